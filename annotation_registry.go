@@ -0,0 +1,339 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// AnnotationTarget identifies the declarations an annotation may be placed
+// on. Targets may be combined to allow several of them.
+type AnnotationTarget int
+
+const (
+	TargetPackage AnnotationTarget = 1 << iota
+	TargetImport
+	TargetStruct
+	TargetField
+	TargetUnion
+	TargetEnum
+	TargetEnumMember
+	TargetService
+	TargetMethod
+	TargetConst
+)
+
+var targetNames = []string{"package", "import", "struct", "field", "union", "enum", "enum member", "service", "method", "const"}
+
+// String returns the declarations allowed by t, such as "structs or fields".
+func (t AnnotationTarget) String() string {
+	var names []string
+	for i, name := range targetNames {
+		if t&(1<<i) != 0 {
+			names = append(names, name+"s")
+		}
+	}
+	switch len(names) {
+	case 0:
+		return "nothing"
+	case 1, 2:
+		return strings.Join(names, " or ")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+}
+
+// name returns the name of t, a single target, such as "enum member".
+func (t AnnotationTarget) name() string {
+	for i, name := range targetNames {
+		if t == 1<<i {
+			return name
+		}
+	}
+	return "declaration"
+}
+
+// ArgType identifies the kinds of values an annotation argument may hold.
+// Types may be combined to accept several of them.
+type ArgType int
+
+const (
+	ArgString    = ArgType(argString)
+	ArgBytes     = ArgType(argBytes)
+	ArgTimestamp = ArgType(argTimestamp)
+	ArgDuration  = ArgType(argDuration)
+	ArgReference = ArgType(argReference)
+	ArgInt       = ArgType(argInt)
+	ArgBool      = ArgType(argBool)
+	ArgFloat     = ArgType(argFloat)
+)
+
+// String returns the kinds of values accepted by t, such as "a string or an
+// integer".
+func (t ArgType) String() string { return argKind(t).String() }
+
+// AnnotationArg describes an argument of a registered annotation.
+type AnnotationArg struct {
+	Name string
+	Type ArgType
+
+	// Required indicates a named argument must be present. Positional
+	// arguments are required unless counted by AnnotationSpec.Optional.
+	Required bool
+}
+
+// AnnotationSpec describes the declarations an annotation may be placed on,
+// and the arguments it takes.
+type AnnotationSpec struct {
+	// Targets lists the declarations the annotation may be placed on. When
+	// zero, it may be placed on any of them.
+	Targets AnnotationTarget
+
+	// Args lists the positional arguments of the annotation, in order.
+	Args []AnnotationArg
+	// Optional is the number of trailing Args which may be omitted.
+	Optional int
+	// Variadic indicates the last of Args may be repeated.
+	Variadic bool
+
+	// Named lists the named arguments of the annotation, such as method in
+	// @route(method = "GET").
+	Named []AnnotationArg
+
+	// Example shows a valid use, included in diagnostics.
+	Example string
+}
+
+// signature returns the positional arguments of s in the form used by
+// built-in annotations.
+func (s *AnnotationSpec) signature() builtinAnnotation {
+	b := builtinAnnotation{optional: s.Optional, variadic: s.Variadic, example: s.Example}
+	for _, arg := range s.Args {
+		b.params = append(b.params, argKind(arg.Type))
+		b.names = append(b.names, arg.Name)
+	}
+	return b
+}
+
+// check validates the arguments of a against s.
+func (s *AnnotationSpec) check(a *ast.Annotation) error {
+	b := s.signature()
+	if len(s.Args) == 0 && len(s.Named) == 0 {
+		if len(a.Arguments) > 0 || len(a.NamedArguments) > 0 {
+			return fmt.Errorf("@%s does not take arguments", a.Name)
+		}
+		return nil
+	}
+	if err := b.checkArguments(a); err != nil {
+		return err
+	}
+
+	for _, arg := range a.NamedArguments {
+		i := indexOfArg(s.Named, arg.Name)
+		if i == -1 {
+			return b.errorf("@%s has no argument named %s", a.Name, arg.Name)
+		}
+		if kind := argKind(s.Named[i].Type); argKindOf(arg.Value)&kind == 0 {
+			return b.errorf("argument %s of @%s must be %s, got %s", arg.Name, a.Name, kind, argKindOf(arg.Value))
+		}
+	}
+	for _, named := range s.Named {
+		if named.Required && a.Arg(named.Name) == nil {
+			return b.errorf("@%s requires argument %s", a.Name, named.Name)
+		}
+	}
+	return nil
+}
+
+func indexOfArg(args []AnnotationArg, name string) int {
+	for i, arg := range args {
+		if arg.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// annotationRegistry holds the annotations registered through
+// RegisterAnnotation, by name.
+var annotationRegistry = struct {
+	sync.RWMutex
+	specs map[string]AnnotationSpec
+}{specs: map[string]AnnotationSpec{}}
+
+// RegisterAnnotation declares the annotation name, such as http or
+// go.package, so that its targets and arguments are checked when compiling
+// schemas using it, instead of by the generators consuming it. It is meant to
+// be called from init functions, and panics when name is already registered
+// or understood by the compiler itself, or when spec is invalid.
+func RegisterAnnotation(name string, spec AnnotationSpec) {
+	if err := checkAnnotationSpec(name, &spec); err != nil {
+		panic("idl: RegisterAnnotation: " + err.Error())
+	}
+	annotationRegistry.Lock()
+	defer annotationRegistry.Unlock()
+	if _, ok := annotationRegistry.specs[name]; ok {
+		panic("idl: RegisterAnnotation: @" + name + " is already registered")
+	}
+	spec.Args = append([]AnnotationArg(nil), spec.Args...)
+	spec.Named = append([]AnnotationArg(nil), spec.Named...)
+	annotationRegistry.specs[name] = spec
+}
+
+func checkAnnotationSpec(name string, spec *AnnotationSpec) error {
+	a := ast.Annotation{Name: name}
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid annotation name %q", name)
+	}
+	if _, ok := builtinAnnotations[name]; ok {
+		return fmt.Errorf("@%s is a built-in annotation", name)
+	}
+	if a.Namespace() == arfAnnotationNamespace {
+		return fmt.Errorf("@%s belongs to the reserved %s namespace", name, arfAnnotationNamespace)
+	}
+	if spec.Optional < 0 || spec.Optional > len(spec.Args) {
+		return fmt.Errorf("@%s declares %d optional arguments out of %d", name, spec.Optional, len(spec.Args))
+	}
+	if spec.Variadic && len(spec.Args) == 0 {
+		return fmt.Errorf("@%s is variadic but declares no arguments", name)
+	}
+	for i, arg := range spec.Named {
+		if arg.Name == "" {
+			return fmt.Errorf("named argument %d of @%s has no name", i+1, name)
+		}
+		if indexOfArg(spec.Named[:i], arg.Name) != -1 {
+			return fmt.Errorf("argument %s of @%s is declared more than once", arg.Name, name)
+		}
+	}
+	return nil
+}
+
+// registeredAnnotation returns the spec registered for the annotation name.
+func registeredAnnotation(name string) (AnnotationSpec, bool) {
+	annotationRegistry.RLock()
+	defer annotationRegistry.RUnlock()
+	spec, ok := annotationRegistry.specs[name]
+	return spec, ok
+}
+
+// registeredAnnotations returns a copy of the registered specs, by name.
+func registeredAnnotations() map[string]AnnotationSpec {
+	annotationRegistry.RLock()
+	defer annotationRegistry.RUnlock()
+	res := make(map[string]AnnotationSpec, len(annotationRegistry.specs))
+	for name, spec := range annotationRegistry.specs {
+		res[name] = spec
+	}
+	return res
+}
+
+// validateAnnotationSpecs checks the annotations of the entrypoint
+// registered through RegisterAnnotation against their specs, and ensures
+// built-in annotations are placed on the declarations they apply to. It must
+// run after validatePhase2, as arguments referencing declarations are
+// resolved by it.
+func validateAnnotationSpecs(files map[string]*ast.File, entrypoint string) error {
+	f, ok := files[entrypoint]
+	if !ok {
+		return fmt.Errorf("BUG: validation entrypoint %s not found", entrypoint)
+	}
+
+	v := &annotationValidator{specs: registeredAnnotations()}
+	walkAnnotations(f, v.validate)
+	return errors.Join(v.errors...)
+}
+
+type annotationValidator struct {
+	specs  map[string]AnnotationSpec
+	errors []error
+}
+
+func (v *annotationValidator) Errorf(pos ast.Position, format string, args ...interface{}) {
+	v.errors = append(v.errors, newDiagnostic(SeverityError, pos, format, args...))
+}
+
+// walkAnnotations calls fn with the annotations of every declaration of f,
+// along with the kind and name of the declaration.
+func walkAnnotations(f *ast.File, fn func(set ast.AnnotationSet, target AnnotationTarget, name string)) {
+	fn(f.Package.Annotations, TargetPackage, f.Package.Value)
+	for _, imp := range f.Imports {
+		name := imp.Value
+		if !imp.ByPackage {
+			name = strconv.Quote(name)
+		}
+		fn(imp.Annotations, TargetImport, name)
+	}
+	for _, c := range f.Consts {
+		fn(c.Annotations, TargetConst, c.Name)
+	}
+
+	walkEnum := func(e *ast.Enum) {
+		fn(e.Annotations, TargetEnum, e.Name)
+		for _, m := range e.Members {
+			fn(m.Annotations, TargetEnumMember, e.Name+"."+m.Name)
+		}
+	}
+	var walkStruct func(s *ast.Struct)
+	walkStruct = func(s *ast.Struct) {
+		fn(s.Annotations, TargetStruct, s.Name)
+		for _, field := range s.Fields {
+			if field.Parent != s {
+				// Merged from a re-opening declaration
+				continue
+			}
+			fn(field.Annotations, TargetField, s.Name+"."+field.Name)
+		}
+		for _, u := range s.Unions {
+			fn(u.Annotations, TargetUnion, s.Name+"."+u.Name)
+		}
+		for _, e := range s.Enums {
+			walkEnum(e)
+		}
+		for _, n := range s.Structs {
+			walkStruct(n)
+		}
+	}
+	for _, s := range f.Structs {
+		walkStruct(s)
+	}
+	for _, e := range f.Enums {
+		walkEnum(e)
+	}
+	for _, s := range f.Services {
+		fn(s.Annotations, TargetService, s.Name)
+		for _, m := range s.Methods {
+			fn(m.Annotations, TargetMethod, s.Name+"."+m.Name)
+		}
+	}
+}
+
+// validate checks the annotations of set, placed on the declaration name of
+// kind target.
+func (v *annotationValidator) validate(set ast.AnnotationSet, target AnnotationTarget, name string) {
+	for _, a := range set {
+		if b, ok := builtinAnnotations[a.Name]; ok {
+			v.checkTarget(&a, b.targets, target, name)
+			continue
+		}
+		spec, ok := v.specs[a.Name]
+		if !ok || !v.checkTarget(&a, spec.Targets, target, name) {
+			continue
+		}
+		if err := spec.check(&a); err != nil {
+			v.Errorf(a.Position, "%s", err)
+		}
+	}
+}
+
+// checkTarget reports a, placed on the declaration name of kind target,
+// unless targets allows it. It returns whether a is allowed.
+func (v *annotationValidator) checkTarget(a *ast.Annotation, targets, target AnnotationTarget, name string) bool {
+	if targets == 0 || targets&target != 0 {
+		return true
+	}
+	v.Errorf(a.Position, "@%s cannot be placed on %s %s; it only applies to %s", a.Name, target.name(), name, targets)
+	return false
+}
@@ -0,0 +1,380 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// arfAnnotationNamespace is reserved for annotations understood by the
+// compiler itself. Annotations within other namespaces (e.g. @go.package) are
+// kept as-is for generators to consume.
+const arfAnnotationNamespace = "arf"
+
+// arfAnnotations lists the annotations known to this compiler version within
+// the arf namespace.
+var arfAnnotations = map[string]struct{}{
+	"deprecated": {},
+}
+
+func isKnownArfAnnotation(a *ast.Annotation) bool {
+	_, ok := arfAnnotations[a.LocalName()]
+	return ok
+}
+
+// argKind identifies the kinds of values annotation arguments may hold. Kinds
+// may be combined to accept several of them.
+type argKind int
+
+const (
+	argString argKind = 1 << iota
+	argBytes
+	argTimestamp
+	argDuration
+	argReference
+	argInt
+	argBool
+	argFloat
+)
+
+var argKindNames = []string{"a string", "a byte string", "a timestamp", "a duration", "a reference", "an integer", "a boolean", "a floating-point number"}
+
+func (k argKind) String() string {
+	var names []string
+	for i, name := range argKindNames {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	switch len(names) {
+	case 0:
+		return "unknown"
+	case 1, 2:
+		return strings.Join(names, " or ")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+}
+
+var argKindTypes = []string{"string", "bytes", "timestamp", "duration", "reference", "int64", "bool", "float64"}
+
+// typeName returns k as written in signatures, such as string | duration.
+func (k argKind) typeName() string {
+	var names []string
+	for i, name := range argKindTypes {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " | ")
+}
+
+// argKindOf returns the kind of v, an annotation argument.
+func argKindOf(v any) argKind {
+	switch v := v.(type) {
+	case string:
+		return argString
+	case []byte:
+		return argBytes
+	case time.Time:
+		return argTimestamp
+	case time.Duration:
+		return argDuration
+	case *ast.AnnotationReference:
+		// Constants stand for their values
+		if c, ok := v.ResolvedObject.(*ast.Const); ok {
+			if _, ok := c.Value.(uint64); ok {
+				return argInt
+			}
+			return argKindOf(c.Value)
+		}
+		return argReference
+	case int64:
+		return argInt
+	case bool:
+		return argBool
+	case float64:
+		return argFloat
+	}
+	return 0
+}
+
+// builtinAnnotation describes the arguments accepted by an annotation
+// understood by the compiler. They may also be passed by name, as in
+// @http(method = "POST", path = "/users"), and are then bound to the position
+// of the param of the same name.
+type builtinAnnotation struct {
+	// params lists the kinds accepted by each argument, and names the name
+	// each one is documented with.
+	params []argKind
+	names  []string
+	// optional is the number of trailing params which may be omitted.
+	optional int
+	// variadic indicates the last param may be repeated.
+	variadic bool
+	// example shows a valid use, included in diagnostics.
+	example string
+	// targets lists the declarations the annotation may be placed on. When
+	// zero, it may be placed on any of them.
+	targets AnnotationTarget
+}
+
+// builtinAnnotations lists the annotations understood by the compiler, by
+// name. Their arguments are checked by validatorP1 before any of them is
+// interpreted, so later phases and generators can rely on their shape.
+var builtinAnnotations = map[string]builtinAnnotation{
+	"arf.deprecated": {params: []argKind{argString}, names: []string{"reason"}, optional: 1, targets: deprecationTargets, example: `@arf.deprecated("use Other instead")`},
+	"default":        {params: []argKind{argString | argBytes | argTimestamp | argDuration | argReference | argInt | argBool | argFloat}, names: []string{"value"}, example: `@default("10")`},
+	"deprecated":     {params: []argKind{argString}, names: []string{"reason"}, optional: 1, targets: deprecationTargets, example: `@deprecated("use NewThing instead")`},
+	"errors":         {params: []argKind{argReference}, names: []string{"codes"}, variadic: true, example: `@errors(ErrorCode.NOT_FOUND)`},
+	"go.tag":         {params: []argKind{argString}, names: []string{"tag"}, example: `@go.tag("json:\"user_id\"")`},
+	"http":           {params: []argKind{argString, argString}, names: []string{"method", "path"}, example: `@http("GET", "/users/{id}")`},
+	"id":             {params: []argKind{argString | argInt}, names: []string{"id"}, targets: TargetService | TargetMethod, example: `@id("0x12ab")`},
+	"idempotent":     {},
+	"max_length":     {params: []argKind{argString | argInt}, names: []string{"length"}, example: `@max_length(64)`},
+	"max_size":       {params: []argKind{argString | argInt}, names: []string{"bytes"}, targets: TargetStruct, example: `@max_size(1024)`},
+	"placeholder":    {},
+	"range":          {params: []argKind{argString | argInt | argFloat, argString | argInt | argFloat}, names: []string{"min", "max"}, example: `@range(0, 100)`},
+	"readonly":       {},
+	"stability":      {params: []argKind{argString}, names: []string{"level"}, example: `@stability("beta")`},
+	"timeout":        {params: []argKind{argString | argDuration}, names: []string{"duration"}, example: `@timeout(5s)`},
+	"ts.name":        {params: []argKind{argString}, names: []string{"name"}, example: `@ts.name("userId")`},
+	"wire_name":      {params: []argKind{argString}, names: []string{"name"}, example: `@wire_name("userId")`},
+}
+
+// deprecationTargets lists the declarations which may be deprecated.
+const deprecationTargets = TargetStruct | TargetField | TargetEnum | TargetEnumMember | TargetService | TargetMethod
+
+// checkBuiltinAnnotation validates the arguments of a against its signature,
+// provided it is a built-in annotation.
+func checkBuiltinAnnotation(a *ast.Annotation) error {
+	b, ok := builtinAnnotations[a.Name]
+	if !ok {
+		return nil
+	}
+	if len(b.params) == 0 {
+		if len(a.Arguments) > 0 || len(a.NamedArguments) > 0 {
+			return fmt.Errorf("@%s does not take arguments", a.Name)
+		}
+		return nil
+	}
+	if err := b.bindNamedArguments(a); err != nil {
+		return err
+	}
+	return b.checkArguments(a)
+}
+
+// bindNamedArguments moves the named arguments of a to the positions of the
+// params they name, so later phases only deal with positional arguments.
+func (b builtinAnnotation) bindNamedArguments(a *ast.Annotation) error {
+	if len(a.NamedArguments) == 0 {
+		return nil
+	}
+	args := slices.Clone(a.Arguments)
+	for _, arg := range a.NamedArguments {
+		i := slices.Index(b.names, arg.Name)
+		switch {
+		case i == -1:
+			return b.errorf("@%s has no argument named %s", a.Name, arg.Name)
+		case b.variadic && i == len(b.names)-1:
+			return b.errorf("argument %s of @%s may be repeated, and cannot be named", arg.Name, a.Name)
+		case i < len(args) && args[i] != nil:
+			return b.errorf("argument %s of @%s is already passed by position", arg.Name, a.Name)
+		}
+		for len(args) <= i {
+			args = append(args, nil)
+		}
+		args[i] = arg.Value
+	}
+	for i, arg := range args {
+		if arg == nil {
+			return b.errorf("@%s requires argument %s", a.Name, b.names[i])
+		}
+	}
+	a.Arguments, a.NamedArguments = args, nil
+	return nil
+}
+
+// checkArguments validates the positional arguments of a against the params
+// of b.
+func (b builtinAnnotation) checkArguments(a *ast.Annotation) error {
+	n, required := len(a.Arguments), len(b.params)-b.optional
+	switch {
+	case b.variadic && n < required:
+		return b.errorf("@%s expects at least %s, got %d", a.Name, pluralArguments(required), n)
+	case !b.variadic && (n < required || n > len(b.params)):
+		expected := pluralArguments(len(b.params))
+		if b.optional > 0 {
+			expected = "at most " + expected
+		}
+		return b.errorf("@%s expects %s, got %d", a.Name, expected, n)
+	}
+
+	for i, arg := range a.Arguments {
+		kind := b.params[min(i, len(b.params)-1)]
+		if ref, ok := arg.(*ast.AnnotationReference); ok && ref.ResolvedObject == nil {
+			// References may name constants, checked by validatePhase2 once
+			// resolved
+			continue
+		}
+		if argKindOf(arg)&kind == 0 {
+			return b.errorf("argument %d of @%s must be %s, got %s", i+1, a.Name, kind, argKindOf(arg))
+		}
+	}
+	return nil
+}
+
+// errorf returns an error formatted according to format, followed by the
+// example of b, if any.
+func (b builtinAnnotation) errorf(format string, args ...any) error {
+	if b.example != "" {
+		format += "; for example, %s"
+		args = append(args, b.example)
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// languageTags lists the annotations refining how generators of a target
+// language name or tag struct fields, along with the check of their value.
+// Their signature is declared by builtinAnnotations.
+var languageTags = map[string]func(string) error{
+	"go.tag":  checkGoTag,
+	"ts.name": checkTSName,
+}
+
+// checkLanguageTag validates the value of a, provided it is a language tag
+// with a well-formed signature.
+func checkLanguageTag(a *ast.Annotation) error {
+	check, ok := languageTags[a.Name]
+	if !ok {
+		return nil
+	}
+	v, ok := singleStringArgument(a)
+	if !ok {
+		// Reported by checkBuiltinAnnotation
+		return nil
+	}
+	if err := check(v); err != nil {
+		return fmt.Errorf("invalid @%s %q: %w", a.Name, v, err)
+	}
+	return nil
+}
+
+// checkStability validates the level declared by a, provided it is a
+// @stability annotation with a well-formed signature.
+func checkStability(a *ast.Annotation) error {
+	if a.Name != "stability" {
+		return nil
+	}
+	v, ok := singleStringArgument(a)
+	if !ok || slices.Contains(ast.Stabilities, ast.Stability(v)) {
+		return nil
+	}
+	levels := make([]string, len(ast.Stabilities))
+	for i, l := range ast.Stabilities {
+		levels[i] = string(l)
+	}
+	return fmt.Errorf("invalid @stability %q: expected one of %s", v, strings.Join(levels, ", "))
+}
+
+// checkGoTag ensures tag follows the conventional format of Go struct tags,
+// as parsed by reflect.StructTag: space-separated key:"value" pairs, keys
+// being unique.
+func checkGoTag(tag string) error {
+	if tag == "" {
+		return errors.New("tag is empty")
+	}
+	seen := map[string]bool{}
+	for tag != "" {
+		if tag[0] == ' ' {
+			tag = tag[1:]
+			continue
+		}
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return errors.New(`expected key:"value" pairs separated by spaces`)
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		// Find the closing quote, skipping escaped ones
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return fmt.Errorf("unterminated value of key %s", key)
+		}
+		if _, err := strconv.Unquote(tag[:i+1]); err != nil {
+			return fmt.Errorf("invalid value of key %s", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate key %s", key)
+		}
+		seen[key] = true
+		tag = tag[i+1:]
+		if tag != "" && tag[0] != ' ' {
+			return fmt.Errorf("expected a space after the value of key %s", key)
+		}
+	}
+	return nil
+}
+
+// checkTSName ensures name is a valid TypeScript identifier.
+func checkTSName(name string) error {
+	for i, r := range name {
+		if r == '_' || r == '$' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r) {
+			continue
+		}
+		return errors.New("name must be a valid identifier")
+	}
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	return nil
+}
+
+func pluralArguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// singleStringArgument returns the only argument of a, provided it has exactly
+// one positional string argument.
+func singleStringArgument(a *ast.Annotation) (string, bool) {
+	if len(a.Arguments) != 1 || len(a.NamedArguments) != 0 {
+		return "", false
+	}
+	v, ok := a.Arguments[0].(string)
+	return v, ok
+}
+
+// isAnnotationReference indicates whether v, an annotation argument, is a
+// reference.
+func isAnnotationReference(v any) bool {
+	_, ok := v.(*ast.AnnotationReference)
+	return ok
+}
+
+// singleDurationArgument returns the only argument of a, provided it has
+// exactly one positional duration literal argument, such as 30s.
+func singleDurationArgument(a *ast.Annotation) (time.Duration, bool) {
+	if len(a.Arguments) != 1 || len(a.NamedArguments) != 0 {
+		return 0, false
+	}
+	v, ok := a.Arguments[0].(time.Duration)
+	return v, ok
+}
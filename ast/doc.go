@@ -0,0 +1,155 @@
+package ast
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Doc is the documentation of a declaration, normalized from its comments so
+// generators and documentation tools render it consistently.
+type Doc struct {
+	// Text holds the comment lines written before the declaration, or the
+	// comment following it on the same line when there are none. Lines are
+	// stripped of the indentation they share and of trailing spaces, and
+	// joined by newlines; leading and trailing blank lines are dropped, as
+	// is the deprecation paragraph.
+	Text string
+
+	// Deprecated indicates the declaration is deprecated, either through
+	// @arf.deprecated or @deprecated, or through a comment paragraph
+	// starting with "Deprecated:". DeprecationNote holds the reason given by
+	// either, if any, the annotation taking precedence.
+	Deprecated      bool
+	DeprecationNote string
+}
+
+// Summary returns the first sentence of the documentation.
+func (d Doc) Summary() string {
+	para, _, _ := strings.Cut(d.Text, "\n\n")
+	para = strings.Join(strings.Fields(para), " ")
+	for i, r := range para {
+		if r == '.' && (i+1 == len(para) || para[i+1] == ' ') {
+			return para[:i+1]
+		}
+	}
+	return para
+}
+
+// DocOf returns the documentation of obj. Objects which cannot be commented,
+// such as imports, have no documentation.
+func DocOf(obj Object) Doc {
+	var lines []string
+	var trailing string
+	var annotations AnnotationSet
+	switch o := obj.(type) {
+	case *Package:
+		lines = o.Comment
+	case *Struct:
+		lines, annotations = o.Comment, o.Annotations
+	case *StructField:
+		lines, trailing, annotations = o.Comment, o.TrailingComment, o.Annotations
+	case *Enum:
+		lines, annotations = o.Comment, o.Annotations
+	case *EnumMember:
+		lines, trailing, annotations = o.Comment, o.TrailingComment, o.Annotations
+	case *Service:
+		lines, annotations = o.Comment, o.Annotations
+	case *ServiceMethod:
+		lines, trailing, annotations = o.Comment, o.TrailingComment, o.Annotations
+	}
+	if len(lines) == 0 && trailing != "" {
+		lines = []string{trailing}
+	}
+
+	var doc Doc
+	var paragraphs []string
+	for _, para := range strings.Split(normalizeComment(lines), "\n\n") {
+		if note, ok := strings.CutPrefix(para, "Deprecated:"); ok {
+			doc.Deprecated = true
+			doc.DeprecationNote = strings.Join(strings.Fields(note), " ")
+			continue
+		}
+		if para != "" {
+			paragraphs = append(paragraphs, para)
+		}
+	}
+	doc.Text = strings.Join(paragraphs, "\n\n")
+
+	for _, name := range []string{"arf.deprecated", "deprecated"} {
+		a := annotations.ByName(name)
+		if a == nil {
+			continue
+		}
+		doc.Deprecated = true
+		if len(a.Arguments) > 0 {
+			if note, ok := a.Arguments[0].(string); ok && note != "" {
+				doc.DeprecationNote = note
+			}
+		}
+		break
+	}
+	return doc
+}
+
+// normalizeComment strips lines of the indentation they share, and of
+// trailing spaces, and joins them. Consecutive blank lines are collapsed,
+// and leading and trailing ones dropped.
+func normalizeComment(lines []string) string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeftFunc(l, unicode.IsSpace))
+		if indent == -1 || n < indent {
+			indent = n
+		}
+	}
+
+	var b strings.Builder
+	blank := false
+	for _, l := range lines {
+		l = strings.TrimRightFunc(l, unicode.IsSpace)
+		if l == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if blank {
+			b.WriteString("\n\n")
+		} else if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		blank = false
+		b.WriteString(l[indent:])
+	}
+	return b.String()
+}
+
+// Deprecated reports whether s is deprecated, along with the reason given,
+// if any. See DocOf.
+func (s *Struct) Deprecated() (bool, string) { return deprecationOf(s) }
+
+// Deprecated reports whether f is deprecated, along with the reason given,
+// if any. See DocOf.
+func (f *StructField) Deprecated() (bool, string) { return deprecationOf(f) }
+
+// Deprecated reports whether e is deprecated, along with the reason given,
+// if any. See DocOf.
+func (e *Enum) Deprecated() (bool, string) { return deprecationOf(e) }
+
+// Deprecated reports whether m is deprecated, along with the reason given,
+// if any. See DocOf.
+func (m *EnumMember) Deprecated() (bool, string) { return deprecationOf(m) }
+
+// Deprecated reports whether s is deprecated, along with the reason given,
+// if any. See DocOf.
+func (s *Service) Deprecated() (bool, string) { return deprecationOf(s) }
+
+// Deprecated reports whether m is deprecated, along with the reason given,
+// if any. See DocOf.
+func (m *ServiceMethod) Deprecated() (bool, string) { return deprecationOf(m) }
+
+func deprecationOf(obj Object) (bool, string) {
+	doc := DocOf(obj)
+	return doc.Deprecated, doc.DeprecationNote
+}
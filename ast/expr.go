@@ -0,0 +1,65 @@
+package ast
+
+// Expr is a constant expression, such as 1 << 2 or FIRST + 1, used to define
+// the value of enum members.
+type Expr interface {
+	Pos() *Position
+	String() string
+}
+
+// IntLiteral is a decimal or hexadecimal integer. Raw holds it as written.
+type IntLiteral struct {
+	Position Position
+	Raw      string
+	Value    int64
+
+	// Unsigned indicates the literal exceeds int64 while fitting in uint64,
+	// such as 18446744073709551615. Value then holds its bits, and the
+	// literal may only be the whole value of an unsigned constant.
+	Unsigned bool
+}
+
+func (l *IntLiteral) Pos() *Position { return &l.Position }
+func (l *IntLiteral) String() string { return l.Raw }
+
+// ConstRef references a constant by name, such as another member of the same
+// enum, or a constant qualified by the alias of an imported package, such as
+// common.MAX_PAGE_SIZE. Resolved is set once the reference is evaluated.
+type ConstRef struct {
+	Position Position
+	Name     string
+	Resolved Object
+}
+
+func (r *ConstRef) Pos() *Position { return &r.Position }
+func (r *ConstRef) String() string { return r.Name }
+
+// UnaryExpr applies Op, either - or ~, to X.
+type UnaryExpr struct {
+	Position Position
+	Op       string
+	X        Expr
+}
+
+func (u *UnaryExpr) Pos() *Position { return &u.Position }
+func (u *UnaryExpr) String() string { return u.Op + u.X.String() }
+
+// BinaryExpr applies Op, such as + or <<, to X and Y.
+type BinaryExpr struct {
+	Position Position
+	Op       string
+	X        Expr
+	Y        Expr
+}
+
+func (b *BinaryExpr) Pos() *Position { return &b.Position }
+func (b *BinaryExpr) String() string { return b.X.String() + " " + b.Op + " " + b.Y.String() }
+
+// ParenExpr is an expression wrapped in parentheses.
+type ParenExpr struct {
+	Position Position
+	X        Expr
+}
+
+func (p *ParenExpr) Pos() *Position { return &p.Position }
+func (p *ParenExpr) String() string { return "(" + p.X.String() + ")" }
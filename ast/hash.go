@@ -0,0 +1,306 @@
+package ast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CanonicalHash returns a digest of the semantically relevant contents of
+// every package in the tree: declarations, their names, types, values and
+// annotations. Comments, formatting, positions, the order of annotations, and
+// the way declarations are split across files do not affect it, so peers
+// may compare digests to detect schema drift.
+func (t *Tree) CanonicalHash() string {
+	h := newCanonicalHasher()
+	names := make([]string, 0, len(t.Packages))
+	for name := range t.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg := t.Packages[name]
+		fmt.Fprintf(h, "package %s\n", name)
+		var decls []Object
+		var walk func(s *Struct)
+		walk = func(s *Struct) {
+			decls = append(decls, s)
+			for _, e := range s.Enums {
+				decls = append(decls, e)
+			}
+			for _, n := range s.Structs {
+				walk(n)
+			}
+		}
+		for _, s := range pkg.Structures {
+			walk(s)
+		}
+		for _, e := range pkg.Enums {
+			decls = append(decls, e)
+		}
+		for _, s := range pkg.Services {
+			decls = append(decls, s)
+		}
+		for _, c := range pkg.Consts {
+			decls = append(decls, c)
+		}
+		h.writeAll(decls)
+	}
+	return h.sum()
+}
+
+// CanonicalHash returns a digest of the struct, its fields, and every struct
+// and enum they reference, directly or not. See Tree.CanonicalHash.
+func (s *Struct) CanonicalHash() string { return canonicalHashOf(s) }
+
+// CanonicalHash returns a digest of the enum and its members. See
+// Tree.CanonicalHash.
+func (e *Enum) CanonicalHash() string { return canonicalHashOf(e) }
+
+// CanonicalHash returns a digest of the service, its methods, and every
+// struct and enum they reference, directly or not. See Tree.CanonicalHash.
+func (s *Service) CanonicalHash() string { return canonicalHashOf(s) }
+
+func canonicalHashOf(root Object) string {
+	h := newCanonicalHasher()
+	seen := map[Object]bool{root: true}
+	queue := []Object{root}
+	for i := 0; i < len(queue); i++ {
+		for _, ref := range references(queue[i]) {
+			if !seen[ref] {
+				seen[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+	h.write(root)
+	h.writeAll(queue[1:])
+	return h.sum()
+}
+
+// references returns the structs and enums referenced by the types of obj.
+func references(obj Object) []Object {
+	var refs []Object
+	var visit func(t Type)
+	visit = func(t Type) {
+		switch tt := t.(type) {
+		case *ArrayType:
+			visit(tt.Type)
+		case *SetType:
+			visit(tt.Type)
+		case *OptionalType:
+			visit(tt.Type)
+		case *MapType:
+			visit(tt.Key)
+			visit(tt.Value)
+		case ResolvableType:
+			if r := tt.Resolved(); r != nil {
+				refs = append(refs, r)
+			}
+		}
+	}
+	switch o := obj.(type) {
+	case *Struct:
+		if o.Extends != nil {
+			visit(o.Extends)
+		}
+		for _, f := range o.Fields {
+			visit(f.Type)
+		}
+	case *Service:
+		if o.Errors != nil {
+			refs = append(refs, o.Errors)
+		}
+		for _, m := range o.Methods {
+			for _, p := range m.Params {
+				visit(p.Type)
+			}
+			for _, r := range m.Returns {
+				visit(r.Type)
+			}
+			for _, e := range m.Errors {
+				visit(e.Type)
+			}
+		}
+	}
+	return refs
+}
+
+type canonicalHasher struct {
+	hash.Hash
+}
+
+func newCanonicalHasher() *canonicalHasher {
+	return &canonicalHasher{sha256.New()}
+}
+
+func (c *canonicalHasher) sum() string { return hex.EncodeToString(c.Sum(nil)) }
+
+// writeAll writes decls sorted by their fully qualified name, so the order
+// in which they were declared does not matter.
+func (c *canonicalHasher) writeAll(decls []Object) {
+	sorted := append([]Object(nil), decls...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].FQN() < sorted[j].FQN() })
+	for _, d := range sorted {
+		c.write(d)
+	}
+}
+
+func (c *canonicalHasher) write(obj Object) {
+	switch o := obj.(type) {
+	case *Struct:
+		var extends string
+		if o.Extends != nil {
+			extends = " extends " + canonicalType(o.Extends)
+		}
+		fmt.Fprintf(c, "struct %s%s%s\n", o.FQN(), extends, canonicalAnnotations(o.Annotations))
+		for _, f := range o.Fields {
+			var index, union string
+			if f.IndexDeclared {
+				index = " = " + strconv.Itoa(f.Index)
+			}
+			if f.Union != nil {
+				union = " in " + f.Union.Name
+			}
+			fmt.Fprintf(c, "  field %s %s%s%s%s\n", f.Name, canonicalType(f.Type), index, union, canonicalAnnotations(f.Annotations))
+		}
+		c.writeReserved(o.Reserved)
+	case *Const:
+		fmt.Fprintf(c, "const %s %s = %s%s\n", o.FQN(), canonicalType(o.Type), canonicalValue(o.Value), canonicalAnnotations(o.Annotations))
+	case *Enum:
+		flags := ""
+		if o.Flags {
+			flags = "flags "
+		}
+		fmt.Fprintf(c, "enum %s%s%s\n", flags, o.FQN(), canonicalAnnotations(o.Annotations))
+		for _, m := range o.Members {
+			fmt.Fprintf(c, "  member %s %d%s\n", m.Name, m.Value, canonicalAnnotations(m.Annotations))
+		}
+		c.writeReserved(o.Reserved)
+	case *Service:
+		fmt.Fprintf(c, "service %s%s\n", o.FQN(), canonicalAnnotations(o.Annotations))
+		for _, m := range o.Methods {
+			var params, returns []string
+			for _, p := range m.Params {
+				param := canonicalType(p.Type)
+				if p.Name != nil {
+					param = *p.Name + " " + param
+				}
+				if p.Stream {
+					param = "stream " + param
+				}
+				params = append(params, param)
+			}
+			for _, r := range m.Returns {
+				if _, ok := r.Type.(*EmptyType); ok {
+					// Returning empty is the same as declaring no returns
+					continue
+				}
+				ret := canonicalType(r.Type)
+				if r.Stream {
+					ret = "stream " + ret
+				}
+				returns = append(returns, ret)
+			}
+			var throws string
+			if len(m.Errors) > 0 {
+				errs := make([]string, len(m.Errors))
+				for i, e := range m.Errors {
+					errs[i] = canonicalType(e.Type)
+				}
+				throws = " throws (" + strings.Join(errs, ", ") + ")"
+			}
+			fmt.Fprintf(c, "  method %s(%s) -> (%s)%s%s\n", m.Name, strings.Join(params, ", "), strings.Join(returns, ", "), throws, canonicalAnnotations(m.Annotations))
+		}
+	}
+}
+
+// writeReserved writes the indices and names of reserved, sorted, as their
+// grouping into statements does not matter.
+func (c *canonicalHasher) writeReserved(reserved []*Reserved) {
+	var indices []int
+	var names []string
+	for _, r := range reserved {
+		indices = append(indices, r.Indices...)
+		names = append(names, r.Names...)
+	}
+	sort.Ints(indices)
+	sort.Strings(names)
+	for _, i := range indices {
+		fmt.Fprintf(c, "  reserved %d\n", i)
+	}
+	for _, n := range names {
+		fmt.Fprintf(c, "  reserved %q\n", n)
+	}
+}
+
+func canonicalType(t Type) string {
+	switch tt := t.(type) {
+	case *PrimitiveType:
+		return tt.Name
+	case *ArrayType:
+		return "array<" + canonicalType(tt.Type) + ">"
+	case *SetType:
+		return "set<" + canonicalType(tt.Type) + ">"
+	case *OptionalType:
+		return "optional<" + canonicalType(tt.Type) + ">"
+	case *MapType:
+		return "map<" + canonicalType(tt.Key) + ", " + canonicalType(tt.Value) + ">"
+	case ResolvableType:
+		if r := tt.Resolved(); r != nil {
+			return r.FQN()
+		}
+		if fqn := tt.FQN(); fqn != "" {
+			return fqn
+		}
+		// Types of trees that were not validated are only known by the
+		// name they were declared with.
+		return tt.DeclaredName()
+	}
+	return "?"
+}
+
+// canonicalAnnotations returns annotations as a sorted list, preceded by a
+// space, or an empty string when there are none.
+func canonicalAnnotations(set AnnotationSet) string {
+	if len(set) == 0 {
+		return ""
+	}
+	annotations := make([]string, 0, len(set))
+	for _, a := range set {
+		args := make([]string, 0, len(a.Arguments)+len(a.NamedArguments))
+		for _, v := range a.Arguments {
+			args = append(args, canonicalValue(v))
+		}
+		named := append([]NamedArgument(nil), a.NamedArguments...)
+		sort.SliceStable(named, func(i, j int) bool { return named[i].Name < named[j].Name })
+		for _, n := range named {
+			args = append(args, n.Name+"="+canonicalValue(n.Value))
+		}
+		annotations = append(annotations, "@"+a.Name+"("+strings.Join(args, ", ")+")")
+	}
+	sort.Strings(annotations)
+	return " " + strings.Join(annotations, " ")
+}
+
+func canonicalValue(v any) string {
+	switch vv := v.(type) {
+	case string:
+		return strconv.Quote(vv)
+	case []byte:
+		return "x\"" + hex.EncodeToString(vv) + "\""
+	case time.Time:
+		return vv.UTC().Format(time.RFC3339Nano)
+	case *AnnotationReference:
+		if r := vv.Resolved(); r != nil {
+			return r.FQN()
+		}
+		return vv.Name
+	}
+	return fmt.Sprintf("%T(%v)", v, v)
+}
@@ -1,8 +1,13 @@
 package ast
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 )
 
 type Container interface {
@@ -19,6 +24,7 @@ type PackageTree struct {
 	Structures []*Struct
 	Enums      []*Enum
 	Services   []*Service
+	Consts     []*Const
 	Imports    []*Import
 	Package    string
 }
@@ -35,7 +41,9 @@ func (t *Tree) AddFile(file *File) {
 	}
 	tree.Files = append(tree.Files, file)
 	for _, v := range file.Structs {
-		tree.Structures = append(tree.Structures, v)
+		if v.Reopens == nil {
+			tree.Structures = append(tree.Structures, v)
+		}
 	}
 	for _, v := range file.Enums {
 		tree.Enums = append(tree.Enums, v)
@@ -43,11 +51,189 @@ func (t *Tree) AddFile(file *File) {
 	for _, v := range file.Services {
 		tree.Services = append(tree.Services, v)
 	}
+	for _, v := range file.Consts {
+		tree.Consts = append(tree.Consts, v)
+	}
 	for _, v := range file.Imports {
 		tree.Imports = append(tree.Imports, v)
 	}
 }
 
+// FindStruct returns the struct named name, such as User or, for nested
+// structs, User.Address, or nil in case none is declared by the package.
+func (t *PackageTree) FindStruct(name string) *Struct {
+	comps := strings.Split(name, ".")
+	var s *Struct
+	for _, st := range t.Structures {
+		if st.Name == comps[0] {
+			s = st
+			break
+		}
+	}
+	for _, c := range comps[1:] {
+		if s == nil {
+			return nil
+		}
+		s = s.FindStruct(c)
+	}
+	return s
+}
+
+// FindEnum returns the enum named name, such as Status or, for enums nested
+// within structs, User.Status, or nil in case none is declared by the
+// package.
+func (t *PackageTree) FindEnum(name string) *Enum {
+	parent, name, nested := strings.Cut(name, ".")
+	if !nested {
+		for _, e := range t.Enums {
+			if e.Name == parent {
+				return e
+			}
+		}
+		return nil
+	}
+	idx := strings.LastIndex(name, ".")
+	container := parent
+	if idx != -1 {
+		container, name = parent+"."+name[:idx], name[idx+1:]
+	}
+	if s := t.FindStruct(container); s != nil {
+		return s.FindEnum(name)
+	}
+	return nil
+}
+
+// FindService returns the service named name, or nil in case none is
+// declared by the package.
+func (t *PackageTree) FindService(name string) *Service {
+	for _, s := range t.Services {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// FindConst returns the constant named name, or nil in case none is
+// declared by the package.
+func (t *PackageTree) FindConst(name string) *Const {
+	for _, c := range t.Consts {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// lookup returns the top-level declaration named name.
+func (t *PackageTree) lookup(name string) Object {
+	if s := t.FindStruct(name); s != nil {
+		return s
+	}
+	if e := t.FindEnum(name); e != nil {
+		return e
+	}
+	if s := t.FindService(name); s != nil {
+		return s
+	}
+	if c := t.FindConst(name); c != nil {
+		return c
+	}
+	return nil
+}
+
+// Collision is reported by Merge when both trees declare the same name in
+// the same package, from different files.
+type Collision struct {
+	FQN      string
+	Existing Object
+	Incoming Object
+}
+
+func (c *Collision) Error() string {
+	ex, in := c.Existing.Pos(), c.Incoming.Pos()
+	return fmt.Sprintf("%s %s at %s, line %d, column %d, is already declared at %s, line %d, column %d",
+		strings.ToLower(c.Incoming.Kind()), c.FQN, in.Filename, in.Line, in.Column, ex.Filename, ex.Line, ex.Column)
+}
+
+// Merge adds the files of other, a tree compiled separately, to t. Files
+// found in both trees, such as common imports, are only kept once. When
+// files of other declare names already declared by t, a Collision is
+// returned for each of them, and t is left untouched.
+func (t *Tree) Merge(other *Tree) error {
+	seen := map[string]bool{}
+	for _, pkg := range t.Packages {
+		for _, f := range pkg.Files {
+			seen[f.Path] = true
+		}
+	}
+	var incoming []*File
+	for _, name := range sortedPackages(other) {
+		for _, f := range other.Packages[name].Files {
+			if !seen[f.Path] {
+				seen[f.Path] = true
+				incoming = append(incoming, f)
+			}
+		}
+	}
+
+	var errs []error
+	for _, f := range incoming {
+		pkg, ok := t.Packages[f.Package.Value]
+		if !ok {
+			continue
+		}
+		var decls []Object
+		for _, s := range f.Structs {
+			decls = append(decls, s)
+		}
+		for _, e := range f.Enums {
+			decls = append(decls, e)
+		}
+		for _, s := range f.Services {
+			decls = append(decls, s)
+		}
+		for _, c := range f.Consts {
+			decls = append(decls, c)
+		}
+		for _, d := range decls {
+			if ex := pkg.lookup(nameOf(d)); ex != nil {
+				errs = append(errs, &Collision{FQN: d.FQN(), Existing: ex, Incoming: d})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, f := range incoming {
+		t.AddFile(f)
+	}
+	return nil
+}
+
+func nameOf(obj Object) string {
+	switch o := obj.(type) {
+	case *Struct:
+		return o.Name
+	case *Enum:
+		return o.Name
+	case *Service:
+		return o.Name
+	case *Const:
+		return o.Name
+	}
+	return ""
+}
+
+func sortedPackages(t *Tree) []string {
+	names := make([]string, 0, len(t.Packages))
+	for name := range t.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type Position struct {
 	Filename string
 	Line     int
@@ -66,6 +252,7 @@ type File struct {
 	Structs       []*Struct
 	Enums         []*Enum
 	Services      []*Service
+	Consts        []*Const
 	Package       *Package
 	Imports       []*Import
 	ImportAliases map[string]string
@@ -93,10 +280,25 @@ func (f *File) FindStruct(name string) *Struct {
 	return nil
 }
 
+// FindConst returns the constant named name declared by the file, or nil.
+func (f *File) FindConst(name string) *Const {
+	for _, c := range f.Consts {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
 type Package struct {
 	Position   Position
+	Comment    []string
 	Value      string
 	Components []string
+
+	// Annotations are declared before the package statement, and usually
+	// hold options of generators for the whole file, such as @go_package.
+	Annotations AnnotationSet
 }
 
 func (p *Package) Kind() string    { return "Package" }
@@ -109,6 +311,30 @@ type Import struct {
 	Value         string
 	ResolvedValue string
 	Alias         string
+
+	// Public indicates the import is re-exported, as in
+	// import public "base.arf";, so files importing this one may refer to
+	// the imported types as if they imported them directly.
+	Public bool
+
+	// ByPackage indicates Value names a package, as in
+	// import org.example.common;, instead of a path.
+	ByPackage bool
+	// Files lists the files the import resolved to, sorted: every file
+	// declaring the imported package, or matching a pattern such as
+	// "common/*". ResolvedValue is the first of them.
+	Files []string
+
+	// AliasSynthesized indicates Alias was derived from the imported package
+	// name instead of being explicitly declared through "as".
+	AliasSynthesized bool
+
+	// PathEnd is the position right after the imported path, and End the
+	// one right after the semicolon ending the import.
+	PathEnd Position
+	End     Position
+
+	Annotations AnnotationSet
 }
 
 func (i *Import) Kind() string    { return "Import" }
@@ -125,11 +351,73 @@ type Struct struct {
 	Structs     []*Struct
 	Enums       []*Enum
 	Parent      *Struct
+
+	// Unions lists the unions declared by the struct. Their members are
+	// part of Fields as well.
+	Unions []*Union
+
+	// Reserved lists the field indices and names the struct may not use.
+	Reserved []*Reserved
+
+	// Extends references the struct this one extends, as in
+	// struct Admin extends User, or is nil. Inherited fields precede the
+	// ones of the struct itself; see AllFields.
+	Extends ResolvableType
+
+	// Inline indicates the struct was declared inline, as the type of a
+	// field or method return, and named after it: the address field of a
+	// User declares User.Address, and the Get method of Users returns
+	// UsersGetResponse.
+	Inline bool
+
+	// Reopens is the declaration this one re-opens, when several files of
+	// the same package declare the struct. The fields of every declaration
+	// are merged into the Fields of the one they re-open, while Fields of
+	// re-opening declarations only hold their own. Re-opening declarations
+	// are left out of PackageTree.Structures.
+	Reopens *Struct
+
+	// End is the position right after the closing brace of the struct.
+	End Position
 }
 
 func (*Struct) Kind() string     { return "Struct" }
 func (s *Struct) Pos() *Position { return &s.Position }
 
+// Original returns the declaration s re-opens, or s itself.
+func (s *Struct) Original() *Struct {
+	if s.Reopens != nil {
+		return s.Reopens
+	}
+	return s
+}
+
+// Base returns the struct s extends, or nil when it extends none or the base
+// is not resolved.
+func (s *Struct) Base() *Struct {
+	if s.Extends == nil {
+		return nil
+	}
+	base, _ := s.Extends.Resolved().(*Struct)
+	return base
+}
+
+// AllFields returns the fields s inherits from its bases, outermost first,
+// followed by its own.
+func (s *Struct) AllFields() []*StructField {
+	var chain []*Struct
+	seen := map[*Struct]bool{}
+	for st := s; st != nil && !seen[st]; st = st.Base() {
+		seen[st] = true
+		chain = append(chain, st)
+	}
+	var fields []*StructField
+	for i := len(chain) - 1; i >= 0; i-- {
+		fields = append(fields, chain[i].Fields...)
+	}
+	return fields
+}
+
 func (s *Struct) AppendStruct(st *Struct) {
 	st.Parent = s
 	s.Structs = append(s.Structs, st)
@@ -142,9 +430,27 @@ func (s *Struct) AppendEnum(e *Enum) {
 
 func (s *Struct) AppendField(f StructField) {
 	f.Parent = s
+	if !f.IndexDeclared {
+		f.Index = len(s.Fields)
+	}
 	s.Fields = append(s.Fields, &f)
 }
 
+// AppendUnion appends u to the unions of s, and its members to the fields of
+// s.
+func (s *Struct) AppendUnion(u *Union) {
+	u.Parent = s
+	for _, f := range u.Fields {
+		f.Parent = s
+		f.Union = u
+		if !f.IndexDeclared {
+			f.Index = len(s.Fields)
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	s.Unions = append(s.Unions, u)
+}
+
 func (s *Struct) FindEnum(name string) *Enum {
 	for _, e := range s.Enums {
 		if e.Name == name {
@@ -184,6 +490,78 @@ type StructField struct {
 	Name        string
 	Type        Type
 	Parent      *Struct
+
+	// Union is the union the field is a member of, if any.
+	Union *Union
+
+	// TrailingComment holds a comment written on the same line as the field,
+	// after its semicolon.
+	TrailingComment string
+
+	// Index identifies the field in binary encodings. It is declared after
+	// the field type, as in `id int64 = 1;`, in which case IndexDeclared is
+	// set. Otherwise, it is the position of the field within its struct.
+	Index         int
+	IndexDeclared bool
+
+	// Default holds the value declared through @default, converted to the
+	// field type: int64, uint64, float64, bool, string, []byte, time.Time,
+	// or *EnumMember.
+	// DefaultRef holds the reference it was declared with, if any.
+	Default    any
+	DefaultRef *AnnotationReference
+
+	// Constraints holds the restrictions declared on the values of the
+	// field through constraint annotations, or nil when there are none.
+	Constraints *Constraints
+}
+
+// Constraints restricts the values accepted by a field, as declared through
+// @max_length and @range. Validators and generators should rely on it rather
+// than interpreting the annotations themselves.
+type Constraints struct {
+	// MaxLength is the maximum length of strings and bytes, or the maximum
+	// number of items of arrays and maps, set through @max_length. It is zero
+	// when unset.
+	MaxLength uint64
+
+	// Min and Max are the inclusive bounds set through @range, converted to
+	// the field type: int64, uint64 or float64. Both are nil when unset.
+	Min, Max any
+}
+
+// WireName returns the name used to identify the field on the wire. It
+// defaults to the field name, and can be overridden through @wire_name.
+func (s *StructField) WireName() string {
+	if a := s.Annotations.ByName("wire_name"); a != nil && len(a.Arguments) == 1 {
+		if v, ok := a.Arguments[0].(string); ok && v != "" {
+			return v
+		}
+	}
+	return s.Name
+}
+
+// GoTag returns the struct tag declared through @go.tag, such as
+// json:"user_id", for Go generators to attach to the field.
+func (s *StructField) GoTag() reflect.StructTag {
+	if a := s.Annotations.ByName("go.tag"); a != nil && len(a.Arguments) == 1 {
+		if v, ok := a.Arguments[0].(string); ok {
+			return reflect.StructTag(v)
+		}
+	}
+	return ""
+}
+
+// TSName returns the name of the property TypeScript generators declare for
+// the field. It defaults to the field name, and can be overridden through
+// @ts.name.
+func (s *StructField) TSName() string {
+	if a := s.Annotations.ByName("ts.name"); a != nil && len(a.Arguments) == 1 {
+		if v, ok := a.Arguments[0].(string); ok && v != "" {
+			return v
+		}
+	}
+	return s.Name
 }
 
 func (*StructField) Kind() string      { return "Struct Field" }
@@ -191,6 +569,77 @@ func (s *StructField) Pos() *Position  { return &s.Position }
 func (s *StructField) BaseFQN() string { return s.Parent.FQN() }
 func (s *StructField) FQN() string     { return s.BaseFQN() + "." + s.Name }
 
+// Const is a constant declared at the top level of a file, such as
+// `const MAX_PAGE_SIZE uint32 = 100;`.
+type Const struct {
+	Position    Position
+	Annotations AnnotationSet
+	Comment     []string
+	Name        string
+	Type        Type
+
+	// Expr holds the value of constants written as integer expressions,
+	// such as 100 or PAGE_SIZE * 2, which may reference other constants of
+	// the file, or of imported ones. Literal holds the value of others, as
+	// written: a string, float64, bool, []byte, time.Time, or
+	// time.Duration.
+	Expr    Expr
+	Literal any
+
+	// Value holds the value of the constant converted to its type: int64,
+	// uint64, float64, bool, string, []byte, or time.Time. It is set once
+	// the file is validated.
+	Value any
+
+	// TrailingComment holds a comment written on the same line as the
+	// constant, after its semicolon.
+	TrailingComment string
+}
+
+func (*Const) Kind() string      { return "Const" }
+func (c *Const) Pos() *Position  { return &c.Position }
+func (c *Const) BaseFQN() string { return c.Position.File.BaseFQN() }
+func (c *Const) FQN() string     { return c.BaseFQN() + "." + c.Name }
+
+// Reserved is a reserved statement, such as reserved 4, 5; or
+// reserved "old_name";, keeping the indices or names of removed fields and
+// enum members from being reused.
+type Reserved struct {
+	Position Position
+	Indices  []int
+	Names    []string
+}
+
+// ReservesIndex indicates whether index is one of r.Indices.
+func (r *Reserved) ReservesIndex(index int) bool {
+	return slices.Contains(r.Indices, index)
+}
+
+// ReservesName indicates whether name is one of r.Names.
+func (r *Reserved) ReservesName(name string) bool {
+	return slices.Contains(r.Names, name)
+}
+
+// Union groups fields of a struct of which at most one holds a value at a
+// time. Its members are also part of the Fields of the struct, in the order
+// they are declared.
+type Union struct {
+	Position    Position
+	Name        string
+	Comment     []string
+	Annotations AnnotationSet
+	Fields      []*StructField
+	Parent      *Struct
+
+	// End is the position right after the closing brace of the union.
+	End Position
+}
+
+func (*Union) Kind() string      { return "Union" }
+func (u *Union) Pos() *Position  { return &u.Position }
+func (u *Union) BaseFQN() string { return u.Parent.FQN() }
+func (u *Union) FQN() string     { return u.BaseFQN() + "." + u.Name }
+
 type Enum struct {
 	Position    Position
 	Annotations AnnotationSet
@@ -198,6 +647,16 @@ type Enum struct {
 	Name        string
 	Members     []*EnumMember
 	Parent      *Struct
+
+	// Flags indicates the enum was declared as enum flags: its members are
+	// bits, which values of the enum may combine.
+	Flags bool
+
+	// Reserved lists the member values and names the enum may not use.
+	Reserved []*Reserved
+
+	// End is the position right after the closing brace of the enum.
+	End Position
 }
 
 func (*Enum) Kind() string     { return "Enum" }
@@ -209,6 +668,15 @@ func (e *Enum) BaseFQN() string {
 	return e.Position.File.BaseFQN()
 }
 
+func (e *Enum) FindMember(name string) *EnumMember {
+	for _, m := range e.Members {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
 func (e *Enum) AppendMember(i EnumMember) {
 	i.Enum = e
 	e.Members = append(e.Members, &i)
@@ -233,6 +701,17 @@ type EnumMember struct {
 	Name        string
 	Value       int
 	Enum        *Enum
+
+	// Expr holds the expression the member value was declared with, such
+	// as 0x04 or FIRST << 1. Value holds its result.
+	Expr Expr
+	// Implicit indicates the member was declared without a value, and
+	// follows the previous member, or zero for the first one.
+	Implicit bool
+
+	// TrailingComment holds a comment written on the same line as the member,
+	// after its semicolon.
+	TrailingComment string
 }
 
 func (*EnumMember) Kind() string      { return "Enum Member" }
@@ -241,9 +720,37 @@ func (m *EnumMember) BaseFQN() string { return m.Enum.BaseFQN() }
 func (m *EnumMember) FQN() string     { return m.Enum.FQN() + "." + m.Name }
 
 type Annotation struct {
-	Position  Position
-	Name      string
-	Arguments []any
+	Position       Position
+	Name           string
+	Arguments      []any
+	NamedArguments []NamedArgument
+}
+
+// Namespace returns the namespace of a namespaced annotation such as
+// @go.package ("go"), or an empty string for plain annotations.
+func (a *Annotation) Namespace() string {
+	if idx := strings.LastIndex(a.Name, "."); idx != -1 {
+		return a.Name[:idx]
+	}
+	return ""
+}
+
+// Arg returns the value of the named argument name, such as "POST" for method
+// in @route(method = "POST"), or nil when a does not declare it. Named
+// arguments of built-in annotations, such as @http, are bound to their
+// positional arguments during validation.
+func (a *Annotation) Arg(name string) any {
+	for _, arg := range a.NamedArguments {
+		if arg.Name == name {
+			return arg.Value
+		}
+	}
+	return nil
+}
+
+// LocalName returns the annotation name without its namespace.
+func (a *Annotation) LocalName() string {
+	return a.Name[strings.LastIndex(a.Name, ".")+1:]
 }
 
 func (*Annotation) Kind() string      { return "Annotation" }
@@ -251,8 +758,40 @@ func (a *Annotation) Pos() *Position  { return &a.Position }
 func (a *Annotation) BaseFQN() string { return a.Position.File.BaseFQN() }
 func (a *Annotation) FQN() string     { return a.BaseFQN() }
 
+// NamedArgument represents an annotation argument in the form name = value.
+type NamedArgument struct {
+	Position Position
+	Name     string
+	Value    any
+}
+
+// AnnotationReference is an annotation argument referencing another
+// declaration, such as RetryPolicy.EXPONENTIAL or the constant MAX_PAGE_SIZE.
+// References are resolved during validation, after which Resolved returns the
+// referenced object.
+type AnnotationReference struct {
+	Position       Position
+	Name           string
+	ResolvedObject Object
+}
+
+func (r *AnnotationReference) Pos() *Position   { return &r.Position }
+func (r *AnnotationReference) Resolved() Object { return r.ResolvedObject }
+func (r *AnnotationReference) String() string   { return r.Name }
+
+// Value returns the value of the constant r references, or nil when it
+// references another kind of declaration.
+func (r *AnnotationReference) Value() any {
+	if c, ok := r.ResolvedObject.(*Const); ok {
+		return c.Value
+	}
+	return nil
+}
+
 type AnnotationSet []Annotation
 
+// ByName returns the first annotation named name, or nil in case none is
+// present. Use AllByName for annotations that may be repeated.
 func (a AnnotationSet) ByName(name string) *Annotation {
 	for _, a := range a {
 		if a.Name == name {
@@ -262,12 +801,39 @@ func (a AnnotationSet) ByName(name string) *Annotation {
 	return nil
 }
 
+// AllByName returns every annotation named name, preserving the order in
+// which they were declared.
+func (a AnnotationSet) AllByName(name string) []*Annotation {
+	var res []*Annotation
+	for i := range a {
+		if a[i].Name == name {
+			res = append(res, &a[i])
+		}
+	}
+	return res
+}
+
 type Service struct {
 	Position    Position
 	Comment     []string
 	Annotations AnnotationSet
 	Name        string
 	Methods     []*ServiceMethod
+
+	// Timeout holds the default deadline for the service methods, as declared
+	// through @timeout. Zero means no timeout was declared.
+	Timeout time.Duration
+
+	// ID is the stable identifier declared through @id, unique across
+	// services and surviving renames. Zero means no ID was declared.
+	ID uint32
+
+	// Errors holds the enum declared through @errors, listing the error codes
+	// the service methods may return.
+	Errors *Enum
+
+	// End is the position right after the closing brace of the service.
+	End Position
 }
 
 func (*Service) Kind() string      { return "Service" }
@@ -288,6 +854,96 @@ type ServiceMethod struct {
 	Params      []*MethodParam
 	Returns     []*MethodReturn
 	Service     *Service
+	HTTP        *HTTPBinding
+
+	// Errors lists the structs and enums the method may fail with, as
+	// declared by its throws clause.
+	Errors []*MethodError
+
+	// ClientStreaming and ServerStreaming indicate the method streams its
+	// params or its returns, respectively. Methods doing both are
+	// bidirectional.
+	ClientStreaming bool
+	ServerStreaming bool
+
+	// TrailingComment holds a comment written on the same line as the method,
+	// after its semicolon.
+	TrailingComment string
+
+	// Idempotent indicates the method can be safely retried, either through
+	// @idempotent or @readonly.
+	Idempotent bool
+	// ReadOnly indicates the method has no side effects, as declared through
+	// @readonly. ReadOnly methods are always Idempotent.
+	ReadOnly bool
+
+	// Timeout holds the deadline declared through @timeout on the method
+	// itself. See EffectiveTimeout.
+	Timeout time.Duration
+
+	// ID is the stable identifier declared through @id, unique within the
+	// service and surviving renames. Zero means no ID was declared.
+	ID uint32
+
+	// ErrorCodes holds the subset of the service error enum the method may
+	// return, as declared through @errors. See EffectiveErrorCodes.
+	ErrorCodes []*EnumMember
+
+	// End is the position right after the semicolon ending the method.
+	End Position
+}
+
+// EffectiveErrorCodes returns the error codes the method may return: either
+// the subset declared by the method, or every member of the service errors
+// enum.
+func (s *ServiceMethod) EffectiveErrorCodes() []*EnumMember {
+	if len(s.ErrorCodes) > 0 || s.Service == nil || s.Service.Errors == nil {
+		return s.ErrorCodes
+	}
+	return s.Service.Errors.Members
+}
+
+// Bidirectional indicates the method streams both its params and its
+// returns.
+func (s *ServiceMethod) Bidirectional() bool {
+	return s.ClientStreaming && s.ServerStreaming
+}
+
+// ReturnsNothing indicates the method returns nothing: it either declares no
+// returns, or returns empty.
+func (s *ServiceMethod) ReturnsNothing() bool {
+	if len(s.Returns) == 1 {
+		_, ok := s.Returns[0].Type.(*EmptyType)
+		return ok
+	}
+	return len(s.Returns) == 0
+}
+
+// EffectiveTimeout returns the method timeout, falling back to the one
+// declared by its service.
+func (s *ServiceMethod) EffectiveTimeout() time.Duration {
+	if s.Timeout != 0 || s.Service == nil {
+		return s.Timeout
+	}
+	return s.Service.Timeout
+}
+
+// HTTPBinding represents a validated @http annotation, used by gateway
+// generators to transcode HTTP requests into method calls.
+type HTTPBinding struct {
+	Position Position
+	Method   string
+	Path     string
+	Segments []HTTPPathSegment
+}
+
+// HTTPPathSegment represents a single segment of an HTTP path template. Either
+// Literal or Variable is set; Variable holds the components of a placeholder
+// such as {user.id}, and Field the struct field it is bound to.
+type HTTPPathSegment struct {
+	Literal  string
+	Variable []string
+	Field    *StructField
 }
 
 func (s *ServiceMethod) AppendParam(p *MethodParam) {
@@ -300,6 +956,11 @@ func (s *ServiceMethod) AppendReturn(r *MethodReturn) {
 	s.Returns = append(s.Returns, r)
 }
 
+func (s *ServiceMethod) AppendError(e *MethodError) {
+	e.Method = s
+	s.Errors = append(s.Errors, e)
+}
+
 func (*ServiceMethod) Kind() string      { return "Service Method" }
 func (s *ServiceMethod) Pos() *Position  { return &s.Position }
 func (s *ServiceMethod) BaseFQN() string { return s.Service.BaseFQN() }
@@ -342,3 +1003,15 @@ func (r *MethodReturn) FQN() string     { return r.Method.BaseFQN() }
 func (r *MethodReturn) Eql(other *MethodReturn) bool {
 	return r.Type.Eql(other.Type) && r.Stream == other.Stream
 }
+
+// MethodError is a struct or enum listed by the throws clause of a method.
+type MethodError struct {
+	Position Position
+	Type     ResolvableType
+	Method   *ServiceMethod
+}
+
+func (*MethodError) Kind() string      { return "Method Error" }
+func (e *MethodError) Pos() *Position  { return &e.Position }
+func (e *MethodError) BaseFQN() string { return e.Method.BaseFQN() }
+func (e *MethodError) FQN() string     { return e.Method.BaseFQN() }
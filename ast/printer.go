@@ -3,13 +3,22 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 )
 
+// Print writes a description of file to the standard output.
 func Print(file *File) {
+	Fprint(os.Stdout, file)
+}
+
+// Fprint writes a description of file to w, listing its declarations along
+// with their types, comments and annotations.
+func Fprint(w io.Writer, file *File) {
 	p := printer{}
 	p.print(file)
-	fmt.Println(p.b.String())
+	fmt.Fprintln(w, p.b.String())
 }
 
 type printer struct {
@@ -32,6 +41,8 @@ func (p *printer) print(file *File) {
 	p.printf("File: %s", file.Path)
 	defer p.inc()()
 	p.printf("Package: %s", file.Package.Value)
+	p.printComments(file.Package.Comment)
+	p.printAnnotations(file.Package.Annotations)
 	if len(file.Imports) > 0 {
 		p.printf("Imports:")
 		p.printImports(file.Imports)
@@ -48,16 +59,45 @@ func (p *printer) print(file *File) {
 		p.printf("Services:")
 		p.printServices(file.Services)
 	}
+	if len(file.Consts) > 0 {
+		p.printf("Consts:")
+		p.printConsts(file.Consts)
+	}
+}
+
+func (p *printer) printConsts(consts []*Const) {
+	defer p.inc()()
+	for _, c := range consts {
+		p.printf("- Name: %s", c.Name)
+		p.inc()
+		p.printComments(c.Comment)
+		p.printAnnotations(c.Annotations)
+		p.printType(c.Type)
+		if c.Expr != nil {
+			p.printf("Expr: %s", c.Expr)
+		} else {
+			p.printf("Literal: %s", formatAnnotationValue(c.Literal))
+		}
+		p.printTrailingComment(c.TrailingComment)
+		p.dec()
+	}
 }
 
 func (p *printer) printImports(imports []*Import) {
 	defer p.inc()()
 	for _, imp := range imports {
+		value := imp.Value
+		if imp.Public {
+			value = "public " + value
+		}
 		if imp.Alias != "" {
-			p.printf(" - %s as %s", imp.Value, imp.Alias)
+			p.printf(" - %s as %s", value, imp.Alias)
 		} else {
-			p.printf(" - %s", imp.Value)
+			p.printf(" - %s", value)
 		}
+		p.inc()
+		p.printAnnotations(imp.Annotations)
+		p.dec()
 	}
 }
 
@@ -68,7 +108,14 @@ func (p *printer) printStructs(structs []*Struct) {
 		p.inc() // 1
 		p.printComments(st.Comment)
 		p.printAnnotations(st.Annotations)
+		if st.Extends != nil {
+			p.printf("Extends:")
+			p.inc()
+			p.printType(st.Extends)
+			p.dec()
+		}
 		p.printFields(st.Fields)
+		p.printReserved(st.Reserved)
 		if len(st.Structs) > 0 {
 			p.printf("Structs:")
 			p.printStructs(st.Structs)
@@ -95,11 +142,21 @@ func (p *printer) printComments(c []string) {
 	}
 }
 
+func formatAnnotationValue(v any) string {
+	if ref, ok := v.(*AnnotationReference); ok {
+		return ref.Name
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
 func (p *printer) printAnnotation(v Annotation) {
-	if len(v.Arguments) > 0 {
-		args := make([]string, 0, len(v.Arguments))
+	if len(v.Arguments) > 0 || len(v.NamedArguments) > 0 {
+		args := make([]string, 0, len(v.Arguments)+len(v.NamedArguments))
 		for _, param := range v.Arguments {
-			args = append(args, fmt.Sprintf("%#v", param))
+			args = append(args, formatAnnotationValue(param))
+		}
+		for _, param := range v.NamedArguments {
+			args = append(args, fmt.Sprintf("%s=%s", param.Name, formatAnnotationValue(param.Value)))
 		}
 		p.printf("- %s (%s)", v.Name, strings.Join(args, " "))
 	} else {
@@ -136,10 +193,39 @@ func (p *printer) printField(f *StructField) {
 	p.printf("- %s", f.Name)
 	defer p.inc()()
 	p.printType(f.Type)
+	if f.IndexDeclared {
+		p.printf("Index: %d", f.Index)
+	}
+	if f.Union != nil {
+		p.printf("Union: %s", f.Union.Name)
+	}
 	p.printComments(f.Comment)
+	p.printTrailingComment(f.TrailingComment)
 	p.printAnnotations(f.Annotations)
 }
 
+func (p *printer) printReserved(reserved []*Reserved) {
+	if len(reserved) == 0 {
+		return
+	}
+	p.printf("Reserved:")
+	defer p.inc()()
+	for _, r := range reserved {
+		for _, i := range r.Indices {
+			p.printf("- %d", i)
+		}
+		for _, n := range r.Names {
+			p.printf("- %q", n)
+		}
+	}
+}
+
+func (p *printer) printTrailingComment(c string) {
+	if c != "" {
+		p.printf("Trailing Comment: %s", c)
+	}
+}
+
 func (p *printer) printType(t Type) {
 	switch tt := t.(type) {
 	case *ArrayType:
@@ -147,6 +233,11 @@ func (p *printer) printType(t Type) {
 		p.inc()
 		p.printType(tt.Type)
 		p.dec()
+	case *SetType:
+		p.printf("Kind: Set")
+		p.inc()
+		p.printType(tt.Type)
+		p.dec()
 	case *MapType:
 		p.printf("Kind: Map")
 		p.inc()
@@ -174,6 +265,8 @@ func (p *printer) printType(t Type) {
 		p.printf("Kind: %s", tt.Name)
 	case *FullQualifiedType:
 		p.printf("Kind: %s", tt.FullName)
+	case *EmptyType:
+		p.printf("Kind: empty")
 	}
 }
 
@@ -189,6 +282,10 @@ func (p *printer) printEnum(e *Enum) {
 	defer p.inc()()
 	p.printComments(e.Comment)
 	p.printAnnotations(e.Annotations)
+	if e.Flags {
+		p.printf("Flags: true")
+	}
+	p.printReserved(e.Reserved)
 	p.printf("Members:")
 	defer p.inc()()
 	for _, m := range e.Members {
@@ -196,6 +293,7 @@ func (p *printer) printEnum(e *Enum) {
 		p.inc()
 		p.printAnnotations(m.Annotations)
 		p.printComments(m.Comment)
+		p.printTrailingComment(m.TrailingComment)
 		p.dec()
 	}
 }
@@ -223,6 +321,7 @@ func (p *printer) printServiceMethod(m *ServiceMethod) {
 	p.printf("- Name: %s", m.Name)
 	defer p.inc()()
 	p.printComments(m.Comment)
+	p.printTrailingComment(m.TrailingComment)
 	p.printAnnotations(m.Annotations)
 	if len(m.Params) > 0 {
 		p.printf("Arguments:")
@@ -232,6 +331,10 @@ func (p *printer) printServiceMethod(m *ServiceMethod) {
 		p.printf("Returns:")
 		p.printMethodReturns(m.Returns)
 	}
+	if len(m.Errors) > 0 {
+		p.printf("Throws:")
+		p.printMethodErrors(m.Errors)
+	}
 }
 
 func (p *printer) printMethodParams(params []*MethodParam) {
@@ -249,6 +352,16 @@ func (p *printer) printMethodParams(params []*MethodParam) {
 	}
 }
 
+func (p *printer) printMethodErrors(errors []*MethodError) {
+	defer p.inc()()
+	for idx, e := range errors {
+		p.inc()
+		p.printf("- Index: %d", idx)
+		p.printType(e.Type)
+		p.dec()
+	}
+}
+
 func (p *printer) printMethodReturns(params []*MethodReturn) {
 	defer p.inc()()
 	for idx, param := range params {
@@ -0,0 +1,53 @@
+package ast
+
+// Stability is the maturity of a declaration, as declared through
+// @stability.
+type Stability string
+
+const (
+	StabilityUnspecified  Stability = ""
+	StabilityExperimental Stability = "experimental"
+	StabilityBeta         Stability = "beta"
+	StabilityStable       Stability = "stable"
+)
+
+// Stabilities lists the valid stability levels, from the least to the most
+// stable.
+var Stabilities = []Stability{StabilityExperimental, StabilityBeta, StabilityStable}
+
+// StabilityOf returns the stability declared for obj. Methods without one
+// inherit the stability of their service, and nested structs and enums the
+// one of the struct declaring them.
+func StabilityOf(obj Object) Stability {
+	var annotations AnnotationSet
+	var parent Object
+	switch o := obj.(type) {
+	case *Struct:
+		annotations = o.Annotations
+		if o.Parent != nil {
+			parent = o.Parent
+		}
+	case *Enum:
+		annotations = o.Annotations
+		if o.Parent != nil {
+			parent = o.Parent
+		}
+	case *Service:
+		annotations = o.Annotations
+	case *ServiceMethod:
+		annotations = o.Annotations
+		if o.Service != nil {
+			parent = o.Service
+		}
+	}
+
+	if a := annotations.ByName("stability"); a != nil && len(a.Arguments) == 1 {
+		if v, ok := a.Arguments[0].(string); ok {
+			return Stability(v)
+		}
+	}
+	if parent != nil {
+		return StabilityOf(parent)
+	}
+	return StabilityUnspecified
+}
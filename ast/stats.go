@@ -0,0 +1,87 @@
+package ast
+
+// Stats counts the declarations of a package, or of a whole tree.
+type Stats struct {
+	Files int
+	// Structs and Enums include nested declarations.
+	Structs int
+	Enums   int
+	Fields  int
+
+	Services int
+	Methods  int
+	// StreamingMethods counts methods streaming either their params or
+	// their returns.
+	StreamingMethods int
+
+	// MaxDepth is the deepest nesting level of structs and enums: 1 when all
+	// of them are declared at the top level, or 0 when there are none.
+	MaxDepth int
+}
+
+// Types returns the number of structs and enums.
+func (s Stats) Types() int { return s.Structs + s.Enums }
+
+func (s *Stats) add(other Stats) {
+	s.Files += other.Files
+	s.Structs += other.Structs
+	s.Enums += other.Enums
+	s.Fields += other.Fields
+	s.Services += other.Services
+	s.Methods += other.Methods
+	s.StreamingMethods += other.StreamingMethods
+	s.MaxDepth = max(s.MaxDepth, other.MaxDepth)
+}
+
+// TreeStats holds the statistics of a tree: totals, and a breakdown per
+// package.
+type TreeStats struct {
+	Stats
+	Packages  int
+	ByPackage map[string]Stats
+}
+
+// Stats returns the statistics of the tree.
+func (t *Tree) Stats() *TreeStats {
+	res := &TreeStats{Packages: len(t.Packages), ByPackage: make(map[string]Stats, len(t.Packages))}
+	for name, pkg := range t.Packages {
+		s := pkg.Stats()
+		res.ByPackage[name] = s
+		res.add(s)
+	}
+	return res
+}
+
+// Stats returns the statistics of the package.
+func (t *PackageTree) Stats() Stats {
+	s := Stats{Files: len(t.Files), Services: len(t.Services)}
+	var walk func(st *Struct, depth int)
+	walk = func(st *Struct, depth int) {
+		s.Structs++
+		s.Fields += len(st.Fields)
+		s.MaxDepth = max(s.MaxDepth, depth)
+		if len(st.Enums) > 0 {
+			s.Enums += len(st.Enums)
+			s.MaxDepth = max(s.MaxDepth, depth+1)
+		}
+		for _, n := range st.Structs {
+			walk(n, depth+1)
+		}
+	}
+	for _, st := range t.Structures {
+		walk(st, 1)
+	}
+	if len(t.Enums) > 0 {
+		s.Enums += len(t.Enums)
+		s.MaxDepth = max(s.MaxDepth, 1)
+	}
+	for _, svc := range t.Services {
+		s.Methods += len(svc.Methods)
+		for _, m := range svc.Methods {
+			if m.ClientStreaming || m.ServerStreaming {
+				s.StreamingMethods++
+			}
+		}
+	}
+	return s
+}
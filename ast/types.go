@@ -22,6 +22,23 @@ func (a *ArrayType) Eql(other Type) bool {
 	return false
 }
 
+// SetType holds unique elements of Type, written as set<T>.
+type SetType struct {
+	Position Position
+	Type     Type
+}
+
+func (s *SetType) _type() {}
+
+func (*SetType) Kind() string { return "Set" }
+
+func (s *SetType) Eql(other Type) bool {
+	if ot, ok := other.(*SetType); ok {
+		return s.Type.Eql(ot.Type)
+	}
+	return false
+}
+
 type MapType struct {
 	Position   Position
 	Key, Value Type
@@ -70,6 +87,22 @@ func (p *PrimitiveType) Eql(other Type) bool {
 	return false
 }
 
+// EmptyType is the type of methods returning nothing, written as empty or,
+// in place of returns, as (). It may only be used as the single return of a
+// method.
+type EmptyType struct {
+	Position Position
+}
+
+func (e *EmptyType) _type() {}
+
+func (*EmptyType) Kind() string { return "Empty" }
+
+func (e *EmptyType) Eql(other Type) bool {
+	_, ok := other.(*EmptyType)
+	return ok
+}
+
 type SimpleUserType struct {
 	Position          Position
 	Name              string
@@ -91,6 +124,8 @@ func (u *SimpleUserType) SetFQN(fqn string) { u.FullQualifiedName = fqn }
 
 func (u *SimpleUserType) FQN() string { return u.FullQualifiedName }
 
+func (u *SimpleUserType) DeclaredName() string { return u.Name }
+
 func (u *SimpleUserType) Eql(other Type) bool {
 	switch ot := other.(type) {
 	case *SimpleUserType:
@@ -126,6 +161,8 @@ func (q *FullQualifiedType) SetFQN(fqn string) { q.FullQualifiedName = fqn }
 
 func (q *FullQualifiedType) FQN() string { return q.FullQualifiedName }
 
+func (q *FullQualifiedType) DeclaredName() string { return q.FullName }
+
 func (q *FullQualifiedType) Eql(other Type) bool {
 	switch ot := other.(type) {
 	case *SimpleUserType:
@@ -144,4 +181,7 @@ type ResolvableType interface {
 	Resolved() Object
 	SetFQN(fqn string)
 	FQN() string
+	// DeclaredName returns the name of the type as written in the schema,
+	// which is available even before the type is resolved.
+	DeclaredName() string
 }
@@ -0,0 +1,199 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Buffer holds the contents of a schema being edited, such as an open
+// editor document, along with its tokens. Edits applied through Apply only
+// re-lex the lines they touch, splicing the resulting tokens into the ones
+// already known, so diagnostics can be refreshed while typing.
+type Buffer struct {
+	filename string
+	src      []rune
+	tokens   []token
+
+	// lexErrors holds the diagnostics reported by the lexer, in source
+	// order.
+	lexErrors []*Diagnostic
+}
+
+// NewBuffer returns a Buffer holding src, the contents of filename.
+func NewBuffer(filename string, src []byte) *Buffer {
+	tokens, errs := lexFile(src, nil)
+	return &Buffer{
+		filename:  filename,
+		src:       []rune(string(src)),
+		tokens:    tokens,
+		lexErrors: diagnosticsOf(errors.Join(errs...)),
+	}
+}
+
+// Bytes returns the current contents of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return []byte(string(b.src))
+}
+
+// Apply replaces the text between edit.Start and edit.End, whose columns
+// count characters, with edit.NewText. It returns an error when the range
+// lies outside of the buffer, in which case the buffer is left unchanged.
+func (b *Buffer) Apply(edit TextEdit) error {
+	start, ok := b.offset(edit.Start)
+	end, okEnd := b.offset(edit.End)
+	if !ok || !okEnd || end < start {
+		return fmt.Errorf("invalid edit range %d:%d-%d:%d", edit.Start.Line, edit.Start.Column, edit.End.Line, edit.End.Column)
+	}
+	text := []rune(edit.NewText)
+	delta := len(text) - (end - start)
+	lineDelta := countLines(text) - countLines(b.src[start:end])
+
+	// Tokens never begin in the middle of a line, so lexing restarts at the
+	// line of the edit, or earlier when a token spans several lines, as
+	// block comments and unterminated strings do. Tokens ending right where
+	// the line starts may be extended by the edit, such as block comments
+	// left unterminated at the end of the buffer.
+	restart := lineStart(b.src, start)
+	head := b.tokenAt(restart)
+	for head > 0 && b.tokens[head-1].End >= restart {
+		restart = lineStart(b.src, b.tokens[head-1].Pos)
+		head = b.tokenAt(restart)
+	}
+	restartLine := edit.Start.Line - countLines(b.src[restart:start])
+
+	src := make([]rune, 0, len(b.src)+delta)
+	src = append(src, b.src[:start]...)
+	src = append(src, text...)
+	src = append(src, b.src[end:]...)
+
+	// Lexing stops at the first line past the edit where the old tokens
+	// resume, so the remaining ones can be reused.
+	tail, tailLine := len(b.tokens), -1
+	var errs []error
+	l := &lexer{
+		data:    src,
+		len:     len(src),
+		pos:     restart,
+		line:    restartLine,
+		column:  1,
+		onError: func(err error) { errs = append(errs, err) },
+	}
+	l.stop = func() bool {
+		if l.pos < start+len(text) || l.pos > 0 && src[l.pos-1] != '\n' {
+			return false
+		}
+		old := l.pos - delta
+		if old > 0 && b.src[old-1] != '\n' {
+			return false
+		}
+		i := b.tokenAt(old)
+		if i > 0 && b.tokens[i-1].End > old {
+			return false
+		}
+		tail, tailLine = i, l.line-lineDelta
+		return true
+	}
+	l.scan()
+
+	tokens := make([]token, 0, len(b.tokens)+len(l.tokens))
+	tokens = append(tokens, b.tokens[:head]...)
+	if tailLine == -1 {
+		tokens = append(tokens, l.tokens...)
+	} else {
+		// The EOF token pushed when the lexer stopped is replaced by the
+		// old tokens that follow.
+		tokens = append(tokens, l.tokens[:len(l.tokens)-1]...)
+		for _, t := range b.tokens[tail:] {
+			t.Pos += delta
+			t.End += delta
+			t.Line += lineDelta
+			tokens = append(tokens, t)
+		}
+	}
+
+	var before, after []*Diagnostic
+	for _, d := range b.lexErrors {
+		switch {
+		case d.Position.Line < restartLine:
+			before = append(before, d)
+		case tailLine != -1 && d.Position.Line >= tailLine:
+			moved := *d
+			moved.Position.Line += lineDelta
+			after = append(after, &moved)
+		}
+	}
+
+	b.src = src
+	b.tokens = tokens
+	b.lexErrors = append(append(before, diagnosticsOf(errors.Join(errs...))...), after...)
+	return nil
+}
+
+// Diagnostics parses the buffer, returning the errors reported by the lexer
+// and the parser.
+func (b *Buffer) Diagnostics() []*Diagnostic {
+	var diags []*Diagnostic
+	for _, d := range b.lexErrors {
+		// The lexer is unaware of the file it scans
+		withFile := *d
+		withFile.Position.Filename = b.filename
+		diags = append(diags, &withFile)
+	}
+	_, errs := parse(b.filename, b.tokens, nil)
+	return append(diags, diagnosticsOf(errors.Join(errs...))...)
+}
+
+// Parse parses the buffer, returning the resulting file along with the
+// errors reported by the parser. Files are returned even when incomplete.
+func (b *Buffer) Parse() (*ast.File, []error) {
+	return parse(b.filename, b.tokens, nil)
+}
+
+// tokenAt returns the index of the first token starting at or after offset.
+func (b *Buffer) tokenAt(offset int) int {
+	return sort.Search(len(b.tokens), func(i int) bool { return b.tokens[i].Pos >= offset })
+}
+
+// offset returns the index within the buffer of pos, which may point right
+// past the last character of a line.
+func (b *Buffer) offset(pos ast.Position) (int, bool) {
+	if pos.Line < 1 || pos.Column < 1 {
+		return 0, false
+	}
+	line, i := 1, 0
+	for ; line < pos.Line && i < len(b.src); i++ {
+		if b.src[i] == '\n' {
+			line++
+		}
+	}
+	if line != pos.Line {
+		return 0, false
+	}
+	for col := 1; col < pos.Column; col++ {
+		if i == len(b.src) || b.src[i] == '\n' {
+			return 0, false
+		}
+		i++
+	}
+	return i, true
+}
+
+func lineStart(src []rune, offset int) int {
+	for offset > 0 && src[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+func countLines(src []rune) int {
+	n := 0
+	for _, r := range src {
+		if r == '\n' {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,74 @@
+package idl
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferApply(t *testing.T) {
+	b := NewBuffer("test.arf", []byte("package test;\n\nstruct A {\n    name string;\n}\n"))
+	require.NoError(t, b.Apply(TextEdit{
+		Start:   ast.Position{Line: 4, Column: 5},
+		End:     ast.Position{Line: 4, Column: 9},
+		NewText: "full_name",
+	}))
+	require.Equal(t, "package test;\n\nstruct A {\n    full_name string;\n}\n", string(b.Bytes()))
+	require.Empty(t, b.Diagnostics())
+
+	require.NoError(t, b.Apply(TextEdit{
+		Start:   ast.Position{Line: 4, Column: 22},
+		End:     ast.Position{Line: 4, Column: 22},
+		NewText: "\n    email \"string;",
+	}))
+	diags := b.Diagnostics()
+	require.NotEmpty(t, diags)
+	require.Equal(t, "test.arf", diags[0].Position.Filename)
+	require.Equal(t, 5, diags[0].Position.Line)
+
+	file, _ := b.Parse()
+	require.Equal(t, "A", file.Structs[0].Name)
+
+	require.Error(t, b.Apply(TextEdit{Start: ast.Position{Line: 9, Column: 1}, End: ast.Position{Line: 9, Column: 1}}))
+	require.Error(t, b.Apply(TextEdit{Start: ast.Position{Line: 1, Column: 30}, End: ast.Position{Line: 1, Column: 30}}))
+}
+
+// TestBufferMatchesLexer applies random edits to a schema, checking the
+// spliced tokens against the ones obtained by lexing the whole result.
+func TestBufferMatchesLexer(t *testing.T) {
+	data, err := os.ReadFile("fixtures/full.arf")
+	require.NoError(t, err)
+	snippets := []string{"", "\n", "x", "\"", "'", "#", "/*", "*/", "b\"", "12", "0x", "struct Foo {\n", "}", "->", "@http(\"GET\")", "é"}
+
+	r := rand.New(rand.NewSource(1))
+	b := NewBuffer("full.arf", data)
+	for i := 0; i < 2000; i++ {
+		src := []rune(string(b.Bytes()))
+		start := r.Intn(len(src) + 1)
+		end := min(len(src), start+r.Intn(8))
+		edit := TextEdit{
+			Start:   positionOf(src, start),
+			End:     positionOf(src, end),
+			NewText: snippets[r.Intn(len(snippets))],
+		}
+		require.NoError(t, b.Apply(edit))
+
+		expected := string(src[:start]) + edit.NewText + string(src[end:])
+		require.Equal(t, expected, string(b.Bytes()))
+		tokens, errs := lexFile([]byte(expected), nil)
+		require.Equal(t, tokens, b.tokens, "edit %d: %+v", i, edit)
+		require.Equal(t, diagnosticsOf(errors.Join(errs...)), b.lexErrors, "edit %d: %+v", i, edit)
+	}
+}
+
+func positionOf(src []rune, offset int) ast.Position {
+	before := string(src[:offset])
+	line := strings.Count(before, "\n") + 1
+	column := len([]rune(before[strings.LastIndex(before, "\n")+1:])) + 1
+	return ast.Position{Line: line, Column: column}
+}
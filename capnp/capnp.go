@@ -0,0 +1,394 @@
+// Package capnp exports validated arf trees as Cap'n Proto schemas.
+//
+// Every file, struct, enum and interface receives a stable id derived from the
+// hash of its fully-qualified name, so regenerating schemas never changes ids.
+// Constructs without a direct Cap'n Proto equivalent are approximated, and
+// listed in the returned mapping report:
+//
+//   - maps become lists of generated Entry structs;
+//   - optional scalars become unions of Void and the scalar type;
+//   - unions become named unions whose first member, of type Void, is set
+//     when no other one is;
+//   - enum values become sequential ordinals;
+//   - timestamps become Int64;
+//   - snake_case and SCREAMING_SNAKE_CASE names become camelCase.
+package capnp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+var primitives = map[string]string{
+	"bool":       "Bool",
+	"int8":       "Int8",
+	"int16":      "Int16",
+	"int32":      "Int32",
+	"int64":      "Int64",
+	"uint8":      "UInt8",
+	"uint16":     "UInt16",
+	"uint32":     "UInt32",
+	"uint64":     "UInt64",
+	"float32":    "Float32",
+	"float64":    "Float64",
+	"string":     "Text",
+	"bytes":      "Data",
+	"timestamp":  "Int64",
+	"uuid":       "Data",
+	"duration":   "Int64",
+	"decimal128": "Text",
+}
+
+// Note describes how an element that could not be translated as-is was
+// mapped to Cap'n Proto.
+type Note struct {
+	Position ast.Position
+	Element  string
+	Message  string
+}
+
+func (n Note) String() string {
+	return fmt.Sprintf("%s: %s", n.Element, n.Message)
+}
+
+// ID returns the stable Cap'n Proto id for the given fully-qualified name.
+func ID(fqn string) uint64 {
+	sum := sha256.Sum256([]byte(fqn))
+	return binary.BigEndian.Uint64(sum[:8]) | 1<<63
+}
+
+// SchemaPath returns the path of the schema generated for pkg.
+func SchemaPath(pkg string) string {
+	return strings.ReplaceAll(pkg, ".", "/") + ".capnp"
+}
+
+// Export converts every package in tree into a Cap'n Proto schema, returning
+// the schemas keyed by their path, along with the mapping report.
+func Export(tree *ast.Tree) (map[string][]byte, []Note, error) {
+	names := make([]string, 0, len(tree.Packages))
+	for name := range tree.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make(map[string][]byte, len(names))
+	var notes []Note
+	for _, name := range names {
+		data, n, err := ExportPackage(tree.Packages[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		res[SchemaPath(name)] = data
+		notes = append(notes, n...)
+	}
+	return res, notes, nil
+}
+
+// ExportPackage converts a single package into a Cap'n Proto schema.
+func ExportPackage(pkg *ast.PackageTree) ([]byte, []Note, error) {
+	e := &exporter{pkg: pkg.Package, imports: map[string]string{}}
+	for _, en := range pkg.Enums {
+		e.exportEnum(en, "")
+	}
+	for _, s := range pkg.Structures {
+		if err := e.exportStruct(s, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range pkg.Services {
+		if err := e.exportService(s); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# Code generated from arf package %s. DO NOT EDIT.\n\n", pkg.Package)
+	fmt.Fprintf(&out, "@0x%x;\n", ID(pkg.Package))
+	aliases := make([]string, 0, len(e.imports))
+	for imp := range e.imports {
+		aliases = append(aliases, imp)
+	}
+	sort.Strings(aliases)
+	if len(aliases) > 0 {
+		out.WriteString("\n")
+	}
+	for _, imp := range aliases {
+		fmt.Fprintf(&out, "using %s = import \"/%s\";\n", e.imports[imp], SchemaPath(imp))
+	}
+	out.Write(e.body.Bytes())
+	return out.Bytes(), e.notes, nil
+}
+
+type exporter struct {
+	pkg     string
+	imports map[string]string
+	body    bytes.Buffer
+	notes   []Note
+}
+
+func (e *exporter) printf(indent, format string, args ...any) {
+	e.body.WriteString(indent)
+	fmt.Fprintf(&e.body, format, args...)
+}
+
+func (e *exporter) note(obj ast.Object, format string, args ...any) {
+	e.notes = append(e.notes, Note{
+		Position: *obj.Pos(),
+		Element:  obj.FQN(),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (e *exporter) printComment(comment []string, indent string) {
+	for _, c := range comment {
+		e.printf(indent, "#%s\n", c)
+	}
+}
+
+func (e *exporter) exportEnum(en *ast.Enum, indent string) {
+	members := make([]*ast.EnumMember, len(en.Members))
+	copy(members, en.Members)
+	sort.SliceStable(members, func(i, j int) bool { return members[i].Value < members[j].Value })
+
+	e.printf("", "\n")
+	e.printComment(en.Comment, indent)
+	e.printf(indent, "enum %s @0x%x {\n", en.Name, ID(en.FQN()))
+	for i, m := range members {
+		if m.Value != i {
+			e.note(m, "value %d is exported as ordinal %d", m.Value, i)
+		}
+		e.printComment(m.Comment, indent+"  ")
+		e.printf(indent, "  %s @%d;\n", lowerCamel(m.Name), i)
+	}
+	e.printf(indent, "}\n")
+}
+
+func (e *exporter) exportStruct(s *ast.Struct, indent string) error {
+	e.printf("", "\n")
+	e.printComment(s.Comment, indent)
+	e.printf(indent, "struct %s @0x%x {\n", s.Name, ID(s.FQN()))
+
+	ordinal := 0
+	var entries []*ast.StructField
+	exported := map[*ast.Union]bool{}
+	for _, f := range s.AllFields() {
+		if f.Union == nil {
+			if err := e.exportField(f, indent+"  ", &ordinal, &entries); err != nil {
+				return err
+			}
+			continue
+		}
+		if exported[f.Union] {
+			// Exported along the first member of the union
+			continue
+		}
+		e.note(f.Union, "union is exported with a leading Void member, unset, held when no other member is set")
+		e.printComment(f.Union.Comment, indent+"  ")
+		e.printf(indent, "  %s :union {\n", lowerCamel(f.Union.Name))
+		e.printf(indent, "    unset @%d :Void;\n", ordinal)
+		ordinal++
+		for _, m := range f.Union.Fields {
+			if err := e.exportField(m, indent+"    ", &ordinal, &entries); err != nil {
+				return err
+			}
+		}
+		e.printf(indent, "  }\n")
+		exported[f.Union] = true
+	}
+
+	for _, f := range entries {
+		m := f.Type.(*ast.MapType)
+		key, err := e.typeName(f, m.Key)
+		if err != nil {
+			return err
+		}
+		value, err := e.typeName(f, m.Value)
+		if err != nil {
+			return err
+		}
+		name := upperCamel(f.Name) + "Entry"
+		e.printf("", "\n")
+		e.printf(indent, "  struct %s @0x%x {\n", name, ID(f.FQN()+"$Entry"))
+		e.printf(indent, "    key @0 :%s;\n", key)
+		e.printf(indent, "    value @1 :%s;\n", value)
+		e.printf(indent, "  }\n")
+	}
+	for _, en := range s.Enums {
+		e.exportEnum(en, indent+"  ")
+	}
+	for _, ss := range s.Structs {
+		if err := e.exportStruct(ss, indent+"  "); err != nil {
+			return err
+		}
+	}
+	e.printf(indent, "}\n")
+	return nil
+}
+
+// exportField prints f at indent, numbered from ordinal, which is advanced
+// past the ordinals f takes. Fields holding maps are appended to entries, so
+// their Entry struct is declared once the struct fields are printed.
+func (e *exporter) exportField(f *ast.StructField, indent string, ordinal *int, entries *[]*ast.StructField) error {
+	name := lowerCamel(f.Name)
+	e.printComment(f.Comment, indent)
+	if opt, ok := f.Type.(*ast.OptionalType); ok && isScalar(opt.Type) {
+		typ, err := e.typeName(f, opt.Type)
+		if err != nil {
+			return err
+		}
+		e.note(f, "optional scalar is exported as a union of Void and %s", typ)
+		e.printf(indent, "%s :union {\n", name)
+		e.printf(indent, "  unset @%d :Void;\n", *ordinal)
+		e.printf(indent, "  value @%d :%s;\n", *ordinal+1, typ)
+		e.printf(indent, "}\n")
+		*ordinal += 2
+		return nil
+	}
+
+	typ, err := e.typeName(f, f.Type)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.Type.(*ast.MapType); ok {
+		*entries = append(*entries, f)
+	}
+	e.printf(indent, "%s @%d :%s;\n", name, *ordinal, typ)
+	*ordinal++
+	return nil
+}
+
+func isScalar(t ast.Type) bool {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		p := primitives[tt.Name]
+		return p != "Text" && p != "Data"
+	case ast.ResolvableType:
+		_, ok := tt.Resolved().(*ast.Enum)
+		return ok
+	}
+	return false
+}
+
+func (e *exporter) typeName(owner ast.Object, t ast.Type) (string, error) {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		switch tt.Name {
+		case "timestamp":
+			e.note(owner, "timestamp is exported as Int64 nanoseconds since the Unix epoch")
+		case "uuid":
+			e.note(owner, "uuid is exported as Data holding its 16 bytes")
+		case "duration":
+			e.note(owner, "duration is exported as Int64 nanoseconds")
+		case "decimal128":
+			e.note(owner, "decimal128 is exported as Text holding its decimal representation")
+		}
+		return primitives[tt.Name], nil
+	case ast.ResolvableType:
+		if tt.Resolved() == nil {
+			return "", fmt.Errorf("%s: unresolved type %s", owner.FQN(), tt.DeclaredName())
+		}
+		return e.reference(tt.Resolved()), nil
+	case *ast.OptionalType:
+		// Pointer types are nullable in Cap'n Proto
+		return e.typeName(owner, tt.Type)
+	case *ast.ArrayType:
+		inner, err := e.typeName(owner, tt.Type)
+		return "List(" + inner + ")", err
+	case *ast.SetType:
+		inner, err := e.typeName(owner, tt.Type)
+		e.note(owner, "set is exported as a List")
+		return "List(" + inner + ")", err
+	case *ast.MapType:
+		if f, ok := owner.(*ast.StructField); ok {
+			e.note(owner, "map is exported as a list of %sEntry", upperCamel(f.Name))
+			return "List(" + upperCamel(f.Name) + "Entry)", nil
+		}
+		return "", fmt.Errorf("%s: maps are only supported as struct fields", owner.FQN())
+	default:
+		return "", fmt.Errorf("%s: unsupported type %s", owner.FQN(), t.Kind())
+	}
+}
+
+func (e *exporter) reference(obj ast.Object) string {
+	pkg := obj.Pos().File.Package.Value
+	local := strings.TrimPrefix(obj.FQN(), pkg+".")
+	if pkg == e.pkg {
+		return local
+	}
+	alias, ok := e.imports[pkg]
+	if !ok {
+		alias = upperCamel(strings.ReplaceAll(pkg, ".", "_"))
+		e.imports[pkg] = alias
+	}
+	return alias + "." + local
+}
+
+func (e *exporter) exportService(s *ast.Service) error {
+	e.printf("", "\n")
+	e.printComment(s.Comment, "")
+	e.printf("", "interface %s @0x%x {\n", s.Name, ID(s.FQN()))
+	ordinal := 0
+	for _, m := range s.Methods {
+		if m.ClientStreaming || m.ServerStreaming {
+			e.note(m, "streaming methods are not supported and were not exported")
+			continue
+		}
+		params := make([]string, 0, len(m.Params))
+		for i, p := range m.Params {
+			name := fmt.Sprintf("arg%d", i)
+			if p.Name != nil {
+				name = lowerCamel(*p.Name)
+			}
+			typ, err := e.typeName(p, p.Type)
+			if err != nil {
+				return err
+			}
+			params = append(params, fmt.Sprintf("%s :%s", name, typ))
+		}
+		results := make([]string, 0, len(m.Returns))
+		for i, r := range m.Returns {
+			if _, ok := r.Type.(*ast.EmptyType); ok {
+				continue
+			}
+			typ, err := e.typeName(r, r.Type)
+			if err != nil {
+				return err
+			}
+			results = append(results, fmt.Sprintf("result%d :%s", i, typ))
+		}
+		e.printComment(m.Comment, "  ")
+		e.printf("", "  %s @%d (%s) -> (%s);\n", lowerCamel(m.Name), ordinal, strings.Join(params, ", "), strings.Join(results, ", "))
+		ordinal++
+	}
+	e.printf("", "}\n")
+	return nil
+}
+
+// upperCamel converts snake_case and SCREAMING_SNAKE_CASE names to
+// UpperCamelCase, keeping CamelCase names untouched.
+func upperCamel(s string) string {
+	if !strings.Contains(s, "_") && strings.ToUpper(s) != s {
+		return strings.ToUpper(s[:1]) + s[1:]
+	}
+	var b strings.Builder
+	for _, part := range strings.Split(strings.ToLower(s), "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+func lowerCamel(s string) string {
+	c := upperCamel(s)
+	if c == "" {
+		return c
+	}
+	return strings.ToLower(c[:1]) + c[1:]
+}
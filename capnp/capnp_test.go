@@ -0,0 +1,87 @@
+package capnp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/full.arf")
+	require.NoError(t, err)
+	schemas, notes, err := Export(tree)
+	require.NoError(t, err)
+	require.Len(t, schemas, 3)
+
+	schema := string(schemas["v1beta1/demo/allfeatures.capnp"])
+	require.Contains(t, schema, fmt.Sprintf("@0x%x;", ID("v1beta1.demo.allfeatures")))
+	require.Contains(t, schema, `using V1beta1OtherCommon = import "/v1beta1/other/common.capnp";`)
+	require.Contains(t, schema, fmt.Sprintf("struct Everything @0x%x {", ID("v1beta1.demo.allfeatures.Everything")))
+	require.Contains(t, schema, "  aMapStrU32 @17 :List(AMapStrU32Entry);")
+	require.Contains(t, schema, "  aFromOtherFile @19 :V1beta1OtherCommon.Test;")
+	require.Contains(t, schema, "  struct Nested @0x")
+	require.Contains(t, schema, "  yynn @3 (i :Everything) -> (result0 :Everything);")
+
+	messages := map[string]string{}
+	for _, n := range notes {
+		messages[n.Element] = n.Message
+	}
+	require.Equal(t, "map is exported as a list of AMapStrU32Entry", messages["v1beta1.demo.allfeatures.Everything.a_map_str_u32"])
+	require.Equal(t, "value 1 is exported as ordinal 0", messages["v1beta1.demo.allfeatures.Mode.FIRST"])
+	require.Equal(t, "streaming methods are not supported and were not exported", messages["v1beta1.demo.allfeatures.FeatureTestService.NNYY"])
+}
+
+func TestExportImports(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/imported_types/main.arf")
+	require.NoError(t, err)
+	schemas, _, err := Export(tree)
+	require.NoError(t, err)
+	require.Contains(t, string(schemas["shop/common.capnp"]), "  unit @1 :Unit;")
+	orders := string(schemas["shop/orders.capnp"])
+	require.Contains(t, orders, `using ShopCommon = import "/shop/common.capnp";`)
+	require.Contains(t, orders, "  total @1 :ShopCommon.Money;\n  lines @2 :List(ShopCommon.Money);")
+
+	// Trees that were not validated leave their types unresolved
+	money := tree.Packages["shop.common"].FindStruct("Money")
+	money.AllFields()[1].Type.(ast.ResolvableType).SetResolved(nil)
+	_, _, err = Export(tree)
+	require.EqualError(t, err, "shop.common.Money.unit: unresolved type Unit")
+}
+
+func TestIDsAreStable(t *testing.T) {
+	require.Equal(t, ID("a.b.C"), ID("a.b.C"))
+	require.NotEqual(t, ID("a.b.C"), ID("a.b.D"))
+	require.NotZero(t, ID("a.b.C")&(1<<63))
+}
+
+func TestNames(t *testing.T) {
+	require.Equal(t, "aMapStrU32", lowerCamel("a_map_str_u32"))
+	require.Equal(t, "notFound", lowerCamel("NOT_FOUND"))
+	require.Equal(t, "otherMethod", lowerCamel("OtherMethod"))
+	require.Equal(t, "UserId", upperCamel("user_id"))
+}
+
+func TestExportUnions(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/unions.arf")
+	require.NoError(t, err)
+	schemas, notes, err := Export(tree)
+	require.NoError(t, err)
+	require.Contains(t, string(schemas["contacts.capnp"]), `  id @0 :Text;
+  # Where to reach the contact
+  channel :union {
+    unset @1 :Void;
+    email @2 :Text;
+    phone @3 :Text;
+    extension @4 :UInt16;
+  }
+  nickname @5 :Text;
+}`)
+	require.Contains(t, notes, Note{
+		Position: tree.Packages["contacts"].FindStruct("Contact").Unions[0].Position,
+		Element:  "contacts.Contact.channel",
+		Message:  "union is exported with a leading Void member, unset, held when no other member is set",
+	})
+}
@@ -0,0 +1,181 @@
+// Package cddl exports structs and enums from validated arf trees as CDDL
+// (RFC 8610) definitions, allowing CBOR payloads produced by arf runtimes to be
+// validated by third-party tools.
+//
+// Rules are named after the fully-qualified name of their declaration. Structs
+// are described as maps keyed by the field wire names; optional fields may be
+// either absent or null, unions are described as an optional choice between
+// the groups of their members, as at most one of them is set, and enums are
+// described as a choice of their values.
+package cddl
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+var primitives = map[string]string{
+	"bool":       "bool",
+	"int8":       "-128..127",
+	"int16":      "-32768..32767",
+	"int32":      "-2147483648..2147483647",
+	"int64":      "int",
+	"uint8":      "0..255",
+	"uint16":     "0..65535",
+	"uint32":     "0..4294967295",
+	"uint64":     "uint",
+	"float32":    "float32",
+	"float64":    "float64",
+	"string":     "tstr",
+	"bytes":      "bstr",
+	"timestamp":  "time",
+	"uuid":       "#6.37(bstr .size 16)",
+	"duration":   "int",
+	"decimal128": "decfrac",
+}
+
+// Export returns a CDDL document describing every struct and enum in tree.
+func Export(tree *ast.Tree) ([]byte, error) {
+	names := make([]string, 0, len(tree.Packages))
+	for name := range tree.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e := &exporter{}
+	e.printf("; Code generated from arf packages %s. DO NOT EDIT.\n", strings.Join(names, ", "))
+	for _, name := range names {
+		pkg := tree.Packages[name]
+		for _, en := range pkg.Enums {
+			e.exportEnum(en)
+		}
+		for _, s := range pkg.Structures {
+			if err := e.exportStruct(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return e.out.Bytes(), nil
+}
+
+type exporter struct {
+	out bytes.Buffer
+}
+
+func (e *exporter) printf(format string, args ...any) {
+	fmt.Fprintf(&e.out, format, args...)
+}
+
+func (e *exporter) printComment(comment []string, indent string) {
+	for _, c := range comment {
+		e.printf("%s;%s\n", indent, c)
+	}
+}
+
+func (e *exporter) exportEnum(en *ast.Enum) {
+	e.printf("\n")
+	e.printComment(en.Comment, "")
+	e.printf("%s = &(\n", en.FQN())
+	for i, m := range en.Members {
+		sep := ","
+		if i == len(en.Members)-1 {
+			sep = ""
+		}
+		e.printf("  %s: %d%s\n", m.Name, m.Value, sep)
+	}
+	e.printf(")\n")
+}
+
+func (e *exporter) exportStruct(s *ast.Struct) error {
+	e.printf("\n")
+	e.printComment(s.Comment, "")
+	e.printf("%s = {\n", s.FQN())
+	fields := s.AllFields()
+	exported := map[*ast.Union]bool{}
+	for _, f := range fields {
+		if f.Union != nil && exported[f.Union] {
+			continue
+		}
+		sep := ","
+		if last := fields[len(fields)-1]; f == last || f.Union != nil && f.Union == last.Union {
+			sep = ""
+		}
+		if f.Union != nil {
+			// Members are exported along the first one of their union
+			choices := make([]string, len(f.Union.Fields))
+			for j, m := range f.Union.Fields {
+				typ, err := typeName(m.Type)
+				if err != nil {
+					return fmt.Errorf("%s: %w", m.FQN(), err)
+				}
+				choices[j] = fmt.Sprintf("%q: %s", m.WireName(), typ)
+			}
+			e.printComment(f.Union.Comment, "  ")
+			e.printf("  ? ( %s )%s\n", strings.Join(choices, " // "), sep)
+			exported[f.Union] = true
+			continue
+		}
+		e.printComment(f.Comment, "  ")
+		if opt, ok := f.Type.(*ast.OptionalType); ok {
+			typ, err := typeName(opt.Type)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.FQN(), err)
+			}
+			e.printf("  ? %q: %s / null%s\n", f.WireName(), typ, sep)
+			continue
+		}
+		typ, err := typeName(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.FQN(), err)
+		}
+		e.printf("  %q: %s%s\n", f.WireName(), typ, sep)
+	}
+	e.printf("}\n")
+
+	for _, en := range s.Enums {
+		e.exportEnum(en)
+	}
+	for _, ss := range s.Structs {
+		if err := e.exportStruct(ss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func typeName(t ast.Type) (string, error) {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return primitives[tt.Name], nil
+	case ast.ResolvableType:
+		if tt.Resolved() == nil {
+			return "", fmt.Errorf("unresolved type %s", tt.DeclaredName())
+		}
+		return tt.Resolved().FQN(), nil
+	case *ast.OptionalType:
+		inner, err := typeName(tt.Type)
+		return "(" + inner + " / null)", err
+	case *ast.ArrayType:
+		inner, err := typeName(tt.Type)
+		return "[* " + inner + "]", err
+	case *ast.SetType:
+		// CDDL has no notion of uniqueness
+		inner, err := typeName(tt.Type)
+		return "[* " + inner + "]", err
+	case *ast.MapType:
+		// Map keys are restricted by the validator to primitives and
+		// user-defined types, so the key rule never includes null.
+		key, err := typeName(tt.Key)
+		if err != nil {
+			return "", err
+		}
+		value, err := typeName(tt.Value)
+		return "{* " + key + " => " + value + "}", err
+	default:
+		return "", fmt.Errorf("unsupported type %s", t.Kind())
+	}
+}
@@ -0,0 +1,56 @@
+package cddl
+
+import (
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/full.arf")
+	require.NoError(t, err)
+	data, err := Export(tree)
+	require.NoError(t, err)
+	doc := string(data)
+
+	require.Contains(t, doc, "v1beta1.demo.allfeatures.Mode = &(\n  FIRST: 1,\n  SECOND: 2,\n  THIRD: 3,\n  FOURTH: 4\n)")
+	require.Contains(t, doc, "v1beta1.demo.allfeatures.Everything = {\n")
+	require.Contains(t, doc, `  "a_int8": -128..127,`)
+	require.Contains(t, doc, `  ? "a_opt_string": tstr / null,`)
+	require.Contains(t, doc, `  ? "a_opt_nested": v1beta1.demo.allfeatures.Everything.Nested / null,`)
+	require.Contains(t, doc, `  "a_array_struct": [* v1beta1.demo.allfeatures.Everything.Nested],`)
+	require.Contains(t, doc, `  "a_map_str_arr": {* tstr => [* int]},`)
+	require.Contains(t, doc, `  "a_from_other_file_2": v1beta1.other.utility.Test2`+"\n}")
+	require.Contains(t, doc, "v1beta1.other.common.Test = {\n  \"name\": tstr\n}")
+}
+
+func TestExportImports(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/imported_types/main.arf")
+	require.NoError(t, err)
+	data, err := Export(tree)
+	require.NoError(t, err)
+	doc := string(data)
+	require.Contains(t, doc, "shop.common.Money = {\n  \"amount\": int,\n  \"unit\": shop.common.Unit\n}")
+	require.Contains(t, doc, `  "lines": [* shop.common.Money]`)
+
+	// Trees that were not validated leave their types unresolved
+	money := tree.Packages["shop.common"].FindStruct("Money")
+	money.AllFields()[1].Type.(ast.ResolvableType).SetResolved(nil)
+	_, err = Export(tree)
+	require.EqualError(t, err, "shop.common.Money.unit: unresolved type Unit")
+}
+
+func TestExportUnions(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/unions.arf")
+	require.NoError(t, err)
+	data, err := Export(tree)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `contacts.Contact = {
+  "id": tstr,
+  ; Where to reach the contact
+  ? ( "email": tstr // "phone": tstr // "extension": 0..65535 ),
+  ? "nickname": tstr / null
+}`)
+}
@@ -0,0 +1,275 @@
+// Package compat detects changes between two versions of a schema which
+// would break existing clients or servers.
+//
+// What counts as breaking depends on how messages are exchanged, so checks
+// are grouped into policies: "wire" protects the binary encoding, which
+// identifies fields by their index; "json" protects the JSON encoding, which
+// identifies fields by their wire name and enum members by their name;
+// "strict" combines both and forbids further changes, such as removing
+// optional fields. Organizations may assemble their own policies from the
+// built-in rules and rules of their own, and make them available by name
+// through RegisterPolicy.
+package compat
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Violation is a breaking change found by a Rule.
+type Violation struct {
+	// Rule is the name of the rule reporting the violation.
+	Rule string
+	// Element is the fully qualified name of the changed declaration.
+	Element string
+	// Position locates the change within the new version of the schema, or
+	// within the old one for declarations that were removed.
+	Position ast.Position
+	Message  string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Element, v.Message, v.Rule)
+}
+
+// Rule detects one kind of breaking change.
+type Rule struct {
+	Name        string
+	Description string
+	Check       func(c *Context)
+}
+
+// Policy is a named set of rules.
+type Policy struct {
+	Name  string
+	Rules []Rule
+}
+
+// Context gives rules access to both versions of a schema, paired by fully
+// qualified name, and collects the violations they report.
+type Context struct {
+	Old, New *ast.Tree
+
+	rule       string
+	violations []Violation
+}
+
+// Reportf records a violation of the running rule.
+func (c *Context) Reportf(obj ast.Object, format string, args ...any) {
+	c.violations = append(c.violations, Violation{
+		Rule:     c.rule,
+		Element:  obj.FQN(),
+		Position: *obj.Pos(),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// StructPair holds both versions of a struct. Old is nil for added structs,
+// and New for removed ones.
+type StructPair struct {
+	Old, New *ast.Struct
+}
+
+// EnumPair holds both versions of an enum. Old is nil for added enums, and
+// New for removed ones.
+type EnumPair struct {
+	Old, New *ast.Enum
+}
+
+// ServicePair holds both versions of a service. Old is nil for added
+// services, and New for removed ones.
+type ServicePair struct {
+	Old, New *ast.Service
+}
+
+// FieldPair holds both versions of a field. Old is nil for added fields, and
+// New for removed ones.
+type FieldPair struct {
+	Old, New *ast.StructField
+}
+
+// Structs returns every struct of either version, nested ones included,
+// sorted by name.
+func (c *Context) Structs() []StructPair {
+	old, updated := structsOf(c.Old), structsOf(c.New)
+	var pairs []StructPair
+	for _, name := range unionKeys(old, updated) {
+		pairs = append(pairs, StructPair{Old: old[name], New: updated[name]})
+	}
+	return pairs
+}
+
+// Enums returns every enum of either version, nested ones included, sorted
+// by name.
+func (c *Context) Enums() []EnumPair {
+	old, updated := enumsOf(c.Old), enumsOf(c.New)
+	var pairs []EnumPair
+	for _, name := range unionKeys(old, updated) {
+		pairs = append(pairs, EnumPair{Old: old[name], New: updated[name]})
+	}
+	return pairs
+}
+
+// Services returns every service of either version, sorted by name.
+func (c *Context) Services() []ServicePair {
+	old, updated := servicesOf(c.Old), servicesOf(c.New)
+	var pairs []ServicePair
+	for _, name := range unionKeys(old, updated) {
+		pairs = append(pairs, ServicePair{Old: old[name], New: updated[name]})
+	}
+	return pairs
+}
+
+// Fields pairs the fields, including inherited ones, of both versions of a
+// struct present in both versions, identifying fields through key. Pairs are
+// ordered as the old fields, followed by the added ones.
+func (p StructPair) Fields(key func(i int, f *ast.StructField) string) []FieldPair {
+	if p.Old == nil || p.New == nil {
+		return nil
+	}
+	updated := map[string]*ast.StructField{}
+	for i, f := range p.New.AllFields() {
+		updated[key(i, f)] = f
+	}
+	var pairs []FieldPair
+	seen := map[string]bool{}
+	for i, f := range p.Old.AllFields() {
+		k := key(i, f)
+		seen[k] = true
+		pairs = append(pairs, FieldPair{Old: f, New: updated[k]})
+	}
+	for i, f := range p.New.AllFields() {
+		if !seen[key(i, f)] {
+			pairs = append(pairs, FieldPair{New: f})
+		}
+	}
+	return pairs
+}
+
+// ByIndex identifies fields through their index, either declared or their
+// position within their struct, as the binary encoding does.
+func ByIndex(_ int, f *ast.StructField) string { return fmt.Sprint(f.Index) }
+
+// ByWireName identifies fields through their wire name, as the JSON encoding
+// does.
+func ByWireName(_ int, f *ast.StructField) string { return f.WireName() }
+
+// ByName identifies fields through their name.
+func ByName(_ int, f *ast.StructField) string { return f.Name }
+
+// Check runs the rules of policy against both versions of a schema,
+// returning the violations found, grouped by rule.
+func Check(old, updated *ast.Tree, policy *Policy) []Violation {
+	c := &Context{Old: old, New: updated}
+	for _, rule := range policy.Rules {
+		c.rule = rule.Name
+		rule.Check(c)
+	}
+	return c.violations
+}
+
+var (
+	policiesMu sync.RWMutex
+	policies   = map[string]*Policy{
+		"wire":   {Name: "wire", Rules: WireRules},
+		"json":   {Name: "json", Rules: JSONRules},
+		"strict": {Name: "strict", Rules: StrictRules},
+	}
+)
+
+// RegisterPolicy makes policy available through LookupPolicy, replacing any
+// policy registered under the same name.
+func RegisterPolicy(policy *Policy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[policy.Name] = policy
+}
+
+// LookupPolicy returns the policy registered as name.
+func LookupPolicy(name string) (*Policy, error) {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	p, ok := policies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compatibility policy %q", name)
+	}
+	return p, nil
+}
+
+// Policies returns the names of every registered policy, sorted.
+func Policies() []string {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func structsOf(tree *ast.Tree) map[string]*ast.Struct {
+	res := map[string]*ast.Struct{}
+	var walk func(s *ast.Struct)
+	walk = func(s *ast.Struct) {
+		res[s.FQN()] = s
+		for _, n := range s.Structs {
+			walk(n)
+		}
+	}
+	for _, pkg := range tree.Packages {
+		for _, s := range pkg.Structures {
+			walk(s)
+		}
+	}
+	return res
+}
+
+func enumsOf(tree *ast.Tree) map[string]*ast.Enum {
+	res := map[string]*ast.Enum{}
+	var walk func(s *ast.Struct)
+	walk = func(s *ast.Struct) {
+		for _, e := range s.Enums {
+			res[e.FQN()] = e
+		}
+		for _, n := range s.Structs {
+			walk(n)
+		}
+	}
+	for _, pkg := range tree.Packages {
+		for _, e := range pkg.Enums {
+			res[e.FQN()] = e
+		}
+		for _, s := range pkg.Structures {
+			walk(s)
+		}
+	}
+	return res
+}
+
+func servicesOf(tree *ast.Tree) map[string]*ast.Service {
+	res := map[string]*ast.Service{}
+	for _, pkg := range tree.Packages {
+		for _, s := range pkg.Services {
+			res[s.FQN()] = s
+		}
+	}
+	return res
+}
+
+func unionKeys[T any](a, b map[string]T) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
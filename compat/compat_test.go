@@ -0,0 +1,126 @@
+package compat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func compile(t *testing.T, src string) *ast.Tree {
+	t.Helper()
+	fe, err := idl.New(idl.StdinEntrypoint, idl.WithStdin(strings.NewReader(src)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	return res.Tree
+}
+
+const oldSchema = `package org.example;
+
+struct User {
+    id int64;
+    name string;
+    nickname optional<string>;
+}
+
+struct Legacy {
+    id int64;
+}
+
+enum Role {
+    ADMIN = 0;
+    MEMBER = 1;
+}
+
+service Users {
+    Get(u User) -> User;
+    List(u User) -> stream User;
+    Purge(u User) -> User;
+}
+`
+
+const newSchema = `package org.example;
+
+struct User {
+    id int64;
+    @wire_name("name")
+    full_name string;
+    email string;
+}
+
+enum Role {
+    ADMIN = 0;
+    OWNER = 1;
+}
+
+service Users {
+    Get(u User) -> User;
+    List(u User) -> User;
+}
+`
+
+func check(t *testing.T, policy string) []string {
+	p, err := LookupPolicy(policy)
+	require.NoError(t, err)
+	var res []string
+	for _, v := range Check(compile(t, oldSchema), compile(t, newSchema), p) {
+		res = append(res, v.String())
+	}
+	return res
+}
+
+func TestPolicies(t *testing.T) {
+	require.Equal(t, []string{
+		"org.example.Legacy: struct was removed (type-removed)",
+		"org.example.Users.Purge: method was removed (method-removed)",
+		"org.example.Users.List: signature changed from (org.example.User) -> (stream org.example.User) to (org.example.User) -> (org.example.User) (method-signature-changed)",
+		"org.example.User.email: type of field at index 2 changed from optional<string> to string (wire-field-type-changed)",
+	}, check(t, "wire"))
+
+	// Optional fields may be removed, and fields renamed as long as their
+	// wire name is kept, but enum members are identified by name.
+	require.Equal(t, []string{
+		"org.example.Legacy: struct was removed (type-removed)",
+		"org.example.Users.Purge: method was removed (method-removed)",
+		"org.example.Users.List: signature changed from (org.example.User) -> (stream org.example.User) to (org.example.User) -> (org.example.User) (method-signature-changed)",
+		"org.example.Role: member MEMBER was removed (enum-member-removed)",
+	}, check(t, "json"))
+
+	strict := check(t, "strict")
+	require.Contains(t, strict, "org.example.User: field nickname was removed (field-removed)")
+	require.Contains(t, strict, "org.example.User.email: required field was added (required-field-added)")
+
+	_, err := LookupPolicy("lenient")
+	require.EqualError(t, err, `unknown compatibility policy "lenient"`)
+}
+
+func TestCustomPolicy(t *testing.T) {
+	noEmail := Rule{
+		Name:        "no-email",
+		Description: "fields cannot be named email",
+		Check: func(c *Context) {
+			for _, p := range c.Structs() {
+				if p.New == nil {
+					continue
+				}
+				for _, f := range p.New.Fields {
+					if f.Name == "email" {
+						c.Reportf(f, "field is named email")
+					}
+				}
+			}
+		},
+	}
+	RegisterPolicy(&Policy{Name: "custom", Rules: []Rule{FieldRemoved, noEmail}})
+	require.Contains(t, Policies(), "custom")
+
+	violations := check(t, "custom")
+	require.Equal(t, []string{
+		"org.example.User: field name was removed (field-removed)",
+		"org.example.User: field nickname was removed (field-removed)",
+		"org.example.User.email: field is named email (no-email)",
+	}, violations)
+}
@@ -0,0 +1,301 @@
+package compat
+
+import (
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// TypeRemoved reports structs and enums that were removed.
+var TypeRemoved = Rule{
+	Name:        "type-removed",
+	Description: "structs and enums cannot be removed",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			if p.New == nil {
+				c.Reportf(p.Old, "struct was removed")
+			}
+		}
+		for _, p := range c.Enums() {
+			if p.New == nil {
+				c.Reportf(p.Old, "enum was removed")
+			}
+		}
+	},
+}
+
+// ServiceRemoved reports services that were removed.
+var ServiceRemoved = Rule{
+	Name:        "service-removed",
+	Description: "services cannot be removed",
+	Check: func(c *Context) {
+		for _, p := range c.Services() {
+			if p.New == nil {
+				c.Reportf(p.Old, "service was removed")
+			}
+		}
+	},
+}
+
+// MethodRemoved reports methods that were removed from services.
+var MethodRemoved = Rule{
+	Name:        "method-removed",
+	Description: "methods cannot be removed",
+	Check: func(c *Context) {
+		for _, p := range c.Services() {
+			if p.Old == nil || p.New == nil {
+				continue
+			}
+			for _, m := range p.Old.Methods {
+				if findMethod(p.New, m.Name) == nil {
+					c.Reportf(m, "method was removed")
+				}
+			}
+		}
+	},
+}
+
+// MethodChanged reports methods whose parameters or return values changed
+// type, or started or stopped streaming.
+var MethodChanged = Rule{
+	Name:        "method-signature-changed",
+	Description: "the parameters and return values of methods cannot change",
+	Check: func(c *Context) {
+		for _, p := range c.Services() {
+			if p.Old == nil || p.New == nil {
+				continue
+			}
+			for _, m := range p.Old.Methods {
+				updated := findMethod(p.New, m.Name)
+				if updated == nil {
+					continue
+				}
+				if was, is := signature(m), signature(updated); was != is {
+					c.Reportf(updated, "signature changed from %s to %s", was, is)
+				}
+			}
+		}
+	},
+}
+
+// WireFieldRemoved reports fields removed from the end of a struct, or whose
+// removal shifted the index of the following ones.
+var WireFieldRemoved = Rule{
+	Name:        "wire-field-removed",
+	Description: "fields cannot be removed, as they are identified by their index",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			for _, f := range p.Fields(ByIndex) {
+				if f.Old != nil && f.New == nil {
+					c.Reportf(p.New, "field %s at index %d was removed", f.Old.Name, f.Old.Index)
+				}
+			}
+		}
+	},
+}
+
+// WireFieldTypeChanged reports fields whose type changed, or whose index
+// is now held by a field of another type.
+var WireFieldTypeChanged = Rule{
+	Name:        "wire-field-type-changed",
+	Description: "the type of the field at each index cannot change",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			for _, f := range p.Fields(ByIndex) {
+				if f.Old == nil || f.New == nil {
+					continue
+				}
+				if was, is := typeName(f.Old.Type), typeName(f.New.Type); was != is {
+					c.Reportf(f.New, "type of field at index %d changed from %s to %s", f.Old.Index, was, is)
+				}
+			}
+		}
+	},
+}
+
+// EnumValueRemoved reports enum values that are no longer declared.
+var EnumValueRemoved = Rule{
+	Name:        "enum-value-removed",
+	Description: "enum values cannot be removed, as they are encoded as numbers",
+	Check: func(c *Context) {
+		for _, p := range c.Enums() {
+			if p.Old == nil || p.New == nil {
+				continue
+			}
+			for _, m := range p.Old.Members {
+				if findMember(p.New, func(n *ast.EnumMember) bool { return n.Value == m.Value }) == nil {
+					c.Reportf(p.New, "value %d (%s) was removed", m.Value, m.Name)
+				}
+			}
+		}
+	},
+}
+
+// JSONRequiredFieldRemoved reports non-optional fields no longer present
+// under their wire name.
+var JSONRequiredFieldRemoved = Rule{
+	Name:        "json-required-field-removed",
+	Description: "required fields cannot be removed or change their wire name",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			for _, f := range p.Fields(ByWireName) {
+				if f.Old != nil && f.New == nil && !isOptional(f.Old) {
+					c.Reportf(p.New, "required field %s was removed", f.Old.WireName())
+				}
+			}
+		}
+	},
+}
+
+// JSONFieldTypeChanged reports fields whose type changed, identifying them
+// by their wire name.
+var JSONFieldTypeChanged = Rule{
+	Name:        "json-field-type-changed",
+	Description: "the type of fields cannot change",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			for _, f := range p.Fields(ByWireName) {
+				if f.Old == nil || f.New == nil {
+					continue
+				}
+				if was, is := typeName(f.Old.Type), typeName(f.New.Type); was != is {
+					c.Reportf(f.New, "type changed from %s to %s", was, is)
+				}
+			}
+		}
+	},
+}
+
+// EnumMemberRemoved reports enum members that are no longer declared under
+// their name.
+var EnumMemberRemoved = Rule{
+	Name:        "enum-member-removed",
+	Description: "enum members cannot be removed or renamed, as they are encoded as names",
+	Check: func(c *Context) {
+		for _, p := range c.Enums() {
+			if p.Old == nil || p.New == nil {
+				continue
+			}
+			for _, m := range p.Old.Members {
+				if findMember(p.New, func(n *ast.EnumMember) bool { return n.Name == m.Name }) == nil {
+					c.Reportf(p.New, "member %s was removed", m.Name)
+				}
+			}
+		}
+	},
+}
+
+// FieldRemoved reports every field that was removed, optional ones
+// included.
+var FieldRemoved = Rule{
+	Name:        "field-removed",
+	Description: "fields cannot be removed, even optional ones",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			for _, f := range p.Fields(ByName) {
+				if f.Old != nil && f.New == nil {
+					c.Reportf(p.New, "field %s was removed", f.Old.Name)
+				}
+			}
+		}
+	},
+}
+
+// RequiredFieldAdded reports non-optional fields added to existing structs,
+// which older peers never send.
+var RequiredFieldAdded = Rule{
+	Name:        "required-field-added",
+	Description: "fields added to existing structs must be optional",
+	Check: func(c *Context) {
+		for _, p := range c.Structs() {
+			for _, f := range p.Fields(ByName) {
+				if f.Old == nil && !isOptional(f.New) {
+					c.Reportf(f.New, "required field was added")
+				}
+			}
+		}
+	},
+}
+
+// commonRules are part of every built-in policy.
+var commonRules = []Rule{TypeRemoved, ServiceRemoved, MethodRemoved, MethodChanged}
+
+// WireRules are the rules of the "wire" policy.
+var WireRules = append(append([]Rule(nil), commonRules...), WireFieldRemoved, WireFieldTypeChanged, EnumValueRemoved)
+
+// JSONRules are the rules of the "json" policy.
+var JSONRules = append(append([]Rule(nil), commonRules...), JSONRequiredFieldRemoved, JSONFieldTypeChanged, EnumMemberRemoved)
+
+// StrictRules are the rules of the "strict" policy.
+var StrictRules = append(append([]Rule(nil), commonRules...),
+	WireFieldRemoved, WireFieldTypeChanged, EnumValueRemoved,
+	JSONRequiredFieldRemoved, JSONFieldTypeChanged, EnumMemberRemoved,
+	FieldRemoved, RequiredFieldAdded)
+
+func findMethod(s *ast.Service, name string) *ast.ServiceMethod {
+	for _, m := range s.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func findMember(e *ast.Enum, match func(*ast.EnumMember) bool) *ast.EnumMember {
+	for _, m := range e.Members {
+		if match(m) {
+			return m
+		}
+	}
+	return nil
+}
+
+func isOptional(f *ast.StructField) bool {
+	_, ok := f.Type.(*ast.OptionalType)
+	return ok
+}
+
+// signature returns the parameters and return values of m, as in
+// (stream Item) -> (Summary). Parameter names do not take part in it.
+func signature(m *ast.ServiceMethod) string {
+	var params, returns []string
+	for _, p := range m.Params {
+		params = append(params, streamPrefix(p.Stream)+typeName(p.Type))
+	}
+	for _, r := range m.Returns {
+		returns = append(returns, streamPrefix(r.Stream)+typeName(r.Type))
+	}
+	return "(" + strings.Join(params, ", ") + ") -> (" + strings.Join(returns, ", ") + ")"
+}
+
+func streamPrefix(stream bool) string {
+	if stream {
+		return "stream "
+	}
+	return ""
+}
+
+// typeName returns t as written in schemas, with user types fully
+// qualified.
+func typeName(t ast.Type) string {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return tt.Name
+	case *ast.ArrayType:
+		return "array<" + typeName(tt.Type) + ">"
+	case *ast.SetType:
+		return "set<" + typeName(tt.Type) + ">"
+	case *ast.OptionalType:
+		return "optional<" + typeName(tt.Type) + ">"
+	case *ast.MapType:
+		return "map<" + typeName(tt.Key) + ", " + typeName(tt.Value) + ">"
+	case *ast.EmptyType:
+		return "empty"
+	case ast.ResolvableType:
+		if r := tt.Resolved(); r != nil {
+			return r.FQN()
+		}
+		return tt.FQN()
+	}
+	return "?"
+}
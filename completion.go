@@ -0,0 +1,480 @@
+package idl
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// CompletionKind identifies what a Completion refers to.
+type CompletionKind int
+
+const (
+	CompletionPrimitive CompletionKind = iota + 1
+	CompletionStruct
+	CompletionEnum
+	CompletionImportAlias
+	CompletionAnnotation
+	CompletionPath
+	CompletionKeyword
+)
+
+var completionKindAsString = map[CompletionKind]string{
+	CompletionPrimitive:   "primitive",
+	CompletionStruct:      "struct",
+	CompletionEnum:        "enum",
+	CompletionImportAlias: "import alias",
+	CompletionAnnotation:  "annotation",
+	CompletionPath:        "path",
+	CompletionKeyword:     "keyword",
+}
+
+func (k CompletionKind) String() string {
+	return completionKindAsString[k]
+}
+
+// Completion is a candidate for the text being typed at a position.
+type Completion struct {
+	// Label replaces the word being completed: a type name, possibly
+	// qualified as in common.User, an annotation name without its @, or an
+	// import path without its quotes.
+	Label  string
+	Kind   CompletionKind
+	Detail string
+}
+
+// CompletionOptions configures Complete.
+type CompletionOptions struct {
+	// Extensions lists the extensions of schema files offered as import
+	// paths. Defaults to DefaultExtensions.
+	Extensions []string
+
+	// SchemaRoot, when set, is used to resolve imports and offer paths
+	// relative to it, in addition to paths relative to the file.
+	SchemaRoot string
+}
+
+// Complete returns the completions available at pos within src, the contents
+// of the schema stored at filename. src is usually being edited, so it may be
+// incomplete or contain syntax errors. Completions are offered for field and
+// parameter types, along with empty and stream in method returns, annotation
+// names, and import paths, sorted by label.
+func Complete(filename string, src []byte, pos ast.Position, opts CompletionOptions) []Completion {
+	if len(opts.Extensions) == 0 {
+		opts.Extensions = DefaultExtensions
+	}
+	tokens, _ := lexFile(src, nil)
+	c := &completer{filename: filename, opts: opts, tokens: tokens, pos: pos}
+	c.locate()
+
+	var res []Completion
+	switch {
+	case c.current != nil && c.current.Type == tokenTypeString:
+		if c.before(c.currentIdx).Value == "import" {
+			c.word = c.stringPrefix(src)
+			res = c.completePaths(c.word)
+		}
+	case c.before(c.wordStart).Type == tokenTypeAtSign:
+		res = completeAnnotations()
+	default:
+		if at := c.typePosition(); at != notType {
+			file, _ := parse(filename, tokens, nil)
+			res = c.completeTypes(file, at)
+		}
+	}
+
+	filtered := res[:0]
+	for _, r := range res {
+		if strings.HasPrefix(r.Label, c.word) {
+			filtered = append(filtered, r)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Label < filtered[j].Label })
+	return filtered
+}
+
+type completer struct {
+	filename string
+	opts     CompletionOptions
+	tokens   []token
+	pos      ast.Position
+
+	// current is the token touching the cursor, if any, at index currentIdx.
+	current    *token
+	currentIdx int
+	// word holds the identifier, possibly qualified, typed right before the
+	// cursor, which starts at token index wordStart.
+	word      string
+	wordStart int
+}
+
+// locate finds the tokens around the cursor.
+func (c *completer) locate() {
+	last := -1
+	for i := range c.tokens {
+		if c.tokens[i].Type == tokenTypeEOF || !c.startsBeforeCursor(&c.tokens[i]) {
+			break
+		}
+		last = i
+	}
+	c.currentIdx, c.wordStart = last+1, last+1
+	if last == -1 {
+		return
+	}
+	t := &c.tokens[last]
+	touching := t.Line == c.pos.Line && t.Column+(t.End-t.Pos) >= c.pos.Column
+	switch {
+	case !touching:
+		// The cursor follows whitespace, so no token is being typed.
+		return
+	case t.Type == tokenTypeString:
+		c.current, c.currentIdx = t, last
+		return
+	case t.Type != tokenTypeIdentifier && t.Type != tokenTypePeriod:
+		return
+	}
+	c.current, c.currentIdx, c.wordStart = t, last, last
+
+	// Qualified names are typed as identifiers separated by periods.
+	for i := last - 1; i >= 0; i-- {
+		t := c.tokens[i]
+		if (t.Type != tokenTypeIdentifier && t.Type != tokenTypePeriod) || t.End != c.tokens[i+1].Pos {
+			break
+		}
+		c.wordStart = i
+	}
+	var b strings.Builder
+	for _, t := range c.tokens[c.wordStart:last] {
+		b.WriteString(t.Value)
+	}
+	typed := []rune(t.Value)
+	b.WriteString(string(typed[:min(len(typed), c.pos.Column-t.Column)]))
+	c.word = b.String()
+}
+
+func (c *completer) startsBeforeCursor(t *token) bool {
+	return t.Line < c.pos.Line || (t.Line == c.pos.Line && t.Column < c.pos.Column)
+}
+
+// before returns the token preceding index i, or an invalid token.
+func (c *completer) before(i int) token {
+	if i <= 0 || i > len(c.tokens) {
+		return token{Type: tokenTypeInvalid}
+	}
+	return c.tokens[i-1]
+}
+
+// stringPrefix returns the contents of the current string token up to the
+// cursor.
+func (c *completer) stringPrefix(src []byte) string {
+	lines := strings.Split(string(src), "\n")
+	if c.pos.Line > len(lines) {
+		return ""
+	}
+	line := []rune(lines[c.pos.Line-1])
+	start, end := c.current.Column, min(c.pos.Column-1, len(line))
+	if start > end {
+		return ""
+	}
+	return string(line[start:end])
+}
+
+// typeContext identifies where a type is expected, which determines the types
+// accepted there.
+type typeContext int
+
+const (
+	notType typeContext = iota
+	// fieldType is the type of a struct field, or a type argument.
+	fieldType
+	// methodType is the type of a method parameter, of a streamed return or
+	// of an error, which must be user-defined.
+	methodType
+	// returnType is the return of a method, right after its arrow, which may
+	// also be empty or streamed.
+	returnType
+	// tupleType is a return within a tuple, which may also be streamed.
+	tupleType
+)
+
+// typePosition indicates whether the word at the cursor is expected to be a
+// type, either of a struct field or of a method parameter or return value, and
+// which one.
+func (c *completer) typePosition() typeContext {
+	var blocks []string
+	parens, angles := 0, 0
+	// tuple indicates whether the innermost parenthesis opens returns
+	tuple := false
+	for i := 0; i < c.wordStart; i++ {
+		t := c.tokens[i]
+		switch t.Type {
+		case tokenTypeLeftCurly:
+			kind := ""
+			if i >= 2 {
+				kind = c.tokens[i-2].Value
+			}
+			blocks = append(blocks, kind)
+		case tokenTypeRightCurly:
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		case tokenTypeLeftParen:
+			parens++
+			tuple = c.before(i).Type == tokenTypeArrow
+		case tokenTypeRightParen:
+			parens = max(0, parens-1)
+			tuple = false
+		case tokenTypeLeftAngled:
+			angles++
+		case tokenTypeRightAngled:
+			angles = max(0, angles-1)
+		case tokenTypeShiftRight:
+			angles = max(0, angles-2)
+		case tokenTypeSemi:
+			parens, angles = 0, 0
+		}
+	}
+	if len(blocks) == 0 {
+		return notType
+	}
+
+	prev := c.before(c.wordStart)
+	switch {
+	case prev.Type == tokenTypeLeftAngled, prev.Type == tokenTypeComma && angles > 0:
+		return fieldType
+	case prev.Type == tokenTypeIdentifier && (prev.Value == "stream" || prev.Value == "throws"):
+		return methodType
+	}
+
+	switch blocks[len(blocks)-1] {
+	case "struct":
+		// Fields are declared as a name followed by their type, possibly
+		// after annotations.
+		if prev.Type != tokenTypeIdentifier || prev.Value == "struct" || prev.Value == "enum" {
+			return notType
+		}
+		switch p := c.before(c.wordStart - 1); p.Type {
+		case tokenTypeLeftCurly, tokenTypeRightCurly, tokenTypeSemi, tokenTypeComment, tokenTypeRightParen:
+			return fieldType
+		case tokenTypeIdentifier:
+			// A preceding annotation without arguments, such as @placeholder
+			if c.before(c.wordStart-2).Type == tokenTypeAtSign {
+				return fieldType
+			}
+		}
+	case "service":
+		if parens == 0 {
+			if prev.Type == tokenTypeArrow {
+				return returnType
+			}
+			return notType
+		}
+		switch prev.Type {
+		case tokenTypeLeftParen, tokenTypeComma:
+			if tuple {
+				return tupleType
+			}
+			return methodType
+		case tokenTypeIdentifier:
+			if p := c.before(c.wordStart - 1); !tuple && (p.Type == tokenTypeLeftParen || p.Type == tokenTypeComma) {
+				return methodType
+			}
+		}
+	}
+	return notType
+}
+
+// completeTypes returns the types accepted at, declared by file or imported
+// by it. Methods only accept user-defined types, so primitives are offered
+// for fields alone.
+func (c *completer) completeTypes(file *ast.File, at typeContext) []Completion {
+	var res []Completion
+	switch at {
+	case fieldType:
+		for name := range primitives {
+			res = append(res, Completion{Label: name, Kind: CompletionPrimitive})
+		}
+		res = append(res,
+			Completion{Label: "array", Kind: CompletionPrimitive, Detail: "array<T>"},
+			Completion{Label: "set", Kind: CompletionPrimitive, Detail: "set<T>"},
+			Completion{Label: "map", Kind: CompletionPrimitive, Detail: "map<K, V>"},
+			Completion{Label: "optional", Kind: CompletionPrimitive, Detail: "optional<T>"},
+		)
+	case returnType:
+		res = append(res,
+			Completion{Label: "empty", Kind: CompletionKeyword, Detail: "no return value"},
+			Completion{Label: "stream", Kind: CompletionKeyword, Detail: "stream T"},
+		)
+	case tupleType:
+		res = append(res, Completion{Label: "stream", Kind: CompletionKeyword, Detail: "stream T"})
+	}
+	if file == nil {
+		return res
+	}
+
+	// Types declared by the file, along with the ones nested in the struct
+	// being edited and its parents.
+	res = append(res, typeCompletions("", file.Structs, file.Enums)...)
+	for s := c.enclosingStruct(file.Structs); s != nil; s = s.Parent {
+		res = append(res, typeCompletions("", s.Structs, s.Enums)...)
+	}
+	if i := strings.LastIndex(c.word, "."); i != -1 {
+		if s := findNestedStruct(file, c.word[:i]); s != nil {
+			res = append(res, typeCompletions(c.word[:i+1], s.Structs, s.Enums)...)
+		}
+	}
+
+	resolver := newFileResolver(nil, c.opts.SchemaRoot, c.opts.Extensions)
+	from, _ := filepath.Abs(c.filename)
+	for _, imp := range file.Imports {
+		if imp.Value == "" {
+			continue
+		}
+		imported := parseImportedFile(resolver, from, imp.Value)
+		alias := imp.Alias
+		if alias == "" && imported != nil && imported.Package != nil && len(imported.Package.Components) > 0 {
+			alias = imported.Package.Components[len(imported.Package.Components)-1]
+		}
+		if alias == "" {
+			continue
+		}
+		res = append(res, Completion{Label: alias, Kind: CompletionImportAlias, Detail: imp.Value})
+		if imported != nil && strings.HasPrefix(c.word, alias+".") {
+			res = append(res, typeCompletions(alias+".", imported.Structs, imported.Enums)...)
+		}
+	}
+	return res
+}
+
+// enclosingStruct returns the innermost struct among structs, and the ones
+// nested in them, containing the cursor.
+func (c *completer) enclosingStruct(structs []*ast.Struct) *ast.Struct {
+	for _, s := range structs {
+		if !c.contains(s.Position, s.End) {
+			continue
+		}
+		if nested := c.enclosingStruct(s.Structs); nested != nil {
+			return nested
+		}
+		return s
+	}
+	return nil
+}
+
+// contains indicates whether the cursor lies between start and end. An unset
+// end, as in declarations lacking their closing brace, extends to the end of
+// the file.
+func (c *completer) contains(start, end ast.Position) bool {
+	after := start.Line < c.pos.Line || (start.Line == c.pos.Line && start.Column <= c.pos.Column)
+	before := end.Line == 0 || c.pos.Line < end.Line || (c.pos.Line == end.Line && c.pos.Column < end.Column)
+	return after && before
+}
+
+func typeCompletions(qualifier string, structs []*ast.Struct, enums []*ast.Enum) []Completion {
+	var res []Completion
+	for _, s := range structs {
+		res = append(res, Completion{Label: qualifier + s.Name, Kind: CompletionStruct})
+	}
+	for _, e := range enums {
+		res = append(res, Completion{Label: qualifier + e.Name, Kind: CompletionEnum})
+	}
+	return res
+}
+
+// findNestedStruct returns the struct of file named by name, such as Outer or
+// Outer.Inner.
+func findNestedStruct(file *ast.File, name string) *ast.Struct {
+	structs := file.Structs
+	var found *ast.Struct
+	for _, comp := range strings.Split(name, ".") {
+		found = nil
+		for _, s := range structs {
+			if s.Name == comp {
+				found = s
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		structs = found.Structs
+	}
+	return found
+}
+
+// parseImportedFile parses the file imported as value from the file at from,
+// returning nil when it cannot be read. Syntax errors are tolerated.
+func parseImportedFile(resolver Resolver, from, value string) *ast.File {
+	location, err := resolver.Resolve(from, value)
+	if err != nil {
+		return nil
+	}
+	data, err := resolver.ReadFile(location)
+	if err != nil {
+		return nil
+	}
+	tokens, _ := lexFile(data, nil)
+	file, _ := parse(location, tokens, nil)
+	return file
+}
+
+func completeAnnotations() []Completion {
+	seen := map[string]bool{}
+	var res []Completion
+	for name, b := range builtinAnnotations {
+		seen[name] = true
+		res = append(res, Completion{Label: name, Kind: CompletionAnnotation, Detail: b.example})
+	}
+	for name, spec := range registeredAnnotations() {
+		seen[name] = true
+		res = append(res, Completion{Label: name, Kind: CompletionAnnotation, Detail: spec.Example})
+	}
+	for name := range arfAnnotations {
+		if name = arfAnnotationNamespace + "." + name; !seen[name] {
+			res = append(res, Completion{Label: name, Kind: CompletionAnnotation})
+		}
+	}
+	return res
+}
+
+// completePaths returns the schema files and directories matching prefix, an
+// import path being typed, relative to the file being edited and to the
+// schema root.
+func (c *completer) completePaths(prefix string) []Completion {
+	dirPart := ""
+	if i := strings.LastIndex(prefix, "/"); i != -1 {
+		dirPart = prefix[:i+1]
+	}
+	self, _ := filepath.Abs(c.filename)
+	bases := []string{filepath.Dir(self)}
+	if c.opts.SchemaRoot != "" {
+		bases = append(bases, c.opts.SchemaRoot)
+	}
+
+	seen := map[string]bool{}
+	var res []Completion
+	for _, base := range bases {
+		dir := filepath.Join(base, filepath.FromSlash(dirPart))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			label := dirPart + e.Name()
+			if e.IsDir() {
+				label += "/"
+			} else if !hasExtension(e.Name(), c.opts.Extensions) || filepath.Join(dir, e.Name()) == self {
+				continue
+			}
+			if strings.HasPrefix(e.Name(), ".") || seen[label] {
+				continue
+			}
+			seen[label] = true
+			res = append(res, Completion{Label: label, Kind: CompletionPath})
+		}
+	}
+	return res
+}
@@ -0,0 +1,58 @@
+package idl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "common"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "common", "types.arf"), []byte("package org.common;\n\nstruct Money { cents int64; }\nenum Currency { USD = 0; }\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "common", "notes.txt"), nil, 0o644))
+
+	// The cursor is placed where | is written.
+	complete := func(src string) []string {
+		var pos ast.Position
+		for i, line := range strings.Split(src, "\n") {
+			if col := strings.Index(line, "|"); col != -1 {
+				pos = ast.Position{Line: i + 1, Column: len([]rune(line[:col])) + 1}
+			}
+		}
+		src = strings.Replace(src, "|", "", 1)
+		var labels []string
+		for _, c := range Complete(filepath.Join(dir, "orders.arf"), []byte(src), pos, CompletionOptions{}) {
+			labels = append(labels, c.Label)
+		}
+		return labels
+	}
+
+	prelude := "package org.orders;\n\nimport \"common/types\";\n\nenum Status { OPEN = 0; }\n\n"
+	require.Equal(t, []string{"Status"}, complete(prelude+"struct Order {\n    status S|\n    total O"))
+	require.Equal(t, []string{"int16", "int32", "int64", "int8"}, complete(prelude+"struct Order {\n    count in|\n}\n"))
+	require.Equal(t, []string{"Item"}, complete(prelude+"struct Order {\n    struct Item {}\n    items map<string, I|\n}\n"))
+	require.Equal(t, []string{"Order.Item"}, complete(prelude+"struct Order {\n    struct Item {}\n}\nstruct Other { item Order.|"))
+	require.Equal(t, []string{"common.Currency", "common.Money"}, complete(prelude+"struct Order {\n    total common.|\n}\n"))
+	require.Equal(t, []string{"common"}, complete(prelude+"struct Order {\n    total co|\n}\n"))
+	require.Equal(t, []string{"Order"}, complete(prelude+"struct Order {}\nservice Orders {\n    Get(r O|"))
+	require.Equal(t, []string{"Order"}, complete(prelude+"struct Order {}\nservice Orders {\n    Get(r Order) -> stream Or|"))
+
+	// Methods only take user-defined types, and may return nothing
+	require.Empty(t, complete(prelude+"struct Order {}\nservice Orders {\n    Get(r in|"))
+	require.Equal(t, []string{"empty"}, complete(prelude+"struct Order {}\nservice Orders {\n    Delete(r Order) -> em|"))
+	require.Equal(t, []string{"Status", "common", "empty", "stream"}, complete(prelude+"service Orders {\n    Watch(r Status) -> |"))
+	require.Equal(t, []string{"Status", "common", "stream"}, complete(prelude+"service Orders {\n    Get(r Status) -> (Status, |"))
+	require.Empty(t, complete(prelude+"struct Order {\n    struct I|"))
+	require.Empty(t, complete(prelude+"struct Order {\n    na|"))
+
+	require.Equal(t, []string{"wire_name"}, complete(prelude+"struct Order {\n    @wire|"))
+	require.Contains(t, complete(prelude+"@|"), "arf.deprecated")
+
+	require.Equal(t, []string{"common/"}, complete("package org.orders;\n\nimport \"c|"))
+	require.Equal(t, []string{"common/types.arf"}, complete("package org.orders;\n\nimport \"common/|\";\n"))
+}
@@ -0,0 +1,111 @@
+package idl
+
+import (
+	"math"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// evalConst evaluates e, using resolve to obtain the value of references.
+// Errors, including overflows of int64 and divisions by zero, are reported as
+// diagnostics positioned at the offending expression.
+func evalConst(e ast.Expr, resolve func(*ast.ConstRef) (int64, error)) (int64, error) {
+	switch ex := e.(type) {
+	case *ast.IntLiteral:
+		if ex.Unsigned {
+			return 0, overflow(ex)
+		}
+		return ex.Value, nil
+	case *ast.ConstRef:
+		return resolve(ex)
+	case *ast.ParenExpr:
+		return evalConst(ex.X, resolve)
+	case *ast.UnaryExpr:
+		x, err := evalConst(ex.X, resolve)
+		if err != nil {
+			return 0, err
+		}
+		switch ex.Op {
+		case "-":
+			if x == math.MinInt64 {
+				return 0, overflow(ex)
+			}
+			return -x, nil
+		case "~":
+			return ^x, nil
+		}
+	case *ast.BinaryExpr:
+		x, err := evalConst(ex.X, resolve)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalConst(ex.Y, resolve)
+		if err != nil {
+			return 0, err
+		}
+		return evalBinary(ex, x, y)
+	}
+	return 0, newDiagnostic(SeverityError, *e.Pos(), "Bug: invalid expression %T", e)
+}
+
+func evalBinary(e *ast.BinaryExpr, x, y int64) (int64, error) {
+	switch e.Op {
+	case "+":
+		r := x + y
+		if (r > x) != (y > 0) {
+			return 0, overflow(e)
+		}
+		return r, nil
+	case "-":
+		r := x - y
+		if (r < x) != (y > 0) {
+			return 0, overflow(e)
+		}
+		return r, nil
+	case "*":
+		if x == 0 || y == 0 {
+			return 0, nil
+		}
+		r := x * y
+		if r/y != x || (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) {
+			return 0, overflow(e)
+		}
+		return r, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, newDiagnostic(SeverityError, e.Position, "Division by zero in %s", e)
+		}
+		if x == math.MinInt64 && y == -1 {
+			return 0, overflow(e)
+		}
+		if e.Op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "<<":
+		if y < 0 || y > 62 {
+			return 0, newDiagnostic(SeverityError, e.Position, "Invalid shift count %d in %s", y, e)
+		}
+		r := x << y
+		if r>>y != x {
+			return 0, overflow(e)
+		}
+		return r, nil
+	case ">>":
+		if y < 0 || y > 63 {
+			return 0, newDiagnostic(SeverityError, e.Position, "Invalid shift count %d in %s", y, e)
+		}
+		return x >> y, nil
+	case "&":
+		return x & y, nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	}
+	return 0, newDiagnostic(SeverityError, e.Position, "Bug: invalid operator %s", e.Op)
+}
+
+func overflow(e ast.Expr) error {
+	return newDiagnostic(SeverityError, *e.Pos(), "Constant expression %s overflows int64", e)
+}
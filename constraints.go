@@ -0,0 +1,164 @@
+package idl
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/wiresize"
+)
+
+// resolveConstraints converts the constraint annotations of f, @max_length
+// and @range, to f.Constraints, ensuring they apply to the field type and
+// that its default value, if any, satisfies them.
+// It must be called once the field type and default are resolved.
+func (v *validatorP2) resolveConstraints(f *ast.StructField) {
+	maxLength, bounds := f.Annotations.ByName("max_length"), f.Annotations.ByName("range")
+	if maxLength == nil && bounds == nil {
+		return
+	}
+	for _, a := range []*ast.Annotation{maxLength, bounds} {
+		if a != nil && slices.ContainsFunc(a.Arguments, isAnnotationReference) {
+			// Reported by resolveBuiltinArgument
+			return
+		}
+	}
+
+	t := f.Type
+	if opt, ok := t.(*ast.OptionalType); ok {
+		t = opt.Type
+	}
+	p, _ := t.(*ast.PrimitiveType)
+
+	c := &ast.Constraints{}
+	valid := true
+	if maxLength != nil {
+		valid = v.resolveMaxLength(f, t, maxLength, c) && valid
+	}
+	if bounds != nil {
+		valid = v.resolveRange(f, p, bounds, c) && valid
+	}
+	if !valid {
+		return
+	}
+	f.Constraints = c
+
+	switch d := f.Default.(type) {
+	case string, []byte:
+		if n := valueLen(d); c.MaxLength > 0 && n > c.MaxLength {
+			v.Errorf(f.Annotations.ByName("default").Position, "@default of field %s is longer than its @max_length of %d", f.Name, c.MaxLength)
+		}
+	case int64, uint64, float64:
+		if c.Min != nil && (compareBound(d, c.Min) < 0 || compareBound(d, c.Max) > 0) {
+			v.Errorf(f.Annotations.ByName("default").Position, "@default of field %s is outside of its @range", f.Name)
+		}
+	}
+}
+
+// resolveMaxLength stores the limit set by a, the @max_length annotation of
+// f, in c. t is the field type, stripped of optional.
+func (v *validatorP2) resolveMaxLength(f *ast.StructField, t ast.Type, a *ast.Annotation, c *ast.Constraints) bool {
+	switch tt := t.(type) {
+	case *ast.ArrayType, *ast.SetType, *ast.MapType:
+	case *ast.PrimitiveType:
+		if tt.Name != "string" && tt.Name != "bytes" {
+			v.Errorf(a.Position, "@max_length is not supported on field %s of type %s: only strings, bytes, arrays and maps have a length", f.Name, tt.Name)
+			return false
+		}
+	default:
+		v.Errorf(a.Position, "@max_length is not supported on field %s: only strings, bytes, arrays and maps have a length", f.Name)
+		return false
+	}
+
+	raw := fmt.Sprint(a.Arguments[0])
+	n, err := parsePrimitiveLiteral("uint64", raw)
+	if err != nil || n.(uint64) == 0 {
+		v.Errorf(a.Position, "invalid @max_length %q for field %s: expected a positive integer, such as \"64\"", raw, f.Name)
+		return false
+	}
+	c.MaxLength = n.(uint64)
+	return true
+}
+
+// resolveRange stores the bounds set by a, the @range annotation of f, in c,
+// converted to p, the field type. Only numeric fields accept ranges.
+func (v *validatorP2) resolveRange(f *ast.StructField, p *ast.PrimitiveType, a *ast.Annotation, c *ast.Constraints) bool {
+	if p == nil || !isNumeric(p.Name) {
+		v.Errorf(a.Position, "@range is not supported on field %s: only integers and floats have a range", f.Name)
+		return false
+	}
+
+	var bounds [2]any
+	for i, name := range []string{"min", "max"} {
+		raw := fmt.Sprint(a.Arguments[i])
+		value, err := parsePrimitiveLiteral(p.Name, raw)
+		if ne, ok := err.(*strconv.NumError); ok {
+			err = ne.Err
+		}
+		if err != nil {
+			v.Errorf(a.Position, "invalid @range %s %q for field %s of type %s: %s", name, raw, f.Name, p.Name, err)
+			return false
+		}
+		bounds[i] = value
+	}
+	if compareBound(bounds[0], bounds[1]) > 0 {
+		v.Errorf(a.Position, "invalid @range for field %s: min %s is greater than max %s", f.Name, a.Arguments[0], a.Arguments[1])
+		return false
+	}
+	c.Min, c.Max = bounds[0], bounds[1]
+	return true
+}
+
+// validateMaxSize ensures s, when annotated with @max_size, cannot encode to
+// more bytes than it allows, according to the upper bound estimated by package
+// wiresize. Strings, bytes and collections of such structs must therefore be
+// bounded through @max_length.
+func (p *validatorP3) validateMaxSize(s *ast.Struct) {
+	a := s.Annotations.ByName("max_size")
+	if a == nil || isAnnotationReference(a.Arguments[0]) {
+		// References are reported by resolveBuiltinArgument
+		return
+	}
+	raw := fmt.Sprint(a.Arguments[0])
+	n, err := parsePrimitiveLiteral("uint64", raw)
+	if err != nil || n.(uint64) == 0 {
+		p.Errorf(a.Position, "invalid @max_size %q for struct %s: expected a positive number of bytes, such as \"1024\"", raw, s.Name)
+		return
+	}
+	limit := n.(uint64)
+	size := wiresize.EstimateStruct(s)
+	switch {
+	case !size.Bounded():
+		p.Errorf(a.Position, "struct %s exceeds its @max_size of %d bytes, as its size is unbounded; bound its strings, bytes and collections through @max_length", s.Name, limit)
+	case uint64(size.Max) > limit:
+		p.Errorf(a.Position, "struct %s exceeds its @max_size of %d bytes, as it may take up to %d bytes", s.Name, limit, size.Max)
+	}
+}
+
+func valueLen(v any) uint64 {
+	if s, ok := v.(string); ok {
+		return uint64(len(s))
+	}
+	return uint64(len(v.([]byte)))
+}
+
+func isNumeric(primitive string) bool {
+	return strings.HasPrefix(primitive, "int") || strings.HasPrefix(primitive, "uint") || strings.HasPrefix(primitive, "float")
+}
+
+// compareBound compares a and b, which hold values of the same numeric type,
+// as returned by parsePrimitiveLiteral.
+func compareBound(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case uint64:
+		return cmp.Compare(a, b.(uint64))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	}
+	return 0
+}
@@ -0,0 +1,274 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// errInvalidConst is returned when evaluating constants referencing another
+// one whose value is invalid, which is reported on its own.
+var errInvalidConst = errors.New("invalid constant")
+
+// Evaluation states of constants, tracked by validatorP2.consts.
+const (
+	constPending = iota
+	constEvaluating
+	constDone
+)
+
+// resolveConsts evaluates the constants declared by the file, storing their
+// values, converted to their types, in Value. Integer expressions may
+// reference other constants of the file, regardless of their order, as well
+// as constants of imported files, which are evaluated along.
+func (v *validatorP2) resolveConsts() {
+	for _, c := range v.f.Consts {
+		if v.consts[c] == constDone || c.Type == nil || c.Expr == nil && c.Literal == nil {
+			continue
+		}
+		if _, err := v.evalConstant(c); err != nil && err != errInvalidConst {
+			v.errors = append(v.errors, err)
+		}
+	}
+}
+
+// evalConstant evaluates c, within the file declaring it, storing its value
+// in c.Value.
+func (v *validatorP2) evalConstant(c *ast.Const) (any, error) {
+	switch v.consts[c] {
+	case constEvaluating:
+		return nil, newDiagnostic(SeverityError, c.Position, "Constant %s is defined in terms of itself", c.Name)
+	case constDone:
+		if c.Value == nil {
+			return nil, errInvalidConst
+		}
+		return c.Value, nil
+	}
+	if v.consts == nil {
+		v.consts = map[*ast.Const]int{}
+	}
+	if file := c.Position.File; file != nil && file != v.f {
+		defer func(restore *ast.File) { v.f = restore }(v.f)
+		v.f = file
+	}
+
+	v.consts[c] = constEvaluating
+	value, err := v.constValue(c, func(ref *ast.ConstRef) (int64, error) {
+		target := v.lookupConst(ref.Name)
+		if target == nil {
+			return 0, newDiagnostic(SeverityError, ref.Position, "Undefined constant %s", ref.Name)
+		}
+		ref.Resolved = target
+		value, err := v.evalConstant(target)
+		if err != nil {
+			return 0, err
+		}
+		switch value := value.(type) {
+		case int64:
+			return value, nil
+		case uint64:
+			if value <= math.MaxInt64 {
+				return int64(value), nil
+			}
+			return 0, newDiagnostic(SeverityError, ref.Position, "Constant %s overflows int64", ref.Name)
+		}
+		return 0, newDiagnostic(SeverityError, ref.Position, "Constant %s of type %s is not an integer", ref.Name, typeString(target.Type))
+	})
+	v.consts[c] = constDone
+	c.Value = value
+	return value, err
+}
+
+// lookupConst returns the constant referenced as name from v.f: one of the
+// package of the file, or one qualified by the alias or name of an imported
+// package, such as common.MAX_PAGE_SIZE.
+func (v *validatorP2) lookupConst(name string) *ast.Const {
+	pkg, constName := v.f.Package.Value, name
+	if idx := strings.LastIndex(name, "."); idx != -1 {
+		pkg, constName = name[:idx], name[idx+1:]
+		if imported, ok := v.importedPackage(pkg); ok {
+			pkg = imported
+		}
+	} else if c := v.f.FindConst(name); c != nil {
+		return c
+	}
+	for _, f := range v.findPackage(pkg) {
+		if c := f.FindConst(constName); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// annotationConst returns the constant referenced as name by an annotation
+// argument, evaluating it when it is declared by another file.
+func (v *validatorP2) annotationConst(name string) *ast.Const {
+	c := v.lookupConst(name)
+	if c == nil || c.Value != nil || v.consts[c] != constPending {
+		return c
+	}
+	if _, err := v.evalConstant(c); err != nil && err != errInvalidConst {
+		v.errors = append(v.errors, err)
+	}
+	return c
+}
+
+// importedPackage returns the package imported by v.f as alias, directly or
+// through the public imports of the files it imports.
+func (v *validatorP2) importedPackage(alias string) (string, bool) {
+	for _, imp := range v.f.Imports {
+		target, ok := v.files[imp.ResolvedValue]
+		if !ok {
+			continue
+		}
+		// Aliases are defined by validatePhase1, which runs for every file
+		if imp.Alias == alias {
+			return target.Package.Value, true
+		}
+	}
+	if location, ok := v.publicAliases(v.f)[alias]; ok {
+		return v.files[location].Package.Value, true
+	}
+	return "", false
+}
+
+// resolveAnnotationConsts resolves the annotation arguments of the entrypoint
+// referencing constants which validatePhase2 leaves unresolved, such as
+// MAX_PAGE_SIZE in @limit(MAX_PAGE_SIZE) placed on a constant or a union, so
+// generators observe the values of the constants instead of copies of them.
+// Constants may be those of the file or of imported packages, such as
+// common.MAX_PAGE_SIZE. It must run after validatePhase2, which evaluates
+// constants and resolves other references.
+func resolveAnnotationConsts(files map[string]*ast.File, entrypoint string) error {
+	f, ok := files[entrypoint]
+	if !ok {
+		return fmt.Errorf("BUG: validation entrypoint %s not found", entrypoint)
+	}
+
+	v := &validatorP2{files: files, f: f}
+	walkAnnotations(f, func(set ast.AnnotationSet, _ AnnotationTarget, _ string) {
+		for _, a := range set {
+			b, builtin := builtinAnnotations[a.Name]
+			for i, arg := range a.Arguments {
+				ref, ok := arg.(*ast.AnnotationReference)
+				if !ok || ref.ResolvedObject != nil {
+					continue
+				}
+				c := v.annotationConst(ref.Name)
+				if c == nil {
+					v.Errorf(ref.Position, "Undefined reference %s", ref.Name)
+					continue
+				}
+				ref.ResolvedObject = c
+				if builtin {
+					a.Arguments[i] = v.resolveBuiltinArgument(&a, b, i)
+				}
+			}
+			for _, arg := range a.NamedArguments {
+				ref, ok := arg.Value.(*ast.AnnotationReference)
+				if !ok || ref.ResolvedObject != nil {
+					continue
+				}
+				if c := v.annotationConst(ref.Name); c != nil {
+					ref.ResolvedObject = c
+				} else {
+					v.Errorf(ref.Position, "Undefined reference %s", ref.Name)
+				}
+			}
+		}
+	})
+	return errors.Join(v.errors...)
+}
+
+// constValue converts the value of c to its type, using resolve to obtain
+// the value of the constants its expression references.
+func (v *validatorP2) constValue(c *ast.Const, resolve func(*ast.ConstRef) (int64, error)) (any, error) {
+	p, ok := c.Type.(*ast.PrimitiveType)
+	if !ok {
+		return nil, newDiagnostic(SeverityError, c.Position, "Constant %s must be of a primitive type, such as int32 or string", c.Name)
+	}
+	mismatch := func(kind string) error {
+		return newDiagnostic(SeverityError, c.Position, "Constant %s of type %s cannot hold %s", c.Name, p.Name, kind)
+	}
+
+	if lit, ok := c.Expr.(*ast.IntLiteral); ok && lit.Unsigned && strings.HasPrefix(p.Name, "uint") {
+		value, err := parsePrimitiveLiteral(p.Name, strconv.FormatUint(uint64(lit.Value), 10))
+		if err != nil {
+			return nil, newDiagnostic(SeverityError, lit.Position, "Constant %s value %s overflows %s", c.Name, lit.Raw, p.Name)
+		}
+		return value, nil
+	}
+	if c.Expr != nil {
+		n, err := evalConst(c.Expr, resolve)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(p.Name, "float") {
+			return float64(n), nil
+		}
+		if !isNumeric(p.Name) {
+			return nil, mismatch("an integer")
+		}
+		value, err := parsePrimitiveLiteral(p.Name, strconv.FormatInt(n, 10))
+		if err != nil {
+			return nil, newDiagnostic(SeverityError, *c.Expr.Pos(), "Constant %s value %d overflows %s", c.Name, n, p.Name)
+		}
+		return value, nil
+	}
+
+	switch lit := c.Literal.(type) {
+	case string:
+		switch {
+		case p.Name == "string":
+			return lit, nil
+		case p.Name == "bytes":
+			return []byte(lit), nil
+		case strings.HasPrefix(p.Name, "float"), p.Name == "uuid", p.Name == "decimal128":
+			// These have no literal form other than strings
+			value, err := parsePrimitiveLiteral(p.Name, lit)
+			if ne, ok := err.(*strconv.NumError); ok {
+				err = ne.Err
+			}
+			if err != nil {
+				return nil, newDiagnostic(SeverityError, c.Position, "Invalid value %q for constant %s of type %s: %s", lit, c.Name, p.Name, err)
+			}
+			return value, nil
+		}
+		return nil, mismatch("a string")
+	case float64:
+		if strings.HasPrefix(p.Name, "float") {
+			value, err := parsePrimitiveLiteral(p.Name, strconv.FormatFloat(lit, 'g', -1, 64))
+			if err != nil {
+				return nil, newDiagnostic(SeverityError, c.Position, "Constant %s value %v overflows %s", c.Name, lit, p.Name)
+			}
+			return value, nil
+		}
+		return nil, mismatch("a floating-point number")
+	case bool:
+		if p.Name == "bool" {
+			return lit, nil
+		}
+		return nil, mismatch("a boolean")
+	case []byte:
+		if p.Name == "bytes" {
+			return lit, nil
+		}
+		return nil, mismatch("a byte string")
+	case time.Time:
+		if p.Name == "timestamp" {
+			return lit, nil
+		}
+		return nil, mismatch("a timestamp")
+	case time.Duration:
+		if p.Name == "duration" {
+			return lit, nil
+		}
+		return nil, mismatch("a duration")
+	}
+	return nil, newDiagnostic(SeverityError, c.Position, "Bug: invalid value %T of constant %s", c.Literal, c.Name)
+}
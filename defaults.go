@@ -0,0 +1,215 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// resolveDefault converts the value declared through @default for f to its
+// type, storing it in f.Default. Values are either strings holding a literal
+// of the field type, such as "10" or "true", integers, floats and booleans,
+// timestamp and duration literals, byte strings, or references to enum members
+// and constants, such as @default(DEFAULT_LIMIT). Unlike in annotation
+// arguments, constants cannot follow the equal sign of a field, as in
+// `limit int32 = DEFAULT_LIMIT;`, as it declares the field index.
+// It must be called once the field type is resolved.
+func (v *validatorP2) resolveDefault(f *ast.StructField) {
+	a := f.Annotations.ByName("default")
+	if a == nil {
+		return
+	}
+
+	t := f.Type
+	if opt, ok := t.(*ast.OptionalType); ok {
+		t = opt.Type
+	}
+
+	if ref, ok := a.Arguments[0].(*ast.AnnotationReference); ok {
+		f.DefaultRef = ref
+		if ref.ResolvedObject == nil {
+			// Reported while resolving annotations
+			return
+		}
+		if c, ok := ref.ResolvedObject.(*ast.Const); ok {
+			v.resolveConstDefault(f, t, c)
+			return
+		}
+		member, ok := ref.ResolvedObject.(*ast.EnumMember)
+		if !ok {
+			v.Errorf(ref.Position, "@default of field %s references %s, which is not a constant", f.Name, ref.Name)
+			return
+		}
+		if rt, ok := t.(ast.ResolvableType); !ok || rt.Resolved() != member.Enum {
+			v.Errorf(ref.Position, "@default of field %s references %s, which is not a member of the field type", f.Name, ref.Name)
+			return
+		}
+		f.Default = member
+		return
+	}
+
+	var raw string
+	switch arg := a.Arguments[0].(type) {
+	case string:
+		raw = arg
+	case int64:
+		if p, ok := t.(*ast.PrimitiveType); !ok || !isNumeric(p.Name) {
+			v.Errorf(a.Position, "@default of field %s cannot be an integer", f.Name)
+			return
+		}
+		raw = strconv.FormatInt(arg, 10)
+	case float64:
+		if p, ok := t.(*ast.PrimitiveType); !ok || p.Name != "float32" && p.Name != "float64" {
+			v.Errorf(a.Position, "@default of field %s cannot be a float", f.Name)
+			return
+		}
+		raw = strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if p, ok := t.(*ast.PrimitiveType); !ok || p.Name != "bool" {
+			v.Errorf(a.Position, "@default of field %s cannot be a boolean", f.Name)
+			return
+		}
+		raw = strconv.FormatBool(arg)
+	case time.Time:
+		if p, ok := t.(*ast.PrimitiveType); ok && p.Name == "timestamp" {
+			f.Default = arg
+		} else {
+			v.Errorf(a.Position, "@default of field %s cannot be a timestamp", f.Name)
+		}
+		return
+	case time.Duration:
+		if p, ok := t.(*ast.PrimitiveType); ok && p.Name == "duration" {
+			f.Default = arg
+		} else {
+			v.Errorf(a.Position, "@default of field %s cannot be a duration", f.Name)
+		}
+		return
+	case []byte:
+		if p, ok := t.(*ast.PrimitiveType); ok && p.Name == "bytes" {
+			f.Default = arg
+		} else {
+			v.Errorf(a.Position, "@default of field %s cannot be a byte string", f.Name)
+		}
+		return
+	}
+
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		value, err := parsePrimitiveLiteral(tt.Name, raw)
+		if ne, ok := err.(*strconv.NumError); ok {
+			err = ne.Err
+		}
+		if err != nil {
+			v.Errorf(a.Position, "invalid @default %q for field %s: %s", raw, f.Name, err)
+			return
+		}
+		f.Default = value
+	case ast.ResolvableType:
+		if e, ok := tt.Resolved().(*ast.Enum); ok {
+			v.Errorf(a.Position, "@default of field %s must reference a member of %s, such as %s.%s", f.Name, e.Name, e.Name, e.Members[0].Name)
+		} else if tt.Resolved() != nil {
+			v.Errorf(a.Position, "@default is not supported on field %s of type %s", f.Name, tt.Resolved().FQN())
+		}
+	default:
+		v.Errorf(a.Position, "@default is not supported on field %s: only primitives and enums have defaults", f.Name)
+	}
+}
+
+// resolveConstDefault stores the value of c, the constant referenced by the
+// @default annotation of f, converted to t, the field type. Constants must be
+// of the field type, or of a numeric type whose value fits it.
+func (v *validatorP2) resolveConstDefault(f *ast.StructField, t ast.Type, c *ast.Const) {
+	if c.Value == nil {
+		// Reported while evaluating the constant
+		return
+	}
+	a := f.Annotations.ByName("default")
+	p, ok := t.(*ast.PrimitiveType)
+	cp, _ := c.Type.(*ast.PrimitiveType)
+	if !ok || cp == nil || p.Name != cp.Name && (!isNumeric(p.Name) || !isNumeric(cp.Name)) {
+		v.Errorf(a.Position, "@default of field %s references constant %s of type %s, which is not assignable to %s", f.Name, c.Name, typeString(c.Type), typeString(f.Type))
+		return
+	}
+	if p.Name == cp.Name {
+		f.Default = c.Value
+		return
+	}
+	raw := fmt.Sprint(c.Value)
+	value, err := parsePrimitiveLiteral(p.Name, raw)
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	if err != nil {
+		v.Errorf(a.Position, "invalid @default %s (%s) for field %s: %s", c.Name, raw, f.Name, err)
+		return
+	}
+	f.Default = value
+}
+
+// parsePrimitiveLiteral converts raw to a value of the primitive type named
+// typ. Integers follow the rules of integer literals, as in checkIntLiteral.
+// UUIDs are returned in their canonical lowercase form, and decimals as the
+// string they were written as.
+func parsePrimitiveLiteral(typ, raw string) (any, error) {
+	if strings.HasPrefix(typ, "int") || strings.HasPrefix(typ, "uint") {
+		if err := checkIntLiteral(strings.TrimPrefix(raw, "-")); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case typ == "string", typ == "bytes":
+		return raw, nil
+	case typ == "bool":
+		return strconv.ParseBool(raw)
+	case typ == "timestamp":
+		return time.Parse(time.RFC3339Nano, raw)
+	case typ == "duration":
+		return time.ParseDuration(raw)
+	case typ == "uuid":
+		return parseUUID(raw)
+	case typ == "decimal128":
+		return parseDecimal128(raw)
+	case strings.HasPrefix(typ, "uint"):
+		bits, _ := strconv.Atoi(typ[len("uint"):])
+		return strconv.ParseUint(raw, 0, bits)
+	case strings.HasPrefix(typ, "int"):
+		bits, _ := strconv.Atoi(typ[len("int"):])
+		return strconv.ParseInt(raw, 0, bits)
+	case strings.HasPrefix(typ, "float"):
+		bits, _ := strconv.Atoi(typ[len("float"):])
+		return strconv.ParseFloat(raw, bits)
+	}
+	return nil, fmt.Errorf("%s values have no literal form", typ)
+}
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func parseUUID(raw string) (string, error) {
+	if !uuidRegex.MatchString(raw) {
+		return "", errors.New("expected a UUID such as 123e4567-e89b-12d3-a456-426614174000")
+	}
+	return strings.ToLower(raw), nil
+}
+
+var decimalRegex = regexp.MustCompile(`^-?([0-9]+)(?:\.([0-9]+))?$`)
+
+// maxDecimal128Digits is the number of significant digits held by an IEEE 754
+// decimal128.
+const maxDecimal128Digits = 34
+
+func parseDecimal128(raw string) (string, error) {
+	m := decimalRegex.FindStringSubmatch(raw)
+	if m == nil {
+		return "", errors.New("expected a decimal such as 12.50")
+	}
+	digits := strings.TrimLeft(m[1]+m[2], "0")
+	if len(digits) > maxDecimal128Digits {
+		return "", fmt.Errorf("decimal128 holds at most %d significant digits", maxDecimal128Digits)
+	}
+	return raw, nil
+}
@@ -0,0 +1,111 @@
+package idl
+
+import (
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// checkDeprecatedUsages reports types of f which reference deprecated
+// structs and enums, through their base, fields, or method params, returns
+// and errors. Declarations deprecated themselves, or declared within a
+// deprecated struct or service, may reference them freely.
+func (w *warner) checkDeprecatedUsages(f *ast.File) {
+	var checkStruct func(s *ast.Struct)
+	checkStruct = func(s *ast.Struct) {
+		if !deprecatedStruct(s) {
+			if s.Extends != nil {
+				if obj, note, ok := deprecatedReference(s.Extends); ok {
+					w.Warnf(CodeDeprecatedUsage, s.Extends.Pos(), "struct %s extends deprecated %s %s%s", s.Name, strings.ToLower(obj.Kind()), obj.FQN(), note)
+				}
+			}
+			for _, field := range s.Fields {
+				if field.Parent != s {
+					// Merged from a re-opening declaration
+					continue
+				}
+				if deprecated, _ := field.Deprecated(); deprecated {
+					continue
+				}
+				w.checkDeprecatedType(field.Position, field.Type, "field "+field.Name+" of "+s.Name)
+			}
+		}
+		for _, n := range s.Structs {
+			checkStruct(n)
+		}
+	}
+	for _, s := range f.Structs {
+		checkStruct(s)
+	}
+
+	for _, s := range f.Services {
+		if deprecated, _ := s.Deprecated(); deprecated {
+			continue
+		}
+		for _, m := range s.Methods {
+			if deprecated, _ := m.Deprecated(); deprecated {
+				continue
+			}
+			user := "method " + s.Name + "." + m.Name
+			for _, p := range m.Params {
+				w.checkDeprecatedType(p.Position, p.Type, user)
+			}
+			for _, r := range m.Returns {
+				w.checkDeprecatedType(r.Position, r.Type, user)
+			}
+			for _, e := range m.Errors {
+				w.checkDeprecatedType(e.Position, e.Type, user)
+			}
+		}
+	}
+}
+
+// checkDeprecatedType reports the deprecated structs and enums referenced by
+// t, used by the declaration described by user.
+func (w *warner) checkDeprecatedType(pos ast.Position, t ast.Type, user string) {
+	seen := map[ast.Object]bool{}
+	walkTypes(t, func(t ast.Type) {
+		rt, ok := t.(ast.ResolvableType)
+		if !ok {
+			return
+		}
+		obj, note, ok := deprecatedReference(rt)
+		if !ok || seen[obj] {
+			return
+		}
+		seen[obj] = true
+		w.Warnf(CodeDeprecatedUsage, pos, "%s uses deprecated %s %s%s", user, strings.ToLower(obj.Kind()), obj.FQN(), note)
+	})
+}
+
+// deprecatedReference returns the struct or enum t resolved to, provided it
+// is deprecated, along with the reason given, formatted to follow a
+// diagnostic.
+func deprecatedReference(t ast.ResolvableType) (ast.Object, string, bool) {
+	var deprecated bool
+	var note string
+	switch obj := t.Resolved().(type) {
+	case *ast.Struct:
+		deprecated, note = obj.Deprecated()
+	case *ast.Enum:
+		deprecated, note = obj.Deprecated()
+	}
+	if !deprecated {
+		return nil, "", false
+	}
+	if note != "" {
+		note = ": " + note
+	}
+	return t.Resolved(), note, true
+}
+
+// deprecatedStruct indicates whether s, or any of the structs it is declared
+// within, is deprecated.
+func deprecatedStruct(s *ast.Struct) bool {
+	for ; s != nil; s = s.Parent {
+		if deprecated, _ := s.Deprecated(); deprecated {
+			return true
+		}
+	}
+	return false
+}
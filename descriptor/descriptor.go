@@ -0,0 +1,432 @@
+// Package descriptor builds compact descriptions of validated arf trees which
+// runtimes can load without the compiler: the methods of each service, the
+// fields of each struct along with their indexes and types, and the members
+// of each enum. They enable dynamic dispatch, server reflection, and generic
+// proxies.
+//
+// Descriptors are encoded as JSON through Marshal, which is deterministic, and
+// loaded through Unmarshal. Registry indexes them by fully qualified name.
+//
+// Descriptors built WithSourceInfo also record where each declaration was
+// written, along with its comments, so runtime errors and reflection UIs can
+// point back to schemas. Strip removes that information from descriptors
+// meant for production.
+package descriptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Version identifies the layout of descriptors produced by this package.
+const Version = 1
+
+// Set holds the descriptors of every declaration in a tree, each list sorted
+// by name.
+type Set struct {
+	Version  int        `json:"version"`
+	Structs  []*Struct  `json:"structs,omitempty"`
+	Enums    []*Enum    `json:"enums,omitempty"`
+	Services []*Service `json:"services,omitempty"`
+}
+
+// Struct describes a struct, nested ones included.
+type Struct struct {
+	Name   string      `json:"name"`
+	Fields []*Field    `json:"fields,omitempty"`
+	Source *SourceInfo `json:"source,omitempty"`
+}
+
+// Field describes a struct field. Index identifies it in binary encodings,
+// either declared or its position within the struct, and WireName in other
+// encoded messages. Union names the union the field is a member of, if any.
+type Field struct {
+	Name     string      `json:"name"`
+	Index    int         `json:"index"`
+	WireName string      `json:"wire_name,omitempty"`
+	Union    string      `json:"union,omitempty"`
+	Type     *Type       `json:"type"`
+	Source   *SourceInfo `json:"source,omitempty"`
+}
+
+// Enum describes an enum, nested ones included.
+type Enum struct {
+	Name    string        `json:"name"`
+	Members []*EnumMember `json:"members,omitempty"`
+	// Flags indicates values of the enum may combine the bits of several
+	// members.
+	Flags  bool        `json:"flags,omitempty"`
+	Source *SourceInfo `json:"source,omitempty"`
+}
+
+// EnumMember describes a member of an enum.
+type EnumMember struct {
+	Name   string      `json:"name"`
+	Value  int         `json:"value"`
+	Source *SourceInfo `json:"source,omitempty"`
+}
+
+// Service describes a service and its methods, in declaration order. ID is
+// the stable identifier declared through @id, if any.
+type Service struct {
+	Name    string      `json:"name"`
+	ID      uint32      `json:"id,omitempty"`
+	Methods []*Method   `json:"methods,omitempty"`
+	Source  *SourceInfo `json:"source,omitempty"`
+}
+
+// Method describes a service method. Index is its position within the
+// service, allowing runtimes to dispatch calls through a method table. ID is
+// the stable identifier declared through @id, if any, which unlike Index
+// survives renames and reordering.
+type Method struct {
+	Name       string   `json:"name"`
+	Index      int      `json:"index"`
+	ID         uint32   `json:"id,omitempty"`
+	Params     []*Param `json:"params,omitempty"`
+	Returns    []*Param `json:"returns,omitempty"`
+	Errors     []*Type  `json:"errors,omitempty"`
+	Idempotent bool     `json:"idempotent,omitempty"`
+	ReadOnly   bool     `json:"read_only,omitempty"`
+	// ClientStreaming and ServerStreaming indicate the method streams its
+	// params or its returns, respectively.
+	ClientStreaming bool        `json:"client_streaming,omitempty"`
+	ServerStreaming bool        `json:"server_streaming,omitempty"`
+	Source          *SourceInfo `json:"source,omitempty"`
+}
+
+// Param describes a parameter or return value of a method. Name is empty
+// for return values and streams.
+type Param struct {
+	Name   string `json:"name,omitempty"`
+	Stream bool   `json:"stream,omitempty"`
+	Type   *Type  `json:"type"`
+}
+
+// TypeKind identifies the kind of a Type.
+type TypeKind string
+
+const (
+	KindPrimitive TypeKind = "primitive"
+	KindStruct    TypeKind = "struct"
+	KindEnum      TypeKind = "enum"
+	KindArray     TypeKind = "array"
+	KindSet       TypeKind = "set"
+	KindMap       TypeKind = "map"
+	KindOptional  TypeKind = "optional"
+)
+
+// Type describes the type of a field or parameter. Name holds the name of
+// primitives, such as int32, and the fully qualified name of structs and
+// enums. Elem holds the element type of arrays, sets and optionals, and the
+// value type of maps, whose key type is held by Key.
+type Type struct {
+	Kind TypeKind `json:"kind"`
+	Name string   `json:"name,omitempty"`
+	Key  *Type    `json:"key,omitempty"`
+	Elem *Type    `json:"elem,omitempty"`
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case KindArray, KindSet, KindOptional:
+		return fmt.Sprintf("%s<%s>", t.Kind, t.Elem)
+	case KindMap:
+		return fmt.Sprintf("map<%s, %s>", t.Key, t.Elem)
+	}
+	return t.Name
+}
+
+// SourceInfo locates a declaration within the schema declaring it. Comment
+// holds the lines of the comment written before it, and TrailingComment the
+// one written after it on the same line, if any, both as written after #.
+type SourceInfo struct {
+	Filename        string   `json:"filename"`
+	Line            int      `json:"line"`
+	Column          int      `json:"column"`
+	Comment         []string `json:"comment,omitempty"`
+	TrailingComment string   `json:"trailing_comment,omitempty"`
+}
+
+// Option configures Build.
+type Option func(*options)
+
+type options struct {
+	sourceInfo bool
+}
+
+// WithSourceInfo records the position and comments of every declaration.
+func WithSourceInfo() Option {
+	return func(o *options) {
+		o.sourceInfo = true
+	}
+}
+
+// Build returns the descriptors of every declaration in tree. It fails when
+// tree references types that were not resolved, which happens only for trees
+// that did not go through validation.
+func Build(tree *ast.Tree, opts ...Option) (*Set, error) {
+	b := &builder{}
+	for _, opt := range opts {
+		opt(&b.options)
+	}
+	set := &Set{Version: Version}
+	var walk func(s *ast.Struct)
+	walk = func(s *ast.Struct) {
+		set.Structs = append(set.Structs, b.buildStruct(s))
+		for _, e := range s.Enums {
+			set.Enums = append(set.Enums, b.buildEnum(e))
+		}
+		for _, n := range s.Structs {
+			walk(n)
+		}
+	}
+	for _, pkg := range tree.Packages {
+		for _, s := range pkg.Structures {
+			walk(s)
+		}
+		for _, e := range pkg.Enums {
+			set.Enums = append(set.Enums, b.buildEnum(e))
+		}
+		for _, s := range pkg.Services {
+			set.Services = append(set.Services, b.buildService(s))
+		}
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	sort.Slice(set.Structs, func(i, j int) bool { return set.Structs[i].Name < set.Structs[j].Name })
+	sort.Slice(set.Enums, func(i, j int) bool { return set.Enums[i].Name < set.Enums[j].Name })
+	sort.Slice(set.Services, func(i, j int) bool { return set.Services[i].Name < set.Services[j].Name })
+	return set, nil
+}
+
+type builder struct {
+	options
+	err error
+}
+
+// source returns the source info of a declaration, unless it was not
+// requested.
+func (b *builder) source(pos ast.Position, comment []string, trailing string) *SourceInfo {
+	if !b.sourceInfo {
+		return nil
+	}
+	if len(comment) == 0 {
+		comment = nil
+	}
+	return &SourceInfo{
+		Filename:        pos.Filename,
+		Line:            pos.Line,
+		Column:          pos.Column,
+		Comment:         comment,
+		TrailingComment: trailing,
+	}
+}
+
+func (b *builder) buildStruct(s *ast.Struct) *Struct {
+	d := &Struct{Name: s.FQN(), Source: b.source(s.Position, s.Comment, "")}
+	for _, f := range s.AllFields() {
+		field := &Field{Name: f.Name, Index: f.Index, Type: b.buildType(f.Type), Source: b.source(f.Position, f.Comment, f.TrailingComment)}
+		if wire := f.WireName(); wire != f.Name {
+			field.WireName = wire
+		}
+		if f.Union != nil {
+			field.Union = f.Union.Name
+		}
+		d.Fields = append(d.Fields, field)
+	}
+	return d
+}
+
+func (b *builder) buildEnum(e *ast.Enum) *Enum {
+	d := &Enum{Name: e.FQN(), Flags: e.Flags, Source: b.source(e.Position, e.Comment, "")}
+	for _, m := range e.Members {
+		d.Members = append(d.Members, &EnumMember{Name: m.Name, Value: m.Value, Source: b.source(m.Position, m.Comment, m.TrailingComment)})
+	}
+	return d
+}
+
+func (b *builder) buildService(s *ast.Service) *Service {
+	d := &Service{Name: s.FQN(), ID: s.ID, Source: b.source(s.Position, s.Comment, "")}
+	for i, m := range s.Methods {
+		method := &Method{
+			Name:            m.Name,
+			Index:           i,
+			ID:              m.ID,
+			Idempotent:      m.Idempotent,
+			ReadOnly:        m.ReadOnly,
+			ClientStreaming: m.ClientStreaming,
+			ServerStreaming: m.ServerStreaming,
+			Source:          b.source(m.Position, m.Comment, m.TrailingComment),
+		}
+		for _, p := range m.Params {
+			param := &Param{Stream: p.Stream, Type: b.buildType(p.Type)}
+			if p.Name != nil {
+				param.Name = *p.Name
+			}
+			method.Params = append(method.Params, param)
+		}
+		for _, r := range m.Returns {
+			if _, ok := r.Type.(*ast.EmptyType); ok {
+				// Methods returning empty have no returns
+				continue
+			}
+			method.Returns = append(method.Returns, &Param{Stream: r.Stream, Type: b.buildType(r.Type)})
+		}
+		for _, e := range m.Errors {
+			method.Errors = append(method.Errors, b.buildType(e.Type))
+		}
+		d.Methods = append(d.Methods, method)
+	}
+	return d
+}
+
+// buildType returns the descriptor of t, recording an error when t, or one
+// of its elements, was not resolved.
+func (b *builder) buildType(t ast.Type) *Type {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return &Type{Kind: KindPrimitive, Name: tt.Name}
+	case *ast.ArrayType:
+		return &Type{Kind: KindArray, Elem: b.buildType(tt.Type)}
+	case *ast.SetType:
+		return &Type{Kind: KindSet, Elem: b.buildType(tt.Type)}
+	case *ast.OptionalType:
+		return &Type{Kind: KindOptional, Elem: b.buildType(tt.Type)}
+	case *ast.MapType:
+		return &Type{Kind: KindMap, Key: b.buildType(tt.Key), Elem: b.buildType(tt.Value)}
+	case ast.ResolvableType:
+		switch o := tt.Resolved().(type) {
+		case *ast.Struct:
+			return &Type{Kind: KindStruct, Name: o.FQN()}
+		case *ast.Enum:
+			return &Type{Kind: KindEnum, Name: o.FQN()}
+		}
+		if b.err == nil {
+			pos := tt.Pos()
+			b.err = fmt.Errorf("descriptor: unresolved type %s at %s:%d:%d", tt.DeclaredName(), pos.Filename, pos.Line, pos.Column)
+		}
+		return &Type{}
+	}
+	if b.err == nil {
+		b.err = fmt.Errorf("descriptor: unsupported type %T", t)
+	}
+	return &Type{}
+}
+
+// Strip removes the source info recorded by WithSourceInfo from set, in
+// place, and returns it.
+func Strip(set *Set) *Set {
+	for _, s := range set.Structs {
+		s.Source = nil
+		for _, f := range s.Fields {
+			f.Source = nil
+		}
+	}
+	for _, e := range set.Enums {
+		e.Source = nil
+		for _, m := range e.Members {
+			m.Source = nil
+		}
+	}
+	for _, s := range set.Services {
+		s.Source = nil
+		for _, m := range s.Methods {
+			m.Source = nil
+		}
+	}
+	return set
+}
+
+// Marshal encodes set as JSON. Equal sets always produce the same output.
+func Marshal(set *Set) ([]byte, error) {
+	return json.Marshal(set)
+}
+
+// Unmarshal decodes descriptors produced by Marshal.
+func Unmarshal(data []byte) (*Set, error) {
+	set := &Set{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	if set.Version != Version {
+		return nil, fmt.Errorf("unsupported descriptor version %d", set.Version)
+	}
+	return set, nil
+}
+
+// Registry indexes the declarations of a Set by fully qualified name.
+type Registry struct {
+	structs  map[string]*Struct
+	enums    map[string]*Enum
+	services map[string]*Service
+}
+
+// NewRegistry returns a Registry holding the declarations of sets. Later
+// sets take precedence over earlier ones declaring the same names.
+func NewRegistry(sets ...*Set) *Registry {
+	r := &Registry{
+		structs:  map[string]*Struct{},
+		enums:    map[string]*Enum{},
+		services: map[string]*Service{},
+	}
+	for _, set := range sets {
+		for _, s := range set.Structs {
+			r.structs[s.Name] = s
+		}
+		for _, e := range set.Enums {
+			r.enums[e.Name] = e
+		}
+		for _, s := range set.Services {
+			r.services[s.Name] = s
+		}
+	}
+	return r
+}
+
+// Struct returns the struct named fqn, or nil.
+func (r *Registry) Struct(fqn string) *Struct { return r.structs[fqn] }
+
+// Enum returns the enum named fqn, or nil.
+func (r *Registry) Enum(fqn string) *Enum { return r.enums[fqn] }
+
+// Service returns the service named fqn, or nil.
+func (r *Registry) Service(fqn string) *Service { return r.services[fqn] }
+
+// Services returns the names of every service, sorted.
+func (r *Registry) Services() []string {
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Method returns the method named name of the service named service, or nil.
+func (r *Registry) Method(service, name string) *Method {
+	s := r.services[service]
+	if s == nil {
+		return nil
+	}
+	for _, m := range s.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Field returns the field named name of s, or nil.
+func (s *Struct) Field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package descriptor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package example.users;
+
+struct User {
+    enum Role {
+        ADMIN = 0;
+        MEMBER = 1;
+    }
+
+    id int64;
+    @wire_name("display_name")
+    name optional<string>;
+    roles map<string, array<Role>>;
+}
+
+struct GetUserRequest {
+    id int64;
+}
+
+service Users {
+    @readonly
+    Get(r GetUserRequest) -> User;
+    Watch(stream GetUserRequest) -> stream User;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+
+	set, err := Build(tree)
+	require.NoError(t, err)
+	data, err := Marshal(set)
+	require.NoError(t, err)
+	loaded, err := Unmarshal(data)
+	require.NoError(t, err)
+	require.Equal(t, set, loaded)
+
+	rebuilt, err := Build(tree)
+	require.NoError(t, err)
+	again, err := Marshal(rebuilt)
+	require.NoError(t, err)
+	require.Equal(t, data, again)
+
+	r := NewRegistry(loaded)
+	require.Equal(t, []string{"example.users.Users"}, r.Services())
+
+	user := r.Struct("example.users.User")
+	require.NotNil(t, user)
+	require.Len(t, user.Fields, 3)
+	require.Equal(t, &Field{Name: "name", Index: 1, WireName: "display_name", Type: &Type{Kind: KindOptional, Elem: &Type{Kind: KindPrimitive, Name: "string"}}}, user.Field("name"))
+	require.Equal(t, "map<string, array<example.users.User.Role>>", user.Field("roles").Type.String())
+	require.Equal(t, []*EnumMember{{Name: "ADMIN", Value: 0}, {Name: "MEMBER", Value: 1}}, r.Enum("example.users.User.Role").Members)
+
+	get := r.Method("example.users.Users", "Get")
+	require.Equal(t, &Method{
+		Name:       "Get",
+		Index:      0,
+		Params:     []*Param{{Name: "r", Type: &Type{Kind: KindStruct, Name: "example.users.GetUserRequest"}}},
+		Returns:    []*Param{{Type: &Type{Kind: KindStruct, Name: "example.users.User"}}},
+		Idempotent: true,
+		ReadOnly:   true,
+	}, get)
+	watch := r.Method("example.users.Users", "Watch")
+	require.Equal(t, 1, watch.Index)
+	require.True(t, watch.Params[0].Stream)
+	require.True(t, watch.Returns[0].Stream)
+	require.Nil(t, r.Method("example.users.Users", "Delete"))
+
+	_, err = Unmarshal([]byte(`{"version": 99}`))
+	require.EqualError(t, err, "unsupported descriptor version 99")
+}
+
+func TestSourceInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package example.users;
+
+# User is a registered account.
+struct User {
+    id int64; # Never reused
+}
+
+service Users {
+    # Get fetches a user.
+    Get(u User) -> User;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+
+	plain, err := Build(tree)
+	require.NoError(t, err)
+	require.Nil(t, NewRegistry(plain).Struct("example.users.User").Source)
+
+	set, err := Build(tree, WithSourceInfo())
+	require.NoError(t, err)
+	r := NewRegistry(set)
+	user := r.Struct("example.users.User")
+	require.Equal(t, &SourceInfo{Filename: path, Line: 4, Column: 1, Comment: []string{" User is a registered account."}}, user.Source)
+	require.Equal(t, &SourceInfo{Filename: path, Line: 5, Column: 5, TrailingComment: " Never reused"}, user.Field("id").Source)
+	require.Equal(t, []string{" Get fetches a user."}, r.Method("example.users.Users", "Get").Source.Comment)
+
+	stripped, err := Marshal(Strip(set))
+	require.NoError(t, err)
+	expected, err := Marshal(plain)
+	require.NoError(t, err)
+	require.Equal(t, expected, stripped)
+}
+
+func TestBuildImports(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/imported_types/main.arf")
+	require.NoError(t, err)
+	set, err := Build(tree)
+	require.NoError(t, err)
+
+	r := NewRegistry(set)
+	require.Equal(t, &Type{Kind: KindStruct, Name: "shop.common.Money"}, r.Struct("shop.orders.Order").Field("total").Type)
+	require.Equal(t, &Type{Kind: KindEnum, Name: "shop.common.Unit"}, r.Struct("shop.common.Money").Field("unit").Type)
+
+	// Trees that were not validated leave their types unresolved
+	tree.Packages["shop.common"].FindStruct("Money").AllFields()[1].Type.(ast.ResolvableType).SetResolved(nil)
+	_, err = Build(tree)
+	require.ErrorContains(t, err, "descriptor: unresolved type Unit at ")
+}
@@ -0,0 +1,168 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+
+	// SeverityOff is only meaningful as a severity override, and silences
+	// diagnostics with the overridden code.
+	SeverityOff
+)
+
+var severityAsString = map[Severity]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityInfo:    "info",
+	SeverityOff:     "off",
+}
+
+func (s Severity) String() string {
+	return severityAsString[s]
+}
+
+// ParseSeverity parses severities as written in configuration files: error,
+// warning (or warn), info, or off.
+func ParseSeverity(s string) (Severity, error) {
+	if s == "warn" {
+		return SeverityWarning, nil
+	}
+	for sev, name := range severityAsString {
+		if name == s {
+			return sev, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid severity %s", s)
+}
+
+// Diagnostic codes identify rules whose severity can be overridden, either
+// through WithSeverity or severity directives in arf.mod, so legacy schemas can
+// be adopted gradually. Diagnostics without a code report problems that always
+// prevent a schema from compiling.
+const (
+	CodeNamingCase        = "naming-case"
+	CodeUnknownAnnotation = "unknown-annotation"
+	CodeWireNameCollision = "wire-name-collision"
+	CodeReadOnlyHTTP      = "readonly-http"
+	CodePackageVersion    = "package-version"
+	CodeAmbiguousImport   = "ambiguous-import"
+	CodePackageLayout     = "package-layout"
+	CodeEmptyStruct       = "empty-struct"
+	CodeEmptyService      = "empty-service"
+	CodeUnusedImport      = "unused-import"
+	CodeImportFormat      = "import-format"
+	CodeNameLength        = "name-length"
+	CodeUnstableExposure  = "unstable-exposure"
+	CodeImplicitEnumValue = "implicit-enum-value"
+	CodeDeprecatedUsage   = "deprecated-usage"
+
+	// CodeFieldOrder is off unless enabled through WithFieldOrder, or by
+	// overriding its severity.
+	CodeFieldOrder = "field-order"
+)
+
+var diagnosticCodes = map[string]struct{}{
+	CodeNamingCase:        {},
+	CodeUnknownAnnotation: {},
+	CodeWireNameCollision: {},
+	CodeReadOnlyHTTP:      {},
+	CodePackageVersion:    {},
+	CodeAmbiguousImport:   {},
+	CodePackageLayout:     {},
+	CodeEmptyStruct:       {},
+	CodeEmptyService:      {},
+	CodeUnusedImport:      {},
+	CodeImportFormat:      {},
+	CodeNameLength:        {},
+	CodeUnstableExposure:  {},
+	CodeImplicitEnumValue: {},
+	CodeDeprecatedUsage:   {},
+	CodeFieldOrder:        {},
+}
+
+func validateCode(code string) error {
+	if _, ok := diagnosticCodes[code]; !ok {
+		return fmt.Errorf("unknown diagnostic code %s", code)
+	}
+	return nil
+}
+
+// Diagnostic represents a problem found in a schema, along with its severity
+// and position.
+type Diagnostic struct {
+	Severity Severity
+	Position ast.Position
+	Message  string
+
+	// Code identifies the rule that reported the diagnostic, if its severity
+	// can be overridden.
+	Code string
+
+	// Fixes holds suggested changes resolving the diagnostic, if any.
+	Fixes []*Fix
+
+	// cause holds the error this diagnostic was created from, if any.
+	cause error
+}
+
+func newDiagnostic(sev Severity, pos ast.Position, format string, args ...any) *Diagnostic {
+	return &Diagnostic{Severity: sev, Position: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// diagnosticsOf flattens err into diagnostics. Errors that are not diagnostics
+// themselves, such as I/O failures, are reported as errors without a position.
+func diagnosticsOf(err error) []*Diagnostic {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *Diagnostic:
+		return []*Diagnostic{e}
+	case interface{ Unwrap() []error }:
+		var diags []*Diagnostic
+		for _, inner := range e.Unwrap() {
+			diags = append(diags, diagnosticsOf(inner)...)
+		}
+		return diags
+	default:
+		return []*Diagnostic{{Severity: SeverityError, Message: err.Error(), cause: err}}
+	}
+}
+
+func newCodedDiagnostic(code string, sev Severity, pos ast.Position, format string, args ...any) *Diagnostic {
+	d := newDiagnostic(sev, pos, format, args...)
+	d.Code = code
+	return d
+}
+
+func joinDiagnostics(diags []*Diagnostic) error {
+	errs := make([]error, len(diags))
+	for i, d := range diags {
+		errs[i] = d
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Diagnostic) Unwrap() error { return d.cause }
+
+func (d *Diagnostic) Error() string {
+	label := d.Severity.String()
+	if d.Code != "" {
+		label += "[" + d.Code + "]"
+	}
+	if d.Position.Filename == "" && d.Position.Line == 0 {
+		return fmt.Sprintf("%s: %s", label, d.Message)
+	}
+	if d.Position.Line == 0 {
+		return fmt.Sprintf("%s: %s at %s", label, d.Message, d.Position.Filename)
+	}
+	return fmt.Sprintf("%s: %s at %s, line %d, column %d", label, d.Message, d.Position.Filename, d.Position.Line, d.Position.Column)
+}
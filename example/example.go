@@ -0,0 +1,202 @@
+// Package example produces realistic example JSON documents for types declared
+// in validated arf trees, for use by documentation generators and API portals.
+package example
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Generate returns an example value for obj, which must be a struct or an enum.
+// Structs are returned as an Object preserving field declaration order, with
+// optional fields populated so every part of the shape is visible. As at most
+// one member of a union is set, only the first one is populated.
+func Generate(obj ast.Object) (any, error) {
+	g := &generator{visiting: map[*ast.Struct]bool{}}
+	switch o := obj.(type) {
+	case *ast.Struct:
+		return g.structValue(o), nil
+	case *ast.Enum:
+		return enumValue(o), nil
+	default:
+		return nil, fmt.Errorf("cannot generate an example for %s %s", obj.Kind(), obj.FQN())
+	}
+}
+
+// JSON returns the example produced by Generate as an indented JSON document.
+func JSON(obj ast.Object) ([]byte, error) {
+	v, err := Generate(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// Member is a single key/value pair of an Object.
+type Member struct {
+	Key   string
+	Value any
+}
+
+// Object is a JSON object whose members are encoded in order.
+type Object []Member
+
+func (o Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type generator struct {
+	visiting map[*ast.Struct]bool
+}
+
+func (g *generator) structValue(s *ast.Struct) Object {
+	g.visiting[s] = true
+	defer delete(g.visiting, s)
+
+	fields := s.AllFields()
+	obj := make(Object, 0, len(fields))
+	for _, f := range fields {
+		if f.Union != nil && f.Union.Fields[0] != f {
+			continue
+		}
+		obj = append(obj, Member{Key: f.WireName(), Value: g.value(f.WireName(), f.Type)})
+	}
+	return obj
+}
+
+func (g *generator) value(name string, t ast.Type) any {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return primitiveValue(name, tt.Name)
+	case *ast.OptionalType:
+		return g.value(name, tt.Type)
+	case *ast.ArrayType:
+		// Recursive types are cut at the first repetition, leaving an empty
+		// collection rather than an infinitely deep document.
+		if g.recursive(tt.Type) {
+			return []any{}
+		}
+		return []any{g.value(name, tt.Type)}
+	case *ast.SetType:
+		if g.recursive(tt.Type) {
+			return []any{}
+		}
+		return []any{g.value(name, tt.Type)}
+	case *ast.MapType:
+		if g.recursive(tt.Value) {
+			return Object{}
+		}
+		return Object{{Key: g.key(tt.Key), Value: g.value(name, tt.Value)}}
+	case ast.ResolvableType:
+		switch o := tt.Resolved().(type) {
+		case *ast.Enum:
+			return enumValue(o)
+		case *ast.Struct:
+			if g.visiting[o] {
+				return nil
+			}
+			return g.structValue(o)
+		}
+	}
+	return nil
+}
+
+func (g *generator) recursive(t ast.Type) bool {
+	for {
+		switch tt := t.(type) {
+		case *ast.OptionalType:
+			t = tt.Type
+			continue
+		case ast.ResolvableType:
+			s, ok := tt.Resolved().(*ast.Struct)
+			return ok && g.visiting[s]
+		}
+		return false
+	}
+}
+
+func (g *generator) key(t ast.Type) string {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		if tt.Name == "string" {
+			return "key"
+		}
+		return fmt.Sprint(primitiveValue("key", tt.Name))
+	case ast.ResolvableType:
+		if e, ok := tt.Resolved().(*ast.Enum); ok {
+			return enumValue(e)
+		}
+	}
+	return "key"
+}
+
+func enumValue(e *ast.Enum) string {
+	if len(e.Members) == 0 {
+		return ""
+	}
+	return e.Members[0].Name
+}
+
+func primitiveValue(name, primitive string) any {
+	switch primitive {
+	case "bool":
+		return true
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64":
+		return 42
+	case "float32", "float64":
+		return 3.14
+	case "bytes":
+		return "ZXhhbXBsZQ=="
+	case "timestamp":
+		return "2024-01-01T12:00:00Z"
+	case "duration":
+		return "1m30s"
+	case "uuid":
+		return "123e4567-e89b-12d3-a456-426614174000"
+	case "decimal128":
+		return "12.50"
+	case "string":
+		return stringValue(name)
+	}
+	return nil
+}
+
+// stringValue picks a sample string matching common field naming patterns.
+func stringValue(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "email"):
+		return "user@example.com"
+	case strings.Contains(lower, "url") || strings.Contains(lower, "uri"):
+		return "https://example.com"
+	case lower == "id" || strings.HasSuffix(lower, "_id"):
+		return "3f2a9c1e"
+	case strings.Contains(lower, "name"):
+		return "Jane Doe"
+	default:
+		return "example " + strings.ReplaceAll(name, "_", " ")
+	}
+}
@@ -0,0 +1,67 @@
+package example
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSON(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/full.arf")
+	require.NoError(t, err)
+	obj := tree.Packages["v1beta1.demo.allfeatures"].Files[0].FindStruct("Everything")
+	require.NotNil(t, obj)
+
+	data, err := JSON(obj)
+	require.NoError(t, err)
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(data, &doc))
+	require.Equal(t, true, doc["a_bool"])
+	require.Equal(t, float64(42), doc["a_int8"])
+	require.Equal(t, "example a opt string", doc["a_opt_string"])
+	require.Equal(t, map[string]any{"id": float64(42), "name": "Jane Doe", "nums": []any{float64(42)}}, doc["a_opt_nested"])
+	require.Equal(t, map[string]any{"key": []any{float64(42)}}, doc["a_map_str_arr"])
+	require.Equal(t, map[string]any{"name": "Jane Doe"}, doc["a_from_other_file"])
+
+	// Field declaration order is preserved.
+	require.Regexp(t, `(?s)^\{\s+"a_bool".*"a_from_other_file_2"`, string(data))
+}
+
+func TestRecursiveStruct(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package example.tree;
+
+struct Node {
+    label    string;
+    parent   optional<Node>;
+    children array<Node>;
+    mode     Mode;
+}
+
+enum Mode {
+    LEAF = 1;
+    BRANCH = 2;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+
+	data, err := JSON(tree.Packages["example.tree"].Files[0].FindStruct("Node"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"label": "example label", "parent": null, "children": [], "mode": "LEAF"}`, string(data))
+}
+
+func TestUnions(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/unions.arf")
+	require.NoError(t, err)
+
+	// Only the first member of the union is set
+	data, err := JSON(tree.Packages["contacts"].FindStruct("Contact"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id": "3f2a9c1e", "email": "user@example.com", "nickname": "Jane Doe"}`, string(data))
+}
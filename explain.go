@@ -0,0 +1,78 @@
+package idl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Explain writes to w how src, a schema, is understood by the compiler: the
+// tokens it is split into, the syntax tree they are parsed into, and the
+// diagnostics reported while compiling it. Imports are resolved from the
+// working directory. It helps learning the grammar, and debugging the parser.
+func Explain(w io.Writer, src []byte) error {
+	tokens, _ := lexFile(src, nil)
+	file, _ := parse("<stdin>", tokens, nil)
+
+	var b bytes.Buffer
+	b.WriteString("Tokens:\n")
+	for _, t := range tokens {
+		fmt.Fprintf(&b, "  %d:%d %s %q\n", t.Line, t.Column, t.Type, t.Value)
+	}
+	b.WriteString("AST:\n")
+	ast.Fprint(&b, file)
+
+	b.WriteString("Diagnostics:\n")
+	fe, err := New(StdinEntrypoint, WithStdin(bytes.NewReader(src)))
+	if err != nil {
+		return err
+	}
+	res := fe.Compile()
+	if len(res.Diagnostics) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, d := range res.Diagnostics {
+		fmt.Fprintf(&b, "  %s\n", d.Error())
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// REPL reads schema snippets from r, each ended by an empty line, and
+// explains every one of them to w as Explain does. Prompts are written to w
+// before each line is read; the end of r ends the session.
+func REPL(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	var snippet strings.Builder
+	prompt := "arf> "
+	for {
+		if _, err := io.WriteString(w, prompt); err != nil {
+			return err
+		}
+		more := scanner.Scan()
+		line := scanner.Text()
+		if more && strings.TrimSpace(line) != "" {
+			snippet.WriteString(line)
+			snippet.WriteByte('\n')
+			prompt = "...> "
+			continue
+		}
+		if snippet.Len() > 0 {
+			if err := Explain(w, []byte(snippet.String())); err != nil {
+				return err
+			}
+			snippet.Reset()
+		}
+		prompt = "arf> "
+		if !more {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+			return scanner.Err()
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package idl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, Explain(&b, []byte("package p;\n\nstruct S {\n    id int32;\n}\n")))
+	out := b.String()
+	require.Contains(t, out, "Tokens:\n  1:1 Identifier \"package\"\n  1:9 Identifier \"p\"\n  1:10 Semi \";\"\n")
+	require.Contains(t, out, "AST:\nFile: <stdin>\n  Package: p\n  Structs:\n    - Name: S\n      Fields:\n        - id\n          Kind: int32\n")
+	require.True(t, strings.HasSuffix(out, "Diagnostics:\n  none\n"), out)
+
+	b.Reset()
+	require.NoError(t, Explain(&b, []byte("package p;\n\nstruct S {\n    id Missing;\n}\n")))
+	require.Contains(t, b.String(), "Diagnostics:\n  error: ")
+	require.Contains(t, b.String(), "Missing")
+}
+
+func TestREPL(t *testing.T) {
+	var b bytes.Buffer
+	in := strings.NewReader("package p;\nenum E {\n  A;\n}\n\n\npackage q;\n")
+	require.NoError(t, REPL(in, &b))
+	out := b.String()
+	require.True(t, strings.HasPrefix(out, "arf> ...> ...> ...> ...> Tokens:\n"), out)
+	require.Equal(t, 2, strings.Count(out, "Tokens:\n"))
+	require.Contains(t, out, "Package: q")
+	require.True(t, strings.HasSuffix(out, "  none\n\n"), out)
+}
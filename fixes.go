@@ -0,0 +1,138 @@
+package idl
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// TextEdit replaces the text between Start and End with NewText. Start is
+// inclusive and End exclusive; both use the 1-based lines and rune columns
+// reported by diagnostics. Insertions have Start equal to End.
+type TextEdit struct {
+	Start   ast.Position
+	End     ast.Position
+	NewText string
+}
+
+// Fix is a change suggested by a diagnostic which can be applied without
+// further input, for instance by editors or `arf-idl fix`.
+type Fix struct {
+	Title string
+	Edits []TextEdit
+}
+
+// ApplyEdits applies edits to src, returning the modified contents. Edits
+// must not overlap, and may be provided in any order.
+func ApplyEdits(src []byte, edits []TextEdit) ([]byte, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+	spans := make([]span, len(edits))
+	for i, e := range edits {
+		start, err := offsetOf(src, e.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := offsetOf(src, e.End)
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid edit: end at line %d, column %d precedes start", e.End.Line, e.End.Column)
+		}
+		spans[i] = span{start, end, e.NewText}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			return nil, fmt.Errorf("overlapping edits")
+		}
+	}
+
+	var b bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		b.Write(src[last:s.start])
+		b.WriteString(s.text)
+		last = s.end
+	}
+	b.Write(src[last:])
+	return b.Bytes(), nil
+}
+
+// offsetOf converts pos into a byte offset within src. Positions right past the
+// end of a line, or of src, are accepted.
+func offsetOf(src []byte, pos ast.Position) (int, error) {
+	line, column := 1, 1
+	for i, r := range string(src) {
+		if line == pos.Line && column == pos.Column {
+			return i, nil
+		}
+		if r == '\n' {
+			if line == pos.Line {
+				break
+			}
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	if line == pos.Line && column == pos.Column {
+		return len(src), nil
+	}
+	return 0, fmt.Errorf("invalid position line %d, column %d", pos.Line, pos.Column)
+}
+
+// replaceFix returns a fix replacing the n runes starting at pos with text.
+func replaceFix(title string, pos ast.Position, n int, text string) *Fix {
+	return &Fix{Title: title, Edits: []TextEdit{replaceEdit(pos, n, text)}}
+}
+
+func replaceEdit(pos ast.Position, n int, text string) TextEdit {
+	end := pos
+	end.Column += n
+	return TextEdit{Start: pos, End: end, NewText: text}
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// closestMatch returns the candidate closest to name, provided it is similar
+// enough to be considered a typo.
+func closestMatch(name string, candidates []string) (string, bool) {
+	best, bestDist := "", -1
+	limit := max(1, len([]rune(name))/3)
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		if d := levenshtein(name, c); d <= limit && (bestDist == -1 || d < bestDist) {
+			best, bestDist = c, d
+		}
+	}
+	return best, bestDist != -1
+}
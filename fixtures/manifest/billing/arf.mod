@@ -0,0 +1,6 @@
+# Billing schemas
+module acme.billing
+
+dep acme.common ../common
+dep acme.types
+option go module=example.com/acme/billing
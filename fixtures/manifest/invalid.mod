@@ -0,0 +1,3 @@
+module a
+dep x ../x
+dep x ../y
@@ -0,0 +1,5 @@
+module legacy
+
+# Older schemas predate the naming rules
+severity naming-case warning
+severity empty-struct off
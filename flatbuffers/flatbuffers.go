@@ -0,0 +1,434 @@
+// Package flatbuffers exports validated arf trees as FlatBuffers schemas
+// (.fbs), for users who want zero-copy access to arf-defined data.
+//
+// Each arf package is exported to its own schema, named after the package
+// components (org.example.users becomes org/example/users.fbs). Structs become
+// tables whose field ids match the arf field indexes, gaps between indexes
+// being filled with deprecated placeholder fields, as FlatBuffers requires ids
+// to be contiguous. Nested declarations are flattened by joining their names
+// with an underscore, maps are exported as vectors of generated entry tables,
+// and unions as FlatBuffers unions of tables wrapping each member. Unions take
+// the two consecutive ids starting at the lowest index of their members. Enums
+// take the smallest integer type holding their values, and flags enums are
+// exported as bit_flags enums.
+package flatbuffers
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// maxFieldID is the largest field id FlatBuffers tables can hold, as vtables
+// store field offsets as 16-bit integers.
+const maxFieldID = 0x7ffc
+
+var primitives = map[string]string{
+	"bool":       "bool",
+	"int8":       "byte",
+	"int16":      "short",
+	"int32":      "int",
+	"int64":      "long",
+	"uint8":      "ubyte",
+	"uint16":     "ushort",
+	"uint32":     "uint",
+	"uint64":     "ulong",
+	"float32":    "float",
+	"float64":    "double",
+	"string":     "string",
+	"bytes":      "[ubyte]",
+	"timestamp":  "long",
+	"uuid":       "[ubyte]",
+	"duration":   "long",
+	"decimal128": "string",
+}
+
+// Export converts every package in tree into a FlatBuffers schema, returning
+// the schemas keyed by their path.
+func Export(tree *ast.Tree) (map[string][]byte, error) {
+	names := make([]string, 0, len(tree.Packages))
+	for name := range tree.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := ExportPackage(tree.Packages[name])
+		if err != nil {
+			return nil, err
+		}
+		res[SchemaPath(name)] = data
+	}
+	return res, nil
+}
+
+// SchemaPath returns the path of the schema generated for pkg.
+func SchemaPath(pkg string) string {
+	return strings.ReplaceAll(pkg, ".", "/") + ".fbs"
+}
+
+// ExportPackage converts a single package into a FlatBuffers schema.
+func ExportPackage(pkg *ast.PackageTree) ([]byte, error) {
+	e := &exporter{pkg: pkg.Package, includes: map[string]struct{}{}}
+	for _, en := range pkg.Enums {
+		e.exportEnum(en)
+	}
+	for _, s := range pkg.Structures {
+		if err := e.exportStruct(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range pkg.Services {
+		e.exportService(s)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated from arf package %s. DO NOT EDIT.\n\n", pkg.Package)
+	includes := make([]string, 0, len(e.includes))
+	for inc := range e.includes {
+		includes = append(includes, inc)
+	}
+	sort.Strings(includes)
+	for _, inc := range includes {
+		fmt.Fprintf(&out, "include %q;\n", SchemaPath(inc))
+	}
+	if len(includes) > 0 {
+		out.WriteString("\n")
+	}
+	fmt.Fprintf(&out, "namespace %s;\n", pkg.Package)
+	out.Write(e.body.Bytes())
+	return out.Bytes(), nil
+}
+
+type exporter struct {
+	pkg      string
+	includes map[string]struct{}
+	body     bytes.Buffer
+}
+
+func (e *exporter) printf(format string, args ...any) {
+	fmt.Fprintf(&e.body, format, args...)
+}
+
+func (e *exporter) printComment(comment []string, indent string) {
+	for _, c := range comment {
+		e.printf("%s///%s\n", indent, c)
+	}
+}
+
+// localName flattens the name of a possibly nested declaration, relative to
+// its package: Outer.Inner becomes Outer_Inner.
+func localName(obj ast.Object) string {
+	pkg := obj.Pos().File.Package.Value
+	return strings.ReplaceAll(strings.TrimPrefix(obj.FQN(), pkg+"."), ".", "_")
+}
+
+func (e *exporter) exportEnum(en *ast.Enum) {
+	members := make([]*ast.EnumMember, len(en.Members))
+	copy(members, en.Members)
+	// FlatBuffers requires enum values to be declared in ascending order
+	sort.SliceStable(members, func(i, j int) bool { return members[i].Value < members[j].Value })
+
+	e.printf("\n")
+	e.printComment(en.Comment, "")
+	if en.Flags {
+		e.exportFlags(en, members)
+		return
+	}
+	var lowest, highest int
+	if len(members) > 0 {
+		lowest, highest = members[0].Value, members[len(members)-1].Value
+	}
+	e.printf("enum %s : %s {\n", localName(en), underlyingType(lowest, highest))
+	for _, m := range members {
+		e.printComment(m.Comment, "  ")
+		e.printf("  %s = %d,\n", m.Name, m.Value)
+	}
+	e.printf("}\n")
+}
+
+// exportFlags exports en, a flags enum whose members are sorted by value, as a
+// bit_flags enum. FlatBuffers declares such members by the position of their
+// bit: members combining several bits, or none, are only listed in comments.
+func (e *exporter) exportFlags(en *ast.Enum, members []*ast.EnumMember) {
+	var highest int
+	if len(members) > 0 {
+		highest = members[len(members)-1].Value
+	}
+	e.printf("enum %s : %s (bit_flags) {\n", localName(en), underlyingType(0, highest))
+	for _, m := range members {
+		e.printComment(m.Comment, "  ")
+		if v := uint64(m.Value); v == 0 || bits.OnesCount64(v) > 1 {
+			e.printf("  // %s = %d is not a single flag, and is not exported\n", m.Name, m.Value)
+			continue
+		}
+		e.printf("  %s = %d,\n", m.Name, bits.TrailingZeros64(uint64(m.Value)))
+	}
+	e.printf("}\n")
+}
+
+// underlyingType returns the smallest FlatBuffers integer type holding every
+// value between lowest and highest, unsigned unless lowest is negative.
+func underlyingType(lowest, highest int) string {
+	if lowest < 0 {
+		switch {
+		case lowest >= math.MinInt8 && highest <= math.MaxInt8:
+			return "byte"
+		case lowest >= math.MinInt16 && highest <= math.MaxInt16:
+			return "short"
+		case lowest >= math.MinInt32 && highest <= math.MaxInt32:
+			return "int"
+		}
+		return "long"
+	}
+	switch {
+	case highest <= math.MaxUint8:
+		return "ubyte"
+	case highest <= math.MaxUint16:
+		return "ushort"
+	case highest <= math.MaxUint32:
+		return "uint"
+	}
+	return "ulong"
+}
+
+func (e *exporter) exportStruct(s *ast.Struct) error {
+	for _, en := range s.Enums {
+		e.exportEnum(en)
+	}
+	for _, ss := range s.Structs {
+		if err := e.exportStruct(ss); err != nil {
+			return err
+		}
+	}
+
+	name := localName(s)
+	var decls []string
+	e.printf("\n")
+	e.printComment(s.Comment, "")
+	e.printf("table %s {\n", name)
+	fields := slices.Clone(s.AllFields())
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Index < fields[j].Index })
+	next := 0
+	exported := map[*ast.Union]bool{}
+	for i, f := range fields {
+		if f.Index > maxFieldID {
+			return fmt.Errorf("%s.%s: index %d exceeds the largest FlatBuffers field id, %d", s.FQN(), f.Name, f.Index, maxFieldID)
+		}
+		if exported[f.Union] {
+			// Exported along the first member of the union
+			continue
+		}
+		for ; next < f.Index; next++ {
+			e.printf("  _unused_%d:ubyte (id: %d, deprecated);\n", next, next)
+		}
+		next = f.Index + 1
+
+		if f.Union != nil {
+			// Union fields take two ids, the first one holding the type
+			// of the value
+			if i+1 == len(fields) || fields[i+1].Union != f.Union || fields[i+1].Index != f.Index+1 {
+				return fmt.Errorf("%s.%s: FlatBuffers unions take two consecutive ids, but no other member of the union has index %d", s.FQN(), f.Union.Name, f.Index+1)
+			}
+			union, err := e.union(name, f.Union, &decls)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", s.FQN(), f.Union.Name, err)
+			}
+			e.printComment(f.Union.Comment, "  ")
+			e.printf("  %s:%s (id: %d);\n", f.Union.Name, union, f.Index+1)
+			exported[f.Union] = true
+			next++
+			continue
+		}
+
+		typ, def, err := e.memberType(fmt.Sprintf("%s_%s", name, camel(f.Name)), f, &decls)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", s.FQN(), f.Name, err)
+		}
+		e.printComment(f.Comment, "  ")
+		e.printf("  %s:%s%s (id: %d);\n", f.Name, typ, def, f.Index)
+	}
+	e.printf("}\n")
+	for _, decl := range decls {
+		e.printf("\n%s", decl)
+	}
+	return nil
+}
+
+// memberType returns the FlatBuffers type and default value clause of f, as
+// fieldType does. Maps are exported as vectors of entry tables, whose
+// declaration is appended to decls; prefix is the name of the table.
+func (e *exporter) memberType(prefix string, f *ast.StructField, decls *[]string) (string, string, error) {
+	typ, def, err := e.fieldType(f.Type)
+	if m, ok := f.Type.(*ast.MapType); ok && err == nil {
+		entry := prefix + "Entry"
+		*decls = append(*decls, e.mapEntry(entry, m))
+		typ, def = "["+entry+"]", ""
+	}
+	return typ, def, err
+}
+
+// union returns the name of the FlatBuffers union exported for u, a union of
+// the struct exported as table, appending its declaration to decls.
+// FlatBuffers unions only hold tables: each member is wrapped in a table
+// holding its value, named after the union and the member.
+func (e *exporter) union(table string, u *ast.Union, decls *[]string) (string, error) {
+	name := fmt.Sprintf("%s_%sUnion", table, camel(u.Name))
+	var members, wrappers []string
+	for _, f := range u.Fields {
+		wrapper := fmt.Sprintf("%s_%s%s", table, camel(u.Name), camel(f.Name))
+		typ, def, err := e.memberType(wrapper, f, &wrappers)
+		if err != nil {
+			return "", fmt.Errorf("member %s: %w", f.Name, err)
+		}
+		members = append(members, fmt.Sprintf("%s:%s", f.Name, wrapper))
+		wrappers = append(wrappers, fmt.Sprintf("table %s {\n  value:%s%s (id: 0);\n}\n", wrapper, typ, def))
+	}
+	*decls = append(*decls, fmt.Sprintf("union %s {\n  %s\n}\n", name, strings.Join(members, ",\n  ")))
+	*decls = append(*decls, wrappers...)
+	return name, nil
+}
+
+func (e *exporter) mapEntry(name string, m *ast.MapType) string {
+	key, _, _ := e.fieldType(m.Key)
+	value, def, _ := e.fieldType(m.Value)
+	return fmt.Sprintf("table %s {\n  key:%s (key, id: 0);\n  value:%s%s (id: 1);\n}\n", name, key, value, def)
+}
+
+// fieldType returns the FlatBuffers type for t, along with a default value
+// clause, used to make scalars optional.
+func (e *exporter) fieldType(t ast.Type) (string, string, error) {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return primitives[tt.Name], "", nil
+	case ast.ResolvableType:
+		if tt.Resolved() == nil {
+			return "", "", fmt.Errorf("unresolved type %s", tt.DeclaredName())
+		}
+		return e.reference(tt.Resolved()), "", nil
+	case *ast.OptionalType:
+		inner, _, err := e.fieldType(tt.Type)
+		if err != nil {
+			return "", "", err
+		}
+		if isScalar(tt.Type) {
+			return inner, " = null", nil
+		}
+		return inner, "", nil
+	case *ast.ArrayType:
+		return e.vectorType(tt.Type)
+	case *ast.SetType:
+		// Sets are exported as vectors, whose uniqueness is not enforced
+		return e.vectorType(tt.Type)
+	case *ast.MapType:
+		if _, ok := tt.Value.(*ast.MapType); ok {
+			return "", "", fmt.Errorf("FlatBuffers does not support nested maps")
+		}
+		if _, _, err := e.fieldType(tt.Key); err != nil {
+			return "", "", err
+		}
+		_, _, err := e.fieldType(tt.Value)
+		return "", "", err
+	default:
+		return "", "", fmt.Errorf("unsupported type %s", t.Kind())
+	}
+}
+
+// vectorType returns the FlatBuffers vector type holding elements of elem.
+func (e *exporter) vectorType(elem ast.Type) (string, string, error) {
+	switch elem.(type) {
+	case *ast.ArrayType, *ast.SetType, *ast.MapType, *ast.OptionalType:
+		return "", "", fmt.Errorf("FlatBuffers does not support vectors of %s", strings.ToLower(elem.Kind()))
+	}
+	if p, ok := elem.(*ast.PrimitiveType); ok && p.Name == "bytes" {
+		return "", "", fmt.Errorf("FlatBuffers does not support vectors of bytes")
+	}
+	inner, _, err := e.fieldType(elem)
+	return "[" + inner + "]", "", err
+}
+
+func isScalar(t ast.Type) bool {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		p := primitives[tt.Name]
+		return p != "string" && p != "[ubyte]"
+	case ast.ResolvableType:
+		_, ok := tt.Resolved().(*ast.Enum)
+		return ok
+	}
+	return false
+}
+
+func (e *exporter) reference(obj ast.Object) string {
+	pkg := obj.Pos().File.Package.Value
+	if pkg == e.pkg {
+		return localName(obj)
+	}
+	e.includes[pkg] = struct{}{}
+	return pkg + "." + localName(obj)
+}
+
+func (e *exporter) exportService(s *ast.Service) {
+	e.printf("\n")
+	e.printComment(s.Comment, "")
+	e.printf("rpc_service %s {\n", s.Name)
+	for _, m := range s.Methods {
+		req, resp, streaming, err := e.methodSignature(m)
+		if err != nil {
+			e.printf("  // %s is not exported: %s\n", m.Name, err)
+			continue
+		}
+		e.printComment(m.Comment, "  ")
+		if streaming != "" {
+			e.printf("  %s(%s):%s (streaming: %q);\n", m.Name, req, resp, streaming)
+		} else {
+			e.printf("  %s(%s):%s;\n", m.Name, req, resp)
+		}
+	}
+	e.printf("}\n")
+}
+
+func (e *exporter) methodSignature(m *ast.ServiceMethod) (string, string, string, error) {
+	if len(m.Params) != 1 || len(m.Returns) != 1 {
+		return "", "", "", fmt.Errorf("FlatBuffers methods require exactly one request and one response")
+	}
+	types := make([]string, 2)
+	for i, t := range []ast.Type{m.Params[0].Type, m.Returns[0].Type} {
+		rt, ok := t.(ast.ResolvableType)
+		if !ok {
+			return "", "", "", fmt.Errorf("requests and responses must be structs")
+		}
+		if _, ok = rt.Resolved().(*ast.Struct); !ok {
+			return "", "", "", fmt.Errorf("requests and responses must be structs")
+		}
+		types[i] = e.reference(rt.Resolved())
+	}
+
+	var streaming string
+	switch {
+	case m.Bidirectional():
+		streaming = "bidi"
+	case m.ClientStreaming:
+		streaming = "client"
+	case m.ServerStreaming:
+		streaming = "server"
+	}
+	return types[0], types[1], streaming, nil
+}
+
+func camel(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package flatbuffers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/full.arf")
+	require.NoError(t, err)
+	schemas, err := Export(tree)
+	require.NoError(t, err)
+	require.Len(t, schemas, 3)
+
+	fbs := string(schemas["v1beta1/demo/allfeatures.fbs"])
+	require.Contains(t, fbs, `include "v1beta1/other/common.fbs";`)
+	require.Contains(t, fbs, "namespace v1beta1.demo.allfeatures;")
+	require.Contains(t, fbs, "enum Mode : ubyte {\n  FIRST = 1,")
+	require.Contains(t, fbs, "table Everything_Nested {\n  id:uint (id: 0);")
+	require.Contains(t, fbs, "  a_opt_nested:Everything_Nested (id: 14);")
+	require.Contains(t, fbs, "  a_map_str_u32:[Everything_AMapStrU32Entry] (id: 17);")
+	require.Contains(t, fbs, "table Everything_AMapStrU32Entry {\n  key:string (key, id: 0);\n  value:uint (id: 1);\n}")
+	require.Contains(t, fbs, "  a_from_other_file:v1beta1.other.common.Test (id: 19);")
+	require.Contains(t, fbs, `  NNYY(Everything_Nested):Everything_Nested (streaming: "bidi");`)
+	require.Contains(t, fbs, "  YYNN(Everything):Everything;")
+	require.Contains(t, fbs, "  // NNNN is not exported")
+}
+
+func TestExportFieldIndices(t *testing.T) {
+	fe, err := idl.New(idl.StdinEntrypoint, idl.WithStdin(strings.NewReader(`package users;
+
+struct User {
+    name string = 3;
+    id uint64 = 0;
+    email string = 1;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	schemas, err := Export(res.Tree)
+	require.NoError(t, err)
+	require.Contains(t, string(schemas["users.fbs"]), `table User {
+  id:ulong (id: 0);
+  email:string (id: 1);
+  _unused_2:ubyte (id: 2, deprecated);
+  name:string (id: 3);
+}`)
+}
+
+func TestExportUnions(t *testing.T) {
+	fe, err := idl.New(idl.StdinEntrypoint, idl.WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id uint64;
+    union contact {
+        email string;
+        phone_number string;
+        tags array<string>;
+    }
+    name string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	schemas, err := Export(res.Tree)
+	require.NoError(t, err)
+	fbs := string(schemas["users.fbs"])
+	require.Contains(t, fbs, `table User {
+  id:ulong (id: 0);
+  contact:User_ContactUnion (id: 2);
+  _unused_3:ubyte (id: 3, deprecated);
+  name:string (id: 4);
+}`)
+	require.Contains(t, fbs, "union User_ContactUnion {\n  email:User_ContactEmail,\n  phone_number:User_ContactPhoneNumber,\n  tags:User_ContactTags\n}")
+	require.Contains(t, fbs, "table User_ContactEmail {\n  value:string (id: 0);\n}")
+	require.Contains(t, fbs, "table User_ContactTags {\n  value:[string] (id: 0);\n}")
+
+	fe, err = idl.New(idl.StdinEntrypoint, idl.WithStdin(strings.NewReader(`package users;
+
+struct User {
+    union contact {
+        email string = 0;
+        phone_number string = 2;
+    }
+    name string = 1;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	_, err = Export(res.Tree)
+	require.EqualError(t, err, "users.User.contact: FlatBuffers unions take two consecutive ids, but no other member of the union has index 1")
+}
+
+func TestExportImports(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/imported_types/main.arf")
+	require.NoError(t, err)
+	schemas, err := Export(tree)
+	require.NoError(t, err)
+	require.Contains(t, string(schemas["shop/common.fbs"]), "table Money {\n  amount:long (id: 0);\n  unit:Unit (id: 1);\n}")
+	orders := string(schemas["shop/orders.fbs"])
+	require.Contains(t, orders, `include "shop/common.fbs";`)
+	require.Contains(t, orders, "  total:shop.common.Money (id: 1);\n  lines:[shop.common.Money] (id: 2);")
+
+	// Trees that were not validated leave their types unresolved
+	money := tree.Packages["shop.common"].FindStruct("Money")
+	money.AllFields()[1].Type.(ast.ResolvableType).SetResolved(nil)
+	_, err = Export(tree)
+	require.EqualError(t, err, "shop.common.Money.unit: unresolved type Unit")
+}
+
+func TestExportEnums(t *testing.T) {
+	fe, err := idl.New(idl.StdinEntrypoint, idl.WithStdin(strings.NewReader(`package users;
+
+enum Level {
+    LOW = -1;
+    HIGH = 100;
+}
+
+enum Priority {
+    LOW = -1;
+    HIGH = 300;
+}
+
+enum Code {
+    OK = 0;
+    LARGE = 300;
+}
+
+enum flags Permissions {
+    NONE = 0;
+    READ = 1;
+    WRITE = 2;
+    READ_WRITE = 3;
+    ADMIN = 1 << 8;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	schemas, err := Export(res.Tree)
+	require.NoError(t, err)
+	fbs := string(schemas["users.fbs"])
+	require.Contains(t, fbs, "enum Level : byte {\n  LOW = -1,\n  HIGH = 100,\n}")
+	require.Contains(t, fbs, "enum Priority : short {\n  LOW = -1,\n  HIGH = 300,\n}")
+	require.Contains(t, fbs, "enum Code : ushort {\n  OK = 0,\n  LARGE = 300,\n}")
+	require.Contains(t, fbs, `enum Permissions : ushort (bit_flags) {
+  // NONE = 0 is not a single flag, and is not exported
+  READ = 0,
+  WRITE = 1,
+  // READ_WRITE = 3 is not a single flag, and is not exported
+  ADMIN = 8,
+}`)
+}
@@ -0,0 +1,100 @@
+package idl
+
+import "sort"
+
+// FoldingKind identifies what a FoldingRange encloses.
+type FoldingKind int
+
+const (
+	// FoldBody encloses the body of a struct, enum, or service.
+	FoldBody FoldingKind = iota + 1
+	// FoldComment encloses a block of comments written on consecutive lines.
+	FoldComment
+	// FoldAnnotations encloses annotations written on consecutive lines
+	// before a declaration.
+	FoldAnnotations
+)
+
+var foldingKindAsString = map[FoldingKind]string{
+	FoldBody:        "body",
+	FoldComment:     "comment",
+	FoldAnnotations: "annotations",
+}
+
+func (k FoldingKind) String() string {
+	return foldingKindAsString[k]
+}
+
+// FoldingRange is a region of a schema editors may collapse, spanning from
+// StartLine to EndLine, both 1-based and inclusive.
+type FoldingRange struct {
+	StartLine int
+	EndLine   int
+	Kind      FoldingKind
+}
+
+// FoldingRanges returns the regions of src which may be folded, ordered by
+// their first line. Ranges are computed from tokens alone, so they remain
+// available while the schema contains syntax errors.
+func FoldingRanges(src []byte) []FoldingRange {
+	tokens, _ := lexFile(src, nil)
+	var ranges []FoldingRange
+	add := func(start, end int, kind FoldingKind) {
+		if end > start {
+			ranges = append(ranges, FoldingRange{StartLine: start, EndLine: end, Kind: kind})
+		}
+	}
+
+	var braces []int
+	commentStart, commentEnd := 0, 0
+	annotationStart, annotationEnd := 0, 0
+	parens := 0
+	lastLine := 0
+	for _, t := range tokens {
+		firstOfLine := t.Line != lastLine
+		lastLine = t.lastLine()
+
+		if t.Type == tokenTypeComment && firstOfLine {
+			if commentStart == 0 || commentEnd != t.Line-1 {
+				add(commentStart, commentEnd, FoldComment)
+				commentStart = t.Line
+			}
+			commentEnd = t.lastLine()
+		}
+
+		switch {
+		case parens > 0:
+			// Arguments of annotations may span several lines.
+			annotationEnd = t.Line
+		case t.Type == tokenTypeAtSign && firstOfLine:
+			if annotationStart == 0 || annotationEnd != t.Line-1 {
+				add(annotationStart, annotationEnd, FoldAnnotations)
+				annotationStart = t.Line
+			}
+			annotationEnd = t.Line
+		case firstOfLine && t.Type != tokenTypeComment:
+			add(annotationStart, annotationEnd, FoldAnnotations)
+			annotationStart, annotationEnd = 0, 0
+		}
+
+		switch t.Type {
+		case tokenTypeLeftParen:
+			parens++
+		case tokenTypeRightParen:
+			parens = max(0, parens-1)
+		case tokenTypeLeftCurly:
+			braces = append(braces, t.Line)
+		case tokenTypeRightCurly:
+			if len(braces) > 0 {
+				// Closing braces remain visible, as in most editors.
+				add(braces[len(braces)-1], t.Line-1, FoldBody)
+				braces = braces[:len(braces)-1]
+			}
+		}
+	}
+	add(commentStart, commentEnd, FoldComment)
+	add(annotationStart, annotationEnd, FoldAnnotations)
+
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].StartLine < ranges[j].StartLine })
+	return ranges
+}
@@ -0,0 +1,38 @@
+package idl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldingRanges(t *testing.T) {
+	src := `# Users are managed
+# by this package.
+package folding;
+
+struct User {
+    # Identifier of
+    # the user.
+    id string; # trailing
+    # single
+    name string;
+    struct Inline { a string; }
+}
+
+@idempotent
+@http("GET",
+      "/users")
+@readonly
+service Users {
+    @timeout(5s) Get(r User) -> User;
+}
+`
+	require.Equal(t, []FoldingRange{
+		{StartLine: 1, EndLine: 2, Kind: FoldComment},
+		{StartLine: 5, EndLine: 11, Kind: FoldBody},
+		{StartLine: 6, EndLine: 7, Kind: FoldComment},
+		{StartLine: 14, EndLine: 17, Kind: FoldAnnotations},
+		{StartLine: 18, EndLine: 19, Kind: FoldBody},
+	}, FoldingRanges([]byte(src)))
+}
@@ -0,0 +1,827 @@
+package idl
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FormatOptions configures Format.
+type FormatOptions struct {
+	// Extensions lists the extensions accepted for schema files. Imports
+	// lacking one are given the extension of the file they resolve to.
+	// Defaults to DefaultExtensions.
+	Extensions []string
+
+	// SchemaRoot, when set, rewrites imports of files stored under it as
+	// paths relative to it. Such imports are resolved when compiling with
+	// WithSchemaRoot or WithPackageLayout.
+	SchemaRoot string
+
+	// AlignColumns aligns the types of consecutive struct fields, the values
+	// of consecutive enum members, and their trailing comments in columns.
+	// Declarations separated by blank lines, comments, or annotations are
+	// aligned independently.
+	AlignColumns bool
+
+	// Optionals selects how optional types are written. By default, they are
+	// kept as written.
+	Optionals OptionalStyle
+}
+
+// OptionalStyle is one of the ways optional types may be written.
+type OptionalStyle int
+
+const (
+	// OptionalAsWritten keeps optional types as written.
+	OptionalAsWritten OptionalStyle = iota
+	// OptionalShorthand writes optional<T> as T?.
+	OptionalShorthand
+	// OptionalGeneric writes T? as optional<T>.
+	OptionalGeneric
+)
+
+// formatIndent is the indentation used for each nesting level.
+const formatIndent = "    "
+
+// Format returns the canonical formatting of src, the contents of the schema
+// stored at filename. Comments are kept where they were written, and
+// declarations are never reordered. Imports, however, are sorted,
+// deduplicated, and normalized as described by FormatOptions. Format only
+// fails when src cannot be parsed; violations of naming conventions and other
+// rules are left untouched.
+func Format(filename string, src []byte, opts FormatOptions) ([]byte, error) {
+	tokens, errs := lexFile(src, nil)
+	if errs != nil {
+		for _, err := range errs {
+			if d, ok := err.(*Diagnostic); ok {
+				d.Position.Filename = filename
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+	_, errs = parse(filename, tokens, nil)
+	for _, d := range diagnosticsOf(errors.Join(errs...)) {
+		if d.Code == "" {
+			return nil, errors.Join(errs...)
+		}
+	}
+
+	from, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	var manifest *Manifest
+	if manifestPath, ok := findManifest(filepath.Dir(from)); ok {
+		if manifest, err = ParseManifest(manifestPath); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &formatter{
+		src:    []rune(string(src)),
+		tokens: tokens,
+		from:   from,
+		align:  opts.AlignColumns,
+		imports: &importNormalizer{
+			resolver:   newFileResolver(manifest, opts.SchemaRoot, opts.Extensions),
+			manifest:   manifest,
+			extensions: opts.Extensions,
+			root:       opts.SchemaRoot,
+		},
+	}
+	if opts.Optionals != OptionalAsWritten {
+		f.rewriteOptionals(opts.Optionals)
+	}
+	return f.format(), nil
+}
+
+type formatter struct {
+	src     []rune
+	tokens  []token
+	from    string
+	imports *importNormalizer
+	align   bool
+
+	lines []*formatLine
+	line  *formatLine
+
+	// prev is the last token written. When line is not nil, it may still
+	// receive a trailing comment.
+	prev       *token
+	breakAfter bool
+	depth      int
+	unary      bool
+	throws     bool
+	parens     int
+	angles     int
+	blocks     []string
+	sawImports bool
+}
+
+// formatLine is a line of formatted output. Cells are separated by a single
+// space, or padded so they line up with the cells of neighbouring lines when
+// the line is alignable.
+type formatLine struct {
+	indent    int
+	cells     []string
+	comment   string
+	first     *token
+	keyword   string
+	alignable bool
+}
+
+func (f *formatter) format() []byte {
+	for i := 0; i < len(f.tokens); i++ {
+		t := &f.tokens[i]
+		switch {
+		case t.Type == tokenTypeEOF:
+			i = len(f.tokens)
+			continue
+		case t.Type == tokenTypeIdentifier && t.Value == "import" && f.depth == 0 && !f.sawImports:
+			i = f.formatImports(i) - 1
+			continue
+		case t.Type == tokenTypeAtSign && f.depth == 0 && !f.sawImports && f.annotatesImport(i):
+			i = f.formatImports(i) - 1
+			continue
+		case t.Type == tokenTypeComment && !f.inlineComment(i):
+			f.writeComment(t)
+			continue
+		}
+
+		if t.Type == tokenTypeRightCurly {
+			f.depth--
+			if len(f.blocks) > 0 {
+				f.blocks = f.blocks[:len(f.blocks)-1]
+			}
+		}
+		if t.Type == tokenTypeRightParen {
+			f.parens--
+		}
+
+		if f.line != nil && (f.breakAfter || t.Line != f.prev.lastLine() || t.Type == tokenTypeRightCurly) {
+			f.endLine()
+		}
+		if f.line == nil {
+			f.startLine(t)
+			f.line.first = t
+			f.line.alignable = f.alignable(i)
+			f.line.cells = []string{f.text(t)}
+		} else {
+			f.writeToken(t)
+		}
+		// A minus sign is unary unless it follows an operand
+		f.unary = t.Type == tokenTypeMinus && f.prev != nil && !isOperand(f.prev)
+		// Unlike annotations named throws, throws clauses are spaced from
+		// the parens listing their types.
+		f.throws = t.Type == tokenTypeIdentifier && t.Value == "throws" && f.prev != nil &&
+			f.prev.Type != tokenTypeAtSign && f.prev.Type != tokenTypePeriod
+		if t.Type == tokenTypeIdentifier && f.line.keyword == "" {
+			switch t.Value {
+			case "struct", "union", "enum", "service":
+				f.line.keyword = t.Value
+			}
+		}
+		f.prev = t
+		f.breakAfter = false
+
+		switch t.Type {
+		case tokenTypeLeftAngled:
+			f.angles++
+		case tokenTypeRightAngled:
+			f.angles--
+		case tokenTypeShiftRight:
+			f.angles = max(f.angles-2, 0)
+		case tokenTypeLeftCurly:
+			f.depth++
+			f.blocks = append(f.blocks, f.line.keyword)
+			f.breakAfter = true
+		case tokenTypeLeftParen:
+			f.parens++
+		case tokenTypeSemi:
+			f.breakAfter = true
+		case tokenTypeRightCurly:
+			// Inline structs are followed by the rest of their field or
+			// method declaration.
+			f.breakAfter = !f.continuesDeclaration(i + 1)
+		}
+	}
+	if f.line != nil {
+		f.endLine()
+	}
+	return f.render()
+}
+
+// continuesDeclaration indicates whether the token at i, following a closing
+// brace, continues the declaration the brace is part of, as semicolons,
+// closing angles, question marks and field indices following inline structs
+// do.
+func (f *formatter) continuesDeclaration(i int) bool {
+	if i >= len(f.tokens) {
+		return false
+	}
+	switch f.tokens[i].Type {
+	case tokenTypeSemi, tokenTypeRightAngled, tokenTypeShiftRight, tokenTypeComma, tokenTypeRightParen, tokenTypeQuestion, tokenTypeEqual:
+		return true
+	}
+	return false
+}
+
+// alignable indicates whether a line starting with the token at i declares a
+// struct field, including union members, or an enum member, whose parts are
+// aligned in columns. Reserved statements are left as written.
+func (f *formatter) alignable(i int) bool {
+	t := &f.tokens[i]
+	if len(f.blocks) == 0 || f.parens > 0 || t.Type != tokenTypeIdentifier {
+		return false
+	}
+	if kind := f.blocks[len(f.blocks)-1]; kind != "struct" && kind != "union" && kind != "enum" {
+		return false
+	}
+	if t.Value == "reserved" && i+1 < len(f.tokens) {
+		switch f.tokens[i+1].Type {
+		case tokenTypeNumber, tokenTypeHex, tokenTypeMinus, tokenTypeString:
+			return false
+		}
+	}
+	_, reserved := reservedNames[t.Value]
+	return !reserved
+}
+
+// writeToken appends t to the current line. On alignable lines, the type of a
+// field and the value following an equal sign start new cells, unlike the
+// semicolon ending enum members without a value.
+func (f *formatter) writeToken(t *token) {
+	l := f.line
+	split := l.alignable && f.parens == 0 &&
+		(f.prev == l.first && t.Type != tokenTypeSemi || t.Type == tokenTypeEqual)
+	if split {
+		l.cells = append(l.cells, f.text(t))
+		return
+	}
+	if f.spaced(f.prev, t) {
+		l.cells[len(l.cells)-1] += " "
+	}
+	l.cells[len(l.cells)-1] += f.text(t)
+}
+
+// text returns t as written in the source.
+func (f *formatter) text(t *token) string {
+	return string(f.src[t.Pos:t.End])
+}
+
+// startLine starts a new line for t, preserving up to one blank line from the
+// source between declarations.
+func (f *formatter) startLine(t *token) {
+	if f.prev != nil && t.Line > f.prev.lastLine()+1 &&
+		f.prev.Type != tokenTypeLeftCurly && t.Type != tokenTypeRightCurly {
+		f.lines = append(f.lines, &formatLine{})
+	}
+	f.line = &formatLine{indent: f.depth + f.parens}
+}
+
+func (f *formatter) endLine() {
+	f.lines = append(f.lines, f.line)
+	f.line = nil
+}
+
+func (f *formatter) writeComment(t *token) {
+	if f.line != nil && f.prev.lastLine() == t.Line {
+		f.line.comment = f.commentText(t)
+	} else {
+		if f.line != nil {
+			f.endLine()
+		}
+		f.startLine(t)
+		f.line.cells = []string{f.commentText(t)}
+	}
+	f.prev = t
+	f.endLine()
+}
+
+// commentText returns the comment t as written in the source, block comments
+// being kept verbatim.
+func (f *formatter) commentText(t *token) string {
+	if t.Block {
+		return f.text(t)
+	}
+	return "#" + t.Value
+}
+
+// inlineComment indicates whether the token at i is a block comment followed
+// by other tokens on the line it ends, such as the one in
+// `id /* user */ int64;`, which is written along with them.
+func (f *formatter) inlineComment(i int) bool {
+	t := &f.tokens[i]
+	if !t.Block || i+1 >= len(f.tokens) {
+		return false
+	}
+	next := &f.tokens[i+1]
+	return next.Type != tokenTypeEOF && next.Type != tokenTypeComment && next.Line == t.lastLine()
+}
+
+// spaced indicates whether a space separates a and b when written on the
+// same line.
+func (f *formatter) spaced(a, b *token) bool {
+	switch b.Type {
+	case tokenTypeSemi, tokenTypeComma, tokenTypeRightParen, tokenTypeRightAngled,
+		tokenTypePeriod, tokenTypeLeftAngled, tokenTypeQuestion:
+		return false
+	case tokenTypeLeftParen:
+		// Method and annotation names are directly followed by their
+		// arguments, unlike parenthesized expressions.
+		if a.Type == tokenTypeIdentifier && !f.throws {
+			return false
+		}
+	case tokenTypeShiftRight:
+		// Closes nested types, such as array<array<int32>>
+		return f.angles == 0
+	}
+	switch a.Type {
+	case tokenTypeLeftParen, tokenTypeLeftAngled, tokenTypePeriod, tokenTypeAtSign, tokenTypeTilde:
+		return false
+	case tokenTypeMinus:
+		return !f.unary
+	}
+	return true
+}
+
+func isOperand(t *token) bool {
+	if t.Type == tokenTypeIdentifier && t.Value == "reserved" {
+		// Only reserved statements are followed by a minus sign
+		return false
+	}
+	switch t.Type {
+	case tokenTypeIdentifier, tokenTypeNumber, tokenTypeHex, tokenTypeFloat, tokenTypeRightParen:
+		return true
+	}
+	return false
+}
+
+// render writes lines, aligning runs of consecutive alignable lines sharing
+// the same indentation when alignment is enabled.
+func (f *formatter) render() []byte {
+	var b bytes.Buffer
+	for i := 0; i < len(f.lines); {
+		j := i + 1
+		if f.align && f.lines[i].alignable {
+			for j < len(f.lines) && f.lines[j].alignable && f.lines[j].indent == f.lines[i].indent {
+				j++
+			}
+		}
+		renderLines(&b, f.lines[i:j])
+		i = j
+	}
+	return b.Bytes()
+}
+
+// renderLines writes lines with their cells and trailing comments padded to
+// the same widths.
+func renderLines(b *bytes.Buffer, lines []*formatLine) {
+	var widths []int
+	for _, l := range lines {
+		if len(l.cells) == 0 {
+			continue
+		}
+		for i, c := range l.cells[:len(l.cells)-1] {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(c))
+		}
+	}
+
+	texts := make([]string, len(lines))
+	commentAt := 0
+	for i, l := range lines {
+		var text strings.Builder
+		for j, c := range l.cells {
+			text.WriteString(c)
+			if j < len(l.cells)-1 {
+				text.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(c)+1))
+			}
+		}
+		texts[i] = text.String()
+		commentAt = max(commentAt, utf8.RuneCountInString(texts[i]))
+	}
+
+	for i, l := range lines {
+		if len(l.cells) > 0 {
+			b.WriteString(strings.Repeat(formatIndent, l.indent))
+			b.WriteString(texts[i])
+		}
+		if l.comment != "" {
+			pad := 1
+			if len(lines) > 1 {
+				pad += commentAt - utf8.RuneCountInString(texts[i])
+			}
+			b.WriteString(strings.Repeat(" ", pad) + l.comment)
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// importStatement is an import as written in a schema, along with comments
+// and annotations placed right before and after it.
+type importStatement struct {
+	importSpec
+	leading  []string
+	trailing string
+}
+
+// formatImports writes the import statements starting at tokens[i], sorted
+// and normalized, returning the index of the first token following them.
+// Comments and annotations placed between imports travel with the import
+// that follows them.
+func (f *formatter) formatImports(i int) int {
+	f.sawImports = true
+	first := &f.tokens[i]
+
+	var statements []*importStatement
+	var comments []string
+	end, last := i, first
+	for i < len(f.tokens) {
+		t := &f.tokens[i]
+		if t.Type == tokenTypeComment {
+			comments = append(comments, f.commentText(t))
+			i++
+			continue
+		}
+		if t.Type == tokenTypeAtSign && f.annotatesImport(i) {
+			next := f.annotationEnd(i)
+			comments = append(comments, f.annotationText(i, next))
+			i = next
+			continue
+		}
+		if t.Type != tokenTypeIdentifier || t.Value != "import" {
+			break
+		}
+
+		stmt := &importStatement{leading: comments}
+		comments = nil
+		i++
+		if t := f.tokens[i]; t.Type == tokenTypeIdentifier && t.Value == "public" &&
+			(f.tokens[i+1].Type == tokenTypeString || f.tokens[i+1].Type == tokenTypeIdentifier) {
+			stmt.Public = true
+			i++
+		}
+		stmt.Value = f.tokens[i].Value
+		stmt.Package = f.tokens[i].Type == tokenTypeIdentifier
+		i++
+		for stmt.Package && f.tokens[i].Type == tokenTypePeriod {
+			stmt.Value += "." + f.tokens[i+1].Value
+			i += 2
+		}
+		if f.tokens[i].Type == tokenTypeIdentifier {
+			stmt.Alias = f.tokens[i+1].Value
+			i += 2
+		}
+		last = &f.tokens[i]
+		i++
+		if next := f.tokens[i]; next.Type == tokenTypeComment && next.Line == last.Line {
+			stmt.trailing = f.commentText(&next)
+			last = &f.tokens[i]
+			i++
+		}
+		statements = append(statements, stmt)
+		end = i
+	}
+
+	specs := make([]importSpec, len(statements))
+	for idx, stmt := range statements {
+		specs[idx] = stmt.importSpec
+	}
+	specs = f.imports.normalizeValues(f.from, specs)
+	for idx, stmt := range statements {
+		stmt.importSpec = specs[idx]
+	}
+	statements = sortImports(statements)
+
+	if f.line != nil {
+		f.endLine()
+	}
+	for idx, stmt := range statements {
+		for j, c := range stmt.leading {
+			if idx == 0 && j == 0 {
+				f.startLine(first)
+			} else {
+				f.line = &formatLine{}
+			}
+			f.line.cells = []string{c}
+			f.endLine()
+		}
+		if idx == 0 && len(stmt.leading) == 0 {
+			f.startLine(first)
+		} else {
+			f.line = &formatLine{}
+		}
+		f.line.cells = []string{stmt.String()}
+		f.line.comment = stmt.trailing
+		f.endLine()
+	}
+	f.prev = last
+	return end
+}
+
+// annotatesImport indicates whether the annotation starting at tokens[i],
+// along with the ones following it, precedes an import. Annotations holding
+// comments are left as written.
+func (f *formatter) annotatesImport(i int) bool {
+	for i < len(f.tokens) && f.tokens[i].Type == tokenTypeAtSign {
+		end := f.annotationEnd(i)
+		for _, t := range f.tokens[i:end] {
+			if t.Type == tokenTypeComment {
+				return false
+			}
+		}
+		i = end
+		for i < len(f.tokens) && f.tokens[i].Type == tokenTypeComment {
+			i++
+		}
+	}
+	return i < len(f.tokens) && f.tokens[i].Type == tokenTypeIdentifier && f.tokens[i].Value == "import"
+}
+
+// annotationEnd returns the index of the first token following the
+// annotation starting at tokens[i].
+func (f *formatter) annotationEnd(i int) int {
+	i += 2 // @ and name
+	for i+1 < len(f.tokens) && f.tokens[i].Type == tokenTypePeriod {
+		i += 2
+	}
+	if i >= len(f.tokens) || f.tokens[i].Type != tokenTypeLeftParen {
+		return min(i, len(f.tokens))
+	}
+	for depth := 0; i < len(f.tokens); i++ {
+		switch f.tokens[i].Type {
+		case tokenTypeLeftParen:
+			depth++
+		case tokenTypeRightParen:
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// annotationText returns the annotation spanning tokens[i:end] written on a
+// single line.
+func (f *formatter) annotationText(i, end int) string {
+	defer func(unary bool) { f.unary = unary }(f.unary)
+	var b strings.Builder
+	var prev *token
+	for ; i < end; i++ {
+		t := &f.tokens[i]
+		if prev != nil && f.spaced(prev, t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.text(t))
+		f.unary = t.Type == tokenTypeMinus && prev != nil && !isOperand(prev)
+		prev = t
+	}
+	return b.String()
+}
+
+// sortImports sorts statements by path and alias, dropping duplicates. The
+// comments of duplicates are kept on the remaining statement.
+func sortImports(statements []*importStatement) []*importStatement {
+	sort.SliceStable(statements, func(i, j int) bool {
+		return statements[i].importSpec.less(statements[j].importSpec)
+	})
+	var res []*importStatement
+	for _, stmt := range statements {
+		if n := len(res); n > 0 && res[n-1].importSpec == stmt.importSpec {
+			prev := res[n-1]
+			prev.leading = append(prev.leading, stmt.leading...)
+			if prev.trailing == "" {
+				prev.trailing = stmt.trailing
+			}
+			continue
+		}
+		res = append(res, stmt)
+	}
+	return res
+}
+
+// importSpec identifies an import by its path, or package name, and
+// explicit alias.
+type importSpec struct {
+	Value string
+	Alias string
+	// Package indicates Value is a package name rather than a path.
+	Package bool
+	Public  bool
+}
+
+// less sorts imports by path, followed by packages imported by name.
+func (s importSpec) less(other importSpec) bool {
+	if s.Package != other.Package {
+		return other.Package
+	}
+	if s.Value != other.Value {
+		return s.Value < other.Value
+	}
+	return s.Alias < other.Alias
+}
+
+func (s importSpec) String() string {
+	value := s.Value
+	if !s.Package {
+		value = `"` + value + `"`
+	}
+	if s.Public {
+		value = "public " + value
+	}
+	if s.Alias != "" {
+		return "import " + value + " as " + s.Alias + ";"
+	}
+	return "import " + value + ";"
+}
+
+// importNormalizer rewrites import paths the way Format writes them.
+type importNormalizer struct {
+	resolver   Resolver
+	manifest   *Manifest
+	extensions []string
+	root       string
+}
+
+// normalize returns specs with their paths normalized, sorted and without
+// duplicates.
+func (n *importNormalizer) normalize(from string, specs []importSpec) []importSpec {
+	specs = n.normalizeValues(from, specs)
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].less(specs[j]) })
+	var res []importSpec
+	for _, s := range specs {
+		if len(res) > 0 && res[len(res)-1] == s {
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func (n *importNormalizer) normalizeValues(from string, specs []importSpec) []importSpec {
+	res := make([]importSpec, len(specs))
+	for i, s := range specs {
+		res[i] = s
+		if !s.Package {
+			res[i].Value = n.normalizeValue(from, s.Value)
+		}
+	}
+	return res
+}
+
+// normalizeValue cleans value, spells its extension as configured, adds it
+// when missing, and rewrites it relative to the schema root if one is set.
+// Remote imports are left untouched, and patterns are only cleaned.
+func (n *importNormalizer) normalizeValue(from, value string) string {
+	if isRemoteLocation(value) {
+		return value
+	}
+	if isGlob(value) {
+		return path.Clean(value)
+	}
+	exts := n.extensions
+	if len(exts) == 0 {
+		exts = DefaultExtensions
+	}
+
+	value = path.Clean(value)
+	location, err := n.resolver.Resolve(from, value)
+	if ext := matchingExtension(value, exts); ext != "" {
+		value = value[:len(value)-len(ext)] + ext
+	} else if err == nil {
+		value += filepath.Ext(location)
+	}
+
+	if _, dependency, _ := n.manifest.resolveDependency(value); dependency || n.root == "" || err != nil {
+		return value
+	}
+	root, err := filepath.Abs(n.root)
+	if err != nil {
+		return value
+	}
+	if rel, err := filepath.Rel(root, location); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		value = filepath.ToSlash(rel)
+	}
+	return value
+}
+
+// rewriteOptionals rewrites the optional types of f.tokens to style. Closing
+// angles lexed as a shift are split first, so each one closes a single type.
+func (f *formatter) rewriteOptionals(style OptionalStyle) {
+	tokens := splitClosingAngles(f.tokens)
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case style == OptionalShorthand && t.Type == tokenTypeIdentifier && t.Value == "optional" &&
+			i+1 < len(tokens) && tokens[i+1].Type == tokenTypeLeftAngled:
+			end := matchingToken(tokens, i+1, 1)
+			if end == -1 {
+				continue
+			}
+			q := f.synthesize(tokenTypeQuestion, "?", &tokens[end])
+			tokens = slices.Concat(tokens[:i], tokens[i+2:end], []token{q}, tokens[end+1:])
+			i--
+		case style == OptionalGeneric && t.Type == tokenTypeQuestion && i > 0:
+			start := typeStart(tokens, i-1)
+			if start == -1 {
+				continue
+			}
+			open := []token{f.synthesize(tokenTypeIdentifier, "optional", &tokens[start]), f.synthesize(tokenTypeLeftAngled, "<", &tokens[start])}
+			closing := f.synthesize(tokenTypeRightAngled, ">", &t)
+			tokens = slices.Concat(tokens[:start], open, tokens[start:i], []token{closing}, tokens[i+1:])
+		}
+	}
+	f.tokens = tokens
+}
+
+// synthesize returns a token of type tt holding text, placed at the same
+// line and column as at. Its text is appended to f.src, where text reads
+// it from.
+func (f *formatter) synthesize(tt tokenType, text string, at *token) token {
+	pos := len(f.src)
+	f.src = append(f.src, []rune(text)...)
+	return token{Type: tt, Value: text, Pos: pos, End: len(f.src), Line: at.Line, Column: at.Column}
+}
+
+// splitClosingAngles returns tokens with shifts closing nested types, as in
+// array<array<int32>>, split into two closing angles.
+func splitClosingAngles(tokens []token) []token {
+	res := make([]token, 0, len(tokens))
+	depth := 0
+	for _, t := range tokens {
+		switch {
+		case t.Type == tokenTypeLeftAngled:
+			depth++
+		case t.Type == tokenTypeRightAngled:
+			depth--
+		case t.Type == tokenTypeShiftRight && depth > 0:
+			first := t
+			first.Type, first.Value, first.End = tokenTypeRightAngled, ">", t.Pos+1
+			second := first
+			second.Pos, second.End, second.Column = first.Pos+1, first.End+1, first.Column+1
+			res = append(res, first, second)
+			depth -= 2
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// matchingToken returns the index of the token closing the angle or curly
+// brace at tokens[i], searching forward when dir is 1 and backward when it
+// is -1, or -1 when there is none.
+func matchingToken(tokens []token, i, dir int) int {
+	open, closing := tokenTypeLeftAngled, tokenTypeRightAngled
+	if tokens[i].Type == tokenTypeLeftCurly || tokens[i].Type == tokenTypeRightCurly {
+		open, closing = tokenTypeLeftCurly, tokenTypeRightCurly
+	}
+	if dir < 0 {
+		open, closing = closing, open
+	}
+	depth := 0
+	for ; i >= 0 && i < len(tokens); i += dir {
+		switch tokens[i].Type {
+		case open:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// typeStart returns the index of the first token of the type ending at
+// tokens[end], or -1 when it cannot be found.
+func typeStart(tokens []token, end int) int {
+	i := end
+	switch tokens[i].Type {
+	case tokenTypeQuestion:
+		return typeStart(tokens, i-1)
+	case tokenTypeRightAngled, tokenTypeRightCurly:
+		// Generic types and inline structs start with their name, or the
+		// struct keyword.
+		if i = matchingToken(tokens, i, -1) - 1; i < 0 {
+			return -1
+		}
+	}
+	if tokens[i].Type != tokenTypeIdentifier {
+		return -1
+	}
+	for i >= 2 && tokens[i-1].Type == tokenTypePeriod && tokens[i-2].Type == tokenTypeIdentifier {
+		i -= 2
+	}
+	return i
+}
@@ -0,0 +1,250 @@
+package idl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	src := `package   v1beta1.demo.fmt;
+import "utility";   # helpers
+# shared types
+import "common" as common;
+import "./utility.arf";
+
+
+# Everything
+@foo("a")
+struct Everything{
+    a_bool bool;# trailing
+    a_map map<string,array<int64>>;
+    a_test common.Test;
+    struct Nested { id uint32; }
+}
+enum Mode { FIRST = 1; FOURTH=0x04; }
+service Features {
+    Bidi(stream Everything.Nested) -> stream Everything.Nested;
+    Mixed(i Everything,
+        stream Everything.Nested);
+}
+`
+	out, err := Format("fixtures/formatted.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, `package v1beta1.demo.fmt;
+# shared types
+import "common.arf" as common;
+import "utility.arf"; # helpers
+
+# Everything
+@foo("a")
+struct Everything {
+    a_bool bool; # trailing
+    a_map map<string, array<int64>>;
+    a_test common.Test;
+    struct Nested {
+        id uint32;
+    }
+}
+enum Mode {
+    FIRST = 1;
+    FOURTH = 0x04;
+}
+service Features {
+    Bidi(stream Everything.Nested) -> stream Everything.Nested;
+    Mixed(i Everything,
+        stream Everything.Nested);
+}
+`, string(out))
+
+	again, err := Format("fixtures/formatted.arf", out, FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, string(out), string(again))
+
+	_, err = Format("fixtures/broken.arf", []byte("package broken;\nstruct {}\n"), FormatOptions{})
+	require.Error(t, err)
+}
+
+func TestFormatSchemaRoot(t *testing.T) {
+	src := "package v1beta1.other.user;\n\nimport \"../../common.arf\";\n"
+	out, err := Format("fixtures/format/nested/user.arf", []byte(src), FormatOptions{SchemaRoot: "fixtures"})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.other.user;\n\nimport \"common.arf\";\n", string(out))
+
+	// Root-relative imports are only resolved when a schema root is configured
+	_, err = Parse("fixtures/format/nested/user.arf")
+	require.Error(t, err)
+	_, err = Parse("fixtures/format/nested/user.arf", WithSchemaRoot("fixtures"))
+	require.NoError(t, err)
+}
+
+func TestImportFormatWarning(t *testing.T) {
+	fe, err := New("fixtures/full.arf")
+	require.NoError(t, err)
+	_, err = fe.Run()
+	require.NoError(t, err)
+	var codes []string
+	for _, w := range fe.Warnings() {
+		codes = append(codes, w.Code)
+	}
+	require.Contains(t, codes, CodeImportFormat)
+
+	fe, err = New("fixtures/format/nested/user.arf", WithSchemaRoot("fixtures"))
+	require.NoError(t, err)
+	_, err = fe.Run()
+	require.NoError(t, err)
+	require.Empty(t, fe.Warnings())
+}
+
+func TestFormatAlignColumns(t *testing.T) {
+	src := `package v1beta1.demo.align;
+
+struct User {
+    # Identity
+    id uint64;
+    display_name string; # shown in listings
+    tags array<string>; # free-form
+
+    @wire_name("mail")
+    email optional<string>;
+    x string;
+}
+
+enum Role {
+    GUEST = 0; # default
+    ADMINISTRATOR = 0x10;
+}
+`
+	out, err := Format("fixtures/aligned.arf", []byte(src), FormatOptions{AlignColumns: true})
+	require.NoError(t, err)
+	require.Equal(t, `package v1beta1.demo.align;
+
+struct User {
+    # Identity
+    id           uint64;
+    display_name string;        # shown in listings
+    tags         array<string>; # free-form
+
+    @wire_name("mail")
+    email optional<string>;
+    x     string;
+}
+
+enum Role {
+    GUEST         = 0;    # default
+    ADMINISTRATOR = 0x10;
+}
+`, string(out))
+
+	out, err = Format("fixtures/aligned.arf", out, FormatOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "    display_name string; # shown in listings\n")
+}
+
+func TestFormatConstantExpressions(t *testing.T) {
+	src := "package v1beta1.demo.expr;\n\nenum Flag {\n    A = 1<<0;\n    B = -(-2)  ;\n    C = (A|B)&~0x0;\n    m_unused = 0;\n}\n\nstruct S {\n    m map<string,array<array<int32>>>;\n}\n"
+	out, err := Format("fixtures/expr.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.expr;\n\nenum Flag {\n    A = 1 << 0;\n    B = -(-2);\n    C = (A | B) & ~0x0;\n    m_unused = 0;\n}\n\nstruct S {\n    m map<string, array<array<int32>>>;\n}\n", string(out))
+}
+
+func TestFormatInlineStructs(t *testing.T) {
+	src := "package v1beta1.demo.inline;\n\nstruct User {\n    address struct { street string; }\n    tags array<struct { key string; }>;\n}\n\nservice Users {\n    Get(u User) -> struct { user User; };\n}\n"
+	out, err := Format("fixtures/inline.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.inline;\n\nstruct User {\n    address struct {\n        street string;\n    }\n    tags array<struct {\n        key string;\n    }>;\n}\n\nservice Users {\n    Get(u User) -> struct {\n        user User;\n    };\n}\n", string(out))
+
+	// Indices follow the closing brace
+	src = "package v1beta1.demo.inline;\n\nstruct User {\n    id int64 = 1;\n    address struct { street string = 1; } = 4;\n}\n"
+	out, err = Format("fixtures/inline.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.inline;\n\nstruct User {\n    id int64 = 1;\n    address struct {\n        street string = 1;\n    } = 4;\n}\n", string(out))
+}
+
+func TestFormatUnions(t *testing.T) {
+	src := "package v1beta1.demo.union;\n\nstruct User {\n  union contact {   email string;\n phone_number string; }\n}\n"
+	out, err := Format("fixtures/union.arf", []byte(src), FormatOptions{AlignColumns: true})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.union;\n\nstruct User {\n    union contact {\n        email        string;\n        phone_number string;\n    }\n}\n", string(out))
+}
+
+func TestFormatReserved(t *testing.T) {
+	src := "package v1beta1.demo.reserved;\n\nstruct User {\n  reserved   4,5;\n  name string;\n  email_address string;\n}\n\nenum Status {\n  reserved -1;\n  ACTIVE = 1;\n}\n"
+	out, err := Format("fixtures/reserved.arf", []byte(src), FormatOptions{AlignColumns: true})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.reserved;\n\nstruct User {\n    reserved 4, 5;\n    name          string;\n    email_address string;\n}\n\nenum Status {\n    reserved -1;\n    ACTIVE = 1;\n}\n", string(out))
+}
+
+func TestFormatFlagEnums(t *testing.T) {
+	src := "package v1beta1.demo.flags;\n\nenum   flags Permissions {\n  READ = 1;\n  WRITE = 2;\n  READ_WRITE = READ|WRITE;\n}\n"
+	out, err := Format("fixtures/flags.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.flags;\n\nenum flags Permissions {\n    READ = 1;\n    WRITE = 2;\n    READ_WRITE = READ | WRITE;\n}\n", string(out))
+}
+
+func TestFormatThrows(t *testing.T) {
+	src := "package v1beta1.demo.throws;\n\nservice Users {\n  Get(r GetRequest)->User throws(NotFound,RateLimited);\n  Delete(r GetRequest)   throws   NotFound;\n}\n"
+	out, err := Format("fixtures/throws.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.throws;\n\nservice Users {\n    Get(r GetRequest) -> User throws (NotFound, RateLimited);\n    Delete(r GetRequest) throws NotFound;\n}\n", string(out))
+}
+
+func TestFormatImportAnnotations(t *testing.T) {
+	src := "# Options\n@go_package( \"pkg/demo\" )\npackage v1beta1.demo.annotated;\n\n@weak\nimport \"zeta.arf\";\n# Shared types\n@go_alias(\"c\",  level = -1)\nimport \"common.arf\";\n\n@go_name(\"Thing\")\nstruct Foo {\n  id int64;\n}\n"
+	out, err := Format("fixtures/annotated.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "# Options\n@go_package(\"pkg/demo\")\npackage v1beta1.demo.annotated;\n\n# Shared types\n@go_alias(\"c\", level = -1)\nimport \"common.arf\";\n@weak\nimport \"zeta.arf\";\n\n@go_name(\"Thing\")\nstruct Foo {\n    id int64;\n}\n", string(out))
+}
+
+func TestFormatPackageImports(t *testing.T) {
+	src := "package v1beta1.demo.packages;\n\nimport org.example.common as c;\nimport  org . example . auth;\nimport \"common.arf\";\n\nstruct Foo {\n  id int64;\n}\n"
+	out, err := Format("fixtures/packages.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.packages;\n\nimport \"common.arf\";\nimport org.example.auth;\nimport org.example.common as c;\n\nstruct Foo {\n    id int64;\n}\n", string(out))
+}
+
+func TestFormatGlobImports(t *testing.T) {
+	src := "package shop;\n\nimport \"./common/*\";\nimport \"common/money\";\n"
+	out, err := Format("fixtures/glob/main.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package shop;\n\nimport \"common/*\";\nimport \"common/money.arf\";\n", string(out))
+}
+
+func TestFormatPublicImports(t *testing.T) {
+	src := "package api;\n\nimport public  \"base\";\nimport \"internal.arf\";\nimport public org.example.common;\n"
+	out, err := Format("fixtures/public/api.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package api;\n\nimport public \"base.arf\";\nimport \"internal.arf\";\nimport public org.example.common;\n", string(out))
+}
+
+func TestFormatImplicitEnumValues(t *testing.T) {
+	src := "package states;\n\nenum State {\n  UNKNOWN = 0; # unset\n  ACTIVE ;\n  SUSPENDED; # paused\n}\n"
+	out, err := Format("fixtures/states.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package states;\n\nenum State {\n    UNKNOWN = 0; # unset\n    ACTIVE;\n    SUSPENDED; # paused\n}\n", string(out))
+
+	out, err = Format("fixtures/states.arf", []byte(src), FormatOptions{AlignColumns: true})
+	require.NoError(t, err)
+	require.Equal(t, "package states;\n\nenum State {\n    UNKNOWN = 0; # unset\n    ACTIVE;\n    SUSPENDED;   # paused\n}\n", string(out))
+}
+
+func TestFormatOptionals(t *testing.T) {
+	generic := "package v1beta1.demo.optional;\n\nstruct User {\n    name      optional<string>;\n    tags      optional<array<optional<string>>>;\n    contact   optional<common.Contact>;\n    addresses map<string, optional<struct {\n        city string;\n    }>>;\n}\n"
+	shorthand := "package v1beta1.demo.optional;\n\nstruct User {\n    name      string?;\n    tags      array<string?>?;\n    contact   common.Contact?;\n    addresses map<string, struct {\n        city string;\n    }?>;\n}\n"
+	out, err := Format("fixtures/optional.arf", []byte(generic), FormatOptions{AlignColumns: true, Optionals: OptionalShorthand})
+	require.NoError(t, err)
+	require.Equal(t, shorthand, string(out))
+	out, err = Format("fixtures/optional.arf", []byte(shorthand), FormatOptions{AlignColumns: true, Optionals: OptionalGeneric})
+	require.NoError(t, err)
+	require.Equal(t, generic, string(out))
+	out, err = Format("fixtures/optional.arf", []byte(shorthand), FormatOptions{AlignColumns: true})
+	require.NoError(t, err)
+	require.Equal(t, shorthand, string(out))
+}
+
+func TestFormatBlockComments(t *testing.T) {
+	src := "package v1beta1.demo.comments;\n\n/* A user,\n   described */\nstruct User {\n  name /* inline */   string;   /* trailing */\n\n\n  /* leading */ \n  email string;\n}\n"
+	out, err := Format("fixtures/comments.arf", []byte(src), FormatOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "package v1beta1.demo.comments;\n\n/* A user,\n   described */\nstruct User {\n    name /* inline */ string; /* trailing */\n\n    /* leading */\n    email string;\n}\n", string(out))
+}
@@ -0,0 +1,242 @@
+// Package gen writes the files produced by generators, such as the ones
+// returned by capnp.Export, to an output directory.
+//
+// Every write records a Manifest in the output directory, listing the path,
+// size and digest of each generated file. The manifest of the previous run
+// lets later runs tell generated files from handwritten ones: files about to
+// be overwritten or removed which were not generated, or were modified since,
+// are reported as conflicts and left untouched. Files generated by the
+// previous run but no longer produced are removed as stale.
+//
+// Runs may be planned without touching the output directory through
+// ModeDryRun, and every generated file may be removed through ModeClean.
+//
+// Generators may also live outside this repository as plugins: executables
+// named after PluginPrefix which read a PluginRequest, describing the
+// compiled schema, from their standard input and write a PluginResponse,
+// listing the files they generated, to their standard output. See RunPlugin
+// and ServePlugin.
+//
+// Generators writing code through a Writer may also emit a SourceMap of each
+// file, mapping its lines back to the declarations they were generated from.
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestFilename is the name of the manifest stored in output
+// directories.
+const ManifestFilename = ".arf-gen.json"
+
+// ErrConflict is returned when applying files would overwrite or remove
+// files that were not generated, or were modified since.
+var ErrConflict = errors.New("generated files conflict with existing ones")
+
+// Manifest lists the files written by a generator, sorted by path.
+type Manifest struct {
+	Files []Entry `json:"files"`
+}
+
+// Entry describes a generated file. Path is relative to the output
+// directory, and always uses forward slashes.
+type Entry struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewManifest returns the manifest of files, keyed by their path.
+func NewManifest(files map[string][]byte) *Manifest {
+	m := &Manifest{Files: []Entry{}}
+	for path, data := range files {
+		m.Files = append(m.Files, Entry{Path: filepath.ToSlash(path), Size: len(data), SHA256: digest(data)})
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m
+}
+
+// ReadManifest reads the manifest stored in dir. A missing manifest results
+// in an empty one.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFilename))
+	if os.IsNotExist(err) {
+		return &Manifest{Files: []Entry{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestFilename, err)
+	}
+	return m, nil
+}
+
+// Lookup returns the entry of path.
+func (m *Manifest) Lookup(path string) (Entry, bool) {
+	path = filepath.ToSlash(path)
+	for _, e := range m.Files {
+		if e.Path == path {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Mode selects what Apply does.
+type Mode int
+
+const (
+	// ModeWrite writes generated files and removes stale ones.
+	ModeWrite Mode = iota
+	// ModeDryRun reports what ModeWrite would do, without touching any file.
+	ModeDryRun
+	// ModeClean removes every file listed by the manifest of the output
+	// directory, along with the manifest itself.
+	ModeClean
+)
+
+// Report describes the changes made, or planned, by Apply. Each list holds
+// paths relative to the output directory, sorted.
+type Report struct {
+	Created   []string
+	Updated   []string
+	Unchanged []string
+	Removed   []string
+
+	// Conflicts lists files which would have been overwritten or removed
+	// although they were not generated, or were modified since.
+	Conflicts []string
+}
+
+// Stale reports whether applying the files changes the output directory.
+func (r *Report) Stale() bool {
+	return len(r.Created)+len(r.Updated)+len(r.Removed)+len(r.Conflicts) > 0
+}
+
+// Apply brings dir in line with files, the output of a generator keyed by
+// paths relative to dir, as described by mode. Files are only written when
+// no conflicts are found; otherwise the report lists them and ErrConflict is
+// returned. ModeClean ignores files.
+func Apply(dir string, files map[string][]byte, mode Mode) (*Report, error) {
+	previous, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if mode == ModeClean {
+		files = nil
+	}
+
+	report := &Report{}
+	for path, data := range files {
+		if err := checkPath(path); err != nil {
+			return nil, err
+		}
+		current, err := os.ReadFile(filepath.Join(dir, path))
+		switch {
+		case os.IsNotExist(err):
+			report.Created = append(report.Created, path)
+		case err != nil:
+			return nil, err
+		case bytes.Equal(current, data):
+			report.Unchanged = append(report.Unchanged, path)
+		case generated(previous, path, current):
+			report.Updated = append(report.Updated, path)
+		default:
+			report.Conflicts = append(report.Conflicts, path)
+		}
+	}
+	for _, e := range previous.Files {
+		path := filepath.FromSlash(e.Path)
+		if _, ok := files[path]; ok {
+			continue
+		}
+		if _, ok := files[e.Path]; ok {
+			continue
+		}
+		current, err := os.ReadFile(filepath.Join(dir, path))
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		case generated(previous, path, current):
+			report.Removed = append(report.Removed, path)
+		default:
+			report.Conflicts = append(report.Conflicts, path)
+		}
+	}
+	for _, list := range [][]string{report.Created, report.Updated, report.Unchanged, report.Removed, report.Conflicts} {
+		sort.Strings(list)
+	}
+
+	if len(report.Conflicts) > 0 {
+		return report, ErrConflict
+	}
+	if mode == ModeDryRun {
+		return report, nil
+	}
+
+	for _, path := range append(report.Created, report.Updated...) {
+		target := filepath.Join(dir, path)
+		if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return report, err
+		}
+		if err = os.WriteFile(target, files[path], 0o644); err != nil {
+			return report, err
+		}
+	}
+	for _, path := range report.Removed {
+		if err = os.Remove(filepath.Join(dir, path)); err != nil {
+			return report, err
+		}
+	}
+
+	manifestPath := filepath.Join(dir, ManifestFilename)
+	if mode == ModeClean {
+		if err = os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+		return report, nil
+	}
+	data, err := json.MarshalIndent(NewManifest(files), "", "  ")
+	if err != nil {
+		return report, err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return report, err
+	}
+	return report, os.WriteFile(manifestPath, append(data, '\n'), 0o644)
+}
+
+// generated indicates whether current, the contents of path, were written by
+// the run described by m.
+func generated(m *Manifest, path string, current []byte) bool {
+	e, ok := m.Lookup(path)
+	return ok && e.Size == len(current) && e.SHA256 == digest(current)
+}
+
+// checkPath ensures path remains within the output directory.
+func checkPath(path string) error {
+	clean := filepath.Clean(path)
+	if path == "" || filepath.IsAbs(path) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("generated file %q must be relative to the output directory", path)
+	}
+	if clean == ManifestFilename {
+		return fmt.Errorf("generated file %q clashes with the manifest", path)
+	}
+	return nil
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"org/users.capnp":  []byte("users"),
+		"org/orders.capnp": []byte("orders"),
+	}
+
+	report, err := Apply(dir, files, ModeDryRun)
+	require.NoError(t, err)
+	require.Equal(t, []string{"org/orders.capnp", "org/users.capnp"}, report.Created)
+	require.NoDirExists(t, filepath.Join(dir, "org"))
+
+	report, err = Apply(dir, files, ModeWrite)
+	require.NoError(t, err)
+	require.True(t, report.Stale())
+	require.FileExists(t, filepath.Join(dir, "org", "users.capnp"))
+
+	m, err := ReadManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, NewManifest(files), m)
+	e, ok := m.Lookup("org/users.capnp")
+	require.True(t, ok)
+	require.Equal(t, 5, e.Size)
+
+	report, err = Apply(dir, files, ModeDryRun)
+	require.NoError(t, err)
+	require.False(t, report.Stale())
+	require.Len(t, report.Unchanged, 2)
+
+	// Outputs no longer generated are removed, and others updated.
+	report, err = Apply(dir, map[string][]byte{"org/users.capnp": []byte("users v2")}, ModeWrite)
+	require.NoError(t, err)
+	require.Equal(t, &Report{Updated: []string{"org/users.capnp"}, Removed: []string{"org/orders.capnp"}}, report)
+	require.NoFileExists(t, filepath.Join(dir, "org", "orders.capnp"))
+
+	// Handwritten and modified files are never clobbered.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "org", "users.capnp"), []byte("edited"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "org", "notes.capnp"), []byte("notes"), 0o644))
+	report, err = Apply(dir, map[string][]byte{"org/users.capnp": []byte("users v3"), "org/notes.capnp": []byte("generated")}, ModeWrite)
+	require.ErrorIs(t, err, ErrConflict)
+	require.Equal(t, []string{"org/notes.capnp", "org/users.capnp"}, report.Conflicts)
+	data, err := os.ReadFile(filepath.Join(dir, "org", "users.capnp"))
+	require.NoError(t, err)
+	require.Equal(t, "edited", string(data))
+
+	_, err = Apply(dir, map[string][]byte{"../escape.capnp": nil}, ModeWrite)
+	require.Error(t, err)
+}
+
+func TestClean(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Apply(dir, map[string][]byte{"a.fbs": []byte("a"), "b.fbs": []byte("b")}, ModeWrite)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "handwritten.fbs"), []byte("mine"), 0o644))
+
+	report, err := Apply(dir, nil, ModeClean)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.fbs", "b.fbs"}, report.Removed)
+	require.NoFileExists(t, filepath.Join(dir, "a.fbs"))
+	require.NoFileExists(t, filepath.Join(dir, ManifestFilename))
+	require.FileExists(t, filepath.Join(dir, "handwritten.fbs"))
+}
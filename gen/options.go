@@ -0,0 +1,167 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Options holds the options passed to the generator of a target language,
+// such as go. Options are gathered from three sources, listed by increasing
+// precedence:
+//
+//  1. option directives of the manifest, such as option go module=acme.com/x;
+//  2. annotations namespaced by the target, such as @go.package("users"),
+//     declared on the element being generated or on an enclosing one, the
+//     innermost annotation winning;
+//  3. command-line flags named after the target, such as
+//     --go_opt=module=acme.com/x,paths=source_relative.
+//
+// Flags thus override whatever schemas declare, while annotations refine the
+// defaults of the manifest for specific declarations.
+type Options struct {
+	// Target names the generator, such as go.
+	Target string
+
+	flags    map[string]string
+	manifest map[string]string
+}
+
+// NewOptions returns the options of target, gathered from manifest, which
+// may be nil, and flags, the values of the --<target>_opt flags.
+func NewOptions(target string, manifest *idl.Manifest, flags []string) (*Options, error) {
+	o := &Options{Target: target, flags: map[string]string{}, manifest: map[string]string{}}
+	if manifest != nil {
+		for name, value := range manifest.Options[target] {
+			o.manifest[name] = value
+		}
+	}
+	for _, flag := range flags {
+		if err := parseOptionList(flag, o.flags); err != nil {
+			return nil, fmt.Errorf("--%s_opt: %w", target, err)
+		}
+	}
+	return o, nil
+}
+
+// ParseFlag splits a command-line argument such as --go_opt=module=acme.com/x
+// into the target it configures and its value. It returns false for
+// arguments that are not generator options.
+func ParseFlag(arg string) (target, value string, ok bool) {
+	name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	if !ok || !strings.HasPrefix(arg, "-") {
+		return "", "", false
+	}
+	target, ok = strings.CutSuffix(name, "_opt")
+	if !ok || target == "" {
+		return "", "", false
+	}
+	return target, value, true
+}
+
+// parseOptionList parses comma-separated options, such as a=1,b, into res.
+// Options without a value are set to true.
+func parseOptionList(list string, res map[string]string) error {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if name == "" {
+			return fmt.Errorf("invalid option %q", item)
+		}
+		if !ok {
+			value = "true"
+		}
+		res[name] = value
+	}
+	return nil
+}
+
+// Get returns the value of the option named name, ignoring annotations.
+func (o *Options) Get(name string) (string, bool) {
+	if v, ok := o.flags[name]; ok {
+		return v, true
+	}
+	v, ok := o.manifest[name]
+	return v, ok
+}
+
+// For returns the value of the option named name for obj, taking annotations
+// declared on obj and its enclosing declarations into account.
+func (o *Options) For(obj ast.Object, name string) (string, bool) {
+	if v, ok := o.flags[name]; ok {
+		return v, true
+	}
+	for ; obj != nil; obj = enclosing(obj) {
+		if a := annotationsOf(obj).ByName(o.Target + "." + name); a != nil {
+			if len(a.Arguments) == 0 {
+				return "true", true
+			}
+			return fmt.Sprint(a.Arguments[0]), true
+		}
+	}
+	v, ok := o.manifest[name]
+	return v, ok
+}
+
+// Parameters returns the options which do not depend on declarations, as
+// passed to plugins through PluginRequest.
+func (o *Options) Parameters() map[string]string {
+	res := make(map[string]string, len(o.manifest)+len(o.flags))
+	for name, value := range o.manifest {
+		res[name] = value
+	}
+	for name, value := range o.flags {
+		res[name] = value
+	}
+	return res
+}
+
+func annotationsOf(obj ast.Object) ast.AnnotationSet {
+	switch o := obj.(type) {
+	case *ast.Struct:
+		return o.Annotations
+	case *ast.StructField:
+		return o.Annotations
+	case *ast.Enum:
+		return o.Annotations
+	case *ast.EnumMember:
+		return o.Annotations
+	case *ast.Service:
+		return o.Annotations
+	case *ast.ServiceMethod:
+		return o.Annotations
+	}
+	return nil
+}
+
+// enclosing returns the declaration obj is declared in, or nil.
+func enclosing(obj ast.Object) ast.Object {
+	switch o := obj.(type) {
+	case *ast.Struct:
+		if o.Parent != nil {
+			return o.Parent
+		}
+	case *ast.StructField:
+		if o.Parent != nil {
+			return o.Parent
+		}
+	case *ast.Enum:
+		if o.Parent != nil {
+			return o.Parent
+		}
+	case *ast.EnumMember:
+		if o.Enum != nil {
+			return o.Enum
+		}
+	case *ast.ServiceMethod:
+		if o.Service != nil {
+			return o.Service
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFlag(t *testing.T) {
+	target, value, ok := ParseFlag("--go_opt=module=acme.com/x,paths=source_relative")
+	require.True(t, ok)
+	require.Equal(t, "go", target)
+	require.Equal(t, "module=acme.com/x,paths=source_relative", value)
+
+	for _, arg := range []string{"--go_out=gen", "go_opt=x", "--_opt=x", "--go_opt"} {
+		_, _, ok = ParseFlag(arg)
+		require.False(t, ok, arg)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "arf.mod"), []byte("module acme.users\noption go package=users\noption go module=acme.com/users\noption ts style=camel\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "users.arf"), []byte(`package acme.users;
+
+@go.package("accounts")
+struct User {
+    @go.name("ID")
+    id int64;
+    @go.omitempty
+    name string;
+}
+
+struct Group {
+    name string;
+}
+`), 0o644))
+	manifest, err := idl.ParseManifest(filepath.Join(dir, "arf.mod"))
+	require.NoError(t, err)
+	tree, err := idl.Parse(filepath.Join(dir, "users.arf"))
+	require.NoError(t, err)
+	pkg := tree.Packages["acme.users"]
+	user, group := pkg.Structures[0], pkg.Structures[1]
+
+	opts, err := NewOptions("go", manifest, []string{"module=acme.com/override", "paths"})
+	require.NoError(t, err)
+
+	get := func(name string) string {
+		v, _ := opts.Get(name)
+		return v
+	}
+	require.Equal(t, "users", get("package"))
+	require.Equal(t, "acme.com/override", get("module"))
+	require.Equal(t, "true", get("paths"))
+	_, ok := opts.Get("style")
+	require.False(t, ok)
+
+	for _, c := range []struct {
+		value string
+		found bool
+		got   func() (string, bool)
+	}{
+		{"accounts", true, func() (string, bool) { return opts.For(user, "package") }},
+		{"accounts", true, func() (string, bool) { return opts.For(user.Fields[0], "package") }},
+		{"users", true, func() (string, bool) { return opts.For(group, "package") }},
+		{"ID", true, func() (string, bool) { return opts.For(user.Fields[0], "name") }},
+		{"true", true, func() (string, bool) { return opts.For(user.Fields[1], "omitempty") }},
+		{"acme.com/override", true, func() (string, bool) { return opts.For(user, "module") }},
+		{"", false, func() (string, bool) { return opts.For(group.Fields[0], "name") }},
+	} {
+		value, found := c.got()
+		require.Equal(t, c.value, value)
+		require.Equal(t, c.found, found)
+	}
+
+	require.Equal(t, map[string]string{"package": "users", "module": "acme.com/override", "paths": "true"}, opts.Parameters())
+
+	_, err = NewOptions("go", nil, []string{"=x"})
+	require.EqualError(t, err, `--go_opt: invalid option "=x"`)
+}
@@ -0,0 +1,147 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/descriptor"
+)
+
+// PluginPrefix prefixes the name of plugin executables: the plugin for
+// swift is looked up as arf-gen-swift.
+const PluginPrefix = "arf-gen-"
+
+// PluginVersion identifies the layout of messages exchanged with plugins.
+const PluginVersion = 1
+
+// PluginRequest is written by the compiler to the standard input of a
+// plugin, as JSON.
+type PluginRequest struct {
+	Version int `json:"version"`
+	// Files lists the schema files compiled, sorted.
+	Files []string `json:"files"`
+	// Parameters holds the options passed to the plugin, as returned by
+	// Options.Parameters.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Schema describes every declaration of the compiled tree, along with
+	// its source info.
+	Schema *descriptor.Set `json:"schema"`
+}
+
+// PluginResponse is written by plugins to their standard output, as JSON.
+// Error reports a failure, such as a schema the plugin cannot handle, in
+// which case Files is ignored.
+type PluginResponse struct {
+	Files []PluginFile `json:"files,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// PluginFile is a file generated by a plugin. Path is relative to the output
+// directory.
+type PluginFile struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content"`
+}
+
+// NewPluginRequest returns the request describing tree, compiled from files,
+// to plugins receiving parameters.
+func NewPluginRequest(tree *ast.Tree, files []string, parameters map[string]string) (*PluginRequest, error) {
+	schema, err := descriptor.Build(tree, descriptor.WithSourceInfo())
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+	return &PluginRequest{
+		Version:    PluginVersion,
+		Files:      sorted,
+		Parameters: parameters,
+		Schema:     schema,
+	}, nil
+}
+
+// LookupPlugin returns the path of the executable implementing the plugin
+// named name, searched in the directories of the PATH environment variable.
+func LookupPlugin(name string) (string, error) {
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s not found: %w", name, err)
+	}
+	return path, nil
+}
+
+// RunPlugin runs the plugin executable at path with req, returning the files
+// it generated, keyed by their path, ready to be passed to Apply.
+func RunPlugin(ctx context.Context, path string, req *PluginRequest) (map[string][]byte, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("plugin %s failed: %w: %s", path, err, msg)
+		}
+		return nil, fmt.Errorf("plugin %s failed: %w", path, err)
+	}
+
+	var res PluginResponse
+	if err = json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		return nil, fmt.Errorf("plugin %s returned an invalid response: %w", path, err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("plugin %s: %s", path, res.Error)
+	}
+	files := make(map[string][]byte, len(res.Files))
+	for _, f := range res.Files {
+		if err = checkPath(f.Path); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", path, err)
+		}
+		if _, ok := files[f.Path]; ok {
+			return nil, fmt.Errorf("plugin %s generated %s more than once", path, f.Path)
+		}
+		files[f.Path] = f.Content
+	}
+	return files, nil
+}
+
+// ServePlugin implements the plugin side of the protocol: it reads a request
+// from r, passes it to generate, and writes the response to w. Errors
+// returned by generate are reported to the compiler through the response.
+// Plugins typically call it with os.Stdin and os.Stdout.
+func ServePlugin(r io.Reader, w io.Writer, generate func(req *PluginRequest) (map[string][]byte, error)) error {
+	var req PluginRequest
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return fmt.Errorf("invalid plugin request: %w", err)
+	}
+	if req.Version != PluginVersion {
+		return fmt.Errorf("unsupported plugin request version %d", req.Version)
+	}
+	if req.Schema == nil {
+		return errors.New("invalid plugin request: missing schema")
+	}
+
+	var res PluginResponse
+	files, err := generate(&req)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		for path, data := range files {
+			res.Files = append(res.Files, PluginFile{Path: path, Content: data})
+		}
+		sort.Slice(res.Files, func(i, j int) bool { return res.Files[i].Path < res.Files[j].Path })
+	}
+	return json.NewEncoder(w).Encode(&res)
+}
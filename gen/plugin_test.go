@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain lets the test binary act as a plugin, listing the structs of the
+// schema it receives.
+func TestMain(m *testing.M) {
+	if os.Getenv("ARF_GEN_TEST_PLUGIN") == "" {
+		os.Exit(m.Run())
+	}
+	err := ServePlugin(os.Stdin, os.Stdout, func(req *PluginRequest) (map[string][]byte, error) {
+		if req.Parameters["fail"] != "" {
+			return nil, errors.New(req.Parameters["fail"])
+		}
+		var names []string
+		for _, s := range req.Schema.Structs {
+			names = append(names, fmt.Sprintf("%s@%d", s.Name, s.Source.Line))
+		}
+		return map[string][]byte{
+			"structs.txt": []byte(strings.Join(names, "\n")),
+			"files.txt":   []byte(strings.Join(req.Files, "\n")),
+		}, nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestRunPlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.arf")
+	require.NoError(t, os.WriteFile(path, []byte("package org.users;\n\nstruct User {\n    name string;\n}\n"), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+
+	t.Setenv("ARF_GEN_TEST_PLUGIN", "1")
+	req, err := NewPluginRequest(tree, []string{path}, nil)
+	require.NoError(t, err)
+	files, err := RunPlugin(context.Background(), os.Args[0], req)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"structs.txt": []byte("org.users.User@3"),
+		"files.txt":   []byte(path),
+	}, files)
+
+	req, err = NewPluginRequest(tree, nil, map[string]string{"fail": "unsupported schema"})
+	require.NoError(t, err)
+	_, err = RunPlugin(context.Background(), os.Args[0], req)
+	require.EqualError(t, err, fmt.Sprintf("plugin %s: unsupported schema", os.Args[0]))
+
+	req, err = NewPluginRequest(tree, nil, nil)
+	require.NoError(t, err)
+	req.Version = 2
+	_, err = RunPlugin(context.Background(), os.Args[0], req)
+	require.ErrorContains(t, err, "unsupported plugin request version 2")
+
+	_, err = LookupPlugin("does-not-exist")
+	require.ErrorContains(t, err, "plugin does-not-exist not found")
+}
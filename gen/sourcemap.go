@@ -0,0 +1,137 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// SourceMapExtension is appended to the path of generated files to obtain the
+// path of their source map.
+const SourceMapExtension = ".arfmap"
+
+// SourceMap correlates regions of a generated file with the declarations
+// they were generated from, so stack traces and coverage reports of
+// generated code can be mapped back to schemas.
+type SourceMap struct {
+	// File is the path of the generated file.
+	File     string    `json:"file"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping associates the lines StartLine to EndLine of a generated file,
+// 1-based and inclusive, with the declaration named Element, found at Line
+// and Column of Source. Mappings may nest, as the methods of a service do
+// within it.
+type Mapping struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Element   string `json:"element"`
+	Source    string `json:"source"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+}
+
+// Lookup returns the innermost mapping of line of the generated file.
+func (m *SourceMap) Lookup(line int) (Mapping, bool) {
+	var best Mapping
+	found := false
+	for _, mapping := range m.Mappings {
+		if line < mapping.StartLine || line > mapping.EndLine {
+			continue
+		}
+		if !found || mapping.EndLine-mapping.StartLine < best.EndLine-best.StartLine {
+			best, found = mapping, true
+		}
+	}
+	return best, found
+}
+
+// AddSourceMaps adds the encoded source maps of maps to files, each stored
+// next to the generated file it describes.
+func AddSourceMaps(files map[string][]byte, maps ...*SourceMap) error {
+	for _, m := range maps {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		files[m.File+SourceMapExtension] = data
+	}
+	return nil
+}
+
+// Writer builds a generated file along with its source map. Generators
+// write code through it, delimiting the code generated for each declaration
+// with Begin and End.
+type Writer struct {
+	path string
+	buf  bytes.Buffer
+	line int
+
+	open     []Mapping
+	mappings []Mapping
+}
+
+// NewWriter returns a Writer for the generated file stored at path.
+func NewWriter(path string) *Writer {
+	return &Writer{path: path, line: 1}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.line += bytes.Count(p, []byte{'\n'})
+	return w.buf.Write(p)
+}
+
+// Printf writes formatted code.
+func (w *Writer) Printf(format string, args ...any) {
+	fmt.Fprintf(w, format, args...)
+}
+
+// Begin starts the region generated for obj at the current line.
+func (w *Writer) Begin(obj ast.Object) {
+	pos := obj.Pos()
+	w.open = append(w.open, Mapping{
+		StartLine: w.line,
+		Element:   obj.FQN(),
+		Source:    pos.Filename,
+		Line:      pos.Line,
+		Column:    pos.Column,
+	})
+}
+
+// End ends the region started by the last call to Begin. Regions end with
+// the last line written, or the current line when it is not empty.
+func (w *Writer) End() {
+	if len(w.open) == 0 {
+		panic("gen: End called without Begin")
+	}
+	m := w.open[len(w.open)-1]
+	w.open = w.open[:len(w.open)-1]
+	m.EndLine = w.line
+	if data := w.buf.Bytes(); len(data) > 0 && data[len(data)-1] == '\n' {
+		m.EndLine--
+	}
+	m.EndLine = max(m.EndLine, m.StartLine)
+	w.mappings = append(w.mappings, m)
+}
+
+// Bytes returns the code written so far.
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// SourceMap returns the source map of the regions ended so far, ordered by
+// their first line, outer regions first.
+func (w *Writer) SourceMap() *SourceMap {
+	mappings := append([]Mapping{}, w.mappings...)
+	sort.SliceStable(mappings, func(i, j int) bool {
+		if mappings[i].StartLine != mappings[j].StartLine {
+			return mappings[i].StartLine < mappings[j].StartLine
+		}
+		return mappings[i].EndLine > mappings[j].EndLine
+	})
+	return &SourceMap{File: w.path, Mappings: mappings}
+}
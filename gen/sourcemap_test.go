@@ -0,0 +1,60 @@
+package gen
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package acme.users;
+
+struct User {
+    id int64;
+    name string;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+	user := tree.Packages["acme.users"].Structures[0]
+
+	w := NewWriter("users.go")
+	w.Printf("package users\n\n")
+	w.Begin(user)
+	w.Printf("type User struct {\n")
+	for _, f := range user.Fields {
+		w.Begin(f)
+		w.Printf("\t%s any\n", f.Name)
+		w.End()
+	}
+	w.Printf("}\n")
+	w.End()
+
+	m := w.SourceMap()
+	require.Equal(t, "users.go", m.File)
+	require.Equal(t, []Mapping{
+		{StartLine: 3, EndLine: 6, Element: "acme.users.User", Source: path, Line: 3, Column: 1},
+		{StartLine: 4, EndLine: 4, Element: "acme.users.User.id", Source: path, Line: 4, Column: 5},
+		{StartLine: 5, EndLine: 5, Element: "acme.users.User.name", Source: path, Line: 5, Column: 5},
+	}, m.Mappings)
+
+	found, ok := m.Lookup(5)
+	require.True(t, ok)
+	require.Equal(t, "acme.users.User.name", found.Element)
+	found, ok = m.Lookup(6)
+	require.True(t, ok)
+	require.Equal(t, "acme.users.User", found.Element)
+	_, ok = m.Lookup(1)
+	require.False(t, ok)
+
+	files := map[string][]byte{"users.go": w.Bytes()}
+	require.NoError(t, AddSourceMaps(files, m))
+	var decoded SourceMap
+	require.NoError(t, json.Unmarshal(files["users.go"+SourceMapExtension], &decoded))
+	require.Equal(t, m, &decoded)
+}
@@ -0,0 +1,221 @@
+// Package goimport converts Go struct types into arf struct declarations,
+// allowing existing codebases to bootstrap schemas from their current models.
+//
+// Exported fields are converted following encoding/json conventions: fields
+// tagged with `json:"-"` are skipped, embedded structs are flattened, and a
+// json tag naming the field is kept as its wire name. Pointers become
+// optionals, slices and arrays become arrays, []byte becomes bytes and
+// time.Time becomes timestamp. Referenced structs are converted as well.
+// Types without an arf equivalent are approximated or dropped, and reported as
+// notes.
+package goimport
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/internal/naming"
+)
+
+// Note describes how an element that could not be translated as-is was
+// mapped to arf.
+type Note struct {
+	Element string
+	Message string
+}
+
+func (n Note) String() string {
+	return fmt.Sprintf("%s: %s", n.Element, n.Message)
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+var primitives = map[reflect.Kind]string{
+	reflect.Bool:    "bool",
+	reflect.Int8:    "int8",
+	reflect.Int16:   "int16",
+	reflect.Int32:   "int32",
+	reflect.Int64:   "int64",
+	reflect.Uint8:   "uint8",
+	reflect.Uint16:  "uint16",
+	reflect.Uint32:  "uint32",
+	reflect.Uint64:  "uint64",
+	reflect.Float32: "float32",
+	reflect.Float64: "float64",
+	reflect.String:  "string",
+}
+
+// Convert returns an arf file declaring pkg, containing a struct for each of
+// the given types and for every struct they reference. Types must be structs or
+// pointers to structs.
+func Convert(pkg string, types ...reflect.Type) (*ast.File, []Note, error) {
+	c := &converter{names: map[reflect.Type]string{}, taken: map[string]struct{}{}}
+	c.file = &ast.File{
+		Package:       &ast.Package{},
+		ImportAliases: map[string]string{},
+	}
+	c.file.Package.Position = c.pos()
+	c.file.Package.Components = strings.Split(pkg, ".")
+	c.file.Package.Value = pkg
+
+	for _, t := range types {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, nil, fmt.Errorf("%s is not a struct", t)
+		}
+		c.structName(t, t.Name())
+	}
+	for len(c.queue) > 0 {
+		t := c.queue[0]
+		c.queue = c.queue[1:]
+		c.file.Structs = append(c.file.Structs, c.convertStruct(t))
+	}
+	return c.file, c.notes, nil
+}
+
+type converter struct {
+	file  *ast.File
+	names map[reflect.Type]string
+	taken map[string]struct{}
+	queue []reflect.Type
+	notes []Note
+}
+
+func (c *converter) pos() ast.Position {
+	return ast.Position{File: c.file}
+}
+
+func (c *converter) notef(element, format string, args ...any) {
+	c.notes = append(c.notes, Note{Element: element, Message: fmt.Sprintf(format, args...)})
+}
+
+// structName returns the arf name of t, scheduling its conversion when seen for
+// the first time. Anonymous structs are named after suggested.
+func (c *converter) structName(t reflect.Type, suggested string) string {
+	if name, ok := c.names[t]; ok {
+		return name
+	}
+	name := suggested
+	for i := 2; ; i++ {
+		if _, ok := c.taken[name]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s%d", suggested, i)
+	}
+	if name != suggested {
+		c.notef(t.String(), "renamed to %s to avoid a name collision", name)
+	}
+	c.names[t] = name
+	c.taken[name] = struct{}{}
+	c.queue = append(c.queue, t)
+	return name
+}
+
+func (c *converter) convertStruct(t reflect.Type) *ast.Struct {
+	s := &ast.Struct{Position: c.pos(), Name: c.names[t]}
+	c.convertFields(s, t, t)
+	return s
+}
+
+func (c *converter) convertFields(s *ast.Struct, owner, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				c.convertFields(s, owner, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		element := owner.String() + "." + f.Name
+		typ := c.convertType(element, f.Type, s.Name+f.Name)
+		if typ == nil {
+			continue
+		}
+		sf := ast.StructField{Position: c.pos(), Name: naming.Snake(f.Name), Type: typ}
+		if tag != "" {
+			sf.Name = naming.Snake(tag)
+			if sf.Name != tag {
+				sf.Annotations = append(sf.Annotations, ast.Annotation{
+					Position:  sf.Position,
+					Name:      "wire_name",
+					Arguments: []any{tag},
+				})
+			}
+		}
+		s.AppendField(sf)
+	}
+}
+
+func (c *converter) convertType(element string, t reflect.Type, suggested string) ast.Type {
+	pos := c.pos()
+	switch {
+	case t == timeType:
+		return &ast.PrimitiveType{Position: pos, Name: "timestamp"}
+	case t == durationType:
+		return &ast.PrimitiveType{Position: pos, Name: "duration"}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8:
+		return &ast.PrimitiveType{Position: pos, Name: "bytes"}
+	}
+
+	if prim, ok := primitives[t.Kind()]; ok {
+		return &ast.PrimitiveType{Position: pos, Name: prim}
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Uint:
+		prim := strings.Replace(t.Kind().String(), "int", "int64", 1)
+		c.notef(element, "%s was converted to %s", t.Kind(), prim)
+		return &ast.PrimitiveType{Position: pos, Name: prim}
+	case reflect.Pointer:
+		inner := c.convertType(element, t.Elem(), suggested)
+		if inner == nil {
+			return nil
+		}
+		if _, ok := inner.(*ast.OptionalType); ok {
+			return inner
+		}
+		return &ast.OptionalType{Position: pos, Type: inner}
+	case reflect.Slice, reflect.Array:
+		inner := c.convertType(element, t.Elem(), suggested)
+		if inner == nil {
+			return nil
+		}
+		return &ast.ArrayType{Position: pos, Type: inner}
+	case reflect.Map:
+		key := c.convertType(element, t.Key(), suggested+"Key")
+		value := c.convertType(element, t.Elem(), suggested)
+		if key == nil || value == nil {
+			return nil
+		}
+		return &ast.MapType{Position: pos, Key: key, Value: value}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			name = suggested
+		}
+		return &ast.SimpleUserType{Position: pos, Name: c.structName(t, name)}
+	}
+
+	c.notef(element, "%s has no arf equivalent; the field was dropped", t)
+	return nil
+}
@@ -0,0 +1,100 @@
+package goimport
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+type Timestamps struct {
+	CreatedAt time.Time
+	TTL       time.Duration
+}
+
+type Address struct {
+	Street string `json:"street"`
+	Zip    *string
+}
+
+type User struct {
+	Timestamps
+	ID       uint64 `json:"id"`
+	Name     string `json:"displayName,omitempty"`
+	Avatar   []byte
+	Tags     []string
+	Labels   map[string]int
+	Home     *Address
+	Previous []Address
+	Manager  *User
+	Meta     struct{ Source string }
+	Callback func()
+	Ignored  string `json:"-"`
+	private  bool
+}
+
+func TestConvert(t *testing.T) {
+	f, notes, err := Convert("example.users", reflect.TypeOf(&User{}))
+	require.NoError(t, err)
+	require.Equal(t, "example.users", f.Package.Value)
+	require.Len(t, f.Structs, 3)
+
+	user := f.FindStruct("User")
+	require.NotNil(t, user)
+	types := map[string]string{}
+	for _, field := range user.Fields {
+		types[field.Name] = typeString(field.Type)
+	}
+	require.Equal(t, map[string]string{
+		"created_at":   "timestamp",
+		"ttl":          "duration",
+		"id":           "uint64",
+		"display_name": "string",
+		"avatar":       "bytes",
+		"tags":         "array<string>",
+		"labels":       "map<string, int64>",
+		"home":         "optional<Address>",
+		"previous":     "array<Address>",
+		"manager":      "optional<User>",
+		"meta":         "UserMeta",
+	}, types)
+
+	name := user.Fields[3]
+	require.Equal(t, "display_name", name.Name)
+	require.Equal(t, "displayName", name.WireName())
+
+	require.NotNil(t, f.FindStruct("Address"))
+	require.NotNil(t, f.FindStruct("UserMeta"))
+
+	var messages []string
+	for _, n := range notes {
+		messages = append(messages, n.String())
+	}
+	require.Equal(t, []string{
+		"goimport.User.Labels: int was converted to int64",
+		"goimport.User.Callback: func() has no arf equivalent; the field was dropped",
+	}, messages)
+}
+
+func TestConvertRejectsNonStructs(t *testing.T) {
+	_, _, err := Convert("example", reflect.TypeOf(1))
+	require.Error(t, err)
+}
+
+func typeString(t ast.Type) string {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return tt.Name
+	case *ast.OptionalType:
+		return "optional<" + typeString(tt.Type) + ">"
+	case *ast.ArrayType:
+		return "array<" + typeString(tt.Type) + ">"
+	case *ast.MapType:
+		return "map<" + typeString(tt.Key) + ", " + typeString(tt.Value) + ">"
+	case *ast.SimpleUserType:
+		return tt.Name
+	}
+	return "?"
+}
@@ -0,0 +1,127 @@
+package idl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+var httpMethods = map[string]struct{}{
+	"GET":     {},
+	"POST":    {},
+	"PUT":     {},
+	"PATCH":   {},
+	"DELETE":  {},
+	"HEAD":    {},
+	"OPTIONS": {},
+}
+
+// parseHTTPPath parses a path template such as /users/{id}/posts/{post.id}
+// into its segments. Placeholders must span a whole segment.
+func parseHTTPPath(path string) ([]ast.HTTPPathSegment, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path %q must start with /", path)
+	}
+	if path == "/" {
+		return nil, nil
+	}
+
+	var segments []ast.HTTPPathSegment
+	seen := makeSet[string]()
+	for _, raw := range strings.Split(path[1:], "/") {
+		if raw == "" {
+			return nil, fmt.Errorf("path %q contains an empty segment", path)
+		}
+		if !strings.HasPrefix(raw, "{") {
+			if strings.ContainsAny(raw, "{}") {
+				return nil, fmt.Errorf("placeholder in path %q must span a whole segment", path)
+			}
+			segments = append(segments, ast.HTTPPathSegment{Literal: raw})
+			continue
+		}
+
+		if !strings.HasSuffix(raw, "}") || strings.Count(raw, "{") != 1 || strings.Count(raw, "}") != 1 {
+			return nil, fmt.Errorf("malformed placeholder %s in path %q", raw, path)
+		}
+		name := raw[1 : len(raw)-1]
+		comps := strings.Split(name, ".")
+		for _, c := range comps {
+			if !snakeCaseRegex.MatchString(c) {
+				return nil, fmt.Errorf("invalid placeholder %s in path %q", raw, path)
+			}
+		}
+		if seen.has(name) {
+			return nil, fmt.Errorf("placeholder %s is used more than once in path %q", raw, path)
+		}
+		seen.add(name)
+		segments = append(segments, ast.HTTPPathSegment{Variable: comps})
+	}
+
+	return segments, nil
+}
+
+// bindHTTPVariable resolves a placeholder against a method's parameters. The
+// first component may name a parameter, in which case the remaining ones walk
+// its fields; otherwise, the placeholder is looked up within the fields of the
+// method's unary parameters.
+func bindHTTPVariable(m *ast.ServiceMethod, variable []string) (*ast.StructField, error) {
+	for _, p := range m.Params {
+		if p.Name != nil && *p.Name == variable[0] {
+			if p.Stream {
+				return nil, fmt.Errorf("cannot bind placeholder {%s} to stream parameter", strings.Join(variable, "."))
+			}
+			if len(variable) == 1 {
+				return nil, fmt.Errorf("placeholder {%s} must reference a scalar field, not parameter %s", variable[0], variable[0])
+			}
+			return walkHTTPVariable(p.Type, variable, 1)
+		}
+	}
+
+	for _, p := range m.Params {
+		if p.Stream {
+			continue
+		}
+		if f, err := walkHTTPVariable(p.Type, variable, 0); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("placeholder {%s} does not match any parameter of method %s", strings.Join(variable, "."), m.Name)
+}
+
+func walkHTTPVariable(t ast.Type, variable []string, idx int) (*ast.StructField, error) {
+	name := strings.Join(variable, ".")
+	rt, ok := t.(ast.ResolvableType)
+	if !ok {
+		return nil, fmt.Errorf("placeholder {%s} does not reference a field", name)
+	}
+	str, ok := rt.Resolved().(*ast.Struct)
+	if !ok {
+		return nil, fmt.Errorf("placeholder {%s} does not reference a field", name)
+	}
+
+	var field *ast.StructField
+	for _, f := range str.AllFields() {
+		if f.Name == variable[idx] {
+			field = f
+			break
+		}
+	}
+	if field == nil {
+		return nil, fmt.Errorf("placeholder {%s}: %s has no field %s", name, str.Name, variable[idx])
+	}
+
+	if idx < len(variable)-1 {
+		return walkHTTPVariable(field.Type, variable, idx+1)
+	}
+
+	switch ft := field.Type.(type) {
+	case *ast.PrimitiveType:
+		return field, nil
+	case ast.ResolvableType:
+		if _, ok := ft.Resolved().(*ast.Enum); ok {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("placeholder {%s} must reference a primitive or enum field, got %s", name, field.Type.Kind())
+}
@@ -3,16 +3,18 @@ package idl
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/arf-rpc/idl/ast"
 )
 
-func Parse(entrypoint string) (*ast.Tree, error) {
-	fe, err := New(entrypoint)
+func Parse(entrypoint string, opts ...Option) (*ast.Tree, error) {
+	fe, err := New(entrypoint, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -21,90 +23,437 @@ func Parse(entrypoint string) (*ast.Tree, error) {
 
 type Frontend interface {
 	Run() (*ast.Tree, error)
+
+	// Compile parses and validates the entrypoint, returning every diagnostic
+	// found rather than a single joined error.
+	Compile() *Result
+
+	// Warnings returns diagnostics that did not prevent the last Run from
+	// succeeding.
+	Warnings() []*Diagnostic
 }
 
 type frontend struct {
+	options
 	entrypoint     string
 	workingDir     string
 	processedPaths map[string]struct{}
+	read           map[string]struct{}
 	files          map[string]*ast.File
+	warnings       []*Diagnostic
+	resolver       Resolver
+	manifest       *Manifest
+	severities     map[string]Severity
+
+	// finder indexes the schema files found under the roots of the current
+	// compilation, resolving imported packages and suggesting missing
+	// imports.
+	finder *importFinder
+	// parsing lists the files being parsed, each one importing the next, so
+	// import cycles can be reported.
+	parsing []string
+	// scanned holds the directories listed by wildcard and package imports
+	// of the current compilation.
+	scanned map[string]struct{}
 }
 
-func New(entrypoint string) (Frontend, error) {
-	stat, err := os.Stat(entrypoint)
-	if err != nil {
-		return nil, err
+// StdinEntrypoint can be passed to New in place of a path to compile a schema
+// read from standard input.
+const StdinEntrypoint = "-"
+
+// New returns a Frontend compiling the schema at entrypoint. When entrypoint
+// is StdinEntrypoint, the schema is read from standard input and reported as
+// <stdin> in diagnostics, unless WithStdinFilename is used.
+func New(entrypoint string, opts ...Option) (Frontend, error) {
+	fe := &frontend{
+		processedPaths: map[string]struct{}{},
+		read:           map[string]struct{}{},
+		files:          map[string]*ast.File{},
+	}
+	for _, opt := range opts {
+		opt(&fe.options)
+	}
+
+	var stdin *stdinResolver
+	if entrypoint == StdinEntrypoint {
+		var err error
+		if stdin, err = fe.readStdin(); err != nil {
+			return nil, err
+		}
+		fe.entrypoint = stdin.location
+		if fe.workingDir, err = filepath.Abs(filepath.Dir(stdin.location)); err != nil {
+			return nil, err
+		}
+	} else {
+		stat, err := os.Stat(entrypoint)
+		if err != nil {
+			return nil, err
+		}
+		if stat.IsDir() {
+			return nil, fmt.Errorf("%s: is a directory", entrypoint)
+		}
+		absPath, err := filepath.Abs(entrypoint)
+		if err != nil {
+			return nil, err
+		}
+		fe.entrypoint = absPath
+		fe.workingDir = path.Dir(absPath)
+	}
+
+	var err error
+
+	var manifest *Manifest
+	manifestPath := fe.manifestPath
+	if manifestPath == "" && !fe.noFilesystem {
+		manifestPath, _ = findManifest(fe.workingDir)
+	}
+	if manifestPath != "" {
+		if manifest, err = ParseManifest(manifestPath); err != nil {
+			return nil, err
+		}
+	}
+
+	fe.severities = map[string]Severity{}
+	if manifest != nil {
+		for code, sev := range manifest.Severities {
+			fe.severities[code] = sev
+		}
+	}
+	for code, sev := range fe.options.severities {
+		if err := validateCode(code); err != nil {
+			return nil, err
+		}
+		fe.severities[code] = sev
+	}
+
+	fe.manifest = manifest
+	if fe.noFilesystem {
+		fe.resolver = noFileResolver{}
+	} else {
+		fe.resolver = newFileResolver(manifest, fe.schemaRoot, fe.extensions, fe.includePaths...)
+	}
+	for _, wrap := range fe.resolvers {
+		fe.resolver = wrap(fe.resolver)
 	}
-	if stat.IsDir() {
-		return nil, fmt.Errorf("%s: is a directory", entrypoint)
+	if stdin != nil {
+		// The buffer read from stdin takes precedence over any file stored at
+		// the same location, which editors use to validate unsaved changes.
+		stdin.next = fe.resolver
+		fe.resolver = stdin
+	}
+	return fe, nil
+}
+
+func (f *frontend) readStdin() (*stdinResolver, error) {
+	r := f.stdin
+	if r == nil {
+		r = os.Stdin
 	}
-	absPath, err := filepath.Abs(entrypoint)
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("reading stdin: %w", err)
 	}
 
-	return &frontend{
-		entrypoint:     absPath,
-		workingDir:     path.Dir(absPath),
-		processedPaths: map[string]struct{}{},
-		files:          map[string]*ast.File{},
-	}, nil
+	location := "<stdin>"
+	if f.stdinFilename != "" {
+		if location, err = filepath.Abs(f.stdinFilename); err != nil {
+			return nil, err
+		}
+	}
+	return &stdinResolver{location: location, data: data}, nil
+}
+
+// stdinResolver serves the contents read from stdin for the entrypoint,
+// delegating everything else to next.
+type stdinResolver struct {
+	next     Resolver
+	location string
+	data     []byte
+}
+
+func (r *stdinResolver) Resolve(from, value string) (string, error) {
+	return r.next.Resolve(from, value)
+}
+
+func (r *stdinResolver) Glob(from, value string) ([]string, error) {
+	return glob(r.next, from, value)
+}
+
+func (r *stdinResolver) ReadFile(location string) ([]byte, error) {
+	if location == r.location {
+		return r.data, nil
+	}
+	return r.next.ReadFile(location)
 }
 
 func (f *frontend) Run() (*ast.Tree, error) {
-	if err := f.parse(f.entrypoint); err != nil {
-		return nil, err
+	res := f.Compile()
+	return res.Tree, res.Err()
+}
+
+func (f *frontend) Compile() *Result {
+	res := &Result{}
+	f.warnings = nil
+	f.finder = f.importFinder()
+	f.scanned = map[string]struct{}{}
+	defer func() {
+		res.Files = sortedKeys(f.read)
+		res.Imports = newImportGraph(f.files)
+		res.Dirs = sortedKeys(f.scanned)
+		if f.manifest != nil {
+			res.Manifest = f.manifest.Path
+		}
+		res.Diagnostics = normalizeDiagnostics(res.Diagnostics)
+		f.warnings = normalizeDiagnostics(f.warnings)
+	}()
+
+	phases := []func() error{
+		func() error { return f.parse(f.entrypoint) },
+		func() error { return f.eachFile(validatePhase1) },
+		func() error { return mergeReopenedStructs(f.files, f.entrypoint) },
+		func() error { return validateConventions(f.files, f.entrypoint, &f.options, f.resolver.ReadFile) },
+		func() error {
+			return f.eachFile(func(files map[string]*ast.File, path string) error {
+				return validatePhase2(files, path, f.finder)
+			})
+		},
+		func() error { return f.eachFile(resolveAnnotationConsts) },
+		func() error { return f.eachFile(validateAnnotationSpecs) },
+		func() error { return validateIDs(f.files, f.entrypoint) },
+		func() error { return f.eachFile(validatePhase3) },
+		func() error {
+			return joinDiagnostics(collectWarnings(f.files, f.entrypoint, f.importNormalizer(), f.limits()))
+		},
 	}
-	if err := validatePhase1(f.files, f.entrypoint); err != nil {
-		return nil, err
+	for _, phase := range phases {
+		if err := f.triage(diagnosticsOf(phase())...); err != nil {
+			res.Diagnostics = append(f.warnings, diagnosticsOf(err)...)
+			return res
+		}
 	}
-	if err := validatePhase2(f.files, f.entrypoint); err != nil {
-		return nil, err
+	res.Diagnostics = f.warnings
+
+	// Files are added in a stable order, so consumers iterating the tree
+	// produce deterministic results.
+	res.Tree = &ast.Tree{}
+	for _, p := range sortedKeys(f.files) {
+		res.Tree.AddFile(f.files[p])
 	}
-	if err := validatePhase3(f.files, f.entrypoint); err != nil {
-		return nil, err
+	return res
+}
+
+// eachFile runs phase over every parsed file, the entrypoint first, so
+// declarations reached only through imports are resolved and validated as
+// well.
+func (f *frontend) eachFile(phase func(files map[string]*ast.File, path string) error) error {
+	errs := []error{phase(f.files, f.entrypoint)}
+	for _, p := range sortedKeys(f.files) {
+		if p != f.entrypoint {
+			errs = append(errs, phase(f.files, p))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	tree := &ast.Tree{}
-	for _, f := range f.files {
-		tree.AddFile(f)
+// override applies severity overrides to diags, dropping the ones that were
+// turned off.
+func (f *frontend) override(diags []*Diagnostic) []*Diagnostic {
+	res := diags[:0]
+	for _, d := range diags {
+		if sev, ok := f.severities[d.Code]; ok && d.Code != "" {
+			d.Severity = sev
+		}
+		if d.Severity != SeverityOff {
+			res = append(res, d)
+		}
 	}
+	return res
+}
 
-	return tree, nil
+// triage applies severity overrides to diags, keeping the ones that are no
+// longer errors as warnings of the current run. It returns the remaining
+// errors, if any.
+func (f *frontend) triage(diags ...*Diagnostic) error {
+	var errs []error
+	for _, d := range f.override(diags) {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+			continue
+		}
+		f.warnings = append(f.warnings, d)
+	}
+	return errors.Join(errs...)
+}
+
+// limits returns the name limits configured through WithNameLimits, or
+// DefaultNameLimits.
+func (f *frontend) limits() NameLimits {
+	if f.nameLimits != nil {
+		return *f.nameLimits
+	}
+	return DefaultNameLimits
+}
+
+// typeDepth returns the type nesting depth configured through
+// WithMaxTypeDepth, or DefaultMaxTypeDepth.
+func (f *frontend) typeDepth() int {
+	if f.maxTypeDepth > 0 {
+		return f.maxTypeDepth
+	}
+	return DefaultMaxTypeDepth
 }
 
+// importFinder returns an importFinder looking up types under the schema
+// root, or the directory of the entrypoint when none is configured, and
+// under the include paths.
+func (f *frontend) importFinder() *importFinder {
+	root := f.schemaRoot
+	if root == "" {
+		root = f.workingDir
+	}
+	exts := f.extensions
+	if len(exts) == 0 {
+		exts = DefaultExtensions
+	}
+	roots := append([]string{root}, f.includePaths...)
+	if f.noFilesystem {
+		roots = nil
+	}
+	return &importFinder{roots: roots, extensions: exts, imports: f.importNormalizer()}
+}
+
+func (f *frontend) importNormalizer() *importNormalizer {
+	return &importNormalizer{
+		resolver:   f.resolver,
+		manifest:   f.manifest,
+		extensions: f.extensions,
+	}
+}
+
+// resolveImport returns the files imp, declared in file, refers to: the file
+// at the imported path, every file matching the imported pattern, or every
+// file declaring the imported package.
+func (f *frontend) resolveImport(file *ast.File, imp *ast.Import) ([]string, error) {
+	if !imp.ByPackage && isGlob(imp.Value) {
+		matches, err := glob(f.resolver, file.Path, imp.Value)
+		if err != nil {
+			return nil, &Diagnostic{Severity: SeverityError, Position: imp.Position, Message: err.Error(), cause: err}
+		}
+		f.scanGlob(file.Path, imp.Value, matches)
+		// A file may import the directory it is part of
+		matches = slices.DeleteFunc(matches, func(location string) bool { return location == file.Path })
+		if len(matches) == 0 {
+			return nil, newDiagnostic(SeverityError, imp.Position, "no schema files match %s", imp.Value)
+		}
+		return matches, nil
+	}
+	if !imp.ByPackage {
+		clean, err := f.resolver.Resolve(file.Path, imp.Value)
+		if err != nil {
+			return nil, &Diagnostic{Severity: SeverityError, Position: imp.Position, Message: err.Error(), cause: err}
+		}
+		return []string{clean}, nil
+	}
+
+	if file.Package != nil && imp.Value == file.Package.Value {
+		return nil, newDiagnostic(SeverityError, imp.Position, "package %s cannot be imported by its own files", imp.Value)
+	}
+	files := f.finder.packageFiles(imp.Value)
+	for _, dir := range f.finder.dirs {
+		f.scan(dir)
+	}
+	if len(files) == 0 {
+		return nil, newDiagnostic(SeverityError, imp.Position, "package %s not found under %s", imp.Value, strings.Join(f.finder.roots, ", "))
+	}
+	return files, nil
+}
+
+// scanGlob records the directories the wildcard import of value, declared in
+// the file at from, was matched in: those holding matches, along with the
+// directory of the pattern up to its first wildcard, relative to from and to
+// each root, where new matches may be added.
+func (f *frontend) scanGlob(from, value string, matches []string) {
+	for _, m := range matches {
+		f.scan(filepath.Dir(m))
+	}
+	static := value
+	for isGlob(static) {
+		static = path.Dir(static)
+	}
+	for _, base := range append([]string{filepath.Dir(from)}, f.finder.roots...) {
+		f.scan(filepath.Join(base, filepath.FromSlash(static)))
+	}
+}
+
+// scan records dir as listed by the current compilation, provided it is a
+// directory of the local filesystem.
+func (f *frontend) scan(dir string) {
+	if f.noFilesystem {
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		f.scanned[abs] = struct{}{}
+	}
+}
+
+func (f *frontend) Warnings() []*Diagnostic { return f.warnings }
+
 func (f *frontend) parse(path string) error {
-	data, err := os.ReadFile(path)
+	data, err := f.resolver.ReadFile(path)
 	if err != nil {
-		return err
+		return &Diagnostic{Severity: SeverityError, Position: ast.Position{Filename: path}, Message: err.Error(), cause: err}
 	}
+	// Files failing to parse were still read, and count as such
+	f.read[path] = struct{}{}
 	tokens, errs := lexFile(data, nil)
 	if errs != nil {
+		// The lexer is unaware of the file it scans
+		for _, err := range errs {
+			if d, ok := err.(*Diagnostic); ok {
+				d.Position.Filename = path
+			}
+		}
 		return errors.Join(errs...)
 	}
 
-	astFile, errs := parse(path, tokens, nil)
-	if errs != nil {
-		return errors.Join(errs...)
+	astFile, errs := parseWithTypeDepth(path, tokens, nil, f.typeDepth())
+	if err := f.triage(diagnosticsOf(errors.Join(errs...))...); err != nil {
+		return err
 	}
 
-	for i, imp := range astFile.Imports {
-		val := imp.Value
-		if !strings.HasSuffix(strings.ToLower(val), ".arf") {
-			val = val + ".arf"
-		}
+	f.parsing = append(f.parsing, path)
+	defer func() { f.parsing = f.parsing[:len(f.parsing)-1] }()
 
-		clean, err := filepath.Abs(filepath.Join(filepath.Dir(path), val))
+	for i, imp := range astFile.Imports {
+		files, err := f.resolveImport(astFile, imp)
 		if err != nil {
 			return err
 		}
 
-		if _, ok := f.processedPaths[clean]; !ok {
-			if err = f.parse(clean); err != nil {
-				return err
+		for _, clean := range files {
+			if start := slices.Index(f.parsing, clean); start != -1 {
+				cycle := &ImportCycleError{
+					Chain: append(slices.Clone(f.parsing[start:]), clean),
+					dir:   filepath.Dir(f.entrypoint),
+				}
+				return &Diagnostic{
+					Severity: SeverityError,
+					Position: imp.Position,
+					Message:  cycle.Error(),
+					cause:    cycle,
+				}
+			}
+			if _, ok := f.processedPaths[clean]; !ok {
+				if err = f.parse(clean); err != nil {
+					return err
+				}
 			}
 		}
-		astFile.Imports[i].ResolvedValue = clean
+		astFile.Imports[i].ResolvedValue = files[0]
+		astFile.Imports[i].Files = files
 	}
 
 	f.files[path] = astFile
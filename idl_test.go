@@ -1,7 +1,14 @@
 package idl
 
 import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/arf-rpc/idl/ast"
 	"github.com/stretchr/testify/require"
@@ -27,7 +34,7 @@ func TestMethodParamsMustBeStructOrEnum(t *testing.T) {
 		require.Empty(t, errs, src)
 		fe, errs := parse("", tokens, nil)
 		require.Empty(t, errs, src)
-		require.Error(t, validatePhase2(map[string]*ast.File{"": fe}, ""), src)
+		require.Error(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil), src)
 	}
 }
 
@@ -55,14 +62,44 @@ func TestMapKeyTypes(t *testing.T) {
 		require.Empty(t, errs, src)
 		fe, errs := parse("", tokens, nil)
 		require.Empty(t, errs, src)
-		require.NoError(t, validatePhase2(map[string]*ast.File{"": fe}, ""), src)
+		require.NoError(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil), src)
 	}
 	for _, src := range bad {
 		tokens, errs := lexFile([]byte(src), nil)
 		require.Empty(t, errs, src)
 		fe, errs := parse("", tokens, nil)
 		require.Empty(t, errs, src)
-		require.Error(t, validatePhase2(map[string]*ast.File{"": fe}, ""), src)
+		require.Error(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil), src)
+	}
+}
+
+func TestSetElementTypes(t *testing.T) {
+	good := []string{
+		"package p; struct S{ s set<string>; }",
+		"package p; enum E{A=1;} struct S{ s set<E>; }",
+		"package p; struct K{} struct S{ s set<K>; m map<string, set<int32>>; }",
+	}
+	bad := map[string]string{
+		"package p; struct S{ s set<optional<string>>; }":         "Cannot use Optional as a set element",
+		"package p; struct S{ s set<array<string>>; }":            "Cannot use Array as a set element",
+		"package p; struct S{ s set<set<string>>; }":              "Cannot use Set as a set element",
+		"package p; struct S{ s set<map<string,string>>; }":       "Cannot use Map as a set element",
+		"package p; struct V{} struct S{ m map<set<string>,V>; }": "Cannot use Set as a map key",
+	}
+	for _, src := range good {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.NoError(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil), src)
+		require.IsType(t, &ast.SetType{}, fe.Structs[len(fe.Structs)-1].Fields[0].Type, src)
+	}
+	for src, msg := range bad {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.ErrorContains(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil), msg, src)
 	}
 }
 
@@ -87,7 +124,7 @@ func TestServiceReopenDivergence(t *testing.T) {
 	require.Empty(t, errs)
 	files := map[string]*ast.File{"": fe}
 	require.NoError(t, validatePhase1(files, ""))
-	require.NoError(t, validatePhase2(files, ""))
+	require.NoError(t, validatePhase2(files, "", nil))
 	require.Error(t, validatePhase3(files, ""))
 }
 
@@ -97,7 +134,7 @@ func TestUnresolvedTypes(t *testing.T) {
 	require.Empty(t, errs)
 	fe, errs := parse("", tokens, nil)
 	require.Empty(t, errs)
-	err := validatePhase2(map[string]*ast.File{"": fe}, "")
+	err := validatePhase2(map[string]*ast.File{"": fe}, "", nil)
 	require.Error(t, err)
 }
 
@@ -117,12 +154,69 @@ func TestStreamPlacementAndUniqueness(t *testing.T) {
 	}
 }
 
-func TestAnnotationParamsMustBeStrings(t *testing.T) {
-	src := `@ann(123) package p; struct S{ f string; }`
+func TestTypedAnnotationArguments(t *testing.T) {
+	src := `package p; enum Verb { GET = 1; } @retry(3, -0x10, 1_000) @flag(true, enabled = false) @route(GET, method = POST, verb = Verb) struct S{ f string; }`
 	tokens, errs := lexFile([]byte(src), nil)
 	require.Empty(t, errs)
-	_, errs = parse("", tokens, nil)
-	require.NotEmpty(t, errs)
+	fe, errs := parse("", tokens, nil)
+	require.Empty(t, errs)
+	require.NoError(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil))
+
+	anns := fe.Structs[0].Annotations
+	require.Equal(t, []any{int64(3), int64(-16), int64(1000)}, anns.ByName("retry").Arguments)
+	require.Equal(t, []any{true}, anns.ByName("flag").Arguments)
+	require.Equal(t, false, anns.ByName("flag").NamedArguments[0].Value)
+	route := anns.ByName("route")
+	require.Equal(t, []any{"GET"}, route.Arguments)
+	require.Equal(t, "POST", route.NamedArguments[0].Value)
+	require.Same(t, fe.FindEnum("Verb"), route.NamedArguments[1].Value.(*ast.AnnotationReference).Resolved())
+
+	bad := map[string]string{
+		`package p; @ann(-x) struct S{}`:                   `Expected integer after -, got Identifier`,
+		`package p; @ann(0xFFFFFFFFFFFFFFFFFF) struct S{}`: `failed parsing value 0xFFFFFFFFFFFFFFFFFF`,
+	}
+	for src, msg := range bad {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		_, errs = parse("", tokens, nil)
+		require.NotEmpty(t, errs, src)
+		require.Contains(t, errs[0].Error(), msg, src)
+	}
+
+	// Built-in annotations taking numbers and booleans as strings accept
+	// typed values as well
+	compiled, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    @max_length(64)
+    name string;
+    @range(0, 150)
+    @default(18)
+    age uint8;
+    @default(true)
+    active bool;
+}
+`)))
+	require.NoError(t, err)
+	res := compiled.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	fields := res.Tree.Packages["users"].Structures[0].Fields
+	require.Equal(t, uint64(64), fields[0].Constraints.MaxLength)
+	require.Equal(t, &ast.Constraints{Min: uint64(0), Max: uint64(150)}, fields[1].Constraints)
+	require.Equal(t, uint64(18), fields[1].Default)
+	require.Equal(t, true, fields[2].Default)
+
+	for decl, msg := range map[string]string{
+		`@default(10) name string;`:   `@default of field name cannot be an integer`,
+		`@default(true) age int32;`:   `@default of field age cannot be a boolean`,
+		`@max_length(0) name string;`: `invalid @max_length "0" for field name: expected a positive integer`,
+	} {
+		compiled, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := compiled.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
 }
 
 func TestServiceReopenIdenticalPasses(t *testing.T) {
@@ -133,7 +227,7 @@ func TestServiceReopenIdenticalPasses(t *testing.T) {
 	require.Empty(t, errs)
 	files := map[string]*ast.File{"": fe}
 	require.NoError(t, validatePhase1(files, ""))
-	require.NoError(t, validatePhase2(files, ""))
+	require.NoError(t, validatePhase2(files, "", nil))
 	require.NoError(t, validatePhase3(files, ""))
 }
 
@@ -168,3 +262,2716 @@ func TestRejectsUnaryOutputAndOutputStream(t *testing.T) {
 	err := validatePhase1(map[string]*ast.File{"": fe}, "")
 	require.Error(t, err)
 }
+
+func TestRepeatedAnnotations(t *testing.T) {
+	src := `package p; struct S{} @tag("a") @tag("b") service X{ M(i S); } @tag("c") service X{ N(i S); }`
+	tokens, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	fe, errs := parse("", tokens, nil)
+	require.Empty(t, errs)
+	require.Len(t, fe.Services, 1)
+
+	svc := fe.Services[0]
+	require.Equal(t, "a", svc.Annotations.ByName("tag").Arguments[0])
+	tags := svc.Annotations.AllByName("tag")
+	require.Len(t, tags, 3)
+	for i, v := range []string{"a", "b", "c"} {
+		require.Equal(t, v, tags[i].Arguments[0])
+	}
+	require.Empty(t, svc.Annotations.AllByName("missing"))
+}
+
+func TestAnnotationReferences(t *testing.T) {
+	src := `package p;
+enum RetryPolicy { LINEAR = 0; EXPONENTIAL = 1; }
+struct S{}
+service X{
+	@retry(policy = RetryPolicy.EXPONENTIAL, "fallback", p.RetryPolicy.LINEAR)
+	M(i S);
+}`
+	tokens, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	fe, errs := parse("", tokens, nil)
+	require.Empty(t, errs)
+	require.NoError(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil))
+
+	ann := fe.Services[0].Methods[0].Annotations.ByName("retry")
+	require.NotNil(t, ann)
+	require.Len(t, ann.NamedArguments, 1)
+	require.Equal(t, "policy", ann.NamedArguments[0].Name)
+	ref := ann.NamedArguments[0].Value.(*ast.AnnotationReference)
+	member, ok := ref.Resolved().(*ast.EnumMember)
+	require.True(t, ok)
+	require.Equal(t, "EXPONENTIAL", member.Name)
+
+	require.Len(t, ann.Arguments, 2)
+	require.Equal(t, "fallback", ann.Arguments[0])
+	require.Equal(t, "LINEAR", ann.Arguments[1].(*ast.AnnotationReference).Resolved().(*ast.EnumMember).Name)
+
+	bad := []string{
+		`package p; enum E { A = 0; } @x(v = E.B) struct S{}`,
+		`package p; struct T{} @x(v = T.A) struct S{}`,
+		`package p; @x(Missing) struct S{}`,
+	}
+	for _, src := range bad {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.Error(t, validatePhase2(map[string]*ast.File{"": fe}, "", nil), src)
+	}
+}
+
+func TestNamespacedAnnotations(t *testing.T) {
+	good := []string{
+		`package p; @arf.deprecated @go.package("x/y") struct S{ @ts.name("f") f string; }`,
+		`package p; enum E { @arf.deprecated A = 0; }`,
+		`package p; struct S{} @java.outer_class("X") service X{ @custom.thing M(i S); }`,
+	}
+	bad := []string{
+		`package p; @arf.unknown struct S{}`,
+		`package p; struct S{ @arf.nope f string; }`,
+		`package p; enum E { @arf.nope A = 0; }`,
+		`package p; struct S{} service X{ @arf.nope M(i S); }`,
+	}
+	for _, src := range good {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.NoError(t, validatePhase1(map[string]*ast.File{"": fe}, ""), src)
+	}
+	for _, src := range bad {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.Error(t, validatePhase1(map[string]*ast.File{"": fe}, ""), src)
+	}
+
+	a := &ast.Annotation{Name: "go.package"}
+	require.Equal(t, "go", a.Namespace())
+	require.Equal(t, "package", a.LocalName())
+}
+
+func TestWireNameCollisions(t *testing.T) {
+	good := []string{
+		`package p; struct S{ @wire_name("userId") user_id string; name string; }`,
+		`package p; struct S{ @wire_name("a") b string; @wire_name("b") a string; }`,
+	}
+	bad := []string{
+		`package p; struct S{ @wire_name("name") user_id string; name string; }`,
+		`package p; struct S{ @wire_name("x") a string; @wire_name("x") b string; }`,
+		`package p; struct S{ @wire_name a string; }`,
+		`package p; struct S{ @wire_name("") a string; }`,
+		`package p; struct S{ @wire_name("a", "b") a string; }`,
+	}
+	for _, src := range good {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.NoError(t, validatePhase1(map[string]*ast.File{"": fe}, ""), src)
+	}
+	for _, src := range bad {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.Error(t, validatePhase1(map[string]*ast.File{"": fe}, ""), src)
+	}
+
+	tokens, _ := lexFile([]byte(good[0]), nil)
+	fe, _ := parse("", tokens, nil)
+	require.Equal(t, "userId", fe.Structs[0].Fields[0].WireName())
+	require.Equal(t, "name", fe.Structs[0].Fields[1].WireName())
+}
+
+func TestHTTPBindings(t *testing.T) {
+	prelude := `package p;
+enum Kind { A = 0; }
+struct User { id string; kind Kind; tags array<string>; }
+struct GetUser { id string; user User; }
+`
+	good := []string{
+		`service X { @http("GET", "/users/{id}") M(r GetUser); }`,
+		`service X { @http("GET", "/users/{r.user.kind}/{r.id}") M(r GetUser); }`,
+		`service X { @http("POST", "/users") M(r GetUser); }`,
+	}
+	bad := []string{
+		`service X { @http("FETCH", "/users") M(r GetUser); }`,
+		`service X { @http("GET", "users") M(r GetUser); }`,
+		`service X { @http("GET", "/users/{missing}") M(r GetUser); }`,
+		`service X { @http("GET", "/users/{r}") M(r GetUser); }`,
+		`service X { @http("GET", "/users/{user}") M(r GetUser); }`,
+		`service X { @http("GET", "/users/{user.tags}") M(r GetUser); }`,
+		`service X { @http("GET", "/users/x{id}") M(r GetUser); }`,
+		`service X { @http("GET", "/users/{id}/{id}") M(r GetUser); }`,
+		`service X { @http("GET", "/users//x") M(r GetUser); }`,
+	}
+	run := func(src string) (*ast.File, error) {
+		tokens, errs := lexFile([]byte(prelude+src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		files := map[string]*ast.File{"": fe}
+		require.NoError(t, validatePhase1(files, ""), src)
+		require.NoError(t, validatePhase2(files, "", nil), src)
+		return fe, validatePhase3(files, "")
+	}
+	for _, src := range good {
+		fe, err := run(src)
+		require.NoError(t, err, src)
+		require.NotNil(t, fe.Services[0].Methods[0].HTTP, src)
+	}
+	for _, src := range bad {
+		_, err := run(src)
+		require.Error(t, err, src)
+	}
+
+	fe, err := run(good[1])
+	require.NoError(t, err)
+	binding := fe.Services[0].Methods[0].HTTP
+	require.Equal(t, "GET", binding.Method)
+	require.Len(t, binding.Segments, 3)
+	require.Equal(t, "users", binding.Segments[0].Literal)
+	require.Equal(t, []string{"r", "user", "kind"}, binding.Segments[1].Variable)
+	require.Equal(t, "kind", binding.Segments[1].Field.Name)
+}
+
+func TestMethodSafetyMarkers(t *testing.T) {
+	run := func(src string) (*ast.File, error) {
+		tokens, errs := lexFile([]byte("package p; struct S{ id string; } "+src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		files := map[string]*ast.File{"": fe}
+		require.NoError(t, validatePhase1(files, ""), src)
+		require.NoError(t, validatePhase2(files, "", nil), src)
+		return fe, validatePhase3(files, "")
+	}
+
+	fe, err := run(`service X { @idempotent A(i S); @readonly @http("GET", "/s/{id}") B(i S); C(i S); }`)
+	require.NoError(t, err)
+	methods := fe.Services[0].Methods
+	require.True(t, methods[0].Idempotent)
+	require.False(t, methods[0].ReadOnly)
+	require.True(t, methods[1].Idempotent)
+	require.True(t, methods[1].ReadOnly)
+	require.False(t, methods[2].Idempotent)
+	require.False(t, methods[2].ReadOnly)
+
+	bad := []string{
+		`service X { @readonly @http("POST", "/s") A(i S); }`,
+	}
+	for _, src := range bad {
+		_, err := run(src)
+		require.Error(t, err, src)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	src := `package p; struct S{} @timeout("30s") service X{ @timeout("1m500ms") A(i S); B(i S); }`
+	tokens, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	fe, errs := parse("", tokens, nil)
+	require.Empty(t, errs)
+	require.NoError(t, validatePhase1(map[string]*ast.File{"": fe}, ""))
+
+	svc := fe.Services[0]
+	require.Equal(t, 30*time.Second, svc.Timeout)
+	require.Equal(t, time.Minute+500*time.Millisecond, svc.Methods[0].EffectiveTimeout())
+	require.Equal(t, time.Duration(0), svc.Methods[1].Timeout)
+	require.Equal(t, 30*time.Second, svc.Methods[1].EffectiveTimeout())
+
+	bad := []string{
+		`package p; struct S{} service X{ @timeout("soon") A(i S); }`,
+		`package p; struct S{} service X{ @timeout("-1s") A(i S); }`,
+		`package p; struct S{} service X{ @timeout A(i S); }`,
+		`package p; struct S{} @timeout("1s") service X{ A(i S); } @timeout("2s") service X{ B(i S); }`,
+	}
+	for _, src := range bad {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		require.Error(t, validatePhase1(map[string]*ast.File{"": fe}, ""), src)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	run := func(src string) (*ast.File, error) {
+		tokens, errs := lexFile([]byte("package p; struct S{} enum ErrorCode { NOT_FOUND = 1; RATE_LIMITED = 2; } enum Other { A = 0; } "+src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		files := map[string]*ast.File{"": fe}
+		require.NoError(t, validatePhase1(files, ""), src)
+		require.NoError(t, validatePhase2(files, "", nil), src)
+		return fe, validatePhase3(files, "")
+	}
+
+	fe, err := run(`@errors(ErrorCode) service X { @errors(ErrorCode.NOT_FOUND) A(i S); B(i S); }`)
+	require.NoError(t, err)
+	svc := fe.Services[0]
+	require.Equal(t, "ErrorCode", svc.Errors.Name)
+	require.Len(t, svc.Methods[0].EffectiveErrorCodes(), 1)
+	require.Equal(t, "NOT_FOUND", svc.Methods[0].ErrorCodes[0].Name)
+	require.Len(t, svc.Methods[1].EffectiveErrorCodes(), 2)
+
+	bad := []string{
+		`@errors(S) service X { A(i S); }`,
+		`@errors(ErrorCode, Other) service X { A(i S); }`,
+		`service X { @errors(ErrorCode.NOT_FOUND) A(i S); }`,
+		`@errors(ErrorCode) service X { @errors(Other.A) A(i S); }`,
+		`@errors(ErrorCode) service X { @errors(ErrorCode.NOT_FOUND, ErrorCode.NOT_FOUND) A(i S); }`,
+	}
+	for _, src := range bad {
+		_, err := run(src)
+		require.Error(t, err, src)
+	}
+}
+
+func TestBuiltinAnnotationArguments(t *testing.T) {
+	validate := func(src string) error {
+		tokens, errs := lexFile([]byte("package p; struct S{ id string; } enum E { A = 0; } "+src), nil)
+		require.Empty(t, errs, src)
+		fe, errs := parse("", tokens, nil)
+		require.Empty(t, errs, src)
+		return validatePhase1(map[string]*ast.File{"": fe}, "")
+	}
+
+	good := []string{
+		`@errors(E) service X { @errors(E.A) @timeout(5s) @idempotent A(i S); }`,
+		`@arf.deprecated struct T { @wire_name("i") @max_length("4") id string; }`,
+		`@arf.deprecated("use S") struct T { @default(b"x") @placeholder id bytes; }`,
+		`struct T { @wire_name(name = "t") t string; }`,
+		`service X { @http("GET", path = "/s") A(i S); }`,
+	}
+	for _, src := range good {
+		require.NoError(t, validate(src), src)
+	}
+
+	bad := map[string]string{
+		`service X { @http("GET") A(i S); }`:                   `@http expects 2 arguments, got 1; for example, @http("GET", "/users/{id}")`,
+		`service X { @http("GET", "/s", "/t") A(i S); }`:       `@http expects 2 arguments, got 3`,
+		`service X { @idempotent("yes") A(i S); }`:             `@idempotent does not take arguments`,
+		`service X { @timeout(2024-01-01T00:00:00Z) A(i S); }`: `argument 1 of @timeout must be a string or a duration, got a timestamp; for example, @timeout(5s)`,
+		`@errors service X { A(i S); }`:                        `@errors expects at least 1 argument, got 0`,
+		`@errors("E") service X { A(i S); }`:                   `argument 1 of @errors must be a reference, got a string`,
+		`struct T { @wire_name(label="t") t string; }`:         `@wire_name has no argument named label`,
+		`service X { @http("GET", method = "POST") A(i S); }`:  `argument method of @http is already passed by position`,
+		`service X { @http(path = "/s") A(i S); }`:             `@http requires argument method`,
+		`@errors(codes = E.A) service X { A(i S); }`:           `argument codes of @errors may be repeated, and cannot be named`,
+		`struct T { @max_length(64s) t string; }`:              `argument 1 of @max_length must be a string or an integer, got a duration`,
+		`@arf.deprecated("a", "b") struct T {}`:                `@arf.deprecated expects at most 1 argument, got 2`,
+		`enum F { @placeholder(x"00") A = 0; }`:                `@placeholder does not take arguments`,
+	}
+	for src, msg := range bad {
+		err := validate(src)
+		require.Error(t, err, src)
+		require.Contains(t, err.Error(), msg, src)
+	}
+}
+
+func TestLanguageTags(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    @go.tag("json:\"user_id,omitempty\" db:\"id\"")
+    @ts.name("userId")
+    user_id string;
+    name string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	fields := res.Tree.Packages["users"].Structures[0].Fields
+	require.Equal(t, "user_id,omitempty", fields[0].GoTag().Get("json"))
+	require.Equal(t, "id", fields[0].GoTag().Get("db"))
+	require.Equal(t, "userId", fields[0].TSName())
+	require.Empty(t, fields[1].GoTag())
+	require.Equal(t, "name", fields[1].TSName())
+
+	bad := map[string]string{
+		`@go.tag("json")`:                  `invalid @go.tag "json": expected key:"value" pairs separated by spaces`,
+		`@go.tag("json:user_id")`:          `expected key:"value" pairs separated by spaces`,
+		`@go.tag("json:\"id")`:             `unterminated value of key json`,
+		`@go.tag("json:\"a\"db:\"b\"")`:    `expected a space after the value of key json`,
+		`@go.tag("json:\"a\" json:\"b\"")`: `duplicate key json`,
+		`@go.tag("")`:                      `invalid @go.tag "": tag is empty`,
+		`@ts.name("user-id")`:              `invalid @ts.name "user-id": name must be a valid identifier`,
+		`@ts.name("1st")`:                  `name must be a valid identifier`,
+		`@ts.name(User)`:                   `argument 1 of @ts.name must be a string, got a reference`,
+	}
+	for ann, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    "+ann+"\n    id string;\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, ann)
+		require.Contains(t, res.Errors()[0].Message, msg, ann)
+	}
+}
+
+func TestFieldConstraints(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    @max_length("255")
+    name string;
+    @range("0", "150")
+    @default("18")
+    age uint8;
+    @range("-1.5", "1.5")
+    score optional<float32>;
+    @max_length("3")
+    tags array<string>;
+    email string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	fields := res.Tree.Packages["users"].Structures[0].Fields
+	require.Equal(t, &ast.Constraints{MaxLength: 255}, fields[0].Constraints)
+	require.Equal(t, &ast.Constraints{Min: uint64(0), Max: uint64(150)}, fields[1].Constraints)
+	require.Equal(t, &ast.Constraints{Min: -1.5, Max: 1.5}, fields[2].Constraints)
+	require.Equal(t, uint64(3), fields[3].Constraints.MaxLength)
+	require.Nil(t, fields[4].Constraints)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	for i, f := range decoded.Tree.Packages["users"].Structures[0].Fields {
+		require.Equal(t, fields[i].Constraints, f.Constraints, f.Name)
+	}
+
+	bad := map[string]string{
+		`@max_length("10") id int32;`:                 `@max_length is not supported on field id of type int32`,
+		`@max_length("0") id string;`:                 `invalid @max_length "0" for field id: expected a positive integer`,
+		`@max_length("-1") id string;`:                `invalid @max_length "-1"`,
+		`@range("0", "10") id string;`:                `@range is not supported on field id: only integers and floats have a range`,
+		`@range("0", "300") id uint8;`:                `invalid @range max "300" for field id of type uint8: value out of range`,
+		`@range("-1", "10") id uint32;`:               `invalid @range min "-1"`,
+		`@range("10", "1") id int32;`:                 `min 10 is greater than max 1`,
+		`@range("0") id int32;`:                       `@range expects 2 arguments, got 1`,
+		`@range(1s, "10") id int32;`:                  `argument 1 of @range must be a string`,
+		`@range("1", "10") @default("20") id int32;`:  `@default of field id is outside of its @range`,
+		`@max_length("2") @default("abc") id string;`: `@default of field id is longer than its @max_length of 2`,
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestStructMaxSize(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package geo;
+
+@max_size(11)
+struct Point {
+    x float32;
+    y float32;
+}
+
+@max_size("64")
+struct Place {
+    @max_length(32)
+    name string;
+    point Point;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+
+	bad := map[string]string{
+		"@max_size(10) struct Point { x float32; y float32; }": "struct Point exceeds its @max_size of 10 bytes, as it may take up to 11 bytes",
+		"@max_size(64) struct User { name string; }":           "struct User exceeds its @max_size of 64 bytes, as its size is unbounded; bound its strings, bytes and collections through @max_length",
+		"@max_size(0) struct User {}":                          `invalid @max_size "0" for struct User: expected a positive number of bytes`,
+		"struct User { @max_size(64) name string; }":           "@max_size",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package geo;\n\n"+decl+"\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+    address Address;
+
+    struct Address {
+        street string;
+        kind Kind;
+
+        enum Kind {
+            HOME = 0;
+            WORK = 1;
+        }
+    }
+}
+
+enum Role {
+    ADMIN = 0;
+}
+
+service Users {
+    Get(user User) -> User;
+    Watch(user User) -> stream User;
+    Upload(stream User);
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+
+	stats := res.Tree.Stats()
+	expected := ast.Stats{
+		Files:            1,
+		Structs:          2,
+		Enums:            2,
+		Fields:           4,
+		Services:         1,
+		Methods:          3,
+		StreamingMethods: 2,
+		MaxDepth:         3,
+	}
+	require.Equal(t, 1, stats.Packages)
+	require.Equal(t, expected, stats.Stats)
+	require.Equal(t, map[string]ast.Stats{"users": expected}, stats.ByPackage)
+	require.Equal(t, 4, stats.Types())
+	require.Equal(t, &ast.TreeStats{ByPackage: map[string]ast.Stats{}}, (&ast.Tree{}).Stats())
+}
+
+func TestStability(t *testing.T) {
+	src := `package users;
+
+@stability("experimental")
+struct Preview {
+    enabled bool;
+}
+
+struct Settings {
+    preview optional<Preview>;
+}
+
+struct User {
+    id int64;
+    settings Settings;
+}
+
+@stability("stable")
+service Users {
+    Get(user User) -> User;
+    @stability("beta")
+    Try(user User) -> Preview;
+}
+
+service Labs {
+    Try(user User) -> Preview;
+}
+`
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.Len(t, res.Errors(), 1, res.String())
+	require.Equal(t, CodeUnstableExposure, res.Errors()[0].Code)
+	require.Equal(t, "stable method Users.Get exposes experimental struct users.Preview through User.settings.preview", res.Errors()[0].Message)
+	require.Equal(t, 19, res.Errors()[0].Position.Line)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithSeverity(CodeUnstableExposure, SeverityOff))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+	require.Equal(t, ast.StabilityExperimental, ast.StabilityOf(pkg.FindStruct("Preview")))
+	require.Equal(t, ast.StabilityUnspecified, ast.StabilityOf(pkg.FindStruct("User")))
+	require.Equal(t, ast.StabilityStable, ast.StabilityOf(pkg.FindService("Users").Methods[0]))
+	require.Equal(t, ast.StabilityBeta, ast.StabilityOf(pkg.FindService("Users").Methods[1]))
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n@stability(\"alpha\")\nstruct User {\n    id int64;\n}\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, `invalid @stability "alpha": expected one of experimental, beta, stable`, res.Errors()[0].Message)
+}
+
+func TestReopenedStructs(t *testing.T) {
+	fe, err := New("fixtures/reopen/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+
+	pkg := res.Tree.Packages["accounts"]
+	require.Len(t, pkg.Structures, 2)
+	user := pkg.FindStruct("User")
+	require.Nil(t, user.Reopens)
+	require.Equal(t, []string{"id", "name", "avatar"}, mapFn(user.Fields, func(f *ast.StructField) string { return f.Name }))
+	avatar := user.Fields[2].Type.(*ast.OptionalType).Type.(ast.ResolvableType)
+	require.Equal(t, pkg.FindStruct("Avatar"), avatar.Resolved())
+	require.Same(t, user, res.Tree.Packages["accounts"].FindService("Users").Methods[0].Returns[0].Type.(ast.ResolvableType).Resolved())
+
+	profile, err := filepath.Abs("fixtures/reopen/profile.arf")
+	require.NoError(t, err)
+	var reopening *ast.Struct
+	for _, f := range pkg.Files {
+		if f.Path == profile {
+			reopening = f.Structs[0]
+		}
+	}
+	require.Same(t, user, reopening.Reopens)
+	require.Same(t, user, reopening.Original())
+	require.Len(t, reopening.Fields, 1)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	decodedUser := decoded.Tree.Packages["accounts"].FindStruct("User")
+	require.Len(t, decoded.Tree.Packages["accounts"].Structures, 2)
+	require.Equal(t, []string{"id", "name", "avatar"}, mapFn(decodedUser.Fields, func(f *ast.StructField) string { return f.Name }))
+
+	fe, err = New("fixtures/reopen/conflict.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1, res.String())
+	require.Contains(t, res.Errors()[0].Message, "avatar is already defined for User at ")
+	require.Contains(t, res.Errors()[0].Message, "conflict.arf, line 7, column 5")
+	require.Equal(t, profile, res.Errors()[0].Position.Filename)
+
+	fe, err = New("fixtures/reopen/annotated.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 2, res.String())
+	require.Contains(t, res.Errors()[0].Message, "annotations of struct User must be declared by its original declaration at ")
+	require.Contains(t, res.Errors()[1].Message, "enum Kind must be declared by the original declaration of User at ")
+
+	fe, err = New("fixtures/reopen/wire.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1, res.String())
+	require.Equal(t, CodeWireNameCollision, res.Errors()[0].Code)
+	require.Contains(t, res.Errors()[0].Message, "wire name avatar of field avatar collides with field picture at ")
+}
+
+func TestEmptyReturns(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+}
+
+service Users {
+    Delete(user User) -> empty;
+    Forget(user User) -> ();
+    Touch(user User);
+    Get(user User) -> User;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	methods := res.Tree.Packages["users"].FindService("Users").Methods
+	for _, m := range methods[:2] {
+		require.Len(t, m.Returns, 1, m.Name)
+		require.IsType(t, &ast.EmptyType{}, m.Returns[0].Type, m.Name)
+		require.True(t, m.ReturnsNothing(), m.Name)
+	}
+	require.Empty(t, methods[2].Returns)
+	require.True(t, methods[2].ReturnsNothing())
+	require.False(t, methods[3].ReturnsNothing())
+	require.Equal(t, 26, methods[1].Returns[0].Position.Column)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	require.IsType(t, &ast.EmptyType{}, decoded.Tree.Packages["users"].FindService("Users").Methods[0].Returns[0].Type)
+
+	bad := map[string]string{
+		`Delete(user User) -> (empty, User);`: `empty cannot be returned along with other types`,
+		`Delete(user User) -> stream empty;`:  `empty cannot be streamed`,
+		`Delete(user empty) -> User;`:         `empty may only be used as the single return of a method`,
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    id int64;\n}\n\nservice Users {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    nothing empty;\n}\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "empty may only be used as the single return of a method", res.Errors()[0].Message)
+}
+
+func TestFieldIndices(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64 = 3;
+    name string = 0x10;
+    email optional<string> = 1_000;
+}
+
+struct Group {
+    id int64;
+    name string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+	user := pkg.FindStruct("User")
+	for i, index := range []int{3, 16, 1000} {
+		require.True(t, user.Fields[i].IndexDeclared)
+		require.Equal(t, index, user.Fields[i].Index)
+	}
+	group := pkg.FindStruct("Group")
+	require.False(t, group.Fields[1].IndexDeclared)
+	require.Equal(t, 1, group.Fields[1].Index)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	field := decoded.Tree.Packages["users"].FindStruct("User").Fields[1]
+	require.True(t, field.IndexDeclared)
+	require.Equal(t, 16, field.Index)
+
+	bad := map[string]string{
+		"id int64 = 1;\n    name string;":     "field name declares no index, while other fields of User do; declare an index for every field, or none",
+		"id int64 = 1;\n    name string = 1;": "index 1 of field name is already used by field id at line 4, column 5",
+		"id int64 = name;":                    "Expected field index, such as id int64 = 1, but got name: the equal sign declares the index of a field; declare its default through @default(name) instead",
+		"id int64 = 0xFFFFFFFFFF;":            "Invalid index 0xFFFFFFFFFF of field id: value out of range",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.True(t, res.HasErrors(), decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestUnions(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+    # How to reach the user
+    union contact {
+        email string;
+        phone string;
+        address struct {
+            city string;
+        }
+    }
+    name string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	user := res.Tree.Packages["users"].FindStruct("User")
+	require.Len(t, user.Unions, 1)
+	contact := user.Unions[0]
+	require.Equal(t, "contact", contact.Name)
+	require.Equal(t, "users.User.contact", contact.FQN())
+	require.Equal(t, []string{" How to reach the user"}, contact.Comment)
+	require.Len(t, contact.Fields, 3)
+	var names []string
+	for i, f := range user.Fields {
+		names = append(names, f.Name)
+		require.Equal(t, i, f.Index)
+	}
+	require.Equal(t, []string{"id", "email", "phone", "address", "name"}, names)
+	require.Same(t, contact, user.Fields[1].Union)
+	require.Nil(t, user.Fields[4].Union)
+	require.NotNil(t, user.FindStruct("Address"))
+	require.Same(t, user.FindStruct("Address"), contact.Fields[2].Type.(ast.ResolvableType).Resolved())
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	user = decoded.Tree.Packages["users"].FindStruct("User")
+	require.Len(t, user.Unions, 1)
+	require.Len(t, user.Unions[0].Fields, 3)
+	require.Same(t, user.Unions[0], user.Fields[2].Union)
+
+	bad := map[string]string{
+		"email string;\n    union contact {\n        email string;\n    }":   "email is already defined for User at line 4, column 5",
+		"contact string;\n    union contact {\n        email string;\n    }": "contact is already defined for User at line 4, column 5",
+		"union contact {\n        email optional<string>;\n    }":            "member email of union contact cannot be optional",
+		"union contact {\n    }":                         "union contact of User declares no members",
+		"union Contact {\n        email string;\n    }":  "Invalid union name Contact, expected snake_case",
+		"union contact {\n        union other {}\n    }": "Invalid union declaration: Unions cannot be declared inside unions",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.True(t, res.HasErrors(), decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestConsts(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+# Largest page served
+const MAX_PAGE_SIZE uint32 = DEFAULT_PAGE_SIZE * 4;
+const DEFAULT_PAGE_SIZE uint32 = 25; # default
+const MIN_BALANCE int64 = -0x10;
+const RATIO float64 = "1.5";
+const SCALE float64 = -2.5e-3;
+const HALF float64 = 0.5;
+const MAX_ID uint64 = 18446744073709551615;
+const GREETING string = "hello";
+const ENABLED bool = true;
+const MAGIC bytes = x"89 50";
+const EPOCH timestamp = 2024-01-01T00:00:00Z;
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+	require.Len(t, pkg.Consts, 11)
+	maxPage := pkg.FindConst("MAX_PAGE_SIZE")
+	require.Equal(t, uint64(100), maxPage.Value)
+	require.Equal(t, "users.MAX_PAGE_SIZE", maxPage.FQN())
+	require.Equal(t, []string{" Largest page served"}, maxPage.Comment)
+	require.Same(t, pkg.FindConst("DEFAULT_PAGE_SIZE"), maxPage.Expr.(*ast.BinaryExpr).X.(*ast.ConstRef).Resolved)
+	require.Equal(t, " default", pkg.FindConst("DEFAULT_PAGE_SIZE").TrailingComment)
+	require.Equal(t, int64(-16), pkg.FindConst("MIN_BALANCE").Value)
+	require.Equal(t, 1.5, pkg.FindConst("RATIO").Value)
+	require.Equal(t, -2.5e-3, pkg.FindConst("SCALE").Value)
+	require.Equal(t, 0.5, pkg.FindConst("HALF").Value)
+	require.Equal(t, uint64(math.MaxUint64), pkg.FindConst("MAX_ID").Value)
+	require.Equal(t, "hello", pkg.FindConst("GREETING").Value)
+	require.Equal(t, true, pkg.FindConst("ENABLED").Value)
+	require.Equal(t, []byte{0x89, 0x50}, pkg.FindConst("MAGIC").Value)
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), pkg.FindConst("EPOCH").Value)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	decodedMax := decoded.Tree.Packages["users"].FindConst("MAX_PAGE_SIZE")
+	require.Equal(t, uint64(100), decodedMax.Value)
+	require.Same(t, decoded.Tree.Packages["users"].FindConst("DEFAULT_PAGE_SIZE"), decodedMax.Expr.(*ast.BinaryExpr).X.(*ast.ConstRef).Resolved)
+	require.True(t, decoded.Tree.Packages["users"].FindConst("MAX_ID").Expr.(*ast.IntLiteral).Unsigned)
+
+	// Constants declared in imported files are referenced by qualified name
+	fe, err = New("fixtures/consts/main.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	orders := res.Tree.Packages["orders"]
+	require.Equal(t, uint64(100), orders.FindConst("LIMIT").Value)
+	require.Equal(t, uint64(6), orders.FindConst("PAGE").Value)
+	require.Same(t, res.Tree.Packages["shared.limits"].FindConst("MAX"), orders.FindConst("LIMIT").Expr.(*ast.BinaryExpr).X.(*ast.ConstRef).Resolved)
+
+	// Years followed by a dash are only timestamps when a month and a day
+	// follow
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package years;\n\nconst BASE int32 = 2024-1;\n\nenum Offset {\n    A = 1000-1;\n    B = 1000 - 2;\n}\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Equal(t, int64(2023), res.Tree.Packages["years"].FindConst("BASE").Value)
+	require.Equal(t, 999, res.Tree.Packages["years"].FindEnum("Offset").Members[0].Value)
+
+	bad := map[string]string{
+		"const LIMIT uint8 = 300;":                              "Constant LIMIT value 300 overflows uint8",
+		"const LIMIT int64 = 18446744073709551615;":             "overflows int64",
+		"const LIMIT uint32 = 1.5;":                             "Constant LIMIT of type uint32 cannot hold a floating-point number",
+		"const LIMIT uint32 = other.MAX;":                       "Undefined constant other.MAX",
+		"const LIMIT uint32 = 1;\nconst LIMIT uint32 = 2;":      "LIMIT is already defined at",
+		"const LIMIT uint32 = OTHER;":                           "Undefined constant OTHER",
+		"const LIMIT uint32 = LIMIT + 1;":                       "Constant LIMIT is defined in terms of itself",
+		"const NAME string = 1;":                                "Constant NAME of type string cannot hold an integer",
+		"const LIMIT uint32 = \"10\";":                          "Constant LIMIT of type uint32 cannot hold a string",
+		"const NAME string = \"a\";\nconst LIMIT int32 = NAME;": "Constant NAME of type string is not an integer",
+		"const LIMIT optional<int32> = 1;":                      "Constant LIMIT must be of a primitive type",
+		"const limit int32 = 1;":                                "Invalid constant name limit, expected SCREAMING_SNAKE_CASE",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n"+decl+"\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestExplicitEnumValues(t *testing.T) {
+	src := "package states;\n\nenum State {\n    ERROR = -1;\n    UNKNOWN;\n    ACTIVE = 1;\n}\n"
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.NoError(t, res.Err())
+	var values []int
+	for _, m := range res.Tree.Packages["states"].Enums[0].Members {
+		values = append(values, m.Value)
+	}
+	require.Equal(t, []int{-1, 0, 1}, values)
+
+	fe, err = New(StdinEntrypoint, WithExplicitEnumValues(), WithStdin(strings.NewReader(src)))
+	require.NoError(t, err)
+	var diag *Diagnostic
+	require.ErrorAs(t, fe.Compile().Err(), &diag)
+	require.Equal(t, CodeImplicitEnumValue, diag.Code)
+	require.Equal(t, "enum member UNKNOWN of State must declare its value, such as UNKNOWN = 0", diag.Message)
+	require.Len(t, diag.Fixes, 1)
+	fixed, err := ApplyEdits([]byte(src), diag.Fixes[0].Edits)
+	require.NoError(t, err)
+	require.Contains(t, string(fixed), "    UNKNOWN = 0;\n")
+}
+
+func TestReserved(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    reserved 1, 0x4;
+    reserved "nickname", "old_name";
+    id int64 = 0;
+    reserved string = 2;
+}
+
+enum Status {
+    reserved -1, 3;
+    reserved "DELETED";
+    ACTIVE = 1;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+	user := pkg.FindStruct("User")
+	require.Len(t, user.Reserved, 2)
+	require.Equal(t, []int{1, 4}, user.Reserved[0].Indices)
+	require.Equal(t, []string{"nickname", "old_name"}, user.Reserved[1].Names)
+	require.Equal(t, "reserved", user.Fields[1].Name)
+	status := pkg.FindEnum("Status")
+	require.Equal(t, []int{-1, 3}, status.Reserved[0].Indices)
+	require.Equal(t, []string{"DELETED"}, status.Reserved[1].Names)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	require.Equal(t, user.Reserved[1].Names, decoded.Tree.Packages["users"].FindStruct("User").Reserved[1].Names)
+	require.Equal(t, status.Reserved[0].Indices, decoded.Tree.Packages["users"].FindEnum("Status").Reserved[0].Indices)
+
+	bad := map[string]string{
+		"struct User {\n    reserved 1;\n    id int64 = 1;\n}":               "index 1 of field id is reserved at line 4, column 5",
+		"struct User {\n    reserved 1;\n    id int64;\n    name string;\n}": "field name takes index 1 by position, which is reserved at line 4, column 5",
+		"struct User {\n    reserved \"name\";\n    name string;\n}":         "field name name is reserved at line 4, column 5",
+		"struct User {\n    reserved 1, \"name\";\n}":                        "Reserved indices and names cannot be mixed; declare them by separate reserved statements",
+		"struct User {\n    reserved -1;\n    id int64;\n}":                  "reserved index -1 of User cannot be negative",
+		"enum Status {\n    reserved 0;\n    ACTIVE;\n}":                     "value 0 of enum member ACTIVE is reserved at line 4, column 5",
+		"enum Status {\n    reserved \"ACTIVE\";\n    ACTIVE = 1;\n}":        "enum member name ACTIVE is reserved at line 4, column 5",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n"+decl+"\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.True(t, res.HasErrors(), decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestExtends(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+    name string;
+}
+
+struct Admin extends User {
+    role string;
+}
+
+struct SuperAdmin extends users.Admin {
+    scopes array<string>;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+	admin := pkg.FindStruct("SuperAdmin").Base()
+	require.Same(t, pkg.FindStruct("Admin"), admin)
+	require.Same(t, pkg.FindStruct("User"), admin.Base())
+	var names []string
+	for i, f := range pkg.FindStruct("SuperAdmin").AllFields() {
+		names = append(names, f.Name)
+		require.Equal(t, i, f.Index, f.Name)
+	}
+	require.Equal(t, []string{"id", "name", "role", "scopes"}, names)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	decodedPkg := decoded.Tree.Packages["users"]
+	require.Same(t, decodedPkg.FindStruct("User"), decodedPkg.FindStruct("Admin").Base())
+
+	// Fields without an index follow the highest inherited one
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct Base {
+    id int64 = 1;
+    name string = 2;
+}
+
+struct Admin extends Base {
+    level int32;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Equal(t, 3, res.Tree.Packages["users"].FindStruct("Admin").Fields[0].Index)
+
+	bad := map[string]string{
+		"struct User extends User {\n    id int64;\n}":                                                                "struct User extends itself through User extends User",
+		"struct A extends B {\n    id int64;\n}\n\nstruct B extends A {\n    name string;\n}":                         "struct A extends itself through A extends B extends A",
+		"struct User {\n    id int64;\n}\n\nstruct Admin extends User {\n    id string;\n}":                           "field id of Admin shadows field id inherited from User at line 4, column 5",
+		"struct User {\n    id int64 = 1;\n}\n\nstruct Admin extends User {\n    role string = 1;\n}":                 "index 1 of field role is already used by field id inherited from User at line 4, column 5",
+		"struct User {\n    reserved \"role\";\n    id int64;\n}\n\nstruct Admin extends User {\n    role string;\n}": "field name role is reserved at line 4, column 5",
+		"enum Role {\n    ADMIN = 1;\n}\n\nstruct Admin extends Role {\n    id int64;\n}":                             "struct Admin can only extend another struct, but users.Role is an enum",
+		"struct Admin extends Missing {\n    id int64;\n}":                                                            "Undefined type Missing",
+		"struct Admin extends array<User> {\n    id int64;\n}":                                                        "Struct Admin can only extend another struct, such as struct Admin extends User, but got array<User>",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n"+decl+"\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.True(t, res.HasErrors(), decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestUUIDDurationAndDecimalPrimitives(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package payments;
+
+const DEFAULT_TIMEOUT duration = 30s;
+const MERCHANT uuid = "123E4567-E89B-12D3-A456-426614174000";
+const FEE decimal128 = "0.25";
+
+struct Payment {
+    @default("00000000-0000-0000-0000-000000000000")
+    id uuid;
+    @default("10.00")
+    amount decimal128;
+    @default(1m30s)
+    duration duration;
+    refunds map<uuid, array<decimal128>>;
+    expires_in optional<duration>;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["payments"]
+	require.Equal(t, 30*time.Second, pkg.FindConst("DEFAULT_TIMEOUT").Value)
+	require.Equal(t, "123e4567-e89b-12d3-a456-426614174000", pkg.FindConst("MERCHANT").Value)
+	require.Equal(t, "0.25", pkg.FindConst("FEE").Value)
+	payment := pkg.FindStruct("Payment")
+	require.Equal(t, "00000000-0000-0000-0000-000000000000", payment.Fields[0].Default)
+	require.Equal(t, "10.00", payment.Fields[1].Default)
+	require.Equal(t, 90*time.Second, payment.Fields[2].Default)
+	require.Equal(t, "duration", payment.Fields[2].Type.(*ast.PrimitiveType).Name)
+
+	bad := map[string]string{
+		`@default("1234") id uuid;`:                                           `invalid @default "1234" for field id: expected a UUID`,
+		`@default("1.2.3") amount decimal128;`:                                `invalid @default "1.2.3" for field amount: expected a decimal`,
+		`@default("12345678901234567890.123456789012345") amount decimal128;`: `decimal128 holds at most 34 significant digits`,
+		`@default(5s) amount decimal128;`:                                     `@default of field amount cannot be a duration`,
+		`@default("soon") timeout duration;`:                                  `invalid @default "soon" for field timeout`,
+		`@max_length("10") id uuid;`:                                          `@max_length is not supported on field id of type uuid`,
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package payments;\n\nstruct Payment {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestFlagEnums(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package files;
+
+enum flags Permissions {
+    NONE = 0;
+    READ = 1;
+    WRITE = 2;
+    READ_WRITE = READ | WRITE;
+    EXECUTE = 1 << 2;
+}
+
+enum Mode {
+    PRIVATE = 1;
+    SHARED = 3;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["files"]
+	perms := pkg.FindEnum("Permissions")
+	require.True(t, perms.Flags)
+	require.Equal(t, 3, perms.FindMember("READ_WRITE").Value)
+	require.False(t, pkg.FindEnum("Mode").Flags)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	require.True(t, decoded.Tree.Packages["files"].FindEnum("Permissions").Flags)
+
+	// Implicit members take the next bit rather than combining previous ones
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(`package files;
+
+enum flags Access {
+    NONE;
+    A;
+    B;
+    AB = A | B;
+    C;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	access := res.Tree.Packages["files"].FindEnum("Access")
+	var values []int
+	for _, m := range access.Members {
+		values = append(values, m.Value)
+	}
+	require.Equal(t, []int{0, 1, 2, 3, 4}, values)
+
+	bad := map[string]string{
+		"READ = 1;\n    WRITE = 3;":               "Member WRITE of flags enum Permissions has value 3, which is neither a power of two nor a combination of the members declared before it",
+		"READ = 1;\n    ALL = 7;\n    WRITE = 2;": "Member ALL of flags enum Permissions has value 7",
+		"READ = 1;\n    WRITE = 1;":               "Enum member WRITE has value 1, already used by READ",
+		"READ = 1;\n    INVALID = -1;":            "Member INVALID of flags enum Permissions cannot have a negative value",
+	}
+	for members, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package files;\n\nenum flags Permissions {\n    "+members+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, members)
+		require.Contains(t, res.Errors()[0].Message, msg, members)
+	}
+}
+
+func TestMethodErrors(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct GetRequest {
+    id int64;
+}
+
+struct User {
+    id int64;
+}
+
+struct NotFound {
+    id int64;
+}
+
+enum RateLimited {
+    PER_USER = 1;
+    GLOBAL = 2;
+}
+
+service Users {
+    Get(r GetRequest) -> User throws (NotFound, RateLimited);
+    Delete(r GetRequest) throws NotFound;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+	get := pkg.Services[0].Methods[0]
+	require.Len(t, get.Errors, 2)
+	require.Same(t, pkg.FindStruct("NotFound"), get.Errors[0].Type.Resolved())
+	require.Same(t, pkg.FindEnum("RateLimited"), get.Errors[1].Type.Resolved())
+	require.Same(t, get, get.Errors[0].Method)
+	require.True(t, pkg.Services[0].Methods[1].ReturnsNothing())
+	require.Len(t, pkg.Services[0].Methods[1].Errors, 1)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	decodedPkg := decoded.Tree.Packages["users"]
+	require.Same(t, decodedPkg.FindEnum("RateLimited"), decodedPkg.Services[0].Methods[0].Errors[1].Type.Resolved())
+
+	bad := map[string]string{
+		"Get(r User) -> User throws (Missing);":            "Undefined type Missing",
+		"Get(r User) -> User throws (array<User>);":        "Methods can only throw structs and enums, such as throws (NotFound), but got array<User>",
+		"Get(r User) -> User throws (NotFound, NotFound);": "users.NotFound is already thrown by Get at line 12, column 33",
+	}
+	for decl, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nstruct User {\n    id int64;\n}\n\nstruct NotFound {\n    id int64;\n}\n\nservice Users {\n    "+decl+"\n}\n")))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.True(t, res.HasErrors(), decl)
+		require.Contains(t, res.Errors()[0].Message, msg, decl)
+	}
+}
+
+func TestStreamingModes(t *testing.T) {
+	src := `package p; struct S{ f string; } service X{ Unary(i S) -> S; Upload(stream S) -> S; Watch(i S) -> stream S; Chat(stream S) -> stream S; }`
+	tokens, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	fe, errs := parse("", tokens, nil)
+	require.Empty(t, errs)
+	modes := map[string][2]bool{}
+	for _, m := range fe.Services[0].Methods {
+		modes[m.Name] = [2]bool{m.ClientStreaming, m.ServerStreaming}
+	}
+	require.Equal(t, map[string][2]bool{
+		"Unary":  {false, false},
+		"Upload": {true, false},
+		"Watch":  {false, true},
+		"Chat":   {true, true},
+	}, modes)
+	require.True(t, fe.Services[0].Methods[3].Bidirectional())
+	require.False(t, fe.Services[0].Methods[2].Bidirectional())
+
+	files := map[string]*ast.File{"": fe}
+	require.NoError(t, validatePhase1(files, ""))
+	fe.Services[0].Methods[0].ServerStreaming = true
+	err := validatePhase1(files, "")
+	require.ErrorContains(t, err, "method Unary is marked with ServerStreaming true, but declares no stream return")
+}
+
+func TestNamedAnnotationArguments(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+}
+
+service Users {
+    @route(method = "POST", path = "/v1/users", retries = 3)
+    Create(u User) -> User;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	ann := res.Tree.Packages["users"].Services[0].Methods[0].Annotations.ByName("route")
+	require.Equal(t, "POST", ann.Arg("method"))
+	require.Equal(t, "/v1/users", ann.Arg("path"))
+	require.Equal(t, int64(3), ann.Arg("retries"))
+	require.Nil(t, ann.Arg("timeout"))
+	var names []string
+	for _, arg := range ann.NamedArguments {
+		names = append(names, arg.Name)
+	}
+	require.Equal(t, []string{"method", "path", "retries"}, names)
+
+	// Named arguments of built-ins are bound to their positions
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+}
+
+service Users {
+    @http(method = "POST", path = "/v1/users")
+    Create(u User) -> User;
+    @http(path = "/v1/users/{id}", method = "GET")
+    Get(u User) -> User;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	methods := res.Tree.Packages["users"].Services[0].Methods
+	require.Equal(t, "POST", methods[0].HTTP.Method)
+	require.Equal(t, "/v1/users", methods[0].HTTP.Path)
+	require.Equal(t, "GET", methods[1].HTTP.Method)
+	require.Equal(t, []any{"GET", "/v1/users/{id}"}, methods[1].Annotations.ByName("http").Arguments)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n@route(method = \"GET\", method = \"POST\")\nstruct User {\n    id int64;\n}\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "argument method of @route is already declared at line 3, column 8", res.Errors()[0].Message)
+}
+
+func TestPackageAndImportAnnotations(t *testing.T) {
+	src := `# Users service
+@go_package("example.com/users")
+@java_package("com.example.users")
+package users;
+
+@go_alias("c")
+import "common.arf";
+import "base.arf";
+
+struct User {
+    id int64;
+}
+`
+	tokens, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	f, errs := parse("users.arf", tokens, nil)
+	require.Empty(t, errs)
+	require.Equal(t, []string{" Users service"}, f.Package.Comment)
+	require.Len(t, f.Package.Annotations, 2)
+	require.Equal(t, []any{"example.com/users"}, f.Package.Annotations.ByName("go_package").Arguments)
+	require.Equal(t, "java_package", f.Package.Annotations[1].Name)
+	require.Len(t, f.Imports, 2)
+	require.Equal(t, []any{"c"}, f.Imports[0].Annotations.ByName("go_alias").Arguments)
+	require.Empty(t, f.Imports[1].Annotations)
+	require.Empty(t, f.Structs[0].Annotations)
+
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("@arf.unknown\npackage users;\n\nstruct User {\n    id int64;\n}\n")))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "unknown annotation @arf.unknown", res.Errors()[0].Message)
+}
+
+func TestRegisteredAnnotations(t *testing.T) {
+	RegisterAnnotation("route", AnnotationSpec{
+		Targets: TargetMethod,
+		Args:    []AnnotationArg{{Name: "path", Type: ArgString}},
+		Named: []AnnotationArg{
+			{Name: "method", Type: ArgString, Required: true},
+			{Name: "retries", Type: ArgInt},
+		},
+		Example: `@route("/v1/users", method = "POST")`,
+	})
+	RegisterAnnotation("java.final", AnnotationSpec{Targets: TargetStruct | TargetEnum})
+	t.Cleanup(func() {
+		delete(annotationRegistry.specs, "route")
+		delete(annotationRegistry.specs, "java.final")
+	})
+	require.Panics(t, func() { RegisterAnnotation("route", AnnotationSpec{}) })
+	require.Panics(t, func() { RegisterAnnotation("http", AnnotationSpec{}) })
+	require.Panics(t, func() { RegisterAnnotation("arf.owner", AnnotationSpec{}) })
+	require.Panics(t, func() { RegisterAnnotation("owner", AnnotationSpec{Optional: 1}) })
+
+	compile := func(src string) *Result {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)))
+		require.NoError(t, err)
+		return fe.Compile()
+	}
+	res := compile(`package users;
+
+@java.final
+struct User {
+    id int64;
+}
+
+service Users {
+    @route("/v1/users", method = "POST", retries = 3)
+    Create(u User) -> User;
+}
+`)
+	require.False(t, res.HasErrors(), res.String())
+
+	res = compile(`package users;
+
+@route("/v1/users", method = "GET")
+struct User {
+    @java.final
+    id int64;
+}
+
+service Users {
+    @route("/v1/users")
+    Get(u User) -> User;
+    @route("/v1/users", method = "POST", retry = 3)
+    Create(u User) -> User;
+    @route("/v1/users", method = "PUT", retries = "3")
+    Update(u User) -> User;
+    @route(method = "DELETE")
+    Delete(u User) -> User;
+}
+`)
+	var messages []string
+	for _, d := range res.Errors() {
+		messages = append(messages, d.Message)
+	}
+	require.Equal(t, []string{
+		"@route cannot be placed on struct User; it only applies to methods",
+		"@java.final cannot be placed on field User.id; it only applies to structs or enums",
+		`@route requires argument method; for example, @route("/v1/users", method = "POST")`,
+		`@route has no argument named retry; for example, @route("/v1/users", method = "POST")`,
+		`argument retries of @route must be an integer, got a string; for example, @route("/v1/users", method = "POST")`,
+		`@route expects 1 argument, got 0; for example, @route("/v1/users", method = "POST")`,
+	}, messages)
+}
+
+func TestDeprecatedUsages(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package shop;
+
+@deprecated("use Address instead")
+struct LegacyAddress {
+    line string;
+}
+
+struct Address {
+    lines array<string>;
+}
+
+# Deprecated: carts are now part of orders.
+enum CartState {
+    OPEN = 0;
+}
+
+struct Order {
+    shipping map<string, LegacyAddress>;
+    billing Address;
+    @deprecated
+    legacy LegacyAddress;
+    cart CartState;
+}
+
+@deprecated("use Order instead")
+struct LegacyOrder {
+    address LegacyAddress;
+
+    struct Item {
+        address LegacyAddress;
+    }
+}
+
+struct Shipment extends LegacyAddress {
+    id int64;
+}
+
+service Orders {
+    Ship(a LegacyAddress, o Order) -> Order;
+    @deprecated
+    ShipLegacy(a LegacyAddress);
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	var messages []string
+	for _, d := range res.Warnings() {
+		require.Equal(t, CodeDeprecatedUsage, d.Code)
+		messages = append(messages, d.Message)
+	}
+	require.Equal(t, []string{
+		"field shipping of Order uses deprecated struct shop.LegacyAddress: use Address instead",
+		"field cart of Order uses deprecated enum shop.CartState: carts are now part of orders.",
+		"struct Shipment extends deprecated struct shop.LegacyAddress: use Address instead",
+		"method Orders.Ship uses deprecated struct shop.LegacyAddress: use Address instead",
+	}, messages)
+
+	order := res.Tree.Packages["shop"].Files[0].FindStruct("Order")
+	deprecated, note := order.Fields[2].Deprecated()
+	require.True(t, deprecated)
+	require.Empty(t, note)
+	deprecated, note = res.Tree.Packages["shop"].Files[0].FindStruct("LegacyOrder").Deprecated()
+	require.True(t, deprecated)
+	require.Equal(t, "use Order instead", note)
+	deprecated, _ = order.Deprecated()
+	require.False(t, deprecated)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package shop;\n\n@deprecated\nconst LIMIT int32 = 10;\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "@deprecated cannot be placed on const LIMIT; it only applies to structs, fields, enums, enum members, services, or methods", res.Errors()[0].Message)
+}
+
+func TestStableIDs(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+struct User {
+    id int64;
+}
+
+@id("0x12ab")
+service Users {
+    @id(1)
+    Get(u User) -> User;
+    @id("0x2")
+    Create(u User) -> User;
+    Delete(u User);
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	svc := res.Tree.Packages["users"].Services[0]
+	require.Equal(t, uint32(0x12ab), svc.ID)
+	require.Equal(t, []uint32{1, 2, 0}, []uint32{svc.Methods[0].ID, svc.Methods[1].ID, svc.Methods[2].ID})
+
+	billing, err := filepath.Abs("fixtures/ids/billing.arf")
+	require.NoError(t, err)
+	fe, err = New("fixtures/ids/main.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	var messages []string
+	for _, d := range res.Errors() {
+		messages = append(messages, d.Message)
+	}
+	require.Equal(t, []string{
+		"@id 0x10 of service Users is already used by service billing.Invoices at " + billing + ", line 8, column 1",
+		"@id 0x2 of method Users.Update is already used by method Create at line 14, column 5",
+	}, messages)
+
+	for _, decl := range []string{`@id("users")`, "@id(0)", `@id("0x100000000")`, "@id(-1)"} {
+		fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n"+decl+"\nservice Users {\n    Ping();\n}\n")))
+		require.NoError(t, err)
+		res = fe.Compile()
+		require.Len(t, res.Errors(), 1, decl)
+		require.Contains(t, res.Errors()[0].Message, "expected an integer between 1 and 0xffffffff, such as 0x12ab", decl)
+	}
+}
+
+func TestAnnotationConstReferences(t *testing.T) {
+	RegisterAnnotation("limit", AnnotationSpec{Args: []AnnotationArg{{Name: "max", Type: ArgInt}}})
+	t.Cleanup(func() { delete(annotationRegistry.specs, "limit") })
+
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+const MAX_PAGE_SIZE int32 = PAGE_SIZE * 4;
+const PAGE_SIZE int32 = 25;
+
+enum RetryPolicy {
+    NONE = 0;
+    EXPONENTIAL = 1;
+}
+
+struct Page {
+    @limit(MAX_PAGE_SIZE)
+    size int32;
+}
+
+service Users {
+    @retry(policy = RetryPolicy.EXPONENTIAL, attempts = PAGE_SIZE, mode = FAST)
+    List(p Page) -> Page;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["users"]
+
+	ref, ok := pkg.Structures[0].Fields[0].Annotations.ByName("limit").Arguments[0].(*ast.AnnotationReference)
+	require.True(t, ok)
+	require.Equal(t, pkg.FindConst("MAX_PAGE_SIZE"), ref.Resolved())
+	require.Equal(t, int64(100), ref.Value())
+
+	retry := pkg.Services[0].Methods[0].Annotations.ByName("retry")
+	member := retry.Arg("policy").(*ast.AnnotationReference)
+	require.Equal(t, pkg.FindEnum("RetryPolicy").FindMember("EXPONENTIAL"), member.Resolved())
+	require.Nil(t, member.Value())
+	require.Equal(t, int64(25), retry.Arg("attempts").(*ast.AnnotationReference).Value())
+	require.Equal(t, "FAST", retry.Arg("mode"))
+
+	// Built-in annotations take the values of the constants
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(`package users;
+
+const MAX uint32 = 64;
+const NAME string = "users";
+const TIMEOUT duration = 30s;
+
+struct Page {
+    @max_length(MAX)
+    name string;
+    @default(NAME)
+    owner string;
+}
+
+service Users {
+    @timeout(TIMEOUT)
+    List(p Page) -> Page;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	pkg = res.Tree.Packages["users"]
+	fields := pkg.Structures[0].Fields
+	require.Equal(t, int64(64), fields[0].Annotations.ByName("max_length").Arguments[0])
+	require.Equal(t, uint64(64), fields[0].Constraints.MaxLength)
+	require.Equal(t, "users", fields[1].Default)
+	require.Equal(t, 30*time.Second, pkg.Services[0].Methods[0].Timeout)
+
+	bad := map[string]string{
+		"const LIMIT int32 = 5;\n\nservice Users {\n    @timeout(LIMIT)\n    List(p Page) -> Page;\n}\n\nstruct Page {}\n":   "argument 1 of @timeout must be a string or a duration, got an integer",
+		"const NAME string = \"users\";\n\n@errors(NAME)\nservice Users {\n    List(p Page) -> Page;\n}\n\nstruct Page {}\n": "argument 1 of @errors must be a reference, got a string",
+		"struct Page {\n    @max_length(Page)\n    name string;\n}\n":                                                        "argument 1 of @max_length must be a string or an integer, got a reference",
+		"struct Page {\n    @max_length(LIMIT)\n    name string;\n}\n":                                                       "Undefined reference LIMIT",
+	}
+	for src, msg := range bad {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\n"+src)))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.Len(t, res.Errors(), 1, src)
+		require.Contains(t, res.Errors()[0].Message, msg, src)
+	}
+
+	// Constants of imported packages are referenced by qualified name
+	fe, err = New("fixtures/consts/annotations.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	tags := res.Tree.Packages["orders"].Structures[0].Fields[0]
+	limit := tags.Annotations.ByName("limit").Arguments[0].(*ast.AnnotationReference)
+	require.Same(t, res.Tree.Packages["shared.limits"].FindConst("MAX"), limit.Resolved())
+	require.Equal(t, uint64(50), limit.Value())
+	require.Equal(t, uint64(5), tags.Constraints.MaxLength)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nconst NAME string = \"users\";\n\nstruct Page {\n    @limit(NAME)\n    size int32;\n}\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "argument 1 of @limit must be an integer, got a string", res.Errors()[0].Message)
+}
+
+func TestIncludePaths(t *testing.T) {
+	fe, err := New("fixtures/include/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.True(t, res.HasErrors())
+
+	vendor, err := filepath.Abs("fixtures/include/vendor/common/types.arf")
+	require.NoError(t, err)
+	fe, err = New("fixtures/include/main.arf", WithIncludePaths("fixtures/include/vendor"))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Contains(t, res.Files, vendor)
+	file := res.Tree.Packages["orders"].Files[0]
+	require.Equal(t, vendor, file.Imports[0].ResolvedValue)
+	require.Equal(t, "types.Money", file.FindStruct("Order").Fields[1].Type.(ast.ResolvableType).Resolved().FQN())
+
+	// Include paths are searched in order
+	shared, err := filepath.Abs("fixtures/include/shared/common/types.arf")
+	require.NoError(t, err)
+	fe, err = New("fixtures/include/main.arf", WithIncludePaths("fixtures/include/shared"), WithIncludePaths("fixtures/include/vendor"))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Equal(t, shared, res.Tree.Packages["orders"].Files[0].Imports[0].ResolvedValue)
+	require.NotContains(t, res.Files, vendor)
+}
+
+func TestPackageImports(t *testing.T) {
+	fe, err := New("fixtures/packages/app/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.True(t, res.HasErrors())
+	require.Contains(t, res.Diagnostics[0].Message, "package org.example.common not found")
+	require.Equal(t, 3, res.Diagnostics[0].Position.Line)
+
+	main, err := filepath.Abs("fixtures/packages/app/main.arf")
+	require.NoError(t, err)
+	money, err := filepath.Abs("fixtures/packages/lib/org/example/common/money.arf")
+	require.NoError(t, err)
+	status, err := filepath.Abs("fixtures/packages/lib/org/example/common/status.arf")
+	require.NoError(t, err)
+	fe, err = New("fixtures/packages/app/main.arf", WithIncludePaths("fixtures/packages/lib"))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Empty(t, res.Diagnostics)
+
+	imp := res.Tree.Packages["billing"].Files[0].Imports[0]
+	require.True(t, imp.ByPackage)
+	require.Equal(t, "org.example.common", imp.Value)
+	require.Equal(t, "common", imp.Alias)
+	require.Equal(t, money, imp.ResolvedValue)
+	require.Equal(t, []string{money, status}, imp.Files)
+	require.Equal(t, []string{money, status}, res.Imports.Dependencies(main))
+
+	invoice := res.Tree.Packages["billing"].Files[0].FindStruct("Invoice")
+	require.Equal(t, "org.example.common.Money", invoice.Fields[1].Type.(ast.ResolvableType).Resolved().FQN())
+	require.Equal(t, "org.example.common.Status", invoice.Fields[2].Type.(ast.ResolvableType).Resolved().FQN())
+}
+
+func TestGlobImports(t *testing.T) {
+	main, err := filepath.Abs("fixtures/glob/main.arf")
+	require.NoError(t, err)
+	money, err := filepath.Abs("fixtures/glob/common/money.arf")
+	require.NoError(t, err)
+	status, err := filepath.Abs("fixtures/glob/common/status.arf")
+	require.NoError(t, err)
+	fe, err := New("fixtures/glob/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Empty(t, res.Diagnostics)
+
+	imp := res.Tree.Packages["shop"].Files[0].Imports[0]
+	require.Equal(t, "common/*", imp.Value)
+	require.Equal(t, "common", imp.Alias)
+	require.Equal(t, money, imp.ResolvedValue)
+	require.Equal(t, []string{money, status}, imp.Files)
+	require.Equal(t, []string{money, status}, res.Imports.Dependencies(main))
+	order := res.Tree.Packages["shop"].Files[0].FindStruct("Order")
+	require.Equal(t, "common.Status", order.Fields[2].Type.(ast.ResolvableType).Resolved().FQN())
+
+	fe, err = New("fixtures/glob/mixed.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.True(t, res.HasErrors())
+	require.Equal(t, "files matching mixed/*.arf declare different packages: mixed/accounts.arf is in package accounts, but mixed/users.arf is in package users", res.Diagnostics[0].Message)
+
+	src := "package shop;\n\nimport \"missing/*\";\n"
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithStdinFilename("fixtures/glob/stdin.arf"))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.True(t, res.HasErrors())
+	require.Equal(t, "no schema files match missing/*", res.Diagnostics[0].Message)
+}
+
+func TestImportCycles(t *testing.T) {
+	var chain []string
+	for _, name := range []string{"a", "b", "c", "a"} {
+		p, err := filepath.Abs("fixtures/cycle/" + name + ".arf")
+		require.NoError(t, err)
+		chain = append(chain, p)
+	}
+
+	fe, err := New("fixtures/cycle/a.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.True(t, res.HasErrors())
+	require.Len(t, res.Diagnostics, 1)
+	d := res.Diagnostics[0]
+	require.Equal(t, "import cycle: a.arf -> b.arf -> c.arf -> a.arf", d.Message)
+	require.Equal(t, chain[2], d.Position.Filename)
+	require.Equal(t, 3, d.Position.Line)
+
+	var cycle *ImportCycleError
+	require.ErrorAs(t, res.Err(), &cycle)
+	require.Equal(t, chain, cycle.Chain)
+}
+
+func TestPublicImports(t *testing.T) {
+	fe, err := New("fixtures/public/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	require.Empty(t, res.Diagnostics)
+
+	order := res.Tree.Packages["orders"].Files[0].FindStruct("Order")
+	require.Equal(t, "shared.core.Id", order.Fields[0].Type.(ast.ResolvableType).Resolved().FQN())
+	require.Equal(t, "shared.base.Timestamp", order.Fields[1].Type.(ast.ResolvableType).Resolved().FQN())
+	api := res.Tree.Packages["shared.api"].Files[0]
+	require.True(t, api.Imports[0].Public)
+	require.False(t, api.Imports[1].Public)
+
+	// Imports that are not public are not re-exported
+	fe, err = New("fixtures/public/private.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.True(t, res.HasErrors())
+	require.Contains(t, res.Diagnostics[0].Message, "Undefined type internal.Secret")
+}
+
+func TestWithoutFilesystem(t *testing.T) {
+	src := "package x;\n\nimport \"common.arf\";\n"
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithStdinFilename("fixtures/x.arf"))
+	require.NoError(t, err)
+	_, err = fe.Run()
+	require.NoError(t, err)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithStdinFilename("fixtures/x.arf"), WithoutFilesystem())
+	require.NoError(t, err)
+	_, err = fe.Run()
+	require.ErrorContains(t, err, "cannot import common.arf: the filesystem is not available")
+}
+
+func TestImportedFilesAreValidated(t *testing.T) {
+	fe, err := New("fixtures/imported_types/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	common := res.Tree.Packages["shop.common"]
+	unit := common.FindStruct("Money").AllFields()[1]
+	require.Same(t, common.FindEnum("Unit"), unit.Type.(ast.ResolvableType).Resolved())
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.arf"), []byte("package shop.orders;\n\nimport \"common.arf\";\n\nstruct Order {\n    total common.Money;\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "common.arf"), []byte("package shop.common;\n\nstruct Money {\n    unit Missing;\n}\n"), 0o644))
+	fe, err = New(filepath.Join(dir, "main.arf"))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1, res.String())
+	require.Equal(t, "Undefined type Missing", res.Errors()[0].Message)
+	require.Equal(t, filepath.Join(dir, "common.arf"), res.Errors()[0].Position.Filename)
+}
+
+func TestEmptyDeclarationWarnings(t *testing.T) {
+	fe, err := New("fixtures/empty.arf")
+	require.NoError(t, err)
+	_, err = fe.Run()
+	require.NoError(t, err)
+
+	warnings := fe.Warnings()
+	require.Len(t, warnings, 2)
+	require.Equal(t, SeverityWarning, warnings[0].Severity)
+	require.Contains(t, warnings[0].Message, "struct Pending")
+	require.Equal(t, 3, warnings[0].Position.Line)
+	require.Contains(t, warnings[1].Message, "service Empty")
+}
+
+func TestVersionedPackages(t *testing.T) {
+	_, err := Parse("fixtures/versioned/users/v1/users.arf", WithVersionedPackages())
+	require.NoError(t, err)
+	_, err = Parse("fixtures/versioned/users/v2/aliased.arf", WithVersionedPackages())
+	require.NoError(t, err)
+
+	_, err = Parse("fixtures/versioned/users/v2/users.arf", WithVersionedPackages())
+	require.ErrorContains(t, err, "type User is declared by both")
+	_, err = Parse("fixtures/versioned/unversioned.arf", WithVersionedPackages())
+	require.ErrorContains(t, err, "must end with a version segment")
+
+	// Rules are opt-in
+	_, err = Parse("fixtures/versioned/users/v2/users.arf")
+	require.NoError(t, err)
+	_, err = Parse("fixtures/versioned/unversioned.arf")
+	require.NoError(t, err)
+}
+
+func TestPackageLayout(t *testing.T) {
+	_, err := Parse("fixtures/layout/org/example/contacts/contacts.arf", WithPackageLayout("fixtures/layout"))
+	require.NoError(t, err)
+
+	_, err = Parse("fixtures/layout/org/example/contacts/misplaced.arf", WithPackageLayout("fixtures/layout"))
+	require.ErrorContains(t, err, "does not match directory")
+	require.ErrorContains(t, err, "or declare package org.example.contacts")
+
+	_, err = Parse("fixtures/layout/org/example/contacts/contacts.arf", WithPackageLayout("fixtures/layout/org/example/contacts"))
+	require.ErrorContains(t, err, "does not match directory")
+
+	_, err = Parse("fixtures/layout/org/example/contacts/contacts.arf", WithPackageLayout("fixtures/versioned"))
+	require.ErrorContains(t, err, "outside of the schema root")
+}
+
+func TestManifestDependencies(t *testing.T) {
+	tree, err := Parse("fixtures/manifest/billing/invoice.arf")
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "acme.common.money")
+	require.Contains(t, tree.Packages, "acme.types")
+
+	m, err := ParseManifest("fixtures/manifest/billing/arf.mod")
+	require.NoError(t, err)
+	require.Equal(t, "acme.billing", m.Module)
+	require.Len(t, m.Dependencies, 2)
+	require.Equal(t, map[string]map[string]string{"go": {"module": "example.com/acme/billing"}}, m.Options)
+	resolved, ok, err := m.Resolve("acme.types/ids.arf")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, strings.HasSuffix(resolved, filepath.Join("billing", "vendor", "acme.types", "ids.arf")))
+	_, ok, err = m.Resolve("other/ids.arf")
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, ok, err = m.Resolve("acme.types/../../invoice.arf")
+	require.True(t, ok)
+	require.EqualError(t, err, "import acme.types/../../invoice.arf is not within dependency acme.types")
+
+	_, err = ParseManifest("fixtures/manifest/invalid.mod")
+	require.ErrorContains(t, err, "already declared")
+	_, err = New("fixtures/manifest/billing/invoice.arf", WithManifest("fixtures/manifest/invalid.mod"))
+	require.Error(t, err)
+}
+
+func TestCompileResult(t *testing.T) {
+	fe, err := New("fixtures/empty.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.NotNil(t, res.Tree)
+	require.NoError(t, res.Err())
+	require.Equal(t, 2, res.Count(SeverityWarning))
+	require.Len(t, res.Warnings(), 2)
+	require.Empty(t, res.Errors())
+	abs, err := filepath.Abs("fixtures/empty.arf")
+	require.NoError(t, err)
+	require.Equal(t, []string{abs}, res.Files)
+	require.Len(t, res.ByFile()[abs], 2)
+	require.Equal(t, "0 errors, 2 warnings across 1 file", res.Summary())
+
+	fe, err = New("fixtures/duplicate_import_aliases.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Nil(t, res.Tree)
+	require.True(t, res.HasErrors())
+	require.Equal(t, "1 error, 0 warnings across 2 files", res.Summary())
+	require.Equal(t, 3, res.Errors()[0].Position.Line)
+	require.ErrorContains(t, res.Err(), "duplicate import alias")
+
+	// Files failing to parse are counted, and the count is omitted when no
+	// file could be read
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package users;\n\nconst X int32 = 0123;\n")))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Equal(t, []string{"<stdin>"}, res.Files)
+	require.Equal(t, "1 error, 0 warnings across 1 file", res.Summary())
+	fe, err = New("fixtures/empty.arf", WithoutFilesystem())
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Empty(t, res.Files)
+	require.Equal(t, "1 error, 0 warnings", res.Summary())
+}
+
+func TestImportAliasConflicts(t *testing.T) {
+	fe, err := New("fixtures/aliases/main.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	d := res.Errors()[0]
+	require.Equal(t, 4, d.Position.Line)
+	require.Equal(t, `duplicate import alias users: billing_users.arf (package billing.users) is also the default alias of acme_users.arf (package acme.users) imported at line 3, column 1; import it as billing_users instead`, d.Message)
+	require.Len(t, d.Fixes, 1)
+	require.Equal(t, "Import as billing_users", d.Fixes[0].Title)
+
+	src, err := os.ReadFile("fixtures/aliases/main.arf")
+	require.NoError(t, err)
+	fixed, err := ApplyEdits(src, d.Fixes[0].Edits)
+	require.NoError(t, err)
+	require.Contains(t, string(fixed), "import \"billing_users.arf\" as billing_users;\n")
+
+	fe, err = New("fixtures/duplicate_import_aliases.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "duplicate import alias foo: foo.arf is already imported at line 2, column 1", res.Errors()[0].Message)
+}
+
+func TestSeverityOverrides(t *testing.T) {
+	fe, err := New("fixtures/severity/legacy.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.NoError(t, res.Err())
+	require.NotNil(t, res.Tree)
+
+	codes := map[string]Severity{}
+	for _, d := range res.Diagnostics {
+		codes[d.Code] = d.Severity
+	}
+	require.Equal(t, map[string]Severity{
+		CodeNamingCase:   SeverityWarning,
+		CodeEmptyService: SeverityWarning,
+	}, codes)
+	require.Equal(t, 3, res.Count(SeverityWarning))
+
+	fe, err = New("fixtures/severity/legacy.arf",
+		WithSeverity(CodeNamingCase, SeverityError),
+		WithSeverity(CodeEmptyService, SeverityInfo))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Nil(t, res.Tree)
+	require.ErrorContains(t, res.Err(), "error[naming-case]: Invalid struct name user_record")
+
+	fe, err = New("fixtures/severity/legacy.arf", WithSeverity(CodeNamingCase, SeverityOff), WithSeverity(CodeEmptyService, SeverityInfo))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.NoError(t, res.Err())
+	require.Len(t, res.Diagnostics, 1)
+	require.Equal(t, SeverityInfo, res.Diagnostics[0].Severity)
+
+	_, err = New("fixtures/severity/legacy.arf", WithSeverity("no-such-rule", SeverityOff))
+	require.ErrorContains(t, err, "unknown diagnostic code no-such-rule")
+}
+
+func TestFileExtensions(t *testing.T) {
+	_, err := Parse("fixtures/extensions/main.arf")
+	require.Error(t, err)
+
+	tree, err := Parse("fixtures/extensions/main.arf", WithExtensions(".arf", "arfi"))
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "ext.types")
+	require.Contains(t, tree.Packages, "ext.shared")
+	require.Contains(t, tree.Packages, "ext.upper")
+}
+
+func TestStdinEntrypoint(t *testing.T) {
+	src := `package ext.buffer;
+
+import "types.arfi";
+
+struct Buffer {
+    kind types.Kind;
+}
+`
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithStdinFilename("fixtures/extensions/unsaved.arf"), WithExtensions(".arf", ".arfi"))
+	require.NoError(t, err)
+	tree, err := fe.Run()
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "ext.buffer")
+	require.Contains(t, tree.Packages, "ext.types")
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader("package broken;\nstruct bad_name {}\n")))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "<stdin>", res.Errors()[0].Position.Filename)
+	require.Equal(t, 2, res.Errors()[0].Position.Line)
+}
+
+func TestDiagnosticsAreSortedAndDeduplicated(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package sorted;
+
+enum Empty {}
+
+struct Dup {
+    x string;
+    x string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.Len(t, res.Errors(), 2)
+	require.Equal(t, 3, res.Errors()[0].Position.Line)
+	require.Equal(t, 7, res.Errors()[1].Position.Line)
+
+	pos := ast.Position{Filename: "a.arf", Line: 4, Column: 2}
+	diags := normalizeDiagnostics([]*Diagnostic{
+		{Severity: SeverityError, Position: pos, Message: "duplicated"},
+		{Severity: SeverityWarning, Position: ast.Position{Filename: "a.arf", Line: 1, Column: 1}, Message: "first"},
+		{Severity: SeverityError, Position: pos, Message: "duplicated"},
+		{Severity: SeverityError, Position: pos, Message: "duplicated", Code: CodeNamingCase},
+	})
+	require.Len(t, diags, 3)
+	require.Equal(t, "first", diags[0].Message)
+	require.Empty(t, diags[1].Code)
+	require.Equal(t, CodeNamingCase, diags[2].Code)
+}
+
+func TestQuickFixes(t *testing.T) {
+	fix := func(t *testing.T, src string, diags []*Diagnostic) string {
+		var edits []TextEdit
+		for _, d := range diags {
+			require.NotEmpty(t, d.Fixes, d.Error())
+			edits = append(edits, d.Fixes[0].Edits...)
+		}
+		out, err := ApplyEdits([]byte(src), edits)
+		require.NoError(t, err)
+		return string(out)
+	}
+	compile := func(t *testing.T, src string) *Result {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithStdinFilename("fixtures/fixes.arf"))
+		require.NoError(t, err)
+		return fe.Compile()
+	}
+
+	t.Run("naming case", func(t *testing.T) {
+		src := "package fixes;\n\nstruct user_info {\n    Name string;\n}\n\nstruct Holder {\n    info user_info;\n}\n"
+		res := compile(t, src)
+		require.Len(t, res.Errors(), 2)
+		fixed := fix(t, src, res.Errors())
+		require.Equal(t, "package fixes;\n\nstruct UserInfo {\n    name string;\n}\n\nstruct Holder {\n    info UserInfo;\n}\n", fixed)
+		require.False(t, compile(t, fixed).HasErrors())
+	})
+
+	t.Run("missing semicolon", func(t *testing.T) {
+		src := "package fixes;\n\nstruct User {\n    name string\n    email string;\n}\n"
+		res := compile(t, src)
+		require.NotEmpty(t, res.Errors())
+		fixed := fix(t, src, res.Errors()[:1])
+		require.Equal(t, "package fixes;\n\nstruct User {\n    name string;\n    email string;\n}\n", fixed)
+		require.False(t, compile(t, fixed).HasErrors())
+	})
+
+	t.Run("unresolved type", func(t *testing.T) {
+		src := "package fixes;\n\nstruct User {\n    info UserInfp;\n}\n\nstruct UserInfo {\n    name string;\n}\n"
+		res := compile(t, src)
+		require.Len(t, res.Errors(), 1)
+		require.Equal(t, "Undefined type UserInfp; did you mean UserInfo?", res.Errors()[0].Message)
+		fixed := fix(t, src, res.Errors())
+		require.False(t, compile(t, fixed).HasErrors())
+
+		res = compile(t, "package fixes;\n\nstruct User {\n    info Unrelated;\n}\n")
+		require.Len(t, res.Errors(), 1)
+		require.Empty(t, res.Errors()[0].Fixes)
+	})
+
+	t.Run("missing import", func(t *testing.T) {
+		src := "package v1beta1.other.fixes;\n\nstruct User {\n    test Test2;\n}\n"
+		res := compile(t, src)
+		require.Len(t, res.Errors(), 1)
+		fixed := fix(t, src, res.Errors())
+		require.Equal(t, "package v1beta1.other.fixes;\n\nimport \"utility.arf\" as utility;\n\nstruct User {\n    test utility.Test2;\n}\n", fixed)
+		require.False(t, compile(t, fixed).HasErrors())
+
+		src = "package v1beta1.other.fixes;\n\nimport \"utility.arf\" as util;\n\nstruct User {\n    test Test2;\n}\n"
+		res = compile(t, src)
+		require.Len(t, res.Errors(), 1)
+		require.Equal(t, "package v1beta1.other.fixes;\n\nimport \"utility.arf\" as util;\n\nstruct User {\n    test util.Test2;\n}\n", fix(t, src, res.Errors()))
+	})
+
+	t.Run("unused import", func(t *testing.T) {
+		src := "package v1beta1.other.fixes;\n\nimport \"common.arf\";\nimport \"utility.arf\";\n\nstruct User {\n    test common.Test;\n}\n"
+		res := compile(t, src)
+		require.False(t, res.HasErrors())
+		require.Len(t, res.Warnings(), 1)
+		require.Equal(t, CodeUnusedImport, res.Warnings()[0].Code)
+		fixed := fix(t, src, res.Warnings())
+		require.Equal(t, "package v1beta1.other.fixes;\n\nimport \"common.arf\";\n\nstruct User {\n    test common.Test;\n}\n", fixed)
+		require.Empty(t, compile(t, fixed).Diagnostics)
+	})
+}
+
+func TestDuplicatedEnumValues(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package states;
+
+enum State {
+    UNKNOWN;
+    PENDING;
+    RUNNING = 1;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "Enum member RUNNING has value 1, already used by PENDING at line 5, column 5", res.Errors()[0].Message)
+}
+
+func TestFieldDefaults(t *testing.T) {
+	compile := func(t *testing.T, body string) *Result {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader("package defaults;\n\nenum Sort {\n    ASC = 0;\n    DESC = 1;\n}\n\nstruct Nested {}\n\n"+body)))
+		require.NoError(t, err)
+		return fe.Compile()
+	}
+
+	res := compile(t, `struct Page {
+    @default("50")
+    limit int32;
+    @default("0x10")
+    offset optional<uint64>;
+    @default("true")
+    include_total bool;
+    @default("1.5")
+    ratio float32;
+    @default("none")
+    filter string;
+    @default(Sort.DESC)
+    sort Sort;
+}
+`)
+	require.False(t, res.HasErrors(), res.String())
+	fields := res.Tree.Packages["defaults"].Files[0].FindStruct("Page").Fields
+	require.Equal(t, int64(50), fields[0].Default)
+	require.Equal(t, uint64(16), fields[1].Default)
+	require.Equal(t, true, fields[2].Default)
+	require.Equal(t, 1.5, fields[3].Default)
+	require.Equal(t, "none", fields[4].Default)
+	require.Equal(t, "DESC", fields[5].Default.(*ast.EnumMember).Name)
+	require.Equal(t, "Sort.DESC", fields[5].DefaultRef.Name)
+
+	res = compile(t, "struct Ratio {\n    @default(-2.5)\n    v float64;\n}\n")
+	require.False(t, res.HasErrors(), res.String())
+	require.Equal(t, -2.5, res.Tree.Packages["defaults"].Files[0].FindStruct("Ratio").Fields[0].Default)
+
+	for body, msg := range map[string]string{
+		"struct S {\n    @default(\"300\")\n    v uint8;\n}\n":       `invalid @default "300" for field v: value out of range`,
+		"struct S {\n    @default(\"yes\")\n    v bool;\n}\n":        `invalid @default "yes" for field v: invalid syntax`,
+		"struct S {\n    @default(\"0123\")\n    v int32;\n}\n":      `invalid @default "0123" for field v: leading zeros are not allowed`,
+		"struct S {\n    @default(\"1\", \"2\")\n    v int8;\n}\n":   "@default expects 1 argument, got 2; for example, @default(\"10\")",
+		"struct S {\n    @default(\"ASC\")\n    v Sort;\n}\n":        "@default of field v must reference a member of Sort, such as Sort.ASC",
+		"struct S {\n    @default(Nested)\n    v Sort;\n}\n":         "@default of field v references Nested, which is not a constant",
+		"struct S {\n    @default(\"x\")\n    v Nested;\n}\n":        "@default is not supported on field v of type defaults.Nested",
+		"struct S {\n    @default(\"x\")\n    v array<string>;\n}\n": "@default is not supported on field v: only primitives and enums have defaults",
+		"struct S {\n    @default(2.5)\n    v int32;\n}\n":           "@default of field v cannot be a float",
+	} {
+		res := compile(t, body)
+		require.Len(t, res.Errors(), 1, body)
+		require.Equal(t, msg, res.Errors()[0].Message, body)
+	}
+
+	// Constants are referenced by name, and recorded along the value
+	res = compile(t, `const DEFAULT_LIMIT int32 = PAGE * 2;
+const PAGE int32 = 25;
+const FILTER string = "none";
+
+struct Page {
+    @default(DEFAULT_LIMIT)
+    limit int32;
+    @default(DEFAULT_LIMIT)
+    offset optional<uint64>;
+    @default(FILTER)
+    filter string;
+}
+`)
+	require.False(t, res.HasErrors(), res.String())
+	pkg := res.Tree.Packages["defaults"]
+	fields = pkg.Files[0].FindStruct("Page").Fields
+	require.Equal(t, int64(50), fields[0].Default)
+	require.Same(t, pkg.FindConst("DEFAULT_LIMIT"), fields[0].DefaultRef.Resolved())
+	require.Equal(t, uint64(50), fields[1].Default)
+	require.Equal(t, "none", fields[2].Default)
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	pkg = decoded.Tree.Packages["defaults"]
+	field := pkg.Files[0].FindStruct("Page").Fields[0]
+	require.Equal(t, int64(50), field.Default)
+	require.Same(t, pkg.FindConst("DEFAULT_LIMIT"), field.DefaultRef.Resolved())
+
+	for body, msg := range map[string]string{
+		"const LIMIT int32 = 300;\n\nstruct S {\n    @default(LIMIT)\n    v uint8;\n}\n":   "invalid @default LIMIT (300) for field v: value out of range",
+		"const NAME string = \"a\";\n\nstruct S {\n    @default(NAME)\n    v int32;\n}\n":  "@default of field v references constant NAME of type string, which is not assignable to int32",
+		"const LIMIT int32 = 1;\n\nstruct S {\n    @default(LIMIT)\n    v Sort;\n}\n":      "@default of field v references constant LIMIT of type int32, which is not assignable to Sort",
+		"const RATIO float64 = 1.5;\n\nstruct S {\n    @default(RATIO)\n    v int32;\n}\n": "invalid @default RATIO (1.5) for field v: unexpected '.'",
+	} {
+		res := compile(t, body)
+		require.Len(t, res.Errors(), 1, body)
+		require.Equal(t, msg, res.Errors()[0].Message, body)
+	}
+}
+
+func TestTimeLiteralArguments(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package literals;
+
+struct Event {
+    @default(2024-01-01T00:00:00Z)
+    at timestamp;
+    @default("2024-06-01T12:00:00+02:00")
+    updated_at timestamp;
+}
+
+service Events {
+    @timeout(1m30s)
+    Get(e Event) -> Event;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	file := res.Tree.Packages["literals"].Files[0]
+	fields := file.FindStruct("Event").Fields
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), fields[0].Default)
+	require.True(t, time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC).Equal(fields[1].Default.(time.Time)))
+	require.Equal(t, 90*time.Second, file.Services[0].Methods[0].Timeout)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(`package literals;
+
+struct Event {
+    @default(30s)
+    count int32;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "@default of field count cannot be a duration", res.Errors()[0].Message)
+}
+
+func TestByteStringArguments(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package literals;
+
+@magic(x"CAFE BABE")
+struct Blob {
+    @default(b"\x89PNG\r\n")
+    header bytes;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	blob := res.Tree.Packages["literals"].Files[0].FindStruct("Blob")
+	require.Equal(t, []byte{0xCA, 0xFE, 0xBA, 0xBE}, blob.Annotations.ByName("magic").Arguments[0])
+	require.Equal(t, []byte("\x89PNG\r\n"), blob.Fields[0].Default)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(`package literals;
+
+struct Blob {
+    @default(b"1")
+    count int32;
+}
+`)))
+	require.NoError(t, err)
+	res = fe.Compile()
+	require.Len(t, res.Errors(), 1)
+	require.Equal(t, "@default of field count cannot be a byte string", res.Errors()[0].Message)
+}
+
+func TestNestedOptionals(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package optionals;
+
+struct S {
+    a optional<optional<int32>>;
+    b map<string, optional<optional<string>>>;
+    c optional<array<optional<int32>>>;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	errs := res.Errors()
+	require.Len(t, errs, 2, res.String())
+	for i, line := range []int{4, 5} {
+		require.Equal(t, "Nested optional types are not allowed; declare the type as optional once", errs[i].Message)
+		require.Equal(t, line, errs[i].Position.Line)
+	}
+	require.Equal(t, 16, errs[0].Position.Column)
+}
+
+func TestNameLimits(t *testing.T) {
+	src := `package org.example;
+
+struct Account {
+    identifier string;
+    struct Settings {
+        theme string;
+    }
+}
+
+enum Kind {
+    ADMINISTRATOR = 0;
+}
+
+service Accounts {
+    Fetch(identifier Account) -> Account;
+}
+`
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)), WithNameLimits(NameLimits{Identifier: 9, FQN: 27}))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	var got []string
+	for _, d := range res.Diagnostics {
+		require.Equal(t, CodeNameLength, d.Code)
+		require.Equal(t, SeverityWarning, d.Severity)
+		got = append(got, fmt.Sprintf("%d:%d %s", d.Position.Line, d.Position.Column, d.Message))
+	}
+	require.Equal(t, []string{
+		"4:5 struct field name identifier is 10 characters long, exceeding the limit of 9",
+		"5:5 fully qualified name org.example.Account.Settings of struct Settings is 28 characters long, exceeding the limit of 27",
+		"6:9 fully qualified name org.example.Account.Settings.theme of struct field theme is 34 characters long, exceeding the limit of 27",
+		"11:5 enum member name ADMINISTRATOR is 13 characters long, exceeding the limit of 9",
+		"15:11 method param name identifier is 10 characters long, exceeding the limit of 9",
+	}, got)
+
+	fe, err = New(StdinEntrypoint, WithStdin(strings.NewReader(src)))
+	require.NoError(t, err)
+	require.Empty(t, fe.Compile().Diagnostics)
+}
+
+func TestCanonicalHash(t *testing.T) {
+	compile := func(src string) *ast.Tree {
+		fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.False(t, res.HasErrors(), res.String())
+		return res.Tree
+	}
+	base := compile(`package org.example;
+
+struct Account {
+    @wire_name("id")
+    identifier string;
+    kind Kind;
+}
+
+struct Unrelated {
+    name string;
+}
+
+enum Kind {
+    ADMIN = 0;
+    MEMBER = 1;
+}
+
+service Accounts {
+    Fetch(a Account) -> Account;
+}
+`)
+	// Comments, formatting, and the order of declarations are irrelevant.
+	same := compile(`package org.example;
+
+# Kinds of accounts
+enum Kind { ADMIN = 0; MEMBER = 1; }
+
+service Accounts { Fetch(a Account) -> Account; }
+
+struct Unrelated { name string; }
+
+struct Account {
+    @wire_name("id") identifier string; # Unique
+    kind Kind;
+}
+`)
+	require.Len(t, base.CanonicalHash(), 64)
+	require.Equal(t, base.CanonicalHash(), same.CanonicalHash())
+
+	account := func(tree *ast.Tree) *ast.Struct { return tree.Packages["org.example"].Structures[0] }
+	service := func(tree *ast.Tree) *ast.Service { return tree.Packages["org.example"].Services[0] }
+	for _, s := range same.Packages["org.example"].Structures {
+		if s.Name == "Account" {
+			require.Equal(t, account(base).CanonicalHash(), s.CanonicalHash())
+		}
+	}
+	require.Equal(t, service(base).CanonicalHash(), service(same).CanonicalHash())
+
+	// Changes to referenced declarations affect the digests of those
+	// referencing them, but not others.
+	changed := compile(`package org.example;
+
+struct Account {
+    @wire_name("id")
+    identifier string;
+    kind Kind;
+}
+
+struct Unrelated {
+    name string;
+}
+
+enum Kind {
+    ADMIN = 0;
+    MEMBER = 2;
+}
+
+service Accounts {
+    Fetch(a Account) -> Account;
+}
+`)
+	require.NotEqual(t, base.CanonicalHash(), changed.CanonicalHash())
+	require.NotEqual(t, account(base).CanonicalHash(), account(changed).CanonicalHash())
+	require.NotEqual(t, service(base).CanonicalHash(), service(changed).CanonicalHash())
+	require.Equal(t, base.Packages["org.example"].Structures[1].CanonicalHash(), changed.Packages["org.example"].Structures[1].CanonicalHash())
+}
+
+func TestCanonicalHashImports(t *testing.T) {
+	dir := t.TempDir()
+	main, err := os.ReadFile("fixtures/imported_types/main.arf")
+	require.NoError(t, err)
+	common, err := os.ReadFile("fixtures/imported_types/common.arf")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.arf"), main, 0o644))
+	compile := func(common string) *ast.Tree {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "common.arf"), []byte(common), 0o644))
+		fe, err := New(filepath.Join(dir, "main.arf"))
+		require.NoError(t, err)
+		res := fe.Compile()
+		require.False(t, res.HasErrors(), res.String())
+		return res.Tree
+	}
+	base := compile(string(common))
+	changed := compile(strings.Replace(string(common), "unit Unit;", "unit int32;", 1))
+	require.NotEqual(t, base.CanonicalHash(), changed.CanonicalHash())
+
+	// Types left unresolved are hashed by their declared name
+	unit := base.Packages["shop.common"].FindStruct("Money").AllFields()[1]
+	unit.Type = &ast.SimpleUserType{Name: "Unit"}
+	unresolved := base.CanonicalHash()
+	unit.Type = &ast.SimpleUserType{Name: "Currency"}
+	require.NotEqual(t, unresolved, base.CanonicalHash())
+}
+
+func TestImportGraph(t *testing.T) {
+	fe, err := New("fixtures/full.arf")
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.NoError(t, res.Err())
+
+	full, err := filepath.Abs("fixtures/full.arf")
+	require.NoError(t, err)
+	common, err := filepath.Abs("fixtures/common.arf")
+	require.NoError(t, err)
+	utility, err := filepath.Abs("fixtures/utility.arf")
+	require.NoError(t, err)
+
+	require.Len(t, res.Imports, 3)
+	require.Empty(t, res.Imports[common])
+	imports := res.Imports[full]
+	require.Len(t, imports, 2)
+	require.Equal(t, "common", imports[0].Path)
+	require.Equal(t, common, imports[0].Resolved)
+	require.Equal(t, "common", imports[0].Alias)
+	require.Equal(t, "v1beta1.other.common", imports[0].Package)
+	require.Equal(t, 3, imports[0].Position.Line)
+	require.Equal(t, utility, imports[1].Resolved)
+	require.Equal(t, "utility", imports[1].Alias)
+
+	require.Equal(t, []string{common, utility}, res.Imports.Dependencies(full))
+	require.Equal(t, []string{full}, res.Imports.Dependents(common))
+	require.Empty(t, res.Imports.Dependents(full))
+}
+
+func TestMarshalResult(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package store;
+
+enum ErrorCode {
+    NOT_FOUND = 1;
+    CONFLICT = NOT_FOUND << 1;
+}
+
+enum Sort {
+    ASC;
+    DESC;
+}
+
+struct Page {
+    @default(Sort.DESC)
+    sort Sort;
+    @default("50")
+    limit int32;
+    @default(2024-01-01T00:00:00Z)
+    since timestamp;
+    items map<string, array<Item>>;
+
+    struct Item {
+        id string;
+    }
+}
+
+@errors(ErrorCode)
+@timeout("30s")
+service Store {
+    @readonly
+    @http("GET", "/items/{limit}")
+    @errors(ErrorCode.NOT_FOUND)
+    List(page Page) -> (stream Page.Item);
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+
+	data, err := MarshalResult(res)
+	require.NoError(t, err)
+	again, err := MarshalResult(fe.Compile())
+	require.NoError(t, err)
+	require.Equal(t, data, again)
+
+	decoded, err := UnmarshalResult(data)
+	require.NoError(t, err)
+	require.Equal(t, res.Files, decoded.Files)
+	require.Equal(t, res.Diagnostics, decoded.Diagnostics)
+	require.Equal(t, res.Tree.CanonicalHash(), decoded.Tree.CanonicalHash())
+	reencoded, err := MarshalResult(decoded)
+	require.NoError(t, err)
+	require.Equal(t, data, reencoded)
+
+	file := decoded.Tree.Packages["store"].Files[0]
+	page := file.FindStruct("Page")
+	require.Equal(t, "DESC", page.Fields[0].Default.(*ast.EnumMember).Name)
+	require.Same(t, file.FindEnum("Sort"), page.Fields[0].Type.(ast.ResolvableType).Resolved())
+	require.Same(t, page.Structs[0], page.Fields[3].Type.(*ast.MapType).Value.(*ast.ArrayType).Type.(ast.ResolvableType).Resolved())
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), page.Fields[2].Default.(time.Time).UTC())
+	require.Same(t, file, page.Position.File)
+
+	codes := file.FindEnum("ErrorCode")
+	require.Same(t, codes.Members[0], codes.Members[1].Expr.(*ast.BinaryExpr).X.(*ast.ConstRef).Resolved)
+	svc := file.Services[0]
+	require.Same(t, codes, svc.Errors)
+	require.Equal(t, 30*time.Second, svc.Timeout)
+	method := svc.Methods[0]
+	require.Same(t, svc, method.Service)
+	require.True(t, method.ReadOnly)
+	require.Same(t, codes.Members[0], method.ErrorCodes[0])
+	require.Same(t, page.Fields[1], method.HTTP.Segments[1].Field)
+	require.True(t, method.Returns[0].Stream)
+
+	fe, err = New("fixtures/full.arf")
+	require.NoError(t, err)
+	res = fe.Compile()
+	data, err = MarshalResult(res)
+	require.NoError(t, err)
+	decoded, err = UnmarshalResult(data)
+	require.NoError(t, err)
+	require.Equal(t, res.Imports, decoded.Imports)
+	require.Equal(t, res.Tree.CanonicalHash(), decoded.Tree.CanonicalHash())
+
+	fe, err = New("fixtures/duplicate_import_aliases.arf")
+	require.NoError(t, err)
+	data, err = MarshalResult(fe.Compile())
+	require.NoError(t, err)
+	decoded, err = UnmarshalResult(data)
+	require.NoError(t, err)
+	require.Nil(t, decoded.Tree)
+	require.ErrorContains(t, decoded.Err(), "duplicate import alias")
+
+	_, err = UnmarshalResult([]byte(`{"version": 2}`))
+	require.EqualError(t, err, "unsupported result version 2")
+}
+
+func TestDocOf(t *testing.T) {
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(`package docs;
+
+# Users are people using the service. They
+# sign in with their email.
+#
+#   Example: alice@example.com
+#
+# Deprecated: use Account
+#   instead.
+struct User {
+    # The email, unique.
+    email string;
+    name string; # shown in listings
+    @arf.deprecated("use email")
+    login string;
+}
+`)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	user := res.Tree.Packages["docs"].Structures[0]
+
+	doc := ast.DocOf(user)
+	require.Equal(t, "Users are people using the service. They\nsign in with their email.\n\n  Example: alice@example.com", doc.Text)
+	require.Equal(t, "Users are people using the service.", doc.Summary())
+	require.True(t, doc.Deprecated)
+	require.Equal(t, "use Account instead.", doc.DeprecationNote)
+
+	doc = ast.DocOf(user.Fields[0])
+	require.Equal(t, ast.Doc{Text: "The email, unique."}, doc)
+	require.Equal(t, "The email, unique.", doc.Summary())
+	require.Equal(t, ast.Doc{Text: "shown in listings"}, ast.DocOf(user.Fields[1]))
+	require.Equal(t, ast.Doc{Deprecated: true, DeprecationNote: "use email"}, ast.DocOf(user.Fields[2]))
+	require.Equal(t, ast.Doc{}, ast.DocOf(res.Tree.Packages["docs"].Files[0].Package))
+}
+
+func TestPackageTreeMerge(t *testing.T) {
+	compile := func(t *testing.T, name, src string) *ast.Tree {
+		fe, err := New(StdinEntrypoint, WithStdinFilename(name), WithStdin(strings.NewReader(src)))
+		require.NoError(t, err)
+		tree, err := fe.Run()
+		require.NoError(t, err)
+		return tree
+	}
+
+	tree := compile(t, "users.arf", `package acme;
+
+struct User {
+    address Address;
+
+    struct Address {
+        kind Kind;
+
+        enum Kind {
+            HOME;
+        }
+    }
+}
+
+enum Role {
+    ADMIN;
+}
+
+service Users {
+    Get(u User) -> User;
+}
+`)
+	pkg := tree.Packages["acme"]
+	require.Equal(t, "User", pkg.FindStruct("User").Name)
+	require.Equal(t, "Address", pkg.FindStruct("User.Address").Name)
+	require.Nil(t, pkg.FindStruct("User.Missing"))
+	require.Equal(t, "Role", pkg.FindEnum("Role").Name)
+	require.Equal(t, "Kind", pkg.FindEnum("User.Address.Kind").Name)
+	require.Nil(t, pkg.FindEnum("User.Kind"))
+	require.Equal(t, "Users", pkg.FindService("Users").Name)
+	require.Nil(t, pkg.FindService("Role"))
+
+	require.NoError(t, tree.Merge(compile(t, "orders.arf", "package acme;\n\nstruct Order {\n    id string;\n}\n")))
+	require.NoError(t, tree.Merge(compile(t, "billing.arf", "package billing;\n\nstruct Invoice {\n    id string;\n}\n")))
+	require.Len(t, tree.Packages["acme"].Files, 2)
+	require.NotNil(t, tree.Packages["acme"].FindStruct("Order"))
+	require.NotNil(t, tree.Packages["billing"].FindStruct("Invoice"))
+
+	// Files found in both trees are kept once
+	require.NoError(t, tree.Merge(tree))
+	require.Len(t, tree.Packages["acme"].Files, 2)
+
+	err := tree.Merge(compile(t, "roles.arf", "package acme;\n\nstruct Role {\n    id string;\n}\n\nstruct Team {\n    id string;\n}\n"))
+	require.ErrorContains(t, err, "struct acme.Role at ")
+	require.ErrorContains(t, err, "roles.arf, line 3, column 1, is already declared at ")
+	require.ErrorContains(t, err, "users.arf, line 15, column 1")
+	var collision *ast.Collision
+	require.ErrorAs(t, err, &collision)
+	require.Equal(t, "acme.Role", collision.FQN)
+	require.Nil(t, tree.Packages["acme"].FindStruct("Team"))
+}
+
+func TestFieldOrder(t *testing.T) {
+	src := `package users;
+
+struct User {
+    # Unique identifier
+    id int64 = 1;
+    @deprecated
+    nickname string = 3; # legacy
+    address struct {
+        city string;
+    } = 4;
+
+    name string = 2;
+}
+`
+	// Off unless enabled
+	fe, err := New(StdinEntrypoint, WithStdin(strings.NewReader(src)))
+	require.NoError(t, err)
+	res := fe.Compile()
+	require.False(t, res.HasErrors(), res.String())
+	for _, d := range res.Diagnostics {
+		require.NotEqual(t, CodeFieldOrder, d.Code)
+	}
+
+	enabled := map[Severity]Option{
+		SeverityError:   WithFieldOrder(),
+		SeverityWarning: WithSeverity(CodeFieldOrder, SeverityWarning),
+	}
+	for sev, opt := range enabled {
+		fe, err = New(StdinEntrypoint, opt, WithStdin(strings.NewReader(src)))
+		require.NoError(t, err)
+		res = fe.Compile()
+		i := slices.IndexFunc(res.Diagnostics, func(d *Diagnostic) bool { return d.Code == CodeFieldOrder })
+		require.NotEqual(t, -1, i, res.String())
+		d := res.Diagnostics[i]
+		require.Equal(t, sev, d.Severity)
+		require.Equal(t, "field name of User has index 2, but follows field address with index 4; fields must be declared in ascending index order", d.Message)
+		require.Equal(t, 12, d.Position.Line)
+		require.Len(t, d.Fixes, 1)
+		fixed, err := ApplyEdits([]byte(src), d.Fixes[0].Edits)
+		require.NoError(t, err)
+		require.Equal(t, `package users;
+
+struct User {
+    # Unique identifier
+    id int64 = 1;
+
+    name string = 2;
+    @deprecated
+    nickname string = 3; # legacy
+    address struct {
+        city string;
+    } = 4;
+}
+`, string(fixed))
+	}
+}
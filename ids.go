@@ -0,0 +1,107 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// validateIDs assigns the stable identifiers declared through @id to the
+// services and methods of every file, and ensures they are unique: service
+// IDs across all files, and method IDs within their service. The entrypoint
+// is visited last, so conflicts with imported files are reported on its own
+// declarations.
+func validateIDs(files map[string]*ast.File, entrypoint string) error {
+	paths := sortedKeys(files)
+	sort.SliceStable(paths, func(i, j int) bool { return paths[i] != entrypoint && paths[j] == entrypoint })
+
+	v := &idValidator{services: map[uint32]*ast.Service{}}
+	for _, path := range paths {
+		for _, s := range files[path].Services {
+			v.validateService(s)
+		}
+	}
+	return errors.Join(v.errors...)
+}
+
+type idValidator struct {
+	services map[uint32]*ast.Service
+	errors   []error
+}
+
+func (v *idValidator) Errorf(pos ast.Position, format string, args ...interface{}) {
+	v.errors = append(v.errors, newDiagnostic(SeverityError, pos, format, args...))
+}
+
+func (v *idValidator) validateService(s *ast.Service) {
+	var pos ast.Position
+	if s.ID, pos = v.parseID(s.Annotations); s.ID != 0 {
+		if ex, ok := v.services[s.ID]; ok {
+			v.Errorf(pos, "@id %s of service %s is already used by service %s at %s", formatID(s.ID), s.Name, ex.FQN(), relativeLocation(ex.Position, pos))
+		} else {
+			v.services[s.ID] = s
+		}
+	}
+
+	methods := map[uint32]*ast.ServiceMethod{}
+	for _, m := range s.Methods {
+		if m.ID, pos = v.parseID(m.Annotations); m.ID == 0 {
+			continue
+		}
+		if ex, ok := methods[m.ID]; ok {
+			v.Errorf(pos, "@id %s of method %s.%s is already used by method %s at %s", formatID(m.ID), s.Name, m.Name, ex.Name, relativeLocation(ex.Position, pos))
+			continue
+		}
+		methods[m.ID] = m
+	}
+}
+
+// parseID returns the identifier declared through @id in set, along with
+// the position of the annotation, or zero when there is none or it is
+// invalid.
+func (v *idValidator) parseID(set ast.AnnotationSet) (uint32, ast.Position) {
+	all := set.AllByName("id")
+	if len(all) == 0 {
+		return 0, ast.Position{}
+	}
+	a := all[0]
+	if len(all) > 1 {
+		v.Errorf(all[1].Position, "@id declared more than once")
+		return 0, a.Position
+	}
+	if len(a.Arguments) != 1 {
+		// Reported by validateAnnotations
+		return 0, a.Position
+	}
+
+	var id uint64
+	var raw string
+	var err error
+	switch arg := a.Arguments[0].(type) {
+	case string:
+		raw = strconv.Quote(arg)
+		id, err = strconv.ParseUint(arg, 0, 32)
+	case int64:
+		raw = strconv.FormatInt(arg, 10)
+		if arg < 0 || arg > math.MaxUint32 {
+			err = strconv.ErrRange
+		}
+		id = uint64(arg)
+	default:
+		// Reported by validateAnnotations
+		return 0, a.Position
+	}
+	if err != nil || id == 0 {
+		v.Errorf(a.Position, "invalid @id %s: expected an integer between 1 and %#x, such as 0x12ab", raw, uint32(math.MaxUint32))
+		return 0, a.Position
+	}
+	return uint32(id), a.Position
+}
+
+func formatID(id uint32) string {
+	return fmt.Sprintf("%#x", id)
+}
@@ -0,0 +1,147 @@
+package idl
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// ImportGraph describes the imports of every file read during a compilation,
+// keyed by file path. Files without imports are present with no edges.
+type ImportGraph map[string][]ResolvedImport
+
+// ResolvedImport is an import statement, along with what it resolved to.
+type ResolvedImport struct {
+	// Path is the imported path, or package name, as written.
+	Path string
+	// Resolved is the path of the imported file. Packages imported by name
+	// have an edge for each of their files.
+	Resolved string
+	// Alias is the name the imported package is referred to by, which is
+	// empty when the compilation stopped before aliases were resolved.
+	Alias string
+	// Package is the package declared by the imported file.
+	Package string
+	// Public indicates the import is re-exported to the files importing
+	// the importing one.
+	Public bool
+
+	Position ast.Position
+}
+
+// newImportGraph returns the import graph of files.
+func newImportGraph(files map[string]*ast.File) ImportGraph {
+	g := make(ImportGraph, len(files))
+	for path, f := range files {
+		edges := make([]ResolvedImport, 0, len(f.Imports))
+		for _, imp := range f.Imports {
+			resolved := imp.Files
+			if len(resolved) == 0 {
+				// The compilation stopped before the import was resolved
+				resolved = []string{imp.ResolvedValue}
+			}
+			for _, location := range resolved {
+				ri := ResolvedImport{Path: imp.Value, Resolved: location, Alias: imp.Alias, Public: imp.Public, Position: imp.Position}
+				if target, ok := files[location]; ok && target.Package != nil {
+					ri.Package = target.Package.Value
+				}
+				ri.Position.File = nil
+				edges = append(edges, ri)
+			}
+		}
+		g[path] = edges
+	}
+	return g
+}
+
+// Dependencies returns the files path imports, directly or not, sorted.
+func (g ImportGraph) Dependencies(path string) []string {
+	return g.walk(path, func(p string) []string {
+		var res []string
+		for _, imp := range g[p] {
+			res = append(res, imp.Resolved)
+		}
+		return res
+	})
+}
+
+// Dependents returns the files importing path, directly or not, sorted:
+// the files to recompile when path changes.
+func (g ImportGraph) Dependents(path string) []string {
+	reverse := map[string][]string{}
+	for from, imports := range g {
+		for _, imp := range imports {
+			reverse[imp.Resolved] = append(reverse[imp.Resolved], from)
+		}
+	}
+	return g.walk(path, func(p string) []string { return reverse[p] })
+}
+
+// walk returns the files reachable from path through next, excluding path
+// itself.
+func (g ImportGraph) walk(path string, next func(string) []string) []string {
+	seen := map[string]bool{path: true}
+	queue := []string{path}
+	var res []string
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, n := range next(p) {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			res = append(res, n)
+			queue = append(queue, n)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// publicImports returns the public imports of the files at locations, and
+// of the files those import, transitively: the imports made visible to a
+// file importing locations. Each file is visited once.
+func publicImports(files map[string]*ast.File, locations []string) []*ast.Import {
+	var res []*ast.Import
+	seen := map[string]bool{}
+	queue := slices.Clone(locations)
+	for len(queue) > 0 {
+		location := queue[0]
+		queue = queue[1:]
+		file, ok := files[location]
+		if !ok || seen[location] {
+			continue
+		}
+		seen[location] = true
+		for _, imp := range file.Imports {
+			if imp.Public {
+				res = append(res, imp)
+				queue = append(queue, imp.Files...)
+			}
+		}
+	}
+	return res
+}
+
+// ImportCycleError reports files importing each other, directly or not,
+// which prevents them from being compiled. Diagnostics reporting a cycle wrap
+// it, so it can be retrieved through errors.As.
+type ImportCycleError struct {
+	// Chain lists the paths of the files forming the cycle, in import order,
+	// starting and ending with the same file.
+	Chain []string
+
+	// dir is the directory paths are shown relative to.
+	dir string
+}
+
+func (e *ImportCycleError) Error() string {
+	names := make([]string, len(e.Chain))
+	for i, p := range e.Chain {
+		names[i] = relativePath(e.dir, p)
+	}
+	return "import cycle: " + strings.Join(names, " -> ")
+}
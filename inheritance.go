@@ -0,0 +1,91 @@
+package idl
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// resolveExtends resolves the base of s, which must be a struct.
+func (v *validatorP2) resolveExtends(s *ast.Struct) {
+	if file := s.Position.File; file != nil && file != v.f {
+		defer func(restore *ast.File) { v.f = restore }(v.f)
+		v.f = file
+	}
+	v.resolveType(s, s.Extends)
+	obj := s.Extends.Resolved()
+	if obj == nil {
+		// Reported by resolveType
+		return
+	}
+	if _, ok := obj.(*ast.Struct); !ok {
+		v.Errorf(s.Extends.Pos(), "struct %s can only extend another struct, but %s is an %s", s.Name, obj.FQN(), strings.ToLower(obj.Kind()))
+	}
+}
+
+// validateInheritance ensures s does not extend itself, directly or through
+// its bases, and that its fields do not shadow inherited ones. Bases declared
+// by other files are resolved within them first. Fields without a declared
+// index are numbered after the highest index they inherit.
+// It must be called once every struct of the file has its base resolved.
+func (v *validatorP2) validateInheritance(s *ast.Struct) {
+	chain := []*ast.Struct{s}
+	for st := s; st.Extends != nil; {
+		if st.Extends.Resolved() == nil && st.Position.File != v.f {
+			v.resolveExtends(st)
+		}
+		base := st.Base()
+		if base == nil {
+			break
+		}
+		if base == s {
+			names := mapFn(chain, func(st *ast.Struct) string { return st.Name })
+			v.Errorf(s.Extends.Pos(), "struct %s extends itself through %s", s.Name, strings.Join(append(names, s.Name), " extends "))
+			return
+		}
+		if slices.Contains(chain, base) {
+			// Cycles not involving s are reported for the structs forming them
+			return
+		}
+		chain = append(chain, base)
+		st = base
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		st := chain[i]
+		offset := 0
+		if base := st.Base(); base != nil {
+			for _, f := range base.AllFields() {
+				offset = max(offset, f.Index+1)
+			}
+		}
+		for j, f := range st.Fields {
+			if !f.IndexDeclared {
+				f.Index = offset + j
+			}
+		}
+	}
+
+	base := s.Base()
+	if base == nil {
+		return
+	}
+	inherited := base.AllFields()
+	for _, f := range s.Fields {
+		for _, ex := range inherited {
+			at := relativeLocation(ex.Position, f.Position)
+			switch {
+			case f.Name == ex.Name:
+				v.Errorf(f.Position, "field %s of %s shadows field %s inherited from %s at %s", f.Name, s.Name, ex.Name, ex.Parent.Name, at)
+			case f.WireName() == ex.WireName():
+				v.errors = append(v.errors, newCodedDiagnostic(CodeWireNameCollision, SeverityError, f.Position, "wire name %s of field %s collides with field %s inherited from %s at %s", f.WireName(), f.Name, ex.Name, ex.Parent.Name, at))
+			case f.Index == ex.Index:
+				v.Errorf(f.Position, "index %d of field %s is already used by field %s inherited from %s at %s", f.Index, f.Name, ex.Name, ex.Parent.Name, at)
+			}
+		}
+	}
+	for _, st := range chain[1:] {
+		v.errors = append(v.errors, reservedFieldConflicts(st, s.Fields)...)
+	}
+}
@@ -0,0 +1,46 @@
+// Package naming converts identifiers between the casing conventions used by
+// importers and the ones enforced by arf.
+package naming
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Snake converts identifiers such as userID or HTTPServer to snake_case.
+func Snake(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if (prevLower || nextLower) && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// Camel converts identifiers such as user_info or userInfo to CamelCase.
+func Camel(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		r := []rune(part)
+		b.WriteRune(unicode.ToUpper(r[0]))
+		b.WriteString(string(r[1:]))
+	}
+	return b.String()
+}
+
+// Screaming converts identifiers to SCREAMING_SNAKE_CASE.
+func Screaming(s string) string {
+	return strings.ToUpper(Snake(s))
+}
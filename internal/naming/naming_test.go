@@ -0,0 +1,16 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNaming(t *testing.T) {
+	require.Equal(t, "user_id", Snake("userID"))
+	require.Equal(t, "http_server", Snake("HTTPServer"))
+	require.Equal(t, "display_name", Snake("display_name"))
+	require.Equal(t, "UserInfo", Camel("user_info"))
+	require.Equal(t, "GetUser", Camel("getUser"))
+	require.Equal(t, "NOT_FOUND", Screaming("NotFound"))
+}
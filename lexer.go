@@ -1,6 +1,14 @@
 package idl
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arf-rpc/idl/ast"
+)
 
 type lexer struct {
 	data      []rune
@@ -15,6 +23,10 @@ type lexer struct {
 
 	onError func(error)
 	tokens  []token
+
+	// stop, when set, is consulted between tokens and ends the scan early
+	// when it returns true.
+	stop func() bool
 }
 
 func lexFile(data []byte, onError func(error)) ([]token, []error) {
@@ -75,16 +87,8 @@ func (s *lexer) advance() rune {
 }
 
 func (s *lexer) errorf(msg string, args ...interface{}) {
-	s.onError(fmt.Errorf("%s at %d:%d", fmt.Sprintf(msg, args...), s.startLine, s.startCol))
-}
-
-func (s *lexer) match(r rune) bool {
-	if s.peek() == r {
-		s.advance()
-		return true
-	}
-	s.errorf("Unexpected '%c'", s.peek())
-	return false
+	pos := ast.Position{Line: s.startLine, Column: s.startCol}
+	s.onError(newDiagnostic(SeverityError, pos, msg, args...))
 }
 
 func (s *lexer) pushToken(t tokenType) {
@@ -92,6 +96,7 @@ func (s *lexer) pushToken(t tokenType) {
 		Type:   t,
 		Value:  s.marked(),
 		Pos:    s.startPos,
+		End:    s.pos,
 		Line:   s.startLine,
 		Column: s.startCol,
 	})
@@ -131,10 +136,29 @@ var simpleTokens = map[rune]tokenType{
 	',': tokenTypeComma,
 	'@': tokenTypeAtSign,
 	'.': tokenTypePeriod,
+	'+': tokenTypePlus,
+	'-': tokenTypeMinus,
+	'*': tokenTypeStar,
+	'/': tokenTypeSlash,
+	'%': tokenTypePercent,
+	'|': tokenTypePipe,
+	'&': tokenTypeAmpersand,
+	'^': tokenTypeCaret,
+	'~': tokenTypeTilde,
+	'?': tokenTypeQuestion,
+}
+
+// doubleTokens lists tokens made of two characters, which take precedence
+// over simpleTokens. Closing angles of nested types, such as the ones in
+// array<array<int32>>, are lexed as a shift and split by the parser.
+var doubleTokens = map[string]tokenType{
+	"->": tokenTypeArrow,
+	"<<": tokenTypeShiftLeft,
+	">>": tokenTypeShiftRight,
 }
 
 func (s *lexer) scan() {
-	for !s.eof() {
+	for !s.eof() && (s.stop == nil || !s.stop()) {
 		p := s.peek()
 		switch p {
 		case ' ', '\n', '\t', '\r':
@@ -146,17 +170,27 @@ func (s *lexer) scan() {
 				s.advance()
 			}
 			s.pushToken(tokenTypeComment)
+		case '/':
+			if s.peek1() == '*' {
+				s.parseBlockComment()
+			} else {
+				s.pushSimple(tokenTypeSlash)
+			}
 		case '"', '\'':
 			s.parseString(p)
-		case '-':
-			s.mark()
-			s.advance()
-			if s.match('>') {
-				s.pushToken(tokenTypeArrow)
-				continue
+		case 'b', 'x':
+			if s.peek1() == '"' {
+				s.parseBytes(p)
+			} else {
+				s.parseIdentifier()
 			}
 		default:
-			if simple, ok := simpleTokens[p]; ok {
+			if double, ok := doubleTokens[string([]rune{p, s.peek1()})]; ok {
+				s.mark()
+				s.advance()
+				s.advance()
+				s.pushToken(double)
+			} else if simple, ok := simpleTokens[p]; ok {
 				s.pushSimple(simple)
 			} else if isDigit(p) {
 				if s.peek1() == 'x' {
@@ -167,19 +201,48 @@ func (s *lexer) scan() {
 			} else if isAscii(p) {
 				s.parseIdentifier()
 			} else {
+				s.mark()
 				s.errorf("Unexpected '%c'", p)
 				s.advance()
 			}
 		}
 	}
 	s.mark()
-	s.tokens = append(s.tokens, token{Type: tokenTypeEOF, Pos: s.startPos, Line: s.line, Column: s.column})
+	s.tokens = append(s.tokens, token{Type: tokenTypeEOF, Pos: s.startPos, End: s.startPos, Line: s.line, Column: s.column})
+}
+
+// parseBlockComment scans a comment delimited by /* and */, which may span
+// several lines. Unlike line comments, its token starts at the opening
+// delimiter.
+func (s *lexer) parseBlockComment() {
+	s.mark()
+	s.advance() // Consume /
+	s.advance() // Consume *
+	start := s.pos
+	for !s.eof() && (s.peek() != '*' || s.peek1() != '/') {
+		s.advance()
+	}
+	value := string(s.data[start:s.pos])
+	if s.eof() {
+		s.errorf("Unterminated block comment")
+	} else {
+		s.advance() // Consume *
+		s.advance() // Consume /
+	}
+
+	s.tokens = append(s.tokens, token{
+		Type:   tokenTypeComment,
+		Value:  value,
+		Pos:    s.startPos,
+		End:    s.pos,
+		Line:   s.startLine,
+		Column: s.startCol,
+		Block:  true,
+	})
 }
 
 func (s *lexer) parseString(q rune) {
-	startPos := s.pos
-	startLine := s.startLine
-	startCol := s.startCol
+	s.mark()
 	s.advance() // Consume first quote
 	var data []rune
 	escaping := false
@@ -217,33 +280,258 @@ func (s *lexer) parseString(q rune) {
 	s.tokens = append(s.tokens, token{
 		Type:   tokenTypeString,
 		Value:  string(data),
-		Pos:    startPos,
-		Line:   startLine,
-		Column: startCol,
+		Pos:    s.startPos,
+		End:    s.pos,
+		Line:   s.startLine,
+		Column: s.startCol,
+	})
+}
+
+// parseBytes scans a byte-string literal, whose decoded contents become the
+// token value. Literals prefixed by b hold text where \xHH denotes an
+// arbitrary byte, along with the \n, \r, \t, \0, \\, and \" escapes, as in
+// b"\x89PNG\r\n". Literals prefixed by x hold pairs of hexadecimal digits,
+// optionally separated by spaces, as in x"89 50 4E 47".
+func (s *lexer) parseBytes(prefix rune) {
+	s.mark()
+	s.advance() // Consume prefix
+	s.advance() // Consume quote
+	var data []byte
+	var hex []rune
+	valid, closed := true, false
+	// fail reports an error once, while the remainder of the literal is
+	// consumed so it does not produce further errors.
+	fail := func(msg string, args ...any) {
+		if valid {
+			s.errorf(msg, args...)
+		}
+		valid = false
+	}
+	for !s.eof() && !closed && s.peek() != '\n' {
+		p := s.advance()
+		switch {
+		case p == '"':
+			closed = true
+		case prefix == 'x' && p == ' ':
+		case prefix == 'x':
+			if !isHex(p) {
+				fail("Invalid byte string: unexpected '%c', expected hexadecimal digits", p)
+				continue
+			}
+			hex = append(hex, p)
+			if len(hex) == 2 {
+				b, _ := strconv.ParseUint(string(hex), 16, 8)
+				data = append(data, byte(b))
+				hex = hex[:0]
+			}
+		case p == '\\':
+			b, err := s.parseByteEscape()
+			if err != nil {
+				fail("Invalid byte string: %s", err)
+				continue
+			}
+			data = append(data, b)
+		default:
+			data = utf8.AppendRune(data, p)
+		}
+	}
+	switch {
+	case !closed:
+		fail("Unterminated byte string")
+	case len(hex) != 0:
+		fail("Invalid byte string: odd number of hexadecimal digits")
+	}
+	if !valid {
+		return
+	}
+	s.tokens = append(s.tokens, token{
+		Type:   tokenTypeBytes,
+		Value:  string(data),
+		Pos:    s.startPos,
+		End:    s.pos,
+		Line:   s.startLine,
+		Column: s.startCol,
 	})
 }
 
+// byteEscapes maps the escape sequences of byte-string literals, other than
+// \xHH, to the byte they represent.
+var byteEscapes = map[rune]byte{
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+}
+
+// parseByteEscape scans an escape sequence of a byte-string literal, whose
+// backslash was already consumed.
+func (s *lexer) parseByteEscape() (byte, error) {
+	if s.eof() || s.peek() == '\n' {
+		return 0, fmt.Errorf("unterminated escape sequence")
+	}
+	p := s.advance()
+	if b, ok := byteEscapes[p]; ok {
+		return b, nil
+	}
+	if p == 'x' && s.pos+1 < s.len && isHex(s.data[s.pos]) && isHex(s.data[s.pos+1]) {
+		b, _ := strconv.ParseUint(string(s.data[s.pos:s.pos+2]), 16, 8)
+		s.advance()
+		s.advance()
+		return byte(b), nil
+	}
+	return 0, fmt.Errorf("unknown escape sequence \\%c", p)
+}
+
 func (s *lexer) parseNumber() {
 	s.mark()
-	for isDigit(s.peek()) {
+	s.skipDigits()
+	switch {
+	case s.atDate():
+		s.parseTimestamp()
+	case s.at('.') && isDigit(s.peek1()):
+		s.parseFraction()
+	case !s.eof() && strings.ContainsRune(durationUnits, s.peek()):
+		s.parseDuration()
+	default:
+		s.pushNumber(tokenTypeNumber)
+	}
+}
+
+// skipDigits consumes decimal digits along with the underscores which may
+// separate them.
+func (s *lexer) skipDigits() {
+	for !s.eof() && (isDigit(s.peek()) || s.peek() == '_') {
+		s.advance()
+	}
+}
+
+// pushNumber pushes the marked integer literal as a token of type t, provided
+// it is well-formed.
+func (s *lexer) pushNumber(t tokenType) {
+	if err := checkIntLiteral(s.marked()); err != nil {
+		s.errorf("Invalid number %s: %s", s.marked(), err)
+		return
+	}
+	s.pushToken(t)
+}
+
+// checkIntLiteral reports whether lit is a valid decimal or hexadecimal
+// integer. Underscores may separate digits, as in 1_000_000 or 0xFF_FF, and
+// decimals other than 0 cannot start with a zero, so 0123 is not mistaken
+// for an octal number.
+func checkIntLiteral(lit string) error {
+	digits, valid := lit, isDigit
+	if strings.HasPrefix(lit, "0x") {
+		digits, valid = lit[2:], isHex
+	} else if len(lit) > 1 && lit[0] == '0' {
+		return fmt.Errorf("leading zeros are not allowed")
+	}
+	if digits == "" {
+		return fmt.Errorf("missing digits")
+	}
+	if digits[0] == '_' || digits[len(digits)-1] == '_' || strings.Contains(digits, "__") {
+		return fmt.Errorf("underscores may only separate digits")
+	}
+	for _, r := range digits {
+		if r != '_' && !valid(r) {
+			return fmt.Errorf("unexpected '%c'", r)
+		}
+	}
+	return nil
+}
+
+// at indicates whether the next rune is r.
+func (s *lexer) at(r rune) bool {
+	return !s.eof() && s.peek() == r
+}
+
+// durationUnits holds the first rune of each unit accepted by duration
+// literals: ns, us (or µs), ms, s, m, and h.
+const durationUnits = "nuµmsh"
+
+// atDate indicates whether the marked digits are the year of a date, followed
+// by -MM-DD. Other numbers followed by a dash, as in 2024-1, are subtracted
+// from.
+func (s *lexer) atDate() bool {
+	const shape = "-00-00"
+	if s.pos-s.startPos != 4 || strings.ContainsRune(s.marked(), '_') || s.pos+len(shape) > s.len {
+		return false
+	}
+	for i, c := range shape {
+		r := s.data[s.pos+i]
+		if c == '-' && r != '-' || c == '0' && !isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTimestamp scans an RFC 3339 timestamp literal, such as
+// 2024-01-01T00:00:00Z or 2024-01-01T09:30:00.5+02:00, whose year was already
+// consumed.
+func (s *lexer) parseTimestamp() {
+	for !s.eof() && (isDigit(s.peek()) || strings.ContainsRune("-:.+TZtz", s.peek())) {
+		s.advance()
+	}
+	if _, err := time.Parse(time.RFC3339Nano, s.marked()); err != nil {
+		s.errorf("Invalid timestamp literal %s, expected RFC 3339 such as 2024-01-01T00:00:00Z", s.marked())
+		return
+	}
+	s.pushToken(tokenTypeTimestamp)
+}
+
+// parseFraction scans the fractional part of a floating-point literal, such
+// as 1.5 or 6.02e23, whose integer digits were already consumed. Literals
+// followed by a unit, such as 1.5h, are durations.
+func (s *lexer) parseFraction() {
+	s.advance() // Consume '.'
+	s.skipDigits()
+	if !s.eof() && strings.ContainsRune(durationUnits, s.peek()) {
+		s.parseDuration()
+		return
+	}
+	if s.at('e') || s.at('E') {
 		s.advance()
+		if s.at('+') || s.at('-') {
+			s.advance()
+		}
+		s.skipDigits()
+	}
+	if _, err := strconv.ParseFloat(s.marked(), 64); err != nil {
+		s.errorf("Invalid number %s, expected a floating-point number such as 1.5 or 2.5e-3", s.marked())
+		return
+	}
+	s.pushToken(tokenTypeFloat)
+}
+
+// parseDuration scans a duration literal, such as 30s, 1.5h, or 1h30m, as
+// accepted by time.ParseDuration, whose first digits were already consumed.
+func (s *lexer) parseDuration() {
+	for !s.eof() && (isAlpha(s.peek()) || s.peek() == '.' || s.peek() == 'µ') {
+		s.advance()
+	}
+	if _, err := time.ParseDuration(s.marked()); err != nil {
+		s.errorf("Invalid duration literal %s, expected a sequence of numbers with units such as 30s or 1h30m", s.marked())
+		return
 	}
-	s.pushToken(tokenTypeNumber)
+	s.pushToken(tokenTypeDuration)
 }
 
 func (s *lexer) parseHex() {
 	s.mark()
 	s.advance() // consume 0
 	s.advance() // consume x
-	for isHex(s.peek()) {
+	for !s.eof() && (isHex(s.peek()) || s.peek() == '_') {
 		s.advance()
 	}
-	s.pushToken(tokenTypeHex)
+	s.pushNumber(tokenTypeHex)
 }
 
 func (s *lexer) parseIdentifier() {
 	s.mark()
-	for isAlpha(s.peek()) {
+	for !s.eof() && isAlpha(s.peek()) {
 		s.advance()
 	}
 	s.pushToken(tokenTypeIdentifier)
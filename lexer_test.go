@@ -15,3 +15,138 @@ func TestLexer(t *testing.T) {
 	require.Empty(t, errs)
 	require.NotNil(t, file)
 }
+
+func TestTimeLiterals(t *testing.T) {
+	tokens, errs := lexFile([]byte("@timeout(30s) @since(2024-01-01T09:30:00.5+02:00) @retry(1h30m, 1.5s, 250ms, 2024)"), nil)
+	require.Empty(t, errs)
+	var got []token
+	for _, tk := range tokens {
+		if tk.Type == tokenTypeDuration || tk.Type == tokenTypeTimestamp || tk.Type == tokenTypeNumber {
+			got = append(got, token{Type: tk.Type, Value: tk.Value})
+		}
+	}
+	require.Equal(t, []token{
+		{Type: tokenTypeDuration, Value: "30s"},
+		{Type: tokenTypeTimestamp, Value: "2024-01-01T09:30:00.5+02:00"},
+		{Type: tokenTypeDuration, Value: "1h30m"},
+		{Type: tokenTypeDuration, Value: "1.5s"},
+		{Type: tokenTypeDuration, Value: "250ms"},
+		{Type: tokenTypeNumber, Value: "2024"},
+	}, got)
+
+	// Years are only timestamps when followed by a month and a day
+	for _, src := range []string{"2024-1", "1000 - 1", "1000-1"} {
+		tokens, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		require.Equal(t, tokenTypeNumber, tokens[0].Type, src)
+	}
+
+	for src, msg := range map[string]string{
+		"2024-13-01T00:00:00Z": "Invalid timestamp literal 2024-13-01T00:00:00Z",
+		"2024-01-01":           "Invalid timestamp literal 2024-01-01",
+		"30mins":               "Invalid duration literal 30mins",
+		"1.5e":                 "Invalid number 1.5e",
+	} {
+		_, errs := lexFile([]byte(src), nil)
+		require.Len(t, errs, 1, src)
+		require.Contains(t, errs[0].Error(), msg)
+	}
+}
+
+func TestFloatLiterals(t *testing.T) {
+	tokens, errs := lexFile([]byte("1.5 0.25 6.02e23 2.5E-3 1.5h"), nil)
+	require.Empty(t, errs)
+	var got []token
+	for _, tk := range tokens {
+		if tk.Type != tokenTypeEOF {
+			got = append(got, token{Type: tk.Type, Value: tk.Value})
+		}
+	}
+	require.Equal(t, []token{
+		{Type: tokenTypeFloat, Value: "1.5"},
+		{Type: tokenTypeFloat, Value: "0.25"},
+		{Type: tokenTypeFloat, Value: "6.02e23"},
+		{Type: tokenTypeFloat, Value: "2.5E-3"},
+		{Type: tokenTypeDuration, Value: "1.5h"},
+	}, got)
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tokens, errs := lexFile([]byte("0 7 1_000_000 0xFF_FF 0x0 10"), nil)
+	require.Empty(t, errs)
+	var got []string
+	for _, tk := range tokens {
+		if tk.Type == tokenTypeNumber || tk.Type == tokenTypeHex {
+			got = append(got, tk.Value)
+		}
+	}
+	require.Equal(t, []string{"0", "7", "1_000_000", "0xFF_FF", "0x0", "10"}, got)
+
+	for src, msg := range map[string]string{
+		"0123":   "Invalid number 0123: leading zeros are not allowed",
+		"00":     "Invalid number 00: leading zeros are not allowed",
+		"1__000": "Invalid number 1__000: underscores may only separate digits",
+		"1_000_": "Invalid number 1_000_: underscores may only separate digits",
+		"0x_FF":  "Invalid number 0x_FF: underscores may only separate digits",
+		"0x":     "Invalid number 0x: missing digits",
+	} {
+		_, errs := lexFile([]byte(src), nil)
+		require.Len(t, errs, 1, src)
+		require.Contains(t, errs[0].Error(), msg)
+	}
+}
+
+func TestByteStringLiterals(t *testing.T) {
+	tokens, errs := lexFile([]byte(`@magic(b"\x89PNG\r\n", x"89 50 4e47", b"", b"\\\"\0é", bx)`), nil)
+	require.Empty(t, errs)
+	var got []token
+	for _, tk := range tokens {
+		if tk.Type == tokenTypeBytes || tk.Type == tokenTypeIdentifier {
+			got = append(got, token{Type: tk.Type, Value: tk.Value})
+		}
+	}
+	require.Equal(t, []token{
+		{Type: tokenTypeIdentifier, Value: "magic"},
+		{Type: tokenTypeBytes, Value: "\x89PNG\r\n"},
+		{Type: tokenTypeBytes, Value: "\x89PNG"},
+		{Type: tokenTypeBytes, Value: ""},
+		{Type: tokenTypeBytes, Value: "\\\"\x00é"},
+		{Type: tokenTypeIdentifier, Value: "bx"},
+	}, got)
+
+	for src, msg := range map[string]string{
+		`x"89 5"`:    "Invalid byte string: odd number of hexadecimal digits",
+		`x"zz"`:      "Invalid byte string: unexpected 'z', expected hexadecimal digits",
+		`b"\q"`:      `Invalid byte string: unknown escape sequence \q`,
+		`b"\x8"`:     `Invalid byte string: unknown escape sequence \x`,
+		"b\"abc\n\"": "Unterminated byte string",
+	} {
+		_, errs := lexFile([]byte(src), nil)
+		require.NotEmpty(t, errs, src)
+		require.Contains(t, errs[0].Error(), msg, src)
+	}
+}
+
+func TestBlockCommentLiterals(t *testing.T) {
+	tokens, errs := lexFile([]byte("a /* one */ b\n  /* two\n   * lines */\nc / d"), nil)
+	require.Empty(t, errs)
+	var got []token
+	for _, tk := range tokens[:len(tokens)-1] {
+		got = append(got, token{Type: tk.Type, Value: tk.Value, Line: tk.Line, Column: tk.Column, Block: tk.Block})
+	}
+	require.Equal(t, []token{
+		{Type: tokenTypeIdentifier, Value: "a", Line: 1, Column: 1},
+		{Type: tokenTypeComment, Value: " one ", Line: 1, Column: 3, Block: true},
+		{Type: tokenTypeIdentifier, Value: "b", Line: 1, Column: 13},
+		{Type: tokenTypeComment, Value: " two\n   * lines ", Line: 2, Column: 3, Block: true},
+		{Type: tokenTypeIdentifier, Value: "c", Line: 4, Column: 1},
+		{Type: tokenTypeSlash, Value: "/", Line: 4, Column: 3},
+		{Type: tokenTypeIdentifier, Value: "d", Line: 4, Column: 5},
+	}, got)
+	require.Equal(t, 3, tokens[3].lastLine())
+
+	_, errs = lexFile([]byte("a\n /* open"), nil)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "Unterminated block comment")
+	require.Contains(t, errs[0].Error(), "line 2, column 2")
+}
@@ -0,0 +1,196 @@
+package idl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestFilename is the name of the manifest file looked up by the frontend
+// when no manifest is explicitly provided.
+const ManifestFilename = "arf.mod"
+
+// Manifest represents an arf.mod file, declaring the dependencies of a schema
+// repository. Manifests are line-based:
+//
+//	# Comments start with a hash sign
+//	module acme.billing
+//	dep acme.common ../common
+//	dep acme.types
+//	severity naming-case warning
+//	option go module=example.com/acme/billing
+//
+// Dependencies without a path are looked up in vendor/<name>. Paths are
+// relative to the directory containing the manifest. Severity directives
+// override the severity of diagnostics with the given code, and accept error,
+// warning, info, or off. Option directives pass options to the generator of
+// a target language.
+type Manifest struct {
+	Path         string
+	Module       string
+	Dependencies []*Dependency
+	Severities   map[string]Severity
+
+	// Options holds the generator options declared through option
+	// directives, keyed by target and then by option name.
+	Options map[string]map[string]string
+}
+
+// Dependency represents a named dependency declared in a manifest. Imports in
+// the form "<name>/path/to/file.arf" are resolved against Dir.
+type Dependency struct {
+	Name string
+	Dir  string
+	Line int
+}
+
+// ParseManifest reads and parses the manifest at path.
+func ParseManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Path: absPath}
+	root := filepath.Dir(absPath)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if idx := strings.Index(text, "#"); idx != -1 {
+			text = text[:idx]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s, line %d: expected module <name>", path, line)
+			}
+			if m.Module != "" {
+				return nil, fmt.Errorf("%s, line %d: module declared more than once", path, line)
+			}
+			m.Module = fields[1]
+		case "dep":
+			if len(fields) < 2 || len(fields) > 3 {
+				return nil, fmt.Errorf("%s, line %d: expected dep <name> [path]", path, line)
+			}
+			name := fields[1]
+			if strings.Contains(name, "/") {
+				return nil, fmt.Errorf("%s, line %d: invalid dependency name %s", path, line, name)
+			}
+			if ex := m.Dependency(name); ex != nil {
+				return nil, fmt.Errorf("%s, line %d: dependency %s is already declared at line %d", path, line, name, ex.Line)
+			}
+			dir := filepath.Join("vendor", name)
+			if len(fields) == 3 {
+				dir = fields[2]
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+			m.Dependencies = append(m.Dependencies, &Dependency{Name: name, Dir: dir, Line: line})
+		case "severity":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%s, line %d: expected severity <code> <level>", path, line)
+			}
+			if err := validateCode(fields[1]); err != nil {
+				return nil, fmt.Errorf("%s, line %d: %w", path, line, err)
+			}
+			sev, err := ParseSeverity(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("%s, line %d: %w", path, line, err)
+			}
+			if m.Severities == nil {
+				m.Severities = map[string]Severity{}
+			}
+			m.Severities[fields[1]] = sev
+		case "option":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%s, line %d: expected option <target> <name>=<value>", path, line)
+			}
+			name, value, ok := strings.Cut(fields[2], "=")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("%s, line %d: expected option <target> <name>=<value>", path, line)
+			}
+			if m.Options == nil {
+				m.Options = map[string]map[string]string{}
+			}
+			if m.Options[fields[1]] == nil {
+				m.Options[fields[1]] = map[string]string{}
+			}
+			m.Options[fields[1]][name] = value
+		default:
+			return nil, fmt.Errorf("%s, line %d: unexpected %s", path, line, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Dependency returns the dependency named name, or nil.
+func (m *Manifest) Dependency(name string) *Dependency {
+	for _, d := range m.Dependencies {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Resolve maps an import path such as "acme.common/types.arf" to a file within
+// the matching dependency. It returns false when the import does not refer to
+// a declared dependency, and an error when it refers to a file outside of the
+// dependency directory, as in "acme.common/../../types.arf".
+func (m *Manifest) Resolve(importPath string) (string, bool, error) {
+	name, rest, ok := strings.Cut(importPath, "/")
+	if !ok {
+		return "", false, nil
+	}
+	dep := m.Dependency(name)
+	if dep == nil {
+		return "", false, nil
+	}
+	path := filepath.Join(dep.Dir, filepath.FromSlash(rest))
+	if rel, err := filepath.Rel(dep.Dir, path); err != nil || !filepath.IsLocal(rel) {
+		return "", true, fmt.Errorf("import %s is not within dependency %s", importPath, name)
+	}
+	return path, true, nil
+}
+
+// resolveDependency is like Resolve, but accepts a nil manifest.
+func (m *Manifest) resolveDependency(importPath string) (string, bool, error) {
+	if m == nil {
+		return "", false, nil
+	}
+	return m.Resolve(importPath)
+}
+
+// findManifest looks for ManifestFilename in dir and its parents.
+func findManifest(dir string) (string, bool) {
+	for {
+		candidate := filepath.Join(dir, ManifestFilename)
+		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+			return candidate, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,1246 @@
+package idl
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// ResultVersion identifies the layout of results encoded by MarshalResult.
+// Results encoded with another version are rejected by UnmarshalResult, and
+// should be recompiled.
+const ResultVersion = 1
+
+// MarshalResult encodes res, along with its tree, diagnostics and import
+// graph, so it can be cached and later restored through UnmarshalResult
+// without recompiling its files. The encoding is deterministic: encoding
+// results of the same files yields the same bytes.
+func MarshalResult(res *Result) ([]byte, error) {
+	e := &encodedResult{
+		Version: ResultVersion,
+		Files:   res.Files,
+		Imports: map[string][]encodedImport{},
+	}
+	for _, d := range res.Diagnostics {
+		e.Diagnostics = append(e.Diagnostics, encodeDiagnostic(d))
+	}
+	for path, imports := range res.Imports {
+		edges := []encodedImport{}
+		for _, imp := range imports {
+			edges = append(edges, encodedImport{
+				Path:     imp.Path,
+				Resolved: imp.Resolved,
+				Alias:    imp.Alias,
+				Package:  imp.Package,
+				Public:   imp.Public,
+				Position: encodePos(imp.Position),
+			})
+		}
+		e.Imports[path] = edges
+	}
+	if res.Tree != nil {
+		e.Tree = []*encodedFile{}
+		var files []*ast.File
+		for _, pkg := range res.Tree.Packages {
+			files = append(files, pkg.Files...)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		for _, f := range files {
+			ef, err := encodeFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Path, err)
+			}
+			e.Tree = append(e.Tree, ef)
+		}
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalResult decodes a result encoded by MarshalResult, resolving
+// references between declarations as the compilation did.
+func UnmarshalResult(data []byte) (*Result, error) {
+	var e encodedResult
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Version != ResultVersion {
+		return nil, fmt.Errorf("unsupported result version %d", e.Version)
+	}
+
+	res := &Result{Files: e.Files, Diagnostics: []*Diagnostic{}, Imports: ImportGraph{}}
+	for _, ed := range e.Diagnostics {
+		d, err := decodeDiagnostic(ed)
+		if err != nil {
+			return nil, err
+		}
+		res.Diagnostics = append(res.Diagnostics, d)
+	}
+	for path, edges := range e.Imports {
+		imports := make([]ResolvedImport, 0, len(edges))
+		for _, imp := range edges {
+			imports = append(imports, ResolvedImport{
+				Path:     imp.Path,
+				Resolved: imp.Resolved,
+				Alias:    imp.Alias,
+				Package:  imp.Package,
+				Public:   imp.Public,
+				Position: imp.Position.decode(path, nil),
+			})
+		}
+		res.Imports[path] = imports
+	}
+	if e.Tree == nil {
+		return res, nil
+	}
+
+	d := &decoder{objects: map[encodedRef]ast.Object{}}
+	res.Tree = &ast.Tree{}
+	var files []*ast.File
+	for _, ef := range e.Tree {
+		files = append(files, d.file(ef))
+	}
+	for _, f := range files {
+		d.index(f)
+	}
+	for _, s := range d.reopening {
+		original, ok := d.objects[encodedRef{Kind: s.Kind(), FQN: s.FQN()}].(*ast.Struct)
+		if !ok {
+			return nil, fmt.Errorf("struct %s re-opens an unknown declaration", s.FQN())
+		}
+		s.Reopens = original
+		original.Fields = append(original.Fields, s.Fields...)
+	}
+	for _, f := range files {
+		res.Tree.AddFile(f)
+	}
+	for _, fixup := range d.fixups {
+		if err := fixup(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type encodedResult struct {
+	Version     int                        `json:"version"`
+	Files       []string                   `json:"files"`
+	Diagnostics []encodedDiagnostic        `json:"diagnostics,omitempty"`
+	Imports     map[string][]encodedImport `json:"imports"`
+	// Tree lists the files of the tree, sorted by path. It is nil when the
+	// result has no tree.
+	Tree []*encodedFile `json:"tree"`
+}
+
+type encodedPos struct {
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// encodePos encodes pos, omitting its filename when it is the one of the
+// file the position belongs to.
+func encodePos(pos ast.Position) encodedPos {
+	if pos.File != nil && pos.File.Path == pos.Filename {
+		pos.Filename = ""
+	}
+	return encodedPos{Filename: pos.Filename, Line: pos.Line, Column: pos.Column}
+}
+
+func (p encodedPos) decode(filename string, f *ast.File) ast.Position {
+	if p.Filename != "" {
+		filename = p.Filename
+	}
+	return ast.Position{Filename: filename, Line: p.Line, Column: p.Column, File: f}
+}
+
+type encodedDiagnostic struct {
+	Severity string       `json:"severity"`
+	Position encodedPos   `json:"position"`
+	Message  string       `json:"message"`
+	Code     string       `json:"code,omitempty"`
+	Fixes    []encodedFix `json:"fixes,omitempty"`
+}
+
+type encodedFix struct {
+	Title string        `json:"title"`
+	Edits []encodedEdit `json:"edits"`
+}
+
+type encodedEdit struct {
+	Start   encodedPos `json:"start"`
+	End     encodedPos `json:"end"`
+	NewText string     `json:"new_text"`
+}
+
+func encodeDiagnostic(d *Diagnostic) encodedDiagnostic {
+	ed := encodedDiagnostic{
+		Severity: d.Severity.String(),
+		Position: encodedPos{Filename: d.Position.Filename, Line: d.Position.Line, Column: d.Position.Column},
+		Message:  d.Message,
+		Code:     d.Code,
+	}
+	for _, fix := range d.Fixes {
+		ef := encodedFix{Title: fix.Title, Edits: []encodedEdit{}}
+		for _, edit := range fix.Edits {
+			ef.Edits = append(ef.Edits, encodedEdit{
+				Start:   encodedPos{Filename: edit.Start.Filename, Line: edit.Start.Line, Column: edit.Start.Column},
+				End:     encodedPos{Filename: edit.End.Filename, Line: edit.End.Line, Column: edit.End.Column},
+				NewText: edit.NewText,
+			})
+		}
+		ed.Fixes = append(ed.Fixes, ef)
+	}
+	return ed
+}
+
+func decodeDiagnostic(ed encodedDiagnostic) (*Diagnostic, error) {
+	sev, err := ParseSeverity(ed.Severity)
+	if err != nil {
+		return nil, err
+	}
+	d := &Diagnostic{Severity: sev, Position: ed.Position.decode("", nil), Message: ed.Message, Code: ed.Code}
+	for _, ef := range ed.Fixes {
+		fix := &Fix{Title: ef.Title}
+		for _, edit := range ef.Edits {
+			fix.Edits = append(fix.Edits, TextEdit{Start: edit.Start.decode("", nil), End: edit.End.decode("", nil), NewText: edit.NewText})
+		}
+		d.Fixes = append(d.Fixes, fix)
+	}
+	return d, nil
+}
+
+type encodedImport struct {
+	Path             string      `json:"path"`
+	Resolved         string      `json:"resolved"`
+	Alias            string      `json:"alias,omitempty"`
+	AliasSynthesized bool        `json:"alias_synthesized,omitempty"`
+	Public           bool        `json:"public,omitempty"`
+	ByPackage        bool        `json:"by_package,omitempty"`
+	Files            []string    `json:"files,omitempty"`
+	Package          string      `json:"package,omitempty"`
+	Position         encodedPos  `json:"position"`
+	PathEnd          *encodedPos `json:"path_end,omitempty"`
+	End              *encodedPos `json:"end,omitempty"`
+
+	Annotations []encodedAnnotation `json:"annotations,omitempty"`
+}
+
+// encodedRef identifies a declaration referenced by another one, such as
+// the struct a field type resolved to.
+type encodedRef struct {
+	Kind string `json:"kind"`
+	FQN  string `json:"fqn"`
+}
+
+func encodeRef(obj ast.Object) *encodedRef {
+	if obj == nil {
+		return nil
+	}
+	return &encodedRef{Kind: obj.Kind(), FQN: obj.FQN()}
+}
+
+type encodedFile struct {
+	Path          string            `json:"path"`
+	Package       encodedPackage    `json:"package"`
+	Imports       []encodedImport   `json:"imports,omitempty"`
+	ImportAliases map[string]string `json:"import_aliases,omitempty"`
+	Structs       []*encodedStruct  `json:"structs,omitempty"`
+	Enums         []*encodedEnum    `json:"enums,omitempty"`
+	Services      []*encodedService `json:"services,omitempty"`
+	Consts        []*encodedConst   `json:"consts,omitempty"`
+}
+
+type encodedConst struct {
+	Position        encodedPos          `json:"position"`
+	Name            string              `json:"name"`
+	Comment         []string            `json:"comment,omitempty"`
+	Annotations     []encodedAnnotation `json:"annotations,omitempty"`
+	Type            *encodedType        `json:"type"`
+	Expr            *encodedExpr        `json:"expr,omitempty"`
+	Literal         *encodedValue       `json:"literal,omitempty"`
+	Value           *encodedValue       `json:"value,omitempty"`
+	TrailingComment string              `json:"trailing_comment,omitempty"`
+}
+
+type encodedPackage struct {
+	Position    encodedPos          `json:"position"`
+	Comment     []string            `json:"comment,omitempty"`
+	Value       string              `json:"value"`
+	Components  []string            `json:"components"`
+	Annotations []encodedAnnotation `json:"annotations,omitempty"`
+}
+
+type encodedStruct struct {
+	Position    encodedPos            `json:"position"`
+	End         encodedPos            `json:"end"`
+	Name        string                `json:"name"`
+	Inline      bool                  `json:"inline,omitempty"`
+	Reopens     bool                  `json:"reopens,omitempty"`
+	Extends     *encodedType          `json:"extends,omitempty"`
+	Comment     []string              `json:"comment,omitempty"`
+	Annotations []encodedAnnotation   `json:"annotations,omitempty"`
+	Fields      []*encodedStructField `json:"fields,omitempty"`
+	Unions      []*encodedUnion       `json:"unions,omitempty"`
+	Reserved    []*encodedReserved    `json:"reserved,omitempty"`
+	Structs     []*encodedStruct      `json:"structs,omitempty"`
+	Enums       []*encodedEnum        `json:"enums,omitempty"`
+}
+
+type encodedUnion struct {
+	Position    encodedPos          `json:"position"`
+	End         encodedPos          `json:"end"`
+	Name        string              `json:"name"`
+	Comment     []string            `json:"comment,omitempty"`
+	Annotations []encodedAnnotation `json:"annotations,omitempty"`
+}
+
+type encodedReserved struct {
+	Position encodedPos `json:"position"`
+	Indices  []int      `json:"indices,omitempty"`
+	Names    []string   `json:"names,omitempty"`
+}
+
+type encodedStructField struct {
+	Position        encodedPos          `json:"position"`
+	Name            string              `json:"name"`
+	Comment         []string            `json:"comment,omitempty"`
+	Annotations     []encodedAnnotation `json:"annotations,omitempty"`
+	Type            *encodedType        `json:"type"`
+	TrailingComment string              `json:"trailing_comment,omitempty"`
+	Union           string              `json:"union,omitempty"`
+	Index           int                 `json:"index"`
+	IndexDeclared   bool                `json:"index_declared,omitempty"`
+	Default         *encodedValue       `json:"default,omitempty"`
+	DefaultRef      *encodedValue       `json:"default_ref,omitempty"`
+	Constraints     *encodedConstraints `json:"constraints,omitempty"`
+}
+
+type encodedConstraints struct {
+	MaxLength uint64        `json:"max_length,omitempty"`
+	Min       *encodedValue `json:"min,omitempty"`
+	Max       *encodedValue `json:"max,omitempty"`
+}
+
+type encodedEnum struct {
+	Position    encodedPos           `json:"position"`
+	End         encodedPos           `json:"end"`
+	Name        string               `json:"name"`
+	Comment     []string             `json:"comment,omitempty"`
+	Annotations []encodedAnnotation  `json:"annotations,omitempty"`
+	Members     []*encodedEnumMember `json:"members,omitempty"`
+	Reserved    []*encodedReserved   `json:"reserved,omitempty"`
+	Flags       bool                 `json:"flags,omitempty"`
+}
+
+type encodedEnumMember struct {
+	Position        encodedPos          `json:"position"`
+	Name            string              `json:"name"`
+	Comment         []string            `json:"comment,omitempty"`
+	Annotations     []encodedAnnotation `json:"annotations,omitempty"`
+	Value           int                 `json:"value"`
+	Expr            *encodedExpr        `json:"expr,omitempty"`
+	Implicit        bool                `json:"implicit,omitempty"`
+	TrailingComment string              `json:"trailing_comment,omitempty"`
+}
+
+type encodedService struct {
+	Position    encodedPos          `json:"position"`
+	End         encodedPos          `json:"end"`
+	Name        string              `json:"name"`
+	Comment     []string            `json:"comment,omitempty"`
+	Annotations []encodedAnnotation `json:"annotations,omitempty"`
+	Methods     []*encodedMethod    `json:"methods,omitempty"`
+	Timeout     time.Duration       `json:"timeout,omitempty"`
+	ID          uint32              `json:"id,omitempty"`
+	Errors      *encodedRef         `json:"errors,omitempty"`
+}
+
+type encodedMethod struct {
+	Position        encodedPos          `json:"position"`
+	End             encodedPos          `json:"end"`
+	Name            string              `json:"name"`
+	Comment         []string            `json:"comment,omitempty"`
+	Annotations     []encodedAnnotation `json:"annotations,omitempty"`
+	Params          []encodedParam      `json:"params,omitempty"`
+	Returns         []encodedParam      `json:"returns,omitempty"`
+	Errors          []encodedParam      `json:"errors,omitempty"`
+	HTTP            *encodedHTTP        `json:"http,omitempty"`
+	TrailingComment string              `json:"trailing_comment,omitempty"`
+	Idempotent      bool                `json:"idempotent,omitempty"`
+	ReadOnly        bool                `json:"read_only,omitempty"`
+	Timeout         time.Duration       `json:"timeout,omitempty"`
+	ID              uint32              `json:"id,omitempty"`
+	ErrorCodes      []*encodedRef       `json:"error_codes,omitempty"`
+	ClientStreaming bool                `json:"client_streaming,omitempty"`
+	ServerStreaming bool                `json:"server_streaming,omitempty"`
+}
+
+// encodedParam encodes method params, along with returns and errors, which
+// have no name.
+type encodedParam struct {
+	Position encodedPos   `json:"position"`
+	Name     *string      `json:"name,omitempty"`
+	Stream   bool         `json:"stream,omitempty"`
+	Type     *encodedType `json:"type"`
+}
+
+type encodedHTTP struct {
+	Position encodedPos           `json:"position"`
+	Method   string               `json:"method"`
+	Path     string               `json:"path"`
+	Segments []encodedHTTPSegment `json:"segments,omitempty"`
+}
+
+type encodedHTTPSegment struct {
+	Literal  string      `json:"literal,omitempty"`
+	Variable []string    `json:"variable,omitempty"`
+	Field    *encodedRef `json:"field,omitempty"`
+}
+
+type encodedAnnotation struct {
+	Position       encodedPos             `json:"position"`
+	Name           string                 `json:"name"`
+	Arguments      []*encodedValue        `json:"arguments,omitempty"`
+	NamedArguments []encodedNamedArgument `json:"named_arguments,omitempty"`
+}
+
+type encodedNamedArgument struct {
+	Position encodedPos    `json:"position"`
+	Name     string        `json:"name"`
+	Value    *encodedValue `json:"value"`
+}
+
+// encodedValue encodes annotation arguments and default values, whose Go
+// type is recorded by Type.
+type encodedValue struct {
+	Type     string        `json:"type"`
+	String   string        `json:"string,omitempty"`
+	Bytes    []byte        `json:"bytes,omitempty"`
+	Int      int64         `json:"int,omitempty"`
+	Uint     uint64        `json:"uint,omitempty"`
+	Float    float64       `json:"float,omitempty"`
+	Bool     bool          `json:"bool,omitempty"`
+	Time     *time.Time    `json:"time,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Position *encodedPos   `json:"position,omitempty"`
+	Resolved *encodedRef   `json:"resolved,omitempty"`
+}
+
+type encodedType struct {
+	Kind       string       `json:"kind"`
+	Position   encodedPos   `json:"position"`
+	Name       string       `json:"name,omitempty"`
+	Package    string       `json:"package,omitempty"`
+	FullName   string       `json:"full_name,omitempty"`
+	Components []string     `json:"components,omitempty"`
+	FQN        string       `json:"fqn,omitempty"`
+	Resolved   *encodedRef  `json:"resolved,omitempty"`
+	Key        *encodedType `json:"key,omitempty"`
+	Elem       *encodedType `json:"elem,omitempty"`
+}
+
+type encodedExpr struct {
+	Kind     string       `json:"kind"`
+	Position encodedPos   `json:"position"`
+	Raw      string       `json:"raw,omitempty"`
+	Value    int64        `json:"value,omitempty"`
+	Unsigned bool         `json:"unsigned,omitempty"`
+	Name     string       `json:"name,omitempty"`
+	Resolved *encodedRef  `json:"resolved,omitempty"`
+	Op       string       `json:"op,omitempty"`
+	X        *encodedExpr `json:"x,omitempty"`
+	Y        *encodedExpr `json:"y,omitempty"`
+}
+
+func encodeFile(f *ast.File) (*encodedFile, error) {
+	anns, err := encodeAnnotations(f.Package.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	ef := &encodedFile{
+		Path: f.Path,
+		Package: encodedPackage{
+			Position:    encodePos(f.Package.Position),
+			Comment:     f.Package.Comment,
+			Value:       f.Package.Value,
+			Components:  f.Package.Components,
+			Annotations: anns,
+		},
+		ImportAliases: f.ImportAliases,
+	}
+	for _, imp := range f.Imports {
+		anns, err := encodeAnnotations(imp.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		pathEnd, end := encodePos(imp.PathEnd), encodePos(imp.End)
+		ef.Imports = append(ef.Imports, encodedImport{
+			Path:             imp.Value,
+			Resolved:         imp.ResolvedValue,
+			Alias:            imp.Alias,
+			AliasSynthesized: imp.AliasSynthesized,
+			Public:           imp.Public,
+			ByPackage:        imp.ByPackage,
+			Files:            imp.Files,
+			Position:         encodePos(imp.Position),
+			PathEnd:          &pathEnd,
+			End:              &end,
+			Annotations:      anns,
+		})
+	}
+	for _, s := range f.Structs {
+		es, err := encodeStruct(s)
+		if err != nil {
+			return nil, err
+		}
+		ef.Structs = append(ef.Structs, es)
+	}
+	for _, e := range f.Enums {
+		ee, err := encodeEnum(e)
+		if err != nil {
+			return nil, err
+		}
+		ef.Enums = append(ef.Enums, ee)
+	}
+	for _, s := range f.Services {
+		es, err := encodeService(s)
+		if err != nil {
+			return nil, err
+		}
+		ef.Services = append(ef.Services, es)
+	}
+	for _, c := range f.Consts {
+		ec, err := encodeConst(c)
+		if err != nil {
+			return nil, err
+		}
+		ef.Consts = append(ef.Consts, ec)
+	}
+	return ef, nil
+}
+
+func encodeConst(c *ast.Const) (*encodedConst, error) {
+	anns, err := encodeAnnotations(c.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	ec := &encodedConst{
+		Position:        encodePos(c.Position),
+		Name:            c.Name,
+		Comment:         c.Comment,
+		Annotations:     anns,
+		Type:            encodeType(c.Type),
+		Expr:            encodeExpr(c.Expr),
+		TrailingComment: c.TrailingComment,
+	}
+	// Literals and values are primitives, which always encode
+	if c.Literal != nil {
+		ec.Literal, _ = encodeValue(c.Literal)
+	}
+	if c.Value != nil {
+		ec.Value, _ = encodeValue(c.Value)
+	}
+	return ec, nil
+}
+
+func encodeStruct(s *ast.Struct) (*encodedStruct, error) {
+	anns, err := encodeAnnotations(s.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	es := &encodedStruct{
+		Position:    encodePos(s.Position),
+		End:         encodePos(s.End),
+		Name:        s.Name,
+		Inline:      s.Inline,
+		Reopens:     s.Reopens != nil,
+		Comment:     s.Comment,
+		Annotations: anns,
+	}
+	for _, f := range s.Fields {
+		if f.Parent != s {
+			// Merged from a re-opening declaration, which encodes it
+			continue
+		}
+		ef := &encodedStructField{
+			Position:        encodePos(f.Position),
+			Name:            f.Name,
+			Comment:         f.Comment,
+			Type:            encodeType(f.Type),
+			TrailingComment: f.TrailingComment,
+			Index:           f.Index,
+			IndexDeclared:   f.IndexDeclared,
+		}
+		if f.Union != nil {
+			ef.Union = f.Union.Name
+		}
+		if ef.Annotations, err = encodeAnnotations(f.Annotations); err != nil {
+			return nil, err
+		}
+		if f.Default != nil {
+			if ef.Default, err = encodeValue(f.Default); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.FQN(), err)
+			}
+		}
+		if f.DefaultRef != nil {
+			ef.DefaultRef, _ = encodeValue(f.DefaultRef)
+		}
+		if c := f.Constraints; c != nil {
+			ef.Constraints = &encodedConstraints{MaxLength: c.MaxLength}
+			if c.Min != nil {
+				// Bounds are numbers, which always encode
+				ef.Constraints.Min, _ = encodeValue(c.Min)
+				ef.Constraints.Max, _ = encodeValue(c.Max)
+			}
+		}
+		es.Fields = append(es.Fields, ef)
+	}
+	for _, u := range s.Unions {
+		eu := &encodedUnion{
+			Position: encodePos(u.Position),
+			End:      encodePos(u.End),
+			Name:     u.Name,
+			Comment:  u.Comment,
+		}
+		if eu.Annotations, err = encodeAnnotations(u.Annotations); err != nil {
+			return nil, err
+		}
+		es.Unions = append(es.Unions, eu)
+	}
+	es.Reserved = encodeReserved(s.Reserved)
+	if s.Extends != nil {
+		es.Extends = encodeType(s.Extends)
+	}
+	for _, n := range s.Structs {
+		en, err := encodeStruct(n)
+		if err != nil {
+			return nil, err
+		}
+		es.Structs = append(es.Structs, en)
+	}
+	for _, e := range s.Enums {
+		ee, err := encodeEnum(e)
+		if err != nil {
+			return nil, err
+		}
+		es.Enums = append(es.Enums, ee)
+	}
+	return es, nil
+}
+
+func encodeReserved(reserved []*ast.Reserved) []*encodedReserved {
+	var res []*encodedReserved
+	for _, r := range reserved {
+		res = append(res, &encodedReserved{Position: encodePos(r.Position), Indices: r.Indices, Names: r.Names})
+	}
+	return res
+}
+
+func encodeEnum(e *ast.Enum) (*encodedEnum, error) {
+	anns, err := encodeAnnotations(e.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	ee := &encodedEnum{
+		Position:    encodePos(e.Position),
+		End:         encodePos(e.End),
+		Name:        e.Name,
+		Comment:     e.Comment,
+		Annotations: anns,
+		Reserved:    encodeReserved(e.Reserved),
+		Flags:       e.Flags,
+	}
+	for _, m := range e.Members {
+		em := &encodedEnumMember{
+			Position:        encodePos(m.Position),
+			Name:            m.Name,
+			Comment:         m.Comment,
+			Value:           m.Value,
+			Expr:            encodeExpr(m.Expr),
+			Implicit:        m.Implicit,
+			TrailingComment: m.TrailingComment,
+		}
+		if em.Annotations, err = encodeAnnotations(m.Annotations); err != nil {
+			return nil, err
+		}
+		ee.Members = append(ee.Members, em)
+	}
+	return ee, nil
+}
+
+func encodeService(s *ast.Service) (*encodedService, error) {
+	anns, err := encodeAnnotations(s.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	es := &encodedService{
+		Position:    encodePos(s.Position),
+		End:         encodePos(s.End),
+		Name:        s.Name,
+		Comment:     s.Comment,
+		Annotations: anns,
+		Timeout:     s.Timeout,
+		ID:          s.ID,
+	}
+	if s.Errors != nil {
+		es.Errors = encodeRef(s.Errors)
+	}
+	for _, m := range s.Methods {
+		em := &encodedMethod{
+			Position:        encodePos(m.Position),
+			End:             encodePos(m.End),
+			Name:            m.Name,
+			Comment:         m.Comment,
+			TrailingComment: m.TrailingComment,
+			Idempotent:      m.Idempotent,
+			ReadOnly:        m.ReadOnly,
+			Timeout:         m.Timeout,
+			ID:              m.ID,
+			ClientStreaming: m.ClientStreaming,
+			ServerStreaming: m.ServerStreaming,
+		}
+		if em.Annotations, err = encodeAnnotations(m.Annotations); err != nil {
+			return nil, err
+		}
+		for _, p := range m.Params {
+			em.Params = append(em.Params, encodedParam{Position: encodePos(p.Position), Name: p.Name, Stream: p.Stream, Type: encodeType(p.Type)})
+		}
+		for _, r := range m.Returns {
+			em.Returns = append(em.Returns, encodedParam{Position: encodePos(r.Position), Stream: r.Stream, Type: encodeType(r.Type)})
+		}
+		for _, e := range m.Errors {
+			em.Errors = append(em.Errors, encodedParam{Position: encodePos(e.Position), Type: encodeType(e.Type)})
+		}
+		if m.HTTP != nil {
+			em.HTTP = &encodedHTTP{Position: encodePos(m.HTTP.Position), Method: m.HTTP.Method, Path: m.HTTP.Path}
+			for _, seg := range m.HTTP.Segments {
+				es := encodedHTTPSegment{Literal: seg.Literal, Variable: seg.Variable}
+				if seg.Field != nil {
+					es.Field = encodeRef(seg.Field)
+				}
+				em.HTTP.Segments = append(em.HTTP.Segments, es)
+			}
+		}
+		for _, code := range m.ErrorCodes {
+			em.ErrorCodes = append(em.ErrorCodes, encodeRef(code))
+		}
+		es.Methods = append(es.Methods, em)
+	}
+	return es, nil
+}
+
+func encodeAnnotations(set ast.AnnotationSet) ([]encodedAnnotation, error) {
+	var res []encodedAnnotation
+	for _, a := range set {
+		ea := encodedAnnotation{Position: encodePos(a.Position), Name: a.Name}
+		for _, arg := range a.Arguments {
+			v, err := encodeValue(arg)
+			if err != nil {
+				return nil, fmt.Errorf("@%s: %w", a.Name, err)
+			}
+			ea.Arguments = append(ea.Arguments, v)
+		}
+		for _, arg := range a.NamedArguments {
+			v, err := encodeValue(arg.Value)
+			if err != nil {
+				return nil, fmt.Errorf("@%s: %w", a.Name, err)
+			}
+			ea.NamedArguments = append(ea.NamedArguments, encodedNamedArgument{Position: encodePos(arg.Position), Name: arg.Name, Value: v})
+		}
+		res = append(res, ea)
+	}
+	return res, nil
+}
+
+func encodeValue(v any) (*encodedValue, error) {
+	switch v := v.(type) {
+	case string:
+		return &encodedValue{Type: "string", String: v}, nil
+	case []byte:
+		return &encodedValue{Type: "bytes", Bytes: v}, nil
+	case int64:
+		return &encodedValue{Type: "int", Int: v}, nil
+	case uint64:
+		return &encodedValue{Type: "uint", Uint: v}, nil
+	case float64:
+		return &encodedValue{Type: "float", Float: v}, nil
+	case bool:
+		return &encodedValue{Type: "bool", Bool: v}, nil
+	case time.Time:
+		return &encodedValue{Type: "time", Time: &v}, nil
+	case time.Duration:
+		return &encodedValue{Type: "duration", Duration: v}, nil
+	case *ast.AnnotationReference:
+		pos := encodePos(v.Position)
+		return &encodedValue{Type: "reference", String: v.Name, Position: &pos, Resolved: encodeRef(v.ResolvedObject)}, nil
+	case *ast.EnumMember:
+		return &encodedValue{Type: "member", Resolved: encodeRef(v)}, nil
+	default:
+		return nil, fmt.Errorf("cannot encode value of type %T", v)
+	}
+}
+
+func encodeType(t ast.Type) *encodedType {
+	switch t := t.(type) {
+	case *ast.PrimitiveType:
+		return &encodedType{Kind: "primitive", Position: encodePos(t.Position), Name: t.Name}
+	case *ast.ArrayType:
+		return &encodedType{Kind: "array", Position: encodePos(t.Position), Elem: encodeType(t.Type)}
+	case *ast.SetType:
+		return &encodedType{Kind: "set", Position: encodePos(t.Position), Elem: encodeType(t.Type)}
+	case *ast.OptionalType:
+		return &encodedType{Kind: "optional", Position: encodePos(t.Position), Elem: encodeType(t.Type)}
+	case *ast.MapType:
+		return &encodedType{Kind: "map", Position: encodePos(t.Position), Key: encodeType(t.Key), Elem: encodeType(t.Value)}
+	case *ast.EmptyType:
+		return &encodedType{Kind: "empty", Position: encodePos(t.Position)}
+	case *ast.SimpleUserType:
+		return &encodedType{Kind: "simple", Position: encodePos(t.Position), Name: t.Name, FQN: t.FullQualifiedName, Resolved: encodeRef(t.ResolvedType)}
+	case *ast.FullQualifiedType:
+		return &encodedType{
+			Kind:       "qualified",
+			Position:   encodePos(t.Position),
+			Name:       t.Name,
+			Package:    t.Package,
+			FullName:   t.FullName,
+			Components: t.Components,
+			FQN:        t.FullQualifiedName,
+			Resolved:   encodeRef(t.ResolvedType),
+		}
+	}
+	return nil
+}
+
+func encodeExpr(x ast.Expr) *encodedExpr {
+	switch x := x.(type) {
+	case *ast.IntLiteral:
+		return &encodedExpr{Kind: "int", Position: encodePos(x.Position), Raw: x.Raw, Value: x.Value, Unsigned: x.Unsigned}
+	case *ast.ConstRef:
+		return &encodedExpr{Kind: "ref", Position: encodePos(x.Position), Name: x.Name, Resolved: encodeRef(x.Resolved)}
+	case *ast.UnaryExpr:
+		return &encodedExpr{Kind: "unary", Position: encodePos(x.Position), Op: x.Op, X: encodeExpr(x.X)}
+	case *ast.BinaryExpr:
+		return &encodedExpr{Kind: "binary", Position: encodePos(x.Position), Op: x.Op, X: encodeExpr(x.X), Y: encodeExpr(x.Y)}
+	case *ast.ParenExpr:
+		return &encodedExpr{Kind: "paren", Position: encodePos(x.Position), X: encodeExpr(x.X)}
+	}
+	return nil
+}
+
+// decoder rebuilds trees encoded by MarshalResult. References between
+// declarations can only be resolved once every file is decoded: they are
+// recorded as fixups, run once declarations are indexed.
+type decoder struct {
+	objects map[encodedRef]ast.Object
+	fixups  []func() error
+
+	// reopening lists the structs re-opening another declaration, which are
+	// linked to it once every file is indexed.
+	reopening []*ast.Struct
+}
+
+// resolve records a fixup calling set with the object ref points to.
+func (d *decoder) resolve(ref *encodedRef, set func(ast.Object)) {
+	if ref == nil {
+		return
+	}
+	d.fixups = append(d.fixups, func() error {
+		obj, ok := d.objects[*ref]
+		if !ok {
+			return fmt.Errorf("unknown %s %s", ref.Kind, ref.FQN)
+		}
+		set(obj)
+		return nil
+	})
+}
+
+// index records every declaration of f, so references can be resolved.
+func (d *decoder) index(f *ast.File) {
+	add := func(obj ast.Object) { d.objects[encodedRef{Kind: obj.Kind(), FQN: obj.FQN()}] = obj }
+	var enum func(e *ast.Enum)
+	enum = func(e *ast.Enum) {
+		add(e)
+		for _, m := range e.Members {
+			add(m)
+		}
+	}
+	var structure func(s *ast.Struct)
+	structure = func(s *ast.Struct) {
+		if !slices.Contains(d.reopening, s) {
+			add(s)
+		}
+		for _, f := range s.Fields {
+			add(f)
+		}
+		for _, n := range s.Structs {
+			structure(n)
+		}
+		for _, e := range s.Enums {
+			enum(e)
+		}
+	}
+	for _, s := range f.Structs {
+		structure(s)
+	}
+	for _, e := range f.Enums {
+		enum(e)
+	}
+	for _, s := range f.Services {
+		add(s)
+		for _, m := range s.Methods {
+			add(m)
+		}
+	}
+	for _, c := range f.Consts {
+		add(c)
+	}
+}
+
+func (d *decoder) file(ef *encodedFile) *ast.File {
+	f := &ast.File{Path: ef.Path, ImportAliases: ef.ImportAliases}
+	if f.ImportAliases == nil {
+		f.ImportAliases = map[string]string{}
+	}
+	f.Package = &ast.Package{
+		Position:    ef.Package.Position.decode(f.Path, f),
+		Comment:     ef.Package.Comment,
+		Value:       ef.Package.Value,
+		Components:  ef.Package.Components,
+		Annotations: d.annotations(f, ef.Package.Annotations),
+	}
+	for _, imp := range ef.Imports {
+		f.Imports = append(f.Imports, &ast.Import{
+			Position:         imp.Position.decode(f.Path, f),
+			Value:            imp.Path,
+			ResolvedValue:    imp.Resolved,
+			Alias:            imp.Alias,
+			AliasSynthesized: imp.AliasSynthesized,
+			Public:           imp.Public,
+			ByPackage:        imp.ByPackage,
+			Files:            imp.Files,
+			Annotations:      d.annotations(f, imp.Annotations),
+		})
+		if imp.PathEnd != nil && imp.End != nil {
+			last := f.Imports[len(f.Imports)-1]
+			last.PathEnd, last.End = imp.PathEnd.decode(f.Path, f), imp.End.decode(f.Path, f)
+		}
+	}
+	for _, es := range ef.Structs {
+		f.Structs = append(f.Structs, d.structure(f, es))
+	}
+	for _, ee := range ef.Enums {
+		f.Enums = append(f.Enums, d.enum(f, ee))
+	}
+	for _, es := range ef.Services {
+		f.Services = append(f.Services, d.service(f, es))
+	}
+	for _, ec := range ef.Consts {
+		f.Consts = append(f.Consts, d.constant(f, ec))
+	}
+	return f
+}
+
+func (d *decoder) constant(f *ast.File, ec *encodedConst) *ast.Const {
+	c := &ast.Const{
+		Position:        d.pos(f, ec.Position),
+		Name:            ec.Name,
+		Comment:         ec.Comment,
+		Annotations:     d.annotations(f, ec.Annotations),
+		Type:            d.typ(f, ec.Type),
+		Expr:            d.expr(f, ec.Expr),
+		TrailingComment: ec.TrailingComment,
+	}
+	if ec.Literal != nil {
+		d.value(f, ec.Literal, func(v any) { c.Literal = v })
+	}
+	if ec.Value != nil {
+		d.value(f, ec.Value, func(v any) { c.Value = v })
+	}
+	return c
+}
+
+func (d *decoder) pos(f *ast.File, p encodedPos) ast.Position {
+	return p.decode(f.Path, f)
+}
+
+func (d *decoder) structure(f *ast.File, es *encodedStruct) *ast.Struct {
+	s := &ast.Struct{
+		Position:    d.pos(f, es.Position),
+		End:         d.pos(f, es.End),
+		Name:        es.Name,
+		Inline:      es.Inline,
+		Comment:     es.Comment,
+		Annotations: d.annotations(f, es.Annotations),
+	}
+	if es.Reopens {
+		d.reopening = append(d.reopening, s)
+	}
+	unions := map[string]*ast.Union{}
+	for _, eu := range es.Unions {
+		u := &ast.Union{
+			Position:    d.pos(f, eu.Position),
+			End:         d.pos(f, eu.End),
+			Name:        eu.Name,
+			Comment:     eu.Comment,
+			Annotations: d.annotations(f, eu.Annotations),
+			Parent:      s,
+		}
+		unions[u.Name] = u
+		s.Unions = append(s.Unions, u)
+	}
+	s.Reserved = d.reserved(f, es.Reserved)
+	if rt, ok := d.typ(f, es.Extends).(ast.ResolvableType); ok {
+		s.Extends = rt
+	}
+	for _, ef := range es.Fields {
+		s.AppendField(ast.StructField{
+			Position:        d.pos(f, ef.Position),
+			Name:            ef.Name,
+			Comment:         ef.Comment,
+			Annotations:     d.annotations(f, ef.Annotations),
+			Type:            d.typ(f, ef.Type),
+			TrailingComment: ef.TrailingComment,
+			IndexDeclared:   ef.IndexDeclared,
+		})
+		field := s.Fields[len(s.Fields)-1]
+		// Fields merged into re-opened structs are not indexed by their
+		// position within the declaration
+		field.Index = ef.Index
+		if u := unions[ef.Union]; u != nil {
+			field.Union = u
+			u.Fields = append(u.Fields, field)
+		}
+		if ef.Default != nil {
+			d.value(f, ef.Default, func(v any) { field.Default = v })
+		}
+		if ef.DefaultRef != nil {
+			d.value(f, ef.DefaultRef, func(v any) { field.DefaultRef, _ = v.(*ast.AnnotationReference) })
+		}
+		if ec := ef.Constraints; ec != nil {
+			field.Constraints = &ast.Constraints{MaxLength: ec.MaxLength}
+			if ec.Min != nil && ec.Max != nil {
+				d.value(f, ec.Min, func(v any) { field.Constraints.Min = v })
+				d.value(f, ec.Max, func(v any) { field.Constraints.Max = v })
+			}
+		}
+	}
+	for _, en := range es.Structs {
+		s.AppendStruct(d.structure(f, en))
+	}
+	for _, ee := range es.Enums {
+		s.AppendEnum(d.enum(f, ee))
+	}
+	return s
+}
+
+func (d *decoder) reserved(f *ast.File, encoded []*encodedReserved) []*ast.Reserved {
+	var res []*ast.Reserved
+	for _, er := range encoded {
+		res = append(res, &ast.Reserved{Position: d.pos(f, er.Position), Indices: er.Indices, Names: er.Names})
+	}
+	return res
+}
+
+func (d *decoder) enum(f *ast.File, ee *encodedEnum) *ast.Enum {
+	e := &ast.Enum{
+		Position:    d.pos(f, ee.Position),
+		End:         d.pos(f, ee.End),
+		Name:        ee.Name,
+		Comment:     ee.Comment,
+		Annotations: d.annotations(f, ee.Annotations),
+		Reserved:    d.reserved(f, ee.Reserved),
+		Flags:       ee.Flags,
+	}
+	for _, em := range ee.Members {
+		e.AppendMember(ast.EnumMember{
+			Position:        d.pos(f, em.Position),
+			Name:            em.Name,
+			Comment:         em.Comment,
+			Annotations:     d.annotations(f, em.Annotations),
+			Value:           em.Value,
+			Expr:            d.expr(f, em.Expr),
+			Implicit:        em.Implicit,
+			TrailingComment: em.TrailingComment,
+		})
+	}
+	return e
+}
+
+func (d *decoder) service(f *ast.File, es *encodedService) *ast.Service {
+	s := &ast.Service{
+		Position:    d.pos(f, es.Position),
+		End:         d.pos(f, es.End),
+		Name:        es.Name,
+		Comment:     es.Comment,
+		Annotations: d.annotations(f, es.Annotations),
+		Timeout:     es.Timeout,
+		ID:          es.ID,
+	}
+	d.resolve(es.Errors, func(obj ast.Object) { s.Errors, _ = obj.(*ast.Enum) })
+	for _, em := range es.Methods {
+		m := &ast.ServiceMethod{
+			Position:        d.pos(f, em.Position),
+			End:             d.pos(f, em.End),
+			Name:            em.Name,
+			Comment:         em.Comment,
+			Annotations:     d.annotations(f, em.Annotations),
+			TrailingComment: em.TrailingComment,
+			Idempotent:      em.Idempotent,
+			ReadOnly:        em.ReadOnly,
+			Timeout:         em.Timeout,
+			ID:              em.ID,
+			ClientStreaming: em.ClientStreaming,
+			ServerStreaming: em.ServerStreaming,
+		}
+		for _, p := range em.Params {
+			m.AppendParam(&ast.MethodParam{Position: d.pos(f, p.Position), Name: p.Name, Stream: p.Stream, Type: d.typ(f, p.Type)})
+		}
+		for _, r := range em.Returns {
+			m.AppendReturn(&ast.MethodReturn{Position: d.pos(f, r.Position), Stream: r.Stream, Type: d.typ(f, r.Type)})
+		}
+		for _, e := range em.Errors {
+			if t, ok := d.typ(f, e.Type).(ast.ResolvableType); ok {
+				m.AppendError(&ast.MethodError{Position: d.pos(f, e.Position), Type: t})
+			}
+		}
+		if em.HTTP != nil {
+			m.HTTP = &ast.HTTPBinding{Position: d.pos(f, em.HTTP.Position), Method: em.HTTP.Method, Path: em.HTTP.Path}
+			m.HTTP.Segments = make([]ast.HTTPPathSegment, len(em.HTTP.Segments))
+			for i, seg := range em.HTTP.Segments {
+				m.HTTP.Segments[i] = ast.HTTPPathSegment{Literal: seg.Literal, Variable: seg.Variable}
+				segment := &m.HTTP.Segments[i]
+				d.resolve(seg.Field, func(obj ast.Object) { segment.Field, _ = obj.(*ast.StructField) })
+			}
+		}
+		m.ErrorCodes = make([]*ast.EnumMember, len(em.ErrorCodes))
+		for i, code := range em.ErrorCodes {
+			d.resolve(code, func(obj ast.Object) { m.ErrorCodes[i], _ = obj.(*ast.EnumMember) })
+		}
+		if len(m.ErrorCodes) == 0 {
+			m.ErrorCodes = nil
+		}
+		s.AppendMethod(m)
+	}
+	return s
+}
+
+func (d *decoder) annotations(f *ast.File, list []encodedAnnotation) ast.AnnotationSet {
+	if list == nil {
+		return nil
+	}
+	res := make(ast.AnnotationSet, len(list))
+	for i, ea := range list {
+		res[i] = ast.Annotation{Position: d.pos(f, ea.Position), Name: ea.Name}
+		ann := &res[i]
+		if ea.Arguments != nil {
+			ann.Arguments = make([]any, len(ea.Arguments))
+		}
+		for j, arg := range ea.Arguments {
+			d.value(f, arg, func(v any) { ann.Arguments[j] = v })
+		}
+		if ea.NamedArguments != nil {
+			ann.NamedArguments = make([]ast.NamedArgument, len(ea.NamedArguments))
+		}
+		for j, arg := range ea.NamedArguments {
+			ann.NamedArguments[j] = ast.NamedArgument{Position: d.pos(f, arg.Position), Name: arg.Name}
+			d.value(f, arg.Value, func(v any) { ann.NamedArguments[j].Value = v })
+		}
+	}
+	return res
+}
+
+// value decodes v, passing the result to set, either immediately or once
+// the enum member it references is decoded.
+func (d *decoder) value(f *ast.File, v *encodedValue, set func(any)) {
+	switch v.Type {
+	case "string":
+		set(v.String)
+	case "bytes":
+		set(v.Bytes)
+	case "int":
+		set(v.Int)
+	case "uint":
+		set(v.Uint)
+	case "float":
+		set(v.Float)
+	case "bool":
+		set(v.Bool)
+	case "time":
+		set(*v.Time)
+	case "duration":
+		set(v.Duration)
+	case "reference":
+		ref := &ast.AnnotationReference{Position: d.pos(f, *v.Position), Name: v.String}
+		d.resolve(v.Resolved, func(obj ast.Object) { ref.ResolvedObject = obj })
+		set(ref)
+	case "member":
+		d.resolve(v.Resolved, func(obj ast.Object) { set(obj) })
+	default:
+		d.fixups = append(d.fixups, func() error { return fmt.Errorf("unknown value type %q", v.Type) })
+	}
+}
+
+func (d *decoder) typ(f *ast.File, et *encodedType) ast.Type {
+	if et == nil {
+		return nil
+	}
+	pos := d.pos(f, et.Position)
+	switch et.Kind {
+	case "primitive":
+		return &ast.PrimitiveType{Position: pos, Name: et.Name}
+	case "array":
+		return &ast.ArrayType{Position: pos, Type: d.typ(f, et.Elem)}
+	case "set":
+		return &ast.SetType{Position: pos, Type: d.typ(f, et.Elem)}
+	case "optional":
+		return &ast.OptionalType{Position: pos, Type: d.typ(f, et.Elem)}
+	case "map":
+		return &ast.MapType{Position: pos, Key: d.typ(f, et.Key), Value: d.typ(f, et.Elem)}
+	case "empty":
+		return &ast.EmptyType{Position: pos}
+	case "simple":
+		t := &ast.SimpleUserType{Position: pos, Name: et.Name, FullQualifiedName: et.FQN}
+		d.resolve(et.Resolved, t.SetResolved)
+		return t
+	case "qualified":
+		t := &ast.FullQualifiedType{
+			Position:          pos,
+			Package:           et.Package,
+			Name:              et.Name,
+			FullName:          et.FullName,
+			Components:        et.Components,
+			FullQualifiedName: et.FQN,
+		}
+		d.resolve(et.Resolved, t.SetResolved)
+		return t
+	}
+	d.fixups = append(d.fixups, func() error { return fmt.Errorf("unknown type kind %q", et.Kind) })
+	return nil
+}
+
+func (d *decoder) expr(f *ast.File, ex *encodedExpr) ast.Expr {
+	if ex == nil {
+		return nil
+	}
+	pos := d.pos(f, ex.Position)
+	switch ex.Kind {
+	case "int":
+		return &ast.IntLiteral{Position: pos, Raw: ex.Raw, Value: ex.Value, Unsigned: ex.Unsigned}
+	case "ref":
+		r := &ast.ConstRef{Position: pos, Name: ex.Name}
+		d.resolve(ex.Resolved, func(obj ast.Object) { r.Resolved = obj })
+		return r
+	case "unary":
+		return &ast.UnaryExpr{Position: pos, Op: ex.Op, X: d.expr(f, ex.X)}
+	case "binary":
+		return &ast.BinaryExpr{Position: pos, Op: ex.Op, X: d.expr(f, ex.X), Y: d.expr(f, ex.Y)}
+	case "paren":
+		return &ast.ParenExpr{Position: pos, X: d.expr(f, ex.X)}
+	}
+	d.fixups = append(d.fixups, func() error { return fmt.Errorf("unknown expression kind %q", ex.Kind) })
+	return nil
+}
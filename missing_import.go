@@ -0,0 +1,148 @@
+package idl
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// importFinder locates the schema files declaring types which are referenced
+// without being imported, so a fix adding the import can be suggested, and
+// the files declaring packages imported by name. Files are looked up under
+// roots, recursively.
+type importFinder struct {
+	roots      []string
+	extensions []string
+	imports    *importNormalizer
+
+	// declarations maps the name of each top-level type to the files
+	// declaring it. It is built on first use.
+	declarations map[string][]*ast.File
+	// packages maps each package to the files declaring it, in the first
+	// root declaring it at all, as paths imported by name take precedence
+	// the same way.
+	packages map[string][]string
+	// dirs lists the directories walked to build the index.
+	dirs []string
+}
+
+// declaring returns the only file declaring a top-level type named name, if
+// exactly one does.
+func (f *importFinder) declaring(name string) (*ast.File, bool) {
+	if f.declarations == nil {
+		f.index()
+	}
+	files := f.declarations[name]
+	if len(files) != 1 {
+		return nil, false
+	}
+	return files[0], true
+}
+
+// packageFiles returns the files declaring the package name, sorted.
+func (f *importFinder) packageFiles(name string) []string {
+	if f.declarations == nil {
+		f.index()
+	}
+	return f.packages[name]
+}
+
+func (f *importFinder) index() {
+	f.declarations = map[string][]*ast.File{}
+	f.packages = map[string][]string{}
+	seen := map[string]bool{}
+	for _, root := range f.roots {
+		declared := map[string]bool{}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				f.dirs = append(f.dirs, path)
+				return nil
+			}
+			if !hasExtension(path, f.extensions) {
+				return nil
+			}
+			location, err := filepath.Abs(path)
+			if err != nil || seen[location] {
+				return nil
+			}
+			seen[location] = true
+			data, err := os.ReadFile(location)
+			if err != nil {
+				return nil
+			}
+			tokens, _ := lexFile(data, nil)
+			file, _ := parse(location, tokens, nil)
+			if file == nil || file.Package == nil || len(file.Package.Components) == 0 {
+				return nil
+			}
+			if pkg := file.Package.Value; declared[pkg] || f.packages[pkg] == nil {
+				declared[pkg] = true
+				f.packages[pkg] = append(f.packages[pkg], location)
+			}
+			for _, s := range file.Structs {
+				f.declarations[s.Name] = append(f.declarations[s.Name], file)
+			}
+			for _, e := range file.Enums {
+				f.declarations[e.Name] = append(f.declarations[e.Name], file)
+			}
+			return nil
+		})
+	}
+}
+
+// fix returns a fix qualifying the reference to name at pos, within file,
+// with the alias of the file declaring it, adding an import for that file
+// when needed.
+func (f *importFinder) fix(file *ast.File, name string, pos ast.Position) *Fix {
+	declaring, ok := f.declaring(name)
+	if !ok || declaring.Path == file.Path {
+		return nil
+	}
+
+	for alias, location := range file.ImportAliases {
+		if location == declaring.Path {
+			qualified := alias + "." + name
+			return replaceFix("Replace with "+qualified, pos, len([]rune(name)), qualified)
+		}
+	}
+
+	alias := declaring.Package.Components[len(declaring.Package.Components)-1]
+	for n := 2; file.ImportAliases[alias] != ""; n++ {
+		alias = fmt.Sprintf("%s%d", declaring.Package.Components[len(declaring.Package.Components)-1], n)
+	}
+	rel, err := filepath.Rel(filepath.Dir(file.Path), declaring.Path)
+	if err != nil {
+		return nil
+	}
+	value := f.imports.normalizeValue(file.Path, filepath.ToSlash(rel))
+
+	// Imports are added after the last one, or after the package when there
+	// are none.
+	stmt := fmt.Sprintf("import %q as %s;\n", value, alias)
+	var at ast.Position
+	if n := len(file.Imports); n > 0 {
+		at = ast.Position{Line: file.Imports[n-1].Position.Line + 1, Column: 1}
+	} else {
+		at = ast.Position{Line: file.Package.Position.Line + 1, Column: 1}
+		stmt = "\n" + stmt
+	}
+
+	qualified := alias + "." + name
+	return &Fix{
+		Title: fmt.Sprintf("Import %s and use %s", value, qualified),
+		Edits: []TextEdit{
+			{Start: at, End: at, NewText: stmt},
+			replaceEdit(pos, len([]rune(name)), qualified),
+		},
+	}
+}
@@ -0,0 +1,558 @@
+// Package openapi converts OpenAPI 3 documents into arf ASTs, allowing REST
+// teams to adopt arf incrementally. Schemas declared under
+// components.schemas become structs and enums, and operations become methods
+// of a service named after their first tag. Constructs without an arf
+// equivalent are either approximated or dropped, and reported as warnings.
+//
+// Both JSON and YAML documents are accepted.
+package openapi
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/internal/naming"
+	"gopkg.in/yaml.v3"
+)
+
+const schemaRefPrefix = "#/components/schemas/"
+
+var operationVerbs = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+var (
+	placeholderRegex = regexp.MustCompile(`\{([^{}]+)\}`)
+	nonIdentRegex    = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// Convert parses the OpenAPI document src and converts it into an arf file.
+// The returned diagnostics contain warnings about constructs that could not be
+// translated as-is; when an error diagnostic is present, the returned file is
+// nil.
+func Convert(filename string, src []byte) (*ast.File, []*idl.Diagnostic) {
+	c := &converter{filename: filename}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		c.diagnostics = append(c.diagnostics, &idl.Diagnostic{
+			Severity: idl.SeverityError,
+			Position: ast.Position{Filename: filename, Line: 1, Column: 1},
+			Message:  err.Error(),
+		})
+		return nil, c.diagnostics
+	}
+
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		c.errorf(root, "expected an OpenAPI document")
+		return nil, c.diagnostics
+	}
+	version := lookup(root, "openapi")
+	if version == nil || !strings.HasPrefix(version.Value, "3.") {
+		c.errorf(root, "only OpenAPI 3 documents are supported")
+		return nil, c.diagnostics
+	}
+
+	f := c.convert(root)
+	for _, d := range c.diagnostics {
+		if d.Severity == idl.SeverityError {
+			return nil, c.diagnostics
+		}
+	}
+	return f, c.diagnostics
+}
+
+type converter struct {
+	filename    string
+	file        *ast.File
+	schemas     map[string]*yaml.Node
+	aliases     map[string]struct{}
+	structs     map[string]struct{}
+	services    map[string]*ast.Service
+	diagnostics []*idl.Diagnostic
+}
+
+func (c *converter) pos(n *yaml.Node) ast.Position {
+	return ast.Position{Filename: c.filename, Line: n.Line, Column: n.Column, File: c.file}
+}
+
+func (c *converter) report(sev idl.Severity, n *yaml.Node, format string, args ...any) {
+	c.diagnostics = append(c.diagnostics, &idl.Diagnostic{
+		Severity: sev,
+		Position: c.pos(n),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *converter) errorf(n *yaml.Node, format string, args ...any) {
+	c.report(idl.SeverityError, n, format, args...)
+}
+
+func (c *converter) warnf(n *yaml.Node, format string, args ...any) {
+	c.report(idl.SeverityWarning, n, format, args...)
+}
+
+func (c *converter) convert(root *yaml.Node) *ast.File {
+	c.file = &ast.File{
+		Package:       &ast.Package{},
+		ImportAliases: map[string]string{},
+		Path:          c.filename,
+	}
+	c.schemas = map[string]*yaml.Node{}
+	c.aliases = map[string]struct{}{}
+	c.structs = map[string]struct{}{}
+	c.services = map[string]*ast.Service{}
+
+	name := naming.Snake(strings.TrimSuffix(path.Base(c.filename), path.Ext(c.filename)))
+	c.file.Package.Position = ast.Position{Filename: c.filename, Line: 1, Column: 1, File: c.file}
+	c.file.Package.Components = []string{name}
+	c.file.Package.Value = name
+
+	schemas := lookup(lookup(root, "components"), "schemas")
+	eachPair(schemas, func(key, value *yaml.Node) {
+		c.schemas[key.Value] = value
+		c.structs[naming.Camel(key.Value)] = struct{}{}
+	})
+	eachPair(schemas, func(key, value *yaml.Node) {
+		c.convertSchema(key, value)
+	})
+
+	eachPair(lookup(root, "paths"), func(key, item *yaml.Node) {
+		c.convertPath(key, item)
+	})
+	return c.file
+}
+
+// convertSchema declares a struct or enum for the component schema named by
+// key. Other schemas are treated as aliases, and inlined where referenced.
+func (c *converter) convertSchema(key, schema *yaml.Node) {
+	name := naming.Camel(key.Value)
+	if values := lookup(schema, "enum"); values != nil {
+		delete(c.structs, name)
+		if e := c.convertEnum(name, schema, values); e != nil {
+			c.file.Enums = append(c.file.Enums, e)
+		}
+		return
+	}
+	if !isStruct(schema) {
+		delete(c.structs, name)
+		c.aliases[key.Value] = struct{}{}
+		c.warnf(key, "schema %s is not an object; its uses were replaced by its definition", key.Value)
+		return
+	}
+	s := &ast.Struct{Position: c.pos(key), Name: name, Comment: comment(schema)}
+	c.file.Structs = append(c.file.Structs, s)
+	c.convertProperties(s, schema)
+}
+
+// isStruct indicates whether schema describes an object with a fixed set of
+// properties.
+func isStruct(schema *yaml.Node) bool {
+	if lookup(schema, "properties") != nil || lookup(schema, "allOf") != nil {
+		return true
+	}
+	typ := lookup(schema, "type")
+	return typ != nil && typ.Value == "object" && lookup(schema, "additionalProperties") == nil
+}
+
+func (c *converter) convertEnum(name string, schema, values *yaml.Node) *ast.Enum {
+	e := &ast.Enum{Position: c.pos(schema), Name: name, Comment: comment(schema)}
+	numeric := scalar(schema, "type") == "integer"
+	if !numeric {
+		c.warnf(values, "values of enum %s were replaced by sequential numbers", name)
+	}
+	for i, v := range values.Content {
+		value := i + 1
+		if numeric {
+			n, err := strconv.Atoi(v.Value)
+			if err != nil || n < 0 || n > 32767 {
+				c.warnf(v, "value %s of enum %s is out of range and was dropped", v.Value, name)
+				continue
+			}
+			value = n
+		}
+		member := naming.Screaming(nonIdentRegex.ReplaceAllString(v.Value, "_"))
+		if numeric {
+			member = "VALUE_" + v.Value
+		}
+		e.AppendMember(ast.EnumMember{Position: c.pos(v), Name: member, Value: value})
+	}
+	if len(e.Members) == 0 {
+		c.warnf(schema, "enum %s has no members and was dropped", name)
+		return nil
+	}
+	return e
+}
+
+func (c *converter) convertProperties(s *ast.Struct, schema *yaml.Node) {
+	for _, part := range seq(lookup(schema, "allOf")) {
+		if ref := scalar(part, "$ref"); ref != "" {
+			target := c.resolveRef(part, ref)
+			if target == nil {
+				continue
+			}
+			c.convertProperties(s, target)
+			continue
+		}
+		c.convertProperties(s, part)
+	}
+
+	required := map[string]bool{}
+	for _, r := range seq(lookup(schema, "required")) {
+		required[r.Value] = true
+	}
+	eachPair(lookup(schema, "properties"), func(key, prop *yaml.Node) {
+		typ := c.convertType(prop, s.Name+naming.Camel(key.Value))
+		if !required[key.Value] || scalar(prop, "nullable") == "true" {
+			typ = optional(typ)
+		}
+		s.AppendField(c.field(key, typ, comment(prop)))
+	})
+}
+
+// field declares a struct field named after key, keeping the original name on
+// the wire when it is not in snake case.
+func (c *converter) field(key *yaml.Node, typ ast.Type, comment []string) ast.StructField {
+	f := ast.StructField{
+		Position: c.pos(key),
+		Comment:  comment,
+		Name:     naming.Snake(key.Value),
+		Type:     typ,
+	}
+	if f.Name != key.Value {
+		f.Annotations = append(f.Annotations, ast.Annotation{
+			Position:  f.Position,
+			Name:      "wire_name",
+			Arguments: []any{key.Value},
+		})
+	}
+	return f
+}
+
+func (c *converter) resolveRef(n *yaml.Node, ref string) *yaml.Node {
+	if !strings.HasPrefix(ref, schemaRefPrefix) {
+		c.warnf(n, "reference %s is not supported and was replaced by bytes", ref)
+		return nil
+	}
+	target, ok := c.schemas[strings.TrimPrefix(ref, schemaRefPrefix)]
+	if !ok {
+		c.errorf(n, "unknown schema %s", ref)
+		return nil
+	}
+	return target
+}
+
+// convertType returns the arf type for schema. Inline objects are declared as
+// structs named after suggested.
+func (c *converter) convertType(schema *yaml.Node, suggested string) ast.Type {
+	return c.convertTypeDepth(schema, suggested, 0)
+}
+
+func (c *converter) convertTypeDepth(schema *yaml.Node, suggested string, depth int) ast.Type {
+	pos := c.pos(schema)
+	bytesType := &ast.PrimitiveType{Position: pos, Name: "bytes"}
+
+	if ref := scalar(schema, "$ref"); ref != "" {
+		target := c.resolveRef(schema, ref)
+		if target == nil {
+			return bytesType
+		}
+		name := strings.TrimPrefix(ref, schemaRefPrefix)
+		if _, ok := c.aliases[name]; ok {
+			if depth > len(c.aliases) {
+				c.errorf(schema, "schema %s is recursive", name)
+				return bytesType
+			}
+			return c.convertTypeDepth(target, suggested, depth+1)
+		}
+		return &ast.SimpleUserType{Position: pos, Name: naming.Camel(name)}
+	}
+
+	for _, key := range []string{"oneOf", "anyOf", "not"} {
+		if n := lookup(schema, key); n != nil {
+			c.warnf(n, "%s is not supported and was replaced by bytes", key)
+			return bytesType
+		}
+	}
+	if lookup(schema, "enum") != nil {
+		c.warnf(schema, "inline enum was replaced by its base type")
+	}
+
+	switch scalar(schema, "type") {
+	case "boolean":
+		return &ast.PrimitiveType{Position: pos, Name: "bool"}
+	case "integer":
+		name := "int64"
+		if scalar(schema, "format") == "int32" {
+			name = "int32"
+		}
+		return &ast.PrimitiveType{Position: pos, Name: name}
+	case "number":
+		name := "float64"
+		if scalar(schema, "format") == "float" {
+			name = "float32"
+		}
+		return &ast.PrimitiveType{Position: pos, Name: name}
+	case "string":
+		switch scalar(schema, "format") {
+		case "date-time":
+			return &ast.PrimitiveType{Position: pos, Name: "timestamp"}
+		case "uuid", "duration":
+			return &ast.PrimitiveType{Position: pos, Name: scalar(schema, "format")}
+		case "byte", "binary":
+			return bytesType
+		}
+		return &ast.PrimitiveType{Position: pos, Name: "string"}
+	case "array":
+		items := lookup(schema, "items")
+		if items == nil {
+			c.warnf(schema, "array without items was converted to array<bytes>")
+			return &ast.ArrayType{Position: pos, Type: bytesType}
+		}
+		return &ast.ArrayType{Position: pos, Type: c.convertTypeDepth(items, suggested+"Item", depth)}
+	}
+
+	if isStruct(schema) {
+		name := c.uniqueStructName(suggested)
+		s := &ast.Struct{Position: pos, Name: name, Comment: comment(schema)}
+		c.file.Structs = append(c.file.Structs, s)
+		c.convertProperties(s, schema)
+		return &ast.SimpleUserType{Position: pos, Name: name}
+	}
+	if ap := lookup(schema, "additionalProperties"); ap != nil && ap.Kind == yaml.MappingNode {
+		return &ast.MapType{
+			Position: pos,
+			Key:      &ast.PrimitiveType{Position: pos, Name: "string"},
+			Value:    c.convertTypeDepth(ap, suggested+"Value", depth),
+		}
+	}
+	c.warnf(schema, "free-form schema was replaced by bytes")
+	return bytesType
+}
+
+func (c *converter) uniqueStructName(base string) string {
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := c.structs[name]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	c.structs[name] = struct{}{}
+	return name
+}
+
+func (c *converter) convertPath(key, item *yaml.Node) {
+	for _, verb := range operationVerbs {
+		op := lookup(item, verb)
+		if op == nil {
+			continue
+		}
+		c.convertOperation(key, verb, op, seq(lookup(item, "parameters")))
+	}
+}
+
+func (c *converter) convertOperation(pathKey *yaml.Node, verb string, op *yaml.Node, shared []*yaml.Node) {
+	tag := "Default"
+	if tags := seq(lookup(op, "tags")); len(tags) > 0 {
+		tag = tags[0].Value
+		if len(tags) > 1 {
+			c.warnf(tags[1], "operation belongs to several tags; only %s is used", tag)
+		}
+	}
+	svcName := naming.Camel(naming.Snake(tag))
+	svc, ok := c.services[svcName]
+	if !ok {
+		svc = &ast.Service{Position: c.pos(op), Name: svcName}
+		c.services[svcName] = svc
+		c.file.Services = append(c.file.Services, svc)
+	}
+
+	name := scalar(op, "operationId")
+	if name == "" {
+		name = verb + "_" + placeholderRegex.ReplaceAllString(pathKey.Value, "by_$1")
+		name = strings.Map(func(r rune) rune {
+			if r == '/' || r == '-' || r == '.' {
+				return '_'
+			}
+			return r
+		}, name)
+	}
+	m := &ast.ServiceMethod{
+		Position: c.pos(op),
+		Comment:  comment(op),
+		Name:     naming.Camel(naming.Snake(name)),
+	}
+
+	params := append(append([]*yaml.Node{}, shared...), seq(lookup(op, "parameters"))...)
+	c.convertRequest(m, params, lookup(op, "requestBody"))
+	c.convertResponse(m, lookup(op, "responses"))
+
+	// Path placeholders are bound to the request fields, which were renamed
+	// to snake case.
+	httpPath := placeholderRegex.ReplaceAllStringFunc(pathKey.Value, func(s string) string {
+		return "{" + naming.Snake(s[1:len(s)-1]) + "}"
+	})
+	m.Annotations = append(m.Annotations, ast.Annotation{
+		Position:  m.Position,
+		Name:      "http",
+		Arguments: []any{strings.ToUpper(verb), httpPath},
+	})
+	svc.AppendMethod(m)
+}
+
+func (c *converter) convertRequest(m *ast.ServiceMethod, params []*yaml.Node, requestBody *yaml.Node) {
+	body := jsonSchema(requestBody)
+	bodyRequired := scalar(requestBody, "required") == "true"
+	if len(params) == 0 && body == nil {
+		return
+	}
+	if len(params) == 0 && bodyRequired && scalar(body, "$ref") != "" {
+		if t, ok := c.convertType(body, m.Name+"Body").(*ast.SimpleUserType); ok {
+			name := "request"
+			m.AppendParam(&ast.MethodParam{Position: c.pos(body), Name: &name, Type: t})
+			return
+		}
+	}
+
+	reqName := c.uniqueStructName(m.Name + "Request")
+	req := &ast.Struct{Position: m.Position, Name: reqName}
+	c.file.Structs = append(c.file.Structs, req)
+	for _, p := range params {
+		if ref := scalar(p, "$ref"); ref != "" {
+			c.warnf(p, "parameter reference %s is not supported and was dropped", ref)
+			continue
+		}
+		nameNode := lookup(p, "name")
+		if nameNode == nil {
+			c.errorf(p, "parameter has no name")
+			continue
+		}
+		schema := lookup(p, "schema")
+		var typ ast.Type = &ast.PrimitiveType{Position: c.pos(p), Name: "string"}
+		if schema != nil {
+			typ = c.convertType(schema, reqName+naming.Camel(nameNode.Value))
+		}
+		if scalar(p, "required") != "true" {
+			typ = optional(typ)
+		}
+		req.AppendField(c.field(nameNode, typ, comment(p)))
+	}
+	if body != nil {
+		typ := c.convertType(body, reqName+"Body")
+		if !bodyRequired {
+			typ = optional(typ)
+		}
+		req.AppendField(ast.StructField{Position: c.pos(body), Name: "body", Type: typ})
+	}
+
+	name := "request"
+	m.AppendParam(&ast.MethodParam{
+		Position: m.Position,
+		Name:     &name,
+		Type:     &ast.SimpleUserType{Position: m.Position, Name: reqName},
+	})
+}
+
+func (c *converter) convertResponse(m *ast.ServiceMethod, responses *yaml.Node) {
+	var codes []string
+	eachPair(responses, func(key, _ *yaml.Node) {
+		if strings.HasPrefix(key.Value, "2") {
+			codes = append(codes, key.Value)
+		}
+	})
+	if len(codes) == 0 {
+		return
+	}
+	sort.Strings(codes)
+	response := lookup(responses, codes[0])
+	schema := jsonSchema(response)
+	if schema == nil {
+		return
+	}
+
+	typ := c.convertType(schema, m.Name+"Response")
+	if t, ok := typ.(*ast.SimpleUserType); ok {
+		m.AppendReturn(&ast.MethodReturn{Position: c.pos(schema), Type: t})
+		return
+	}
+	resp := &ast.Struct{Position: c.pos(schema), Name: c.uniqueStructName(m.Name + "Response")}
+	c.file.Structs = append(c.file.Structs, resp)
+	resp.AppendField(ast.StructField{Position: c.pos(schema), Name: "value", Type: typ})
+	m.AppendReturn(&ast.MethodReturn{
+		Position: c.pos(schema),
+		Type:     &ast.SimpleUserType{Position: c.pos(schema), Name: resp.Name},
+	})
+}
+
+// jsonSchema returns the schema of the application/json content of a request
+// body or response.
+func jsonSchema(n *yaml.Node) *yaml.Node {
+	return lookup(lookup(lookup(n, "content"), "application/json"), "schema")
+}
+
+func optional(t ast.Type) ast.Type {
+	if _, ok := t.(*ast.OptionalType); ok {
+		return t
+	}
+	return &ast.OptionalType{Type: t}
+}
+
+func comment(schema *yaml.Node) []string {
+	desc := scalar(schema, "description")
+	if desc == "" {
+		desc = scalar(schema, "summary")
+	}
+	if desc == "" {
+		return nil
+	}
+	var lines []string
+	for _, l := range strings.Split(strings.TrimSpace(desc), "\n") {
+		lines = append(lines, " "+l)
+	}
+	return lines
+}
+
+// lookup returns the value associated with key in the mapping n, or nil.
+func lookup(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(n *yaml.Node, key string) string {
+	if v := lookup(n, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+func seq(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// eachPair calls fn for each entry of the mapping n, in document order.
+func eachPair(n *yaml.Node, fn func(key, value *yaml.Node)) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		fn(n.Content[i], n.Content[i+1])
+	}
+}
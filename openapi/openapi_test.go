@@ -0,0 +1,170 @@
+package openapi
+
+import (
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `
+openapi: 3.0.3
+info:
+  title: Pet Store
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      tags: [pets]
+      operationId: listPets
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            format: int32
+      responses:
+        "200":
+          description: A list of pets
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/Pet"
+    post:
+      tags: [pets]
+      operationId: createPet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Pet"
+      responses:
+        "201":
+          description: Created
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Pet"
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        required: true
+        schema:
+          $ref: "#/components/schemas/PetID"
+    delete:
+      tags: [pets, admin]
+      responses:
+        "204":
+          description: Deleted
+  /health:
+    get:
+      responses:
+        "200":
+          description: OK
+components:
+  schemas:
+    PetID:
+      type: string
+      format: uuid
+    Status:
+      type: string
+      enum: [available, on-hold]
+    Pet:
+      description: A pet for sale.
+      type: object
+      required: [id, name]
+      properties:
+        id:
+          $ref: "#/components/schemas/PetID"
+        name:
+          type: string
+        birthDate:
+          type: string
+          format: date-time
+        status:
+          $ref: "#/components/schemas/Status"
+        owner:
+          type: object
+          properties:
+            email:
+              type: string
+        attributes:
+          type: object
+          additionalProperties:
+            type: number
+        extra:
+          oneOf:
+            - type: string
+            - type: integer
+`
+
+func TestConvert(t *testing.T) {
+	f, diags := Convert("pet_store.yaml", []byte(source))
+	require.NotNil(t, f)
+	var messages []string
+	for _, d := range diags {
+		require.Equal(t, idl.SeverityWarning, d.Severity, d.Error())
+		messages = append(messages, d.Message)
+	}
+	require.Equal(t, []string{
+		"schema PetID is not an object; its uses were replaced by its definition",
+		"values of enum Status were replaced by sequential numbers",
+		"oneOf is not supported and was replaced by bytes",
+		"operation belongs to several tags; only pets is used",
+	}, messages)
+	require.Equal(t, 61, diags[0].Position.Line)
+
+	require.Equal(t, "pet_store", f.Package.Value)
+
+	status := f.FindEnum("Status")
+	require.Equal(t, "ON_HOLD", status.Members[1].Name)
+
+	pet := f.FindStruct("Pet")
+	require.Equal(t, []string{" A pet for sale."}, pet.Comment)
+	require.Equal(t, "uuid", pet.Fields[0].Type.(*ast.PrimitiveType).Name)
+	require.Equal(t, "birth_date", pet.Fields[2].Name)
+	require.Equal(t, "birthDate", pet.Fields[2].WireName())
+	require.Equal(t, "timestamp", pet.Fields[2].Type.(*ast.OptionalType).Type.(*ast.PrimitiveType).Name)
+	require.Equal(t, "PetOwner", pet.Fields[4].Type.(*ast.OptionalType).Type.(*ast.SimpleUserType).Name)
+	require.IsType(t, &ast.MapType{}, pet.Fields[5].Type.(*ast.OptionalType).Type)
+	require.NotNil(t, f.FindStruct("PetOwner"))
+
+	require.Len(t, f.Services, 2)
+	pets := f.Services[0]
+	require.Equal(t, "Pets", pets.Name)
+	require.Len(t, pets.Methods, 3)
+
+	list := pets.Methods[0]
+	require.Equal(t, "ListPets", list.Name)
+	require.Equal(t, []any{"GET", "/pets"}, list.Annotations.ByName("http").Arguments)
+	require.Equal(t, "ListPetsRequest", list.Params[0].Type.(*ast.SimpleUserType).Name)
+	require.Equal(t, "ListPetsResponse", list.Returns[0].Type.(*ast.SimpleUserType).Name)
+
+	create := pets.Methods[1]
+	require.Equal(t, "Pet", create.Params[0].Type.(*ast.SimpleUserType).Name)
+	require.Equal(t, "Pet", create.Returns[0].Type.(*ast.SimpleUserType).Name)
+
+	del := pets.Methods[2]
+	require.Equal(t, "DeletePetsByPetId", del.Name)
+	require.Equal(t, []any{"DELETE", "/pets/{pet_id}"}, del.Annotations.ByName("http").Arguments)
+	req := f.FindStruct("DeletePetsByPetIdRequest")
+	require.Equal(t, "pet_id", req.Fields[0].Name)
+	require.Empty(t, del.Returns)
+
+	require.Equal(t, "Default", f.Services[1].Name)
+}
+
+func TestConvertErrors(t *testing.T) {
+	_, diags := Convert("bad.yaml", []byte("swagger: \"2.0\"\n"))
+	require.Len(t, diags, 1)
+	require.Equal(t, idl.SeverityError, diags[0].Severity)
+
+	_, diags = Convert("bad.json", []byte(`{"openapi": "3.1.0", "components": {"schemas": {"A": {"properties": {"b": {"$ref": "#/components/schemas/B"}}}}}}`))
+	require.Len(t, diags, 1)
+	require.Equal(t, "unknown schema #/components/schemas/B", diags[0].Message)
+}
@@ -0,0 +1,201 @@
+package idl
+
+import (
+	"io"
+	"strings"
+)
+
+// Option configures optional behaviour of a Frontend created through New.
+type Option func(*options)
+
+type options struct {
+	versionedPackages bool
+	packageLayout     bool
+	schemaRoot        string
+	includePaths      []string
+	manifestPath      string
+	resolvers         []func(next Resolver) Resolver
+	severities        map[string]Severity
+	extensions        []string
+	stdin             io.Reader
+	stdinFilename     string
+	nameLimits        *NameLimits
+	maxTypeDepth      int
+	explicitEnums     bool
+	fieldOrder        bool
+	noFilesystem      bool
+}
+
+// WithVersionedPackages enforces that every package ends with a version
+// segment, such as org.example.users.v1, and that types from another version
+// of the same package are not imported without an explicit alias when their
+// names collide with local ones.
+func WithVersionedPackages() Option {
+	return func(o *options) {
+		o.versionedPackages = true
+	}
+}
+
+// WithPackageLayout enforces that a file's package matches its directory
+// relative to root; files in package org.example.contacts must be placed under
+// root/org/example/contacts.
+func WithPackageLayout(root string) Option {
+	return func(o *options) {
+		o.packageLayout = true
+		o.schemaRoot = root
+	}
+}
+
+// WithSchemaRoot allows imports to be written relative to root, in addition to
+// the importing file. Imports are first looked up relative to the importing
+// file, falling back to root. WithPackageLayout implies the same behaviour.
+func WithSchemaRoot(root string) Option {
+	return func(o *options) {
+		o.schemaRoot = root
+	}
+}
+
+// WithIncludePaths adds dirs to the roots imports are looked up under, as
+// protoc's -I flag does. Imports not found relative to the importing file are
+// looked up under the schema root, if any, then under each of dirs in order,
+// the first match being used. Packages imported by name, as in
+// import org.example.common;, resolve to the files declaring them under the
+// first of those roots declaring them at all. The option may be repeated.
+func WithIncludePaths(dirs ...string) Option {
+	return func(o *options) {
+		o.includePaths = append(o.includePaths, dirs...)
+	}
+}
+
+// WithManifest uses the manifest at path to resolve imports of external
+// dependencies. By default, the frontend looks for an arf.mod file in the
+// entrypoint directory and its parents.
+func WithManifest(path string) Option {
+	return func(o *options) {
+		o.manifestPath = path
+	}
+}
+
+// WithResolver wraps the Resolver used to locate imports. wrap receives the
+// default resolver, which it may delegate to for imports it does not handle:
+//
+//	idl.WithResolver(func(next idl.Resolver) idl.Resolver {
+//		return &idl.RemoteResolver{Next: next, Lock: lock, CacheDir: cache}
+//	})
+func WithResolver(wrap func(next Resolver) Resolver) Option {
+	return func(o *options) {
+		o.resolvers = append(o.resolvers, wrap)
+	}
+}
+
+// WithSeverity overrides the severity of diagnostics reported with code, which
+// must be one of the Code constants. Overrides take precedence over severity
+// directives declared in arf.mod:
+//
+//	idl.WithSeverity(idl.CodeNamingCase, idl.SeverityWarning)
+func WithSeverity(code string, sev Severity) Option {
+	return func(o *options) {
+		if o.severities == nil {
+			o.severities = map[string]Severity{}
+		}
+		o.severities[code] = sev
+	}
+}
+
+// WithExtensions sets the extensions accepted for schema files, such as ".arf"
+// and ".arfi". Imports carrying one of them are used as-is; others are looked
+// up with each extension in order. Defaults to DefaultExtensions.
+func WithExtensions(exts ...string) Option {
+	return func(o *options) {
+		o.extensions = nil
+		for _, ext := range exts {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			o.extensions = append(o.extensions, ext)
+		}
+	}
+}
+
+// WithStdin sets the reader used when the entrypoint is StdinEntrypoint.
+// Defaults to os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(o *options) {
+		o.stdin = r
+	}
+}
+
+// WithStdinFilename sets the name under which a schema read from standard
+// input is reported. Imports are resolved relative to it, as if the schema was
+// stored at that location, allowing editors to validate unsaved buffers.
+func WithStdinFilename(name string) Option {
+	return func(o *options) {
+		o.stdinFilename = name
+	}
+}
+
+// NameLimits bounds the length, in characters, of identifiers and of the fully
+// qualified names derived from them, such as org.example.users.User.Kind.
+// Some target languages and filesystems cannot handle longer names. Zero
+// disables a limit.
+type NameLimits struct {
+	Identifier int
+	FQN        int
+}
+
+// DefaultNameLimits holds the limits enforced when none are configured through
+// WithNameLimits.
+var DefaultNameLimits = NameLimits{Identifier: 64, FQN: 255}
+
+// WithNameLimits sets the maximum lengths of identifiers and fully qualified
+// names. Names exceeding them are reported as warnings with the
+// CodeNameLength code, whose severity can be overridden.
+func WithNameLimits(limits NameLimits) Option {
+	return func(o *options) {
+		o.nameLimits = &limits
+	}
+}
+
+// DefaultMaxTypeDepth is the nesting depth of types allowed when none is
+// configured through WithMaxTypeDepth.
+const DefaultMaxTypeDepth = 16
+
+// WithMaxTypeDepth sets how many levels of array, map, and optional types may
+// be nested: array<map<string, int32>> nests two levels. Deeper types are
+// reported as errors.
+func WithMaxTypeDepth(depth int) Option {
+	return func(o *options) {
+		o.maxTypeDepth = depth
+	}
+}
+
+// WithExplicitEnumValues requires every enum member to declare its value, as
+// in ACTIVE = 1;, instead of following the previous member. Members without
+// one are reported with the CodeImplicitEnumValue code.
+func WithExplicitEnumValues() Option {
+	return func(o *options) {
+		o.explicitEnums = true
+	}
+}
+
+// WithFieldOrder requires the fields of every struct to be declared in
+// ascending index order, so diffs and generated code stay stable. Structs
+// declaring them out of order are reported with the CodeFieldOrder code,
+// along with a fix reordering them. The rule may also be enabled by setting
+// the severity of CodeFieldOrder, through WithSeverity or arf.mod.
+func WithFieldOrder() Option {
+	return func(o *options) {
+		o.fieldOrder = true
+	}
+}
+
+// WithoutFilesystem prevents the frontend from reading the local filesystem on
+// its own: no arf.mod is looked up, packages imported by name are not searched
+// for on disk, and the Resolvers configured through WithResolver are passed
+// one failing every lookup. Files are only loaded through those Resolvers,
+// which suits schemas received from untrusted sources, read from stdin.
+func WithoutFilesystem() Option {
+	return func(o *options) {
+		o.noFilesystem = true
+	}
+}
@@ -0,0 +1,96 @@
+package idl
+
+import (
+	"sort"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// SymbolKind identifies the kind of declaration represented by a Symbol.
+type SymbolKind int
+
+const (
+	SymbolStruct SymbolKind = iota + 1
+	SymbolEnum
+	SymbolService
+	SymbolMethod
+)
+
+var symbolKindAsString = map[SymbolKind]string{
+	SymbolStruct:  "struct",
+	SymbolEnum:    "enum",
+	SymbolService: "service",
+	SymbolMethod:  "method",
+}
+
+func (k SymbolKind) String() string {
+	return symbolKindAsString[k]
+}
+
+// Symbol is a declaration of a file, as presented by editor outlines and
+// breadcrumbs.
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+
+	// Start and End delimit the declaration, from its keyword (or name, for
+	// methods) to right after its closing brace or semicolon. End equals
+	// Start for declarations that could not be parsed to completion.
+	Start ast.Position
+	End   ast.Position
+
+	// Children holds the declarations nested within this one, such as the
+	// structs and enums of a struct or the methods of a service, in source
+	// order.
+	Children []Symbol
+}
+
+// Outline returns the declarations of file as a tree of symbols, in source
+// order.
+func Outline(file *ast.File) []Symbol {
+	var symbols []Symbol
+	for _, s := range file.Structs {
+		symbols = append(symbols, structSymbol(s))
+	}
+	for _, e := range file.Enums {
+		symbols = append(symbols, newSymbol(e.Name, SymbolEnum, e.Position, e.End))
+	}
+	for _, s := range file.Services {
+		svc := newSymbol(s.Name, SymbolService, s.Position, s.End)
+		for _, m := range s.Methods {
+			svc.Children = append(svc.Children, newSymbol(m.Name, SymbolMethod, m.Position, m.End))
+		}
+		symbols = append(symbols, svc)
+	}
+	sortSymbols(symbols)
+	return symbols
+}
+
+func structSymbol(s *ast.Struct) Symbol {
+	sym := newSymbol(s.Name, SymbolStruct, s.Position, s.End)
+	for _, ss := range s.Structs {
+		sym.Children = append(sym.Children, structSymbol(ss))
+	}
+	for _, e := range s.Enums {
+		sym.Children = append(sym.Children, newSymbol(e.Name, SymbolEnum, e.Position, e.End))
+	}
+	sortSymbols(sym.Children)
+	return sym
+}
+
+func newSymbol(name string, kind SymbolKind, start, end ast.Position) Symbol {
+	if end.Line == 0 {
+		end = start
+	}
+	return Symbol{Name: name, Kind: kind, Start: start, End: end}
+}
+
+func sortSymbols(symbols []Symbol) {
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i].Start, symbols[j].Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
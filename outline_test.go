@@ -0,0 +1,51 @@
+package idl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutline(t *testing.T) {
+	src := `package outline;
+
+service Users {
+    Get(r User) -> User;
+    List(r User) -> stream User;
+}
+
+struct User {
+    id string;
+    enum Kind {
+        ADMIN = 0;
+    }
+    struct Settings { theme string; }
+}
+
+enum Status { ACTIVE = 0; }
+`
+	tokens, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	file, errs := parse("outline.arf", tokens, nil)
+	require.Empty(t, errs)
+
+	var got []string
+	var walk func(symbols []Symbol, depth int)
+	walk = func(symbols []Symbol, depth int) {
+		for _, s := range symbols {
+			got = append(got, fmt.Sprintf("%*s%s %s %d:%d-%d:%d", depth*2, "", s.Kind, s.Name, s.Start.Line, s.Start.Column, s.End.Line, s.End.Column))
+			walk(s.Children, depth+1)
+		}
+	}
+	walk(Outline(file), 0)
+	require.Equal(t, []string{
+		"service Users 3:1-6:2",
+		"  method Get 4:5-4:25",
+		"  method List 5:5-5:33",
+		"struct User 8:1-14:2",
+		"  enum Kind 10:5-12:6",
+		"  struct Settings 13:5-13:38",
+		"enum Status 16:1-16:28",
+	}, got)
+}
@@ -1,13 +1,18 @@
 package idl
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/bits"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/internal/naming"
 )
 
 var reservedNames = map[string]struct{}{
@@ -17,9 +22,12 @@ var reservedNames = map[string]struct{}{
 	"struct":    {},
 	"enum":      {},
 	"service":   {},
+	"const":     {},
+	"union":     {},
 	"optional":  {},
 	"map":       {},
 	"array":     {},
+	"set":       {},
 	"stream":    {},
 	"string":    {},
 	"int8":      {},
@@ -52,6 +60,11 @@ var primitives = map[string]struct{}{
 	"bool":      {},
 	"bytes":     {},
 	"timestamp": {},
+	// Introduced after the names above; not reserved so that fields and
+	// params already named after them remain valid.
+	"uuid":       {},
+	"duration":   {},
+	"decimal128": {},
 }
 
 var camelCaseRegex = regexp.MustCompile(`^[A-Z]+[a-zA-Z0-9]*$`)
@@ -59,10 +72,18 @@ var snakeCaseRegex = regexp.MustCompile(`^[a-z]+[a-z_0-9]*$`)
 var screamingSnakeCaseRegex = regexp.MustCompile(`^[A-Z]+[A-Z_0-9]*$`)
 
 func parse(filepath string, tokens []token, onError func(error)) (*ast.File, []error) {
+	return parseWithTypeDepth(filepath, tokens, onError, DefaultMaxTypeDepth)
+}
+
+// parseWithTypeDepth is like parse, rejecting types nesting more than
+// maxTypeDepth levels of arrays, maps, and optionals.
+func parseWithTypeDepth(filepath string, tokens []token, onError func(error), maxTypeDepth int) (*ast.File, []error) {
 	var errors []error
+	tokens = withoutInlineComments(tokens)
 	p := parser{
-		tokens: tokens,
-		length: len(tokens),
+		tokens:       tokens,
+		length:       len(tokens),
+		maxTypeDepth: maxTypeDepth,
 		onError: func(err error) {
 			errors = append(errors, err)
 			if onError != nil {
@@ -79,11 +100,27 @@ func parse(filepath string, tokens []token, onError func(error)) (*ast.File, []e
 			Path:          filepath,
 		},
 	}
+	// The file is returned even when errors are reported, so callers may
+	// proceed when all of them were downgraded by severity overrides.
 	p.parse()
-	if len(errors) > 0 {
-		return nil, errors
+	return &p.file, errors
+}
+
+// withoutInlineComments drops block comments written between the tokens of a
+// declaration, such as the one in `id /* user */ int64;`. Other comments are
+// attached to declarations by the parser.
+func withoutInlineComments(tokens []token) []token {
+	if !slices.ContainsFunc(tokens, func(t token) bool { return t.Block }) {
+		return tokens
 	}
-	return &p.file, nil
+	res := make([]token, 0, len(tokens))
+	for i, t := range tokens {
+		if next := i + 1; t.Block && next < len(tokens) && tokens[next].Type != tokenTypeEOF && tokens[next].Line == t.lastLine() {
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
 }
 
 type parser struct {
@@ -94,6 +131,17 @@ type parser struct {
 	comments    []token
 	annotations []ast.Annotation
 	onError     func(error)
+
+	// inlineName is the name given to a struct declared inline by the type
+	// being parsed, if it may declare one. inlined collects such structs
+	// until they are attached to their parent. See parseInlineStruct.
+	inlineName string
+	inlined    []*ast.Struct
+
+	// maxTypeDepth bounds the nesting of types, such as array<array<T>>,
+	// typeDepth being the depth of the type being parsed.
+	maxTypeDepth int
+	typeDepth    int
 }
 
 func (p *parser) tokenPos(t *token) ast.Position {
@@ -105,8 +153,43 @@ func (p *parser) tokenPos(t *token) ast.Position {
 	}
 }
 
-func (p *parser) errorf(format string, args ...interface{}) {
-	p.onError(fmt.Errorf(format, args...))
+// tokenEnd returns the position right after t.
+func (p *parser) tokenEnd(t *token) ast.Position {
+	pos := p.tokenPos(t)
+	pos.Column += t.End - t.Pos
+	return pos
+}
+
+func (p *parser) errorf(pos ast.Position, format string, args ...interface{}) {
+	p.onError(newDiagnostic(SeverityError, pos, format, args...))
+}
+
+// namingErrorf reports an identifier that does not follow the casing expected
+// for its kind of declaration, suggesting convert(t.Value) as a replacement.
+// When references is set, other identifiers in the file with the same value
+// are renamed along with the declaration, which is used for types and aliases.
+func (p *parser) namingErrorf(t *token, convert func(string) string, references bool, format string, args ...interface{}) {
+	d := newCodedDiagnostic(CodeNamingCase, SeverityError, p.tokenPos(t), format, args...)
+	name := convert(t.Value)
+	if _, reserved := reservedNames[name]; name != "" && name != t.Value && !reserved {
+		fix := &Fix{Title: fmt.Sprintf("Rename %s to %s", t.Value, name)}
+		for i, ref := range p.tokens {
+			if ref.Type != tokenTypeIdentifier || ref.Value != t.Value {
+				continue
+			}
+			isAnnotation := i > 0 && p.tokens[i-1].Type == tokenTypeAtSign
+			if ref.Pos == t.Pos || references && !isAnnotation {
+				fix.Edits = append(fix.Edits, replaceEdit(p.tokenPos(&ref), len([]rune(ref.Value)), name))
+			}
+		}
+		d.Fixes = append(d.Fixes, fix)
+	}
+	p.onError(d)
+}
+
+func (p *parser) peekPos() ast.Position {
+	t := p.peek()
+	return p.tokenPos(&t)
 }
 
 func (p *parser) peek() token {
@@ -116,7 +199,17 @@ func (p *parser) peek() token {
 	return p.tokens[p.pos]
 }
 
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return token{Type: tokenTypeEOF}
+	}
+	return p.tokens[p.pos+n]
+}
+
 func (p *parser) advance() token {
+	if p.pos >= len(p.tokens) {
+		return token{Type: tokenTypeEOF}
+	}
 	t := p.tokens[p.pos]
 	p.pos++
 	return t
@@ -129,18 +222,34 @@ func (p *parser) eof() bool {
 func (p *parser) expect(expected tokenType) *token {
 	pk := p.peek()
 	if pk.Type != expected {
-		msg := fmt.Sprintf("Expected %s but got %s at line %d column %d", expected, pk.Type, pk.Line, pk.Column)
-		p.errorf("%s", msg)
+		d := newDiagnostic(SeverityError, p.tokenPos(&pk), "Expected %s but got %s", expected, pk.Type)
+		if expected == tokenTypeSemi && p.pos > 0 {
+			// Semicolons are inserted right after the previous token, rather
+			// than before the unexpected one, which is usually on the next line.
+			prev := p.tokens[p.pos-1]
+			d.Fixes = append(d.Fixes, replaceFix("Insert missing ;", p.tokenEnd(&prev), 0, ";"))
+		}
+		p.onError(d)
 		return nil
 	}
 	p.pos++
 	return &pk
 }
 
-func (p *parser) discardComments() {
-	for p.peek().Type == tokenTypeComment {
-		p.advance()
+// expectRightAngled is like expect(tokenTypeRightAngled), but splits >> into
+// two closing angles, as found in nested types such as array<array<int32>>.
+func (p *parser) expectRightAngled() *token {
+	if pk := p.peek(); pk.Type == tokenTypeShiftRight {
+		first := pk
+		first.Type, first.Value, first.End = tokenTypeRightAngled, ">", pk.Pos+1
+		second := first
+		second.Pos, second.End, second.Column = first.Pos+1, first.End+1, first.Column+1
+		// The token slice is shared with callers, so it must not be changed
+		// in place.
+		p.tokens = slices.Concat(p.tokens[:p.pos], []token{first, second}, p.tokens[p.pos+1:])
+		p.length = len(p.tokens)
 	}
+	return p.expect(tokenTypeRightAngled)
 }
 
 func (p *parser) consumeUntilSemiOrLinebreak() {
@@ -150,7 +259,7 @@ func (p *parser) consumeUntilSemiOrLinebreak() {
 			p.advance()
 			break
 		}
-		if p.peek().Line != currentLine {
+		if p.peek().Line != currentLine || p.eof() {
 			break
 		}
 		p.advance()
@@ -158,24 +267,28 @@ func (p *parser) consumeUntilSemiOrLinebreak() {
 }
 
 func (p *parser) parsePackage() {
+	comment := p.commentsAsStrings()
+	annotations := p.takeAnnotations()
 	pkg := p.expect(tokenTypeIdentifier)
 	if pkg == nil {
 		return
 	}
 	var components []string
+	var componentTokens []token
 	if pkg.Value != "package" {
-		p.errorf("Expected package but got %s at line %d, column %d", pkg.Value, pkg.Line, pkg.Column)
+		p.errorf(p.tokenPos(pkg), "Expected package but got %s", pkg.Value)
 		return
 	}
 
 	for !p.eof() {
 		pk := p.peek()
 		if pk.Type != tokenTypeIdentifier {
-			p.errorf("Expected identifier at line %d column %d", pk.Line, pk.Column)
+			p.errorf(p.tokenPos(&pk), "Expected identifier")
 			p.consumeUntilSemiOrLinebreak()
 			return
 		}
 		components = append(components, pk.Value)
+		componentTokens = append(componentTokens, pk)
 		p.advance()
 		if p.peek().Type != tokenTypePeriod {
 			break
@@ -183,21 +296,31 @@ func (p *parser) parsePackage() {
 		p.advance()
 	}
 
-	for _, v := range components {
-		if !snakeCaseRegex.MatchString(v) {
-			p.errorf("Invalid package component %s at line %d, column %d, expected snake_case", v, pkg.Line, pkg.Column)
+	for _, t := range componentTokens {
+		if !snakeCaseRegex.MatchString(t.Value) {
+			p.namingErrorf(&t, naming.Snake, false, "Invalid package component %s, expected snake_case", t.Value)
 		}
 	}
 
 	if p.expect(tokenTypeSemi) != nil {
 		p.file.Package.Position = p.tokenPos(pkg)
+		p.file.Package.Comment = comment
+		p.file.Package.Annotations = annotations
 		p.file.Package.Components = components
 		p.file.Package.Value = strings.Join(components, ".")
 	}
 }
 
 func (p *parser) parse() {
-	p.discardComments()
+	for {
+		if p.peek().Type == tokenTypeComment {
+			p.parseComments()
+		} else if p.peek().Type == tokenTypeAtSign {
+			p.parseAnnotations()
+		} else {
+			break
+		}
+	}
 	p.parsePackage()
 
 	for !p.eof() {
@@ -209,7 +332,7 @@ func (p *parser) parse() {
 		case tokenTypeIdentifier:
 			p.parseRootItem()
 		default:
-			p.errorf("Unexpected %s; expected comment, import, annotation, enum, struct, or service", p.peek().Value)
+			p.errorf(p.peekPos(), "Unexpected %s; expected comment, import, annotation, enum, struct, service, or const", p.peek().Value)
 			p.consumeUntilSemiOrLinebreak()
 		}
 	}
@@ -219,7 +342,7 @@ func (p *parser) parseComments() {
 	p.comments = []token{}
 	var lastComment token
 	for p.peek().Type == tokenTypeComment {
-		if lastComment.Type != tokenTypeInvalid && p.peek().Line-lastComment.Line != 1 {
+		if lastComment.Type != tokenTypeInvalid && p.peek().Line-lastComment.lastLine() != 1 {
 			p.comments = []token{}
 		}
 		lastComment = p.advance()
@@ -241,31 +364,177 @@ func (p *parser) parseAnnotation() {
 		p.consumeUntilSemiOrLinebreak()
 		return
 	}
+	// Annotations may be namespaced, such as @go.package
+	comps := []string{name.Value}
+	for p.peek().Type == tokenTypePeriod {
+		p.advance() // Consume period
+		next := p.expect(tokenTypeIdentifier)
+		if next == nil {
+			p.consumeUntilSemiOrLinebreak()
+			return
+		}
+		comps = append(comps, next.Value)
+	}
+	ann := ast.Annotation{
+		Position: p.tokenPos(&atSym),
+		Name:     strings.Join(comps, "."),
+	}
 	if p.peek().Type != tokenTypeLeftParen {
-		p.annotations = append(p.annotations, ast.Annotation{
-			Position: p.tokenPos(&atSym),
-			Name:     name.Value,
-		})
+		p.annotations = append(p.annotations, ann)
 		return
 	}
 
 	p.advance() // Consume LeftParen
-	var params []any
-	for p.peek().Type == tokenTypeString {
-		params = append(params, p.advance().Value)
+	for !p.eof() && p.peek().Type != tokenTypeRightParen {
+		if !p.parseAnnotationArgument(&ann) {
+			break
+		}
 		if p.peek().Type != tokenTypeComma {
 			break
 		}
-	}
-	if p.peek().Type != tokenTypeRightParen && p.peek().Type != tokenTypeString {
-		p.errorf("Expected ) or string, got %s at line %d, column %d", p.peek().Value, p.peek().Line, p.peek().Column)
+		p.advance() // Consume comma
 	}
 	p.expect(tokenTypeRightParen)
-	p.annotations = append(p.annotations, ast.Annotation{
-		Position:  p.tokenPos(&atSym),
-		Name:      name.Value,
-		Arguments: params,
-	})
+	p.annotations = append(p.annotations, ann)
+}
+
+func (p *parser) parseAnnotationArgument(ann *ast.Annotation) bool {
+	if p.peek().Type == tokenTypeIdentifier && p.peekAt(1).Type == tokenTypeEqual {
+		name := p.advance()
+		p.advance() // Consume =
+		value, ok := p.parseAnnotationValue()
+		if !ok {
+			return false
+		}
+		ann.NamedArguments = append(ann.NamedArguments, ast.NamedArgument{
+			Position: p.tokenPos(&name),
+			Name:     name.Value,
+			Value:    value,
+		})
+		return true
+	}
+
+	value, ok := p.parseAnnotationValue()
+	if !ok {
+		return false
+	}
+	ann.Arguments = append(ann.Arguments, value)
+	return true
+}
+
+func (p *parser) parseAnnotationValue() (any, bool) {
+	pk := p.peek()
+	switch pk.Type {
+	case tokenTypeString:
+		return p.parseStringLiteral()
+	case tokenTypeTimestamp:
+		// Literals are validated by the lexer
+		p.advance()
+		t, _ := time.Parse(time.RFC3339Nano, pk.Value)
+		return t, true
+	case tokenTypeDuration:
+		p.advance()
+		d, _ := time.ParseDuration(pk.Value)
+		return d, true
+	case tokenTypeBytes:
+		// Byte strings are decoded by the lexer
+		p.advance()
+		return []byte(pk.Value), true
+	case tokenTypeFloat:
+		return p.parseAnnotationFloat()
+	case tokenTypeNumber, tokenTypeHex, tokenTypeMinus:
+		if pk.Type == tokenTypeMinus && p.peekAt(1).Type == tokenTypeFloat {
+			return p.parseAnnotationFloat()
+		}
+		return p.parseAnnotationInt()
+	case tokenTypeIdentifier:
+		if pk.Value == "true" || pk.Value == "false" {
+			p.advance()
+			return pk.Value == "true", true
+		}
+		p.advance()
+		comps := []string{pk.Value}
+		for p.peek().Type == tokenTypePeriod {
+			p.advance() // Consume period
+			next := p.expect(tokenTypeIdentifier)
+			if next == nil {
+				return nil, false
+			}
+			comps = append(comps, next.Value)
+		}
+		return &ast.AnnotationReference{
+			Position: p.tokenPos(&pk),
+			Name:     strings.Join(comps, "."),
+		}, true
+	default:
+		p.errorf(p.tokenPos(&pk), "Expected ), string, byte string, integer, float, timestamp, duration, or identifier, got %s", pk.Value)
+		return nil, false
+	}
+}
+
+// parseAnnotationFloat parses a float annotation argument, such as 2.5 or
+// -1e3.
+func (p *parser) parseAnnotationFloat() (float64, bool) {
+	sign := ""
+	if p.peek().Type == tokenTypeMinus {
+		p.advance()
+		sign = "-"
+	}
+	lit := p.advance()
+	// Literals are validated by the lexer
+	value, _ := strconv.ParseFloat(sign+lit.Value, 64)
+	return value, true
+}
+
+// parseAnnotationInt parses an integer annotation argument, such as 3, -1,
+// or 0xFF.
+func (p *parser) parseAnnotationInt() (int64, bool) {
+	sign := ""
+	if p.peek().Type == tokenTypeMinus {
+		p.advance()
+		sign = "-"
+	}
+	pk := p.peek()
+	if pk.Type != tokenTypeNumber && pk.Type != tokenTypeHex {
+		p.errorf(p.tokenPos(&pk), "Expected integer after -, got %s", pk.Type)
+		return 0, false
+	}
+	p.advance()
+	digits, base := strings.ReplaceAll(pk.Value, "_", ""), 10
+	if pk.Type == tokenTypeHex {
+		digits, base = digits[2:], 16
+	}
+	value, err := strconv.ParseInt(sign+digits, base, 64)
+	if err != nil {
+		p.errorf(p.tokenPos(&pk), "failed parsing value %s%s: %s", sign, pk.Value, err)
+		return 0, false
+	}
+	return value, true
+}
+
+// parseStringLiteral parses a string literal, which may be split in adjacent
+// literals, optionally joined by +, so long values can span multiple lines:
+//
+//	@doc("Returns the user identified by id, "
+//	     "or NotFound when no such user exists.")
+func (p *parser) parseStringLiteral() (string, bool) {
+	var b strings.Builder
+	b.WriteString(p.advance().Value)
+	for {
+		switch p.peek().Type {
+		case tokenTypeString:
+			b.WriteString(p.advance().Value)
+		case tokenTypePlus:
+			p.advance() // Consume +
+			next := p.expect(tokenTypeString)
+			if next == nil {
+				return "", false
+			}
+			b.WriteString(next.Value)
+		default:
+			return b.String(), true
+		}
+	}
 }
 
 func (p *parser) parseRootItem() {
@@ -276,24 +545,46 @@ func (p *parser) parseRootItem() {
 		p.file.Enums = append(p.file.Enums, p.parseEnum())
 	case "service":
 		svc := p.parseService()
-		for svcID, v := range p.file.Services {
+		for _, v := range p.file.Services {
 			if v.Name == svc.Name {
+				// Re-opened services are merged into the first declaration:
+				// methods and annotations are appended in declaration order,
+				// and comments are only taken when the first block has none.
 				for _, meth := range svc.Methods {
 					v.AppendMethod(meth)
 				}
-				p.file.Services[svcID] = v
+				v.Annotations = append(v.Annotations, svc.Annotations...)
+				if len(v.Comment) == 0 {
+					v.Comment = svc.Comment
+				}
 				return
 			}
 		}
-		p.file.Services = append(p.file.Services, &svc)
+		p.file.Services = append(p.file.Services, svc)
 	case "import":
 		p.file.Imports = append(p.file.Imports, p.parseImport())
+	case "const":
+		p.file.Consts = append(p.file.Consts, p.parseConst())
 	default:
-		p.errorf("Unexpected %s; expected struct, enum, or service", p.peek().Value)
+		p.errorf(p.peekPos(), "Unexpected %s; expected struct, enum, service, or const", p.peek().Value)
 		p.consumeUntilSemiOrLinebreak()
 	}
 }
 
+// trailingComment consumes a comment placed on the same line as the last
+// consumed token, such as the one following a field declaration. Otherwise,
+// the comment would be attached to the next declaration.
+func (p *parser) trailingComment() string {
+	if p.pos == 0 {
+		return ""
+	}
+	if pk := p.peek(); pk.Type == tokenTypeComment && pk.Line == p.tokens[p.pos-1].Line {
+		p.advance()
+		return strings.Join(commentLines(pk), " ")
+	}
+	return ""
+}
+
 func (p *parser) takeAnnotations() []ast.Annotation {
 	a := p.annotations
 	p.annotations = []ast.Annotation{}
@@ -308,29 +599,85 @@ func (p *parser) takeComments() []token {
 
 func (p *parser) parseImport() *ast.Import {
 	tk := p.advance() // consume "import"
-	str := p.expect(tokenTypeString)
-	if str == nil {
+	annotations := p.takeAnnotations()
+	public := p.peekPublic()
+	if public {
+		p.advance() // consume "public"
+	}
+	var value string
+	var last *token
+	byPackage := p.peek().Type == tokenTypeIdentifier
+	if byPackage {
+		value, last = p.parseImportedPackage()
+	} else if last = p.expect(tokenTypeString); last != nil {
+		value = last.Value
+	}
+	if last == nil {
 		p.consumeUntilSemiOrLinebreak()
 		return &ast.Import{}
 	}
 	alias := ""
 	if peek := p.peek(); peek.Type == tokenTypeIdentifier {
 		if peek.Value != "as" {
-			p.errorf("Expected 'as' or ';' after import path, got %s at line %d, column %d", peek.Value, peek.Line, peek.Column)
+			p.errorf(p.tokenPos(&peek), "Expected 'as' or ';' after import path, got %s", peek.Value)
 			p.consumeUntilSemiOrLinebreak()
 			return &ast.Import{}
 		}
 		p.advance() // consume "as"
-		alias = p.expect(tokenTypeIdentifier).Value
+		aliasToken := p.expect(tokenTypeIdentifier)
+		if aliasToken == nil {
+			p.consumeUntilSemiOrLinebreak()
+			return &ast.Import{}
+		}
+		alias = aliasToken.Value
 		if !snakeCaseRegex.MatchString(alias) {
-			p.errorf("Invalid alias %s at line %d, column %d, expected snake_case", alias, peek.Line, peek.Column)
+			p.namingErrorf(aliasToken, naming.Snake, true, "Invalid alias %s, expected snake_case", alias)
 		}
 	}
-	p.expect(tokenTypeSemi)
+	end := p.expect(tokenTypeSemi)
+	if end == nil {
+		end = &p.tokens[p.pos-1]
+	}
 	return &ast.Import{
-		Position: p.tokenPos(&tk),
-		Value:    str.Value,
-		Alias:    alias,
+		Position:    p.tokenPos(&tk),
+		Value:       value,
+		Alias:       alias,
+		Public:      public,
+		ByPackage:   byPackage,
+		PathEnd:     p.tokenEnd(last),
+		End:         p.tokenEnd(end),
+		Annotations: annotations,
+	}
+}
+
+// peekPublic indicates whether the next token is the public modifier of an
+// import, rather than the first component of an imported package.
+func (p *parser) peekPublic() bool {
+	if t := p.peek(); t.Type != tokenTypeIdentifier || t.Value != "public" {
+		return false
+	}
+	next := p.peekAt(1).Type
+	return next == tokenTypeString || next == tokenTypeIdentifier
+}
+
+// parseImportedPackage parses the package name of an import such as
+// import org.example.common;, returning it along with its last token, or nil
+// when it is malformed.
+func (p *parser) parseImportedPackage() (string, *token) {
+	var components []string
+	for {
+		t := p.expect(tokenTypeIdentifier)
+		if t == nil {
+			return "", nil
+		}
+		if !snakeCaseRegex.MatchString(t.Value) {
+			p.namingErrorf(t, naming.Snake, false, "Invalid package component %s, expected snake_case", t.Value)
+		}
+		components = append(components, t.Value)
+		if p.peek().Type != tokenTypePeriod {
+			return strings.Join(components, "."), t
+		}
+		p.advance()
 	}
 }
 
@@ -343,8 +690,36 @@ func mapFn[T any, C []T, U any](c C, fn func(T) U) []U {
 }
 
 func (p *parser) commentsAsStrings() []string {
-	cmm := p.takeComments()
-	return mapFn(cmm, func(t token) string { return t.Value })
+	comments := p.takeComments()
+	res := make([]string, 0, len(comments))
+	for _, t := range comments {
+		res = append(res, commentLines(t)...)
+	}
+	return res
+}
+
+// commentLines returns the lines of the comment t. Block comments are split
+// on line breaks, dropping the asterisks commonly aligned at the start of
+// their lines, as well as leading and trailing blank lines.
+func commentLines(t token) []string {
+	if !t.Block {
+		return []string{t.Value}
+	}
+	lines := strings.Split(t.Value, "\n")
+	for i, l := range lines {
+		l = strings.TrimRight(l, " \t\r")
+		if trimmed := strings.TrimLeft(l, " \t"); i > 0 && strings.HasPrefix(trimmed, "*") {
+			l = trimmed[1:]
+		}
+		lines[i] = l
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
 }
 
 func (p *parser) parseStruct() *ast.Struct {
@@ -365,10 +740,26 @@ func (p *parser) parseStruct() *ast.Struct {
 	} else {
 		str.Name = name.Value
 		if !camelCaseRegex.MatchString(name.Value) {
-			p.errorf("Invalid struct name %s at line %d, column %d, expected CamelCase", name.Value, name.Line, name.Column)
+			p.namingErrorf(name, naming.Camel, true, "Invalid struct name %s, expected CamelCase", name.Value)
+		}
+	}
+
+	if pk := p.peek(); pk.Type == tokenTypeIdentifier && pk.Value == "extends" {
+		p.advance()
+		t := p.parseType()
+		if rt, ok := t.(ast.ResolvableType); ok {
+			str.Extends = rt
+		} else if t != nil {
+			p.errorf(p.tokenPos(&pk), "Struct %s can only extend another struct, such as struct Admin extends User, but got %s", str.Name, typeString(t))
 		}
 	}
 
+	p.parseStructBody(&str)
+	return &str
+}
+
+// parseStructBody parses the declarations of str, enclosed in curly braces.
+func (p *parser) parseStructBody(str *ast.Struct) {
 	p.expect(tokenTypeLeftCurly)
 
 loop:
@@ -382,17 +773,29 @@ loop:
 			case "enum":
 				str.AppendEnum(p.parseEnum())
 			case "service":
-				p.errorf("Invalid service declaration at line %d, column %d: Services cannot be declared inside structs", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid service declaration: Services cannot be declared inside structs")
 				p.parseService()
+			case "union":
+				str.AppendUnion(p.parseUnion())
+			case "reserved":
+				if !p.atReserved() {
+					str.AppendField(p.parseStructField())
+					break
+				}
+				str.Reserved = append(str.Reserved, p.parseReserved())
 			default:
 				v := pk.Value
 				if _, ok := reservedNames[v]; ok {
-					p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Value, pk.Line, pk.Column)
+					p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Value)
 					p.consumeUntilSemiOrLinebreak()
 					continue
 				}
 				str.AppendField(p.parseStructField())
 			}
+			for _, inline := range p.inlined {
+				str.AppendStruct(inline)
+			}
+			p.inlined = nil
 		case tokenTypeAtSign:
 			p.parseAnnotations()
 		case tokenTypeComment:
@@ -400,14 +803,36 @@ loop:
 		case tokenTypeRightCurly:
 			break loop
 		default:
-			p.errorf("unexpected %s at line %d, column %d, expected identifier", pk.Type, pk.Line, pk.Column)
+			p.errorf(p.tokenPos(&pk), "unexpected %s, expected identifier", pk.Type)
 			p.consumeUntilSemiOrLinebreak()
 		}
 	}
 
-	p.expect(tokenTypeRightCurly)
+	if end := p.expect(tokenTypeRightCurly); end != nil {
+		str.End = p.tokenEnd(end)
+	}
+}
 
-	return &str
+// parseInlineStruct parses a struct declared inline, such as
+// struct { street string; }, as the type of a field or method return. The
+// struct is named after p.inlineName, and collected in p.inlined, to be
+// declared next to the field or method by the caller; the type returned
+// references it.
+func (p *parser) parseInlineStruct(tk *token) ast.Type {
+	pos := p.tokenPos(tk)
+	if p.inlineName == "" {
+		p.errorf(pos, "Unexpected inline struct; inline structs may only be declared once, as the type of a field or method return")
+	}
+	str := &ast.Struct{Position: pos, Name: p.inlineName, Inline: true}
+	p.inlineName = ""
+
+	// Structs declared inline by the fields of str belong to str itself,
+	// and the types of its fields start a new nesting.
+	outer, depth := p.inlined, p.typeDepth
+	p.inlined, p.typeDepth = nil, 0
+	p.parseStructBody(str)
+	p.inlined, p.typeDepth = append(outer, str), depth
+	return &ast.SimpleUserType{Position: pos, Name: str.Name}
 }
 
 func (p *parser) parseStructField() ast.StructField {
@@ -422,22 +847,274 @@ func (p *parser) parseStructField() ast.StructField {
 	}
 
 	if !snakeCaseRegex.MatchString(f.Name) {
-		p.errorf("Invalid field name %s at line %d, column %d, expected snake_case", f.Name, f.Position.Line, f.Position.Column)
+		p.namingErrorf(&n, naming.Snake, false, "Invalid field name %s, expected snake_case", f.Name)
 	}
 
-	if fieldType := p.parseType(); p == nil {
+	p.inlineName = naming.Camel(f.Name)
+	f.Type = p.parseType()
+	p.inlineName = ""
+
+	if p.peek().Type == tokenTypeEqual {
+		p.advance()
+		if !p.parseFieldIndex(&f) {
+			p.consumeUntilSemiOrLinebreak()
+			return f
+		}
+	} else if _, ok := f.Type.(*ast.SimpleUserType); ok && len(p.inlined) > 0 && p.peek().Type != tokenTypeSemi {
+		// The semicolon following an inline struct is optional
+		f.TrailingComment = p.trailingComment()
 		return f
-	} else {
-		f.Type = fieldType
 	}
-
 	if p.expect(tokenTypeSemi) == nil {
 		p.consumeUntilSemiOrLinebreak()
 		return f
 	}
+	f.TrailingComment = p.trailingComment()
 	return f
 }
 
+// parseConst parses a constant declaration, such as
+// `const MAX_PAGE_SIZE uint32 = 100;`.
+func (p *parser) parseConst() *ast.Const {
+	tk := p.advance() // Consume "const"
+	c := ast.Const{
+		Position:    p.tokenPos(&tk),
+		Comment:     p.commentsAsStrings(),
+		Annotations: p.takeAnnotations(),
+	}
+
+	name := p.expect(tokenTypeIdentifier)
+	if name == nil {
+		p.consumeUntilSemiOrLinebreak()
+		return &c
+	}
+	c.Name = name.Value
+	if !screamingSnakeCaseRegex.MatchString(name.Value) {
+		p.namingErrorf(name, naming.Screaming, true, "Invalid constant name %s, expected SCREAMING_SNAKE_CASE", name.Value)
+	}
+
+	if c.Type = p.parseType(); c.Type == nil {
+		return &c
+	}
+	if p.expect(tokenTypeEqual) == nil || !p.parseConstValue(&c) {
+		p.consumeUntilSemiOrLinebreak()
+		return &c
+	}
+	if p.expect(tokenTypeSemi) == nil {
+		p.consumeUntilSemiOrLinebreak()
+		return &c
+	}
+	c.TrailingComment = p.trailingComment()
+	return &c
+}
+
+// parseConstValue parses the value of c, either a literal or an integer
+// expression.
+func (p *parser) parseConstValue(c *ast.Const) bool {
+	pk := p.peek()
+	switch {
+	case pk.Type == tokenTypeIdentifier && (pk.Value == "true" || pk.Value == "false"):
+		p.advance()
+		c.Literal = pk.Value == "true"
+	case pk.Type == tokenTypeString, pk.Type == tokenTypeBytes, pk.Type == tokenTypeTimestamp, pk.Type == tokenTypeDuration:
+		value, ok := p.parseAnnotationValue()
+		if !ok {
+			return false
+		}
+		c.Literal = value
+	case pk.Type == tokenTypeFloat, pk.Type == tokenTypeMinus && p.peekAt(1).Type == tokenTypeFloat:
+		c.Literal, _ = p.parseAnnotationFloat()
+	default:
+		if c.Expr = p.parseExpr(); c.Expr == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUnion parses a union declared within a struct, such as
+// `union contact { email string; phone string; }`. Structs declared inline
+// by its members are left in p.inlined.
+func (p *parser) parseUnion() *ast.Union {
+	tk := p.advance() // Consume "union"
+	u := ast.Union{
+		Position:    p.tokenPos(&tk),
+		Comment:     p.commentsAsStrings(),
+		Annotations: p.takeAnnotations(),
+	}
+
+	if name := p.expect(tokenTypeIdentifier); name == nil {
+		p.consumeUntilSemiOrLinebreak()
+	} else {
+		u.Name = name.Value
+		if !snakeCaseRegex.MatchString(name.Value) {
+			p.namingErrorf(name, naming.Snake, false, "Invalid union name %s, expected snake_case", name.Value)
+		}
+	}
+
+	p.expect(tokenTypeLeftCurly)
+
+loop:
+	for !p.eof() {
+		pk := p.peek()
+		switch pk.Type {
+		case tokenTypeIdentifier:
+			switch pk.Value {
+			case "struct":
+				p.errorf(p.tokenPos(&pk), "Invalid struct declaration: Structs cannot be declared inside unions")
+				p.parseStruct()
+			case "enum":
+				p.errorf(p.tokenPos(&pk), "Invalid enum declaration: Enums cannot be declared inside unions")
+				p.parseEnum()
+			case "service":
+				p.errorf(p.tokenPos(&pk), "Invalid service declaration: Services cannot be declared inside unions")
+				p.parseService()
+			case "union":
+				p.errorf(p.tokenPos(&pk), "Invalid union declaration: Unions cannot be declared inside unions")
+				p.parseUnion()
+			default:
+				if _, ok := reservedNames[pk.Value]; ok {
+					p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Value)
+					p.consumeUntilSemiOrLinebreak()
+					continue
+				}
+				f := p.parseStructField()
+				u.Fields = append(u.Fields, &f)
+			}
+		case tokenTypeAtSign:
+			p.parseAnnotations()
+		case tokenTypeComment:
+			p.parseComments()
+		case tokenTypeRightCurly:
+			break loop
+		default:
+			p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Type)
+			p.consumeUntilSemiOrLinebreak()
+		}
+	}
+
+	if end := p.expect(tokenTypeRightCurly); end != nil {
+		u.End = p.tokenEnd(end)
+	}
+	return &u
+}
+
+// parseFieldIndex parses the index following the equal sign of a field, such
+// as 3 in `id int64 = 3;`. The equal sign always declares an index, so
+// defaults, including references to constants, are declared through
+// @default instead.
+func (p *parser) parseFieldIndex(f *ast.StructField) bool {
+	pk := p.peek()
+	if pk.Type == tokenTypeIdentifier {
+		p.errorf(p.tokenPos(&pk), "Expected field index, such as %s %s = 1, but got %s: the equal sign declares the index of a field; declare its default through @default(%s) instead", f.Name, typeString(f.Type), pk.Value, pk.Value)
+		return false
+	}
+	if pk.Type != tokenTypeNumber && pk.Type != tokenTypeHex {
+		p.errorf(p.tokenPos(&pk), "Expected field index, such as %s %s = 1, but got %s", f.Name, typeString(f.Type), pk.Type)
+		return false
+	}
+	p.advance()
+	digits, base := strings.ReplaceAll(pk.Value, "_", ""), 10
+	if pk.Type == tokenTypeHex {
+		digits, base = digits[2:], 16
+	}
+	index, err := strconv.ParseInt(digits, base, 32)
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	if err != nil {
+		p.errorf(p.tokenPos(&pk), "Invalid index %s of field %s: %s", pk.Value, f.Name, err)
+		return false
+	}
+	f.Index, f.IndexDeclared = int(index), true
+	return true
+}
+
+// atReserved indicates whether the next tokens start a reserved statement,
+// rather than a field or member named reserved.
+func (p *parser) atReserved() bool {
+	switch p.peekAt(1).Type {
+	case tokenTypeNumber, tokenTypeHex, tokenTypeMinus, tokenTypeString:
+		return true
+	}
+	return false
+}
+
+// parseReserved parses a reserved statement, such as reserved 4, 5; or
+// reserved "old_name";. Indices and names may not be mixed by a single
+// statement.
+func (p *parser) parseReserved() *ast.Reserved {
+	tk := p.advance() // Consume "reserved"
+	r := &ast.Reserved{Position: p.tokenPos(&tk)}
+	names := p.peek().Type == tokenTypeString
+	for {
+		pk := p.peek()
+		index := pk.Type == tokenTypeNumber || pk.Type == tokenTypeHex || pk.Type == tokenTypeMinus
+		if names && index || !names && pk.Type == tokenTypeString {
+			p.errorf(p.tokenPos(&pk), "Reserved indices and names cannot be mixed; declare them by separate reserved statements")
+			p.consumeUntilSemiOrLinebreak()
+			return r
+		}
+		if names {
+			if pk.Type != tokenTypeString {
+				p.errorf(p.tokenPos(&pk), "Expected reserved name, such as reserved \"old_name\", but got %s", pk.Type)
+				p.consumeUntilSemiOrLinebreak()
+				return r
+			}
+			name, ok := p.parseStringLiteral()
+			if !ok {
+				p.consumeUntilSemiOrLinebreak()
+				return r
+			}
+			r.Names = append(r.Names, name)
+		} else {
+			index, ok := p.parseReservedIndex()
+			if !ok {
+				p.consumeUntilSemiOrLinebreak()
+				return r
+			}
+			r.Indices = append(r.Indices, index)
+		}
+		if p.peek().Type != tokenTypeComma {
+			break
+		}
+		p.advance()
+	}
+	if p.expect(tokenTypeSemi) == nil {
+		p.consumeUntilSemiOrLinebreak()
+	}
+	return r
+}
+
+// parseReservedIndex parses an index of a reserved statement, which may be
+// negative to reserve the value of an enum member.
+func (p *parser) parseReservedIndex() (int, bool) {
+	sign := int64(1)
+	if p.peek().Type == tokenTypeMinus {
+		p.advance()
+		sign = -1
+	}
+	pk := p.peek()
+	if pk.Type != tokenTypeNumber && pk.Type != tokenTypeHex {
+		p.errorf(p.tokenPos(&pk), "Expected reserved index, such as reserved 4, but got %s", pk.Type)
+		return 0, false
+	}
+	p.advance()
+	digits, base := strings.ReplaceAll(pk.Value, "_", ""), 10
+	if pk.Type == tokenTypeHex {
+		digits, base = digits[2:], 16
+	}
+	index, err := strconv.ParseInt(digits, base, 32)
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	if err != nil {
+		p.errorf(p.tokenPos(&pk), "Invalid reserved index %s: %s", pk.Value, err)
+		return 0, false
+	}
+	return int(sign * index), true
+}
+
 func (p *parser) parseEnum() *ast.Enum {
 	tk := p.advance() // Consume "enum"
 	en := ast.Enum{
@@ -446,12 +1123,18 @@ func (p *parser) parseEnum() *ast.Enum {
 		Annotations: p.takeAnnotations(),
 	}
 
+	// flags is a modifier only when followed by the name of the enum
+	if pk := p.peek(); pk.Type == tokenTypeIdentifier && pk.Value == "flags" && p.peekAt(1).Type == tokenTypeIdentifier {
+		p.advance()
+		en.Flags = true
+	}
+
 	if name := p.expect(tokenTypeIdentifier); name == nil {
 		p.consumeUntilSemiOrLinebreak()
 	} else {
 		en.Name = name.Value
 		if !camelCaseRegex.MatchString(name.Value) {
-			p.errorf("Invalid enum name %s at line %d, column %d, expected CamelCase", name.Value, name.Line, name.Column)
+			p.namingErrorf(name, naming.Camel, true, "Invalid enum name %s, expected CamelCase", name.Value)
 		}
 	}
 
@@ -464,18 +1147,24 @@ loop:
 		case tokenTypeIdentifier:
 			switch pk.Value {
 			case "struct":
-				p.errorf("Invalid struct declaration at line %d, column %d: Structs cannot be declared inside enums", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid struct declaration: Structs cannot be declared inside enums")
 				p.parseStruct()
 			case "enum":
-				p.errorf("Invalid enum declaration at line %d, column %d: Enums cannot be declared inside enums", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid enum declaration: Enums cannot be declared inside enums")
 				p.parseEnum()
 			case "service":
-				p.errorf("Invalid service declaration at line %d, column %d: Services cannot be declared inside enums", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid service declaration: Services cannot be declared inside enums")
 				p.parseService()
+			case "reserved":
+				if !p.atReserved() {
+					en.AppendMember(p.parseEnumMember())
+					break
+				}
+				en.Reserved = append(en.Reserved, p.parseReserved())
 			default:
 				v := pk.Value
 				if _, ok := reservedNames[v]; ok {
-					p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Value, pk.Line, pk.Column)
+					p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Value)
 					p.consumeUntilSemiOrLinebreak()
 					continue
 				}
@@ -488,16 +1177,179 @@ loop:
 		case tokenTypeRightCurly:
 			break loop
 		default:
-			p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Type, pk.Line, pk.Column)
+			p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Type)
 			p.consumeUntilSemiOrLinebreak()
 		}
 	}
 
-	p.expect(tokenTypeRightCurly)
+	if end := p.expect(tokenTypeRightCurly); end != nil {
+		en.End = p.tokenEnd(end)
+	}
+	p.evaluateEnum(&en)
 
 	return &en
 }
 
+// evaluateEnum evaluates the value of each member of e. Members may reference
+// other members of the same enum by name, regardless of their order. Members
+// declared without a value are assigned the value of the previous member plus
+// one, starting at zero, or the next power of two in flags enums. Values must
+// fit in an int16, so negative values such as -1 are allowed.
+func (p *parser) evaluateEnum(e *ast.Enum) {
+	const (
+		pending = iota
+		evaluating
+		done
+	)
+	state := map[*ast.EnumMember]int{}
+	var eval func(m *ast.EnumMember) (int64, error)
+	eval = func(m *ast.EnumMember) (int64, error) {
+		switch state[m] {
+		case evaluating:
+			return 0, newDiagnostic(SeverityError, m.Position, "Enum member %s is defined in terms of itself", m.Name)
+		case done:
+			return int64(m.Value), nil
+		}
+		state[m] = evaluating
+		var v int64
+		var err error
+		if m.Implicit {
+			if idx := slices.Index(e.Members, m); idx > 0 {
+				v, err = eval(e.Members[idx-1])
+				switch {
+				case !e.Flags || v < 0:
+					v++
+				case v == 0:
+					v = 1
+				default:
+					// Members of flags enums take the next bit, so they
+					// are never combinations of the previous ones
+					v = 1 << bits.Len64(uint64(v))
+				}
+			}
+			if err == nil && v > math.MaxInt16 {
+				err = newDiagnostic(SeverityError, m.Position, "enum member %s value %d, following the previous member, overflows int16", m.Name, v)
+			}
+		} else {
+			v, err = evalConst(m.Expr, func(ref *ast.ConstRef) (int64, error) {
+				target := e.FindMember(ref.Name)
+				if target == nil || target.Expr == nil && !target.Implicit {
+					return 0, newDiagnostic(SeverityError, ref.Position, "Undefined enum member %s in enum %s", ref.Name, e.Name)
+				}
+				ref.Resolved = target
+				return eval(target)
+			})
+			if err == nil && (v < math.MinInt16 || v > math.MaxInt16) {
+				err = newDiagnostic(SeverityError, *m.Expr.Pos(), "enum member value %s (%d) underflows or overflows int16", m.Expr, v)
+			}
+		}
+		state[m] = done
+		m.Value = int(v)
+		return v, err
+	}
+
+	for _, m := range e.Members {
+		if m.Expr == nil && !m.Implicit || state[m] == done {
+			continue
+		}
+		if _, err := eval(m); err != nil {
+			p.onError(err)
+		}
+	}
+}
+
+var binaryPrecedence = map[tokenType]int{
+	tokenTypePipe:       1,
+	tokenTypeCaret:      2,
+	tokenTypeAmpersand:  3,
+	tokenTypeShiftLeft:  4,
+	tokenTypeShiftRight: 4,
+	tokenTypePlus:       5,
+	tokenTypeMinus:      5,
+	tokenTypeStar:       6,
+	tokenTypeSlash:      6,
+	tokenTypePercent:    6,
+}
+
+// parseExpr parses a constant expression, such as 1 << 2 or FIRST + 1.
+// Operators follow the usual precedence: multiplicative operators bind
+// tighter than additive ones, followed by shifts, &, ^, and |.
+func (p *parser) parseExpr() ast.Expr {
+	return p.parseBinaryExpr(1)
+}
+
+func (p *parser) parseBinaryExpr(minPrecedence int) ast.Expr {
+	x := p.parseUnaryExpr()
+	for x != nil {
+		op := p.peek()
+		precedence, ok := binaryPrecedence[op.Type]
+		if !ok || precedence < minPrecedence {
+			break
+		}
+		p.advance()
+		y := p.parseBinaryExpr(precedence + 1)
+		if y == nil {
+			return nil
+		}
+		x = &ast.BinaryExpr{Position: p.tokenPos(&op), Op: op.Value, X: x, Y: y}
+	}
+	return x
+}
+
+func (p *parser) parseUnaryExpr() ast.Expr {
+	pk := p.peek()
+	switch pk.Type {
+	case tokenTypeMinus, tokenTypeTilde:
+		p.advance()
+		x := p.parseUnaryExpr()
+		if x == nil {
+			return nil
+		}
+		return &ast.UnaryExpr{Position: p.tokenPos(&pk), Op: pk.Value, X: x}
+	case tokenTypeLeftParen:
+		p.advance()
+		x := p.parseExpr()
+		if x == nil || p.expect(tokenTypeRightParen) == nil {
+			return nil
+		}
+		return &ast.ParenExpr{Position: p.tokenPos(&pk), X: x}
+	case tokenTypeIdentifier:
+		p.advance()
+		name := pk.Value
+		for p.peek().Type == tokenTypePeriod {
+			p.advance() // Consume period
+			next := p.expect(tokenTypeIdentifier)
+			if next == nil {
+				return nil
+			}
+			name += "." + next.Value
+		}
+		return &ast.ConstRef{Position: p.tokenPos(&pk), Name: name}
+	case tokenTypeNumber, tokenTypeHex:
+		p.advance()
+		digits, base := strings.ReplaceAll(pk.Value, "_", ""), 10
+		if pk.Type == tokenTypeHex {
+			digits, base = digits[2:], 16
+		}
+		lit := &ast.IntLiteral{Position: p.tokenPos(&pk), Raw: pk.Value}
+		var err error
+		if lit.Value, err = strconv.ParseInt(digits, base, 64); errors.Is(err, strconv.ErrRange) {
+			// Only unsigned constants may hold such values
+			var u uint64
+			u, err = strconv.ParseUint(digits, base, 64)
+			lit.Value, lit.Unsigned = int64(u), true
+		}
+		if err != nil {
+			p.errorf(p.tokenPos(&pk), "failed parsing value %s: %s", pk.Value, err)
+			return nil
+		}
+		return lit
+	default:
+		p.errorf(p.tokenPos(&pk), "Expected Number, Hex, or identifier but got %s", pk.Type)
+		return nil
+	}
+}
+
 func (p *parser) parseEnumMember() ast.EnumMember {
 	member := ast.EnumMember{
 		Comment:     p.commentsAsStrings(),
@@ -511,61 +1363,42 @@ func (p *parser) parseEnumMember() ast.EnumMember {
 		member.Position = p.tokenPos(name)
 		member.Name = name.Value
 		if !screamingSnakeCaseRegex.MatchString(member.Name) {
-			p.errorf("Invalid enum member name %s at line %d, column %d, expected SCREAMING_SNAKE_CASE", member.Name, member.Position.Line, member.Position.Column)
+			p.namingErrorf(name, naming.Screaming, false, "Invalid enum member name %s, expected SCREAMING_SNAKE_CASE", member.Name)
 		}
 	}
 
+	// Members without a value follow the previous one
+	if p.peek().Type == tokenTypeSemi {
+		p.advance()
+		member.Implicit = true
+		member.TrailingComment = p.trailingComment()
+		return member
+	}
+
 	if p.expect(tokenTypeEqual) == nil {
 		p.consumeUntilSemiOrLinebreak()
 		return member
 	}
 
-	switch p.peek().Type {
-	case tokenTypeNumber:
-		value := p.advance()
-		valueInt, err := strconv.ParseInt(value.Value, 10, 64)
-		if err != nil {
-			p.errorf("failed parsing enum member value %s at line %d, column %d: %s", value.Value, value.Line, value.Column, err)
-			break
-		}
-		if valueInt < 0 || valueInt > math.MaxInt16 {
-			p.errorf("enum member value %s underflows or overflows uint16 at line %d, column %d: %s", value.Value, value.Line, value.Column, err)
-			break
-		}
-
-		member.Value = int(valueInt)
-
-	case tokenTypeHex:
-		value := p.advance()
-		valueInt, err := strconv.ParseInt(value.Value[2:], 16, 64)
-		if err != nil {
-			p.errorf("failed parsing enum member value %s at line %d, column %d: %s", value.Value, value.Line, value.Column, err)
-			break
-		}
-		if valueInt < 0 || valueInt > math.MaxInt16 {
-			p.errorf("enum member value %s underflows or overflows uint16 at line %d, column %d: %s", value.Value, value.Line, value.Column, err)
-			break
-		}
-		member.Value = int(valueInt)
-
-	default:
-		pk := p.peek()
-		msg := fmt.Sprintf("Expected Number of Hex but got %s at line %d column %d", pk.Type, pk.Line, pk.Column)
-		p.errorf("%s", msg)
+	// Values are evaluated once all members are known, as expressions may
+	// reference members declared afterwards.
+	if member.Expr = p.parseExpr(); member.Expr == nil {
 		p.consumeUntilSemiOrLinebreak()
 		return member
 	}
 
 	if p.expect(tokenTypeSemi) == nil {
 		p.consumeUntilSemiOrLinebreak()
+		return member
 	}
+	member.TrailingComment = p.trailingComment()
 
 	return member
 }
 
-func (p *parser) parseService() ast.Service {
+func (p *parser) parseService() *ast.Service {
 	tk := p.advance() // Consume "service"
-	svc := ast.Service{
+	svc := &ast.Service{
 		Position:    p.tokenPos(&tk),
 		Comment:     p.commentsAsStrings(),
 		Annotations: p.takeAnnotations(),
@@ -576,7 +1409,7 @@ func (p *parser) parseService() ast.Service {
 	} else {
 		svc.Name = name.Value
 		if !camelCaseRegex.MatchString(name.Value) {
-			p.errorf("Invalid service name %s at line %d, column %d, expected CamelCase", name.Value, name.Line, name.Column)
+			p.namingErrorf(name, naming.Camel, true, "Invalid service name %s, expected CamelCase", name.Value)
 		}
 	}
 
@@ -589,22 +1422,22 @@ loop:
 		case tokenTypeIdentifier:
 			switch pk.Value {
 			case "struct":
-				p.errorf("Invalid struct declaration at line %d, column %d: Structs cannot be declared inside services", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid struct declaration: Structs cannot be declared inside services")
 				p.parseStruct()
 			case "enum":
-				p.errorf("Invalid enum declaration at line %d, column %d: Enums cannot be declared inside services", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid enum declaration: Enums cannot be declared inside services")
 				p.parseEnum()
 			case "service":
-				p.errorf("Invalid service declaration at line %d, column %d: Services cannot be declared inside services", pk.Line, pk.Column)
+				p.errorf(p.tokenPos(&pk), "Invalid service declaration: Services cannot be declared inside services")
 				p.parseService()
 			default:
 				v := pk.Value
 				if _, ok := reservedNames[v]; ok {
-					p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Value, pk.Line, pk.Column)
+					p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Value)
 					p.consumeUntilSemiOrLinebreak()
 					continue
 				}
-				svc.AppendMethod(p.parseServiceMethod())
+				svc.AppendMethod(p.parseServiceMethod(svc))
 			}
 		case tokenTypeAtSign:
 			p.parseAnnotations()
@@ -613,17 +1446,22 @@ loop:
 		case tokenTypeRightCurly:
 			break loop
 		default:
-			p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Type, pk.Line, pk.Column)
+			p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Type)
 			p.consumeUntilSemiOrLinebreak()
 		}
 	}
 
-	p.expect(tokenTypeRightCurly)
+	if end := p.expect(tokenTypeRightCurly); end != nil {
+		svc.End = p.tokenEnd(end)
+	}
 
 	return svc
 }
 
-func (p *parser) parseServiceMethod() *ast.ServiceMethod {
+// parseServiceMethod parses a method of svc. Structs declared inline by its
+// returns are named after svc and the method, such as UsersGetResponse, and
+// declared at the top level of the file.
+func (p *parser) parseServiceMethod(svc *ast.Service) *ast.ServiceMethod {
 	method := &ast.ServiceMethod{
 		Comment:     p.commentsAsStrings(),
 		Annotations: p.takeAnnotations(),
@@ -636,7 +1474,7 @@ func (p *parser) parseServiceMethod() *ast.ServiceMethod {
 		method.Name = name.Value
 		method.Position = p.tokenPos(name)
 		if !camelCaseRegex.MatchString(method.Name) {
-			p.errorf("Invalid method name %s at line %d, column %d, expected CamelCase", method.Name, method.Position.Line, method.Position.Column)
+			p.namingErrorf(name, naming.Camel, false, "Invalid method name %s, expected CamelCase", method.Name)
 		}
 	}
 
@@ -658,37 +1496,144 @@ func (p *parser) parseServiceMethod() *ast.ServiceMethod {
 
 	if p.peek().Type == tokenTypeArrow {
 		p.advance() // Consume arrow
-		for _, r := range p.parseMethodReturns() {
+		for _, r := range p.parseMethodReturns(svc.Name + method.Name + "Response") {
 			method.AppendReturn(&r)
 		}
+		p.file.Structs = append(p.file.Structs, p.inlined...)
+		p.inlined = nil
+	}
+
+	if pk := p.peek(); pk.Type == tokenTypeIdentifier && pk.Value == "throws" {
+		p.advance()
+		for _, e := range p.parseMethodErrors() {
+			if e.Type != nil {
+				method.AppendError(&e)
+			}
+		}
 	}
 
 	streamFound := false
 	for _, param := range method.Params {
 		if streamFound {
-			p.errorf("Stream must be the last parameter of a method at %s, line %d, column %d", param.Position.Filename, param.Position.Line, param.Position.Column)
+			p.errorf(param.Position, "Stream must be the last parameter of a method")
 			break
 		}
 		if param.Stream {
 			streamFound = true
 		}
 	}
+	method.ClientStreaming = streamFound
 
 	streamFound = false
 	for _, ret := range method.Returns {
 		if streamFound {
-			p.errorf("Stream must be the last return value of a method at %s, line %d, column %d", ret.Position.Filename, ret.Position.Line, ret.Position.Column)
+			p.errorf(ret.Position, "Stream must be the last return value of a method")
 			break
 		}
 		if ret.Stream {
 			streamFound = true
 		}
 	}
+	method.ServerStreaming = streamFound
 
-	p.expect(tokenTypeSemi)
+	if prev := p.tokens[p.pos-1]; prev.Type == tokenTypeRightCurly && p.peek().Type != tokenTypeSemi {
+		// As after fields, the semicolon following an inline struct is
+		// optional
+		method.End = p.tokenEnd(&prev)
+		method.TrailingComment = p.trailingComment()
+		return method
+	}
+	if end := p.expect(tokenTypeSemi); end != nil {
+		method.End = p.tokenEnd(end)
+		method.TrailingComment = p.trailingComment()
+	}
 	return method
 }
 
+// parseGenericType parses the arguments of a map, array, or optional type,
+// enclosed in angles following typeName.
+func (p *parser) parseGenericType(typeName *token) ast.Type {
+	pos := p.tokenPos(typeName)
+	open := p.expect(tokenTypeLeftAngled)
+	if open == nil {
+		p.consumeUntilSemiOrLinebreak()
+		return nil
+	}
+	if p.typeDepth >= p.maxTypeDepth {
+		p.errorf(pos, "Type nested too deeply: at most %s of array, map, and optional may be nested", plural(p.maxTypeDepth, "level"))
+		p.skipTypeArguments()
+		return nil
+	}
+	p.typeDepth++
+	defer func() { p.typeDepth-- }()
+
+	var args []ast.Type
+	args = append(args, p.parseNestedType())
+	if typeName.Value == "map" {
+		if p.peek().Type != tokenTypeComma {
+			pk := p.peek()
+			p.errorf(p.tokenPos(&pk), "map expects a key and a value type, such as map<string, int32>; got %s", pk.Type)
+			if pk.Type == tokenTypeRightAngled || pk.Type == tokenTypeShiftRight {
+				p.expectRightAngled()
+			}
+			return nil
+		}
+		p.advance() // Consume comma
+		args = append(args, p.parseNestedType())
+	} else if pk := p.peek(); pk.Type == tokenTypeComma {
+		p.errorf(p.tokenPos(&pk), "%s expects a single type, such as %s<int32>", typeName.Value, typeName.Value)
+		p.skipTypeArguments()
+		return nil
+	}
+
+	if pk := p.peek(); pk.Type != tokenTypeRightAngled && pk.Type != tokenTypeShiftRight {
+		// The type is kept, so a missing angle is reported once, rather
+		// than along with the field it belongs to.
+		d := newDiagnostic(SeverityError, p.tokenPos(&pk), "Expected > to close %s< opened at line %d, column %d, got %s", typeName.Value, open.Line, open.Column, pk.Type)
+		if p.pos > 0 {
+			prev := p.tokens[p.pos-1]
+			d.Fixes = append(d.Fixes, replaceFix("Insert missing >", p.tokenEnd(&prev), 0, ">"))
+		}
+		p.onError(d)
+	} else {
+		p.expectRightAngled()
+	}
+
+	switch typeName.Value {
+	case "map":
+		return &ast.MapType{Position: pos, Key: args[0], Value: args[1]}
+	case "array":
+		return &ast.ArrayType{Position: pos, Type: args[0]}
+	case "set":
+		return &ast.SetType{Position: pos, Type: args[0]}
+	default:
+		return &ast.OptionalType{Position: pos, Type: args[0]}
+	}
+}
+
+// skipTypeArguments skips the arguments of a generic type, up to the angle
+// closing them, the opening angle being already consumed.
+func (p *parser) skipTypeArguments() {
+	for depth := 1; depth > 0 && !p.eof(); {
+		switch p.peek().Type {
+		case tokenTypeLeftAngled:
+			depth++
+		case tokenTypeRightAngled:
+			depth--
+		case tokenTypeShiftRight:
+			if depth == 1 {
+				// Only the first angle closes the skipped type
+				p.expectRightAngled()
+				return
+			}
+			depth -= 2
+		case tokenTypeSemi, tokenTypeLeftCurly, tokenTypeRightCurly:
+			return
+		}
+		p.advance()
+	}
+}
+
 func (p *parser) parseMethodParams() []ast.MethodParam {
 	res := []ast.MethodParam{p.parseMethodParam()}
 	for p.peek().Type == tokenTypeComma {
@@ -714,27 +1659,35 @@ func (p *parser) parseMethodParam() ast.MethodParam {
 	return param
 }
 
-func (p *parser) parseMethodReturns() []ast.MethodReturn {
+// parseMethodReturns parses the returns of a method. Structs declared inline
+// by returns are named inlineName, followed by the position of the return
+// after the first one, such as GetResponse2.
+func (p *parser) parseMethodReturns(inlineName string) []ast.MethodReturn {
 	pk := p.peek()
 	switch {
 	case pk.Type == tokenTypeIdentifier:
+		p.inlineName = inlineName
+		defer func() { p.inlineName = "" }()
 		return []ast.MethodReturn{p.parseMethodReturn()}
 	case pk.Type == tokenTypeLeftParen:
 		p.advance()
 		if p.peek().Type == tokenTypeRightParen {
 			p.advance()
-			return nil
+			return []ast.MethodReturn{{Position: p.tokenPos(&pk), Type: &ast.EmptyType{Position: p.tokenPos(&pk)}}}
 		}
+		p.inlineName = inlineName
 		ret := []ast.MethodReturn{p.parseMethodReturn()}
 		for p.peek().Type == tokenTypeComma {
 			p.advance() // consume comma
+			p.inlineName = fmt.Sprintf("%s%d", inlineName, len(ret)+1)
 			ret = append(ret, p.parseMethodReturn())
 		}
+		p.inlineName = ""
 		p.expect(tokenTypeRightParen)
 		return ret
 
 	default:
-		p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Type.String(), pk.Line, pk.Column)
+		p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Type.String())
 		p.consumeUntilSemiOrLinebreak()
 		return nil
 	}
@@ -746,7 +1699,7 @@ func (p *parser) parseMethodReturn() ast.MethodReturn {
 	case pk.Type == tokenTypeIdentifier && pk.Value == "stream":
 		p.advance()
 		if p.peek().Type == tokenTypeLeftParen {
-			p.errorf("Unexpected %s at line %d, column %d; cannot stream tuples", pk.Value, pk.Line, pk.Column)
+			p.errorf(p.tokenPos(&pk), "Unexpected %s; cannot stream tuples", pk.Value)
 			for !p.eof() && p.peek().Type != tokenTypeRightParen {
 				p.advance()
 			}
@@ -756,74 +1709,113 @@ func (p *parser) parseMethodReturn() ast.MethodReturn {
 	case pk.Type == tokenTypeIdentifier:
 		return ast.MethodReturn{Position: p.tokenPos(&pk), Type: p.parseType(), Stream: false}
 	case pk.Type == tokenTypeLeftParen:
-		p.errorf("Unexpected %s at line %d, column %d; expected identifier", pk.Type, pk.Line, pk.Column)
+		p.errorf(p.tokenPos(&pk), "Unexpected %s; expected identifier", pk.Type)
 		p.advance()
 		if p.peek().Type == tokenTypeRightParen {
 			p.advance()
 		}
 		return ast.MethodReturn{}
 	default:
-		p.errorf("Unexpected %s at line %d, column %d, expected identifier", pk.Type, pk.Line, pk.Column)
+		p.errorf(p.tokenPos(&pk), "Unexpected %s, expected identifier", pk.Type)
 		p.consumeUntilSemiOrLinebreak()
 		return ast.MethodReturn{}
 	}
 }
 
+// parseMethodErrors parses the types listed by the throws clause of a method,
+// either a single one or several enclosed in parens.
+func (p *parser) parseMethodErrors() []ast.MethodError {
+	if p.peek().Type != tokenTypeLeftParen {
+		return []ast.MethodError{p.parseMethodError()}
+	}
+	p.advance()
+	res := []ast.MethodError{p.parseMethodError()}
+	for p.peek().Type == tokenTypeComma {
+		p.advance() // Consume comma
+		res = append(res, p.parseMethodError())
+	}
+	p.expect(tokenTypeRightParen)
+	return res
+}
+
+func (p *parser) parseMethodError() ast.MethodError {
+	pk := p.peek()
+	res := ast.MethodError{Position: p.tokenPos(&pk)}
+	t := p.parseType()
+	if rt, ok := t.(ast.ResolvableType); ok {
+		res.Type = rt
+	} else if t != nil {
+		p.errorf(res.Position, "Methods can only throw structs and enums, such as throws (NotFound), but got %s", typeString(t))
+	}
+	return res
+}
+
+// parseType parses the type of a field, method param, or method return.
 func (p *parser) parseType() ast.Type {
+	t := p.parseNestedType()
+	// Closing angles left after a complete type have nothing to close.
+	for pk := p.peek(); pk.Type == tokenTypeRightAngled || pk.Type == tokenTypeShiftRight; pk = p.peek() {
+		d := newDiagnostic(SeverityError, p.tokenPos(&pk), "Unexpected %s, no < left to close", pk.Value)
+		d.Fixes = append(d.Fixes, replaceFix("Remove extra "+pk.Value, p.tokenPos(&pk), pk.End-pk.Pos, ""))
+		p.onError(d)
+		p.advance()
+	}
+	return t
+}
+
+// parseNestedType parses a type, including the types nested within it, such
+// as array<map<string, optional<Foo>>>. A trailing question mark, as in
+// string?, is a shorthand for optional<string>.
+func (p *parser) parseNestedType() ast.Type {
+	start := p.peek()
+	t := p.parseUnsuffixedType()
+	for t != nil && p.peek().Type == tokenTypeQuestion {
+		q := p.advance()
+		if p.typeDepth+typeLevels(t) >= p.maxTypeDepth {
+			p.errorf(p.tokenPos(&q), "Type nested too deeply: at most %s of array, map, and optional may be nested", plural(p.maxTypeDepth, "level"))
+			return nil
+		}
+		t = &ast.OptionalType{Position: p.tokenPos(&start), Type: t}
+	}
+	return t
+}
+
+// typeLevels returns how many levels of array, set, map, and optional t
+// nests.
+func typeLevels(t ast.Type) int {
+	switch tt := t.(type) {
+	case *ast.ArrayType:
+		return 1 + typeLevels(tt.Type)
+	case *ast.SetType:
+		return 1 + typeLevels(tt.Type)
+	case *ast.OptionalType:
+		return 1 + typeLevels(tt.Type)
+	case *ast.MapType:
+		return 1 + max(typeLevels(tt.Key), typeLevels(tt.Value))
+	}
+	return 0
+}
+
+// parseUnsuffixedType parses a type up to its optional shorthand, if any.
+func (p *parser) parseUnsuffixedType() ast.Type {
 	typeName := p.expect(tokenTypeIdentifier)
 	if typeName == nil {
 		p.consumeUntilSemiOrLinebreak()
 		return nil
 	}
 	switch typeName.Value {
-	case "map":
-		if p.expect(tokenTypeLeftAngled) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
-		}
-		k := p.parseType()
-		if p.expect(tokenTypeComma) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
-		}
-		v := p.parseType()
-		if p.expect(tokenTypeRightAngled) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
-		}
-		return &ast.MapType{
-			Position: p.tokenPos(typeName),
-			Key:      k,
-			Value:    v,
-		}
-	case "array":
-		if p.expect(tokenTypeLeftAngled) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
-		}
-		t := p.parseType()
-		if p.expect(tokenTypeRightAngled) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
-		}
-		return &ast.ArrayType{
-			Position: p.tokenPos(typeName),
-			Type:     t,
-		}
-	case "optional":
-		if p.expect(tokenTypeLeftAngled) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
-		}
-		t := p.parseType()
-		if p.expect(tokenTypeRightAngled) == nil {
-			p.consumeUntilSemiOrLinebreak()
-			return nil
+	case "struct":
+		if p.peek().Type == tokenTypeLeftCurly {
+			return p.parseInlineStruct(typeName)
 		}
-		return &ast.OptionalType{
-			Position: p.tokenPos(typeName),
-			Type:     t,
+		return &ast.SimpleUserType{Position: p.tokenPos(typeName), Name: typeName.Value}
+	case "map", "array", "set", "optional":
+		return p.parseGenericType(typeName)
+	case "empty":
+		if p.peek().Type != tokenTypePeriod {
+			return &ast.EmptyType{Position: p.tokenPos(typeName)}
 		}
+		fallthrough
 	default:
 		if _, ok := primitives[typeName.Value]; ok {
 			return &ast.PrimitiveType{
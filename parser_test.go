@@ -3,6 +3,7 @@ package idl
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/arf-rpc/idl/ast"
@@ -22,3 +23,382 @@ func TestParser(t *testing.T) {
 	fmt.Println()
 	ast.Print(f)
 }
+
+func TestPackageDocumentation(t *testing.T) {
+	src := `# License header
+
+# Package users manages user accounts.
+# It is the source of truth for identities.
+package users;
+
+# S is a struct.
+struct S{}
+`
+	scan, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+	require.Equal(t, []string{" Package users manages user accounts.", " It is the source of truth for identities."}, f.Package.Comment)
+	require.Equal(t, []string{" S is a struct."}, f.Structs[0].Comment)
+}
+
+func TestTrailingComments(t *testing.T) {
+	src := `package users;
+
+struct User {
+    name string; # the user's name
+    # Leading comment
+    email string;
+}
+
+enum Role {
+    ADMIN = 1; # full access
+    GUEST = 2;
+}
+
+service Users {
+    Get(id string) -> User; # fetches a user
+    List() -> stream User;
+}
+`
+	scan, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+
+	fields := f.Structs[0].Fields
+	require.Equal(t, " the user's name", fields[0].TrailingComment)
+	require.Empty(t, fields[0].Comment)
+	require.Empty(t, fields[1].TrailingComment)
+	require.Equal(t, []string{" Leading comment"}, fields[1].Comment)
+
+	members := f.Enums[0].Members
+	require.Equal(t, " full access", members[0].TrailingComment)
+	require.Empty(t, members[1].Comment)
+
+	methods := f.Services[0].Methods
+	require.Equal(t, " fetches a user", methods[0].TrailingComment)
+	require.Empty(t, methods[1].Comment)
+}
+
+func TestBlockComments(t *testing.T) {
+	src := `package users;
+
+/*
+ * A registered user.
+ *
+ * Users sign in with their email.
+ */
+struct User {
+    /* Display name */
+    name /* inline */ string; /* the user's name */
+    # Line comment
+    /* and a block */
+    email string;
+}
+`
+	scan, errs := lexFile([]byte(src), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+
+	user := f.Structs[0]
+	require.Equal(t, []string{" A registered user.", "", " Users sign in with their email."}, user.Comment)
+	require.Equal(t, []string{" Display name"}, user.Fields[0].Comment)
+	require.Equal(t, " the user's name", user.Fields[0].TrailingComment)
+	require.Equal(t, []string{" Line comment", " and a block"}, user.Fields[1].Comment)
+}
+
+func TestEnumConstantExpressions(t *testing.T) {
+	parseEnum := func(t *testing.T, body string) (*ast.Enum, []error) {
+		scan, errs := lexFile([]byte("package flags;\n\nenum Flag {\n"+body+"}\n"), nil)
+		require.Empty(t, errs)
+		f, errs := parse("", scan, nil)
+		return f.Enums[0], errs
+	}
+
+	e, errs := parseEnum(t, `
+    NONE = 0;
+    A = 1 << 0;
+    B = A << 1;
+    C = LAST - 1;
+    ALL = (A | B | C) & ~NONE;
+    LAST = 0x10 + 2 * 3 % 4;
+    K = 1_000 + 0x0_1;
+`)
+	require.Empty(t, errs)
+	values := map[string]int{}
+	for _, m := range e.Members {
+		values[m.Name] = m.Value
+	}
+	require.Equal(t, map[string]int{"NONE": 0, "A": 1, "B": 2, "C": 17, "ALL": 19, "LAST": 18, "K": 1001}, values)
+	require.Equal(t, "(A | B | C) & ~NONE", e.FindMember("ALL").Expr.String())
+	require.Equal(t, "A << 1", e.FindMember("B").Expr.String())
+	ref := e.FindMember("B").Expr.(*ast.BinaryExpr).X.(*ast.ConstRef)
+	require.Same(t, e.FindMember("A"), ref.Resolved)
+
+	for body, msg := range map[string]string{
+		"A = B;\nB = A;\n":                        "Enum member A is defined in terms of itself",
+		"A = MISSING + 1;\n":                      "Undefined enum member MISSING in enum Flag",
+		"A = 1 / 0;\n":                            "Division by zero in 1 / 0",
+		"A = 0x7FFFFFFFFFFFFFFF + 1;\n":           "Constant expression 0x7FFFFFFFFFFFFFFF + 1 overflows int64",
+		"A = 1 << 63;\n":                          "Invalid shift count 63 in 1 << 63",
+		"A = 0 - 0x8001;\n":                       "enum member value 0 - 0x8001 (-32769) underflows or overflows int16",
+		"A = 0x7FFF;\nB;\n":                       "enum member B value 32768, following the previous member, overflows int16",
+		"A = 1 +;\n":                              "Expected Number, Hex, or identifier but got Semi",
+		"A = 99999999999999999999999999999999;\n": "failed parsing value",
+	} {
+		_, errs := parseEnum(t, body)
+		require.NotEmpty(t, errs, body)
+		require.Contains(t, errs[0].Error(), msg, body)
+	}
+}
+
+func TestNestedTypeClosingAngles(t *testing.T) {
+	scan, errs := lexFile([]byte("package nested;\n\nstruct S {\n    m map<string, array<array<int32>>>;\n}\n"), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+	m := f.Structs[0].Fields[0].Type.(*ast.MapType)
+	inner := m.Value.(*ast.ArrayType).Type.(*ast.ArrayType)
+	require.Equal(t, "int32", inner.Type.(*ast.PrimitiveType).Name)
+}
+
+func TestNestedTypes(t *testing.T) {
+	parseField := func(typ string, depth int) (ast.Type, []error) {
+		scan, errs := lexFile([]byte("package nested;\n\nstruct S {\n    f "+typ+";\n    g int32;\n}\n"), nil)
+		require.Empty(t, errs, typ)
+		f, errs := parseWithTypeDepth("", scan, nil, depth)
+		require.Len(t, f.Structs[0].Fields, 2, typ)
+		return f.Structs[0].Fields[0].Type, errs
+	}
+
+	typ, errs := parseField("array<map<string, optional<array<Foo>>>>", DefaultMaxTypeDepth)
+	require.Empty(t, errs)
+	value := typ.(*ast.ArrayType).Type.(*ast.MapType).Value
+	require.Equal(t, "Foo", value.(*ast.OptionalType).Type.(*ast.ArrayType).Type.(*ast.SimpleUserType).Name)
+
+	_, errs = parseField("array<map<string, int32>>", 2)
+	require.Empty(t, errs)
+	_, errs = parseField("array<map<string, optional<int32>>>", 2)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "Type nested too deeply: at most 2 levels of array, map, and optional may be nested at , line 4, column 25")
+
+	typ, errs = parseField("array<map<string, int32>", DefaultMaxTypeDepth)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "Expected > to close array< opened at line 4, column 12, got Semi at , line 4, column 31")
+	require.Equal(t, "Insert missing >", errs[0].(*Diagnostic).Fixes[0].Title)
+	require.IsType(t, &ast.MapType{}, typ.(*ast.ArrayType).Type)
+
+	for typ, msg := range map[string]string{
+		"array<int32>>":         "Unexpected >, no < left to close",
+		"int32>>":               "Unexpected >>, no < left to close",
+		"map<string>":           "map expects a key and a value type, such as map<string, int32>; got RightAngled",
+		"array<int32, string>":  "array expects a single type, such as array<int32>",
+		"optional<array<int32>": "Expected > to close optional<",
+	} {
+		_, errs := parseField(typ, DefaultMaxTypeDepth)
+		require.Len(t, errs, 1, typ)
+		require.ErrorContains(t, errs[0], msg, typ)
+	}
+
+	fe, err := New(StdinEntrypoint, WithMaxTypeDepth(1), WithStdin(strings.NewReader("package nested;\n\nstruct S {\n    f array<array<int32>>;\n}\n")))
+	require.NoError(t, err)
+	require.ErrorContains(t, fe.Compile().Err(), "at most 1 level of array")
+}
+
+func TestOptionalShorthand(t *testing.T) {
+	parseField := func(typ string, depth int) (ast.Type, []error) {
+		scan, errs := lexFile([]byte("package nested;\n\nstruct S {\n    f "+typ+";\n}\n"), nil)
+		require.Empty(t, errs, typ)
+		f, errs := parseWithTypeDepth("", scan, nil, depth)
+		return f.Structs[0].Fields[0].Type, errs
+	}
+
+	typ, errs := parseField("string?", DefaultMaxTypeDepth)
+	require.Empty(t, errs)
+	require.True(t, typ.Eql(&ast.OptionalType{Type: &ast.PrimitiveType{Name: "string"}}))
+	require.Equal(t, 4, typ.(*ast.OptionalType).Position.Line)
+	require.Equal(t, 7, typ.(*ast.OptionalType).Position.Column)
+
+	typ, errs = parseField("array<common.Contact?>?", DefaultMaxTypeDepth)
+	require.Empty(t, errs)
+	contact := typ.(*ast.OptionalType).Type.(*ast.ArrayType).Type.(*ast.OptionalType).Type
+	require.Equal(t, "common.Contact", contact.(*ast.FullQualifiedType).FullName)
+
+	_, errs = parseField("array<int32>?", 2)
+	require.Empty(t, errs)
+	_, errs = parseField("array<int32?>?", 2)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "Type nested too deeply: at most 2 levels of array, map, and optional may be nested at , line 4, column 20")
+}
+
+func TestEnumAutoIncrement(t *testing.T) {
+	scan, errs := lexFile([]byte(`package states;
+
+enum State {
+    UNKNOWN;
+    PENDING;
+    RUNNING = 10;
+    DONE; # follows RUNNING
+    FAILED = DONE + 10;
+    CANCELLED;
+}
+`), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+	var values []int
+	for _, m := range f.Enums[0].Members {
+		values = append(values, m.Value)
+	}
+	require.Equal(t, []int{0, 1, 10, 11, 21, 22}, values)
+	require.True(t, f.Enums[0].Members[0].Implicit)
+	require.Nil(t, f.Enums[0].Members[0].Expr)
+	require.False(t, f.Enums[0].Members[2].Implicit)
+	require.Equal(t, " follows RUNNING", f.Enums[0].Members[3].TrailingComment)
+}
+
+func TestAnnotationStringConcatenation(t *testing.T) {
+	scan, errs := lexFile([]byte(`package docs;
+
+@doc("Users are identified "
+     "by their email, "
+     + 'see https://example.com/' + "users")
+@http("GET", "/users/" "{id}")
+struct User {}
+`), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+	anns := f.Structs[0].Annotations
+	require.Equal(t, []any{"Users are identified by their email, see https://example.com/users"}, anns[0].Arguments)
+	require.Equal(t, []any{"GET", "/users/{id}"}, anns[1].Arguments)
+
+	scan, errs = lexFile([]byte("package docs;\n\n@doc(\"a\" + )\nstruct User {}\n"), nil)
+	require.Empty(t, errs)
+	_, errs = parse("", scan, nil)
+	require.NotEmpty(t, errs)
+}
+
+// Annotation arguments are tokenized along with the rest of the file, so
+// parentheses and commas within strings do not end them early.
+func TestAnnotationArgumentsWithDelimiters(t *testing.T) {
+	scan, errs := lexFile([]byte(`package docs;
+
+@doc("Returns (a, b) pairs; see f(x).", "\")\"")
+@pattern(regex = "^(\w+)\)$", name = "paren")
+struct Pair {}
+`), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+	require.Len(t, f.Structs, 1)
+	anns := f.Structs[0].Annotations
+	require.Equal(t, []any{"Returns (a, b) pairs; see f(x).", `")"`}, anns[0].Arguments)
+	require.Equal(t, "regex", anns[1].NamedArguments[0].Name)
+	require.Equal(t, `^(\w+)\)$`, anns[1].NamedArguments[0].Value)
+	require.Equal(t, "paren", anns[1].NamedArguments[1].Value)
+}
+
+func TestAnnotationFloats(t *testing.T) {
+	scan, errs := lexFile([]byte(`package shapes;
+
+struct Circle {
+    @default(2.5)
+    radius float64;
+    @range(-0.5, 1.5e2)
+    ratio float32;
+}
+`), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+	fields := f.Structs[0].Fields
+	require.Equal(t, []any{2.5}, fields[0].Annotations[0].Arguments)
+	require.Equal(t, []any{-0.5, 150.0}, fields[1].Annotations[0].Arguments)
+}
+
+func TestInlineStructs(t *testing.T) {
+	scan, errs := lexFile([]byte(`package shop;
+
+struct User {
+    address struct {
+        street string;
+        geo struct { lat float64; }
+    }
+    tags array<struct { key string; }>;
+}
+
+service Users {
+    Get(u User) -> struct { user User; };
+    Pair(u User) -> (User, struct { found bool; });
+}
+`), nil)
+	require.Empty(t, errs)
+	f, errs := parse("", scan, nil)
+	require.Empty(t, errs)
+
+	user := f.Structs[0]
+	require.Equal(t, "Address", user.Fields[0].Type.(*ast.SimpleUserType).Name)
+	require.Equal(t, "Tags", user.Fields[1].Type.(*ast.ArrayType).Type.(*ast.SimpleUserType).Name)
+	require.Len(t, user.Structs, 2)
+	address := user.Structs[0]
+	require.Equal(t, "Address", address.Name)
+	require.True(t, address.Inline)
+	require.Same(t, user, address.Parent)
+	require.Equal(t, "Geo", address.Structs[0].Name)
+	require.Equal(t, "Tags", user.Structs[1].Name)
+
+	require.Len(t, f.Structs, 3)
+	require.Equal(t, "UsersGetResponse", f.Structs[1].Name)
+	require.Equal(t, "UsersPairResponse2", f.Structs[2].Name)
+	require.True(t, f.Structs[2].Inline)
+	require.Equal(t, "UsersPairResponse2", f.Services[0].Methods[1].Returns[1].Type.(*ast.SimpleUserType).Name)
+
+	// Semicolons following inline structs are optional, for fields and
+	// method returns alike
+	scan, errs = lexFile([]byte(`package shop;
+
+struct User {
+    address struct { street string; };
+    geo struct { lat float64; }
+}
+
+service Users {
+    Get(u User) -> struct { user User; } # fetches a user
+    List(u User) -> stream struct { user User; }
+    Delete(u User) -> struct { deleted bool; };
+}
+`), nil)
+	require.Empty(t, errs)
+	f, errs = parse("", scan, nil)
+	require.Empty(t, errs)
+	require.Len(t, f.Structs[0].Fields, 2)
+	methods := f.Services[0].Methods
+	require.Len(t, methods, 3)
+	require.Equal(t, " fetches a user", methods[0].TrailingComment)
+	require.True(t, methods[1].ServerStreaming)
+	require.Equal(t, "UsersDeleteResponse", methods[2].Returns[0].Type.(*ast.SimpleUserType).Name)
+
+	for _, src := range []string{
+		"package shop; service Users { Get(u struct { id string; }) -> User; }",
+		"package shop; struct S { m map<struct { a string; }, struct { b string; }>; }",
+	} {
+		scan, errs := lexFile([]byte(src), nil)
+		require.Empty(t, errs, src)
+		_, errs = parse("", scan, nil)
+		require.Len(t, errs, 1, src)
+		require.ErrorContains(t, errs[0], "Unexpected inline struct", src)
+	}
+}
+
+func TestParseIncompleteSources(t *testing.T) {
+	data, err := os.ReadFile("fixtures/full.arf")
+	require.NoError(t, err)
+	src := []rune(string(data))
+	for i := range src {
+		tokens, _ := lexFile([]byte(string(src[:i])), nil)
+		require.NotPanics(t, func() { parse("full.arf", tokens, nil) }, string(src[:i]))
+	}
+}
@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/arf-rpc/idl/descriptor"
+)
+
+// Client talks to a registry Server.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the registry at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) url(pkg string, rest ...string) string {
+	parts := append([]string{c.BaseURL, "v1", "packages", url.PathEscape(pkg), "versions"}, rest...)
+	return strings.Join(parts, "/")
+}
+
+func (c *Client) do(ctx context.Context, method, url string, body, out any) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s", ErrNotFound, e.Error)
+		case http.StatusConflict:
+			return fmt.Errorf("%w: %s", ErrConflict, e.Error)
+		default:
+			return fmt.Errorf("registry: %s: %s", resp.Status, e.Error)
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Publish uploads b to the registry.
+func (c *Client) Publish(ctx context.Context, b *Bundle) error {
+	if b.Digest == "" {
+		b.Digest = b.ComputeDigest()
+	}
+	return c.do(ctx, http.MethodPut, c.url(b.Package, url.PathEscape(b.Version)), b, nil)
+}
+
+// Fetch downloads the bundle published for pkg at version, verifying its
+// digest.
+func (c *Client) Fetch(ctx context.Context, pkg, version string) (*Bundle, error) {
+	var b Bundle
+	if err := c.do(ctx, http.MethodGet, c.url(pkg, url.PathEscape(version)), nil, &b); err != nil {
+		return nil, err
+	}
+	if b.Digest != b.ComputeDigest() {
+		return nil, fmt.Errorf("registry: digest mismatch for %s@%s", pkg, version)
+	}
+	return &b, nil
+}
+
+// Descriptors downloads the descriptor set compiled from the bundle published
+// for pkg at version.
+func (c *Client) Descriptors(ctx context.Context, pkg, version string) (*descriptor.Set, error) {
+	var set descriptor.Set
+	if err := c.do(ctx, http.MethodGet, c.url(pkg, url.PathEscape(version), "descriptors"), nil, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// Versions lists the versions published for pkg.
+func (c *Client) Versions(ctx context.Context, pkg string) ([]string, error) {
+	var versions []string
+	if err := c.do(ctx, http.MethodGet, c.url(pkg), nil, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -0,0 +1,273 @@
+// Package registry implements a small HTTP protocol for publishing schemas to
+// a central registry, which compiles them to descriptor sets, and fetching
+// them by package and version.
+//
+// The protocol is composed of the following endpoints, all exchanging JSON:
+//
+//	PUT /v1/packages/{package}/versions/{version}              publishes a Bundle
+//	GET /v1/packages/{package}/versions/{version}              fetches a Bundle
+//	GET /v1/packages/{package}/versions/{version}/descriptors  fetches its descriptor set
+//	GET /v1/packages/{package}/versions                        lists published versions
+//
+// Published versions are immutable: publishing a different Bundle under an
+// existing version is rejected.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/descriptor"
+)
+
+var (
+	ErrNotFound = errors.New("registry: not found")
+	ErrConflict = errors.New("registry: version already published with different contents")
+)
+
+// Bundle is the unit of publication: a set of schema files belonging to a
+// package version. Files maps slash-separated paths, relative to the bundle
+// root, to their contents. Extensions lists the extensions of those files, as
+// configured through idl.WithExtensions, and defaults to
+// idl.DefaultExtensions. Descriptors holds the descriptor set compiled from
+// them by the registry, which is not part of the digest.
+type Bundle struct {
+	Package     string            `json:"package"`
+	Version     string            `json:"version"`
+	Entrypoint  string            `json:"entrypoint"`
+	Files       map[string]string `json:"files"`
+	Extensions  []string          `json:"extensions,omitempty"`
+	Digest      string            `json:"digest"`
+	Descriptors *descriptor.Set   `json:"descriptors,omitempty"`
+}
+
+// NewBundle creates a Bundle from files on disk. Paths are recorded relative
+// to root, and entrypoint must be one of them.
+func NewBundle(pkg, version, root, entrypoint string, paths ...string) (*Bundle, error) {
+	b := &Bundle{
+		Package: pkg,
+		Version: version,
+		Files:   make(map[string]string, len(paths)),
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil, err
+		}
+		b.Files[filepath.ToSlash(rel)] = string(data)
+	}
+	rel, err := filepath.Rel(root, entrypoint)
+	if err != nil {
+		return nil, err
+	}
+	b.Entrypoint = filepath.ToSlash(rel)
+	if _, ok := b.Files[b.Entrypoint]; !ok {
+		return nil, fmt.Errorf("entrypoint %s is not part of the bundle", entrypoint)
+	}
+	b.Digest = b.ComputeDigest()
+	return b, nil
+}
+
+// ComputeDigest returns the SHA-256 digest of the bundle files, independent of
+// the order in which they were added.
+func (b *Bundle) ComputeDigest() string {
+	keys := make([]string, 0, len(b.Files))
+	for k := range b.Files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(k), k, len(b.Files[k]), b.Files[k])
+	}
+	// Extensions change how imports resolve. They are only hashed when set,
+	// so bundles relying on the defaults keep their digest.
+	for _, ext := range b.Extensions {
+		fmt.Fprintf(h, "ext%d:%s", len(ext), ext)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Compile compiles the entrypoint of the bundle, ensuring the bundle declares
+// the expected package. Imports are only resolved against the files of the
+// bundle: nothing is read from the local filesystem, as bundles may come from
+// untrusted clients.
+func (b *Bundle) Compile(opts ...idl.Option) (*ast.Tree, error) {
+	if err := b.checkPaths(); err != nil {
+		return nil, err
+	}
+	entrypoint, ok := b.Files[b.Entrypoint]
+	if !ok {
+		return nil, fmt.Errorf("entrypoint %s is not part of the bundle", b.Entrypoint)
+	}
+
+	opts = append(opts,
+		idl.WithoutFilesystem(),
+		idl.WithExtensions(b.extensions()...),
+		idl.WithResolver(func(idl.Resolver) idl.Resolver {
+			return &bundleResolver{files: b.Files, extensions: b.extensions()}
+		}),
+		idl.WithStdin(strings.NewReader(entrypoint)),
+		idl.WithStdinFilename("/"+b.Entrypoint),
+	)
+	tree, err := idl.Parse(idl.StdinEntrypoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tree.Packages[b.Package]; !ok {
+		return nil, fmt.Errorf("bundle does not declare package %s", b.Package)
+	}
+	return tree, nil
+}
+
+func (b *Bundle) extensions() []string {
+	if len(b.Extensions) == 0 {
+		return idl.DefaultExtensions
+	}
+	return b.Extensions
+}
+
+// checkPaths ensures the paths of the bundle files are clean and relative,
+// without leading ../ elements.
+func (b *Bundle) checkPaths() error {
+	for name := range b.Files {
+		if !filepath.IsLocal(filepath.FromSlash(name)) || path.Clean(name) != name {
+			return fmt.Errorf("invalid bundle path %s", name)
+		}
+	}
+	return nil
+}
+
+// bundleResolver resolves imports against the files of a bundle, keyed by
+// their path relative to the bundle root. Their locations are those paths,
+// prefixed with a slash. Imports lacking one of extensions are looked up with
+// each of them in order.
+type bundleResolver struct {
+	files      map[string]string
+	extensions []string
+}
+
+func (r *bundleResolver) Resolve(from, value string) (string, error) {
+	location := path.Join(path.Dir(from), value)
+	candidates := []string{location}
+	if !r.hasExtension(location) {
+		candidates = candidates[:0]
+		for _, ext := range r.extensions {
+			candidates = append(candidates, location+ext)
+		}
+	}
+	for _, c := range candidates {
+		if _, ok := r.files[strings.TrimPrefix(c, "/")]; ok {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("cannot import %s: not part of the bundle", value)
+}
+
+func (r *bundleResolver) Glob(from, value string) ([]string, error) {
+	pattern := path.Join(path.Dir(from), value)
+	var res []string
+	for name := range r.files {
+		if ok, err := path.Match(pattern, "/"+name); err != nil {
+			return nil, err
+		} else if ok && r.hasExtension(name) {
+			res = append(res, "/"+name)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (r *bundleResolver) ReadFile(location string) ([]byte, error) {
+	data, ok := r.files[strings.TrimPrefix(location, "/")]
+	if !ok {
+		return nil, fmt.Errorf("%s is not part of the bundle", location)
+	}
+	return []byte(data), nil
+}
+
+// hasExtension indicates whether name ends with one of the extensions,
+// regardless of casing.
+func (r *bundleResolver) hasExtension(name string) bool {
+	for _, ext := range r.extensions {
+		if strings.HasSuffix(strings.ToLower(name), strings.ToLower(ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists published bundles.
+type Store interface {
+	Put(b *Bundle) error
+	Get(pkg, version string) (*Bundle, error)
+	Versions(pkg string) ([]string, error)
+}
+
+// NewMemoryStore returns a Store keeping bundles in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{bundles: map[string]map[string]*Bundle{}}
+}
+
+type memoryStore struct {
+	mu      sync.RWMutex
+	bundles map[string]map[string]*Bundle
+}
+
+func (m *memoryStore) Put(b *Bundle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions, ok := m.bundles[b.Package]
+	if !ok {
+		versions = map[string]*Bundle{}
+		m.bundles[b.Package] = versions
+	}
+	if ex, ok := versions[b.Version]; ok {
+		if ex.Digest != b.Digest {
+			return ErrConflict
+		}
+		return nil
+	}
+	versions[b.Version] = b
+	return nil
+}
+
+func (m *memoryStore) Get(pkg, version string) (*Bundle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.bundles[pkg][version]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+func (m *memoryStore) Versions(pkg string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions, ok := m.bundles[pkg]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	res := make([]string, 0, len(versions))
+	for v := range versions {
+		res = append(res, v)
+	}
+	sort.Strings(res)
+	return res, nil
+}
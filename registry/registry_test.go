@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl/descriptor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishAndFetch(t *testing.T) {
+	srv := httptest.NewServer(NewServer(NewMemoryStore()))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ctx := context.Background()
+
+	root := filepath.Join("..", "fixtures")
+	b, err := NewBundle("v1beta1.demo.allfeatures", "1.0.0", root,
+		filepath.Join(root, "full.arf"),
+		filepath.Join(root, "full.arf"),
+		filepath.Join(root, "common.arf"),
+		filepath.Join(root, "utility.arf"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, client.Publish(ctx, b))
+	// Publishing the same contents again is a no-op
+	require.NoError(t, client.Publish(ctx, b))
+
+	fetched, err := client.Fetch(ctx, "v1beta1.demo.allfeatures", "1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, b.Digest, fetched.Digest)
+	tree, err := fetched.Compile()
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "v1beta1.other.common")
+
+	set, err := client.Descriptors(ctx, "v1beta1.demo.allfeatures", "1.0.0")
+	require.NoError(t, err)
+	require.NotNil(t, descriptor.NewRegistry(set).Struct("v1beta1.demo.allfeatures.Everything"))
+	require.Equal(t, set, fetched.Descriptors)
+
+	versions, err := client.Versions(ctx, "v1beta1.demo.allfeatures")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1.0.0"}, versions)
+
+	_, err = client.Fetch(ctx, "v1beta1.demo.allfeatures", "2.0.0")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	changed := *b
+	changed.Files = map[string]string{"full.arf": "package v1beta1.demo.allfeatures; struct S { f string; }"}
+	changed.Entrypoint = "full.arf"
+	changed.Digest = changed.ComputeDigest()
+	require.ErrorIs(t, client.Publish(ctx, &changed), ErrConflict)
+
+	broken := &Bundle{Package: "broken", Version: "1.0.0", Entrypoint: "b.arf", Files: map[string]string{"b.arf": "package broken; struct S { f Missing; }"}}
+	err = client.Publish(ctx, broken)
+	require.ErrorContains(t, err, "bundle does not compile: error: Undefined type Missing at /b.arf, line 1, column 30")
+
+	escaping := &Bundle{Package: "x", Version: "1.0.0", Entrypoint: "../x.arf", Files: map[string]string{"../x.arf": "package x;"}}
+	require.ErrorContains(t, client.Publish(ctx, escaping), "invalid bundle path")
+}
+
+func TestCompileOnlyReadsBundleFiles(t *testing.T) {
+	b := &Bundle{Package: "x", Version: "1.0.0", Entrypoint: "schemas/x.arf", Files: map[string]string{
+		"schemas/x.arf":      "package x;\n\nimport \"common\";\n\nstruct S {\n    c common.C;\n}\n",
+		"schemas/common.arf": "package common;\n\nstruct C {}\n",
+	}}
+	_, err := b.Compile()
+	require.NoError(t, err)
+
+	for _, imp := range []string{"../../fixtures/common.arf", "/etc/passwd", "../x.arf"} {
+		b.Files["schemas/x.arf"] = "package x;\n\nimport \"" + imp + "\";\n"
+		_, err = b.Compile()
+		require.ErrorContains(t, err, "not part of the bundle", imp)
+	}
+}
+
+func TestPublishImportedTypes(t *testing.T) {
+	srv := httptest.NewServer(NewServer(NewMemoryStore()))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ctx := context.Background()
+
+	root := filepath.Join("..", "fixtures", "imported_types")
+	b, err := NewBundle("shop.orders", "1.0.0", root,
+		filepath.Join(root, "main.arf"),
+		filepath.Join(root, "main.arf"),
+		filepath.Join(root, "common.arf"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, client.Publish(ctx, b))
+	set, err := client.Descriptors(ctx, "shop.orders", "1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, "shop.common.Unit", descriptor.NewRegistry(set).Struct("shop.common.Money").Field("unit").Type.Name)
+}
+
+func TestBundleExtensions(t *testing.T) {
+	b := &Bundle{Package: "x", Version: "1.0.0", Entrypoint: "x.idl", Extensions: []string{".idl"}, Files: map[string]string{
+		"x.idl":       "package x;\n\nimport \"common\";\nimport \"extra/*\";\n\nstruct S {\n    c common.C;\n}\n",
+		"common.idl":  "package common;\n\nstruct C {}\n",
+		"extra/e.idl": "package extra;\n\nstruct E {}\n",
+		"extra/e.arf": "package ignored;\n\nstruct E {}\n",
+	}}
+	tree, err := b.Compile()
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "common")
+	require.Contains(t, tree.Packages, "extra")
+	require.NotContains(t, tree.Packages, "ignored")
+
+	// Extensions are part of the digest, as they change how imports resolve
+	digest := b.ComputeDigest()
+	b.Extensions = []string{".idl", ".arf"}
+	require.NotEqual(t, digest, b.ComputeDigest())
+
+	b.Extensions = nil
+	_, err = b.Compile()
+	require.ErrorContains(t, err, "cannot import common: not part of the bundle")
+}
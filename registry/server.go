@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/arf-rpc/idl/descriptor"
+)
+
+// maxBundleSize limits the size of published bundles.
+const maxBundleSize = 32 << 20
+
+// Server exposes a Store through the registry protocol.
+type Server struct {
+	Store Store
+	mux   *http.ServeMux
+}
+
+// NewServer returns a Server backed by store.
+func NewServer(store Store) *Server {
+	s := &Server{Store: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("PUT /v1/packages/{package}/versions/{version}", s.publish)
+	s.mux.HandleFunc("GET /v1/packages/{package}/versions/{version}", s.fetch)
+	s.mux.HandleFunc("GET /v1/packages/{package}/versions/{version}/descriptors", s.descriptors)
+	s.mux.HandleFunc("GET /v1/packages/{package}/versions", s.versions)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (s *Server) publish(w http.ResponseWriter, r *http.Request) {
+	var b Bundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBundleSize)).Decode(&b); err != nil {
+		writeError(w, fmt.Errorf("invalid bundle: %w", err))
+		return
+	}
+	if b.Package != r.PathValue("package") || b.Version != r.PathValue("version") {
+		writeError(w, fmt.Errorf("bundle %s@%s does not match the request path", b.Package, b.Version))
+		return
+	}
+	if b.Digest != b.ComputeDigest() {
+		writeError(w, fmt.Errorf("bundle digest does not match its contents"))
+		return
+	}
+	if err := b.checkPaths(); err != nil {
+		writeError(w, err)
+		return
+	}
+	tree, err := b.Compile()
+	if err != nil {
+		writeError(w, fmt.Errorf("bundle does not compile: %w", err))
+		return
+	}
+	if b.Descriptors, err = descriptor.Build(tree); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.Store.Put(&b); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, &b)
+}
+
+func (s *Server) fetch(w http.ResponseWriter, r *http.Request) {
+	b, err := s.Store.Get(r.PathValue("package"), r.PathValue("version"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) descriptors(w http.ResponseWriter, r *http.Request) {
+	b, err := s.Store.Get(r.PathValue("package"), r.PathValue("version"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b.Descriptors)
+}
+
+func (s *Server) versions(w http.ResponseWriter, r *http.Request) {
+	versions, err := s.Store.Versions(r.PathValue("package"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
@@ -0,0 +1,386 @@
+package idl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LockfileFilename is the conventional name of the file pinning remote
+// imports.
+const LockfileFilename = "arf.lock"
+
+// Lockfile pins the contents of remote imports through their SHA-256 digest.
+// Lockfiles are line-based, each line containing a location and its digest:
+//
+//	https://schemas.example.com/common/types.arf sha256:2c26b46b...
+type Lockfile struct {
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// ReadLockfile reads the lockfile at path. A missing file results in an empty
+// Lockfile.
+func ReadLockfile(path string) (*Lockfile, error) {
+	l := &Lockfile{entries: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "sha256:") {
+			return nil, fmt.Errorf("%s, line %d: expected <location> sha256:<digest>", path, line)
+		}
+		l.entries[fields[0]] = strings.TrimPrefix(fields[1], "sha256:")
+	}
+	return l, scanner.Err()
+}
+
+// Sum returns the digest pinned for location.
+func (l *Lockfile) Sum(location string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, ok := l.entries[location]
+	return v, ok
+}
+
+// Pin records the digest of location.
+func (l *Lockfile) Pin(location, sum string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries == nil {
+		l.entries = map[string]string{}
+	}
+	l.entries[location] = sum
+}
+
+// Write stores the lockfile at path, sorted by location.
+func (l *Lockfile) Write(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.entries))
+	for k := range l.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s sha256:%s\n", k, l.entries[k])
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// isRemoteLocation indicates whether location must be fetched by a
+// RemoteResolver.
+func isRemoteLocation(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "git+")
+}
+
+// RemoteResolver fetches imports from remote sources, delegating any other
+// import to Next. Supported sources are:
+//
+//	import "https://schemas.example.com/common/types.arf";
+//	import "git+https://github.com/acme/schemas.git//common/types.arf?ref=v1.2.0";
+//
+// Relative imports within remote files are resolved against their location.
+// Fetched contents are verified against Lock, and stored in CacheDir, keyed by
+// their digest. When Offline is set, contents are only read from CacheDir,
+// which allows a cache directory to be vendored along with the schemas.
+type RemoteResolver struct {
+	Next Resolver
+	// Lock pins fetched contents. When nil, contents are verified against
+	// an empty Lockfile, so nothing is pinned across runs.
+	Lock *Lockfile
+	// CacheDir holds fetched contents. Defaults to the arf directory within
+	// os.UserCacheDir.
+	CacheDir string
+
+	// Offline prevents any network access.
+	Offline bool
+	// Frozen rejects remote imports not pinned by Lock.
+	Frozen bool
+	// Client is used for https sources. Defaults to http.DefaultClient.
+	Client *http.Client
+	// Extensions lists the accepted extensions of remote files; the first
+	// one is appended to imports lacking any. Defaults to DefaultExtensions.
+	Extensions []string
+	// GitSchemes lists the URL schemes git repositories may be cloned over.
+	// Defaults to DefaultGitSchemes.
+	GitSchemes []string
+	// MaxSize limits the size of fetched files, in bytes. Defaults to
+	// DefaultMaxRemoteSize.
+	MaxSize int64
+}
+
+// DefaultMaxRemoteSize limits the size of fetched files when none is
+// configured through RemoteResolver.MaxSize.
+const DefaultMaxRemoteSize = 8 << 20
+
+// DefaultGitSchemes lists the schemes git sources may use when none are
+// configured through RemoteResolver.GitSchemes. Others, such as ext:: or
+// file://, would let schemas run commands or read local repositories.
+var DefaultGitSchemes = []string{"https", "ssh", "git"}
+
+func (r *RemoteResolver) extensions() []string {
+	if len(r.Extensions) == 0 {
+		return DefaultExtensions
+	}
+	return r.Extensions
+}
+
+// Glob expands wildcard imports of local files through Next. Remote sources
+// cannot be listed, so patterns are rejected within remote files.
+func (r *RemoteResolver) Glob(from, value string) ([]string, error) {
+	if isRemoteLocation(from) {
+		return nil, fmt.Errorf("cannot import %s: wildcard imports are not supported for remote files", value)
+	}
+	return glob(r.Next, from, value)
+}
+
+func (r *RemoteResolver) Resolve(from, value string) (string, error) {
+	if isRemoteLocation(value) {
+		return r.normalize(value), nil
+	}
+	if !isRemoteLocation(from) {
+		return r.Next.Resolve(from, value)
+	}
+
+	if exts := r.extensions(); !hasExtension(value, exts) {
+		value = value + exts[0]
+	}
+	if strings.HasPrefix(from, "git+") {
+		repo, file, ref, err := splitGitLocation(from)
+		if err != nil {
+			return "", err
+		}
+		loc := repo + "//" + strings.TrimPrefix(path.Join(path.Dir(file), value), "/")
+		if ref != "" {
+			loc += "?ref=" + ref
+		}
+		return loc, nil
+	}
+
+	base, err := url.Parse(from)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// normalize appends the default extension to remote locations lacking one.
+func (r *RemoteResolver) normalize(location string) string {
+	exts := r.extensions()
+	if hasExtension(strings.SplitN(location, "?", 2)[0], exts) {
+		return location
+	}
+	if base, query, ok := strings.Cut(location, "?"); ok {
+		return base + exts[0] + "?" + query
+	}
+	return location + exts[0]
+}
+
+func (r *RemoteResolver) ReadFile(location string) ([]byte, error) {
+	if !isRemoteLocation(location) {
+		return r.Next.ReadFile(location)
+	}
+
+	lock := r.Lock
+	if lock == nil {
+		lock = &Lockfile{}
+	}
+	sum, pinned := lock.Sum(location)
+	if !pinned && r.Frozen {
+		return nil, fmt.Errorf("%s is not pinned by the lockfile", location)
+	}
+	cache, err := r.cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if pinned {
+		if data, err := os.ReadFile(filepath.Join(cache, sum)); err == nil {
+			// The cache may have been altered since it was written, such as
+			// when vendored
+			actual := checksum(data)
+			if actual == sum {
+				return data, nil
+			}
+			if r.Offline {
+				return nil, fmt.Errorf("checksum mismatch for cached %s: expected sha256:%s, got sha256:%s", location, sum, actual)
+			}
+		}
+	}
+	if r.Offline {
+		return nil, fmt.Errorf("%s is not available in %s while offline", location, cache)
+	}
+
+	data, err := r.fetch(location)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", location, err)
+	}
+	actual := checksum(data)
+	if pinned && actual != sum {
+		return nil, fmt.Errorf("checksum mismatch for %s: expected sha256:%s, got sha256:%s", location, sum, actual)
+	}
+	lock.Pin(location, actual)
+
+	if err = os.MkdirAll(cache, 0o755); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(cache, actual), data, 0o644); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checksum returns the hex-encoded SHA-256 digest of data, as pinned by
+// lockfiles.
+func checksum(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// cacheDir returns the directory fetched contents are stored in.
+func (r *RemoteResolver) cacheDir() (string, error) {
+	if r.CacheDir != "" {
+		return r.CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no cache directory for remote imports: %w", err)
+	}
+	return filepath.Join(dir, "arf"), nil
+}
+
+func (r *RemoteResolver) fetch(location string) ([]byte, error) {
+	limit := r.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxRemoteSize
+	}
+	if strings.HasPrefix(location, "git+") {
+		schemes := r.GitSchemes
+		if len(schemes) == 0 {
+			schemes = DefaultGitSchemes
+		}
+		data, err := fetchGit(location, schemes)
+		if err == nil && int64(len(data)) > limit {
+			return nil, fmt.Errorf("%s exceeds the maximum size of %d bytes", location, limit)
+		}
+		return data, err
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	// Reads one more byte than allowed, so oversized files are told apart
+	// from those exactly at the limit
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds the maximum size of %d bytes", location, limit)
+	}
+	return data, nil
+}
+
+// splitGitLocation splits git+<repo>//<file>?ref=<ref> into its components.
+func splitGitLocation(location string) (repo, file, ref string, err error) {
+	rest := strings.TrimPrefix(location, "git+")
+	rest, ref, _ = strings.Cut(rest, "?ref=")
+	schemeEnd := strings.Index(rest, "://")
+	if schemeEnd == -1 {
+		return "", "", "", fmt.Errorf("invalid git location %s", location)
+	}
+	sep := strings.Index(rest[schemeEnd+3:], "//")
+	if sep == -1 {
+		return "", "", "", fmt.Errorf("invalid git location %s: expected <repository>//<path>", location)
+	}
+	sep += schemeEnd + 3
+	return "git+" + rest[:sep], rest[sep+2:], ref, nil
+}
+
+// fetchGit clones the repository of location, whose scheme must be one of
+// schemes, and returns the file it designates.
+func fetchGit(location string, schemes []string) ([]byte, error) {
+	repo, file, ref, err := splitGitLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	repo = strings.TrimPrefix(repo, "git+")
+	if scheme, _, _ := strings.Cut(repo, "://"); !slices.Contains(schemes, scheme) {
+		return nil, fmt.Errorf("unsupported git scheme %q, expected one of %s", scheme, strings.Join(schemes, ", "))
+	}
+	if !filepath.IsLocal(filepath.FromSlash(file)) {
+		return nil, fmt.Errorf("invalid git location %s: %s is not within the repository", location, file)
+	}
+	dir, err := os.MkdirTemp("", "arf-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repo, dir)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git clone: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return readWithin(dir, filepath.FromSlash(file))
+}
+
+// readWithin reads the file at name, relative to dir, provided it still lies
+// within dir once symbolic links are followed. Repositories may otherwise
+// commit links to arbitrary local files.
+func readWithin(dir, name string) ([]byte, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("%s is not within the repository", filepath.ToSlash(name))
+	}
+	return os.ReadFile(path)
+}
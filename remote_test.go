@@ -0,0 +1,159 @@
+package idl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteImports(t *testing.T) {
+	sources := map[string]string{
+		"/schemas/common.arf": `package acme.common; import "types"; struct Money { amount types.Amount; }`,
+		"/schemas/types.arf":  `package acme.types; struct Amount { units int64; }`,
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		src, ok := sources[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(src))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "invoice.arf")
+	require.NoError(t, os.WriteFile(entry, []byte(`package acme.billing;
+import "`+srv.URL+`/schemas/common" as common;
+struct Invoice { total common.Money; }
+`), 0o644))
+
+	cache := filepath.Join(dir, "cache")
+	lockPath := filepath.Join(dir, LockfileFilename)
+	remote := func(lock *Lockfile, mut func(r *RemoteResolver)) Option {
+		return WithResolver(func(next Resolver) Resolver {
+			r := &RemoteResolver{Next: next, Lock: lock, CacheDir: cache, Client: srv.Client()}
+			if mut != nil {
+				mut(r)
+			}
+			return r
+		})
+	}
+
+	lock, err := ReadLockfile(lockPath)
+	require.NoError(t, err)
+	_, err = Parse(entry, remote(lock, func(r *RemoteResolver) { r.Frozen = true }))
+	require.ErrorContains(t, err, "not pinned")
+
+	tree, err := Parse(entry, remote(lock, nil))
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "acme.types")
+	_, ok := lock.Sum(srv.URL + "/schemas/types.arf")
+	require.True(t, ok)
+	require.NoError(t, lock.Write(lockPath))
+
+	// Pinned contents are served from the cache while offline
+	lock, err = ReadLockfile(lockPath)
+	require.NoError(t, err)
+	_, err = Parse(entry, remote(lock, func(r *RemoteResolver) { r.Offline = true; r.Frozen = true }))
+	require.NoError(t, err)
+
+	// Altered cached contents are fetched again, or rejected while offline
+	sum, _ := lock.Sum(srv.URL + "/schemas/types.arf")
+	require.NoError(t, os.WriteFile(filepath.Join(cache, sum), []byte(`package acme.types; struct Amount { units string; }`), 0o644))
+	_, err = Parse(entry, remote(lock, func(r *RemoteResolver) { r.Offline = true }))
+	require.ErrorContains(t, err, "checksum mismatch for cached "+srv.URL+"/schemas/types.arf")
+	tree, err = Parse(entry, remote(lock, nil))
+	require.NoError(t, err)
+	require.Equal(t, "int64", tree.Packages["acme.types"].FindStruct("Amount").AllFields()[0].Type.(*ast.PrimitiveType).Name)
+	_, err = Parse(entry, remote(lock, func(r *RemoteResolver) { r.Offline = true }))
+	require.NoError(t, err)
+
+	// Resolvers without a lockfile do not pin anything
+	_, err = Parse(entry, remote(nil, nil))
+	require.NoError(t, err)
+
+	// Files larger than MaxSize are rejected
+	require.NoError(t, os.RemoveAll(cache))
+	_, err = Parse(entry, remote(nil, func(r *RemoteResolver) { r.MaxSize = 16 }))
+	require.ErrorContains(t, err, srv.URL+"/schemas/common.arf exceeds the maximum size of 16 bytes")
+
+	// Changed upstream contents are rejected
+	require.NoError(t, os.RemoveAll(cache))
+	sources["/schemas/types.arf"] = `package acme.types; struct Amount { units int32; }`
+	_, err = Parse(entry, remote(lock, nil))
+	require.ErrorContains(t, err, "checksum mismatch")
+
+	_, err = Parse(entry, remote(lock, func(r *RemoteResolver) { r.Offline = true }))
+	require.ErrorContains(t, err, "offline")
+}
+
+func TestGitImports(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "common"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "common", "types.arf"), []byte(`package acme.types; struct Amount { units int64; }`), 0o644))
+	secret := filepath.Join(dir, "secret.arf")
+	require.NoError(t, os.WriteFile(secret, []byte(`package secret;`), 0o644))
+	require.NoError(t, os.Symlink(secret, filepath.Join(repo, "common", "leak.arf")))
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=arf", "-c", "user.email=arf@example.com", "commit", "--quiet", "-m", "init"},
+		{"tag", "v1"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	entry := filepath.Join(dir, "entry.arf")
+	require.NoError(t, os.WriteFile(entry, []byte(`package acme.billing;
+import "git+file://`+filepath.ToSlash(repo)+`//common/types?ref=v1";
+struct Invoice { total types.Amount; }
+`), 0o644))
+
+	// Contents are cached within the user cache directory by default
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("HOME", dir)
+	userCache, err := os.UserCacheDir()
+	require.NoError(t, err)
+
+	lock := &Lockfile{}
+	tree, err := Parse(entry, WithResolver(func(next Resolver) Resolver {
+		return &RemoteResolver{Next: next, Lock: lock, GitSchemes: []string{"file"}}
+	}))
+	require.NoError(t, err)
+	require.Contains(t, tree.Packages, "acme.types")
+	sum, ok := lock.Sum("git+file://" + filepath.ToSlash(repo) + "//common/types.arf?ref=v1")
+	require.True(t, ok)
+	require.FileExists(t, filepath.Join(userCache, "arf", sum))
+
+	// Committed links cannot reach outside of the repository
+	r := &RemoteResolver{Lock: lock, GitSchemes: []string{"file"}}
+	_, err = r.ReadFile("git+file://" + filepath.ToSlash(repo) + "//common/leak.arf?ref=v1")
+	require.ErrorContains(t, err, "common/leak.arf is not within the repository")
+}
+
+func TestGitSchemes(t *testing.T) {
+	r := &RemoteResolver{Lock: &Lockfile{}, CacheDir: t.TempDir()}
+	for location, msg := range map[string]string{
+		"git+ext::sh -c touch% /tmp/pwned://x//a.arf": `unsupported git scheme "ext::sh -c touch% /tmp/pwned"`,
+		"git+file:///tmp/repo//a.arf":                 `unsupported git scheme "file", expected one of https, ssh, git`,
+		"git+-uhttps://example.com/repo//a.arf":       `unsupported git scheme "-uhttps"`,
+		"git+https://example.com/repo//../a.arf":      "../a.arf is not within the repository",
+	} {
+		_, err := r.ReadFile(location)
+		require.ErrorContains(t, err, msg, location)
+	}
+}
@@ -0,0 +1,126 @@
+package idl
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// mergeReopenedStructs merges top-level structs declared by several files of
+// the same package. The declaration of the entrypoint, or else the one of the
+// first file by path, is the original one: the fields of the others, which
+// re-open it, are appended to its own. Field names and wire names must
+// remain unique across the merged set. Structs declared twice by the same
+// file are not merged, and are reported by validatorP1 instead.
+func mergeReopenedStructs(files map[string]*ast.File, entrypoint string) error {
+	paths := sortedKeys(files)
+	sort.SliceStable(paths, func(i, j int) bool { return paths[i] == entrypoint && paths[j] != entrypoint })
+
+	declarations := map[string][]*ast.Struct{}
+	var order []string
+	for _, path := range paths {
+		for _, s := range files[path].Structs {
+			fqn := s.FQN()
+			decls, ok := declarations[fqn]
+			if !ok {
+				order = append(order, fqn)
+			} else if decls[len(decls)-1].Position.File == s.Position.File {
+				continue
+			}
+			declarations[fqn] = append(decls, s)
+		}
+	}
+
+	m := &structMerger{}
+	for _, fqn := range order {
+		if decls := declarations[fqn]; len(decls) > 1 {
+			m.merge(decls[0], decls[1:])
+		}
+	}
+	return errors.Join(m.errors...)
+}
+
+type structMerger struct {
+	errors []error
+}
+
+func (m *structMerger) Errorf(pos ast.Position, format string, args ...interface{}) {
+	m.errors = append(m.errors, newDiagnostic(SeverityError, pos, format, args...))
+}
+
+func (m *structMerger) Reportf(code string, pos ast.Position, format string, args ...interface{}) {
+	m.errors = append(m.errors, newCodedDiagnostic(code, SeverityError, pos, format, args...))
+}
+
+// merge appends the fields of every declaration of reopening to original.
+func (m *structMerger) merge(original *ast.Struct, reopening []*ast.Struct) {
+	// Compilations may run more than once over the same files, in which case
+	// fields merged by a previous run are dropped first.
+	own := original.Fields[:0:0]
+	for _, f := range original.Fields {
+		if f.Parent == original {
+			own = append(own, f)
+		}
+	}
+	original.Fields = own
+
+	names := map[string]*ast.StructField{}
+	wireNames := map[string]*ast.StructField{}
+	for _, f := range original.Fields {
+		names[f.Name] = f
+		wireNames[f.WireName()] = f
+	}
+
+	for _, s := range reopening {
+		s.Reopens = original
+		pos := original.Position
+		for _, a := range s.Annotations {
+			m.Errorf(a.Position, "annotations of struct %s must be declared by its original declaration at %s, line %d, column %d", s.Name, pos.Filename, pos.Line, pos.Column)
+		}
+		if s.Extends != nil {
+			m.Errorf(s.Extends.Pos(), "the base of struct %s must be declared by its original declaration at %s, line %d, column %d", s.Name, pos.Filename, pos.Line, pos.Column)
+		}
+		for _, n := range s.Structs {
+			m.Errorf(n.Position, "struct %s must be declared by the original declaration of %s at %s, line %d, column %d", n.Name, s.Name, pos.Filename, pos.Line, pos.Column)
+		}
+		for _, e := range s.Enums {
+			m.Errorf(e.Position, "enum %s must be declared by the original declaration of %s at %s, line %d, column %d", e.Name, s.Name, pos.Filename, pos.Line, pos.Column)
+		}
+		for _, u := range s.Unions {
+			m.Errorf(u.Position, "union %s must be declared by the original declaration of %s at %s, line %d, column %d", u.Name, s.Name, pos.Filename, pos.Line, pos.Column)
+		}
+		for _, r := range s.Reserved {
+			m.Errorf(r.Position, "reserved indices and names of %s must be declared by its original declaration at %s, line %d, column %d", s.Name, pos.Filename, pos.Line, pos.Column)
+		}
+
+		for _, f := range s.Fields {
+			if f.Union != nil {
+				continue
+			}
+			if ex, ok := names[f.Name]; ok {
+				m.Errorf(f.Position, "%s is already defined for %s at %s, line %d, column %d", f.Name, s.Name, ex.Position.Filename, ex.Position.Line, ex.Position.Column)
+				continue
+			}
+			if ex, ok := wireNames[f.WireName()]; ok {
+				m.Reportf(CodeWireNameCollision, f.Position, "wire name %s of field %s collides with field %s at %s, line %d, column %d", f.WireName(), f.Name, ex.Name, ex.Position.Filename, ex.Position.Line, ex.Position.Column)
+			} else {
+				wireNames[f.WireName()] = f
+			}
+			names[f.Name] = f
+			original.Fields = append(original.Fields, f)
+		}
+	}
+
+	// Fields without a declared index are identified by their position
+	// within the merged set.
+	for i, f := range original.Fields {
+		if !f.IndexDeclared {
+			f.Index = i
+		}
+	}
+	m.errors = append(m.errors, fieldIndexConflicts(original)...)
+
+	// Fields of the original declaration are checked by validatorP1
+	m.errors = append(m.errors, reservedFieldConflicts(original, original.Fields[len(own):])...)
+}
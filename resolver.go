@@ -0,0 +1,230 @@
+package idl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Resolver locates and loads files imported by a schema. Locations returned by
+// Resolve are used to identify files throughout compilation, and are passed
+// back to ReadFile to obtain their contents.
+type Resolver interface {
+	// Resolve returns the location of the file imported as value by the file
+	// at from.
+	Resolve(from, value string) (string, error)
+
+	// ReadFile returns the contents of a location returned by Resolve.
+	ReadFile(location string) ([]byte, error)
+}
+
+// GlobResolver is implemented by Resolvers able to expand imports holding
+// wildcards, such as "common/*".
+type GlobResolver interface {
+	// Glob returns the locations of the files matched by the pattern
+	// imported as value by the file at from, sorted.
+	Glob(from, value string) ([]string, error)
+}
+
+// isGlob indicates whether the import value holds wildcards. Remote imports
+// never do, as ? starts their query.
+func isGlob(value string) bool {
+	return !isRemoteLocation(value) && strings.ContainsAny(value, "*?[")
+}
+
+// glob expands the pattern imported as value by the file at from through r.
+func glob(r Resolver, from, value string) ([]string, error) {
+	g, ok := r.(GlobResolver)
+	if !ok {
+		return nil, fmt.Errorf("cannot import %s: wildcard imports are not supported by %T", value, r)
+	}
+	return g.Glob(from, value)
+}
+
+// noFileResolver fails every lookup, standing for the filesystem when
+// WithoutFilesystem is used.
+type noFileResolver struct{}
+
+func (noFileResolver) Resolve(_, value string) (string, error) {
+	return "", fmt.Errorf("cannot import %s: the filesystem is not available", value)
+}
+
+func (noFileResolver) ReadFile(location string) ([]byte, error) {
+	return nil, fmt.Errorf("cannot read %s: the filesystem is not available", location)
+}
+
+// DefaultExtensions lists the extensions of schema files accepted when none
+// are configured through WithExtensions.
+var DefaultExtensions = []string{".arf"}
+
+// hasExtension indicates whether name ends with one of exts, regardless of
+// casing.
+func hasExtension(name string, exts []string) bool {
+	return matchingExtension(name, exts) != ""
+}
+
+// matchingExtension returns the element of exts name ends with, regardless of
+// casing.
+func matchingExtension(name string, exts []string) string {
+	for _, ext := range exts {
+		if strings.HasSuffix(strings.ToLower(name), strings.ToLower(ext)) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// NewFileResolver returns a Resolver for files on the local filesystem.
+// Imports prefixed by the name of a dependency declared in manifest are
+// resolved against the dependency directory; others are relative to the
+// importing file. manifest may be nil.
+//
+// Imports ending with one of extensions are used as-is. Others are looked up
+// with each extension in turn, defaulting to the first one when no file
+// exists. When no extensions are given, DefaultExtensions is used.
+func NewFileResolver(manifest *Manifest, extensions ...string) Resolver {
+	return newFileResolver(manifest, "", extensions)
+}
+
+// newFileResolver returns a fileResolver which also looks imports up relative
+// to root, then to each of includes, when they do not exist relative to the
+// importing file.
+func newFileResolver(manifest *Manifest, root string, extensions []string, includes ...string) *fileResolver {
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	var roots []string
+	for _, dir := range append([]string{root}, includes...) {
+		if dir == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		roots = append(roots, dir)
+	}
+	return &fileResolver{manifest: manifest, roots: roots, extensions: extensions}
+}
+
+type fileResolver struct {
+	manifest   *Manifest
+	roots      []string
+	extensions []string
+}
+
+func (r *fileResolver) Resolve(from, value string) (string, error) {
+	if hasExtension(value, r.extensions) {
+		return r.locate(from, value)
+	}
+
+	var first string
+	for _, ext := range r.extensions {
+		location, err := r.locate(from, value+ext)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(location); err == nil {
+			return location, nil
+		}
+		if first == "" {
+			first = location
+		}
+	}
+	return first, nil
+}
+
+func (r *fileResolver) locate(from, value string) (string, error) {
+	location := filepath.Join(filepath.Dir(from), value)
+	if resolved, ok, err := r.manifest.resolveDependency(value); err != nil {
+		return "", err
+	} else if ok {
+		location = resolved
+	} else if !fileExists(location) {
+		for _, root := range r.roots {
+			if candidate := filepath.Join(root, value); fileExists(candidate) {
+				location = candidate
+				break
+			}
+		}
+	}
+	location, err := filepath.Abs(location)
+	if err != nil {
+		return "", err
+	}
+	return canonicalCase(location), nil
+}
+
+func fileExists(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && !stat.IsDir()
+}
+
+// canonicalCase returns location with its file name spelled as stored on disk.
+// On case-insensitive filesystems, this prevents a file imported with
+// different casings from being processed more than once.
+func canonicalCase(location string) string {
+	if _, err := os.Stat(location); err != nil {
+		return location
+	}
+	dir, base := filepath.Split(location)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return location
+	}
+	for _, e := range entries {
+		if e.Name() == base {
+			return location
+		}
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), base) {
+			return filepath.Join(dir, e.Name())
+		}
+	}
+	return location
+}
+
+func (r *fileResolver) ReadFile(location string) ([]byte, error) {
+	return os.ReadFile(location)
+}
+
+// Glob returns the schema files matched by value, which are looked up the
+// same way as other imports: relative to the importing file, or under the
+// first root holding any of them. Hidden files are skipped.
+func (r *fileResolver) Glob(from, value string) ([]string, error) {
+	patterns := []string{filepath.Join(filepath.Dir(from), value)}
+	if resolved, ok, err := r.manifest.resolveDependency(value); err != nil {
+		return nil, err
+	} else if ok {
+		patterns = []string{resolved}
+	} else {
+		for _, root := range r.roots {
+			patterns = append(patterns, filepath.Join(root, value))
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid import pattern %s: %w", value, err)
+		}
+		var res []string
+		for _, m := range matches {
+			if strings.HasPrefix(filepath.Base(m), ".") || !hasExtension(m, r.extensions) || !fileExists(m) {
+				continue
+			}
+			location, err := filepath.Abs(m)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, location)
+		}
+		if len(res) > 0 {
+			sort.Strings(res)
+			return res, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,152 @@
+package idl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Result holds the outcome of compiling a schema: the resulting tree, if any,
+// and every diagnostic reported along the way.
+type Result struct {
+	// Tree is nil when errors prevented the compilation from completing.
+	Tree *ast.Tree
+
+	// Diagnostics lists all problems found, errors and warnings alike.
+	Diagnostics []*Diagnostic
+
+	// Files lists the paths of all files read during the compilation,
+	// including those which failed to parse, sorted.
+	Files []string
+
+	// Imports holds the imports of every file in Files.
+	Imports ImportGraph
+
+	// Manifest is the path of the manifest used by the compilation, whether
+	// given through WithManifest or found next to the entrypoint, or empty
+	// when there is none.
+	Manifest string
+
+	// Dirs lists the directories listed by wildcard and package imports,
+	// sorted. Files added to them may change the result.
+	Dirs []string
+}
+
+// Count returns the number of diagnostics with the given severity.
+func (r *Result) Count(sev Severity) int {
+	n := 0
+	for _, d := range r.Diagnostics {
+		if d.Severity == sev {
+			n++
+		}
+	}
+	return n
+}
+
+// HasErrors indicates whether any error was reported.
+func (r *Result) HasErrors() bool { return r.Count(SeverityError) > 0 }
+
+// Errors returns the diagnostics with error severity.
+func (r *Result) Errors() []*Diagnostic { return r.BySeverity()[SeverityError] }
+
+// Warnings returns the diagnostics with warning severity.
+func (r *Result) Warnings() []*Diagnostic { return r.BySeverity()[SeverityWarning] }
+
+// BySeverity groups diagnostics by their severity.
+func (r *Result) BySeverity() map[Severity][]*Diagnostic {
+	res := map[Severity][]*Diagnostic{}
+	for _, d := range r.Diagnostics {
+		res[d.Severity] = append(res[d.Severity], d)
+	}
+	return res
+}
+
+// ByFile groups diagnostics by the file they were reported in. Diagnostics
+// not tied to a file are grouped under the empty string.
+func (r *Result) ByFile() map[string][]*Diagnostic {
+	res := map[string][]*Diagnostic{}
+	for _, d := range r.Diagnostics {
+		res[d.Position.Filename] = append(res[d.Position.Filename], d)
+	}
+	return res
+}
+
+// Err returns all errors joined into a single value, or nil when the
+// compilation succeeded. Warnings are not included.
+func (r *Result) Err() error {
+	return joinDiagnostics(r.Errors())
+}
+
+// Summary renders a compact description of the result, such as "3 errors,
+// 7 warnings across 12 files". The file count is omitted when no file could
+// be read.
+func (r *Result) Summary() string {
+	summary := plural(r.Count(SeverityError), "error") + ", " + plural(r.Count(SeverityWarning), "warning")
+	if len(r.Files) == 0 {
+		return summary
+	}
+	return summary + " across " + plural(len(r.Files), "file")
+}
+
+// String renders every diagnostic on its own line, followed by the summary.
+func (r *Result) String() string {
+	var b strings.Builder
+	for _, d := range r.Diagnostics {
+		b.WriteString(d.Error())
+		b.WriteByte('\n')
+	}
+	b.WriteString(r.Summary())
+	return b.String()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeDiagnostics sorts diags by position, and removes diagnostics
+// repeating the code, position, and message of a previous one, which happens
+// when the same problem is detected by several validation passes.
+func normalizeDiagnostics(diags []*Diagnostic) []*Diagnostic {
+	type key struct {
+		code    string
+		pos     ast.Position
+		message string
+	}
+	seen := map[key]struct{}{}
+	res := make([]*Diagnostic, 0, len(diags))
+	for _, d := range diags {
+		pos := d.Position
+		pos.File = nil
+		k := key{d.Code, pos, d.Message}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		res = append(res, d)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i].Position, res[j].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return res
+}
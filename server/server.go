@@ -0,0 +1,508 @@
+// Package server runs the compiler as a long-running service, so build
+// systems and editors avoid paying for process startup on every invocation
+// and reuse results across requests.
+//
+// Clients exchange newline-delimited JSON messages with the server, either
+// over standard input and output through Serve, or over a socket through
+// ServeListener. Each request names a method and carries its parameters:
+//
+//	{"id": 1, "method": "check", "params": {"entrypoint": "users.arf"}}
+//
+// Responses echo the id of their request, along with either a result or an
+// error:
+//
+//	{"id": 1, "result": {"ok": true, "diagnostics": []}}
+//
+// The following methods are supported:
+//
+//	compile  compiles a schema and its imports, taking CompileParams
+//	check    reports the diagnostics of a schema, taking CompileParams
+//	format   formats a schema, taking FormatParams
+//	diff     returns a unified diff of the changes format would make
+//
+// Successful compilations are cached until one of the files they read, their
+// manifest, or one of the directories their wildcard and package imports
+// list changes, so unchanged schemas are not compiled again. At most
+// 256 compilations are cached, evicting the least recently used ones first.
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arf-rpc/idl"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// maxMessageSize limits the size of a single request.
+const maxMessageSize = 64 << 20
+
+// maxCacheEntries limits the number of compilations cached by a Server. The
+// least recently used ones are evicted first.
+const maxCacheEntries = 256
+
+// Request is a message sent by clients.
+type Request struct {
+	// ID is echoed in the response, so clients may match responses with
+	// their requests.
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the answer to a Request. Exactly one of Result and Error is
+// set.
+type Response struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Result any             `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// CompileParams holds the parameters of the compile and check methods.
+type CompileParams struct {
+	// Entrypoint is the path of the schema to compile.
+	Entrypoint string `json:"entrypoint"`
+
+	// Source, when set, is compiled in place of the contents of Entrypoint,
+	// allowing editors to check unsaved buffers. Such compilations are never
+	// cached.
+	Source *string `json:"source,omitempty"`
+
+	SchemaRoot        string            `json:"schema_root,omitempty"`
+	PackageLayout     bool              `json:"package_layout,omitempty"`
+	VersionedPackages bool              `json:"versioned_packages,omitempty"`
+	Manifest          string            `json:"manifest,omitempty"`
+	Extensions        []string          `json:"extensions,omitempty"`
+	Severities        map[string]string `json:"severities,omitempty"`
+}
+
+// CompileResult is the result of the compile method.
+type CompileResult struct {
+	OK          bool         `json:"ok"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+
+	// Files lists the paths of all files read, sorted.
+	Files []string `json:"files"`
+	// Packages lists the packages declared by those files, sorted.
+	Packages []string `json:"packages"`
+	// Cached indicates whether the result was served from the cache.
+	Cached bool `json:"cached"`
+}
+
+// CheckResult is the result of the check method.
+type CheckResult struct {
+	OK          bool         `json:"ok"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// FormatParams holds the parameters of the format and diff methods.
+type FormatParams struct {
+	// Filename is the path of the schema, used to normalize its imports.
+	Filename string `json:"filename"`
+	// Source holds the contents of the schema. When nil, the contents of
+	// Filename are read.
+	Source *string `json:"source,omitempty"`
+
+	SchemaRoot   string   `json:"schema_root,omitempty"`
+	Extensions   []string `json:"extensions,omitempty"`
+	AlignColumns bool     `json:"align_columns,omitempty"`
+}
+
+// FormatResult is the result of the format method.
+type FormatResult struct {
+	Source string `json:"source"`
+	// Changed indicates whether Source differs from the input.
+	Changed bool `json:"changed"`
+}
+
+// DiffResult is the result of the diff method.
+type DiffResult struct {
+	// Diff is empty when the schema is already formatted.
+	Diff string `json:"diff"`
+}
+
+// Diagnostic is the representation of idl.Diagnostic exchanged with clients.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+}
+
+// Server answers requests, caching compilations across them. Servers are
+// safe for concurrent use.
+type Server struct {
+	mu         sync.Mutex
+	cache      map[string]*cacheEntry
+	maxEntries int
+	clock      uint64
+}
+
+// cacheEntry holds a successful compilation, along with the state of the
+// files and directories it depends on.
+type cacheEntry struct {
+	result *idl.Result
+	stamps map[string]stamp
+	used   uint64
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New returns a Server with an empty cache.
+func New() *Server {
+	return &Server{cache: map[string]*cacheEntry{}, maxEntries: maxCacheEntries}
+}
+
+// Serve answers the requests read from r, one per line, writing responses to
+// w in the same order. It returns once r is exhausted.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxMessageSize)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var req Request
+		var res Response
+		if err := json.Unmarshal(line, &req); err != nil {
+			res = Response{Error: fmt.Sprintf("invalid request: %s", err)}
+		} else {
+			res = s.Handle(req)
+		}
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ServeListener accepts connections from l, serving each of them
+// concurrently through Serve. It returns once l is closed.
+func (s *Server) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			_ = s.Serve(conn, conn)
+		}()
+	}
+}
+
+// Handle answers a single request.
+func (s *Server) Handle(req Request) Response {
+	var result any
+	var err error
+	switch req.Method {
+	case "compile":
+		var params CompileParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			result, err = s.compile(params)
+		}
+	case "check":
+		var params CompileParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			var res *CompileResult
+			if res, err = s.compile(params); err == nil {
+				result = &CheckResult{OK: res.OK, Diagnostics: res.Diagnostics}
+			}
+		}
+	case "format":
+		var params FormatParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			result, err = format(params)
+		}
+	case "diff":
+		var params FormatParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			result, err = diff(params)
+		}
+	default:
+		err = fmt.Errorf("unknown method %q", req.Method)
+	}
+	if err != nil {
+		return Response{ID: req.ID, Error: err.Error()}
+	}
+	return Response{ID: req.ID, Result: result}
+}
+
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return errors.New("missing params")
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+func (p CompileParams) options() ([]idl.Option, error) {
+	var opts []idl.Option
+	if p.SchemaRoot != "" {
+		opts = append(opts, idl.WithSchemaRoot(p.SchemaRoot))
+	}
+	if p.PackageLayout {
+		opts = append(opts, idl.WithPackageLayout(p.SchemaRoot))
+	}
+	if p.VersionedPackages {
+		opts = append(opts, idl.WithVersionedPackages())
+	}
+	if p.Manifest != "" {
+		opts = append(opts, idl.WithManifest(p.Manifest))
+	}
+	if len(p.Extensions) > 0 {
+		opts = append(opts, idl.WithExtensions(p.Extensions...))
+	}
+	for code, name := range p.Severities {
+		sev, err := idl.ParseSeverity(name)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, idl.WithSeverity(code, sev))
+	}
+	if p.Source != nil {
+		opts = append(opts, idl.WithStdin(strings.NewReader(*p.Source)), idl.WithStdinFilename(p.Entrypoint))
+	}
+	return opts, nil
+}
+
+func (s *Server) compile(params CompileParams) (*CompileResult, error) {
+	if params.Entrypoint == "" {
+		return nil, errors.New("missing entrypoint")
+	}
+	opts, err := params.options()
+	if err != nil {
+		return nil, err
+	}
+
+	var key string
+	if params.Source == nil {
+		k, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		key = string(k)
+		if result, ok := s.cached(key); ok {
+			res := newCompileResult(result)
+			res.Cached = true
+			return res, nil
+		}
+	}
+
+	entrypoint := params.Entrypoint
+	if params.Source != nil {
+		entrypoint = idl.StdinEntrypoint
+	}
+	// Files are stamped before being read, so changes made while compiling
+	// invalidate the result instead of being cached as part of it
+	started := time.Now()
+	reads := map[string]stamp{}
+	opts = append(opts, idl.WithResolver(func(next idl.Resolver) idl.Resolver {
+		return &stampingResolver{next: next, stamps: reads}
+	}))
+	fe, err := idl.New(entrypoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	result := fe.Compile()
+	if key != "" && !result.HasErrors() {
+		s.store(key, result, reads, started)
+	}
+	return newCompileResult(result), nil
+}
+
+// cached returns the result cached under key, provided none of the files it
+// read changed since.
+func (s *Server) cached(key string) (*idl.Result, bool) {
+	s.mu.Lock()
+	entry, ok := s.cache[key]
+	if ok {
+		s.clock++
+		entry.used = s.clock
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	for path, st := range entry.stamps {
+		if current, ok := stampOf(path); !ok || current != st {
+			s.mu.Lock()
+			delete(s.cache, key)
+			s.mu.Unlock()
+			return nil, false
+		}
+	}
+	return entry.result, true
+}
+
+// store caches result under key, along with reads, the stamps its files had
+// before being read, and stamps of its manifest and the directories listed by
+// its wildcard and package imports. Results reading files which cannot be
+// stamped, such as remote imports, are not cached, and neither are those whose
+// manifest or directories changed after the compilation started. Once full,
+// the least recently used entry is evicted.
+func (s *Server) store(key string, result *idl.Result, reads map[string]stamp, started time.Time) {
+	entry := &cacheEntry{result: result, stamps: map[string]stamp{}}
+	for _, path := range result.Files {
+		st, ok := reads[path]
+		if !ok {
+			return
+		}
+		entry.stamps[path] = st
+	}
+	paths := slices.Clone(result.Dirs)
+	if result.Manifest != "" {
+		paths = append(paths, result.Manifest)
+	}
+	for _, path := range paths {
+		st, ok := stampOf(path)
+		if !ok || st.modTime.After(started) {
+			return
+		}
+		entry.stamps[path] = st
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cache[key]; !ok && len(s.cache) >= s.maxEntries {
+		var oldest string
+		for k, e := range s.cache {
+			if oldest == "" || e.used < s.cache[oldest].used {
+				oldest = k
+			}
+		}
+		delete(s.cache, oldest)
+	}
+	s.clock++
+	entry.used = s.clock
+	s.cache[key] = entry
+}
+
+// stampingResolver records the stamps of files before delegating their reads
+// to next.
+type stampingResolver struct {
+	next   idl.Resolver
+	stamps map[string]stamp
+}
+
+func (r *stampingResolver) Resolve(from, value string) (string, error) {
+	return r.next.Resolve(from, value)
+}
+
+func (r *stampingResolver) Glob(from, value string) ([]string, error) {
+	g, ok := r.next.(idl.GlobResolver)
+	if !ok {
+		return nil, fmt.Errorf("cannot import %s: wildcard imports are not supported by %T", value, r.next)
+	}
+	return g.Glob(from, value)
+}
+
+func (r *stampingResolver) ReadFile(location string) ([]byte, error) {
+	if st, ok := stampOf(location); ok {
+		r.stamps[location] = st
+	}
+	return r.next.ReadFile(location)
+}
+
+func stampOf(path string) (stamp, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}, false
+	}
+	return stamp{modTime: info.ModTime(), size: info.Size()}, true
+}
+
+func newCompileResult(result *idl.Result) *CompileResult {
+	res := &CompileResult{
+		OK:          !result.HasErrors(),
+		Diagnostics: []Diagnostic{},
+		Files:       result.Files,
+		Packages:    []string{},
+	}
+	if res.Files == nil {
+		res.Files = []string{}
+	}
+	for _, d := range result.Diagnostics {
+		res.Diagnostics = append(res.Diagnostics, Diagnostic{
+			Severity: d.Severity.String(),
+			Filename: d.Position.Filename,
+			Line:     d.Position.Line,
+			Column:   d.Position.Column,
+			Message:  d.Message,
+			Code:     d.Code,
+		})
+	}
+	if result.Tree != nil {
+		for name := range result.Tree.Packages {
+			res.Packages = append(res.Packages, name)
+		}
+		sort.Strings(res.Packages)
+	}
+	return res
+}
+
+func (p FormatParams) format() (src, formatted []byte, err error) {
+	if p.Filename == "" {
+		return nil, nil, errors.New("missing filename")
+	}
+	if p.Source != nil {
+		src = []byte(*p.Source)
+	} else if src, err = os.ReadFile(p.Filename); err != nil {
+		return nil, nil, err
+	}
+	formatted, err = idl.Format(p.Filename, src, idl.FormatOptions{
+		Extensions:   p.Extensions,
+		SchemaRoot:   p.SchemaRoot,
+		AlignColumns: p.AlignColumns,
+	})
+	return src, formatted, err
+}
+
+func format(params FormatParams) (*FormatResult, error) {
+	src, formatted, err := params.format()
+	if err != nil {
+		return nil, err
+	}
+	return &FormatResult{Source: string(formatted), Changed: string(src) != string(formatted)}, nil
+}
+
+func diff(params FormatParams) (*DiffResult, error) {
+	src, formatted, err := params.format()
+	if err != nil {
+		return nil, err
+	}
+	if string(src) == string(formatted) {
+		return &DiffResult{}, nil
+	}
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(src)),
+		B:        difflib.SplitLines(string(formatted)),
+		FromFile: params.Filename,
+		ToFile:   params.Filename + " (formatted)",
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DiffResult{Diff: text}, nil
+}
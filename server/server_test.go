@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arf-rpc/idl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	users := filepath.Join(dir, "users.arf")
+	require.NoError(t, os.WriteFile(users, []byte("package org.users;\n\nstruct User {\n    name string;\n}\n"), 0o644))
+
+	s := New()
+	serve := func(requests ...string) []map[string]any {
+		var out bytes.Buffer
+		require.NoError(t, s.Serve(strings.NewReader(strings.Join(requests, "\n")+"\n"), &out))
+		var responses []map[string]any
+		dec := json.NewDecoder(&out)
+		for dec.More() {
+			var res map[string]any
+			require.NoError(t, dec.Decode(&res))
+			responses = append(responses, res)
+		}
+		return responses
+	}
+	request := func(id int, method string, params any) string {
+		data, err := json.Marshal(map[string]any{"id": id, "method": method, "params": params})
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	compile := request(1, "compile", CompileParams{Entrypoint: users})
+	res := serve(compile, compile)
+	require.Len(t, res, 2)
+	require.EqualValues(t, 1, res[0]["id"])
+	first := res[0]["result"].(map[string]any)
+	require.Equal(t, true, first["ok"])
+	require.Equal(t, false, first["cached"])
+	require.Equal(t, []any{"org.users"}, first["packages"])
+	require.Equal(t, true, res[1]["result"].(map[string]any)["cached"])
+
+	// Changes to files read by a compilation invalidate it.
+	require.NoError(t, os.WriteFile(users, []byte("package org.users;\n\nstruct User {\n    name strin;\n}\n"), 0o644))
+	res = serve(compile)
+	result := res[0]["result"].(map[string]any)
+	require.Equal(t, false, result["ok"])
+	require.Equal(t, false, result["cached"])
+	diag := result["diagnostics"].([]any)[0].(map[string]any)
+	require.Equal(t, "error", diag["severity"])
+	require.EqualValues(t, 4, diag["line"])
+
+	source := "package org.users;\nstruct User {\nname string;\n}\n"
+	res = serve(
+		request(2, "check", CompileParams{Entrypoint: users, Source: &source}),
+		request(3, "format", FormatParams{Filename: users, Source: &source}),
+		request(4, "diff", FormatParams{Filename: users, Source: &source}),
+		request(5, "lint", CompileParams{Entrypoint: users}),
+		`{"id": 6, "method": "compile"}`,
+		`{"id": 7,`,
+	)
+	require.Len(t, res, 6)
+	require.Equal(t, map[string]any{"ok": true, "diagnostics": []any{}}, res[0]["result"])
+	require.Equal(t, map[string]any{
+		"source":  "package org.users;\nstruct User {\n    name string;\n}\n",
+		"changed": true,
+	}, res[1]["result"])
+	require.Contains(t, res[2]["result"].(map[string]any)["diff"], "-name string;\n+    name string;\n")
+	require.Equal(t, `unknown method "lint"`, res[3]["error"])
+	require.Equal(t, "missing params", res[4]["error"])
+	require.Contains(t, res[5]["error"], "invalid request")
+	require.Nil(t, res[5]["id"])
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+	}
+	write("arf.mod", "module shop\n")
+	write("main.arf", "package shop;\n\nimport \"models/*\";\nimport org.example.common;\n\nstruct Order {\n    total common.Money;\n}\n")
+	write("models/a.arf", "package shop.models;\n\nstruct A {}\n")
+	write("lib/org/example/common/money.arf", "package org.example.common;\n\nstruct Money {\n    amount int64;\n}\n")
+
+	s := New()
+	params, err := json.Marshal(CompileParams{Entrypoint: filepath.Join(dir, "main.arf")})
+	require.NoError(t, err)
+	compile := func() *CompileResult {
+		res := s.Handle(Request{Method: "compile", Params: params})
+		require.Empty(t, res.Error)
+		result := res.Result.(*CompileResult)
+		require.True(t, result.OK, result.Diagnostics)
+		return result
+	}
+	require.False(t, compile().Cached)
+	require.True(t, compile().Cached)
+
+	// Files matching wildcard imports invalidate the cache
+	write("models/b.arf", "package shop.models;\n\nstruct B {}\n")
+	res := compile()
+	require.False(t, res.Cached)
+	require.Contains(t, res.Files, filepath.Join(dir, "models", "b.arf"))
+	require.True(t, compile().Cached)
+
+	// So do files added to imported packages
+	write("lib/org/example/common/status.arf", "package org.example.common;\n\nenum Status {\n    OK = 0;\n}\n")
+	res = compile()
+	require.False(t, res.Cached)
+	require.Contains(t, res.Files, filepath.Join(dir, "lib", "org", "example", "common", "status.arf"))
+	require.True(t, compile().Cached)
+
+	// And changes to the manifest found next to the entrypoint
+	write("arf.mod", "# Shop schemas\nmodule shop\n")
+	require.False(t, compile().Cached)
+	require.True(t, compile().Cached)
+}
+
+func TestCacheStaleReads(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.arf")
+	require.NoError(t, os.WriteFile(path, []byte("package shop;\n\nstruct A {}\n"), 0o644))
+	reads := map[string]stamp{}
+	st, ok := stampOf(path)
+	require.True(t, ok)
+	reads[path] = st
+
+	s := New()
+	params := CompileParams{Entrypoint: path}
+	res, err := s.compile(params)
+	require.NoError(t, err)
+	require.True(t, res.OK, res.Diagnostics)
+
+	// A file saved while compiling is stamped as it was read, so the result
+	// is not served once the compilation completes
+	started := time.Now()
+	fe, err := idl.New(path)
+	require.NoError(t, err)
+	result := fe.Compile()
+	require.NoError(t, os.WriteFile(path, []byte("package shop;\n\nstruct A {}\n\nstruct B {}\n"), 0o644))
+	key, err := json.Marshal(params)
+	require.NoError(t, err)
+	s.store(string(key), result, reads, started)
+	res, err = s.compile(params)
+	require.NoError(t, err)
+	require.False(t, res.Cached)
+}
+
+func TestCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	s := New()
+	s.maxEntries = 2
+	compile := func(name string) bool {
+		path := filepath.Join(dir, name+".arf")
+		if _, err := os.Stat(path); err != nil {
+			require.NoError(t, os.WriteFile(path, []byte("package shop;\n"), 0o644))
+		}
+		res, err := s.compile(CompileParams{Entrypoint: path})
+		require.NoError(t, err)
+		require.True(t, res.OK, res.Diagnostics)
+		return res.Cached
+	}
+	require.False(t, compile("a"))
+	require.False(t, compile("b"))
+	require.True(t, compile("a"))
+
+	// b is the least recently used, and evicted first
+	require.False(t, compile("c"))
+	require.Len(t, s.cache, 2)
+	require.True(t, compile("a"))
+	require.False(t, compile("b"))
+}
@@ -0,0 +1,186 @@
+package idl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// SignatureHelp describes the arguments expected by the annotation or method
+// whose parentheses enclose a position, so editors can display them while
+// they are typed.
+type SignatureHelp struct {
+	// Label is the whole signature, such as @http(method string, path string)
+	// or Get(r GetUser) -> User.
+	Label string
+	// Params holds the label of each parameter, such as method string.
+	Params []string
+	// ActiveParam is the index within Params of the parameter at the
+	// position. Variadic parameters remain active once reached.
+	ActiveParam int
+}
+
+// SignatureAt returns the signature help for pos within src, the contents of
+// a schema which may be incomplete. Signatures are available within the
+// arguments of built-in annotations, such as @http(, and within the
+// parameter list of methods. It returns nil elsewhere.
+func SignatureAt(src []byte, pos ast.Position) *SignatureHelp {
+	tokens, _ := lexFile(src, nil)
+	c := &completer{tokens: tokens, pos: pos}
+	c.locate()
+	if c.current != nil && c.current.Type == tokenTypeString {
+		// Strings are arguments of their own, so the cursor is within the
+		// argument list as well.
+		c.currentIdx++
+	}
+
+	// Find the parenthesis left open before the cursor, counting the
+	// arguments already written.
+	depth, angles, commas := 0, 0, 0
+	open := -1
+	for i := c.currentIdx - 1; i >= 0 && open == -1; i-- {
+		switch tokens[i].Type {
+		case tokenTypeRightAngled:
+			angles++
+		case tokenTypeShiftRight:
+			angles += 2
+		case tokenTypeLeftAngled:
+			if angles--; angles < 0 {
+				// The cursor is within a type, such as map<string, |, so
+				// the commas found so far belong to it.
+				angles, commas = 0, 0
+			}
+		case tokenTypeRightParen:
+			depth++
+		case tokenTypeLeftParen:
+			if depth == 0 {
+				open = i
+			}
+			depth--
+		case tokenTypeComma:
+			// Commas of map types do not separate arguments.
+			if depth == 0 && angles == 0 {
+				commas++
+			}
+		case tokenTypeSemi, tokenTypeLeftCurly, tokenTypeRightCurly:
+			return nil
+		}
+	}
+	if open < 1 || tokens[open-1].Type != tokenTypeIdentifier {
+		return nil
+	}
+
+	// Annotation names may be qualified, as in @arf.deprecated(.
+	name := tokens[open-1].Value
+	start := open - 1
+	for start >= 2 && tokens[start-1].Type == tokenTypePeriod && tokens[start-2].Type == tokenTypeIdentifier {
+		start -= 2
+		name = tokens[start].Value + "." + name
+	}
+	if start >= 1 && tokens[start-1].Type == tokenTypeAtSign {
+		return annotationSignature(name, commas)
+	}
+
+	file, _ := parse("", tokens, nil)
+	nameToken := tokens[open-1]
+	for _, s := range file.Services {
+		for _, m := range s.Methods {
+			if m.Position.Line == nameToken.Line && m.Position.Column == nameToken.Column {
+				return methodSignature(m, commas)
+			}
+		}
+	}
+	return nil
+}
+
+func annotationSignature(name string, active int) *SignatureHelp {
+	b, ok := builtinAnnotations[name]
+	if !ok {
+		spec, registered := registeredAnnotation(name)
+		if !registered {
+			return nil
+		}
+		b = spec.signature()
+	}
+	help := &SignatureHelp{ActiveParam: active}
+	for i, kind := range b.params {
+		param := b.names[i] + " " + kind.typeName()
+		if b.variadic && i == len(b.params)-1 {
+			param += "..."
+		}
+		if i >= len(b.params)-b.optional {
+			param = "[" + param + "]"
+		}
+		help.Params = append(help.Params, param)
+	}
+	if b.variadic && len(b.params) > 0 {
+		help.ActiveParam = min(active, len(b.params)-1)
+	}
+	help.Label = fmt.Sprintf("@%s(%s)", name, strings.Join(help.Params, ", "))
+	return help
+}
+
+func methodSignature(m *ast.ServiceMethod, active int) *SignatureHelp {
+	help := &SignatureHelp{ActiveParam: active}
+	for _, p := range m.Params {
+		switch {
+		case p.Name == nil && p.Type == nil && !p.Stream:
+			// Parameters yet to be written
+		case p.Stream:
+			help.Params = append(help.Params, "stream "+typeString(p.Type))
+		case p.Name != nil:
+			help.Params = append(help.Params, *p.Name+" "+typeString(p.Type))
+		default:
+			help.Params = append(help.Params, typeString(p.Type))
+		}
+	}
+	var returns []string
+	for _, r := range m.Returns {
+		if r.Stream {
+			returns = append(returns, "stream "+typeString(r.Type))
+		} else {
+			returns = append(returns, typeString(r.Type))
+		}
+	}
+	help.Label = fmt.Sprintf("%s(%s)", m.Name, strings.Join(help.Params, ", "))
+	switch len(returns) {
+	case 0:
+	case 1:
+		help.Label += " -> " + returns[0]
+	default:
+		help.Label += " -> (" + strings.Join(returns, ", ") + ")"
+	}
+	if len(m.Errors) > 0 {
+		errs := make([]string, len(m.Errors))
+		for i, e := range m.Errors {
+			errs[i] = typeString(e.Type)
+		}
+		help.Label += " throws (" + strings.Join(errs, ", ") + ")"
+	}
+	return help
+}
+
+// typeString returns t as written in schemas, such as map<string, User>.
+// Types that failed to parse are written as ?.
+func typeString(t ast.Type) string {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return tt.Name
+	case *ast.SimpleUserType:
+		return tt.Name
+	case *ast.FullQualifiedType:
+		return tt.FullName
+	case *ast.ArrayType:
+		return "array<" + typeString(tt.Type) + ">"
+	case *ast.SetType:
+		return "set<" + typeString(tt.Type) + ">"
+	case *ast.OptionalType:
+		return "optional<" + typeString(tt.Type) + ">"
+	case *ast.MapType:
+		return "map<" + typeString(tt.Key) + ", " + typeString(tt.Value) + ">"
+	case *ast.EmptyType:
+		return "empty"
+	}
+	return "?"
+}
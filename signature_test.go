@@ -0,0 +1,56 @@
+package idl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureAt(t *testing.T) {
+	// The cursor is placed where | is written.
+	signature := func(src string) *SignatureHelp {
+		var pos ast.Position
+		for i, line := range strings.Split(src, "\n") {
+			if col := strings.Index(line, "|"); col != -1 {
+				pos = ast.Position{Line: i + 1, Column: col + 1}
+			}
+		}
+		return SignatureAt([]byte(strings.Replace(src, "|", "", 1)), pos)
+	}
+
+	prelude := "package sig;\n\nstruct Req {}\nstruct Res {}\n\nservice S {\n"
+	help := signature(prelude + `    @http("GET", |`)
+	require.Equal(t, &SignatureHelp{
+		Label:       "@http(method string, path string)",
+		Params:      []string{"method string", "path string"},
+		ActiveParam: 1,
+	}, help)
+
+	help = signature(prelude + `    @http("G|ET", "/s") A(r Req);`)
+	require.Equal(t, 0, help.ActiveParam)
+
+	help = signature(prelude + `    @errors(E.A, E.B, |`)
+	require.Equal(t, "@errors(codes reference...)", help.Label)
+	require.Equal(t, 0, help.ActiveParam)
+
+	help = signature(prelude + "}\n@arf.deprecated(|)\nstruct T {}\n")
+	require.Equal(t, "@arf.deprecated([reason string])", help.Label)
+
+	help = signature(prelude + "    Get(r Req, m map<string, Req>, |) -> (Res, stream Res);\n}\n")
+	require.Equal(t, &SignatureHelp{
+		Label:       "Get(r Req, m map<string, Req>) -> (Res, stream Res)",
+		Params:      []string{"r Req", "m map<string, Req>"},
+		ActiveParam: 2,
+	}, help)
+
+	help = signature(prelude + "    Put(r Req, m map<string, |")
+	require.Equal(t, 1, help.ActiveParam)
+
+	help = signature(prelude + "    Sync(stream |")
+	require.Equal(t, "Sync(stream ?)", help.Label)
+
+	require.Nil(t, signature(prelude+"    Get(r Req) -> Res;|\n}\n"))
+	require.Nil(t, signature(prelude+"    @custom(|\n"))
+}
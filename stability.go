@@ -0,0 +1,82 @@
+package idl
+
+import (
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// validateStability ensures stable methods, either declared as such or
+// belonging to a stable service, do not expose experimental types through
+// their params or returns, directly or through the fields of the structs
+// they reference.
+func (p *validatorP3) validateStability(m *ast.ServiceMethod) {
+	if ast.StabilityOf(m) != ast.StabilityStable {
+		return
+	}
+	seen := map[ast.Object]bool{}
+	check := func(pos ast.Position, t ast.Type) {
+		obj, path := experimentalType(t, seen)
+		if obj == nil {
+			return
+		}
+		var through string
+		if len(path) > 0 {
+			through = " through " + strings.Join(path, ".")
+		}
+		p.Reportf(CodeUnstableExposure, pos, "stable method %s.%s exposes experimental %s %s%s", m.Service.Name, m.Name, strings.ToLower(obj.Kind()), obj.FQN(), through)
+	}
+	for _, param := range m.Params {
+		check(param.Position, param.Type)
+	}
+	for _, ret := range m.Returns {
+		check(ret.Position, ret.Type)
+	}
+}
+
+// experimentalType returns the first experimental struct or enum referenced
+// by t, along with the path of fields leading to it, if any. Structs present
+// in seen are skipped, and those visited are added to it.
+func experimentalType(t ast.Type, seen map[ast.Object]bool) (ast.Object, []string) {
+	switch tt := t.(type) {
+	case *ast.ArrayType:
+		return experimentalType(tt.Type, seen)
+	case *ast.SetType:
+		return experimentalType(tt.Type, seen)
+	case *ast.OptionalType:
+		return experimentalType(tt.Type, seen)
+	case *ast.MapType:
+		if obj, path := experimentalType(tt.Key, seen); obj != nil {
+			return obj, path
+		}
+		return experimentalType(tt.Value, seen)
+	case ast.ResolvableType:
+		obj := tt.Resolved()
+		if obj == nil || seen[obj] {
+			return nil, nil
+		}
+		seen[obj] = true
+		if ast.StabilityOf(obj) == ast.StabilityExperimental {
+			return obj, nil
+		}
+		s, ok := obj.(*ast.Struct)
+		if !ok {
+			return nil, nil
+		}
+		for _, f := range s.AllFields() {
+			if found, path := experimentalType(f.Type, seen); found != nil {
+				return found, append([]string{s.Name, f.Name}, trimStructName(path)...)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// trimStructName drops the struct name starting path, already implied by
+// the field leading to it.
+func trimStructName(path []string) []string {
+	if len(path) > 0 {
+		return path[1:]
+	}
+	return path
+}
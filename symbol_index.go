@@ -0,0 +1,183 @@
+package idl
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// symbolIndexVersion is bumped whenever the layout of persisted indexes
+// changes. Indexes written by other versions are discarded when loaded.
+const symbolIndexVersion = 1
+
+// SymbolIndex maps the fully qualified name of every declaration within a
+// workspace to its location, so workspace-wide symbol searches can be answered
+// without compiling the workspace. Indexes are persisted through Save and
+// LoadSymbolIndex, and kept up to date through Update, which only parses files
+// changed since they were last indexed.
+type SymbolIndex struct {
+	Version int                     `json:"version"`
+	Files   map[string]*IndexedFile `json:"files"`
+}
+
+// IndexedFile holds the symbols declared by a file, along with the
+// modification time and size observed when it was indexed.
+type IndexedFile struct {
+	ModTime time.Time       `json:"mod_time"`
+	Size    int64           `json:"size"`
+	Symbols []IndexedSymbol `json:"symbols"`
+}
+
+// IndexedSymbol is a declaration recorded by a SymbolIndex.
+type IndexedSymbol struct {
+	FQN      string     `json:"fqn"`
+	Kind     SymbolKind `json:"kind"`
+	Filename string     `json:"filename"`
+	Line     int        `json:"line"`
+	Column   int        `json:"column"`
+}
+
+// NewSymbolIndex returns an empty SymbolIndex.
+func NewSymbolIndex() *SymbolIndex {
+	return &SymbolIndex{Version: symbolIndexVersion, Files: map[string]*IndexedFile{}}
+}
+
+// LoadSymbolIndex reads the index stored at path. A missing file, or one
+// written by an incompatible version, results in an empty SymbolIndex.
+func LoadSymbolIndex(path string) (*SymbolIndex, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewSymbolIndex(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	idx := &SymbolIndex{}
+	if err = json.Unmarshal(data, idx); err != nil {
+		return nil, err
+	}
+	if idx.Version != symbolIndexVersion || idx.Files == nil {
+		return NewSymbolIndex(), nil
+	}
+	return idx, nil
+}
+
+// Save stores the index at path. The file is replaced atomically, so readers
+// never observe a partially written index.
+func (idx *SymbolIndex) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Update walks roots for files with one of extensions, reindexing those
+// created or modified since the last update and dropping those that no longer
+// exist. It returns the number of files reindexed or dropped.
+func (idx *SymbolIndex) Update(roots []string, extensions []string) (int, error) {
+	changed := 0
+	seen := map[string]bool{}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !hasExtension(path, extensions) {
+				return nil
+			}
+			location, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			seen[location] = true
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if f, ok := idx.Files[location]; ok && f.Size == info.Size() && f.ModTime.Equal(info.ModTime()) {
+				return nil
+			}
+			data, err := os.ReadFile(location)
+			if err != nil {
+				return err
+			}
+			idx.UpdateFile(location, data)
+			idx.Files[location].ModTime = info.ModTime()
+			idx.Files[location].Size = info.Size()
+			changed++
+			return nil
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	for location := range idx.Files {
+		if !seen[location] {
+			delete(idx.Files, location)
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// UpdateFile indexes src as the contents of path, such as an unsaved editor
+// buffer. Files that fail to parse keep the symbols that could be recovered.
+func (idx *SymbolIndex) UpdateFile(path string, src []byte) {
+	tokens, _ := lexFile(src, nil)
+	file, _ := parse(path, tokens, nil)
+	f := &IndexedFile{}
+	if file != nil && file.Package != nil {
+		var walk func(prefix string, symbols []Symbol)
+		walk = func(prefix string, symbols []Symbol) {
+			for _, s := range symbols {
+				fqn := prefix + "." + s.Name
+				f.Symbols = append(f.Symbols, IndexedSymbol{
+					FQN:      fqn,
+					Kind:     s.Kind,
+					Filename: path,
+					Line:     s.Start.Line,
+					Column:   s.Start.Column,
+				})
+				walk(fqn, s.Children)
+			}
+		}
+		walk(file.Package.Value, Outline(file))
+	}
+	idx.Files[path] = f
+}
+
+// Search returns the symbols whose fully qualified name contains query,
+// ignoring case, sorted by name. An empty query matches every symbol.
+func (idx *SymbolIndex) Search(query string) []IndexedSymbol {
+	query = strings.ToLower(query)
+	var symbols []IndexedSymbol
+	for _, f := range idx.Files {
+		for _, s := range f.Symbols {
+			if strings.Contains(strings.ToLower(s.FQN), query) {
+				symbols = append(symbols, s)
+			}
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].FQN != symbols[j].FQN {
+			return symbols[i].FQN < symbols[j].FQN
+		}
+		return symbols[i].Filename < symbols[j].Filename
+	})
+	return symbols
+}
@@ -0,0 +1,63 @@
+package idl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbolIndex(t *testing.T) {
+	dir := t.TempDir()
+	types := filepath.Join(dir, "common", "types.arf")
+	orders := filepath.Join(dir, "orders.arf")
+	require.NoError(t, os.MkdirAll(filepath.Dir(types), 0o755))
+	require.NoError(t, os.WriteFile(types, []byte("package org.common;\n\nstruct Money {\n    enum Currency { USD = 0; }\n    cents int64;\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(orders, []byte("package org.orders;\n\nstruct Order {}\n\nservice Orders {\n    Get(id string) -> Order;\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("struct Ignored {}"), 0o644))
+
+	fqns := func(symbols []IndexedSymbol) []string {
+		var names []string
+		for _, s := range symbols {
+			names = append(names, s.FQN)
+		}
+		return names
+	}
+
+	idx := NewSymbolIndex()
+	n, err := idx.Update([]string{dir}, DefaultExtensions)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []string{"org.common.Money", "org.common.Money.Currency", "org.orders.Order", "org.orders.Orders", "org.orders.Orders.Get"}, fqns(idx.Search("")))
+
+	found := idx.Search("currency")
+	require.Len(t, found, 1)
+	require.Equal(t, IndexedSymbol{FQN: "org.common.Money.Currency", Kind: SymbolEnum, Filename: types, Line: 4, Column: 5}, found[0])
+
+	path := filepath.Join(dir, ".arf-index")
+	require.NoError(t, idx.Save(path))
+	loaded, err := LoadSymbolIndex(path)
+	require.NoError(t, err)
+	require.Equal(t, fqns(idx.Search("")), fqns(loaded.Search("")))
+
+	// Unchanged files are not reindexed.
+	n, err = loaded.Update([]string{dir}, DefaultExtensions)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	require.NoError(t, os.WriteFile(orders, []byte("package org.orders;\n\nstruct Invoice {}\n"), 0o644))
+	require.NoError(t, os.Remove(types))
+	n, err = loaded.Update([]string{dir}, DefaultExtensions)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []string{"org.orders.Invoice"}, fqns(loaded.Search("")))
+
+	// Buffers are indexed even when incomplete.
+	loaded.UpdateFile(orders, []byte("package org.orders;\n\nstruct Invoice {}\nstruct Draft {"))
+	require.Equal(t, []string{"org.orders.Draft", "org.orders.Invoice"}, fqns(loaded.Search("")))
+
+	missing, err := LoadSymbolIndex(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	require.Empty(t, missing.Search(""))
+}
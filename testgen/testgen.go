@@ -0,0 +1,218 @@
+// Package testgen produces pseudo-random but reproducible values shaped after
+// structs declared in validated arf trees, so runtime packages can fuzz their
+// encoders against real schemas.
+//
+// Generated values use plain Go types that encode directly as JSON: structs and
+// maps become map[string]any, arrays []any, integers int64 or uint64, floats
+// float32 or float64, bytes []byte, timestamps time.Time and enums the name of
+// one of their members. A single member of each union is set, picked at
+// random. Map keys that are not strings are formatted with fmt.Sprint,
+// mirroring their JSON representation.
+package testgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+type config struct {
+	maxLength    int
+	maxDepth     int
+	nullRatio    float64
+	maxStringLen int
+}
+
+// Option configures Generate.
+type Option func(*config)
+
+// WithMaxLength sets the maximum number of entries generated for arrays and
+// maps. Defaults to 4.
+func WithMaxLength(n int) Option {
+	return func(c *config) { c.maxLength = n }
+}
+
+// WithMaxStringLength sets the maximum length of generated strings and byte
+// slices. Defaults to 16.
+func WithMaxStringLength(n int) Option {
+	return func(c *config) { c.maxStringLen = n }
+}
+
+// WithMaxDepth sets how many nested structs are generated before optional
+// fields are left empty and collections are generated without entries.
+// Defaults to 4.
+func WithMaxDepth(n int) Option {
+	return func(c *config) { c.maxDepth = n }
+}
+
+// WithNullRatio sets the probability, between 0 and 1, that an optional field is
+// left empty. Defaults to 0.25.
+func WithNullRatio(p float64) Option {
+	return func(c *config) { c.nullRatio = p }
+}
+
+// Generate returns a value for obj, which must be a struct. Calls with the same
+// object, seed and options always return the same value.
+func Generate(obj ast.Object, seed int64, opts ...Option) (map[string]any, error) {
+	s, ok := obj.(*ast.Struct)
+	if !ok {
+		return nil, fmt.Errorf("cannot generate values for %s %s", obj.Kind(), obj.FQN())
+	}
+	g := &generator{
+		config: config{maxLength: 4, maxDepth: 4, nullRatio: 0.25, maxStringLen: 16},
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+	for _, o := range opts {
+		o(&g.config)
+	}
+	return g.structValue(s, 0), nil
+}
+
+type generator struct {
+	config
+	rand *rand.Rand
+}
+
+func (g *generator) structValue(s *ast.Struct, depth int) map[string]any {
+	fields := s.AllFields()
+	v := make(map[string]any, len(fields))
+	set := map[*ast.Union]*ast.StructField{}
+	for _, f := range fields {
+		if f.Union != nil {
+			if _, ok := set[f.Union]; !ok {
+				set[f.Union] = f.Union.Fields[g.rand.Intn(len(f.Union.Fields))]
+			}
+			if set[f.Union] != f {
+				continue
+			}
+		}
+		v[f.WireName()] = g.value(f.Type, depth+1)
+	}
+	return v
+}
+
+func (g *generator) value(t ast.Type, depth int) any {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return g.primitive(tt.Name)
+	case *ast.OptionalType:
+		if depth > g.maxDepth || g.rand.Float64() < g.nullRatio {
+			return nil
+		}
+		return g.value(tt.Type, depth)
+	case *ast.ArrayType:
+		v := make([]any, g.length(depth))
+		for i := range v {
+			v[i] = g.value(tt.Type, depth)
+		}
+		return v
+	case *ast.SetType:
+		// Duplicates are dropped, so sets may hold fewer elements
+		n := g.length(depth)
+		seen := make(map[string]bool, n)
+		v := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			elem := g.value(tt.Type, depth)
+			if key := fmt.Sprint(elem); !seen[key] {
+				seen[key] = true
+				v = append(v, elem)
+			}
+		}
+		return v
+	case *ast.MapType:
+		n := g.length(depth)
+		v := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			v[fmt.Sprint(g.value(tt.Key, depth))] = g.value(tt.Value, depth)
+		}
+		return v
+	case ast.ResolvableType:
+		switch o := tt.Resolved().(type) {
+		case *ast.Enum:
+			if len(o.Members) == 0 {
+				return ""
+			}
+			return o.Members[g.rand.Intn(len(o.Members))].Name
+		case *ast.Struct:
+			// Required fields referencing their own struct can never be
+			// satisfied, so recursion is cut once the depth limit is hit.
+			if depth > g.maxDepth+1 {
+				return nil
+			}
+			return g.structValue(o, depth)
+		}
+	}
+	return nil
+}
+
+func (g *generator) length(depth int) int {
+	if depth > g.maxDepth || g.maxLength <= 0 {
+		return 0
+	}
+	return g.rand.Intn(g.maxLength + 1)
+}
+
+const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
+
+func (g *generator) primitive(name string) any {
+	switch name {
+	case "bool":
+		return g.rand.Intn(2) == 1
+	case "int8":
+		return int64(int8(g.rand.Uint32()))
+	case "int16":
+		return int64(int16(g.rand.Uint32()))
+	case "int32":
+		return int64(int32(g.rand.Uint32()))
+	case "int64":
+		return int64(g.rand.Uint64())
+	case "uint8":
+		return uint64(uint8(g.rand.Uint32()))
+	case "uint16":
+		return uint64(uint16(g.rand.Uint32()))
+	case "uint32":
+		return uint64(g.rand.Uint32())
+	case "uint64":
+		return g.rand.Uint64()
+	case "float32":
+		return float32(g.rand.NormFloat64() * 1000)
+	case "float64":
+		return g.rand.NormFloat64() * math.MaxInt32
+	case "string":
+		b := make([]byte, g.stringLength())
+		for i := range b {
+			b[i] = alphabet[g.rand.Intn(len(alphabet))]
+		}
+		return string(b)
+	case "bytes":
+		b := make([]byte, g.stringLength())
+		g.rand.Read(b)
+		return b
+	case "timestamp":
+		// Timestamps are kept between 1970 and 2100 at second precision so
+		// they survive encoders that truncate sub-second parts.
+		return time.Unix(g.rand.Int63n(4102444800), 0).UTC()
+	case "duration":
+		return time.Duration(g.rand.Int63n(int64(24 * time.Hour)))
+	case "uuid":
+		// Random (version 4) UUIDs
+		b := make([]byte, 16)
+		g.rand.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "decimal128":
+		return fmt.Sprintf("%d.%02d", g.rand.Int63n(1000000), g.rand.Intn(100))
+	}
+	return nil
+}
+
+func (g *generator) stringLength() int {
+	if g.maxStringLen <= 0 {
+		return 0
+	}
+	return g.rand.Intn(g.maxStringLen + 1)
+}
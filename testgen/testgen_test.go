@@ -0,0 +1,108 @@
+package testgen
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func everything(t *testing.T) *ast.Struct {
+	tree, err := idl.Parse("../fixtures/full.arf")
+	require.NoError(t, err)
+	s := tree.Packages["v1beta1.demo.allfeatures"].Files[0].FindStruct("Everything")
+	require.NotNil(t, s)
+	return s
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	s := everything(t)
+
+	a, err := Generate(s, 42)
+	require.NoError(t, err)
+	b, err := Generate(s, 42)
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	c, err := Generate(s, 43)
+	require.NoError(t, err)
+	require.NotEqual(t, a, c)
+
+	_, err = json.Marshal(a)
+	require.NoError(t, err)
+}
+
+func TestGenerateShapes(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		v, err := Generate(everything(t), seed, WithMaxLength(2), WithMaxStringLength(3))
+		require.NoError(t, err)
+
+		require.IsType(t, false, v["a_bool"])
+		require.GreaterOrEqual(t, v["a_int8"].(int64), int64(-128))
+		require.LessOrEqual(t, v["a_uint16"].(uint64), uint64(65535))
+		require.LessOrEqual(t, len(v["a_str"].(string)), 3)
+		require.LessOrEqual(t, len(v["a_array_struct"].([]any)), 2)
+		for _, n := range v["a_array_struct"].([]any) {
+			require.Contains(t, n.(map[string]any), "nums")
+		}
+		if o := v["a_opt_string"]; o != nil {
+			require.IsType(t, "", o)
+		}
+		require.IsType(t, map[string]any{}, v["a_from_other_file"])
+	}
+}
+
+func TestGenerateRecursive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package example.tree;
+
+struct Node {
+    parent   optional<Node>;
+    children array<Node>;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+	node := tree.Packages["example.tree"].Files[0].FindStruct("Node")
+
+	v, err := Generate(node, 7, WithMaxDepth(2), WithNullRatio(0))
+	require.NoError(t, err)
+	depth := 0
+	for v != nil {
+		depth++
+		v, _ = v["parent"].(map[string]any)
+	}
+	require.Equal(t, 3, depth)
+}
+
+func TestGenerateRejectsNonStructs(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/full.arf")
+	require.NoError(t, err)
+	_, err = Generate(tree.Packages["v1beta1.demo.allfeatures"].Enums[0], 1)
+	require.Error(t, err)
+}
+
+func TestGenerateUnions(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/unions.arf")
+	require.NoError(t, err)
+	contact := tree.Packages["contacts"].FindStruct("Contact")
+
+	members := map[string]bool{}
+	for seed := int64(0); seed < 20; seed++ {
+		v, err := Generate(contact, seed)
+		require.NoError(t, err)
+		var set []string
+		for _, name := range []string{"email", "phone", "extension"} {
+			if _, ok := v[name]; ok {
+				set = append(set, name)
+				members[name] = true
+			}
+		}
+		require.Len(t, set, 1, v)
+	}
+	require.Len(t, members, 3)
+}
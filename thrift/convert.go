@@ -0,0 +1,364 @@
+// Package thrift converts Apache Thrift IDL documents into arf ASTs, easing
+// migrations from Thrift. Constructs without an arf equivalent are either
+// approximated or dropped, and reported as warnings.
+package thrift
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/arf-rpc/idl/internal/naming"
+)
+
+var primitives = map[string]string{
+	"bool":   "bool",
+	"byte":   "int8",
+	"i8":     "int8",
+	"i16":    "int16",
+	"i32":    "int32",
+	"i64":    "int64",
+	"double": "float64",
+	"string": "string",
+	"binary": "bytes",
+	"uuid":   "uuid",
+}
+
+// Convert parses the Thrift document src and converts it into an arf file.
+// The returned diagnostics contain warnings about constructs that could not be
+// translated as-is; when an error diagnostic is present, the returned file is
+// nil.
+func Convert(filename string, src []byte) (*ast.File, []*idl.Diagnostic) {
+	c := &converter{filename: filename}
+	tokens, err := lex(src)
+	if err != nil {
+		c.errorf(token{}, "%s", err)
+		return nil, c.diagnostics
+	}
+	doc, err := parseDocument(tokens)
+	if err != nil {
+		pe := err.(*parseError)
+		c.errorf(pe.tok, "%s", pe.msg)
+		return nil, c.diagnostics
+	}
+
+	f := c.convert(doc)
+	for _, d := range c.diagnostics {
+		if d.Severity == idl.SeverityError {
+			return nil, c.diagnostics
+		}
+	}
+	return f, c.diagnostics
+}
+
+type converter struct {
+	filename    string
+	file        *ast.File
+	typedefs    map[string]*typedef
+	structs     map[string]struct{}
+	diagnostics []*idl.Diagnostic
+}
+
+func (c *converter) pos(t token) ast.Position {
+	return ast.Position{Filename: c.filename, Line: t.line, Column: t.column, File: c.file}
+}
+
+func (c *converter) report(sev idl.Severity, t token, format string, args ...any) {
+	c.diagnostics = append(c.diagnostics, &idl.Diagnostic{
+		Severity: sev,
+		Position: c.pos(t),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *converter) errorf(t token, format string, args ...any) {
+	c.report(idl.SeverityError, t, format, args...)
+}
+
+func (c *converter) warnf(t token, format string, args ...any) {
+	c.report(idl.SeverityWarning, t, format, args...)
+}
+
+func (c *converter) convert(doc *document) *ast.File {
+	c.file = &ast.File{
+		Package:       &ast.Package{},
+		ImportAliases: map[string]string{},
+		Path:          c.filename,
+	}
+	c.typedefs = map[string]*typedef{}
+	c.structs = map[string]struct{}{}
+
+	c.convertPackage(doc)
+	for _, inc := range doc.includes {
+		base := strings.TrimSuffix(inc.path, ".thrift")
+		c.file.Imports = append(c.file.Imports, &ast.Import{
+			Position: c.pos(inc.tok),
+			Value:    base,
+			Alias:    naming.Snake(path.Base(base)),
+		})
+	}
+	for _, td := range doc.typedefs {
+		c.warnf(td.tok, "typedef %s is not supported; its uses were replaced by the aliased type", td.name)
+		c.typedefs[td.name] = td
+	}
+	for _, cd := range doc.consts {
+		c.warnf(cd.tok, "const %s is not supported and was dropped", cd.name)
+	}
+	for _, def := range doc.definitions {
+		if s, ok := def.(*structDef); ok {
+			c.structs[s.name] = struct{}{}
+		}
+	}
+
+	for _, def := range doc.definitions {
+		switch d := def.(type) {
+		case *structDef:
+			c.file.Structs = append(c.file.Structs, c.convertStruct(d))
+		case *enumDef:
+			if e := c.convertEnum(d); e != nil {
+				c.file.Enums = append(c.file.Enums, e)
+			}
+		case *serviceDef:
+			c.file.Services = append(c.file.Services, c.convertService(d))
+		}
+	}
+	return c.file
+}
+
+func (c *converter) convertPackage(doc *document) {
+	name := ""
+	for _, ns := range doc.namespaces {
+		if ns[0] == "*" {
+			name = ns[1]
+			break
+		}
+		if name == "" {
+			name = ns[1]
+		}
+	}
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(c.filename), path.Ext(c.filename))
+	}
+
+	var comps []string
+	for _, comp := range strings.Split(name, ".") {
+		comps = append(comps, naming.Snake(comp))
+	}
+	c.file.Package.Position = ast.Position{Filename: c.filename, Line: 1, Column: 1, File: c.file}
+	c.file.Package.Components = comps
+	c.file.Package.Value = strings.Join(comps, ".")
+}
+
+func (c *converter) convertStruct(d *structDef) *ast.Struct {
+	switch d.kind {
+	case "union":
+		c.warnf(d.tok, "union %s was converted to a struct with optional fields", d.name)
+	case "exception":
+		c.warnf(d.tok, "exception %s was converted to a struct", d.name)
+	}
+
+	s := &ast.Struct{Position: c.pos(d.tok), Name: naming.Camel(d.name)}
+	ids := c.keepIDs(d.name, d.tok, d.fields)
+	for _, f := range d.fields {
+		sf := c.convertField(f, ids)
+		if d.kind == "union" {
+			if _, ok := sf.Type.(*ast.OptionalType); !ok {
+				sf.Type = &ast.OptionalType{Position: sf.Position, Type: sf.Type}
+			}
+		}
+		s.AppendField(sf)
+	}
+	return s
+}
+
+// keepIDs reports whether the field ids of fields, declared by name, can be
+// kept as arf indices. arf requires every field of a struct to declare a
+// non-negative index, or none to; otherwise ids are dropped with a warning.
+func (c *converter) keepIDs(name string, t token, fields []*field) bool {
+	declared, kept := 0, 0
+	for _, f := range fields {
+		if f.hasID {
+			declared++
+			if f.id >= 0 {
+				kept++
+			}
+		}
+	}
+	if declared > 0 && kept < len(fields) {
+		c.warnf(t, "field ids of %s were dropped, as not every field declares a non-negative id; fields are numbered by position", name)
+		return false
+	}
+	return declared > 0
+}
+
+// convertField converts f, keeping its id as the index of the field when ids
+// is set.
+func (c *converter) convertField(f *field, ids bool) ast.StructField {
+	sf := ast.StructField{
+		Position: c.pos(f.tok),
+		Name:     naming.Snake(f.name),
+		Type:     c.convertType(f.typ, 0),
+	}
+	if ids {
+		sf.Index, sf.IndexDeclared = int(f.id), true
+	}
+	if sf.Name != f.name {
+		// Keep the original name on the wire
+		sf.Annotations = append(sf.Annotations, ast.Annotation{
+			Position:  sf.Position,
+			Name:      "wire_name",
+			Arguments: []any{f.name},
+		})
+	}
+	if f.optional {
+		sf.Type = &ast.OptionalType{Position: sf.Position, Type: sf.Type}
+	}
+	if f.hasDefault {
+		c.warnf(f.tok, "default value of field %s is not supported and was dropped", f.name)
+	}
+	return sf
+}
+
+func (c *converter) convertType(t *typeRef, depth int) ast.Type {
+	pos := c.pos(t.tok)
+	if prim, ok := primitives[t.name]; ok {
+		return &ast.PrimitiveType{Position: pos, Name: prim}
+	}
+
+	switch t.name {
+	case "list":
+		return &ast.ArrayType{Position: pos, Type: c.convertType(t.args[0], depth)}
+	case "set":
+		return &ast.SetType{Position: pos, Type: c.convertType(t.args[0], depth)}
+	case "map":
+		return &ast.MapType{Position: pos, Key: c.convertType(t.args[0], depth), Value: c.convertType(t.args[1], depth)}
+	}
+
+	if td, ok := c.typedefs[t.name]; ok {
+		if depth > len(c.typedefs) {
+			c.errorf(t.tok, "typedef %s is recursive", t.name)
+			return &ast.PrimitiveType{Position: pos, Name: "bytes"}
+		}
+		return c.convertType(td.typ, depth+1)
+	}
+
+	if idx := strings.LastIndex(t.name, "."); idx != -1 {
+		comps := []string{naming.Snake(t.name[:idx]), naming.Camel(t.name[idx+1:])}
+		return &ast.FullQualifiedType{
+			Position:   pos,
+			Package:    comps[0],
+			Name:       comps[1],
+			FullName:   strings.Join(comps, "."),
+			Components: comps,
+		}
+	}
+	return &ast.SimpleUserType{Position: pos, Name: naming.Camel(t.name)}
+}
+
+func (c *converter) convertEnum(d *enumDef) *ast.Enum {
+	e := &ast.Enum{Position: c.pos(d.tok), Name: naming.Camel(d.name)}
+	for _, m := range d.members {
+		if m.value < math.MinInt16 || m.value > math.MaxInt16 {
+			c.warnf(m.tok, "value %d of enum member %s is out of range and was dropped", m.value, m.name)
+			continue
+		}
+		e.AppendMember(ast.EnumMember{
+			Position: c.pos(m.tok),
+			Name:     naming.Screaming(m.name),
+			Value:    int(m.value),
+		})
+	}
+	if len(e.Members) == 0 {
+		c.warnf(d.tok, "enum %s has no members and was dropped", d.name)
+		return nil
+	}
+	return e
+}
+
+func (c *converter) convertService(d *serviceDef) *ast.Service {
+	svc := &ast.Service{Position: c.pos(d.tok), Name: naming.Camel(d.name)}
+	if d.extends != "" {
+		c.warnf(d.tok, "service %s extends %s, which is not supported; inherited methods were not included", d.name, d.extends)
+	}
+	for _, fn := range d.functions {
+		svc.AppendMethod(c.convertFunction(fn))
+	}
+	return svc
+}
+
+// isUserStruct indicates whether t references a struct, either declared in the
+// document or in an include.
+func (c *converter) isUserStruct(t *typeRef) bool {
+	if _, ok := primitives[t.name]; ok {
+		return false
+	}
+	if td, ok := c.typedefs[t.name]; ok {
+		return c.isUserStruct(td.typ)
+	}
+	if _, ok := c.structs[t.name]; ok {
+		return true
+	}
+	return strings.Contains(t.name, ".")
+}
+
+func (c *converter) convertFunction(fn *function) *ast.ServiceMethod {
+	m := &ast.ServiceMethod{Position: c.pos(fn.tok), Name: naming.Camel(fn.name)}
+	if fn.oneway {
+		c.warnf(fn.tok, "oneway function %s was converted to a method without returns", fn.name)
+	}
+	if len(fn.throws) > 0 {
+		c.warnf(fn.tok, "throws clause of function %s is not supported and was dropped", fn.name)
+	}
+
+	switch {
+	case len(fn.args) == 1 && !fn.args[0].optional && c.isUserStruct(fn.args[0].typ):
+		name := naming.Snake(fn.args[0].name)
+		m.AppendParam(&ast.MethodParam{
+			Position: c.pos(fn.args[0].tok),
+			Name:     &name,
+			Type:     c.convertType(fn.args[0].typ, 0),
+		})
+	case len(fn.args) > 0:
+		req := c.syntheticStruct(m.Name+"Request", fn.tok)
+		ids := c.keepIDs(fn.name+" arguments", fn.tok, fn.args)
+		for _, a := range fn.args {
+			req.AppendField(c.convertField(a, ids))
+		}
+		name := "request"
+		m.AppendParam(&ast.MethodParam{
+			Position: c.pos(fn.tok),
+			Name:     &name,
+			Type:     &ast.SimpleUserType{Position: c.pos(fn.tok), Name: req.Name},
+		})
+	}
+
+	if fn.ret != nil {
+		if c.isUserStruct(fn.ret) {
+			m.AppendReturn(&ast.MethodReturn{Position: c.pos(fn.ret.tok), Type: c.convertType(fn.ret, 0)})
+		} else {
+			resp := c.syntheticStruct(m.Name+"Response", fn.tok)
+			resp.AppendField(ast.StructField{Position: c.pos(fn.ret.tok), Name: "value", Type: c.convertType(fn.ret, 0)})
+			m.AppendReturn(&ast.MethodReturn{Position: c.pos(fn.ret.tok), Type: &ast.SimpleUserType{Position: c.pos(fn.ret.tok), Name: resp.Name}})
+		}
+	}
+	return m
+}
+
+// syntheticStruct declares a struct wrapping function arguments or results,
+// which must be structs in arf.
+func (c *converter) syntheticStruct(name string, t token) *ast.Struct {
+	base := name
+	for i := 2; ; i++ {
+		if _, ok := c.structs[name]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	c.structs[name] = struct{}{}
+	s := &ast.Struct{Position: c.pos(t), Name: name}
+	c.file.Structs = append(c.file.Structs, s)
+	return s
+}
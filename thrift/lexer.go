@@ -0,0 +1,124 @@
+package thrift
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	line   int
+	column int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "EOF"
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+func isIdentStart(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || r >= '0' && r <= '9' || r == '.'
+}
+
+func isNumberPart(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r == 'x' || r == 'X' || r == '.' || r == '-' || r == '+'
+}
+
+// lex splits a Thrift document into tokens, discarding comments.
+func lex(src []byte) ([]token, error) {
+	data := []rune(string(src))
+	var tokens []token
+	line, col := 1, 1
+	i := 0
+	advance := func() rune {
+		r := data[i]
+		i++
+		col++
+		if r == '\n' {
+			line++
+			col = 1
+		}
+		return r
+	}
+	peek := func(n int) rune {
+		if i+n >= len(data) {
+			return 0
+		}
+		return data[i+n]
+	}
+
+	for i < len(data) {
+		r := data[i]
+		startLine, startCol := line, col
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			advance()
+		case r == '#' || r == '/' && peek(1) == '/':
+			for i < len(data) && data[i] != '\n' {
+				advance()
+			}
+		case r == '/' && peek(1) == '*':
+			advance()
+			advance()
+			for i < len(data) && !(data[i] == '*' && peek(1) == '/') {
+				advance()
+			}
+			if i >= len(data) {
+				return nil, fmt.Errorf("unterminated comment at line %d, column %d", startLine, startCol)
+			}
+			advance()
+			advance()
+		case r == '"' || r == '\'':
+			q := advance()
+			var sb strings.Builder
+			for i < len(data) && data[i] != q {
+				if data[i] == '\\' && i+1 < len(data) {
+					advance()
+				}
+				sb.WriteRune(advance())
+			}
+			if i >= len(data) {
+				return nil, fmt.Errorf("unterminated string at line %d, column %d", startLine, startCol)
+			}
+			advance()
+			tokens = append(tokens, token{kind: tokString, value: sb.String(), line: startLine, column: startCol})
+		case isIdentStart(r):
+			start := i
+			for i < len(data) && isIdentPart(data[i]) {
+				advance()
+			}
+			tokens = append(tokens, token{kind: tokIdent, value: string(data[start:i]), line: startLine, column: startCol})
+		case r >= '0' && r <= '9' || (r == '-' || r == '+') && peek(1) >= '0' && peek(1) <= '9':
+			start := i
+			advance()
+			for i < len(data) && isNumberPart(data[i]) {
+				advance()
+			}
+			tokens = append(tokens, token{kind: tokNumber, value: string(data[start:i]), line: startLine, column: startCol})
+		case strings.ContainsRune("{}()<>[]=,;:*", r):
+			advance()
+			tokens = append(tokens, token{kind: tokPunct, value: string(r), line: startLine, column: startCol})
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at line %d, column %d", r, startLine, startCol)
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, line: line, column: col})
+	return tokens, nil
+}
@@ -0,0 +1,340 @@
+package thrift
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type typeRef struct {
+	name string
+	args []*typeRef
+	tok  token
+}
+
+type field struct {
+	name       string
+	typ        *typeRef
+	optional   bool
+	hasDefault bool
+	hasID      bool
+	id         int64
+	tok        token
+}
+
+type structDef struct {
+	kind   string
+	name   string
+	fields []*field
+	tok    token
+}
+
+type enumMember struct {
+	name  string
+	value int64
+	tok   token
+}
+
+type enumDef struct {
+	name    string
+	members []*enumMember
+	tok     token
+}
+
+type function struct {
+	name   string
+	oneway bool
+	ret    *typeRef
+	args   []*field
+	throws []*field
+	tok    token
+}
+
+type serviceDef struct {
+	name      string
+	extends   string
+	functions []*function
+	tok       token
+}
+
+type include struct {
+	path string
+	tok  token
+}
+
+type typedef struct {
+	name string
+	typ  *typeRef
+	tok  token
+}
+
+type constDef struct {
+	name string
+	tok  token
+}
+
+// document represents the subset of a Thrift document relevant to the
+// conversion, in declaration order.
+type document struct {
+	namespaces  [][2]string
+	includes    []*include
+	typedefs    []*typedef
+	consts      []*constDef
+	definitions []any
+}
+
+type parseError struct {
+	tok token
+	msg string
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.msg, e.tok.line, e.tok.column)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseDocument(tokens []token) (doc *document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(*parseError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, pe
+		}
+	}()
+
+	p := &parser{tokens: tokens}
+	doc = &document{}
+	for p.peek().kind != tokEOF {
+		p.parseDefinition(doc)
+	}
+	return doc, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) advance() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) fail(t token, format string, args ...any) {
+	panic(&parseError{tok: t, msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) is(value string) bool {
+	t := p.peek()
+	return (t.kind == tokPunct || t.kind == tokIdent) && t.value == value
+}
+
+func (p *parser) accept(value string) bool {
+	if p.is(value) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(value string) token {
+	if !p.is(value) {
+		p.fail(p.peek(), "expected %q, got %s", value, p.peek())
+	}
+	return p.advance()
+}
+
+func (p *parser) ident() token {
+	t := p.peek()
+	if t.kind != tokIdent {
+		p.fail(t, "expected identifier, got %s", t)
+	}
+	return p.advance()
+}
+
+func (p *parser) skipSeparator() {
+	if !p.accept(",") {
+		p.accept(";")
+	}
+}
+
+// skipBalanced skips an annotation list or constant value, including nested
+// brackets.
+func (p *parser) skipBalanced() {
+	depth := 0
+	for {
+		t := p.peek()
+		if t.kind == tokEOF {
+			p.fail(t, "unexpected end of file")
+		}
+		if t.kind == tokPunct {
+			switch t.value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+		}
+		p.advance()
+		if depth <= 0 {
+			return
+		}
+	}
+}
+
+func (p *parser) skipAnnotations() {
+	if p.is("(") {
+		p.skipBalanced()
+	}
+}
+
+func (p *parser) parseDefinition(doc *document) {
+	t := p.ident()
+	switch t.value {
+	case "namespace":
+		scope := p.advance()
+		name := p.ident()
+		doc.namespaces = append(doc.namespaces, [2]string{scope.value, name.value})
+		p.skipAnnotations()
+	case "include":
+		path := p.advance()
+		if path.kind != tokString {
+			p.fail(path, "expected include path, got %s", path)
+		}
+		doc.includes = append(doc.includes, &include{path: path.value, tok: t})
+	case "cpp_include":
+		p.advance()
+	case "typedef":
+		typ := p.parseType()
+		name := p.ident()
+		p.skipAnnotations()
+		doc.typedefs = append(doc.typedefs, &typedef{name: name.value, typ: typ, tok: t})
+	case "const":
+		p.parseType()
+		name := p.ident()
+		p.expect("=")
+		p.skipBalanced()
+		doc.consts = append(doc.consts, &constDef{name: name.value, tok: t})
+	case "enum":
+		doc.definitions = append(doc.definitions, p.parseEnum(t))
+	case "struct", "union", "exception":
+		name := p.ident()
+		def := &structDef{kind: t.value, name: name.value, tok: t}
+		def.fields = p.parseFields("{", "}")
+		p.skipAnnotations()
+		doc.definitions = append(doc.definitions, def)
+	case "service":
+		doc.definitions = append(doc.definitions, p.parseService(t))
+	default:
+		p.fail(t, "unexpected %s", t)
+	}
+	p.skipSeparator()
+}
+
+func (p *parser) parseEnum(t token) *enumDef {
+	def := &enumDef{name: p.ident().value, tok: t}
+	p.expect("{")
+	next := int64(0)
+	for !p.accept("}") {
+		name := p.ident()
+		m := &enumMember{name: name.value, value: next, tok: name}
+		if p.accept("=") {
+			v := p.advance()
+			n, err := strconv.ParseInt(v.value, 0, 64)
+			if v.kind != tokNumber || err != nil {
+				p.fail(v, "invalid enum value %s", v)
+			}
+			m.value = n
+		}
+		next = m.value + 1
+		p.skipAnnotations()
+		p.skipSeparator()
+		def.members = append(def.members, m)
+	}
+	p.skipAnnotations()
+	return def
+}
+
+func (p *parser) parseService(t token) *serviceDef {
+	def := &serviceDef{name: p.ident().value, tok: t}
+	if p.accept("extends") {
+		def.extends = p.ident().value
+	}
+	p.expect("{")
+	for !p.accept("}") {
+		fn := &function{tok: p.peek()}
+		if p.accept("oneway") {
+			fn.oneway = true
+		}
+		if !p.accept("void") {
+			fn.ret = p.parseType()
+		}
+		fn.name = p.ident().value
+		fn.args = p.parseFields("(", ")")
+		if p.accept("throws") {
+			fn.throws = p.parseFields("(", ")")
+		}
+		p.skipAnnotations()
+		p.skipSeparator()
+		def.functions = append(def.functions, fn)
+	}
+	p.skipAnnotations()
+	return def
+}
+
+func (p *parser) parseFields(open, close string) []*field {
+	p.expect(open)
+	var fields []*field
+	for !p.accept(close) {
+		f := &field{tok: p.peek()}
+		if p.peek().kind == tokNumber {
+			v := p.advance()
+			n, err := strconv.ParseInt(v.value, 0, 32)
+			if err != nil {
+				p.fail(v, "invalid field id %s", v)
+			}
+			f.id, f.hasID = n, true
+			p.expect(":")
+		}
+		if p.accept("optional") {
+			f.optional = true
+		} else {
+			p.accept("required")
+		}
+		f.typ = p.parseType()
+		f.name = p.ident().value
+		if p.accept("=") {
+			f.hasDefault = true
+			p.skipBalanced()
+		}
+		p.skipAnnotations()
+		p.skipSeparator()
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func (p *parser) parseType() *typeRef {
+	t := p.ident()
+	ref := &typeRef{name: t.value, tok: t}
+	switch t.value {
+	case "list", "set":
+		p.expect("<")
+		ref.args = []*typeRef{p.parseType()}
+		p.expect(">")
+	case "map":
+		p.expect("<")
+		k := p.parseType()
+		p.expect(",")
+		v := p.parseType()
+		p.expect(">")
+		ref.args = []*typeRef{k, v}
+	}
+	p.skipAnnotations()
+	return ref
+}
@@ -0,0 +1,132 @@
+package thrift
+
+import (
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/ast"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `
+namespace go example.users
+namespace * org.example.users
+
+include "shared.thrift"
+
+typedef i64 UserID
+
+const i32 MAX_USERS = 100
+
+enum Status {
+  ACTIVE = 1,
+  Suspended,
+}
+
+/** A user */
+struct User {
+  1: required UserID userId,
+  2: optional string displayName = "anonymous",
+  3: list<string> tags,
+  4: set<i32> groups,
+  5: map<string, shared.Attribute> attributes (go.tag = "attrs"),
+  6: Status status,
+}
+
+union Lookup {
+  1: i64 id
+  2: string email
+}
+
+exception NotFound {
+  1: string message
+}
+
+service UserService extends shared.BaseService {
+  User getUser(1: UserID id) throws (1: NotFound nf),
+  void saveUser(1: User user),
+  oneway void ping(),
+}
+`
+
+func TestConvert(t *testing.T) {
+	f, diags := Convert("users.thrift", []byte(source))
+	require.NotNil(t, f)
+	for _, d := range diags {
+		require.Equal(t, idl.SeverityWarning, d.Severity, d.Error())
+	}
+	require.Len(t, diags, 8)
+
+	require.Equal(t, "org.example.users", f.Package.Value)
+	require.Len(t, f.Imports, 1)
+	require.Equal(t, "shared", f.Imports[0].Alias)
+
+	user := f.FindStruct("User")
+	require.NotNil(t, user)
+	require.Equal(t, "user_id", user.Fields[0].Name)
+	require.Equal(t, "userId", user.Fields[0].WireName())
+	require.Equal(t, "int64", user.Fields[0].Type.(*ast.PrimitiveType).Name)
+	require.IsType(t, &ast.OptionalType{}, user.Fields[1].Type)
+	require.IsType(t, &ast.SetType{}, user.Fields[3].Type)
+	attrs := user.Fields[4].Type.(*ast.MapType)
+	require.Equal(t, "shared.Attribute", attrs.Value.(*ast.FullQualifiedType).FullName)
+
+	status := f.FindEnum("Status")
+	require.Equal(t, "SUSPENDED", status.Members[1].Name)
+	require.Equal(t, 2, status.Members[1].Value)
+
+	lookup := f.FindStruct("Lookup")
+	for _, fld := range lookup.Fields {
+		require.IsType(t, &ast.OptionalType{}, fld.Type)
+	}
+	require.NotNil(t, f.FindStruct("NotFound"))
+
+	svc := f.Services[0]
+	require.Len(t, svc.Methods, 3)
+	get := svc.Methods[0]
+	require.Equal(t, "GetUser", get.Name)
+	require.Equal(t, "GetUserRequest", get.Params[0].Type.(*ast.SimpleUserType).Name)
+	require.Equal(t, "User", get.Returns[0].Type.(*ast.SimpleUserType).Name)
+	save := svc.Methods[1]
+	require.Equal(t, "user", *save.Params[0].Name)
+	require.Empty(t, save.Returns)
+	require.NotNil(t, f.FindStruct("GetUserRequest"))
+}
+
+func TestConvertFieldIDs(t *testing.T) {
+	f, diags := Convert("ids.thrift", []byte(`
+struct Account {
+  1: i64 id,
+  5: string email,
+  9: bool active,
+}
+
+struct Legacy {
+  1: i64 id,
+  string note,
+}
+`))
+	require.NotNil(t, f)
+	require.Len(t, diags, 1)
+	require.Equal(t, idl.SeverityWarning, diags[0].Severity)
+	require.Contains(t, diags[0].Message, "field ids of Legacy were dropped")
+
+	account := f.FindStruct("Account")
+	for i, index := range []int{1, 5, 9} {
+		require.True(t, account.Fields[i].IndexDeclared)
+		require.Equal(t, index, account.Fields[i].Index)
+	}
+	legacy := f.FindStruct("Legacy")
+	for i, fld := range legacy.Fields {
+		require.False(t, fld.IndexDeclared)
+		require.Equal(t, i, fld.Index)
+	}
+}
+
+func TestConvertSyntaxError(t *testing.T) {
+	f, diags := Convert("bad.thrift", []byte("struct { }"))
+	require.Nil(t, f)
+	require.Len(t, diags, 1)
+	require.Equal(t, idl.SeverityError, diags[0].Severity)
+	require.Equal(t, 1, diags[0].Position.Line)
+}
@@ -1,6 +1,9 @@
 package idl
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type tokenType int
 
@@ -28,6 +31,22 @@ const (
 	tokenTypePeriod
 	tokenTypeAtSign
 	tokenTypeArrow
+	tokenTypePlus
+	tokenTypeMinus
+	tokenTypeStar
+	tokenTypeSlash
+	tokenTypePercent
+	tokenTypePipe
+	tokenTypeAmpersand
+	tokenTypeCaret
+	tokenTypeTilde
+	tokenTypeShiftLeft
+	tokenTypeShiftRight
+	tokenTypeTimestamp
+	tokenTypeDuration
+	tokenTypeBytes
+	tokenTypeQuestion
+	tokenTypeFloat
 )
 
 var tokenTypeAsString = map[tokenType]string{
@@ -50,14 +69,44 @@ var tokenTypeAsString = map[tokenType]string{
 	tokenTypeAtSign:      "AtSign",
 	tokenTypeArrow:       "Arrow",
 	tokenTypeHex:         "Hex",
+	tokenTypePlus:        "Plus",
+	tokenTypeMinus:       "Minus",
+	tokenTypeStar:        "Star",
+	tokenTypeSlash:       "Slash",
+	tokenTypePercent:     "Percent",
+	tokenTypePipe:        "Pipe",
+	tokenTypeAmpersand:   "Ampersand",
+	tokenTypeCaret:       "Caret",
+	tokenTypeTilde:       "Tilde",
+	tokenTypeShiftLeft:   "ShiftLeft",
+	tokenTypeShiftRight:  "ShiftRight",
+	tokenTypeTimestamp:   "Timestamp",
+	tokenTypeDuration:    "Duration",
+	tokenTypeBytes:       "Bytes",
+	tokenTypeQuestion:    "Question",
+	tokenTypeFloat:       "Float",
 }
 
 type token struct {
 	Type   tokenType
 	Value  string
 	Pos    int
+	End    int
 	Line   int
 	Column int
+
+	// Block indicates a comment delimited by /* and */, whose Value holds
+	// the text between both delimiters, line breaks included.
+	Block bool
+}
+
+// lastLine returns the line t ends at, which differs from the one it starts
+// at for block comments spanning several lines.
+func (t token) lastLine() int {
+	if t.Block {
+		return t.Line + strings.Count(t.Value, "\n")
+	}
+	return t.Line
 }
 
 func (t token) String() string {
@@ -0,0 +1,312 @@
+package idl
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+var versionSegmentRegex = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]*)?$`)
+
+// validateConventions runs opt-in rules configured through Options. It must
+// run after validatePhase1, as it depends on import aliases. read returns the
+// source of the entrypoint, from which fixes are built.
+func validateConventions(files map[string]*ast.File, entrypoint string, opts *options, read func(string) ([]byte, error)) error {
+	f, ok := files[entrypoint]
+	if !ok {
+		return fmt.Errorf("BUG: validation entrypoint %s not found", entrypoint)
+	}
+
+	v := &conventionsValidator{
+		files: files,
+		f:     f,
+	}
+
+	if opts.versionedPackages {
+		v.validatePackageVersion()
+	}
+	if opts.packageLayout {
+		v.validatePackageLayout(opts.schemaRoot)
+	}
+	if opts.explicitEnums {
+		v.validateExplicitEnumValues()
+	}
+	// Reported as off unless enabled, so the severity of the rule can still
+	// be overridden.
+	sev := SeverityOff
+	if opts.fieldOrder {
+		sev = SeverityError
+	}
+	v.validateFieldOrder(sev, read)
+
+	return errors.Join(v.errors...)
+}
+
+type conventionsValidator struct {
+	files  map[string]*ast.File
+	errors []error
+	f      *ast.File
+}
+
+func (v *conventionsValidator) Errorf(pos ast.Position, format string, args ...interface{}) {
+	v.errors = append(v.errors, newDiagnostic(SeverityError, pos, format, args...))
+}
+
+// Reportf reports a violation of the rule identified by code, whose severity
+// may be overridden.
+func (v *conventionsValidator) Reportf(code string, pos ast.Position, format string, args ...interface{}) {
+	v.errors = append(v.errors, newCodedDiagnostic(code, SeverityError, pos, format, args...))
+}
+
+// splitPackageVersion splits a versioned package such as org.example.users.v1
+// into its base (org.example.users) and version (v1).
+func splitPackageVersion(pkg *ast.Package) (string, string, bool) {
+	if len(pkg.Components) < 2 {
+		return "", "", false
+	}
+	last := pkg.Components[len(pkg.Components)-1]
+	if !versionSegmentRegex.MatchString(last) {
+		return "", "", false
+	}
+	return strings.Join(pkg.Components[:len(pkg.Components)-1], "."), last, true
+}
+
+func (v *conventionsValidator) validatePackageVersion() {
+	pos := v.f.Package.Position
+	base, version, ok := splitPackageVersion(v.f.Package)
+	if !ok {
+		v.Reportf(CodePackageVersion, pos, "package %s must end with a version segment such as v1", v.f.Package.Value)
+		return
+	}
+
+	for _, imp := range v.f.Imports {
+		if !imp.AliasSynthesized {
+			continue
+		}
+		target, ok := v.files[imp.ResolvedValue]
+		if !ok {
+			continue
+		}
+		targetBase, targetVersion, ok := splitPackageVersion(target.Package)
+		if !ok || targetBase != base || targetVersion == version {
+			continue
+		}
+
+		for _, name := range topLevelTypeNames(target) {
+			if v.f.FindStruct(name) == nil && v.f.FindEnum(name) == nil {
+				continue
+			}
+			ipos := imp.Position
+			v.Reportf(CodeAmbiguousImport, ipos, "type %s is declared by both %s and %s; import %s with an explicit alias", name, v.f.Package.Value, target.Package.Value, imp.Value)
+		}
+	}
+}
+
+func topLevelTypeNames(f *ast.File) []string {
+	var names []string
+	for _, s := range f.Structs {
+		names = append(names, s.Name)
+	}
+	for _, e := range f.Enums {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func (v *conventionsValidator) validatePackageLayout(root string) {
+	pos := v.f.Package.Position
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		v.Reportf(CodePackageLayout, pos, "invalid schema root %s: %s", root, err)
+		return
+	}
+	rel, err := filepath.Rel(absRoot, filepath.Dir(v.f.Path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		v.Reportf(CodePackageLayout, pos, "%s is outside of the schema root %s", v.f.Path, absRoot)
+		return
+	}
+
+	expected := filepath.Join(v.f.Package.Components...)
+	if rel == expected {
+		return
+	}
+
+	msg := fmt.Sprintf("package %s does not match directory %s; move the file to %s", v.f.Package.Value, rel, filepath.Join(absRoot, expected))
+	if rel != "." {
+		comps := strings.Split(rel, string(filepath.Separator))
+		valid := true
+		for _, c := range comps {
+			valid = valid && snakeCaseRegex.MatchString(c)
+		}
+		if valid {
+			msg += fmt.Sprintf(" or declare package %s", strings.Join(comps, "."))
+		}
+	}
+	v.Reportf(CodePackageLayout, pos, "%s", msg)
+}
+
+// validateExplicitEnumValues reports enum members declared without a value,
+// suggesting the one they currently follow from the previous member.
+func (v *conventionsValidator) validateExplicitEnumValues() {
+	var check func(enums []*ast.Enum, structs []*ast.Struct)
+	check = func(enums []*ast.Enum, structs []*ast.Struct) {
+		for _, e := range enums {
+			for _, m := range e.Members {
+				if !m.Implicit {
+					continue
+				}
+				d := newCodedDiagnostic(CodeImplicitEnumValue, SeverityError, m.Position, "enum member %s of %s must declare its value, such as %s = %d", m.Name, e.Name, m.Name, m.Value)
+				end := m.Position
+				end.Column += len([]rune(m.Name))
+				d.Fixes = append(d.Fixes, replaceFix(fmt.Sprintf("Declare %s = %d", m.Name, m.Value), end, 0, fmt.Sprintf(" = %d", m.Value)))
+				v.errors = append(v.errors, d)
+			}
+		}
+		for _, s := range structs {
+			check(s.Enums, s.Structs)
+		}
+	}
+	check(v.f.Enums, v.f.Structs)
+}
+
+// validateFieldOrder reports structs whose fields are not declared in
+// ascending index order, with severity sev. When read provides the source of
+// the file, a fix reordering the fields is attached.
+func (v *conventionsValidator) validateFieldOrder(sev Severity, read func(string) ([]byte, error)) {
+	var tokens []token
+	var lines []string
+	var check func(structs []*ast.Struct)
+	check = func(structs []*ast.Struct) {
+		for _, s := range structs {
+			check(s.Structs)
+			var fields []*ast.StructField
+			for _, f := range s.Fields {
+				if f.Parent == s {
+					// Skips fields merged from a re-opening declaration
+					fields = append(fields, f)
+				}
+			}
+			i := 1
+			for i < len(fields) && fields[i].Index >= fields[i-1].Index {
+				i++
+			}
+			if i >= len(fields) {
+				continue
+			}
+			prev := fields[i-1]
+			d := newCodedDiagnostic(CodeFieldOrder, sev, fields[i].Position, "field %s of %s has index %d, but follows field %s with index %d; fields must be declared in ascending index order",
+				fields[i].Name, s.Name, fields[i].Index, prev.Name, prev.Index)
+			if tokens == nil && read != nil {
+				if src, err := read(v.f.Path); err == nil {
+					tokens, _ = lexFile(src, nil)
+					lines = strings.SplitAfter(string(src), "\n")
+				}
+			}
+			if fix := fieldOrderFix(s, fields, tokens, lines); fix != nil {
+				d.Fixes = append(d.Fixes, fix)
+			}
+			v.errors = append(v.errors, d)
+		}
+	}
+	check(v.f.Structs)
+}
+
+// fieldOrderFix returns a fix moving the fields of s, declared in order by
+// fields, so they are sorted by index. Each field is moved along with the
+// lines preceding it, up to the previous field, such as comments and
+// annotations. It returns nil unless every field spans whole lines of its
+// own, or when s declares unions, whose fields cannot be moved out of them.
+func fieldOrderFix(s *ast.Struct, fields []*ast.StructField, tokens []token, lines []string) *Fix {
+	if len(tokens) == 0 || len(s.Unions) > 0 {
+		return nil
+	}
+	open := slices.IndexFunc(tokens, func(t token) bool {
+		return t.Type == tokenTypeLeftCurly && (t.Line > s.Position.Line || t.Line == s.Position.Line && t.Column > s.Position.Column)
+	})
+	if open == -1 {
+		return nil
+	}
+
+	// blocks holds the lines moved along with each field, as [start, end]
+	// line numbers.
+	blocks := make([][2]int, len(fields))
+	start := tokens[open].Line + 1
+	for i, f := range fields {
+		end := fieldEndLine(f, tokens)
+		if end == 0 || f.Position.Line < start {
+			return nil
+		}
+		blocks[i] = [2]int{start, end}
+		start = end + 1
+	}
+	if start > closingLine(tokens, open) || start > len(lines) {
+		return nil
+	}
+
+	order := make([]int, len(fields))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return fields[order[i]].Index < fields[order[j]].Index })
+	var b strings.Builder
+	for _, i := range order {
+		for l := blocks[i][0]; l <= blocks[i][1]; l++ {
+			b.WriteString(strings.TrimSuffix(lines[l-1], "\n") + "\n")
+		}
+	}
+	return &Fix{
+		Title: fmt.Sprintf("Sort the fields of %s by index", s.Name),
+		Edits: []TextEdit{{
+			Start:   ast.Position{Line: blocks[0][0], Column: 1},
+			End:     ast.Position{Line: start, Column: 1},
+			NewText: b.String(),
+		}},
+	}
+}
+
+// fieldEndLine returns the line of the semicolon ending the declaration of
+// f, or zero when it cannot be found.
+func fieldEndLine(f *ast.StructField, tokens []token) int {
+	i := slices.IndexFunc(tokens, func(t token) bool { return t.Line == f.Position.Line && t.Column == f.Position.Column })
+	if i == -1 {
+		return 0
+	}
+	depth := 0
+	for _, t := range tokens[i:] {
+		switch t.Type {
+		case tokenTypeLeftCurly:
+			depth++
+		case tokenTypeRightCurly:
+			depth--
+		case tokenTypeSemi:
+			if depth == 0 {
+				return t.Line
+			}
+		}
+	}
+	return 0
+}
+
+// closingLine returns the line of the brace closing tokens[open], or zero
+// when it cannot be found.
+func closingLine(tokens []token, open int) int {
+	depth := 0
+	for _, t := range tokens[open:] {
+		switch t.Type {
+		case tokenTypeLeftCurly:
+			depth++
+		case tokenTypeRightCurly:
+			depth--
+			if depth == 0 {
+				return t.Line
+			}
+		}
+	}
+	return 0
+}
@@ -3,7 +3,10 @@ package idl
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/arf-rpc/idl/ast"
 )
@@ -27,6 +30,11 @@ func validatePhase1(files map[string]*ast.File, entrypoint string) error {
 		return errors.Join(v.errors...)
 	}
 
+	v.validateAnnotations(f.Package.Annotations)
+	for _, imp := range f.Imports {
+		v.validateAnnotations(imp.Annotations)
+	}
+
 	for _, s := range f.Structs {
 		v.validateStruct(s)
 	}
@@ -39,6 +47,10 @@ func validatePhase1(files map[string]*ast.File, entrypoint string) error {
 		v.detectDuplicatedService(s)
 	}
 
+	for _, c := range f.Consts {
+		v.validateConst(c)
+	}
+
 	return errors.Join(v.errors...)
 }
 
@@ -50,65 +62,183 @@ type validatorP1 struct {
 	f          *ast.File
 }
 
-func (p *validatorP1) Errorf(format string, args ...interface{}) {
-	p.errors = append(p.errors, fmt.Errorf(format, args...))
+func (p *validatorP1) Errorf(pos ast.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, newDiagnostic(SeverityError, pos, format, args...))
+}
+
+// Reportf reports a violation of the rule identified by code, whose severity
+// may be overridden.
+func (p *validatorP1) Reportf(code string, pos ast.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, newCodedDiagnostic(code, SeverityError, pos, format, args...))
 }
 
 func (p *validatorP1) processImports() {
+	imports := map[string]*ast.Import{}
 	for _, imp := range p.f.Imports {
-		// TODO: defineImportAlias should return whether the name was synthetised
-		//       so we can improve the error message
+		p.checkImportedPackage(imp)
 		p.defineImportAlias(imp)
-		if _, ok := p.f.ImportAliases[imp.Alias]; ok {
-			pos := imp.Pos()
-			p.Errorf("duplicate import alias %s at %s, line %d, column %d", imp.Alias, p.f.Path, pos.Line, pos.Column)
+		if ex, ok := imports[imp.Alias]; ok {
+			p.importAliasClash(imp, ex, imports)
 			continue
 		}
+		imports[imp.Alias] = imp
 		p.f.ImportAliases[imp.Alias] = imp.ResolvedValue
 	}
 }
 
-func (p *validatorP1) nameClash(fqn string, pos *ast.Position) {
+// importAliasClash reports imp, whose alias is already used by ex. imports
+// holds the imports declared so far, by alias.
+func (p *validatorP1) importAliasClash(imp, ex *ast.Import, imports map[string]*ast.Import) {
+	if imp.ResolvedValue == ex.ResolvedValue {
+		p.Errorf(imp.Position, "duplicate import alias %s: %s is already imported at line %d, column %d", imp.Alias, imp.Value, ex.Position.Line, ex.Position.Column)
+		return
+	}
+	pkg, exPkg := p.files[imp.ResolvedValue].Package, p.files[ex.ResolvedValue].Package
+	how := "is also the alias of"
+	if imp.AliasSynthesized {
+		how = "is also the default alias of"
+	}
+	msg := fmt.Sprintf("duplicate import alias %s: %s (package %s) %s %s (package %s) imported at line %d, column %d",
+		imp.Alias, imp.Value, pkg.Value, how, ex.Value, exPkg.Value, ex.Position.Line, ex.Position.Column)
+
+	alias := suggestImportAlias(pkg, imports)
+	if alias == "" || imp.End.Line != imp.PathEnd.Line {
+		p.errors = append(p.errors, newDiagnostic(SeverityError, imp.Position, "%s", msg))
+		return
+	}
+	d := newDiagnostic(SeverityError, imp.Position, "%s; import it as %s instead", msg, alias)
+	d.Fixes = append(d.Fixes, &Fix{
+		Title: "Import as " + alias,
+		Edits: []TextEdit{{Start: imp.PathEnd, End: imp.End, NewText: " as " + alias + ";"}},
+	})
+	p.errors = append(p.errors, d)
+}
+
+// suggestImportAlias returns an alias for pkg not used by imports, joining
+// its trailing components, such as billing_users for acme.billing.users. It
+// returns an empty string when none is available.
+func suggestImportAlias(pkg *ast.Package, imports map[string]*ast.Import) string {
+	comps := pkg.Components
+	for n := 2; n <= len(comps); n++ {
+		alias := strings.Join(comps[len(comps)-n:], "_")
+		if _, taken := imports[alias]; !taken && snakeCaseRegex.MatchString(alias) {
+			return alias
+		}
+	}
+	return ""
+}
+
+func (p *validatorP1) nameClash(fqn string, pos, ex *ast.Position) {
 	comps := strings.Split(fqn, ".")
 	name := comps[len(comps)-1]
-	p.Errorf("%s is already defined at %s, line %d, column %d", name, pos.Filename, pos.Line, pos.Column)
+	p.Errorf(*pos, "%s is already defined at %s, line %d, column %d", name, ex.Filename, ex.Line, ex.Column)
 }
 
-func (p *validatorP1) structFieldClash(f *ast.StructField, pos *ast.Position) {
-	p.Errorf("%s is already defined for %s at line %d, column %d", f.Name, pos.Filename, pos.Line, pos.Column)
+func (p *validatorP1) structFieldClash(f *ast.StructField, ex *ast.Position) {
+	p.Errorf(f.Position, "%s is already defined for %s at line %d, column %d", f.Name, f.Parent.Name, ex.Line, ex.Column)
 }
 
 func (p *validatorP1) detectDuplicatedService(s *ast.Service) {
 	fqn := s.FQN()
 	if ex, ok := p.objects[fqn]; ok {
-		p.nameClash(fqn, ex.Pos())
+		p.nameClash(fqn, s.Pos(), ex.Pos())
 		return
 	}
 
 	p.objects[fqn] = s
+	p.validateAnnotations(s.Annotations)
+	s.Timeout = parseTimeout(s.Annotations, p.Errorf)
 
 	// We don't check for duplicated methods here, as we need resolved types
 	// to make sure duplicated methods are divergent.
 	for _, m := range s.Methods {
+		p.validateAnnotations(m.Annotations)
+		m.Timeout = parseTimeout(m.Annotations, p.Errorf)
 		p.validateMethodParams(m)
 	}
 }
 
+func (p *validatorP1) validateAnnotations(set ast.AnnotationSet) {
+	for i := range set {
+		// Built-ins are checked through a pointer, as their named arguments
+		// are bound to positions in place.
+		a := &set[i]
+		repeated := false
+		for i, arg := range a.NamedArguments {
+			if j := slices.IndexFunc(a.NamedArguments[:i], func(ex ast.NamedArgument) bool { return ex.Name == arg.Name }); j != -1 {
+				ex := a.NamedArguments[j].Position
+				p.Errorf(arg.Position, "argument %s of @%s is already declared at line %d, column %d", arg.Name, a.Name, ex.Line, ex.Column)
+				repeated = true
+			}
+		}
+		if !repeated {
+			if err := checkBuiltinAnnotation(a); err != nil {
+				p.Errorf(a.Position, "%s", err)
+			}
+		}
+		if err := checkLanguageTag(a); err != nil {
+			p.Errorf(a.Position, "%s", err)
+		}
+		if err := checkStability(a); err != nil {
+			p.Errorf(a.Position, "%s", err)
+		}
+		if a.Namespace() != arfAnnotationNamespace {
+			continue
+		}
+		if !isKnownArfAnnotation(a) {
+			p.Reportf(CodeUnknownAnnotation, a.Position, "unknown annotation @%s", a.Name)
+		}
+	}
+}
+
+// parseTimeout returns the duration set by the @timeout annotation of set, if
+// any, reporting invalid ones through errorf.
+func parseTimeout(set ast.AnnotationSet, errorf func(pos ast.Position, format string, args ...any)) time.Duration {
+	all := set.AllByName("timeout")
+	if len(all) == 0 {
+		return 0
+	}
+	a := all[0]
+	if len(all) > 1 {
+		errorf(all[1].Position, "@timeout declared more than once")
+		return 0
+	}
+	var d time.Duration
+	raw, ok := singleStringArgument(a)
+	if ok {
+		var err error
+		if d, err = time.ParseDuration(raw); err != nil {
+			errorf(a.Position, "invalid @timeout %q: %s", raw, err)
+			return 0
+		}
+	} else if d, ok = singleDurationArgument(a); ok {
+		raw = d.String()
+	} else {
+		// Reported by validateAnnotations
+		return 0
+	}
+	if d <= 0 {
+		errorf(a.Position, "@timeout must be positive, got %q", raw)
+		return 0
+	}
+	return d
+}
+
 func (p *validatorP1) validateMethodParams(m *ast.ServiceMethod) {
 	inputNames := makeSet[string]()
 	hasStreamingInput := false
 	for _, param := range m.Params {
 		if param.Name != nil {
 			if inputNames.has(*param.Name) {
-				p.Errorf("duplicate parameter name %s for method %s at %s, line %d, column %d", *param.Name, m.Name, param.Position.Filename, param.Position.Line, param.Position.Column)
+				p.Errorf(param.Position, "duplicate parameter name %s for method %s", *param.Name, m.Name)
 			}
 			if !snakeCaseRegex.MatchString(*param.Name) {
-				p.Errorf("invalid parameter name %s for method %s: must be snake_case at %s, line %d, column %d", *param.Name, m.Name, param.Position.Filename, param.Position.Line, param.Position.Column)
+				p.Reportf(CodeNamingCase, param.Position, "invalid parameter name %s for method %s: must be snake_case", *param.Name, m.Name)
 			}
 		}
 
 		if param.Stream && hasStreamingInput {
-			p.Errorf("method %s can only have one stream param at %s, line %d, column %d", m.Name, param.Position.Filename, param.Position.Line, param.Position.Column)
+			p.Errorf(param.Position, "method %s can only have one stream param", m.Name)
 		} else if param.Stream {
 			hasStreamingInput = true
 		}
@@ -118,7 +248,7 @@ func (p *validatorP1) validateMethodParams(m *ast.ServiceMethod) {
 	hasUnaryOutput := false
 	for _, r := range m.Returns {
 		if r.Stream && hasStreamingOutput {
-			p.Errorf("method %s can only have one stream return at %s, line %d, column %d", m.Name, r.Position.Filename, r.Position.Line, r.Position.Column)
+			p.Errorf(r.Position, "method %s can only have one stream return", m.Name)
 		} else if r.Stream {
 			hasStreamingOutput = true
 		} else if !r.Stream {
@@ -127,34 +257,76 @@ func (p *validatorP1) validateMethodParams(m *ast.ServiceMethod) {
 	}
 
 	if hasUnaryOutput && hasStreamingOutput {
-		p.Errorf("method %s declares both unary output and stream output, which is not allowed at line %d, column %d", m.Name, m.Position.Line, m.Position.Column)
+		p.Errorf(m.Position, "method %s declares both unary output and stream output, which is not allowed", m.Name)
+	}
+
+	// Methods built by other means than parsing must set their streaming
+	// mode as the parser does.
+	if m.ClientStreaming != hasStreamingInput {
+		p.Errorf(m.Position, "method %s is marked with ClientStreaming %t, but %s", m.Name, m.ClientStreaming, streamDescription(hasStreamingInput, "param"))
+	}
+	if m.ServerStreaming != hasStreamingOutput {
+		p.Errorf(m.Position, "method %s is marked with ServerStreaming %t, but %s", m.Name, m.ServerStreaming, streamDescription(hasStreamingOutput, "return"))
 	}
 }
 
+func streamDescription(streams bool, what string) string {
+	if streams {
+		return "declares a stream " + what
+	}
+	return "declares no stream " + what
+}
+
+func (p *validatorP1) validateConst(c *ast.Const) {
+	fqn := c.FQN()
+	if ex, ok := p.objects[fqn]; ok {
+		p.nameClash(fqn, c.Pos(), ex.Pos())
+		return
+	}
+	p.objects[fqn] = c
+	p.validateAnnotations(c.Annotations)
+}
+
 func (p *validatorP1) validateEnum(e *ast.Enum) {
 	fqn := e.FQN()
 	if ex, ok := p.objects[fqn]; ok {
-		p.nameClash(fqn, ex.Pos())
+		p.nameClash(fqn, e.Pos(), ex.Pos())
 		return
 	}
 	p.objects[fqn] = e
+	p.validateAnnotations(e.Annotations)
+	for _, m := range e.Members {
+		p.validateAnnotations(m.Annotations)
+	}
 
 	if len(e.Members) == 0 {
-		p.Errorf("Enum %s must have at least one member at %s, line %d, column %d", e.Name, e.Position.Filename, e.Position.Line, e.Position.Column)
+		p.Errorf(e.Position, "Enum %s must have at least one member", e.Name)
 		return
 	}
 
 	p.detectDuplicatedEnumValues(e)
+	p.detectReservedEnumMembers(e)
+	if e.Flags {
+		p.detectInvalidFlags(e)
+	}
 }
 
 func (p *validatorP1) validateStruct(s *ast.Struct) {
 	fqn := s.FQN()
 	if ex, ok := p.objects[fqn]; ok {
-		p.nameClash(fqn, ex.Pos())
+		p.nameClash(fqn, s.Pos(), ex.Pos())
 		return
 	}
 	p.objects[fqn] = s
+	p.validateAnnotations(s.Annotations)
+	for _, f := range s.Fields {
+		p.validateAnnotations(f.Annotations)
+	}
 	p.detectDuplicatedFields(s)
+	p.detectWireNameCollisions(s)
+	p.errors = append(p.errors, fieldIndexConflicts(s)...)
+	p.errors = append(p.errors, reservedFieldConflicts(s, s.Fields)...)
+	p.validateUnions(s)
 
 	for _, ss := range s.Structs {
 		p.validateStruct(ss)
@@ -176,16 +348,197 @@ func (p *validatorP1) detectDuplicatedFields(s *ast.Struct) {
 	}
 }
 
+func (p *validatorP1) detectWireNameCollisions(s *ast.Struct) {
+	fields := make(map[string]*ast.StructField)
+	for _, f := range s.Fields {
+		if a := f.Annotations.ByName("wire_name"); a != nil {
+			if v, ok := singleStringArgument(a); !ok {
+				// Reported by validateAnnotations
+				continue
+			} else if v == "" {
+				p.Errorf(a.Position, "@wire_name cannot be empty")
+				continue
+			}
+		}
+		name := f.WireName()
+		if ex, ok := fields[name]; ok {
+			// Fields sharing the same name are reported by detectDuplicatedFields
+			if ex.Name != f.Name {
+				p.Reportf(CodeWireNameCollision, f.Position, "wire name %s of field %s collides with field %s at line %d, column %d", name, f.Name, ex.Name, ex.Position.Line, ex.Position.Column)
+			}
+			continue
+		}
+		fields[name] = f
+	}
+}
+
+// validateUnions ensures the unions of s declare members, none of them
+// optional, and that their names do not clash with the fields of s, union
+// members included, nor with one another.
+func (p *validatorP1) validateUnions(s *ast.Struct) {
+	if len(s.Unions) == 0 {
+		return
+	}
+	names := make(posSet)
+	for _, f := range s.Fields {
+		if _, ok := names[f.Name]; !ok {
+			names[f.Name] = f.Pos()
+		}
+	}
+	for _, u := range s.Unions {
+		p.validateAnnotations(u.Annotations)
+		if ex, ok := names[u.Name]; ok {
+			p.Errorf(u.Position, "%s is already defined for %s at line %d, column %d", u.Name, s.Name, ex.Line, ex.Column)
+		} else {
+			names[u.Name] = u.Pos()
+		}
+		if len(u.Fields) == 0 {
+			p.Errorf(u.Position, "union %s of %s declares no members", u.Name, s.Name)
+		}
+		for _, f := range u.Fields {
+			if _, ok := f.Type.(*ast.OptionalType); ok {
+				p.Errorf(f.Position, "member %s of union %s cannot be optional: at most one member of a union is set at a time", f.Name, u.Name)
+			}
+		}
+	}
+}
+
+// fieldIndexConflicts ensures the fields of s either all declare an index, or
+// none does, and that declared indices are unique.
+func fieldIndexConflicts(s *ast.Struct) []error {
+	declared := slices.ContainsFunc(s.Fields, func(f *ast.StructField) bool { return f.IndexDeclared })
+	if !declared {
+		return nil
+	}
+	var errs []error
+	indices := map[int]*ast.StructField{}
+	for _, f := range s.Fields {
+		if !f.IndexDeclared {
+			errs = append(errs, newDiagnostic(SeverityError, f.Position, "field %s declares no index, while other fields of %s do; declare an index for every field, or none", f.Name, s.Name))
+			continue
+		}
+		if ex, ok := indices[f.Index]; ok {
+			errs = append(errs, newDiagnostic(SeverityError, f.Position, "index %d of field %s is already used by field %s at %s", f.Index, f.Name, ex.Name, relativeLocation(ex.Position, f.Position)))
+			continue
+		}
+		indices[f.Index] = f
+	}
+	return errs
+}
+
+// reservedFieldConflicts ensures fields, which belong to s, use none of the
+// indices or names reserved by s. Fields without a declared index are checked
+// against the index they take by position.
+func reservedFieldConflicts(s *ast.Struct, fields []*ast.StructField) []error {
+	var errs []error
+	for _, r := range s.Reserved {
+		for _, i := range r.Indices {
+			if i < 0 {
+				errs = append(errs, newDiagnostic(SeverityError, r.Position, "reserved index %d of %s cannot be negative", i, s.Name))
+			}
+		}
+	}
+	for _, f := range fields {
+		for _, r := range s.Reserved {
+			switch {
+			case r.ReservesIndex(f.Index) && f.IndexDeclared:
+				errs = append(errs, newDiagnostic(SeverityError, f.Position, "index %d of field %s is reserved at %s", f.Index, f.Name, relativeLocation(r.Position, f.Position)))
+			case r.ReservesIndex(f.Index):
+				errs = append(errs, newDiagnostic(SeverityError, f.Position, "field %s takes index %d by position, which is reserved at %s; declare an index for every field instead", f.Name, f.Index, relativeLocation(r.Position, f.Position)))
+			}
+			if r.ReservesName(f.Name) {
+				errs = append(errs, newDiagnostic(SeverityError, f.Position, "field name %s is reserved at %s", f.Name, relativeLocation(r.Position, f.Position)))
+			} else if r.ReservesName(f.WireName()) {
+				errs = append(errs, newDiagnostic(SeverityError, f.Position, "wire name %s of field %s is reserved at %s", f.WireName(), f.Name, relativeLocation(r.Position, f.Position)))
+			}
+		}
+	}
+	return errs
+}
+
+// relativeLocation describes pos, omitting its file when it is the one of
+// from.
+func relativeLocation(pos, from ast.Position) string {
+	if pos.Filename == from.Filename {
+		return fmt.Sprintf("line %d, column %d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s, line %d, column %d", pos.Filename, pos.Line, pos.Column)
+}
+
 func (p *validatorP1) detectDuplicatedEnumValues(e *ast.Enum) {
 	fields := make(posSet)
+	values := make(map[int]*ast.EnumMember)
 	for _, f := range e.Members {
 		if ex, ok := fields[f.Name]; ok {
-			p.nameClash(f.Name, ex)
+			p.nameClash(f.Name, f.Pos(), ex)
 			continue
 		}
 		fields[f.Name] = f.Pos()
+
+		if ex, ok := values[f.Value]; ok {
+			p.Errorf(f.Position, "Enum member %s has value %d, already used by %s at line %d, column %d", f.Name, f.Value, ex.Name, ex.Position.Line, ex.Position.Column)
+			continue
+		}
+		values[f.Value] = f
+	}
+}
+
+// detectReservedEnumMembers ensures the members of e use none of the values
+// or names it reserves.
+func (p *validatorP1) detectReservedEnumMembers(e *ast.Enum) {
+	for _, m := range e.Members {
+		for _, r := range e.Reserved {
+			if r.ReservesIndex(m.Value) {
+				p.Errorf(m.Position, "value %d of enum member %s is reserved at line %d, column %d", m.Value, m.Name, r.Position.Line, r.Position.Column)
+			}
+			if r.ReservesName(m.Name) {
+				p.Errorf(m.Position, "enum member name %s is reserved at line %d, column %d", m.Name, r.Position.Line, r.Position.Column)
+			}
+		}
+	}
+}
+
+// detectInvalidFlags ensures the members of e, a flags enum, are either single
+// bits or combinations of the bits of members declared before them, such as
+// READ_WRITE = READ | WRITE. Zero is allowed, for members holding no bits.
+func (p *validatorP1) detectInvalidFlags(e *ast.Enum) {
+	var bits int
+	for _, m := range e.Members {
+		switch v := m.Value; {
+		case v < 0:
+			p.Errorf(m.Position, "Member %s of flags enum %s cannot have a negative value", m.Name, e.Name)
+		case v&(v-1) == 0:
+			bits |= v
+		case v&^bits != 0:
+			p.Errorf(m.Position, "Member %s of flags enum %s has value %d, which is neither a power of two nor a combination of the members declared before it", m.Name, e.Name, v)
+		}
+	}
+}
+
+// checkImportedPackage ensures the files matched by a wildcard import all
+// declare the same package, which the alias of the import refers to.
+func (p *validatorP1) checkImportedPackage(imp *ast.Import) {
+	if len(imp.Files) < 2 {
+		return
+	}
+	first := p.files[imp.Files[0]]
+	for _, location := range imp.Files[1:] {
+		if f := p.files[location]; f.Package.Value != first.Package.Value {
+			dir := filepath.Dir(p.f.Path)
+			p.Errorf(imp.Position, "files matching %s declare different packages: %s is in package %s, but %s is in package %s",
+				imp.Value, relativePath(dir, first.Path), first.Package.Value, relativePath(dir, f.Path), f.Package.Value)
+			return
+		}
+	}
+}
+
+// relativePath returns location relative to dir, or as-is when it is not
+// within it.
+func relativePath(dir, location string) string {
+	if rel, err := filepath.Rel(dir, location); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
 	}
-	return
+	return location
 }
 
 func (p *validatorP1) defineImportAlias(imp *ast.Import) {
@@ -197,4 +550,5 @@ func (p *validatorP1) defineImportAlias(imp *ast.Import) {
 		panic("BUG: resolved import not found")
 	}
 	imp.Alias = f.Package.Components[len(f.Package.Components)-1]
+	imp.AliasSynthesized = true
 }
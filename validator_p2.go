@@ -3,29 +3,54 @@ package idl
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"strings"
 	"unicode"
 
 	"github.com/arf-rpc/idl/ast"
 )
 
-func validatePhase2(files map[string]*ast.File, entrypoint string) error {
+// validatePhase2 resolves and type-checks references. When imports is not
+// nil, references to types declared by files that are not imported are
+// reported with a fix adding the import.
+func validatePhase2(files map[string]*ast.File, entrypoint string, imports *importFinder) error {
 	f, ok := files[entrypoint]
 	if !ok {
 		return fmt.Errorf("BUG: validation entrypoint %s not found", entrypoint)
 	}
 
 	v := &validatorP2{
-		files:  files,
-		errors: nil,
-		f:      f,
+		files:   files,
+		errors:  nil,
+		f:       f,
+		imports: imports,
+	}
+
+	v.resolveConsts()
+
+	v.resolveAnnotations(v.f, f.Package.Annotations)
+	for _, imp := range f.Imports {
+		v.resolveAnnotations(v.f, imp.Annotations)
 	}
 
 	for _, s := range f.Structs {
 		v.validateStruct(s)
 	}
+	var inherit func(structs []*ast.Struct)
+	inherit = func(structs []*ast.Struct) {
+		for _, s := range structs {
+			v.validateInheritance(s)
+			inherit(s.Structs)
+		}
+	}
+	inherit(f.Structs)
 
-	// No need to validate enums, as they are not allowed to reference other types.
+	// Enums are not allowed to reference other types, but their annotations
+	// may still reference enum members.
+	for _, e := range f.Enums {
+		v.resolveEnumAnnotations(v.f, e)
+	}
 
 	for _, s := range f.Services {
 		v.validateService(s)
@@ -35,33 +60,172 @@ func validatePhase2(files map[string]*ast.File, entrypoint string) error {
 }
 
 type validatorP2 struct {
-	files  map[string]*ast.File
-	errors []error
-	f      *ast.File
+	files   map[string]*ast.File
+	errors  []error
+	f       *ast.File
+	imports *importFinder
+
+	// public caches the result of publicAliases, by file.
+	public map[*ast.File]map[string]string
+	// consts holds the evaluation state of constants.
+	consts map[*ast.Const]int
 }
 
-func (v *validatorP2) Errorf(format string, args ...interface{}) {
-	v.errors = append(v.errors, fmt.Errorf(format, args...))
+func (v *validatorP2) Errorf(pos ast.Position, format string, args ...interface{}) {
+	v.errors = append(v.errors, newDiagnostic(SeverityError, pos, format, args...))
 }
 
 func (v *validatorP2) validateStruct(s *ast.Struct) {
+	v.resolveAnnotations(s, s.Annotations)
+	if s.Extends != nil {
+		v.resolveExtends(s)
+	}
+
 	for _, ss := range s.Structs {
 		v.validateStruct(ss)
 	}
 
 	for _, f := range s.Fields {
-		v.resolveType(s, f.Type)
+		v.validateField(s.Original(), f)
+	}
+
+	for _, e := range s.Enums {
+		v.resolveEnumAnnotations(s, e)
+	}
+}
+
+// validateField resolves the type and annotations of f, a field of s. Fields
+// merged from re-opening declarations are resolved within the file declaring
+// them, so they use its imports.
+func (v *validatorP2) validateField(s *ast.Struct, f *ast.StructField) {
+	if file := f.Position.File; file != nil && file != v.f {
+		defer func(restore *ast.File) { v.f = restore }(v.f)
+		v.f = file
 	}
+	v.resolveType(s, f.Type)
+	v.resolveAnnotations(s, f.Annotations)
+	v.resolveDefault(f)
+	v.resolveConstraints(f)
+}
 
-	// No need to validate enums, as they are not allowed to reference other types.
+func (v *validatorP2) resolveEnumAnnotations(ctx ast.Container, e *ast.Enum) {
+	v.resolveAnnotations(ctx, e.Annotations)
+	for _, m := range e.Members {
+		v.resolveAnnotations(ctx, m.Annotations)
+	}
+}
+
+func (v *validatorP2) resolveAnnotations(ctx ast.Container, set ast.AnnotationSet) {
+	for _, a := range set {
+		b, builtin := builtinAnnotations[a.Name]
+		for i, arg := range a.Arguments {
+			a.Arguments[i] = v.resolveAnnotationValue(ctx, arg, builtin)
+			if builtin {
+				a.Arguments[i] = v.resolveBuiltinArgument(&a, b, i)
+			}
+		}
+		for i, arg := range a.NamedArguments {
+			a.NamedArguments[i].Value = v.resolveAnnotationValue(ctx, arg.Value, builtin)
+		}
+	}
+}
+
+// resolveAnnotationValue resolves annotation arguments referencing enum
+// members, such as RetryPolicy.EXPONENTIAL or common.RetryPolicy.EXPONENTIAL,
+// or user-defined types such as ErrorCode, returning the value to store in
+// place of value.
+// Arguments of annotations other than built-in ones may also be plain
+// identifiers, such as GET in @route(GET): bare identifiers referencing
+// nothing and which cannot name a type are replaced by their name.
+// References to constants, such as MAX_PAGE_SIZE or common.MAX_PAGE_SIZE,
+// are resolved to the constant.
+func (v *validatorP2) resolveAnnotationValue(ctx ast.Container, value any, builtin bool) any {
+	ref, ok := value.(*ast.AnnotationReference)
+	if !ok {
+		return value
+	}
+
+	if idx := strings.LastIndex(ref.Name, "."); idx != -1 {
+		if e, ok := v.lookupType(ctx, ref.Name[:idx]).(*ast.Enum); ok {
+			if m := e.FindMember(ref.Name[idx+1:]); m != nil {
+				ref.ResolvedObject = m
+				return ref
+			}
+		}
+	}
+
+	if obj := v.lookupType(ctx, ref.Name); obj != nil {
+		ref.ResolvedObject = obj
+		return ref
+	}
+
+	if c := v.annotationConst(ref.Name); c != nil {
+		ref.ResolvedObject = c
+		return ref
+	}
+
+	if !builtin && !strings.Contains(ref.Name, ".") && !isTypeName(ref.Name) {
+		return ref.Name
+	}
+
+	pos := ref.Pos()
+	v.Errorf(*pos, "Undefined reference %s", ref.Name)
+	return ref
+}
+
+// resolveBuiltinArgument checks the resolved reference held by the argument
+// at index i of a, a built-in annotation described by b, against the kind of
+// its param, which validatePhase1 leaves to this phase. References to
+// constants are replaced by the values of the constants, so @max_length(MAX)
+// is interpreted as @max_length(64) would be, except for those of @default,
+// which resolveDefault records on the field.
+func (v *validatorP2) resolveBuiltinArgument(a *ast.Annotation, b builtinAnnotation, i int) any {
+	ref, ok := a.Arguments[i].(*ast.AnnotationReference)
+	if !ok || ref.ResolvedObject == nil || len(b.params) == 0 {
+		return a.Arguments[i]
+	}
+	c, isConst := ref.ResolvedObject.(*ast.Const)
+	if isConst && c.Value == nil {
+		// Reported while evaluating the constant
+		return ref
+	}
+	kind := b.params[min(i, len(b.params)-1)]
+	if got := argKindOf(ref); got&kind == 0 {
+		v.Errorf(ref.Position, "%s", b.errorf("argument %d of @%s must be %s, got %s", i+1, a.Name, kind, got))
+		return ref
+	}
+	if !isConst || a.Name == "default" {
+		return ref
+	}
+	if u, ok := c.Value.(uint64); ok {
+		if u > math.MaxInt64 {
+			v.Errorf(ref.Position, "Constant %s overflows int64, the type of arguments of @%s", ref.Name, a.Name)
+			return ref
+		}
+		return int64(u)
+	}
+	return c.Value
+}
+
+// isTypeName indicates whether name follows the casing of struct and enum
+// names, excluding names made of capitals only, such as GET.
+func isTypeName(name string) bool {
+	return camelCaseRegex.MatchString(name) && !screamingSnakeCaseRegex.MatchString(name)
 }
 
 func (v *validatorP2) resolveType(parent ast.Object, t ast.Type) {
 	switch tt := t.(type) {
 	case *ast.OptionalType:
+		if inner, ok := tt.Type.(*ast.OptionalType); ok {
+			// optional<optional<T>> has no distinct wire representation.
+			v.Errorf(inner.Position, "Nested optional types are not allowed; declare the type as optional once")
+		}
 		v.resolveType(parent, tt.Type)
 	case *ast.ArrayType:
 		v.resolveType(parent, tt.Type)
+	case *ast.SetType:
+		v.resolveType(parent, tt.Type)
+		v.validateSetElement(tt)
 	case *ast.MapType:
 		v.resolveType(parent, tt.Key)
 		v.resolveType(parent, tt.Value)
@@ -72,8 +236,10 @@ func (v *validatorP2) resolveType(parent ast.Object, t ast.Type) {
 		v.preResolveType(parent, tt.FullName, tt)
 	case *ast.PrimitiveType:
 		// NOOP
+	case *ast.EmptyType:
+		v.Errorf(tt.Position, "empty may only be used as the single return of a method")
 	default:
-		v.Errorf("Bug: Invalid type %T", tt)
+		v.Errorf(*parent.Pos(), "Bug: Invalid type %T", tt)
 	}
 }
 
@@ -87,14 +253,58 @@ func (v *validatorP2) preResolveType(parent ast.Object, name string, rt ast.Reso
 
 	if obj == nil {
 		pos := rt.Pos()
-		v.Errorf("Undefined type %s at %s, line %d, column %d", name, pos.Filename, pos.Line, pos.Column)
+		d := newDiagnostic(SeverityError, pos, "Undefined type %s", name)
+		if match, ok := closestMatch(name, v.typeCandidates(parent)); ok {
+			d.Message += fmt.Sprintf("; did you mean %s?", match)
+			d.Fixes = append(d.Fixes, replaceFix("Replace with "+match, pos, len([]rune(name)), match))
+		}
+		if _, simple := rt.(*ast.SimpleUserType); simple && v.imports != nil {
+			if fix := v.imports.fix(v.f, name, pos); fix != nil {
+				d.Fixes = append(d.Fixes, fix)
+			}
+		}
+		v.errors = append(v.errors, d)
 		return
 	}
 
+	if s, ok := obj.(*ast.Struct); ok {
+		obj = s.Original()
+	}
 	rt.SetResolved(obj)
 	rt.SetFQN(obj.FQN())
 }
 
+// typeCandidates lists names of types visible from parent, used to suggest
+// corrections for undefined types.
+func (v *validatorP2) typeCandidates(parent ast.Object) []string {
+	var names []string
+	var collect func(prefix string, structs []*ast.Struct, enums []*ast.Enum)
+	collect = func(prefix string, structs []*ast.Struct, enums []*ast.Enum) {
+		for _, e := range enums {
+			names = append(names, prefix+e.Name)
+		}
+		for _, s := range structs {
+			names = append(names, prefix+s.Name)
+			collect(prefix+s.Name+".", s.Structs, s.Enums)
+		}
+	}
+
+	for s, ok := parent.(*ast.Struct); ok && s != nil; s = s.Parent {
+		collect("", s.Structs, s.Enums)
+	}
+	collect("", v.f.Structs, v.f.Enums)
+	aliases := maps.Clone(v.publicAliases(v.f))
+	maps.Copy(aliases, v.f.ImportAliases)
+	for _, alias := range sortedKeys(aliases) {
+		if imported, ok := v.files[aliases[alias]]; ok {
+			for _, file := range v.findPackage(imported.Package.Value) {
+				collect(alias+".", file.Structs, file.Enums)
+			}
+		}
+	}
+	return names
+}
+
 func (v *validatorP2) lookupType(parent ast.Container, name string) ast.Object {
 	components := strings.Split(name, ".")
 
@@ -104,6 +314,8 @@ func (v *validatorP2) lookupType(parent ast.Container, name string) ast.Object {
 	if unicode.IsLower([]rune(components[0])[0]) {
 		if alias, ok := v.f.ImportAliases[components[0]]; ok {
 			components[0] = v.files[alias].Package.Value
+		} else if alias, ok := v.publicAliases(v.f)[components[0]]; ok {
+			components[0] = v.files[alias].Package.Value
 		} else if components[0] == v.f.Package.Components[0] {
 			components[0] = v.f.Package.Value
 		}
@@ -154,60 +366,83 @@ func (v *validatorP2) findScopedType(ctx ast.Container, components []string) ast
 			if next == nil {
 				return nil
 			}
-			ctx = next
+			ctx = next.Original()
 			comp = comp[1:]
 		}
 	}
 }
 
-func (v *validatorP2) findPackage(name string) *ast.File {
-	for _, f := range v.files {
-		if f.Package.Value == name {
-			return f
+// publicAliases returns the files made visible to f by the public imports of
+// the files it imports, transitively, by alias. Aliases are the ones given
+// by the public imports, and the ones f declares itself take precedence.
+func (v *validatorP2) publicAliases(f *ast.File) map[string]string {
+	if res, ok := v.public[f]; ok {
+		return res
+	}
+	var imported []string
+	for _, imp := range f.Imports {
+		imported = append(imported, imp.Files...)
+	}
+	res := map[string]string{}
+	for _, imp := range publicImports(v.files, imported) {
+		target, ok := v.files[imp.ResolvedValue]
+		if !ok {
+			continue
+		}
+		alias := imp.Alias
+		if alias == "" {
+			alias = target.Package.Components[len(target.Package.Components)-1]
+		}
+		if _, ok := f.ImportAliases[alias]; !ok && res[alias] == "" {
+			res[alias] = imp.ResolvedValue
+		}
+	}
+	if v.public == nil {
+		v.public = map[*ast.File]map[string]string{}
+	}
+	v.public[f] = res
+	return res
+}
+
+// findPackage returns the files declaring the package name, sorted by path.
+func (v *validatorP2) findPackage(name string) []*ast.File {
+	var res []*ast.File
+	for _, path := range sortedKeys(v.files) {
+		if f := v.files[path]; f.Package.Value == name {
+			res = append(res, f)
 		}
 	}
-	return nil
+	return res
 }
 
 func (v *validatorP2) lookupFQN(components []string) ast.Object {
-	var target ast.Container
+	var targets []*ast.File
 	var i int
 	for i = range components {
 		fullPkg := strings.Join(components[:i+1], ".")
 
-		if p := v.findPackage(fullPkg); p != nil {
-			target = p
+		if files := v.findPackage(fullPkg); len(files) > 0 {
+			targets = files
 			break
 		}
 		if v.f.Package.Value == fullPkg {
-			target = v.f
+			targets = []*ast.File{v.f}
 			break
 		}
 	}
-	if target == nil {
+	name := components[i+1:]
+	if len(name) == 0 {
 		return nil
 	}
-	name := components[i+1:]
 
-	for {
-		switch len(name) {
-		case 1:
-			if e := target.FindEnum(name[0]); e != nil {
-				return e
-			}
-			if s := target.FindStruct(name[0]); s != nil {
-				return s
-			}
-			return nil
-		default:
-			next := target.FindStruct(name[0])
-			if next == nil {
-				return nil
-			}
-			target = next
-			name = name[1:]
+	// Packages imported by name may span several files, any of which may
+	// declare the type.
+	for _, target := range targets {
+		if obj := v.findScopedType(target, name); obj != nil {
+			return obj
 		}
 	}
+	return nil
 }
 
 func (v *validatorP2) validateMapKey(m *ast.MapType) {
@@ -220,39 +455,94 @@ func (v *validatorP2) validateMapKey(m *ast.MapType) {
 		v.invalidMapKeyType(t, m)
 	case *ast.ArrayType:
 		v.invalidMapKeyType(t, m)
+	case *ast.SetType:
+		v.invalidMapKeyType(t, m)
 	case *ast.MapType:
 		v.invalidMapKeyType(t, m)
 	}
 }
 
+// validateSetElement ensures the elements of s can be compared for
+// uniqueness, applying the same restrictions as map keys.
+func (v *validatorP2) validateSetElement(s *ast.SetType) {
+	switch t := s.Type.(type) {
+	case *ast.OptionalType, *ast.ArrayType, *ast.SetType, *ast.MapType:
+		v.Errorf(s.Position, "Cannot use %s as a set element", t.Kind())
+	}
+}
+
 func (v *validatorP2) invalidMapKeyType(t ast.Type, m *ast.MapType) {
 	pos := m.Position
-	v.Errorf("Cannot use %s as a map key at %s, line %d, column %d", t.Kind(), pos.Filename, pos.Line, pos.Column)
+	v.Errorf(pos, "Cannot use %s as a map key", t.Kind())
 }
 
 func (v *validatorP2) validateService(s *ast.Service) {
 	// At this point, the service has passed initial validation, so we can
 	// focus on type checks for each of its methods.
 
+	v.resolveAnnotations(v.f, s.Annotations)
+	if s.Timeout == 0 {
+		// Left unset by validatePhase1 when @timeout references a constant
+		s.Timeout = parseTimeout(s.Annotations, v.Errorf)
+	}
 	for _, m := range s.Methods {
 		v.validateMethod(m)
 	}
 }
 
 func (v *validatorP2) validateMethod(m *ast.ServiceMethod) {
+	v.resolveAnnotations(v.f, m.Annotations)
+	if m.Timeout == 0 {
+		m.Timeout = parseTimeout(m.Annotations, v.Errorf)
+	}
 	for _, p := range m.Params {
 		v.validateMethodParam(p.Type, &p.Position)
 	}
 	for _, p := range m.Returns {
+		if e, ok := p.Type.(*ast.EmptyType); ok {
+			if len(m.Returns) > 1 {
+				v.Errorf(e.Position, "empty cannot be returned along with other types; it may only be the single return of a method")
+			} else if p.Stream {
+				v.Errorf(p.Position, "empty cannot be streamed")
+			}
+			continue
+		}
 		v.validateMethodParam(p.Type, &p.Position)
 	}
+	v.validateMethodErrors(m)
+}
+
+// validateMethodErrors resolves the types thrown by m, which must be structs
+// or enums listed once.
+func (v *validatorP2) validateMethodErrors(m *ast.ServiceMethod) {
+	seen := map[ast.Object]*ast.MethodError{}
+	for _, e := range m.Errors {
+		v.resolveType(v.f, e.Type)
+		obj := e.Type.Resolved()
+		switch obj.(type) {
+		case nil:
+			// Reported by resolveType
+			continue
+		case *ast.Struct, *ast.Enum:
+		default:
+			v.Errorf(e.Position, "Methods can only throw structs and enums, but %s is a %s", obj.FQN(), strings.ToLower(obj.Kind()))
+			continue
+		}
+		if ex, ok := seen[obj]; ok {
+			v.Errorf(e.Position, "%s is already thrown by %s at line %d, column %d", obj.FQN(), m.Name, ex.Position.Line, ex.Position.Column)
+			continue
+		}
+		seen[obj] = e
+	}
 }
 
 func (v *validatorP2) validateMethodParam(t ast.Type, pos *ast.Position) {
 	switch tt := t.(type) {
 	case ast.ResolvableType:
 		v.resolveType(v.f, tt)
+	case *ast.EmptyType:
+		v.Errorf(tt.Position, "empty may only be used as the single return of a method")
 	default:
-		v.Errorf("Types used within methods are required to be user-defined structures. Cannot use %s at %s, line %d, column %d", t.Kind(), pos.Filename, pos.Line, pos.Column)
+		v.Errorf(*pos, "Types used within methods are required to be user-defined structures. Cannot use %s", t.Kind())
 	}
 }
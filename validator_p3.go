@@ -15,8 +15,24 @@ func validatePhase3(files map[string]*ast.File, entrypoint string) error {
 
 	v := &validatorP3{}
 
+	var structs func(list []*ast.Struct)
+	structs = func(list []*ast.Struct) {
+		for _, s := range list {
+			v.validateMaxSize(s)
+			structs(s.Structs)
+		}
+	}
+	structs(f.Structs)
+
 	for _, s := range f.Services {
 		v.detectDuplicatedMethods(s)
+		v.validateServiceErrors(s)
+		for _, m := range s.Methods {
+			v.validateHTTPBinding(m)
+			v.validateMethodSafety(m)
+			v.validateMethodErrors(m)
+			v.validateStability(m)
+		}
 	}
 
 	return errors.Join(v.errors...)
@@ -26,8 +42,14 @@ type validatorP3 struct {
 	errors []error
 }
 
-func (p *validatorP3) Errorf(format string, args ...interface{}) {
-	p.errors = append(p.errors, fmt.Errorf(format, args...))
+func (p *validatorP3) Errorf(pos ast.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, newDiagnostic(SeverityError, pos, format, args...))
+}
+
+// Reportf reports a violation of the rule identified by code, whose severity
+// may be overridden.
+func (p *validatorP3) Reportf(code string, pos ast.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, newCodedDiagnostic(code, SeverityError, pos, format, args...))
 }
 
 func (p *validatorP3) detectDuplicatedMethods(s *ast.Service) {
@@ -45,7 +67,7 @@ func (p *validatorP3) detectDuplicatedMethods(s *ast.Service) {
 }
 
 func (p *validatorP3) areMethodsDivergent(m *ast.ServiceMethod, ex *ast.ServiceMethod) bool {
-	if len(m.Params) != len(ex.Params) || len(m.Returns) != len(ex.Returns) {
+	if len(m.Params) != len(ex.Params) || len(m.Returns) != len(ex.Returns) || len(m.Errors) != len(ex.Errors) {
 		return true
 	}
 
@@ -63,9 +85,136 @@ func (p *validatorP3) areMethodsDivergent(m *ast.ServiceMethod, ex *ast.ServiceM
 		}
 	}
 
+	for i, va := range m.Errors {
+		if !va.Type.Eql(ex.Errors[i].Type) {
+			return true
+		}
+	}
+
 	return false
 }
 
 func (p *validatorP3) methodNameClash(m *ast.ServiceMethod, ex *ast.Position) {
-	p.Errorf("%s is already defined for %s at %s, line %d, column %d", m.Name, m.Service.Name, ex.File.Path, ex.Line, ex.Column)
+	p.Errorf(m.Position, "%s is already defined for %s at %s, line %d, column %d", m.Name, m.Service.Name, ex.Filename, ex.Line, ex.Column)
+}
+
+func (p *validatorP3) validateHTTPBinding(m *ast.ServiceMethod) {
+	a := m.Annotations.ByName("http")
+	if a == nil {
+		return
+	}
+	// Arguments were checked against the signature of @http by validatorP1
+	pos := a.Position
+	method, path := a.Arguments[0].(string), a.Arguments[1].(string)
+	if _, ok := httpMethods[method]; !ok {
+		p.Errorf(pos, "invalid HTTP method %s for method %s", method, m.Name)
+		return
+	}
+
+	segments, err := parseHTTPPath(path)
+	if err != nil {
+		p.Errorf(pos, "%s for method %s", err, m.Name)
+		return
+	}
+	for i, seg := range segments {
+		if seg.Variable == nil {
+			continue
+		}
+		field, err := bindHTTPVariable(m, seg.Variable)
+		if err != nil {
+			p.Errorf(pos, "%s", err)
+			return
+		}
+		segments[i].Field = field
+	}
+
+	m.HTTP = &ast.HTTPBinding{
+		Position: pos,
+		Method:   method,
+		Path:     path,
+		Segments: segments,
+	}
+}
+
+// safeHTTPMethods lists the HTTP methods @readonly methods may be bound to.
+var safeHTTPMethods = map[string]struct{}{
+	"GET":     {},
+	"HEAD":    {},
+	"OPTIONS": {},
+}
+
+func (p *validatorP3) validateMethodSafety(m *ast.ServiceMethod) {
+	idempotent := m.Annotations.ByName("idempotent")
+	readOnly := m.Annotations.ByName("readonly")
+	if readOnly != nil && m.HTTP != nil {
+		if _, ok := safeHTTPMethods[m.HTTP.Method]; !ok {
+			pos := readOnly.Position
+			p.Reportf(CodeReadOnlyHTTP, pos, "@readonly method %s cannot be bound to HTTP %s", m.Name, m.HTTP.Method)
+			return
+		}
+	}
+
+	m.ReadOnly = readOnly != nil
+	m.Idempotent = idempotent != nil || m.ReadOnly
+}
+
+func (p *validatorP3) validateServiceErrors(s *ast.Service) {
+	all := s.Annotations.AllByName("errors")
+	if len(all) == 0 {
+		return
+	}
+	a := all[0]
+	pos := a.Position
+	if len(all) > 1 {
+		pos = all[1].Position
+		p.Errorf(pos, "@errors declared more than once for service %s", s.Name)
+		return
+	}
+	if len(a.Arguments) != 1 || len(a.NamedArguments) != 0 {
+		p.Errorf(pos, "@errors expects exactly one enum for service %s", s.Name)
+		return
+	}
+	ref, ok := a.Arguments[0].(*ast.AnnotationReference)
+	if !ok {
+		p.Errorf(pos, "@errors expects an enum for service %s", s.Name)
+		return
+	}
+	e, ok := ref.Resolved().(*ast.Enum)
+	if !ok {
+		p.Errorf(pos, "@errors expects an enum, but %s is not one", ref.Name)
+		return
+	}
+	s.Errors = e
+}
+
+func (p *validatorP3) validateMethodErrors(m *ast.ServiceMethod) {
+	a := m.Annotations.ByName("errors")
+	if a == nil {
+		return
+	}
+	pos := a.Position
+	if m.Service.Errors == nil {
+		p.Errorf(pos, "method %s declares @errors, but service %s does not", m.Name, m.Service.Name)
+		return
+	}
+
+	seen := makeSet[*ast.EnumMember]()
+	var codes []*ast.EnumMember
+	for _, arg := range a.Arguments {
+		var member *ast.EnumMember
+		if ref, ok := arg.(*ast.AnnotationReference); ok {
+			member, _ = ref.Resolved().(*ast.EnumMember)
+		}
+		if member == nil || member.Enum != m.Service.Errors {
+			p.Errorf(pos, "@errors for method %s only accepts members of %s, got %v", m.Name, m.Service.Errors.Name, arg)
+			return
+		}
+		if seen.has(member) {
+			p.Errorf(pos, "@errors lists %s more than once for method %s", member.Name, m.Name)
+			return
+		}
+		seen.add(member)
+		codes = append(codes, member)
+	}
+	m.ErrorCodes = codes
 }
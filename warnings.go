@@ -0,0 +1,231 @@
+package idl
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// collectWarnings runs checks that do not prevent a schema from compiling, but
+// that most likely point to a mistake. It must only be called after all
+// validation phases succeeded. When imports is not nil, imports that Format
+// would rewrite are reported, and names longer than limits allow.
+func collectWarnings(files map[string]*ast.File, entrypoint string, imports *importNormalizer, limits NameLimits) []*Diagnostic {
+	f, ok := files[entrypoint]
+	if !ok {
+		return nil
+	}
+
+	w := &warner{files: files, limits: limits}
+	for _, s := range f.Structs {
+		w.checkStruct(s)
+	}
+	for _, e := range f.Enums {
+		w.checkEnum(e)
+	}
+	for _, s := range f.Services {
+		w.checkService(s)
+	}
+	w.checkDeprecatedUsages(f)
+	w.checkImports(f)
+	if imports != nil {
+		w.checkImportFormat(f, imports)
+	}
+	return w.warnings
+}
+
+type warner struct {
+	files    map[string]*ast.File
+	warnings []*Diagnostic
+	limits   NameLimits
+}
+
+func (w *warner) Warnf(code string, pos ast.Position, format string, args ...interface{}) {
+	w.warnings = append(w.warnings, newCodedDiagnostic(code, SeverityWarning, pos, format, args...))
+}
+
+func (w *warner) checkStruct(s *ast.Struct) {
+	if len(s.AllFields()) == 0 && s.Annotations.ByName("placeholder") == nil {
+		w.Warnf(CodeEmptyStruct, s.Position, "struct %s has no fields; annotate it with @placeholder if this is intended", s.Name)
+	}
+	w.checkName(s, s.Name)
+	for _, f := range s.Fields {
+		w.checkName(f, f.Name)
+	}
+	for _, ss := range s.Structs {
+		w.checkStruct(ss)
+	}
+	for _, e := range s.Enums {
+		w.checkEnum(e)
+	}
+}
+
+func (w *warner) checkEnum(e *ast.Enum) {
+	w.checkName(e, e.Name)
+	for _, m := range e.Members {
+		w.checkName(m, m.Name)
+	}
+}
+
+func (w *warner) checkService(s *ast.Service) {
+	if len(s.Methods) == 0 && s.Annotations.ByName("placeholder") == nil {
+		w.Warnf(CodeEmptyService, s.Position, "service %s has no methods; annotate it with @placeholder if this is intended", s.Name)
+	}
+	w.checkName(s, s.Name)
+	for _, m := range s.Methods {
+		w.checkName(m, m.Name)
+		for _, p := range m.Params {
+			if p.Name == nil || w.limits.Identifier == 0 {
+				continue
+			}
+			if n := utf8.RuneCountInString(*p.Name); n > w.limits.Identifier {
+				w.Warnf(CodeNameLength, p.Position, "method param name %s is %d characters long, exceeding the limit of %d", *p.Name, n, w.limits.Identifier)
+			}
+		}
+	}
+}
+
+// checkName reports name, declaring obj, and the fully qualified name of obj
+// when they exceed the configured limits.
+func (w *warner) checkName(obj ast.Object, name string) {
+	pos := *obj.Pos()
+	kind := strings.ToLower(obj.Kind())
+	if n := utf8.RuneCountInString(name); w.limits.Identifier > 0 && n > w.limits.Identifier {
+		w.Warnf(CodeNameLength, pos, "%s name %s is %d characters long, exceeding the limit of %d", kind, name, n, w.limits.Identifier)
+		return
+	}
+	if fqn := obj.FQN(); w.limits.FQN > 0 && utf8.RuneCountInString(fqn) > w.limits.FQN {
+		w.Warnf(CodeNameLength, pos, "fully qualified name %s of %s %s is %d characters long, exceeding the limit of %d", fqn, kind, name, utf8.RuneCountInString(fqn), w.limits.FQN)
+	}
+}
+
+// checkImports reports imports from which f does not reference any type or
+// enum member. Such imports are suggested to be removed.
+func (w *warner) checkImports(f *ast.File) {
+	used := map[string]bool{}
+	markType := func(t ast.Type) {
+		walkTypes(t, func(t ast.Type) {
+			if rt, ok := t.(ast.ResolvableType); ok && rt.Resolved() != nil {
+				used[rt.Resolved().Pos().Filename] = true
+			}
+		})
+	}
+	markAnnotations := func(set ast.AnnotationSet) {
+		for _, a := range set {
+			values := a.Arguments
+			for _, arg := range a.NamedArguments {
+				values = append(values, arg.Value)
+			}
+			for _, v := range values {
+				if ref, ok := v.(*ast.AnnotationReference); ok && ref.ResolvedObject != nil {
+					used[ref.ResolvedObject.Pos().Filename] = true
+				}
+			}
+		}
+	}
+
+	markEnum := func(e *ast.Enum) {
+		markAnnotations(e.Annotations)
+		for _, m := range e.Members {
+			markAnnotations(m.Annotations)
+		}
+	}
+	var markStruct func(s *ast.Struct)
+	markStruct = func(s *ast.Struct) {
+		markAnnotations(s.Annotations)
+		for _, field := range s.Fields {
+			markAnnotations(field.Annotations)
+			markType(field.Type)
+		}
+		for _, ss := range s.Structs {
+			markStruct(ss)
+		}
+		for _, e := range s.Enums {
+			markEnum(e)
+		}
+	}
+	for _, s := range f.Structs {
+		markStruct(s)
+	}
+	for _, e := range f.Enums {
+		markEnum(e)
+	}
+	for _, s := range f.Services {
+		markAnnotations(s.Annotations)
+		for _, m := range s.Methods {
+			markAnnotations(m.Annotations)
+			for _, p := range m.Params {
+				markType(p.Type)
+			}
+			for _, r := range m.Returns {
+				markType(r.Type)
+			}
+			for _, e := range m.Errors {
+				markType(e.Type)
+			}
+		}
+	}
+
+	for _, imp := range f.Imports {
+		if imp.Public {
+			// Re-exported to the files importing f
+			continue
+		}
+		// Types may be used through the public imports of the imported files
+		reachable := slices.Clone(imp.Files)
+		for _, public := range publicImports(w.files, imp.Files) {
+			reachable = append(reachable, public.Files...)
+		}
+		if slices.ContainsFunc(reachable, func(path string) bool { return used[path] }) {
+			continue
+		}
+		start := ast.Position{File: f, Filename: f.Path, Line: imp.Position.Line, Column: 1}
+		end := start
+		end.Line++
+		w.Warnf(CodeUnusedImport, imp.Position, "import %s is not used", imp.Value)
+		d := w.warnings[len(w.warnings)-1]
+		d.Fixes = append(d.Fixes, &Fix{
+			Title: "Remove unused import",
+			Edits: []TextEdit{{Start: start, End: end}},
+		})
+	}
+}
+
+// walkTypes calls fn for t and every type it is composed of.
+func walkTypes(t ast.Type, fn func(ast.Type)) {
+	if t == nil {
+		return
+	}
+	fn(t)
+	switch tt := t.(type) {
+	case *ast.OptionalType:
+		walkTypes(tt.Type, fn)
+	case *ast.ArrayType:
+		walkTypes(tt.Type, fn)
+	case *ast.SetType:
+		walkTypes(tt.Type, fn)
+	case *ast.MapType:
+		walkTypes(tt.Key, fn)
+		walkTypes(tt.Value, fn)
+	}
+}
+
+// checkImportFormat reports imports that are not sorted, duplicated, or not
+// written as Format would write them.
+func (w *warner) checkImportFormat(f *ast.File, n *importNormalizer) {
+	if len(f.Imports) == 0 {
+		return
+	}
+	specs := make([]importSpec, len(f.Imports))
+	for i, imp := range f.Imports {
+		specs[i] = importSpec{Value: imp.Value, Package: imp.ByPackage, Public: imp.Public}
+		if !imp.AliasSynthesized {
+			specs[i].Alias = imp.Alias
+		}
+	}
+	if !slices.Equal(specs, n.normalize(f.Path, specs)) {
+		w.Warnf(CodeImportFormat, f.Imports[0].Position, "imports are not formatted; run arf-idl fmt to sort and normalize them")
+	}
+}
@@ -0,0 +1,11 @@
+package wiresize
+
+import "github.com/arf-rpc/idl/ast"
+
+// PrimitiveSize exposes primitiveSize to tests.
+var PrimitiveSize = primitiveSize
+
+// UnionSize exposes the size of unions to tests.
+func UnionSize(u *ast.Union) Estimate {
+	return (&estimator{visiting: map[*ast.Struct]bool{}}).unionSize(u)
+}
@@ -0,0 +1,252 @@
+// Package wiresize estimates the encoded size of structs declared in validated
+// arf trees, helping teams budget payload sizes.
+//
+// Estimates assume a compact binary encoding: every present field carries a
+// one-byte header, integers and enums are varints, booleans take a single
+// byte, floats and timestamps have a fixed width, and strings, bytes,
+// collections and structs are prefixed by a varint length. Strings, bytes,
+// arrays and maps are unbounded unless their field is annotated with
+// @max_length("N"); the typical size assumes 16 bytes for strings and bytes
+// and 4 entries for collections. At most one member of a union is present, so
+// unions may be absent entirely, and otherwise take the size of their largest
+// member.
+package wiresize
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/arf-rpc/idl/ast"
+)
+
+// Unbounded is reported as Max when an estimate has no upper bound.
+const Unbounded = -1
+
+const (
+	typicalLength = 16
+	typicalItems  = 4
+)
+
+// Estimate holds the estimated encoded size of a value, in bytes.
+type Estimate struct {
+	Min, Typical, Max int
+}
+
+// Bounded reports whether the estimate has an upper bound.
+func (e Estimate) Bounded() bool { return e.Max != Unbounded }
+
+func (e Estimate) add(o Estimate) Estimate {
+	r := Estimate{Min: e.Min + o.Min, Typical: e.Typical + o.Typical, Max: e.Max + o.Max}
+	if !e.Bounded() || !o.Bounded() {
+		r.Max = Unbounded
+	}
+	return r
+}
+
+// StructEstimate associates a struct with its estimated size.
+type StructEstimate struct {
+	Struct *ast.Struct
+	Estimate
+}
+
+// EstimateStruct returns the estimated encoded size of s.
+func EstimateStruct(s *ast.Struct) Estimate {
+	return (&estimator{visiting: map[*ast.Struct]bool{}}).structSize(s)
+}
+
+// EstimateTree returns estimates for every struct in tree, including nested
+// ones, sorted by their fully-qualified name.
+func EstimateTree(tree *ast.Tree) []StructEstimate {
+	var result []StructEstimate
+	var walk func(s *ast.Struct)
+	walk = func(s *ast.Struct) {
+		result = append(result, StructEstimate{Struct: s, Estimate: EstimateStruct(s)})
+		for _, n := range s.Structs {
+			walk(n)
+		}
+	}
+	for _, pkg := range tree.Packages {
+		for _, s := range pkg.Structures {
+			walk(s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Struct.FQN() < result[j].Struct.FQN()
+	})
+	return result
+}
+
+// WriteTable writes estimates to w as an aligned table.
+func WriteTable(w io.Writer, estimates []StructEstimate) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "STRUCT\tMIN\tTYPICAL\tMAX\t")
+	for _, e := range estimates {
+		upper := "unbounded"
+		if e.Bounded() {
+			upper = strconv.Itoa(e.Max)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t\n", e.Struct.FQN(), e.Min, e.Typical, upper)
+	}
+	return tw.Flush()
+}
+
+type estimator struct {
+	visiting map[*ast.Struct]bool
+}
+
+func (e *estimator) structSize(s *ast.Struct) Estimate {
+	// A struct reached again while it is being estimated can nest
+	// indefinitely; only its length prefix counts towards the minimum.
+	if e.visiting[s] {
+		return Estimate{Min: 1, Typical: 1, Max: Unbounded}
+	}
+	e.visiting[s] = true
+	defer delete(e.visiting, s)
+
+	var body Estimate
+	for _, f := range s.AllFields() {
+		if f.Union != nil {
+			if f.Union.Fields[0] == f {
+				body = body.add(e.unionSize(f.Union))
+			}
+			continue
+		}
+		size := e.typeSize(f.Type, maxLength(f))
+		if _, ok := f.Type.(*ast.OptionalType); ok {
+			// Absent optionals are omitted entirely, header included.
+			size.Typical++
+			if size.Bounded() {
+				size.Max++
+			}
+		} else {
+			size = size.add(Estimate{1, 1, 1})
+		}
+		body = body.add(size)
+	}
+	return lengthPrefixed(body)
+}
+
+// unionSize returns the size of u, which is absent when none of its members is
+// set, and as large as its largest member otherwise.
+func (e *estimator) unionSize(u *ast.Union) Estimate {
+	var size Estimate
+	for _, f := range u.Fields {
+		m := e.typeSize(f.Type, maxLength(f)).add(Estimate{1, 1, 1})
+		size.Typical = max(size.Typical, m.Typical)
+		if !m.Bounded() || !size.Bounded() {
+			size.Max = Unbounded
+		} else {
+			size.Max = max(size.Max, m.Max)
+		}
+	}
+	return size
+}
+
+func (e *estimator) typeSize(t ast.Type, limit int) Estimate {
+	switch tt := t.(type) {
+	case *ast.PrimitiveType:
+		return primitiveSize(tt.Name, limit)
+	case *ast.OptionalType:
+		inner := e.typeSize(tt.Type, limit)
+		inner.Min = 0
+		return inner
+	case *ast.ArrayType:
+		return collection(e.typeSize(tt.Type, 0), limit)
+	case *ast.SetType:
+		return collection(e.typeSize(tt.Type, 0), limit)
+	case *ast.MapType:
+		return collection(e.typeSize(tt.Key, 0).add(e.typeSize(tt.Value, 0)), limit)
+	case ast.ResolvableType:
+		switch o := tt.Resolved().(type) {
+		case *ast.Struct:
+			return e.structSize(o)
+		case *ast.Enum:
+			var largest uint64
+			for _, m := range o.Members {
+				if m.Value < 0 {
+					// Negative values are sign-extended to a full varint
+					return Estimate{1, 1, 10}
+				}
+				largest = max(largest, uint64(m.Value))
+			}
+			return Estimate{1, 1, varintLen(largest)}
+		}
+	}
+	return Estimate{}
+}
+
+func primitiveSize(name string, limit int) Estimate {
+	switch name {
+	case "bool":
+		return Estimate{1, 1, 1}
+	case "int8", "uint8":
+		return Estimate{1, 1, 2}
+	case "int16", "uint16":
+		return Estimate{1, 2, 3}
+	case "int32", "uint32":
+		return Estimate{1, 3, 5}
+	case "int64", "uint64", "duration":
+		return Estimate{1, 4, 10}
+	case "float32":
+		return Estimate{4, 4, 4}
+	case "uuid", "decimal128":
+		return Estimate{16, 16, 16}
+	case "float64", "timestamp":
+		return Estimate{8, 8, 8}
+	case "string", "bytes":
+		typical := typicalLength
+		if limit > 0 && limit < typical {
+			typical = limit
+		}
+		size := Estimate{Min: 1, Typical: 1 + typical, Max: Unbounded}
+		if limit > 0 {
+			size.Max = varintLen(uint64(limit)) + limit
+		}
+		return size
+	}
+	return Estimate{}
+}
+
+func collection(item Estimate, limit int) Estimate {
+	items := typicalItems
+	if limit > 0 && limit < items {
+		items = limit
+	}
+	size := Estimate{Min: 1, Typical: 1 + items*item.Typical, Max: Unbounded}
+	if limit > 0 && item.Bounded() {
+		size.Max = varintLen(uint64(limit)) + limit*item.Max
+	}
+	return size
+}
+
+func lengthPrefixed(body Estimate) Estimate {
+	size := Estimate{
+		Min:     body.Min + varintLen(uint64(body.Min)),
+		Typical: body.Typical + varintLen(uint64(body.Typical)),
+		Max:     Unbounded,
+	}
+	if body.Bounded() {
+		size.Max = body.Max + varintLen(uint64(body.Max))
+	}
+	return size
+}
+
+// maxLength returns the limit set by a @max_length annotation on f, or zero.
+func maxLength(f *ast.StructField) int {
+	if f.Constraints == nil {
+		return 0
+	}
+	return int(f.Constraints.MaxLength)
+}
+
+func varintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package wiresize_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arf-rpc/idl"
+	"github.com/arf-rpc/idl/wiresize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateStruct(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sizes.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package example.sizes;
+
+struct Point {
+    x float32;
+    y float32;
+}
+
+struct User {
+    @max_length("10")
+    name  string;
+    email optional<string>;
+    level Level;
+}
+
+struct Path {
+    @max_length("3")
+    points array<Point>;
+}
+
+enum Level {
+    LOW = 1;
+    HIGH = 200;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+	file := tree.Packages["example.sizes"].Files[0]
+
+	// Two headers and two floats, behind a one byte length prefix.
+	require.Equal(t, wiresize.Estimate{11, 11, 11}, wiresize.EstimateStruct(file.FindStruct("Point")))
+
+	user := wiresize.EstimateStruct(file.FindStruct("User"))
+	require.Equal(t, 5, user.Min)
+	require.False(t, user.Bounded())
+
+	path3 := wiresize.EstimateStruct(file.FindStruct("Path"))
+	require.Equal(t, wiresize.Estimate{Min: 3, Typical: 36, Max: 36}, path3)
+
+	var buf bytes.Buffer
+	require.NoError(t, wiresize.WriteTable(&buf, wiresize.EstimateTree(tree)))
+	require.Equal(t, `               STRUCT  MIN  TYPICAL        MAX
+   example.sizes.Path    3       36         36
+  example.sizes.Point   11       11         11
+   example.sizes.User    5       33  unbounded
+`, buf.String())
+}
+
+func TestEstimateRecursive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.arf")
+	require.NoError(t, os.WriteFile(path, []byte(`package example.tree;
+
+struct Node {
+    parent optional<Node>;
+}
+`), 0o644))
+	tree, err := idl.Parse(path)
+	require.NoError(t, err)
+
+	e := wiresize.EstimateStruct(tree.Packages["example.tree"].Files[0].FindStruct("Node"))
+	require.Equal(t, 1, e.Min)
+	require.False(t, e.Bounded())
+}
+
+func TestEstimateUnions(t *testing.T) {
+	tree, err := idl.Parse("../fixtures/unions.arf")
+	require.NoError(t, err)
+	contact := tree.Packages["contacts"].FindStruct("Contact")
+
+	// Absent, or as large as the 32 bytes long email, behind its length and
+	// header.
+	require.Equal(t, wiresize.Estimate{Min: 0, Typical: 18, Max: 34}, wiresize.UnionSize(contact.Unions[0]))
+	require.Equal(t, wiresize.Estimate{Min: 3, Typical: 55, Max: wiresize.Unbounded}, wiresize.EstimateStruct(contact))
+}
+
+func TestPrimitiveSizes(t *testing.T) {
+	// Booleans take a single byte, while 8-bit integers are varints which
+	// may take two.
+	require.Equal(t, wiresize.Estimate{1, 1, 1}, wiresize.PrimitiveSize("bool", 0))
+	require.Equal(t, wiresize.Estimate{1, 1, 2}, wiresize.PrimitiveSize("int8", 0))
+	require.Equal(t, wiresize.Estimate{8, 8, 8}, wiresize.PrimitiveSize("float64", 0))
+}